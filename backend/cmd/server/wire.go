@@ -97,6 +97,10 @@ func provideCleanup(
 	scheduledTestRunner *service.ScheduledTestRunnerService,
 	backupSvc *service.BackupService,
 	paymentOrderExpiry *service.PaymentOrderExpiryService,
+	referralSvc *service.ReferralService,
+	privacySvc *service.PrivacyService,
+	clusterSvc *service.ClusterService,
+	budgetSvc *service.BudgetService,
 ) func() {
 	return func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -239,6 +243,30 @@ func provideCleanup(
 				}
 				return nil
 			}},
+			{"ReferralService", func() error {
+				if referralSvc != nil {
+					referralSvc.Stop()
+				}
+				return nil
+			}},
+			{"PrivacyService", func() error {
+				if privacySvc != nil {
+					privacySvc.Stop()
+				}
+				return nil
+			}},
+			{"ClusterService", func() error {
+				if clusterSvc != nil {
+					clusterSvc.Stop()
+				}
+				return nil
+			}},
+			{"BudgetService", func() error {
+				if budgetSvc != nil {
+					budgetSvc.Stop()
+				}
+				return nil
+			}},
 		}
 
 		infraSteps := []cleanupStep{
@@ -78,7 +78,18 @@ func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
 	}
 	totpCache := repository.NewTotpCache(redisClient)
 	totpService := service.NewTotpService(userRepository, secretEncryptor, totpCache, settingService, emailService, emailQueueService)
-	authHandler := handler.NewAuthHandler(configConfig, authService, userService, settingService, promoService, redeemService, totpService)
+	ldapAuthService := service.NewLDAPAuthService(configConfig)
+	samlService := service.NewSAMLService(configConfig)
+	directoryGroupSyncService := service.NewDirectoryGroupSyncService(userRepository, subscriptionService, apiKeyAuthCacheInvalidator)
+	directoryLinkRepository := repository.NewDirectoryLinkRepository(db)
+	directorySSOService := service.NewDirectorySSOService(authService, userRepository, directoryLinkRepository, ldapAuthService, samlService, directoryGroupSyncService)
+	recoveryCodeRepository := repository.NewRecoveryCodeRepository(db)
+	recoveryCodeService := service.NewRecoveryCodeService(recoveryCodeRepository, totpService)
+	passkeyRepository := repository.NewPasskeyRepository(db)
+	passkeyCache := repository.NewPasskeyCache(redisClient)
+	passkeyService := service.NewPasskeyService(configConfig, userRepository, passkeyRepository, passkeyCache, settingService, totpService)
+	twoFactorService := service.NewTwoFactorService(settingService, totpService, passkeyService, recoveryCodeService)
+	authHandler := handler.NewAuthHandler(configConfig, authService, userService, settingService, promoService, redeemService, totpService, directorySSOService, twoFactorService, passkeyService)
 	userHandler := handler.NewUserHandler(userService, emailService, emailCache)
 	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
 	usageLogRepository := repository.NewUsageLogRepository(client, db)
@@ -106,7 +117,9 @@ func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
 	privacyClientFactory := providePrivacyClientFactory()
 	adminService := service.NewAdminService(userRepository, groupRepository, accountRepository, proxyRepository, apiKeyRepository, redeemCodeRepository, userGroupRateRepository, billingCacheService, proxyExitInfoProber, proxyLatencyCache, apiKeyAuthCacheInvalidator, client, settingService, subscriptionService, userSubscriptionRepository, privacyClientFactory)
 	concurrencyCache := repository.ProvideConcurrencyCache(redisClient, configConfig)
-	concurrencyService := service.ProvideConcurrencyService(concurrencyCache, accountRepository, configConfig)
+	apiKeyPriorityRepository := repository.NewAPIKeyPriorityRepository(db)
+	requestPriorityService := service.ProvideRequestPriorityService(apiKeyPriorityRepository, configConfig, apiKeyService)
+	concurrencyService := service.ProvideConcurrencyService(concurrencyCache, accountRepository, configConfig, requestPriorityService)
 	adminUserHandler := admin.NewUserHandler(adminService, concurrencyService)
 	sessionLimitCache := repository.ProvideSessionLimitCache(redisClient, configConfig)
 	rpmCache := repository.NewRPMCache(redisClient)
@@ -135,16 +148,21 @@ func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
 	tlsFingerprintProfileRepository := repository.NewTLSFingerprintProfileRepository(client)
 	tlsFingerprintProfileCache := repository.NewTLSFingerprintProfileCache(redisClient)
 	tlsFingerprintProfileService := service.NewTLSFingerprintProfileService(tlsFingerprintProfileRepository, tlsFingerprintProfileCache)
-	accountUsageService := service.NewAccountUsageService(accountRepository, usageLogRepository, claudeUsageFetcher, geminiQuotaService, antigravityQuotaFetcher, usageCache, identityCache, tlsFingerprintProfileService)
+	quotaForecastService := service.NewQuotaForecastService(configConfig)
+	accountUsageService := service.NewAccountUsageService(accountRepository, usageLogRepository, claudeUsageFetcher, geminiQuotaService, antigravityQuotaFetcher, usageCache, identityCache, tlsFingerprintProfileService, quotaForecastService)
 	oAuthRefreshAPI := service.NewOAuthRefreshAPI(accountRepository, geminiTokenCache)
 	geminiTokenProvider := service.ProvideGeminiTokenProvider(accountRepository, geminiTokenCache, geminiOAuthService, oAuthRefreshAPI)
+	vertexTokenClient := repository.NewVertexTokenClient()
+	vertexTokenProvider := service.NewVertexTokenProvider(vertexTokenClient, geminiTokenCache)
+	azureOpenAITokenClient := repository.NewAzureOpenAITokenClient()
+	azureOpenAITokenProvider := service.NewAzureOpenAITokenProvider(azureOpenAITokenClient, geminiTokenCache)
 	gatewayCache := repository.NewGatewayCache(redisClient)
 	schedulerOutboxRepository := repository.NewSchedulerOutboxRepository(db)
 	schedulerSnapshotService := service.ProvideSchedulerSnapshotService(schedulerCache, schedulerOutboxRepository, accountRepository, groupRepository, configConfig)
 	antigravityTokenProvider := service.ProvideAntigravityTokenProvider(accountRepository, geminiTokenCache, antigravityOAuthService, oAuthRefreshAPI, tempUnschedCache)
 	internal500CounterCache := repository.NewInternal500CounterCache(redisClient)
 	antigravityGatewayService := service.NewAntigravityGatewayService(accountRepository, gatewayCache, schedulerSnapshotService, antigravityTokenProvider, rateLimitService, httpUpstream, settingService, internal500CounterCache)
-	accountTestService := service.NewAccountTestService(accountRepository, geminiTokenProvider, antigravityGatewayService, httpUpstream, configConfig, tlsFingerprintProfileService)
+	accountTestService := service.NewAccountTestService(accountRepository, geminiTokenProvider, vertexTokenProvider, azureOpenAITokenProvider, antigravityGatewayService, httpUpstream, configConfig, tlsFingerprintProfileService)
 	crsSyncService := service.NewCRSSyncService(accountRepository, proxyRepository, oAuthService, openAIOAuthService, geminiOAuthService, configConfig)
 	accountHandler := admin.NewAccountHandler(adminService, oAuthService, openAIOAuthService, geminiOAuthService, antigravityOAuthService, rateLimitService, accountUsageService, accountTestService, concurrencyService, crsSyncService, sessionLimitCache, rpmCache, compositeTokenCacheInvalidator)
 	adminAnnouncementHandler := admin.NewAnnouncementHandler(announcementService)
@@ -177,10 +195,12 @@ func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
 	channelService := service.NewChannelService(channelRepository, apiKeyAuthCacheInvalidator)
 	modelPricingResolver := service.NewModelPricingResolver(channelService, billingService)
 	balanceNotifyService := service.ProvideBalanceNotifyService(emailService, settingRepository, accountRepository)
-	gatewayService := service.NewGatewayService(accountRepository, groupRepository, usageLogRepository, usageBillingRepository, userRepository, userSubscriptionRepository, userGroupRateRepository, gatewayCache, configConfig, schedulerSnapshotService, concurrencyService, billingService, rateLimitService, billingCacheService, identityService, httpUpstream, deferredService, claudeTokenProvider, sessionLimitCache, rpmCache, digestSessionStore, settingService, tlsFingerprintProfileService, channelService, modelPricingResolver, balanceNotifyService)
+	promptCacheRepository := repository.NewPromptCacheRepository(db)
+	promptCacheService := service.ProvidePromptCacheService(promptCacheRepository, groupRepository, billingService, usageService)
+	gatewayService := service.NewGatewayService(accountRepository, groupRepository, usageLogRepository, usageBillingRepository, userRepository, userSubscriptionRepository, userGroupRateRepository, gatewayCache, configConfig, schedulerSnapshotService, concurrencyService, billingService, rateLimitService, billingCacheService, identityService, httpUpstream, deferredService, claudeTokenProvider, vertexTokenProvider, sessionLimitCache, rpmCache, digestSessionStore, settingService, tlsFingerprintProfileService, channelService, modelPricingResolver, balanceNotifyService, quotaForecastService, promptCacheService)
 	openAITokenProvider := service.ProvideOpenAITokenProvider(accountRepository, geminiTokenCache, openAIOAuthService, oAuthRefreshAPI)
-	openAIGatewayService := service.NewOpenAIGatewayService(accountRepository, usageLogRepository, usageBillingRepository, userRepository, userSubscriptionRepository, userGroupRateRepository, gatewayCache, configConfig, schedulerSnapshotService, concurrencyService, billingService, rateLimitService, billingCacheService, httpUpstream, deferredService, openAITokenProvider, modelPricingResolver, channelService, balanceNotifyService)
-	geminiMessagesCompatService := service.NewGeminiMessagesCompatService(accountRepository, groupRepository, gatewayCache, schedulerSnapshotService, geminiTokenProvider, rateLimitService, httpUpstream, antigravityGatewayService, configConfig)
+	openAIGatewayService := service.NewOpenAIGatewayService(accountRepository, usageLogRepository, usageBillingRepository, userRepository, userSubscriptionRepository, userGroupRateRepository, gatewayCache, configConfig, schedulerSnapshotService, concurrencyService, billingService, rateLimitService, billingCacheService, httpUpstream, deferredService, openAITokenProvider, azureOpenAITokenProvider, modelPricingResolver, channelService, balanceNotifyService, quotaForecastService)
+	geminiMessagesCompatService := service.NewGeminiMessagesCompatService(accountRepository, groupRepository, gatewayCache, schedulerSnapshotService, geminiTokenProvider, vertexTokenProvider, rateLimitService, httpUpstream, antigravityGatewayService, configConfig)
 	opsSystemLogSink := service.ProvideOpsSystemLogSink(opsRepository)
 	opsService := service.NewOpsService(opsRepository, settingRepository, configConfig, accountRepository, userRepository, concurrencyService, gatewayService, openAIGatewayService, geminiMessagesCompatService, antigravityGatewayService, opsSystemLogSink)
 	opsHandler := admin.NewOpsHandler(opsService)
@@ -218,22 +238,55 @@ func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
 	defaultLoadBalancer := payment.ProvideDefaultLoadBalancer(client, encryptionKey)
 	paymentConfigService := service.ProvidePaymentConfigService(client, settingRepository, encryptionKey)
 	paymentService := service.NewPaymentService(client, registry, defaultLoadBalancer, redeemService, subscriptionService, paymentConfigService, userRepository, groupRepository)
-	settingHandler := admin.NewSettingHandler(settingService, emailService, turnstileService, opsService, paymentConfigService, paymentService)
+	settingHandler := admin.NewSettingHandler(settingService, emailService, turnstileService, opsService, paymentConfigService, paymentService, passkeyService)
 	paymentOrderExpiryService := service.ProvidePaymentOrderExpiryService(paymentService)
 	paymentHandler := admin.NewPaymentHandler(paymentService, paymentConfigService)
-	adminHandlers := handler.ProvideAdminHandlers(dashboardHandler, adminUserHandler, groupHandler, accountHandler, adminAnnouncementHandler, dataManagementHandler, backupHandler, oAuthHandler, openAIOAuthHandler, geminiOAuthHandler, antigravityOAuthHandler, proxyHandler, adminRedeemHandler, promoHandler, settingHandler, opsHandler, systemHandler, adminSubscriptionHandler, adminUsageHandler, userAttributeHandler, errorPassthroughHandler, tlsFingerprintProfileHandler, adminAPIKeyHandler, scheduledTestHandler, channelHandler, paymentHandler)
+	referralRepository := repository.NewReferralRepository(db)
+	referralService := service.ProvideReferralService(referralRepository, settingRepository, billingCacheService, apiKeyAuthCacheInvalidator, authService, paymentService)
+	referralHandler := admin.NewReferralHandler(referralService)
+	shadowRepository := repository.NewShadowRepository(db)
+	shadowService := service.NewShadowService(shadowRepository, groupRepository, gatewayService, concurrencyService, billingService, configConfig)
+	shadowHandler := admin.NewShadowHandler(shadowService)
+	configAsCodeService := service.NewConfigAsCodeService(adminService, channelService, errorPassthroughService, tlsFingerprintProfileService, settingService, systemOperationLockService)
+	configHandler := admin.NewConfigHandler(configAsCodeService)
+	promptCacheHandler := admin.NewPromptCacheHandler(promptCacheService)
+	modelCatalogService := service.NewModelCatalogService(gatewayService, pricingService, modelPricingResolver, channelService, groupRepository, configConfig)
+	contextPolicyRepository := repository.NewContextPolicyRepository(db)
+	contextPolicyService := service.NewContextPolicyService(contextPolicyRepository, groupRepository, modelCatalogService)
+	contextPolicyHandler := admin.NewContextPolicyHandler(contextPolicyService)
+	adminHandlers := handler.ProvideAdminHandlers(dashboardHandler, adminUserHandler, groupHandler, accountHandler, adminAnnouncementHandler, dataManagementHandler, backupHandler, oAuthHandler, openAIOAuthHandler, geminiOAuthHandler, antigravityOAuthHandler, proxyHandler, adminRedeemHandler, promoHandler, settingHandler, opsHandler, systemHandler, adminSubscriptionHandler, adminUsageHandler, userAttributeHandler, errorPassthroughHandler, tlsFingerprintProfileHandler, adminAPIKeyHandler, scheduledTestHandler, channelHandler, paymentHandler, referralHandler, shadowHandler, configHandler, promptCacheHandler, contextPolicyHandler)
 	usageRecordWorkerPool := service.NewUsageRecordWorkerPool(configConfig)
 	userMsgQueueCache := repository.NewUserMsgQueueCache(redisClient)
 	userMessageQueueService := service.ProvideUserMessageQueueService(userMsgQueueCache, rpmCache, configConfig)
-	gatewayHandler := handler.NewGatewayHandler(gatewayService, geminiMessagesCompatService, antigravityGatewayService, userService, concurrencyService, billingCacheService, usageService, apiKeyService, usageRecordWorkerPool, errorPassthroughService, userMessageQueueService, configConfig, settingService)
-	openAIGatewayHandler := handler.NewOpenAIGatewayHandler(openAIGatewayService, concurrencyService, billingCacheService, apiKeyService, usageRecordWorkerPool, errorPassthroughService, configConfig)
+	fairShareService := service.ProvideFairShareService(settingService, schedulerSnapshotService, opsService)
+	gatewayHandler := handler.NewGatewayHandler(gatewayService, geminiMessagesCompatService, antigravityGatewayService, userService, concurrencyService, billingCacheService, usageService, apiKeyService, usageRecordWorkerPool, errorPassthroughService, userMessageQueueService, configConfig, settingService, modelCatalogService, shadowService, fairShareService, contextPolicyService)
+	openAIGatewayHandler := handler.NewOpenAIGatewayHandler(openAIGatewayService, concurrencyService, billingCacheService, apiKeyService, usageRecordWorkerPool, errorPassthroughService, configConfig, fairShareService)
 	handlerSettingHandler := handler.ProvideSettingHandler(settingService, buildInfo)
-	totpHandler := handler.NewTotpHandler(totpService)
+	totpHandler := handler.NewTotpHandler(totpService, userService, twoFactorService, recoveryCodeService)
+	passkeyHandler := handler.NewPasskeyHandler(passkeyService, userService, twoFactorService, recoveryCodeService)
 	handlerPaymentHandler := handler.NewPaymentHandler(paymentService, paymentConfigService, channelService)
 	paymentWebhookHandler := handler.NewPaymentWebhookHandler(paymentService, registry)
+	handlerReferralHandler := handler.NewReferralHandler(referralService)
+	budgetRepository := repository.NewBudgetRepository(db)
+	budgetSpendCache := repository.NewBudgetSpendCache(redisClient)
+	budgetService := service.ProvideBudgetService(budgetRepository, budgetSpendCache, userRepository, apiKeyRepository, emailQueueService, settingRepository, billingCacheService)
+	budgetHandler := handler.NewBudgetHandler(budgetService)
+	privacyRepository := repository.NewPrivacyRepository(db)
+	privacyService := service.ProvidePrivacyService(privacyRepository, userRepository, apiKeyAuthCacheInvalidator, refreshTokenCache, emailQueueService, settingRepository, configConfig)
+	clusterStateCache := repository.NewClusterStateCache(redisClient)
+	clusterService := service.ProvideClusterService(clusterStateCache, configConfig, digestSessionStore, openAIGatewayService, opsService)
+	privacyHandler := handler.NewPrivacyHandler(privacyService)
+	modelCatalogHandler := handler.NewModelCatalogHandler(modelCatalogService)
+	oAuthServerCache := repository.NewOAuthServerCache(redisClient)
+	oAuthGrantRepository := repository.NewOAuthGrantRepository(db)
+	oAuthServerService := service.NewOAuthServerService(configConfig, oAuthServerCache, oAuthGrantRepository, apiKeyService, settingService)
+	oAuthServerHandler := handler.NewOAuthServerHandler(oAuthServerService)
+	scimRepository := repository.NewSCIMRepository(db)
+	scimService := service.NewSCIMService(configConfig, userRepository, groupRepository, scimRepository, adminService, settingService, authService, apiKeyAuthCacheInvalidator)
+	scimHandler := handler.NewSCIMHandler(scimService)
 	idempotencyCoordinator := service.ProvideIdempotencyCoordinator(idempotencyRepository, configConfig)
 	idempotencyCleanupService := service.ProvideIdempotencyCleanupService(idempotencyRepository, configConfig)
-	handlers := handler.ProvideHandlers(authHandler, userHandler, apiKeyHandler, usageHandler, redeemHandler, subscriptionHandler, announcementHandler, adminHandlers, gatewayHandler, openAIGatewayHandler, handlerSettingHandler, totpHandler, handlerPaymentHandler, paymentWebhookHandler, idempotencyCoordinator, idempotencyCleanupService)
+	handlers := handler.ProvideHandlers(authHandler, userHandler, apiKeyHandler, usageHandler, redeemHandler, subscriptionHandler, announcementHandler, adminHandlers, gatewayHandler, openAIGatewayHandler, handlerSettingHandler, totpHandler, passkeyHandler, handlerPaymentHandler, paymentWebhookHandler, handlerReferralHandler, budgetHandler, privacyHandler, modelCatalogHandler, oAuthServerHandler, scimHandler, idempotencyCoordinator, idempotencyCleanupService)
 	jwtAuthMiddleware := middleware.NewJWTAuthMiddleware(authService, userService)
 	adminAuthMiddleware := middleware.NewAdminAuthMiddleware(authService, userService, settingService)
 	apiKeyAuthMiddleware := middleware.NewAPIKeyAuthMiddleware(apiKeyService, subscriptionService, configConfig)
@@ -248,7 +301,7 @@ func initializeApplication(buildInfo handler.BuildInfo) (*Application, error) {
 	accountExpiryService := service.ProvideAccountExpiryService(accountRepository)
 	subscriptionExpiryService := service.ProvideSubscriptionExpiryService(userSubscriptionRepository)
 	scheduledTestRunnerService := service.ProvideScheduledTestRunnerService(scheduledTestPlanRepository, scheduledTestService, accountTestService, rateLimitService, configConfig)
-	v := provideCleanup(client, redisClient, opsMetricsCollector, opsAggregationService, opsAlertEvaluatorService, opsCleanupService, opsScheduledReportService, opsSystemLogSink, schedulerSnapshotService, tokenRefreshService, accountExpiryService, subscriptionExpiryService, usageCleanupService, idempotencyCleanupService, pricingService, emailQueueService, billingCacheService, usageRecordWorkerPool, subscriptionService, oAuthService, openAIOAuthService, geminiOAuthService, antigravityOAuthService, openAIGatewayService, scheduledTestRunnerService, backupService, paymentOrderExpiryService)
+	v := provideCleanup(client, redisClient, opsMetricsCollector, opsAggregationService, opsAlertEvaluatorService, opsCleanupService, opsScheduledReportService, opsSystemLogSink, schedulerSnapshotService, tokenRefreshService, accountExpiryService, subscriptionExpiryService, usageCleanupService, idempotencyCleanupService, pricingService, emailQueueService, billingCacheService, usageRecordWorkerPool, subscriptionService, oAuthService, openAIOAuthService, geminiOAuthService, antigravityOAuthService, openAIGatewayService, scheduledTestRunnerService, backupService, paymentOrderExpiryService, referralService, privacyService, clusterService, budgetService)
 	application := &Application{
 		Server:  httpServer,
 		Cleanup: v,
@@ -302,6 +355,10 @@ func provideCleanup(
 	scheduledTestRunner *service.ScheduledTestRunnerService,
 	backupSvc *service.BackupService,
 	paymentOrderExpiry *service.PaymentOrderExpiryService,
+	referralSvc *service.ReferralService,
+	privacySvc *service.PrivacyService,
+	clusterSvc *service.ClusterService,
+	budgetSvc *service.BudgetService,
 ) func() {
 	return func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -443,6 +500,30 @@ func provideCleanup(
 				}
 				return nil
 			}},
+			{"ReferralService", func() error {
+				if referralSvc != nil {
+					referralSvc.Stop()
+				}
+				return nil
+			}},
+			{"PrivacyService", func() error {
+				if privacySvc != nil {
+					privacySvc.Stop()
+				}
+				return nil
+			}},
+			{"ClusterService", func() error {
+				if clusterSvc != nil {
+					clusterSvc.Stop()
+				}
+				return nil
+			}},
+			{"BudgetService", func() error {
+				if budgetSvc != nil {
+					budgetSvc.Stop()
+				}
+				return nil
+			}},
 		}
 
 		infraSteps := []cleanupStep{
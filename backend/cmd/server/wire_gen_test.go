@@ -76,6 +76,10 @@ func TestProvideCleanup_WithMinimalDependencies_NoPanic(t *testing.T) {
 		nil, // scheduledTestRunner
 		nil, // backupSvc
 		nil, // paymentOrderExpiry
+		nil, // referralSvc
+		nil, // privacySvc
+		nil, // clusterSvc
+		nil, // budgetSvc
 	)
 
 	require.NotPanics(t, func() {
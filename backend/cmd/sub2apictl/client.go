@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const adminAPIPrefix = "/api/v1/admin"
+
+// adminClient 管理端 API 客户端，使用 Admin API Key（x-api-key）认证
+type adminClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// apiEnvelope 对应 pkg/response.Response
+type apiEnvelope struct {
+	Code     int               `json:"code"`
+	Message  string            `json:"message"`
+	Reason   string            `json:"reason,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Data     json.RawMessage   `json:"data,omitempty"`
+}
+
+// apiError 服务端返回的业务错误
+type apiError struct {
+	Status   int
+	Code     int
+	Reason   string
+	Message  string
+	Metadata map[string]string
+}
+
+func (e *apiError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP %d", e.Status)
+	if e.Reason != "" {
+		fmt.Fprintf(&b, " %s", e.Reason)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	keys := make([]string, 0, len(e.Metadata))
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n  %s=%s", k, e.Metadata[k])
+	}
+	return b.String()
+}
+
+func newAdminClient(baseURL, apiKey string, httpClient *http.Client) *adminClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &adminClient{
+		baseURL:    strings.TrimRight(strings.TrimSpace(baseURL), "/"),
+		apiKey:     strings.TrimSpace(apiKey),
+		httpClient: httpClient,
+	}
+}
+
+func (c *adminClient) endpoint(path string, query url.Values) string {
+	u := c.baseURL + adminAPIPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// newRequest 构造请求；body 为 []byte 时按原样发送，否则序列化为 JSON
+func (c *adminClient) newRequest(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	var reader io.Reader
+	contentType := ""
+	switch v := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(v)
+		contentType = "application/yaml"
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(raw)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint(path, query), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// do 发送请求并解开响应信封，返回 data 字段原文
+func (c *adminClient) do(ctx context.Context, method, path string, query url.Values, body any) (json.RawMessage, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	var env apiEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &apiError{Status: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+		}
+		return nil, fmt.Errorf("decode response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest || env.Code != 0 {
+		return nil, &apiError{
+			Status:   resp.StatusCode,
+			Code:     env.Code,
+			Reason:   env.Reason,
+			Message:  env.Message,
+			Metadata: env.Metadata,
+		}
+	}
+	return env.Data, nil
+}
+
+// stream 发送请求并逐条回调 SSE data 行（用于账号测试等流式接口）
+func (c *adminClient) stream(ctx context.Context, method, path string, body any, onData func(data []byte) error) error {
+	req, err := c.newRequest(ctx, method, path, nil, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var env apiEnvelope
+		if json.Unmarshal(raw, &env) == nil && env.Message != "" {
+			return &apiError{Status: resp.StatusCode, Code: env.Code, Reason: env.Reason, Message: env.Message, Metadata: env.Metadata}
+		}
+		return &apiError{Status: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+	}
+
+	return readSSE(resp.Body, onData)
+}
+
+// websocketURL 将 http(s) 基址转换为 ws(s)
+func (c *adminClient) websocketURL(path string) (string, error) {
+	u, err := url.Parse(c.endpoint(path, nil))
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", fmt.Errorf("unsupported server scheme %q", u.Scheme)
+	}
+	return u.String(), nil
+}
+
+// readSSE 解析 text/event-stream，只关心 data 行
+func readSSE(r io.Reader, onData func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		if err := onData([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	accountListColumns = []string{"id", "name", "platform", "type", "status", "schedulable", "priority", "concurrency", "error_message"}
+	accountColumns     = []string{"id", "name", "platform", "type", "status", "schedulable", "priority", "concurrency", "rate_multiplier", "proxy_id", "error_message", "last_used_at", "expires_at", "created_at"}
+	groupListColumns   = []string{"id", "name", "platform", "status", "rate_multiplier", "subscription_type", "is_exclusive"}
+	keyListColumns     = []string{"id", "name", "user_id", "group_id", "status", "quota", "quota_used", "last_used_at", "expires_at"}
+	importColumns      = []string{"proxy_created", "proxy_reused", "proxy_failed", "account_created", "account_failed"}
+	importErrorColumns = []string{"kind", "name", "proxy_key", "message"}
+)
+
+var accountCommands = map[string]command{
+	"list":        {usage: "[-platform p] [-type t] [-status s] [-group id] [-search q] [-page n] [-page-size n]", run: accountsList},
+	"get":         {usage: "<id>", run: accountsGet},
+	"test":        {usage: "<id> [-model m] [-prompt text]", run: accountsTest},
+	"refresh":     {usage: "<id>...", run: accountsRefresh},
+	"clear-error": {usage: "<id>...", run: accountsClearError},
+	"import":      {usage: "-f <file.json|-> [-skip-default-group-bind]", run: accountsImport},
+}
+
+var groupCommands = map[string]command{
+	"list":   {usage: "[-platform p] [-status s] [-search q] [-page n] [-page-size n]", run: groupsList},
+	"get":    {usage: "<id>", run: groupsGet},
+	"create": {usage: "(-f <file.json|-> | -name n [-platform p] [-description d] [-rate-multiplier r] [-exclusive] [-subscription-type t])", run: groupsCreate},
+	"delete": {usage: "<id>", run: groupsDelete},
+}
+
+var keyCommands = map[string]command{
+	"list":      {usage: "(-user id | -group id) [-page n] [-page-size n]", run: keysList},
+	"set-group": {usage: "<key-id> -group <id> (0 unbinds)", run: keysSetGroup},
+}
+
+func newFlagSet(a *app, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.errOut)
+	return fs
+}
+
+// parseArgs 允许 flag 与位置参数交错（如 `accounts test 12 -model x`），返回位置参数
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func parseIDs(positional []string, min int) ([]int64, error) {
+	if len(positional) < min {
+		return nil, fmt.Errorf("%w: missing id", errUsage)
+	}
+	ids := make([]int64, 0, len(positional))
+	for _, raw := range positional {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("%w: invalid id %q", errUsage, raw)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseSingleID(positional []string) (int64, error) {
+	if len(positional) > 1 {
+		return 0, fmt.Errorf("%w: expected exactly one id", errUsage)
+	}
+	ids, err := parseIDs(positional, 1)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// setQuery 仅在值非空时写入查询参数
+func setQuery(q url.Values, key, value string) {
+	if strings.TrimSpace(value) != "" {
+		q.Set(key, strings.TrimSpace(value))
+	}
+}
+
+func pageQuery(page, pageSize int) url.Values {
+	q := url.Values{}
+	q.Set("page", strconv.Itoa(page))
+	q.Set("page_size", strconv.Itoa(pageSize))
+	return q
+}
+
+// readInput 读取 -f 指定的文件，"-" 表示标准输入
+func readInput(a *app, path string) ([]byte, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, fmt.Errorf("%w: -f is required", errUsage)
+	}
+	if path == "-" {
+		return io.ReadAll(a.in)
+	}
+	return os.ReadFile(path)
+}
+
+func (a *app) listRows(ctx context.Context, path string, query url.Values, key string, columns []string) error {
+	data, err := a.client.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	rows, err := decodeRows(data, key)
+	if err != nil {
+		return err
+	}
+	return a.print.list(data, rows, columns)
+}
+
+func (a *app) showObject(ctx context.Context, method, path string, query url.Values, body any, columns []string) error {
+	data, err := a.client.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	obj, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	return a.print.object(data, obj, columns)
+}
+
+// ─── accounts ───
+
+func accountsList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "accounts list")
+	platform := fs.String("platform", "", "Filter by platform")
+	accountType := fs.String("type", "", "Filter by account type")
+	status := fs.String("status", "", "Filter by status (active, error, disabled...)")
+	group := fs.String("group", "", "Filter by group id (or 'ungrouped')")
+	search := fs.String("search", "", "Search by name")
+	page := fs.Int("page", 1, "Page number")
+	pageSize := fs.Int("page-size", 50, "Page size")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	q := pageQuery(*page, *pageSize)
+	setQuery(q, "platform", *platform)
+	setQuery(q, "type", *accountType)
+	setQuery(q, "status", *status)
+	setQuery(q, "group", *group)
+	setQuery(q, "search", *search)
+	return a.listRows(ctx, "/accounts", q, "items", accountListColumns)
+}
+
+func accountsGet(ctx context.Context, a *app, args []string) error {
+	positional, err := parseArgs(newFlagSet(a, "accounts get"), args)
+	if err != nil {
+		return err
+	}
+	id, err := parseSingleID(positional)
+	if err != nil {
+		return err
+	}
+	return a.showObject(ctx, http.MethodGet, fmt.Sprintf("/accounts/%d", id), nil, nil, accountColumns)
+}
+
+// accountTestEvent 对应 service.TestEvent
+type accountTestEvent struct {
+	Type    string `json:"type"`
+	Text    string `json:"text,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Success bool   `json:"success,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func accountsTest(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "accounts test")
+	model := fs.String("model", "", "Model to test (defaults to the platform default)")
+	prompt := fs.String("prompt", "", "Custom test prompt")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	id, err := parseSingleID(positional)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]string{}
+	if *model != "" {
+		body["model_id"] = *model
+	}
+	if *prompt != "" {
+		body["prompt"] = *prompt
+	}
+
+	var testErr string
+	completed := false
+	err = a.client.stream(ctx, http.MethodPost, fmt.Sprintf("/accounts/%d/test", id), body, func(data []byte) error {
+		if a.print.format == outputJSON {
+			_, err := fmt.Fprintln(a.out, string(data))
+			return err
+		}
+		var ev accountTestEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil
+		}
+		switch ev.Type {
+		case "test_start":
+			_, _ = fmt.Fprintf(a.errOut, "testing account %d with model %s...\n", id, ev.Model)
+		case "content":
+			_, _ = fmt.Fprint(a.out, ev.Text)
+		case "error":
+			testErr = ev.Error
+		case "test_complete":
+			completed = ev.Success
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if a.print.format != outputJSON {
+		_, _ = fmt.Fprintln(a.out)
+	}
+	if testErr != "" {
+		return fmt.Errorf("account %d test failed: %s", id, testErr)
+	}
+	if !completed {
+		return fmt.Errorf("account %d test ended without completion", id)
+	}
+	_, _ = fmt.Fprintf(a.errOut, "account %d test passed\n", id)
+	return nil
+}
+
+// accountsAction 对每个账号调用 POST /accounts/:id/<action>，逐个报告结果
+func accountsAction(ctx context.Context, a *app, name, action, verb string, args []string) error {
+	positional, err := parseArgs(newFlagSet(a, "accounts "+name), args)
+	if err != nil {
+		return err
+	}
+	ids, err := parseIDs(positional, 1)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	results := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		row := map[string]any{"id": id, "result": verb}
+		if _, err := a.client.do(ctx, http.MethodPost, fmt.Sprintf("/accounts/%d/%s", id, action), nil, nil); err != nil {
+			failed++
+			row["result"] = "failed"
+			row["error"] = err.Error()
+		}
+		results = append(results, row)
+	}
+
+	raw, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	if err := a.print.list(raw, results, []string{"id", "result", "error"}); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d accounts failed", failed, len(ids))
+	}
+	return nil
+}
+
+func accountsRefresh(ctx context.Context, a *app, args []string) error {
+	return accountsAction(ctx, a, "refresh", "refresh", "refreshed", args)
+}
+
+func accountsClearError(ctx context.Context, a *app, args []string) error {
+	return accountsAction(ctx, a, "clear-error", "clear-error", "cleared", args)
+}
+
+func accountsImport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "accounts import")
+	file := fs.String("f", "", "Export file produced by the admin UI / GET /accounts/data ('-' for stdin)")
+	skipBind := fs.Bool("skip-default-group-bind", false, "Do not bind imported accounts to the platform default group")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	raw, err := readInput(a, *file)
+	if err != nil {
+		return err
+	}
+
+	// 既接受导出文件本身，也接受已包装为 {"data": ...} 的导入请求
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return fmt.Errorf("parse import file: %w", err)
+	}
+	body := map[string]any{"data": json.RawMessage(raw)}
+	if inner, ok := probe["data"]; ok {
+		body["data"] = inner
+	}
+	if *skipBind {
+		body["skip_default_group_bind"] = true
+	}
+
+	data, err := a.client.do(ctx, http.MethodPost, "/accounts/data", nil, body)
+	if err != nil {
+		return err
+	}
+	if a.print.format == outputJSON {
+		return a.print.json(data)
+	}
+	obj, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	if err := a.print.object(data, obj, importColumns); err != nil {
+		return err
+	}
+	rows, err := decodeRows(data, "errors")
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	_, _ = fmt.Fprintln(a.out)
+	if err := a.print.list(nil, rows, importErrorColumns); err != nil {
+		return err
+	}
+	return fmt.Errorf("import finished with %d errors", len(rows))
+}
+
+// ─── groups ───
+
+func groupsList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "groups list")
+	platform := fs.String("platform", "", "Filter by platform")
+	status := fs.String("status", "", "Filter by status")
+	search := fs.String("search", "", "Search by name")
+	page := fs.Int("page", 1, "Page number")
+	pageSize := fs.Int("page-size", 50, "Page size")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	q := pageQuery(*page, *pageSize)
+	setQuery(q, "platform", *platform)
+	setQuery(q, "status", *status)
+	setQuery(q, "search", *search)
+	return a.listRows(ctx, "/groups", q, "items", groupListColumns)
+}
+
+func groupsGet(ctx context.Context, a *app, args []string) error {
+	positional, err := parseArgs(newFlagSet(a, "groups get"), args)
+	if err != nil {
+		return err
+	}
+	id, err := parseSingleID(positional)
+	if err != nil {
+		return err
+	}
+	return a.showObject(ctx, http.MethodGet, fmt.Sprintf("/groups/%d", id), nil, nil, nil)
+}
+
+func groupsCreate(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "groups create")
+	file := fs.String("f", "", "JSON file with the full create request ('-' for stdin)")
+	name := fs.String("name", "", "Group name")
+	platform := fs.String("platform", "", "Platform (anthropic, openai, gemini, antigravity)")
+	description := fs.String("description", "", "Description")
+	rate := fs.Float64("rate-multiplier", 1, "Rate multiplier")
+	exclusive := fs.Bool("exclusive", false, "Exclusive group")
+	subscriptionType := fs.String("subscription-type", "", "standard or subscription")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	var body any
+	if *file != "" {
+		raw, err := readInput(a, *file)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(raw) {
+			return fmt.Errorf("%s is not valid JSON", *file)
+		}
+		body = json.RawMessage(raw)
+	} else {
+		if strings.TrimSpace(*name) == "" {
+			return fmt.Errorf("%w: -name or -f is required", errUsage)
+		}
+		req := map[string]any{
+			"name":            *name,
+			"rate_multiplier": *rate,
+			"is_exclusive":    *exclusive,
+		}
+		if *platform != "" {
+			req["platform"] = *platform
+		}
+		if *description != "" {
+			req["description"] = *description
+		}
+		if *subscriptionType != "" {
+			req["subscription_type"] = *subscriptionType
+		}
+		body = req
+	}
+	return a.showObject(ctx, http.MethodPost, "/groups", nil, body, groupListColumns)
+}
+
+func groupsDelete(ctx context.Context, a *app, args []string) error {
+	positional, err := parseArgs(newFlagSet(a, "groups delete"), args)
+	if err != nil {
+		return err
+	}
+	id, err := parseSingleID(positional)
+	if err != nil {
+		return err
+	}
+	if _, err := a.client.do(ctx, http.MethodDelete, fmt.Sprintf("/groups/%d", id), nil, nil); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(a.errOut, "group %d deleted\n", id)
+	return nil
+}
+
+// ─── keys ───
+
+func keysList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "keys list")
+	userID := fs.Int64("user", 0, "List keys owned by user id")
+	groupID := fs.Int64("group", 0, "List keys bound to group id")
+	page := fs.Int("page", 1, "Page number")
+	pageSize := fs.Int("page-size", 50, "Page size")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	var path string
+	switch {
+	case *userID > 0 && *groupID > 0:
+		return fmt.Errorf("%w: -user and -group are mutually exclusive", errUsage)
+	case *userID > 0:
+		path = fmt.Sprintf("/users/%d/api-keys", *userID)
+	case *groupID > 0:
+		path = fmt.Sprintf("/groups/%d/api-keys", *groupID)
+	default:
+		return fmt.Errorf("%w: -user or -group is required", errUsage)
+	}
+	return a.listRows(ctx, path, pageQuery(*page, *pageSize), "items", keyListColumns)
+}
+
+func keysSetGroup(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "keys set-group")
+	groupID := fs.Int64("group", -1, "Target group id (0 unbinds the key)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	id, err := parseSingleID(positional)
+	if err != nil {
+		return err
+	}
+	if *groupID < 0 {
+		return fmt.Errorf("%w: -group is required", errUsage)
+	}
+
+	data, err := a.client.do(ctx, http.MethodPut, fmt.Sprintf("/api-keys/%d", id), nil, map[string]int64{"group_id": *groupID})
+	if err != nil {
+		return err
+	}
+	if a.print.format == outputJSON {
+		return a.print.json(data)
+	}
+	var resp struct {
+		APIKey json.RawMessage `json:"api_key"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("decode data: %w", err)
+	}
+	obj, err := decodeObject(resp.APIKey)
+	if err != nil {
+		return err
+	}
+	return a.print.object(resp.APIKey, obj, keyListColumns)
+}
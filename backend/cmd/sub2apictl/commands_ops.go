@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// opsWSCloseRealtimeDisabled 与 handler/admin/ops_ws_handler.go 保持一致
+const opsWSCloseRealtimeDisabled = 4001
+
+var (
+	opsErrorColumns   = []string{"id", "created_at", "phase", "type", "severity", "status_code", "platform", "model", "account_name", "retry_count", "resolved", "message"}
+	backupColumns     = []string{"id", "status", "triggered_by", "file_name", "size_bytes", "started_at", "finished_at", "expires_at", "restore_status", "error_message"}
+	usageStatsColumns = []string{"total_requests", "total_input_tokens", "total_output_tokens", "total_cache_tokens", "total_tokens", "total_cost", "total_actual_cost", "average_duration_ms"}
+	usageModelColumns = []string{"model", "requests", "input_tokens", "output_tokens", "cache_creation_tokens", "cache_read_tokens", "total_tokens", "cost", "actual_cost"}
+	usageGroupColumns = []string{"group_id", "group_name", "requests", "total_tokens", "cost", "actual_cost"}
+	usageLogColumns   = []string{"id", "created_at", "user_id", "api_key_id", "account_id", "group_id", "model", "input_tokens", "output_tokens", "cache_read_tokens", "total_cost", "actual_cost", "duration_ms"}
+	configPlanColumns = []string{"action", "kind", "name", "fields"}
+)
+
+var opsCommands = map[string]command{
+	"errors": {usage: "[-time-range 1h] [-phase p] [-owner o] [-platform p] [-group id] [-q text] [-page n] [-page-size n]", run: opsErrors},
+	"retry":  {usage: "<error-id> [-account id]", run: opsRetry},
+	"tail":   {usage: "[-count n]", run: opsTail},
+}
+
+var backupCommands = map[string]command{
+	"list":    {usage: "", run: backupsList},
+	"create":  {usage: "[-expire-days n]", run: backupsCreate},
+	"restore": {usage: "<backup-id> [-password p] (or " + envAdminPassword + ")", run: backupsRestore},
+}
+
+var usageCommands = map[string]command{
+	"stats":  {usage: "[usage filters]", run: usageStats},
+	"models": {usage: "[usage filters]", run: usageModels},
+	"groups": {usage: "[usage filters]", run: usageGroups},
+	"logs":   {usage: "[usage filters] [-page n] [-page-size n]", run: usageLogs},
+}
+
+var configCommands = map[string]command{
+	"plan":  {usage: "-f <spec.yaml|->", run: configPlan},
+	"apply": {usage: "-f <spec.yaml|-> [-plan-hash h]", run: configApply},
+}
+
+// ─── ops ───
+
+func opsErrors(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "ops errors")
+	timeRange := fs.String("time-range", "", "Time window, e.g. 5m, 1h, 24h")
+	phase := fs.String("phase", "", "Filter by phase (request, auth, routing, upstream, network, internal)")
+	owner := fs.String("owner", "", "Filter by owner (client, provider, platform)")
+	platform := fs.String("platform", "", "Filter by platform")
+	group := fs.String("group", "", "Filter by group id")
+	query := fs.String("q", "", "Full-text search")
+	page := fs.Int("page", 1, "Page number")
+	pageSize := fs.Int("page-size", 50, "Page size")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	q := pageQuery(*page, *pageSize)
+	setQuery(q, "time_range", *timeRange)
+	setQuery(q, "phase", *phase)
+	setQuery(q, "error_owner", *owner)
+	setQuery(q, "platform", *platform)
+	setQuery(q, "group_id", *group)
+	setQuery(q, "q", *query)
+	return a.listRows(ctx, "/ops/errors", q, "items", opsErrorColumns)
+}
+
+func opsRetry(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "ops retry")
+	accountID := fs.Int64("account", 0, "Pin the retry to this account id")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	id, err := parseSingleID(positional)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]any{"mode": "client"}
+	if *accountID > 0 {
+		body["pinned_account_id"] = *accountID
+	}
+	return a.showObject(ctx, http.MethodPost, fmt.Sprintf("/ops/errors/%d/retry", id), nil, body, nil)
+}
+
+// opsQPSMessage 对应 ops WebSocket 推送的 qps_update
+type opsQPSMessage struct {
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	Data      struct {
+		QPS          float64 `json:"qps"`
+		TPS          float64 `json:"tps"`
+		RequestCount int64   `json:"request_count"`
+	} `json:"data"`
+}
+
+// opsTail 订阅 /ops/ws/qps，持续输出实时 QPS/TPS，直到 Ctrl-C 或达到 -count
+func opsTail(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "ops tail")
+	count := fs.Int("count", 0, "Stop after n updates (0 = until interrupted)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	wsURL, err := a.client.websocketURL("/ops/ws/qps")
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("x-api-key", a.client.apiKey)
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: a.client.httpClient.Timeout,
+		Subprotocols:     []string{"sub2api-admin"},
+	}
+	conn, resp, err := dialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("connect %s: HTTP %d", wsURL, resp.StatusCode)
+		}
+		return fmt.Errorf("connect %s: %w", wsURL, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// ctx 取消时主动关闭连接以打断 ReadMessage
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		_ = conn.Close()
+	})
+	defer stop()
+
+	if a.print.format == outputCSV {
+		_, _ = fmt.Fprintln(a.out, "timestamp,qps,tps,request_count")
+	} else if a.print.format == outputTable {
+		_, _ = fmt.Fprintf(a.out, "%-25s %10s %12s %14s\n", "TIMESTAMP", "QPS", "TPS", "REQUEST_COUNT")
+	}
+
+	received := 0
+	for *count <= 0 || received < *count {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				if closeErr.Code == opsWSCloseRealtimeDisabled {
+					return errors.New("ops realtime monitoring is disabled on the server")
+				}
+				if closeErr.Code == websocket.CloseNormalClosure {
+					return nil
+				}
+			}
+			return err
+		}
+
+		var msg opsQPSMessage
+		if err := json.Unmarshal(payload, &msg); err != nil || msg.Type != "qps_update" {
+			continue
+		}
+		received++
+		switch a.print.format {
+		case outputJSON:
+			_, _ = fmt.Fprintln(a.out, string(payload))
+		case outputCSV:
+			_, _ = fmt.Fprintf(a.out, "%s,%s,%s,%d\n", msg.Timestamp, formatCell(msg.Data.QPS), formatCell(msg.Data.TPS), msg.Data.RequestCount)
+		default:
+			_, _ = fmt.Fprintf(a.out, "%-25s %10s %12s %14d\n", msg.Timestamp, formatCell(msg.Data.QPS), formatCell(msg.Data.TPS), msg.Data.RequestCount)
+		}
+	}
+	return nil
+}
+
+// ─── backups ───
+
+func backupsList(ctx context.Context, a *app, args []string) error {
+	if _, err := parseArgs(newFlagSet(a, "backups list"), args); err != nil {
+		return err
+	}
+	return a.listRows(ctx, "/backups", nil, "items", backupColumns)
+}
+
+func backupsCreate(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "backups create")
+	expireDays := fs.Int("expire-days", -1, "Days before the backup expires (0 = never, default server-side 14)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	body := map[string]any{}
+	if *expireDays >= 0 {
+		body["expire_days"] = *expireDays
+	}
+	return a.showObject(ctx, http.MethodPost, "/backups", nil, body, backupColumns)
+}
+
+func backupsRestore(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "backups restore")
+	password := fs.String("password", "", "Admin password (required by the server for restores)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || strings.TrimSpace(positional[0]) == "" {
+		return fmt.Errorf("%w: expected exactly one backup id", errUsage)
+	}
+	pw := firstNonEmpty(*password, a.getenv(envAdminPassword))
+	if pw == "" {
+		return fmt.Errorf("%w: -password or %s is required", errUsage, envAdminPassword)
+	}
+	path := "/backups/" + url.PathEscape(positional[0]) + "/restore"
+	return a.showObject(ctx, http.MethodPost, path, nil, map[string]string{"password": pw}, backupColumns)
+}
+
+// ─── usage ───
+
+// usageFilters 用量报表通用筛选条件，与 /usage 和 /dashboard 接口的查询参数对应
+type usageFilters struct {
+	start, end, period, timezone, model  string
+	userID, apiKeyID, accountID, groupID int64
+	page, pageSize                       int
+}
+
+func parseUsageFilters(a *app, name string, args []string) (*usageFilters, error) {
+	fs := newFlagSet(a, name)
+	f := &usageFilters{}
+	fs.StringVar(&f.start, "start", "", "Start date (YYYY-MM-DD)")
+	fs.StringVar(&f.end, "end", "", "End date (YYYY-MM-DD, inclusive)")
+	fs.StringVar(&f.period, "period", "", "Preset period when no dates are given (today, week, month)")
+	fs.StringVar(&f.timezone, "timezone", "", "IANA timezone for date boundaries")
+	fs.StringVar(&f.model, "model", "", "Filter by model")
+	fs.Int64Var(&f.userID, "user", 0, "Filter by user id")
+	fs.Int64Var(&f.apiKeyID, "key", 0, "Filter by API key id")
+	fs.Int64Var(&f.accountID, "account", 0, "Filter by account id")
+	fs.Int64Var(&f.groupID, "group", 0, "Filter by group id")
+	fs.IntVar(&f.page, "page", 1, "Page number (logs only)")
+	fs.IntVar(&f.pageSize, "page-size", 50, "Page size (logs only)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return nil, err
+	}
+	if (f.start == "") != (f.end == "") {
+		return nil, fmt.Errorf("%w: -start and -end must be given together", errUsage)
+	}
+	return f, nil
+}
+
+func (f *usageFilters) query() url.Values {
+	q := url.Values{}
+	setQuery(q, "start_date", f.start)
+	setQuery(q, "end_date", f.end)
+	setQuery(q, "period", f.period)
+	setQuery(q, "timezone", f.timezone)
+	setQuery(q, "model", f.model)
+	for key, id := range map[string]int64{"user_id": f.userID, "api_key_id": f.apiKeyID, "account_id": f.accountID, "group_id": f.groupID} {
+		if id > 0 {
+			q.Set(key, strconv.FormatInt(id, 10))
+		}
+	}
+	return q
+}
+
+func usageStats(ctx context.Context, a *app, args []string) error {
+	f, err := parseUsageFilters(a, "usage stats", args)
+	if err != nil {
+		return err
+	}
+	return a.showObject(ctx, http.MethodGet, "/usage/stats", f.query(), nil, usageStatsColumns)
+}
+
+func usageModels(ctx context.Context, a *app, args []string) error {
+	f, err := parseUsageFilters(a, "usage models", args)
+	if err != nil {
+		return err
+	}
+	return a.listRows(ctx, "/dashboard/models", f.query(), "models", usageModelColumns)
+}
+
+func usageGroups(ctx context.Context, a *app, args []string) error {
+	f, err := parseUsageFilters(a, "usage groups", args)
+	if err != nil {
+		return err
+	}
+	return a.listRows(ctx, "/dashboard/groups", f.query(), "groups", usageGroupColumns)
+}
+
+func usageLogs(ctx context.Context, a *app, args []string) error {
+	f, err := parseUsageFilters(a, "usage logs", args)
+	if err != nil {
+		return err
+	}
+	q := f.query()
+	q.Set("page", strconv.Itoa(f.page))
+	q.Set("page_size", strconv.Itoa(f.pageSize))
+	return a.listRows(ctx, "/usage", q, "items", usageLogColumns)
+}
+
+// ─── config ───
+
+func configPlan(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "config plan")
+	file := fs.String("f", "", "Config spec (YAML or JSON, '-' for stdin)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	spec, err := readInput(a, *file)
+	if err != nil {
+		return err
+	}
+	data, err := a.client.do(ctx, http.MethodPost, "/config/plan", nil, spec)
+	if err != nil {
+		return err
+	}
+	return a.printConfigPlan(data)
+}
+
+func configApply(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet(a, "config apply")
+	file := fs.String("f", "", "Config spec (YAML or JSON, '-' for stdin)")
+	planHash := fs.String("plan-hash", "", "Only apply if the plan still matches this hash (from `config plan`)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	spec, err := readInput(a, *file)
+	if err != nil {
+		return err
+	}
+	q := url.Values{}
+	setQuery(q, "plan_hash", *planHash)
+	data, err := a.client.do(ctx, http.MethodPost, "/config/apply", q, spec)
+	if err != nil {
+		return err
+	}
+	if a.print.format == outputJSON {
+		return a.print.json(data)
+	}
+	var result struct {
+		Plan    json.RawMessage `json:"plan"`
+		Applied int             `json:"applied"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("decode data: %w", err)
+	}
+	if err := a.printConfigPlan(result.Plan); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(a.errOut, "applied %d changes\n", result.Applied)
+	return nil
+}
+
+func (a *app) printConfigPlan(data json.RawMessage) error {
+	if a.print.format == outputJSON {
+		return a.print.json(data)
+	}
+	var plan struct {
+		Hash    string `json:"hash"`
+		Changes []struct {
+			Kind   string `json:"kind"`
+			Name   string `json:"name"`
+			Action string `json:"action"`
+			Fields []struct {
+				Path string `json:"path"`
+			} `json:"fields"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("decode plan: %w", err)
+	}
+	rows := make([]map[string]any, 0, len(plan.Changes))
+	for _, ch := range plan.Changes {
+		paths := make([]string, 0, len(ch.Fields))
+		for _, field := range ch.Fields {
+			paths = append(paths, field.Path)
+		}
+		rows = append(rows, map[string]any{"action": ch.Action, "kind": ch.Kind, "name": ch.Name, "fields": strings.Join(paths, ",")})
+	}
+	if err := a.print.list(data, rows, configPlanColumns); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(a.errOut, "%d changes, plan hash: %s\n", len(rows), plan.Hash)
+	return nil
+}
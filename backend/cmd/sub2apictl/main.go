@@ -0,0 +1,164 @@
+// Command sub2apictl 是 sub2api 管理端的命令行客户端。
+//
+// 通过 Admin API Key（x-api-key，见管理后台 /admin-api-key）访问 /api/v1/admin，
+// 覆盖账号、分组、密钥、运维错误、备份、实时流量与用量报表等常用运维操作，
+// 便于在脚本与 CI 中使用。
+//
+//	sub2apictl -server https://api.example.com -key admin-xxx accounts list -status error
+//	SUB2API_URL=... SUB2API_ADMIN_KEY=... sub2apictl usage models -start 2026-10-01 -end 2026-10-19 -o csv
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	envServerURL     = "SUB2API_URL"
+	envAdminKey      = "SUB2API_ADMIN_KEY"
+	envAdminPassword = "SUB2API_ADMIN_PASSWORD"
+
+	defaultServerURL = "http://localhost:8080"
+)
+
+// errUsage 参数错误，退出码 2
+var errUsage = errors.New("usage error")
+
+// app 单次命令执行的上下文
+type app struct {
+	client *adminClient
+	print  *printer
+	in     io.Reader
+	out    io.Writer
+	errOut io.Writer
+	getenv func(string) string
+}
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+// commands 资源 -> 动作 -> 命令
+var commands = map[string]map[string]command{
+	"accounts": accountCommands,
+	"groups":   groupCommands,
+	"keys":     keyCommands,
+	"ops":      opsCommands,
+	"backups":  backupCommands,
+	"usage":    usageCommands,
+	"config":   configCommands,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, in io.Reader, out, errOut io.Writer, getenv func(string) string) int {
+	fs := flag.NewFlagSet("sub2apictl", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	server := fs.String("server", firstNonEmpty(getenv(envServerURL), defaultServerURL), "Server base URL (env "+envServerURL+")")
+	key := fs.String("key", getenv(envAdminKey), "Admin API key (env "+envAdminKey+")")
+	format := fs.String("o", outputTable, "Output format: table, json or csv")
+	timeout := fs.Duration("timeout", 2*time.Minute, "HTTP request timeout")
+	fs.Usage = func() { printUsage(errOut, fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if !validOutputFormat(*format) {
+		_, _ = fmt.Fprintf(errOut, "invalid output format %q (want table, json or csv)\n", *format)
+		return 2
+	}
+
+	rest := fs.Args()
+	if len(rest) < 2 {
+		fs.Usage()
+		return 2
+	}
+	actions, ok := commands[rest[0]]
+	if !ok {
+		_, _ = fmt.Fprintf(errOut, "unknown resource %q\n\n", rest[0])
+		fs.Usage()
+		return 2
+	}
+	cmd, ok := actions[rest[1]]
+	if !ok {
+		_, _ = fmt.Fprintf(errOut, "unknown command %q for %s\n\n", rest[1], rest[0])
+		fs.Usage()
+		return 2
+	}
+	if strings.TrimSpace(*key) == "" {
+		_, _ = fmt.Fprintf(errOut, "admin API key is required (-key or %s)\n", envAdminKey)
+		return 2
+	}
+
+	a := &app{
+		client: newAdminClient(*server, *key, &http.Client{Timeout: *timeout}),
+		print:  &printer{out: out, format: *format},
+		in:     in,
+		out:    out,
+		errOut: errOut,
+		getenv: getenv,
+	}
+	if err := cmd.run(ctx, a, rest[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if errors.Is(err, errUsage) {
+			_, _ = fmt.Fprintf(errOut, "%v\nusage: sub2apictl %s %s %s\n", err, rest[0], rest[1], cmd.usage)
+			return 2
+		}
+		_, _ = fmt.Fprintf(errOut, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	_, _ = fmt.Fprintln(w, "usage: sub2apictl [global flags] <resource> <command> [flags] [args]")
+	_, _ = fmt.Fprintln(w, "\nglobal flags:")
+	fs.PrintDefaults()
+	_, _ = fmt.Fprintln(w, "\ncommands:")
+
+	resources := make([]string, 0, len(commands))
+	for name := range commands {
+		resources = append(resources, name)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		actions := make([]string, 0, len(commands[resource]))
+		for name := range commands[resource] {
+			actions = append(actions, name)
+		}
+		sort.Strings(actions)
+		for _, action := range actions {
+			_, _ = fmt.Fprintf(w, "  %s %s %s\n", resource, action, commands[resource][action].usage)
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
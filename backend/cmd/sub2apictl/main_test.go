@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminKey = "admin-test-key"
+
+// fakeAdminServer 校验 x-api-key 后按 "METHOD path" 分发到测试注册的处理函数
+type fakeAdminServer struct {
+	t        *testing.T
+	handlers map[string]http.HandlerFunc
+}
+
+func newFakeAdminServer(t *testing.T) (*fakeAdminServer, *httptest.Server) {
+	fake := &fakeAdminServer{t: t, handlers: map[string]http.HandlerFunc{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != testAdminKey {
+			writeEnvelope(w, http.StatusUnauthorized, map[string]any{"code": 401, "reason": "INVALID_ADMIN_KEY", "message": "Invalid admin API key"})
+			return
+		}
+		h, ok := fake.handlers[r.Method+" "+r.URL.Path]
+		if !ok {
+			writeEnvelope(w, http.StatusNotFound, map[string]any{"code": 404, "message": "not found"})
+			return
+		}
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return fake, srv
+}
+
+func (f *fakeAdminServer) handle(method, path string, h http.HandlerFunc) {
+	f.handlers[method+" "+adminAPIPrefix+path] = h
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, body map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func success(data any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeEnvelope(w, http.StatusOK, map[string]any{"code": 0, "message": "success", "data": data})
+	}
+}
+
+func runCLI(t *testing.T, srv *httptest.Server, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	env := map[string]string{envServerURL: srv.URL, envAdminKey: testAdminKey}
+	var out, errOut bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &out, &errOut, func(k string) string { return env[k] })
+	return code, out.String(), errOut.String()
+}
+
+func TestAccountsListTable(t *testing.T) {
+	fake, srv := newFakeAdminServer(t)
+	fake.handle(http.MethodGet, "/accounts", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "error", r.URL.Query().Get("status"))
+		require.Equal(t, "20", r.URL.Query().Get("page_size"))
+		success(map[string]any{
+			"items": []map[string]any{
+				{"id": 7, "name": "claude-main", "platform": "anthropic", "type": "oauth", "status": "error", "schedulable": true, "priority": 1, "concurrency": 3, "error_message": "token expired"},
+			},
+			"total": 1, "page": 1, "page_size": 20, "pages": 1,
+		})(w, r)
+	})
+
+	code, out, errOut := runCLI(t, srv, "", "accounts", "list", "-status", "error", "-page-size", "20")
+	require.Equal(t, 0, code, errOut)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	require.Regexp(t, `^ID\s+NAME\s+PLATFORM`, lines[0])
+	require.Regexp(t, `^7\s+claude-main\s+anthropic\s+oauth\s+error\s+true\s+1\s+3\s+token expired$`, lines[1])
+}
+
+func TestAPIErrorAndAuthFailure(t *testing.T) {
+	fake, srv := newFakeAdminServer(t)
+	fake.handle(http.MethodPost, "/accounts/9/refresh", func(w http.ResponseWriter, r *http.Request) {
+		writeEnvelope(w, http.StatusBadRequest, map[string]any{"code": 400, "reason": "ACCOUNT_NOT_OAUTH", "message": "account does not support refresh"})
+	})
+	fake.handle(http.MethodPost, "/accounts/8/refresh", success(map[string]any{"id": 8}))
+
+	code, out, errOut := runCLI(t, srv, "", "accounts", "refresh", "8", "9")
+	require.Equal(t, 1, code)
+	require.Contains(t, out, "refreshed")
+	require.Contains(t, out, "ACCOUNT_NOT_OAUTH: account does not support refresh")
+	require.Contains(t, errOut, "1 of 2 accounts failed")
+
+	var stdout, stderr bytes.Buffer
+	code = run(context.Background(), []string{"-server", srv.URL, "-key", "wrong", "groups", "list"}, nil, &stdout, &stderr, func(string) string { return "" })
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr.String(), "HTTP 401 INVALID_ADMIN_KEY")
+
+	code = run(context.Background(), []string{"-server", srv.URL, "groups", "list"}, nil, &stdout, &stderr, func(string) string { return "" })
+	require.Equal(t, 2, code)
+	require.Contains(t, stderr.String(), "admin API key is required")
+}
+
+func TestUsageModelsCSVAndJSON(t *testing.T) {
+	fake, srv := newFakeAdminServer(t)
+	fake.handle(http.MethodGet, "/dashboard/models", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "2026-10-01", r.URL.Query().Get("start_date"))
+		require.Equal(t, "2026-10-19", r.URL.Query().Get("end_date"))
+		require.Equal(t, "3", r.URL.Query().Get("group_id"))
+		success(map[string]any{
+			"models": []map[string]any{
+				{"model": "claude-sonnet-4-5", "requests": 12, "input_tokens": 1000, "output_tokens": 200, "cache_creation_tokens": 0, "cache_read_tokens": 50, "total_tokens": 1250, "cost": 0.125, "actual_cost": 0.1},
+			},
+			"start_date": "2026-10-01", "end_date": "2026-10-19",
+		})(w, r)
+	})
+
+	args := []string{"usage", "models", "-start", "2026-10-01", "-end", "2026-10-19", "-group", "3"}
+	code, out, errOut := runCLI(t, srv, "", append([]string{"-o", "csv"}, args...)...)
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "model,requests,input_tokens,output_tokens,cache_creation_tokens,cache_read_tokens,total_tokens,cost,actual_cost\n"+
+		"claude-sonnet-4-5,12,1000,200,0,50,1250,0.125,0.1\n", out)
+
+	code, out, errOut = runCLI(t, srv, "", append([]string{"-o", "json"}, args...)...)
+	require.Equal(t, 0, code, errOut)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(out), &decoded))
+	require.Equal(t, "2026-10-19", decoded["end_date"])
+
+	code, _, errOut = runCLI(t, srv, "", "usage", "models", "-start", "2026-10-01")
+	require.Equal(t, 2, code)
+	require.Contains(t, errOut, "-start and -end must be given together")
+}
+
+func TestAccountsImportWrapsExportFile(t *testing.T) {
+	fake, srv := newFakeAdminServer(t)
+	var received map[string]json.RawMessage
+	fake.handle(http.MethodPost, "/accounts/data", func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(raw, &received))
+		success(map[string]any{"proxy_created": 1, "account_created": 2, "account_failed": 0})(w, r)
+	})
+
+	file := filepath.Join(t.TempDir(), "accounts.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"exported_at":"2026-10-19T00:00:00Z","proxies":[],"accounts":[{"name":"a"}]}`), 0o600))
+
+	code, out, errOut := runCLI(t, srv, "", "accounts", "import", "-f", file, "-skip-default-group-bind")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, string(received["data"]), `"accounts":[{"name":"a"}]`)
+	require.Equal(t, "true", string(received["skip_default_group_bind"]))
+	require.Regexp(t, `account_created\s+2`, out)
+
+	// 已包装为 {"data": ...} 的请求体从 stdin 读入时不再二次包装
+	code, _, errOut = runCLI(t, srv, `{"data":{"accounts":[]}}`, "accounts", "import", "-f", "-")
+	require.Equal(t, 0, code, errOut)
+	require.JSONEq(t, `{"accounts":[]}`, string(received["data"]))
+}
+
+func TestAccountsTestStreamsSSE(t *testing.T) {
+	fake, srv := newFakeAdminServer(t)
+	fake.handle(http.MethodPost, "/accounts/5/test", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "claude-haiku", body["model_id"])
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range []string{
+			`{"type":"test_start","model":"claude-haiku"}`,
+			`{"type":"content","text":"Hello"}`,
+			`{"type":"content","text":" there"}`,
+			`{"type":"test_complete","success":true}`,
+		} {
+			_, _ = io.WriteString(w, "data: "+ev+"\n\n")
+		}
+	})
+	fake.handle(http.MethodPost, "/accounts/6/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"type\":\"error\",\"error\":\"401 unauthorized\"}\n\n")
+	})
+
+	code, out, errOut := runCLI(t, srv, "", "accounts", "test", "5", "-model", "claude-haiku")
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "Hello there\n", out)
+	require.Contains(t, errOut, "account 5 test passed")
+
+	code, _, errOut = runCLI(t, srv, "", "accounts", "test", "6")
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "401 unauthorized")
+}
+
+func TestOpsTailReadsWebSocket(t *testing.T) {
+	fake, srv := newFakeAdminServer(t)
+	upgrader := websocket.Upgrader{Subprotocols: []string{"sub2api-admin"}}
+	fake.handle(http.MethodGet, "/ops/ws/qps", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		for _, qps := range []float64{1.5, 2} {
+			msg, _ := json.Marshal(map[string]any{
+				"type":      "qps_update",
+				"timestamp": "2026-10-19T08:00:00Z",
+				"data":      map[string]any{"qps": qps, "tps": 120.5, "request_count": 90},
+			})
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, msg))
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	code, out, errOut := runCLI(t, srv, "", "-o", "csv", "ops", "tail", "-count", "2")
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "timestamp,qps,tps,request_count\n"+
+		"2026-10-19T08:00:00Z,1.5,120.5,90\n"+
+		"2026-10-19T08:00:00Z,2,120.5,90\n", out)
+}
+
+func TestConfigApplyPassesPlanHash(t *testing.T) {
+	fake, srv := newFakeAdminServer(t)
+	fake.handle(http.MethodPost, "/config/apply", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "abc123", r.URL.Query().Get("plan_hash"))
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, "groups:\n  - name: pro\n", string(raw))
+		success(map[string]any{
+			"applied": 1,
+			"plan": map[string]any{
+				"hash":    "abc123",
+				"changes": []map[string]any{{"kind": "groups", "name": "pro", "action": "create", "fields": []map[string]any{{"path": "platform"}, {"path": "rate_multiplier"}}}},
+			},
+		})(w, r)
+	})
+
+	code, out, errOut := runCLI(t, srv, "groups:\n  - name: pro\n", "config", "apply", "-f", "-", "-plan-hash", "abc123")
+	require.Equal(t, 0, code, errOut)
+	require.Regexp(t, `create\s+groups\s+pro\s+platform,rate_multiplier`, out)
+	require.Contains(t, errOut, "plan hash: abc123")
+	require.Contains(t, errOut, "applied 1 changes")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+func validOutputFormat(format string) bool {
+	switch format {
+	case outputTable, outputJSON, outputCSV:
+		return true
+	}
+	return false
+}
+
+// printer 按 -o 指定的格式输出结果
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+// list 输出对象数组；columns 为空时取所有出现过的字段（按字母序）
+func (p *printer) list(raw json.RawMessage, rows []map[string]any, columns []string) error {
+	if p.format == outputJSON {
+		return p.json(raw)
+	}
+	if len(columns) == 0 {
+		columns = collectColumns(rows)
+	}
+	records := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, col := range columns {
+			record[i] = formatCell(lookupField(row, col))
+		}
+		records = append(records, record)
+	}
+	if p.format == outputCSV {
+		return writeCSV(p.out, columns, records)
+	}
+	return writeTable(p.out, columns, records)
+}
+
+// object 输出单个对象；表格模式下按 FIELD/VALUE 纵向排列
+func (p *printer) object(raw json.RawMessage, obj map[string]any, columns []string) error {
+	if p.format == outputJSON {
+		return p.json(raw)
+	}
+	if len(columns) == 0 {
+		columns = collectColumns([]map[string]any{obj})
+	}
+	if p.format == outputCSV {
+		record := make([]string, len(columns))
+		for i, col := range columns {
+			record[i] = formatCell(lookupField(obj, col))
+		}
+		return writeCSV(p.out, columns, [][]string{record})
+	}
+	records := make([][]string, 0, len(columns))
+	for _, col := range columns {
+		records = append(records, []string{col, formatCell(lookupField(obj, col))})
+	}
+	return writeTable(p.out, []string{"field", "value"}, records)
+}
+
+func (p *printer) json(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		raw = json.RawMessage("null")
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("decode data: %w", err)
+	}
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeTable(w io.Writer, columns []string, records [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = strings.ToUpper(col)
+	}
+	if _, err := fmt.Fprintln(tw, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for _, record := range records {
+		cells := make([]string, len(record))
+		for i, cell := range record {
+			// 表格中换行/制表符会打乱对齐
+			cells[i] = strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(cell)
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(cells, "\t")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, columns []string, records [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func collectColumns(rows []map[string]any) []string {
+	seen := make(map[string]struct{})
+	var columns []string
+	for _, row := range rows {
+		for k := range row {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			columns = append(columns, k)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// lookupField 支持 a.b 形式访问嵌套字段
+func lookupField(row map[string]any, path string) any {
+	var cur any = row
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+func formatCell(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1e15 {
+			return strconv.FormatInt(int64(val), 10)
+		}
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprint(val)
+		}
+		return string(raw)
+	}
+}
+
+// decodeRows 从 data 中取出对象数组：data 本身是数组，或为 {key: [...]}（分页结果为 items）
+func decodeRows(raw json.RawMessage, key string) ([]map[string]any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var direct []map[string]any
+	if err := json.Unmarshal(raw, &direct); err == nil {
+		return direct, nil
+	}
+	var wrapped map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &wrapped); err != nil {
+		return nil, fmt.Errorf("decode data: %w", err)
+	}
+	inner, ok := wrapped[key]
+	if !ok || string(inner) == "null" {
+		return nil, nil
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(inner, &rows); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", key, err)
+	}
+	return rows, nil
+}
+
+func decodeObject(raw json.RawMessage) (map[string]any, error) {
+	var obj map[string]any
+	if len(raw) == 0 {
+		return obj, nil
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("decode data: %w", err)
+	}
+	return obj, nil
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -66,6 +67,10 @@ type Config struct {
 	Totp                    TotpConfig                    `mapstructure:"totp"`
 	LinuxDo                 LinuxDoConnectConfig          `mapstructure:"linuxdo_connect"`
 	OIDC                    OIDCConnectConfig             `mapstructure:"oidc_connect"`
+	LDAP                    LDAPConnectConfig             `mapstructure:"ldap_connect"`
+	SAML                    SAMLConnectConfig             `mapstructure:"saml_connect"`
+	SCIM                    SCIMConfig                    `mapstructure:"scim"`
+	WebAuthn                WebAuthnConfig                `mapstructure:"webauthn"`
 	Default                 DefaultConfig                 `mapstructure:"default"`
 	RateLimit               RateLimitConfig               `mapstructure:"rate_limit"`
 	Pricing                 PricingConfig                 `mapstructure:"pricing"`
@@ -83,6 +88,10 @@ type Config struct {
 	Gemini                  GeminiConfig                  `mapstructure:"gemini"`
 	Update                  UpdateConfig                  `mapstructure:"update"`
 	Idempotency             IdempotencyConfig             `mapstructure:"idempotency"`
+	Privacy                 PrivacyConfig                 `mapstructure:"privacy"`
+	Cluster                 ClusterConfig                 `mapstructure:"cluster"`
+	Shadow                  ShadowConfig                  `mapstructure:"shadow"`
+	OAuthServer             OAuthServerConfig             `mapstructure:"oauth_server"`
 }
 
 type LogConfig struct {
@@ -146,6 +155,70 @@ type UpdateConfig struct {
 	ProxyURL string `mapstructure:"proxy_url"`
 }
 
+// PrivacyConfig 用户数据导出与注销配置
+type PrivacyConfig struct {
+	// ExportDir: 数据导出 zip 文件存放目录
+	ExportDir string `mapstructure:"export_dir"`
+	// ExportRetentionHours: 导出文件保留时长（小时），过期后删除文件
+	ExportRetentionHours int `mapstructure:"export_retention_hours"`
+	// DownloadLinkTTLMinutes: 签名下载链接有效期（分钟）
+	DownloadLinkTTLMinutes int `mapstructure:"download_link_ttl_minutes"`
+	// DeletionGraceDays: 账号注销申请的冷静期（天），期间可撤销
+	DeletionGraceDays int `mapstructure:"deletion_grace_days"`
+	// WorkerIntervalSeconds: 后台导出/注销任务轮询间隔（秒）
+	WorkerIntervalSeconds int `mapstructure:"worker_interval_seconds"`
+}
+
+// ClusterConfig 多副本部署配置
+type ClusterConfig struct {
+	// Enabled: 启用后摘要会话与 WS 粘连状态写入 Redis，在副本间共享
+	Enabled bool `mapstructure:"enabled"`
+	// NodeID: 当前副本标识，留空时使用主机名
+	NodeID string `mapstructure:"node_id"`
+	// HeartbeatIntervalSeconds: 节点心跳间隔（秒），节点记录 TTL 为 3 倍心跳间隔
+	HeartbeatIntervalSeconds int `mapstructure:"heartbeat_interval_seconds"`
+}
+
+// ShadowConfig 分组影子流量（镜像评估）配置，具体规则在管理后台按分组配置
+type ShadowConfig struct {
+	// Enabled: 全局开关，关闭后所有影子规则不生效
+	Enabled bool `mapstructure:"enabled"`
+	// MaxConcurrency: 单实例影子请求并发上限（与规则级 max_concurrency 同时生效），超出时直接放弃采样
+	MaxConcurrency int `mapstructure:"max_concurrency"`
+	// TimeoutSeconds: 单个影子请求的超时时间（秒）
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+	// RuleCacheSeconds: 影子规则的本地缓存刷新间隔（秒）
+	RuleCacheSeconds int `mapstructure:"rule_cache_seconds"`
+}
+
+// OAuthServerConfig sub2api 作为 OAuth 2.0 授权服务器的配置（设备码 RFC 8628 / 授权码 + PKCE），
+// CLI 工具经用户在浏览器中授权后获得绑定分组的短期 API Key
+type OAuthServerConfig struct {
+	// Enabled: 是否开放 /api/v1/oauth 授权端点
+	Enabled bool `mapstructure:"enabled"`
+	// Clients: 允许的客户端；为空时仅内置 sub2api-cli（回环地址回调）
+	Clients []OAuthServerClientConfig `mapstructure:"clients"`
+	// DeviceCodeTTLSeconds: 设备码与用户码有效期（秒）
+	DeviceCodeTTLSeconds int `mapstructure:"device_code_ttl_seconds"`
+	// PollIntervalSeconds: 设备码轮询的最小间隔（秒），过快轮询返回 slow_down
+	PollIntervalSeconds int `mapstructure:"poll_interval_seconds"`
+	// AuthCodeTTLSeconds: 授权码有效期（秒）
+	AuthCodeTTLSeconds int `mapstructure:"auth_code_ttl_seconds"`
+	// KeyTTLMinutes: 签发的 API Key 有效期（分钟），refresh_token 续期时顺延
+	KeyTTLMinutes int `mapstructure:"key_ttl_minutes"`
+	// RefreshTokenTTLDays: refresh_token 有效期（天），0 表示沿用 jwt.refresh_token_expire_days
+	RefreshTokenTTLDays int `mapstructure:"refresh_token_ttl_days"`
+}
+
+// OAuthServerClientConfig OAuth 客户端（均为公开客户端，授权码模式强制 PKCE）
+type OAuthServerClientConfig struct {
+	ClientID string `mapstructure:"client_id"`
+	// Name: 授权页展示的客户端名称，同时作为签发 Key 的名称前缀
+	Name string `mapstructure:"name"`
+	// RedirectURIs: 授权码模式允许的回调地址；回环地址（127.0.0.1/[::1]/localhost）忽略端口比较（RFC 8252）
+	RedirectURIs []string `mapstructure:"redirect_uris"`
+}
+
 type IdempotencyConfig struct {
 	// ObserveOnly 为 true 时处于观察期：未携带 Idempotency-Key 的请求继续放行。
 	ObserveOnly bool `mapstructure:"observe_only"`
@@ -213,6 +286,90 @@ type OIDCConnectConfig struct {
 	UserInfoUsernamePath string `mapstructure:"userinfo_username_path"`
 }
 
+// LDAPConnectConfig LDAP / Active Directory 登录：先用服务账号查找用户，再以用户 DN + 密码绑定校验
+type LDAPConnectConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	ProviderName       string `mapstructure:"provider_name"` // 登录页显示名: "Active Directory" 等
+	URL                string `mapstructure:"url"`           // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool   `mapstructure:"start_tls"`     // ldap:// 连接上升级 TLS
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	BindDN             string `mapstructure:"bind_dn"` // 查找用户的服务账号；为空时匿名查找
+	BindPassword       string `mapstructure:"bind_password"`
+	BaseDN             string `mapstructure:"base_dn"`
+	// UserFilter: 查找用户的过滤器，{username} 会被转义替换；默认适配 AD 的 sAMAccountName
+	UserFilter        string `mapstructure:"user_filter"`
+	EmailAttribute    string `mapstructure:"email_attribute"`    // 默认 mail
+	UsernameAttribute string `mapstructure:"username_attribute"` // 默认 displayName
+	GroupAttribute    string `mapstructure:"group_attribute"`    // 默认 memberOf（组 DN）
+	TimeoutSeconds    int    `mapstructure:"timeout_seconds"`
+	// FrontendRedirectURL: 需要邀请码时前端补全注册的路由（默认：/auth/ldap/callback）
+	FrontendRedirectURL string `mapstructure:"frontend_redirect_url"`
+	// GroupMappings: 目录组到 sub2api 分组/订阅/并发的映射，每次登录重新同步
+	GroupMappings []DirectoryGroupMapping `mapstructure:"group_mappings"`
+}
+
+// SAMLConnectConfig SAML 2.0 SP（HTTP-Redirect 发起 AuthnRequest，HTTP-POST 接收签名断言）
+type SAMLConnectConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	ProviderName string `mapstructure:"provider_name"` // 登录页显示名
+	// RootURL: 后端对外地址，用于生成 metadata 与 ACS 地址（{root}/api/v1/auth/saml/metadata、/acs）
+	RootURL string `mapstructure:"root_url"`
+	// EntityID: SP 实体 ID，为空时使用 metadata 地址
+	EntityID string `mapstructure:"entity_id"`
+	// CertificateFile / PrivateKeyFile: SP 证书与私钥（PEM），用于签名 AuthnRequest 与解密加密断言
+	CertificateFile string `mapstructure:"certificate_file"`
+	PrivateKeyFile  string `mapstructure:"private_key_file"`
+	// IDPMetadataURL / IDPMetadataFile: IdP 元数据来源，二选一
+	IDPMetadataURL  string `mapstructure:"idp_metadata_url"`
+	IDPMetadataFile string `mapstructure:"idp_metadata_file"`
+	// AllowIDPInitiated: 允许 IdP 发起的登录（无 AuthnRequest）
+	AllowIDPInitiated   bool   `mapstructure:"allow_idp_initiated"`
+	SignRequests        bool   `mapstructure:"sign_requests"`
+	FrontendRedirectURL string `mapstructure:"frontend_redirect_url"` // 前端接收 token 的路由（默认：/auth/saml/callback）
+	EmailAttribute      string `mapstructure:"email_attribute"`       // 为空时依次尝试 email/mail 常见属性名，最后使用 NameID
+	UsernameAttribute   string `mapstructure:"username_attribute"`
+	GroupAttribute      string `mapstructure:"group_attribute"` // 默认 groups
+	// GroupMappings: 目录组到 sub2api 分组/订阅/并发的映射，每次登录重新同步
+	GroupMappings []DirectoryGroupMapping `mapstructure:"group_mappings"`
+}
+
+// DirectoryGroupMapping 目录组映射。出现在任一映射中的分组由目录托管：
+// 用户不再属于对应目录组时，登录同步会撤销其分组权限与同步发放的订阅。
+type DirectoryGroupMapping struct {
+	// DirectoryGroup: LDAP 组 DN（或其 CN）、SAML 组属性值，不区分大小写
+	DirectoryGroup string `mapstructure:"directory_group"`
+	// AllowedGroupIDs: 加入 user_allowed_groups 的专属分组
+	AllowedGroupIDs []int64 `mapstructure:"allowed_group_ids"`
+	// Subscriptions: 发放的订阅（已有有效订阅时不重复发放）
+	Subscriptions []DirectorySubscriptionMapping `mapstructure:"subscriptions"`
+	// Concurrency: 用户并发数；命中多个映射时取最大值，0 表示不调整
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+// DirectorySubscriptionMapping 目录组映射的订阅发放
+type DirectorySubscriptionMapping struct {
+	GroupID      int64 `mapstructure:"group_id"`
+	ValidityDays int   `mapstructure:"validity_days"`
+}
+
+// SCIMConfig SCIM 2.0 用户/组自动供应（/scim/v2），IdP 使用专用 Bearer Token 调用。
+// 停用（active=false 或 DELETE）会禁用用户、禁用其全部 API Key 并撤销登录会话。
+type SCIMConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	BearerToken string `mapstructure:"bearer_token"` // 至少 32 个字符
+	// GroupIDs: 作为 SCIM Group 暴露的专属分组；为空时暴露全部专属分组
+	GroupIDs []int64 `mapstructure:"group_ids"`
+}
+
+// WebAuthnConfig 通行密钥（WebAuthn / Passkey）：无密码登录与第二因素。
+// RPID 必须是前端访问域名（或其可注册的上级域名），RPOrigins 为浏览器实际访问的完整来源。
+type WebAuthnConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	RPID          string   `mapstructure:"rp_id"`           // 例如 example.com
+	RPDisplayName string   `mapstructure:"rp_display_name"` // 认证器中展示的站点名称
+	RPOrigins     []string `mapstructure:"rp_origins"`      // 例如 https://example.com
+}
+
 // TokenRefreshConfig OAuth token自动刷新配置
 type TokenRefreshConfig struct {
 	// 是否启用自动刷新
@@ -282,6 +439,7 @@ type URLAllowlistConfig struct {
 	UpstreamHosts     []string `mapstructure:"upstream_hosts"`
 	PricingHosts      []string `mapstructure:"pricing_hosts"`
 	CRSHosts          []string `mapstructure:"crs_hosts"`
+	WebFetchHosts     []string `mapstructure:"web_fetch_hosts"` // web_fetch 模拟可抓取的主机（仅 enabled=true 时生效，空表示不限制）
 	AllowPrivateHosts bool     `mapstructure:"allow_private_hosts"`
 	// 关闭 URL 白名单校验时，是否允许 http URL（默认只允许 https）
 	AllowInsecureHTTP bool `mapstructure:"allow_insecure_http"`
@@ -428,6 +586,24 @@ type GatewayConfig struct {
 	// UserMessageQueue: 用户消息串行队列配置
 	// 对 role:"user" 的真实用户消息实施账号级串行化 + RPM 自适应延迟
 	UserMessageQueue UserMessageQueueConfig `mapstructure:"user_message_queue"`
+
+	// WebFetch: web_fetch 服务端工具模拟的抓取限制
+	WebFetch GatewayWebFetchConfig `mapstructure:"web_fetch"`
+}
+
+// GatewayWebFetchConfig web_fetch 模拟抓取配置
+// 私网/主机白名单策略复用 security.url_allowlist
+type GatewayWebFetchConfig struct {
+	// TimeoutSeconds: 单次抓取总超时（秒）
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+	// MaxResponseBytes: 抓取响应体读取上限（字节），超出部分截断
+	MaxResponseBytes int64 `mapstructure:"max_response_bytes"`
+	// MaxContentChars: 转换后正文字符数上限，超出部分截断
+	MaxContentChars int `mapstructure:"max_content_chars"`
+	// MaxRedirects: 最大重定向次数（每次重定向目标都会重新校验）
+	MaxRedirects int `mapstructure:"max_redirects"`
+	// QuotaLimit: 每月抓取次数上限，0 表示不限制
+	QuotaLimit int64 `mapstructure:"quota_limit"`
 }
 
 // UserMessageQueueConfig 用户消息串行队列配置
@@ -565,6 +741,8 @@ type GatewayOpenAIWSSchedulerScoreWeights struct {
 	Queue     float64 `mapstructure:"queue"`
 	ErrorRate float64 `mapstructure:"error_rate"`
 	TTFT      float64 `mapstructure:"ttft"`
+	// Quota 订阅额度余量（由额度预测给出）的权重
+	Quota float64 `mapstructure:"quota"`
 }
 
 // GatewayUsageRecordConfig 使用量记录异步队列配置
@@ -685,6 +863,38 @@ type GatewaySchedulingConfig struct {
 	// 全量重建周期配置
 	// 全量重建周期（秒），0 表示禁用
 	FullRebuildIntervalSeconds int `mapstructure:"full_rebuild_interval_seconds"`
+
+	// 订阅账号额度预测调度配置
+	QuotaForecast GatewayQuotaForecastConfig `mapstructure:"quota_forecast"`
+
+	// API Key 优先级分道配置
+	Priority GatewayPriorityConfig `mapstructure:"priority"`
+}
+
+// GatewayQuotaForecastConfig 订阅账号（Claude OAuth / Codex / Antigravity）额度耗尽预测配置。
+// 根据近期消耗速率与窗口重置时间估算耗尽时间，在触发 429 之前逐步降低该账号的调度权重。
+type GatewayQuotaForecastConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 计算消耗速率时使用的采样窗口
+	BurnRateWindow time.Duration `mapstructure:"burn_rate_window"`
+	// 使用率达到该值（0-100）开始线性降权
+	DrainStartPercent float64 `mapstructure:"drain_start_percent"`
+	// 使用率达到该值（0-100）视为完全排空，仅在其他账号不可用时才会被选中
+	DrainFullPercent float64 `mapstructure:"drain_full_percent"`
+}
+
+// GatewayPriorityConfig API Key 优先级分道（interactive / normal / background）配置。
+// 账号槽位获取与等待队列按优先级让位，background 请求只能占用账号容量的一部分，且在等待队列满时可被更高优先级抢占。
+type GatewayPriorityConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 让位模式：strict（有更高优先级等待时低优先级一律让位）或 weighted（按权重概率让位）
+	Mode string `mapstructure:"mode"`
+	// background 请求可占用的账号并发比例（0-1]，至少 1 个槽位
+	BackgroundMaxFraction float64 `mapstructure:"background_max_fraction"`
+	// weighted 模式下各优先级权重
+	InteractiveWeight float64 `mapstructure:"interactive_weight"`
+	NormalWeight      float64 `mapstructure:"normal_weight"`
+	BackgroundWeight  float64 `mapstructure:"background_weight"`
 }
 
 func (s *ServerConfig) Address() string {
@@ -1025,6 +1235,10 @@ func load(allowMissingJWTSecret bool) (*Config, error) {
 	cfg.OIDC.UserInfoIDPath = strings.TrimSpace(cfg.OIDC.UserInfoIDPath)
 	cfg.OIDC.UserInfoUsernamePath = strings.TrimSpace(cfg.OIDC.UserInfoUsernamePath)
 	cfg.Dashboard.KeyPrefix = strings.TrimSpace(cfg.Dashboard.KeyPrefix)
+	cfg.Cluster.NodeID = strings.TrimSpace(cfg.Cluster.NodeID)
+	if cfg.Cluster.NodeID == "" {
+		cfg.Cluster.NodeID = defaultClusterNodeID()
+	}
 	cfg.CORS.AllowedOrigins = normalizeStringSlice(cfg.CORS.AllowedOrigins)
 	cfg.Security.ResponseHeaders.AdditionalAllowed = normalizeStringSlice(cfg.Security.ResponseHeaders.AdditionalAllowed)
 	cfg.Security.ResponseHeaders.ForceRemove = normalizeStringSlice(cfg.Security.ResponseHeaders.ForceRemove)
@@ -1165,6 +1379,7 @@ func setDefaults() {
 		"raw.githubusercontent.com",
 	})
 	viper.SetDefault("security.url_allowlist.crs_hosts", []string{})
+	viper.SetDefault("security.url_allowlist.web_fetch_hosts", []string{})
 	viper.SetDefault("security.url_allowlist.allow_private_hosts", true)
 	viper.SetDefault("security.url_allowlist.allow_insecure_http", true)
 	viper.SetDefault("security.response_headers.enabled", true)
@@ -1226,6 +1441,47 @@ func setDefaults() {
 	viper.SetDefault("oidc_connect.userinfo_id_path", "")
 	viper.SetDefault("oidc_connect.userinfo_username_path", "")
 
+	// LDAP / Active Directory 登录
+	viper.SetDefault("ldap_connect.enabled", false)
+	viper.SetDefault("ldap_connect.provider_name", "LDAP")
+	viper.SetDefault("ldap_connect.url", "")
+	viper.SetDefault("ldap_connect.start_tls", false)
+	viper.SetDefault("ldap_connect.insecure_skip_verify", false)
+	viper.SetDefault("ldap_connect.bind_dn", "")
+	viper.SetDefault("ldap_connect.bind_password", "")
+	viper.SetDefault("ldap_connect.base_dn", "")
+	viper.SetDefault("ldap_connect.user_filter", "(&(objectClass=user)(sAMAccountName={username}))")
+	viper.SetDefault("ldap_connect.email_attribute", "mail")
+	viper.SetDefault("ldap_connect.username_attribute", "displayName")
+	viper.SetDefault("ldap_connect.group_attribute", "memberOf")
+	viper.SetDefault("ldap_connect.timeout_seconds", 10)
+	viper.SetDefault("ldap_connect.frontend_redirect_url", "/auth/ldap/callback")
+
+	// SAML 2.0 登录
+	viper.SetDefault("saml_connect.enabled", false)
+	viper.SetDefault("saml_connect.provider_name", "SAML")
+	viper.SetDefault("saml_connect.root_url", "")
+	viper.SetDefault("saml_connect.entity_id", "")
+	viper.SetDefault("saml_connect.certificate_file", "")
+	viper.SetDefault("saml_connect.private_key_file", "")
+	viper.SetDefault("saml_connect.idp_metadata_url", "")
+	viper.SetDefault("saml_connect.idp_metadata_file", "")
+	viper.SetDefault("saml_connect.allow_idp_initiated", false)
+	viper.SetDefault("saml_connect.sign_requests", false)
+	viper.SetDefault("saml_connect.frontend_redirect_url", "/auth/saml/callback")
+	viper.SetDefault("saml_connect.email_attribute", "")
+	viper.SetDefault("saml_connect.username_attribute", "")
+	viper.SetDefault("saml_connect.group_attribute", "groups")
+
+	// SCIM 2.0 自动供应
+	viper.SetDefault("scim.enabled", false)
+	viper.SetDefault("scim.bearer_token", "")
+
+	// WebAuthn 通行密钥
+	viper.SetDefault("webauthn.enabled", false)
+	viper.SetDefault("webauthn.rp_id", "")
+	viper.SetDefault("webauthn.rp_display_name", "Sub2API")
+
 	// Database
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", 5432)
@@ -1348,6 +1604,32 @@ func setDefaults() {
 	viper.SetDefault("idempotency.cleanup_interval_seconds", 60)
 	viper.SetDefault("idempotency.cleanup_batch_size", 500)
 
+	// Privacy
+	viper.SetDefault("privacy.export_dir", "./data/exports")
+	viper.SetDefault("privacy.export_retention_hours", 72)
+	viper.SetDefault("privacy.download_link_ttl_minutes", 30)
+	viper.SetDefault("privacy.deletion_grace_days", 14)
+	viper.SetDefault("privacy.worker_interval_seconds", 60)
+
+	// Cluster
+	viper.SetDefault("cluster.enabled", false)
+	viper.SetDefault("cluster.node_id", "")
+	viper.SetDefault("cluster.heartbeat_interval_seconds", 10)
+
+	// Shadow traffic
+	viper.SetDefault("shadow.enabled", true)
+	viper.SetDefault("shadow.max_concurrency", 16)
+	viper.SetDefault("shadow.timeout_seconds", 300)
+	viper.SetDefault("shadow.rule_cache_seconds", 15)
+
+	// OAuth authorization server (device code / PKCE)
+	viper.SetDefault("oauth_server.enabled", false)
+	viper.SetDefault("oauth_server.device_code_ttl_seconds", 600)
+	viper.SetDefault("oauth_server.poll_interval_seconds", 5)
+	viper.SetDefault("oauth_server.auth_code_ttl_seconds", 120)
+	viper.SetDefault("oauth_server.key_ttl_minutes", 1440)
+	viper.SetDefault("oauth_server.refresh_token_ttl_days", 0)
+
 	// Gateway
 	viper.SetDefault("gateway.response_header_timeout", 600) // 600秒(10分钟)等待上游响应头，LLM高负载时可能排队较久
 	viper.SetDefault("gateway.log_upstream_error_body", true)
@@ -1404,6 +1686,7 @@ func setDefaults() {
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.queue", 0.7)
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.error_rate", 0.8)
 	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.ttft", 0.5)
+	viper.SetDefault("gateway.openai_ws.scheduler_score_weights.quota", 1.0)
 	viper.SetDefault("gateway.antigravity_fallback_cooldown_minutes", 1)
 	viper.SetDefault("gateway.antigravity_extra_retries", 10)
 	viper.SetDefault("gateway.max_body_size", int64(256*1024*1024))
@@ -1440,6 +1723,16 @@ func setDefaults() {
 	viper.SetDefault("gateway.scheduling.outbox_lag_rebuild_failures", 3)
 	viper.SetDefault("gateway.scheduling.outbox_backlog_rebuild_rows", 10000)
 	viper.SetDefault("gateway.scheduling.full_rebuild_interval_seconds", 300)
+	viper.SetDefault("gateway.scheduling.quota_forecast.enabled", true)
+	viper.SetDefault("gateway.scheduling.quota_forecast.burn_rate_window", 30*time.Minute)
+	viper.SetDefault("gateway.scheduling.quota_forecast.drain_start_percent", 80.0)
+	viper.SetDefault("gateway.scheduling.quota_forecast.drain_full_percent", 95.0)
+	viper.SetDefault("gateway.scheduling.priority.enabled", true)
+	viper.SetDefault("gateway.scheduling.priority.mode", "strict")
+	viper.SetDefault("gateway.scheduling.priority.background_max_fraction", 0.5)
+	viper.SetDefault("gateway.scheduling.priority.interactive_weight", 8.0)
+	viper.SetDefault("gateway.scheduling.priority.normal_weight", 4.0)
+	viper.SetDefault("gateway.scheduling.priority.background_weight", 1.0)
 	viper.SetDefault("gateway.usage_record.worker_count", 128)
 	viper.SetDefault("gateway.usage_record.queue_size", 16384)
 	viper.SetDefault("gateway.usage_record.task_timeout_seconds", 5)
@@ -1464,6 +1757,11 @@ func setDefaults() {
 	viper.SetDefault("gateway.user_message_queue.min_delay_ms", 200)
 	viper.SetDefault("gateway.user_message_queue.max_delay_ms", 2000)
 	viper.SetDefault("gateway.user_message_queue.cleanup_interval_seconds", 60)
+	viper.SetDefault("gateway.web_fetch.timeout_seconds", 30)
+	viper.SetDefault("gateway.web_fetch.max_response_bytes", int64(10*1024*1024))
+	viper.SetDefault("gateway.web_fetch.max_content_chars", 100000)
+	viper.SetDefault("gateway.web_fetch.max_redirects", 5)
+	viper.SetDefault("gateway.web_fetch.quota_limit", int64(0))
 
 	viper.SetDefault("gateway.tls_fingerprint.enabled", true)
 	viper.SetDefault("concurrency.ping_interval", 10)
@@ -1743,6 +2041,86 @@ func (c *Config) Validate() error {
 		warnIfInsecureURL("oidc_connect.redirect_url", c.OIDC.RedirectURL)
 		warnIfInsecureURL("oidc_connect.frontend_redirect_url", c.OIDC.FrontendRedirectURL)
 	}
+	if c.LDAP.Enabled {
+		u, err := url.Parse(strings.TrimSpace(c.LDAP.URL))
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("ldap_connect.url must be an ldap:// or ldaps:// URL")
+		}
+		if u.Scheme == "ldaps" && c.LDAP.StartTLS {
+			return fmt.Errorf("ldap_connect.start_tls cannot be used with ldaps://")
+		}
+		if strings.TrimSpace(c.LDAP.BaseDN) == "" {
+			return fmt.Errorf("ldap_connect.base_dn is required when ldap_connect.enabled=true")
+		}
+		if !strings.Contains(c.LDAP.UserFilter, "{username}") {
+			return fmt.Errorf("ldap_connect.user_filter must contain {username}")
+		}
+		if c.LDAP.TimeoutSeconds <= 0 {
+			return fmt.Errorf("ldap_connect.timeout_seconds must be positive")
+		}
+		if err := ValidateFrontendRedirectURL(c.LDAP.FrontendRedirectURL); err != nil {
+			return fmt.Errorf("ldap_connect.frontend_redirect_url invalid: %w", err)
+		}
+		if err := validateDirectoryGroupMappings("ldap_connect", c.LDAP.GroupMappings); err != nil {
+			return err
+		}
+		if u.Scheme == "ldap" && !c.LDAP.StartTLS {
+			slog.Warn("ldap url uses plain ldap:// without start_tls; passwords are sent in cleartext", "field", "ldap_connect.url")
+		}
+	}
+	if c.SAML.Enabled {
+		if err := ValidateAbsoluteHTTPURL(c.SAML.RootURL); err != nil {
+			return fmt.Errorf("saml_connect.root_url invalid: %w", err)
+		}
+		metadataURL := strings.TrimSpace(c.SAML.IDPMetadataURL)
+		metadataFile := strings.TrimSpace(c.SAML.IDPMetadataFile)
+		if (metadataURL == "") == (metadataFile == "") {
+			return fmt.Errorf("saml_connect: exactly one of idp_metadata_url or idp_metadata_file is required")
+		}
+		if metadataURL != "" {
+			if err := ValidateAbsoluteHTTPURL(metadataURL); err != nil {
+				return fmt.Errorf("saml_connect.idp_metadata_url invalid: %w", err)
+			}
+		}
+		if (strings.TrimSpace(c.SAML.CertificateFile) == "") != (strings.TrimSpace(c.SAML.PrivateKeyFile) == "") {
+			return fmt.Errorf("saml_connect.certificate_file and saml_connect.private_key_file must be set together")
+		}
+		if c.SAML.SignRequests && strings.TrimSpace(c.SAML.PrivateKeyFile) == "" {
+			return fmt.Errorf("saml_connect.private_key_file is required when saml_connect.sign_requests=true")
+		}
+		if err := ValidateFrontendRedirectURL(c.SAML.FrontendRedirectURL); err != nil {
+			return fmt.Errorf("saml_connect.frontend_redirect_url invalid: %w", err)
+		}
+		if err := validateDirectoryGroupMappings("saml_connect", c.SAML.GroupMappings); err != nil {
+			return err
+		}
+		warnIfInsecureURL("saml_connect.root_url", c.SAML.RootURL)
+		warnIfInsecureURL("saml_connect.idp_metadata_url", c.SAML.IDPMetadataURL)
+	}
+	if c.SCIM.Enabled {
+		if len(strings.TrimSpace(c.SCIM.BearerToken)) < 32 {
+			return fmt.Errorf("scim.bearer_token must be at least 32 characters when scim.enabled=true")
+		}
+		for _, id := range c.SCIM.GroupIDs {
+			if id <= 0 {
+				return fmt.Errorf("scim.group_ids must contain positive group ids")
+			}
+		}
+	}
+	if c.WebAuthn.Enabled {
+		rpID := strings.TrimSpace(c.WebAuthn.RPID)
+		if rpID == "" || strings.Contains(rpID, "/") || strings.Contains(rpID, ":") {
+			return fmt.Errorf("webauthn.rp_id must be a bare domain name when webauthn.enabled=true")
+		}
+		if len(c.WebAuthn.RPOrigins) == 0 {
+			return fmt.Errorf("webauthn.rp_origins must not be empty when webauthn.enabled=true")
+		}
+		for _, origin := range c.WebAuthn.RPOrigins {
+			if err := ValidateAbsoluteHTTPURL(origin); err != nil {
+				return fmt.Errorf("webauthn.rp_origins: %w", err)
+			}
+		}
+	}
 	if c.Billing.CircuitBreaker.Enabled {
 		if c.Billing.CircuitBreaker.FailureThreshold <= 0 {
 			return fmt.Errorf("billing.circuit_breaker.failure_threshold must be positive")
@@ -1921,6 +2299,67 @@ func (c *Config) Validate() error {
 	if c.Idempotency.CleanupBatchSize <= 0 {
 		return fmt.Errorf("idempotency.cleanup_batch_size must be positive")
 	}
+	if strings.TrimSpace(c.Privacy.ExportDir) == "" {
+		return fmt.Errorf("privacy.export_dir is required")
+	}
+	if c.Privacy.ExportRetentionHours <= 0 {
+		return fmt.Errorf("privacy.export_retention_hours must be positive")
+	}
+	if c.Privacy.DownloadLinkTTLMinutes <= 0 {
+		return fmt.Errorf("privacy.download_link_ttl_minutes must be positive")
+	}
+	if c.Privacy.DeletionGraceDays < 0 {
+		return fmt.Errorf("privacy.deletion_grace_days must be non-negative")
+	}
+	if c.Privacy.WorkerIntervalSeconds <= 0 {
+		return fmt.Errorf("privacy.worker_interval_seconds must be positive")
+	}
+	if c.Cluster.HeartbeatIntervalSeconds <= 0 {
+		return fmt.Errorf("cluster.heartbeat_interval_seconds must be positive")
+	}
+	if strings.ContainsAny(c.Cluster.NodeID, " \t\r\n|") {
+		return fmt.Errorf("cluster.node_id must not contain whitespace or '|'")
+	}
+	if c.Shadow.MaxConcurrency <= 0 {
+		return fmt.Errorf("shadow.max_concurrency must be positive")
+	}
+	if c.Shadow.TimeoutSeconds <= 0 {
+		return fmt.Errorf("shadow.timeout_seconds must be positive")
+	}
+	if c.Shadow.RuleCacheSeconds <= 0 {
+		return fmt.Errorf("shadow.rule_cache_seconds must be positive")
+	}
+	if c.OAuthServer.DeviceCodeTTLSeconds <= 0 {
+		return fmt.Errorf("oauth_server.device_code_ttl_seconds must be positive")
+	}
+	if c.OAuthServer.PollIntervalSeconds <= 0 {
+		return fmt.Errorf("oauth_server.poll_interval_seconds must be positive")
+	}
+	if c.OAuthServer.AuthCodeTTLSeconds <= 0 {
+		return fmt.Errorf("oauth_server.auth_code_ttl_seconds must be positive")
+	}
+	if c.OAuthServer.KeyTTLMinutes <= 0 {
+		return fmt.Errorf("oauth_server.key_ttl_minutes must be positive")
+	}
+	if c.OAuthServer.RefreshTokenTTLDays < 0 {
+		return fmt.Errorf("oauth_server.refresh_token_ttl_days must be non-negative")
+	}
+	seenOAuthClients := make(map[string]struct{}, len(c.OAuthServer.Clients))
+	for i, client := range c.OAuthServer.Clients {
+		id := strings.TrimSpace(client.ClientID)
+		if id == "" {
+			return fmt.Errorf("oauth_server.clients[%d].client_id is required", i)
+		}
+		if _, dup := seenOAuthClients[id]; dup {
+			return fmt.Errorf("oauth_server.clients[%d].client_id %q is duplicated", i, id)
+		}
+		seenOAuthClients[id] = struct{}{}
+		for _, redirectURI := range client.RedirectURIs {
+			if err := ValidateAbsoluteHTTPURL(redirectURI); err != nil {
+				return fmt.Errorf("oauth_server.clients[%d].redirect_uris invalid: %w", i, err)
+			}
+		}
+	}
 	if c.Gateway.MaxBodySize <= 0 {
 		return fmt.Errorf("gateway.max_body_size must be positive")
 	}
@@ -1930,6 +2369,10 @@ func (c *Config) Validate() error {
 	if c.Gateway.ProxyProbeResponseReadMaxBytes <= 0 {
 		return fmt.Errorf("gateway.proxy_probe_response_read_max_bytes must be positive")
 	}
+	if c.Gateway.WebFetch.TimeoutSeconds < 0 || c.Gateway.WebFetch.MaxResponseBytes < 0 ||
+		c.Gateway.WebFetch.MaxContentChars < 0 || c.Gateway.WebFetch.MaxRedirects < 0 || c.Gateway.WebFetch.QuotaLimit < 0 {
+		return fmt.Errorf("gateway.web_fetch limits must be non-negative")
+	}
 	if strings.TrimSpace(c.Gateway.ConnectionPoolIsolation) != "" {
 		switch c.Gateway.ConnectionPoolIsolation {
 		case ConnectionPoolIsolationProxy, ConnectionPoolIsolationAccount, ConnectionPoolIsolationAccountProxy:
@@ -2079,7 +2522,8 @@ func (c *Config) Validate() error {
 		c.Gateway.OpenAIWS.SchedulerScoreWeights.Load < 0 ||
 		c.Gateway.OpenAIWS.SchedulerScoreWeights.Queue < 0 ||
 		c.Gateway.OpenAIWS.SchedulerScoreWeights.ErrorRate < 0 ||
-		c.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT < 0 {
+		c.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT < 0 ||
+		c.Gateway.OpenAIWS.SchedulerScoreWeights.Quota < 0 {
 		return fmt.Errorf("gateway.openai_ws.scheduler_score_weights.* must be non-negative")
 	}
 	weightSum := c.Gateway.OpenAIWS.SchedulerScoreWeights.Priority +
@@ -2205,6 +2649,27 @@ func (c *Config) Validate() error {
 	if c.Gateway.Scheduling.FullRebuildIntervalSeconds < 0 {
 		return fmt.Errorf("gateway.scheduling.full_rebuild_interval_seconds must be non-negative")
 	}
+	if qf := c.Gateway.Scheduling.QuotaForecast; qf.Enabled {
+		if qf.BurnRateWindow <= 0 {
+			return fmt.Errorf("gateway.scheduling.quota_forecast.burn_rate_window must be positive")
+		}
+		if qf.DrainStartPercent < 0 || qf.DrainFullPercent > 100 || qf.DrainStartPercent >= qf.DrainFullPercent {
+			return fmt.Errorf("gateway.scheduling.quota_forecast requires 0 <= drain_start_percent < drain_full_percent <= 100")
+		}
+	}
+	if pr := c.Gateway.Scheduling.Priority; pr.Enabled {
+		switch pr.Mode {
+		case "strict", "weighted":
+		default:
+			return fmt.Errorf("gateway.scheduling.priority.mode must be one of: strict/weighted")
+		}
+		if pr.BackgroundMaxFraction <= 0 || pr.BackgroundMaxFraction > 1 {
+			return fmt.Errorf("gateway.scheduling.priority.background_max_fraction must be within (0, 1]")
+		}
+		if pr.InteractiveWeight <= 0 || pr.NormalWeight <= 0 || pr.BackgroundWeight <= 0 {
+			return fmt.Errorf("gateway.scheduling.priority weights must be positive")
+		}
+	}
 	if c.Gateway.Scheduling.OutboxLagWarnSeconds > 0 &&
 		c.Gateway.Scheduling.OutboxLagRebuildSeconds > 0 &&
 		c.Gateway.Scheduling.OutboxLagRebuildSeconds < c.Gateway.Scheduling.OutboxLagWarnSeconds {
@@ -2231,6 +2696,16 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// defaultClusterNodeID 未配置 node_id 时使用主机名（容器内即 Pod/容器名）
+func defaultClusterNodeID() string {
+	host, err := os.Hostname()
+	host = strings.TrimSpace(host)
+	if err != nil || host == "" {
+		return "node-" + strconv.Itoa(os.Getpid())
+	}
+	return host
+}
+
 func normalizeStringSlice(values []string) []string {
 	if len(values) == 0 {
 		return values
@@ -2361,6 +2836,28 @@ func ValidateFrontendRedirectURL(raw string) error {
 	return nil
 }
 
+func validateDirectoryGroupMappings(prefix string, mappings []DirectoryGroupMapping) error {
+	for i, m := range mappings {
+		if strings.TrimSpace(m.DirectoryGroup) == "" {
+			return fmt.Errorf("%s.group_mappings[%d].directory_group is required", prefix, i)
+		}
+		for _, id := range m.AllowedGroupIDs {
+			if id <= 0 {
+				return fmt.Errorf("%s.group_mappings[%d].allowed_group_ids must be positive", prefix, i)
+			}
+		}
+		for j, sub := range m.Subscriptions {
+			if sub.GroupID <= 0 || sub.ValidityDays <= 0 {
+				return fmt.Errorf("%s.group_mappings[%d].subscriptions[%d] requires positive group_id and validity_days", prefix, i, j)
+			}
+		}
+		if m.Concurrency < 0 {
+			return fmt.Errorf("%s.group_mappings[%d].concurrency must be non-negative", prefix, i)
+		}
+	}
+	return nil
+}
+
 func scopeContainsOpenID(scopes string) bool {
 	for _, scope := range strings.Fields(strings.ToLower(strings.TrimSpace(scopes))) {
 		if scope == "openid" {
@@ -31,6 +31,8 @@ const (
 	AccountTypeAPIKey     = "apikey"      // API Key类型账号
 	AccountTypeUpstream   = "upstream"    // 上游透传类型账号（通过 Base URL + API Key 连接上游）
 	AccountTypeBedrock    = "bedrock"     // AWS Bedrock 类型账号（通过 SigV4 签名或 API Key 连接 Bedrock，由 credentials.auth_mode 区分）
+	AccountTypeVertex     = "vertex"      // Google Vertex AI 类型账号（服务账号 JSON 换取 access token，支持 Claude 与 Gemini 模型）
+	AccountTypeAzure      = "azure"       // Azure OpenAI 类型账号（资源端点 + 部署名映射，API Key 或 Entra ID 客户端凭据认证）
 )
 
 // Redeem type constants
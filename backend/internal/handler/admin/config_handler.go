@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxConfigSpecBodyBytes 配置文件请求体上限
+const maxConfigSpecBodyBytes = 4 << 20
+
+// ConfigHandler handles declarative config-as-code plan/apply
+type ConfigHandler struct {
+	configService *service.ConfigAsCodeService
+}
+
+// NewConfigHandler creates a new admin config-as-code handler
+func NewConfigHandler(configService *service.ConfigAsCodeService) *ConfigHandler {
+	return &ConfigHandler{configService: configService}
+}
+
+func (h *ConfigHandler) readSpec(c *gin.Context) (*service.ConfigSpec, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxConfigSpecBodyBytes))
+	if err != nil {
+		response.BadRequest(c, "Failed to read config spec: "+err.Error())
+		return nil, false
+	}
+	spec, err := service.ParseConfigSpec(data)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return nil, false
+	}
+	return spec, true
+}
+
+// Plan diffs a config spec against the live state
+// POST /api/v1/admin/config/plan
+// Body: YAML or JSON config spec
+func (h *ConfigHandler) Plan(c *gin.Context) {
+	spec, ok := h.readSpec(c)
+	if !ok {
+		return
+	}
+	plan, err := h.configService.Plan(c.Request.Context(), spec)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, plan)
+}
+
+// Apply executes the plan for a config spec, rolling back on failure
+// POST /api/v1/admin/config/apply?plan_hash=<hash from plan>
+// Body: YAML or JSON config spec
+func (h *ConfigHandler) Apply(c *gin.Context) {
+	spec, ok := h.readSpec(c)
+	if !ok {
+		return
+	}
+	result, err := h.configService.Apply(c.Request.Context(), spec, c.Query("plan_hash"))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, result)
+}
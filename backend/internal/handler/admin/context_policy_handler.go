@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextPolicyHandler handles per-group context-window overflow policies
+type ContextPolicyHandler struct {
+	contextPolicyService *service.ContextPolicyService
+}
+
+// NewContextPolicyHandler creates a new admin context policy handler
+func NewContextPolicyHandler(contextPolicyService *service.ContextPolicyService) *ContextPolicyHandler {
+	return &ContextPolicyHandler{contextPolicyService: contextPolicyService}
+}
+
+// ContextPolicyRequest represents an update context policy request.
+// Omitted fields keep their current values.
+type ContextPolicyRequest struct {
+	Enabled          *bool   `json:"enabled"`
+	Action           *string `json:"action"`
+	LongContextModel *string `json:"long_context_model"`
+	ContextWindow    *int    `json:"context_window"`
+	ReserveTokens    *int    `json:"reserve_tokens"`
+}
+
+// GetPolicy returns the context policy of a group (disabled defaults when unset)
+// GET /api/v1/admin/groups/:id/context-policy
+func (h *ContextPolicyHandler) GetPolicy(c *gin.Context) {
+	groupID, ok := parsePolicyGroupID(c)
+	if !ok {
+		return
+	}
+	policy, err := h.contextPolicyService.GetPolicy(c.Request.Context(), groupID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, policy)
+}
+
+// UpdatePolicy creates or updates the context policy of a group
+// PUT /api/v1/admin/groups/:id/context-policy
+func (h *ContextPolicyHandler) UpdatePolicy(c *gin.Context) {
+	groupID, ok := parsePolicyGroupID(c)
+	if !ok {
+		return
+	}
+	var req ContextPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	policy, err := h.contextPolicyService.GetPolicy(c.Request.Context(), groupID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.Action != nil {
+		policy.Action = *req.Action
+	}
+	if req.LongContextModel != nil {
+		policy.LongContextModel = *req.LongContextModel
+	}
+	if req.ContextWindow != nil {
+		policy.ContextWindow = *req.ContextWindow
+	}
+	if req.ReserveTokens != nil {
+		policy.ReserveTokens = *req.ReserveTokens
+	}
+	updated, err := h.contextPolicyService.SetPolicy(c.Request.Context(), policy)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, updated)
+}
+
+// DeletePolicy removes the context policy of a group
+// DELETE /api/v1/admin/groups/:id/context-policy
+func (h *ContextPolicyHandler) DeletePolicy(c *gin.Context) {
+	groupID, ok := parsePolicyGroupID(c)
+	if !ok {
+		return
+	}
+	if err := h.contextPolicyService.DeletePolicy(c.Request.Context(), groupID); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"message": "Context policy deleted successfully"})
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+// GetClusterNodes returns live replicas and the number of sessions each one owns.
+// GET /api/v1/admin/ops/cluster/nodes
+func (h *OpsHandler) GetClusterNodes(c *gin.Context) {
+	if h.opsService == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Ops service not available")
+		return
+	}
+	if err := h.opsService.RequireMonitoringEnabled(c.Request.Context()); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	overview, err := h.opsService.GetClusterOverview(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, overview)
+}
+
+// ListClusterNodeSessions returns sessions (digest / WS bindings) owned by a replica.
+// GET /api/v1/admin/ops/cluster/nodes/:node_id/sessions
+func (h *OpsHandler) ListClusterNodeSessions(c *gin.Context) {
+	if h.opsService == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Ops service not available")
+		return
+	}
+	if err := h.opsService.RequireMonitoringEnabled(c.Request.Context()); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	limit := 0
+	if v := strings.TrimSpace(c.Query("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			response.BadRequest(c, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	sessions, err := h.opsService.ListClusterSessions(c.Request.Context(), c.Param("node_id"), limit)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{
+		"node_id":  strings.TrimSpace(c.Param("node_id")),
+		"sessions": sessions,
+	})
+}
@@ -29,6 +29,7 @@ func (h *OpsHandler) GetConcurrencyStats(c *gin.Context) {
 			"platform":  map[string]*service.PlatformConcurrencyInfo{},
 			"group":     map[int64]*service.GroupConcurrencyInfo{},
 			"account":   map[int64]*service.AccountConcurrencyInfo{},
+			"priority":  []service.PriorityClassStats{},
 			"timestamp": time.Now().UTC(),
 		})
 		return
@@ -56,6 +57,7 @@ func (h *OpsHandler) GetConcurrencyStats(c *gin.Context) {
 		"platform": platform,
 		"group":    group,
 		"account":  account,
+		"priority": h.opsService.GetPriorityClassStats(),
 	}
 	if collectedAt != nil {
 		payload["timestamp"] = collectedAt.UTC()
@@ -100,6 +102,30 @@ func (h *OpsHandler) GetUserConcurrencyStats(c *gin.Context) {
 	response.Success(c, payload)
 }
 
+// GetFairShareStats returns per-group fair-share admission state (tenant shares,
+// queue positions and estimated waits) for the current instance.
+// GET /api/v1/admin/ops/fair-share
+func (h *OpsHandler) GetFairShareStats(c *gin.Context) {
+	if h.opsService == nil {
+		response.Error(c, http.StatusServiceUnavailable, "Ops service not available")
+		return
+	}
+	if err := h.opsService.RequireMonitoringEnabled(c.Request.Context()); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	if !h.opsService.IsRealtimeMonitoringEnabled(c.Request.Context()) {
+		response.Success(c, &service.OpsFairShareOverview{
+			Groups:    []service.FairShareGroupStats{},
+			Timestamp: time.Now().UTC(),
+		})
+		return
+	}
+
+	response.Success(c, h.opsService.GetFairShareOverview(c.Request.Context()))
+}
+
 // GetAccountAvailability returns account availability statistics.
 // GET /api/v1/admin/ops/account-availability
 //
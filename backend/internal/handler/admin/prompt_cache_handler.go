@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromptCacheHandler handles per-group automatic prompt-cache breakpoint policies
+type PromptCacheHandler struct {
+	promptCacheService *service.PromptCacheService
+}
+
+// NewPromptCacheHandler creates a new admin prompt cache handler
+func NewPromptCacheHandler(promptCacheService *service.PromptCacheService) *PromptCacheHandler {
+	return &PromptCacheHandler{promptCacheService: promptCacheService}
+}
+
+// PromptCachePolicyRequest represents an update prompt cache policy request.
+// Omitted fields keep their current values.
+type PromptCachePolicyRequest struct {
+	Enabled         *bool   `json:"enabled"`
+	TTLMode         *string `json:"ttl_mode"`
+	MinPrefixTokens *int    `json:"min_prefix_tokens"`
+	CacheTools      *bool   `json:"cache_tools"`
+	CacheSystem     *bool   `json:"cache_system"`
+	CacheMessages   *bool   `json:"cache_messages"`
+}
+
+func parsePolicyGroupID(c *gin.Context) (int64, bool) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || groupID <= 0 {
+		response.BadRequest(c, "Invalid group ID")
+		return 0, false
+	}
+	return groupID, true
+}
+
+// GetPolicy returns the prompt cache policy of a group (disabled defaults when unset)
+// GET /api/v1/admin/groups/:id/prompt-cache-policy
+func (h *PromptCacheHandler) GetPolicy(c *gin.Context) {
+	groupID, ok := parsePolicyGroupID(c)
+	if !ok {
+		return
+	}
+	policy, err := h.promptCacheService.GetPolicy(c.Request.Context(), groupID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, policy)
+}
+
+// UpdatePolicy creates or updates the prompt cache policy of a group
+// PUT /api/v1/admin/groups/:id/prompt-cache-policy
+func (h *PromptCacheHandler) UpdatePolicy(c *gin.Context) {
+	groupID, ok := parsePolicyGroupID(c)
+	if !ok {
+		return
+	}
+	var req PromptCachePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	policy, err := h.promptCacheService.GetPolicy(c.Request.Context(), groupID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.TTLMode != nil {
+		policy.TTLMode = *req.TTLMode
+	}
+	if req.MinPrefixTokens != nil {
+		policy.MinPrefixTokens = *req.MinPrefixTokens
+	}
+	if req.CacheTools != nil {
+		policy.CacheTools = *req.CacheTools
+	}
+	if req.CacheSystem != nil {
+		policy.CacheSystem = *req.CacheSystem
+	}
+	if req.CacheMessages != nil {
+		policy.CacheMessages = *req.CacheMessages
+	}
+	updated, err := h.promptCacheService.SetPolicy(c.Request.Context(), policy)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, updated)
+}
+
+// DeletePolicy removes the prompt cache policy of a group
+// DELETE /api/v1/admin/groups/:id/prompt-cache-policy
+func (h *PromptCacheHandler) DeletePolicy(c *gin.Context) {
+	groupID, ok := parsePolicyGroupID(c)
+	if !ok {
+		return
+	}
+	if err := h.promptCacheService.DeletePolicy(c.Request.Context(), groupID); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"message": "Prompt cache policy deleted successfully"})
+}
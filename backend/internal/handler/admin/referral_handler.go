@@ -0,0 +1,171 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReferralHandler handles admin referral program management
+type ReferralHandler struct {
+	referralService *service.ReferralService
+}
+
+// NewReferralHandler creates a new admin referral handler
+func NewReferralHandler(referralService *service.ReferralService) *ReferralHandler {
+	return &ReferralHandler{
+		referralService: referralService,
+	}
+}
+
+// ReferralPayoutRequest represents an admin-recorded off-platform payout
+type ReferralPayoutRequest struct {
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Note   string  `json:"note"`
+}
+
+// GetConfig returns the referral program configuration
+// GET /api/v1/admin/referrals/config
+func (h *ReferralHandler) GetConfig(c *gin.Context) {
+	cfg, err := h.referralService.GetConfig(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, cfg)
+}
+
+// UpdateConfig updates the referral program configuration
+// PUT /api/v1/admin/referrals/config
+func (h *ReferralHandler) UpdateConfig(c *gin.Context) {
+	var req service.ReferralConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	cfg, err := h.referralService.UpdateConfig(c.Request.Context(), &req)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, cfg)
+}
+
+// GetStats returns program-wide referral stats, or one referrer's stats when referrer_id is set
+// GET /api/v1/admin/referrals/stats
+func (h *ReferralHandler) GetStats(c *gin.Context) {
+	referrerID, ok := parseOptionalReferralID(c, "referrer_id")
+	if !ok {
+		return
+	}
+	stats, err := h.referralService.GetStats(c.Request.Context(), referrerID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, stats)
+}
+
+// ListRelations lists referral relations
+// GET /api/v1/admin/referrals/relations
+func (h *ReferralHandler) ListRelations(c *gin.Context) {
+	filters, ok := parseReferralListFilters(c)
+	if !ok {
+		return
+	}
+	page, pageSize := response.ParsePagination(c)
+	params := pagination.PaginationParams{Page: page, PageSize: pageSize}
+
+	relations, result, err := h.referralService.ListRelations(c.Request.Context(), params, filters)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Paginated(c, relations, result.Total, page, pageSize)
+}
+
+// ListCommissions lists referral commissions
+// GET /api/v1/admin/referrals/commissions
+func (h *ReferralHandler) ListCommissions(c *gin.Context) {
+	filters, ok := parseReferralListFilters(c)
+	if !ok {
+		return
+	}
+	page, pageSize := response.ParsePagination(c)
+	params := pagination.PaginationParams{Page: page, PageSize: pageSize}
+
+	commissions, result, err := h.referralService.ListCommissions(c.Request.Context(), params, filters)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Paginated(c, commissions, result.Total, page, pageSize)
+}
+
+// ListUserPayouts lists payouts of a user
+// GET /api/v1/admin/referrals/users/:id/payouts
+func (h *ReferralHandler) ListUserPayouts(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID <= 0 {
+		response.BadRequest(c, "Invalid user ID")
+		return
+	}
+	payouts, err := h.referralService.ListPayouts(c.Request.Context(), userID, 100)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, payouts)
+}
+
+// RecordPayout records an off-platform settlement and deducts the user's referral credit
+// POST /api/v1/admin/referrals/users/:id/payouts
+func (h *ReferralHandler) RecordPayout(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID <= 0 {
+		response.BadRequest(c, "Invalid user ID")
+		return
+	}
+	var req ReferralPayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	payout, err := h.referralService.RecordManualPayout(c.Request.Context(), userID, req.Amount, req.Note)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, payout)
+}
+
+func parseReferralListFilters(c *gin.Context) (service.ReferralListFilters, bool) {
+	var filters service.ReferralListFilters
+	var ok bool
+	if filters.ReferrerID, ok = parseOptionalReferralID(c, "referrer_id"); !ok {
+		return filters, false
+	}
+	if filters.RefereeID, ok = parseOptionalReferralID(c, "referee_id"); !ok {
+		return filters, false
+	}
+	return filters, true
+}
+
+func parseOptionalReferralID(c *gin.Context, key string) (int64, bool) {
+	raw := c.Query(key)
+	if raw == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		response.BadRequest(c, "Invalid "+key)
+		return 0, false
+	}
+	return id, true
+}
@@ -51,10 +51,11 @@ type SettingHandler struct {
 	opsService           *service.OpsService
 	paymentConfigService *service.PaymentConfigService
 	paymentService       *service.PaymentService
+	passkeyService       *service.PasskeyService
 }
 
 // NewSettingHandler 创建系统设置处理器
-func NewSettingHandler(settingService *service.SettingService, emailService *service.EmailService, turnstileService *service.TurnstileService, opsService *service.OpsService, paymentConfigService *service.PaymentConfigService, paymentService *service.PaymentService) *SettingHandler {
+func NewSettingHandler(settingService *service.SettingService, emailService *service.EmailService, turnstileService *service.TurnstileService, opsService *service.OpsService, paymentConfigService *service.PaymentConfigService, paymentService *service.PaymentService, passkeyService *service.PasskeyService) *SettingHandler {
 	return &SettingHandler{
 		settingService:       settingService,
 		emailService:         emailService,
@@ -62,6 +63,7 @@ func NewSettingHandler(settingService *service.SettingService, emailService *ser
 		opsService:           opsService,
 		paymentConfigService: paymentConfigService,
 		paymentService:       paymentService,
+		passkeyService:       passkeyService,
 	}
 }
 
@@ -103,6 +105,9 @@ func (h *SettingHandler) GetSettings(c *gin.Context) {
 		InvitationCodeEnabled:                settings.InvitationCodeEnabled,
 		TotpEnabled:                          settings.TotpEnabled,
 		TotpEncryptionKeyConfigured:          h.settingService.IsTotpEncryptionKeyConfigured(),
+		PasskeyEnabled:                       settings.PasskeyEnabled,
+		PasskeyConfigError:                   h.passkeyService.ConfigError(),
+		RequirePasskeyForAdmins:              settings.RequirePasskeyForAdmins,
 		SMTPHost:                             settings.SMTPHost,
 		SMTPPort:                             settings.SMTPPort,
 		SMTPUsername:                         settings.SMTPUsername,
@@ -211,7 +216,8 @@ type UpdateSettingsRequest struct {
 	PasswordResetEnabled             bool     `json:"password_reset_enabled"`
 	FrontendURL                      string   `json:"frontend_url"`
 	InvitationCodeEnabled            bool     `json:"invitation_code_enabled"`
-	TotpEnabled                      bool     `json:"totp_enabled"` // TOTP 双因素认证
+	TotpEnabled                      bool     `json:"totp_enabled"`               // TOTP 双因素认证
+	RequirePasskeyForAdmins          bool     `json:"require_passkey_for_admins"` // 管理员必须使用通行密钥登录
 
 	// 邮件服务设置
 	SMTPHost     string `json:"smtp_host"`
@@ -426,6 +432,18 @@ func (h *SettingHandler) UpdateSettings(c *gin.Context) {
 		}
 	}
 
+	// 管理员强制通行密钥：开启前要求通行密钥已启用且所有活跃管理员均已注册，避免锁死管理后台
+	if req.RequirePasskeyForAdmins && !previousSettings.RequirePasskeyForAdmins {
+		if h.passkeyService == nil {
+			response.ErrorFrom(c, service.ErrPasskeyNotEnabled)
+			return
+		}
+		if err := h.passkeyService.EnsureAdminsHavePasskeys(c.Request.Context()); err != nil {
+			response.ErrorFrom(c, err)
+			return
+		}
+	}
+
 	// LinuxDo Connect 参数验证
 	if req.LinuxDoConnectEnabled {
 		req.LinuxDoConnectClientID = strings.TrimSpace(req.LinuxDoConnectClientID)
@@ -787,6 +805,7 @@ func (h *SettingHandler) UpdateSettings(c *gin.Context) {
 		FrontendURL:                      req.FrontendURL,
 		InvitationCodeEnabled:            req.InvitationCodeEnabled,
 		TotpEnabled:                      req.TotpEnabled,
+		RequirePasskeyForAdmins:          req.RequirePasskeyForAdmins,
 		SMTPHost:                         req.SMTPHost,
 		SMTPPort:                         req.SMTPPort,
 		SMTPUsername:                     req.SMTPUsername,
@@ -998,6 +1017,9 @@ func (h *SettingHandler) UpdateSettings(c *gin.Context) {
 		InvitationCodeEnabled:                updatedSettings.InvitationCodeEnabled,
 		TotpEnabled:                          updatedSettings.TotpEnabled,
 		TotpEncryptionKeyConfigured:          h.settingService.IsTotpEncryptionKeyConfigured(),
+		PasskeyEnabled:                       updatedSettings.PasskeyEnabled,
+		PasskeyConfigError:                   h.passkeyService.ConfigError(),
+		RequirePasskeyForAdmins:              updatedSettings.RequirePasskeyForAdmins,
 		SMTPHost:                             updatedSettings.SMTPHost,
 		SMTPPort:                             updatedSettings.SMTPPort,
 		SMTPUsername:                         updatedSettings.SMTPUsername,
@@ -1154,6 +1176,9 @@ func diffSettings(before *service.SystemSettings, after *service.SystemSettings,
 	if before.TotpEnabled != after.TotpEnabled {
 		changed = append(changed, "totp_enabled")
 	}
+	if before.RequirePasskeyForAdmins != after.RequirePasskeyForAdmins {
+		changed = append(changed, "require_passkey_for_admins")
+	}
 	if before.SMTPHost != after.SMTPHost {
 		changed = append(changed, "smtp_host")
 	}
@@ -2008,3 +2033,36 @@ func (h *SettingHandler) TestWebSearchEmulation(c *gin.Context) {
 	}
 	response.Success(c, result)
 }
+
+// GetFairShareSettings 获取分组内公平准入配置
+// GET /api/v1/admin/settings/fair-share
+func (h *SettingHandler) GetFairShareSettings(c *gin.Context) {
+	settings, err := h.settingService.GetFairShareSettings(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, settings)
+}
+
+// UpdateFairShareSettings 更新分组内公平准入配置（网关侧约 10 秒内生效）
+// PUT /api/v1/admin/settings/fair-share
+func (h *SettingHandler) UpdateFairShareSettings(c *gin.Context) {
+	var settings service.FairShareSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := h.settingService.SetFairShareSettings(c.Request.Context(), &settings); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	updated, err := h.settingService.GetFairShareSettings(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, updated)
+}
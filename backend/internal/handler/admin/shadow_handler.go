@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShadowHandler handles group traffic shadowing rules and comparison reports
+type ShadowHandler struct {
+	shadowService *service.ShadowService
+}
+
+// NewShadowHandler creates a new admin shadow handler
+func NewShadowHandler(shadowService *service.ShadowService) *ShadowHandler {
+	return &ShadowHandler{shadowService: shadowService}
+}
+
+// ShadowRuleRequest represents a create/update shadow rule request
+type ShadowRuleRequest struct {
+	ShadowGroupID  int64    `json:"shadow_group_id"`
+	SampleRate     float64  `json:"sample_rate" binding:"required"`
+	ModelPatterns  []string `json:"model_patterns"`
+	MaxConcurrency int      `json:"max_concurrency"`
+	Enabled        *bool    `json:"enabled"`
+}
+
+func (req *ShadowRuleRequest) toRule(groupID int64) *service.GroupShadowRule {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &service.GroupShadowRule{
+		GroupID:        groupID,
+		ShadowGroupID:  req.ShadowGroupID,
+		SampleRate:     req.SampleRate,
+		ModelPatterns:  req.ModelPatterns,
+		MaxConcurrency: req.MaxConcurrency,
+		Enabled:        enabled,
+	}
+}
+
+func parseShadowGroupAndRule(c *gin.Context, withRule bool) (int64, int64, bool) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid group ID")
+		return 0, 0, false
+	}
+	if !withRule {
+		return groupID, 0, true
+	}
+	ruleID, err := strconv.ParseInt(c.Param("rule_id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid rule ID")
+		return 0, 0, false
+	}
+	return groupID, ruleID, true
+}
+
+// List lists shadow rules of a group
+// GET /api/v1/admin/groups/:id/shadow-rules
+func (h *ShadowHandler) List(c *gin.Context) {
+	groupID, _, ok := parseShadowGroupAndRule(c, false)
+	if !ok {
+		return
+	}
+	rules, err := h.shadowService.ListRules(c.Request.Context(), groupID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, rules)
+}
+
+// Create creates a shadow rule for a group
+// POST /api/v1/admin/groups/:id/shadow-rules
+func (h *ShadowHandler) Create(c *gin.Context) {
+	groupID, _, ok := parseShadowGroupAndRule(c, false)
+	if !ok {
+		return
+	}
+	var req ShadowRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	if req.ShadowGroupID <= 0 {
+		response.BadRequest(c, "shadow_group_id is required")
+		return
+	}
+	rule, err := h.shadowService.CreateRule(c.Request.Context(), req.toRule(groupID))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, rule)
+}
+
+// Update updates a shadow rule (the shadow group itself cannot be changed)
+// PUT /api/v1/admin/groups/:id/shadow-rules/:rule_id
+func (h *ShadowHandler) Update(c *gin.Context) {
+	groupID, ruleID, ok := parseShadowGroupAndRule(c, true)
+	if !ok {
+		return
+	}
+	var req ShadowRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	rule := req.toRule(groupID)
+	rule.ID = ruleID
+	updated, err := h.shadowService.UpdateRule(c.Request.Context(), rule)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, updated)
+}
+
+// Delete deletes a shadow rule together with its comparison records
+// DELETE /api/v1/admin/groups/:id/shadow-rules/:rule_id
+func (h *ShadowHandler) Delete(c *gin.Context) {
+	groupID, ruleID, ok := parseShadowGroupAndRule(c, true)
+	if !ok {
+		return
+	}
+	if err := h.shadowService.DeleteRule(c.Request.Context(), groupID, ruleID); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"message": "Shadow rule deleted successfully"})
+}
+
+// GetReport returns the primary vs shadow comparison report
+// GET /api/v1/admin/groups/:id/shadow-rules/:rule_id/report
+// Query: start_date, end_date (YYYY-MM-DD), timezone
+func (h *ShadowHandler) GetReport(c *gin.Context) {
+	groupID, ruleID, ok := parseShadowGroupAndRule(c, true)
+	if !ok {
+		return
+	}
+	startTime, endTime := parseTimeRange(c)
+	report, err := h.shadowService.GetComparisonReport(c.Request.Context(), groupID, ruleID, startTime, endTime)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, report)
+}
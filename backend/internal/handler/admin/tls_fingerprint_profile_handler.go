@@ -232,3 +232,99 @@ func (h *TLSFingerprintProfileHandler) Delete(c *gin.Context) {
 
 	response.Success(c, gin.H{"message": "Profile deleted successfully"})
 }
+
+// Import 从 JA3/JA4 字符串或抓取的 ClientHello 导入模板（save=false 时仅预览）
+// POST /api/v1/admin/tls-fingerprint-profiles/import
+func (h *TLSFingerprintProfileHandler) Import(c *gin.Context) {
+	var req service.ImportTLSFingerprintInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.service.ImportProfile(c.Request.Context(), &req)
+	if err != nil {
+		if _, ok := err.(*model.ValidationError); ok {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// StartCapture 启动临时 TLS 监听，记录下一个连接的客户端 ClientHello
+// POST /api/v1/admin/tls-fingerprint-profiles/capture
+func (h *TLSFingerprintProfileHandler) StartCapture(c *gin.Context) {
+	var req service.StartTLSCaptureInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, "Invalid request: "+err.Error())
+			return
+		}
+	}
+
+	capture, err := h.service.StartCapture(c.Request.Context(), &req)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	response.Success(c, capture)
+}
+
+// GetCapture 查询抓取会话状态与结果
+// GET /api/v1/admin/tls-fingerprint-profiles/capture/:capture_id
+func (h *TLSFingerprintProfileHandler) GetCapture(c *gin.Context) {
+	capture, err := h.service.GetCapture(c.Request.Context(), c.Param("capture_id"))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	response.Success(c, capture)
+}
+
+// ExportFingerprint 导出模板实际生成的 JA3/JA4
+// GET /api/v1/admin/tls-fingerprint-profiles/:id/fingerprint
+func (h *TLSFingerprintProfileHandler) ExportFingerprint(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid profile ID")
+		return
+	}
+
+	fp, err := h.service.ExportFingerprint(c.Request.Context(), id, c.Query("server_name"))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	response.Success(c, fp)
+}
+
+// Diff 将模板与参考指纹（ja3 / ja4 / client_hello）逐字段比对
+// POST /api/v1/admin/tls-fingerprint-profiles/:id/diff
+func (h *TLSFingerprintProfileHandler) Diff(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid profile ID")
+		return
+	}
+
+	var req service.TLSFingerprintSource
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	result, err := h.service.DiffProfile(c.Request.Context(), id, &req)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
@@ -309,3 +309,71 @@ func (h *APIKeyHandler) GetUserGroupRates(c *gin.Context) {
 
 	response.Success(c, rates)
 }
+
+// UpdatePriorityRequest represents the update API key priority class request payload
+type UpdatePriorityRequest struct {
+	PriorityClass string `json:"priority_class" binding:"required"`
+}
+
+// GetPriority returns the priority class of an API key
+// GET /api/v1/api-keys/:id/priority
+func (h *APIKeyHandler) GetPriority(c *gin.Context) {
+	key, ok := h.ownedKey(c)
+	if !ok {
+		return
+	}
+	response.Success(c, gin.H{
+		"api_key_id":     key.ID,
+		"priority_class": h.apiKeyService.PriorityClassOf(c.Request.Context(), key.ID),
+	})
+}
+
+// UpdatePriority sets the priority class (interactive / normal / background) of an API key
+// PUT /api/v1/api-keys/:id/priority
+func (h *APIKeyHandler) UpdatePriority(c *gin.Context) {
+	var req UpdatePriorityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	key, ok := h.ownedKey(c)
+	if !ok {
+		return
+	}
+
+	class, err := h.apiKeyService.SetPriorityClass(c.Request.Context(), key.ID, req.PriorityClass)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{
+		"api_key_id":     key.ID,
+		"priority_class": class,
+	})
+}
+
+// ownedKey loads the API key in the path and verifies it belongs to the current user
+func (h *APIKeyHandler) ownedKey(c *gin.Context) (*service.APIKey, bool) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return nil, false
+	}
+
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid key ID")
+		return nil, false
+	}
+
+	key, err := h.apiKeyService.GetByID(c.Request.Context(), keyID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return nil, false
+	}
+	if key.UserID != subject.UserID {
+		response.Forbidden(c, "Not authorized to access this key")
+		return nil, false
+	}
+	return key, true
+}
@@ -0,0 +1,364 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ip"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	samlCookiePath         = "/api/v1/auth/saml"
+	samlRequestIDCookie    = "saml_request_id"
+	samlRedirectCookie     = "saml_redirect"
+	samlAffCookie          = "saml_aff"
+	samlCookieMaxAgeSec    = 10 * 60 // 10 minutes
+	samlDefaultFrontendCB  = "/auth/saml/callback"
+	samlDefaultRedirectTo  = "/dashboard"
+	ldapDefaultFrontendCB  = "/auth/ldap/callback"
+	directoryMaxFormMemory = 1 << 20
+)
+
+func directoryReferralSource(provider string) string {
+	if provider == service.DirectoryProviderSAML {
+		return service.ReferralSignupSAML
+	}
+	return service.ReferralSignupLDAP
+}
+
+// directoryPendingError 目录登录需要用户补充信息时返回回调页使用的 error 代码：
+// invitation_required（补邀请码注册）或 link_required（用本地密码关联已有账号）；其他错误返回空串。
+func directoryPendingError(err error) string {
+	switch {
+	case errors.Is(err, service.ErrOAuthInvitationRequired):
+		return "invitation_required"
+	case errors.Is(err, service.ErrDirectoryLinkRequired):
+		return "link_required"
+	}
+	return ""
+}
+
+func directoryTokenBody(tokenPair *service.TokenPair) gin.H {
+	return gin.H{
+		"access_token":  tokenPair.AccessToken,
+		"refresh_token": tokenPair.RefreshToken,
+		"expires_in":    tokenPair.ExpiresIn,
+		"token_type":    "Bearer",
+	}
+}
+
+type ldapLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	AffCode  string `json:"aff_code"`
+}
+
+// LDAPLogin 用目录账号密码登录；需要邀请码或关联已有账号时返回 invitation_required / link_required
+// 与 pending token，前端跳转到 ldap_connect.frontend_redirect_url 补全注册或关联。
+// POST /api/v1/auth/ldap/login
+func (h *AuthHandler) LDAPLogin(c *gin.Context) {
+	if h.directorySSO == nil || !h.directorySSO.LDAP().Enabled() {
+		response.ErrorFrom(c, service.ErrLDAPDisabled)
+		return
+	}
+	var req ldapLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	identity, err := h.directorySSO.LDAP().Authenticate(c.Request.Context(), req.Username, req.Password)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	affCode := service.NormalizeReferralCode(req.AffCode)
+	ctx := service.WithReferralSignup(c.Request.Context(), service.ReferralSignup{
+		Code:   affCode,
+		Source: service.ReferralSignupLDAP,
+		IP:     ip.GetClientIP(c),
+	})
+	user, err := h.directorySSO.Login(ctx, identity, "")
+	if err != nil {
+		if pending := directoryPendingError(err); pending != "" {
+			pendingToken, tokenErr := h.directorySSO.CreatePendingToken(identity)
+			if tokenErr != nil {
+				response.ErrorFrom(c, infraerrors.InternalServer("PENDING_TOKEN_FAILED", "failed to create registration token").WithCause(tokenErr))
+				return
+			}
+			response.Success(c, gin.H{
+				"error":               pending,
+				"pending_oauth_token": pendingToken,
+				"frontend_callback":   firstNonEmpty(h.cfg.LDAP.FrontendRedirectURL, ldapDefaultFrontendCB),
+			})
+			return
+		}
+		response.ErrorFrom(c, err)
+		return
+	}
+	tokenPair, challenge, err := h.completeSSOLogin(ctx, user, ip.GetClientIP(c))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	if challenge != nil {
+		response.Success(c, challenge)
+		return
+	}
+	response.Success(c, directoryTokenBody(tokenPair))
+}
+
+// SAMLMetadata 返回 SP metadata，供 IdP 导入
+// GET /api/v1/auth/saml/metadata
+func (h *AuthHandler) SAMLMetadata(c *gin.Context) {
+	if h.directorySSO == nil {
+		response.ErrorFrom(c, service.ErrSAMLDisabled)
+		return
+	}
+	body, err := h.directorySSO.SAML().Metadata(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", body)
+}
+
+// SAMLLogin 发起 SP-initiated 登录：记录请求 ID 后跳转到 IdP
+// GET /api/v1/auth/saml/login?redirect=/dashboard
+func (h *AuthHandler) SAMLLogin(c *gin.Context) {
+	if h.directorySSO == nil {
+		response.ErrorFrom(c, service.ErrSAMLDisabled)
+		return
+	}
+	redirectURL, requestID, err := h.directorySSO.SAML().StartLogin(c.Request.Context(), "")
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	redirectTo := sanitizeFrontendRedirectPath(c.Query("redirect"))
+	if redirectTo == "" {
+		redirectTo = samlDefaultRedirectTo
+	}
+	secureCookie := isRequestHTTPS(c)
+	samlSetCookie(c, samlRequestIDCookie, encodeCookieValue(requestID), samlCookieMaxAgeSec, secureCookie)
+	samlSetCookie(c, samlRedirectCookie, encodeCookieValue(redirectTo), samlCookieMaxAgeSec, secureCookie)
+	if affCode := service.NormalizeReferralCode(c.Query("aff")); affCode != "" {
+		samlSetCookie(c, samlAffCookie, encodeCookieValue(affCode), samlCookieMaxAgeSec, secureCookie)
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// SAMLACS 是 Assertion Consumer Service：校验 IdP POST 回来的签名断言，登录后带 token（或第二步验证挑战）跳回前端
+// POST /api/v1/auth/saml/acs
+func (h *AuthHandler) SAMLACS(c *gin.Context) {
+	frontendCallback := samlDefaultFrontendCB
+	if h.cfg != nil {
+		frontendCallback = firstNonEmpty(h.cfg.SAML.FrontendRedirectURL, samlDefaultFrontendCB)
+	}
+	if h.directorySSO == nil || !h.directorySSO.SAML().Enabled() {
+		redirectOAuthError(c, frontendCallback, "saml_disabled", "saml login is disabled", "")
+		return
+	}
+
+	secureCookie := isRequestHTTPS(c)
+	requestID, _ := readCookieDecoded(c, samlRequestIDCookie)
+	redirectTo, _ := readCookieDecoded(c, samlRedirectCookie)
+	affCode, _ := readCookieDecoded(c, samlAffCookie)
+	// 请求 ID 一次性使用，防止同一断言被重放
+	samlClearCookie(c, samlRequestIDCookie, secureCookie)
+	samlClearCookie(c, samlRedirectCookie, secureCookie)
+	samlClearCookie(c, samlAffCookie, secureCookie)
+
+	redirectTo = sanitizeFrontendRedirectPath(redirectTo)
+	if redirectTo == "" {
+		redirectTo = samlDefaultRedirectTo
+	}
+
+	if err := c.Request.ParseMultipartForm(directoryMaxFormMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		redirectOAuthError(c, frontendCallback, "invalid_response", "invalid saml response", "")
+		return
+	}
+	var possibleRequestIDs []string
+	if requestID != "" {
+		possibleRequestIDs = []string{requestID}
+	}
+	identity, err := h.directorySSO.SAML().ParseResponse(c.Request.Context(), c.PostForm("SAMLResponse"), possibleRequestIDs)
+	if err != nil {
+		redirectOAuthError(c, frontendCallback, "invalid_response", infraerrors.Reason(err), infraerrors.Message(err))
+		return
+	}
+
+	ctx := service.WithReferralSignup(c.Request.Context(), service.ReferralSignup{
+		Code:   affCode,
+		Source: service.ReferralSignupSAML,
+		IP:     ip.GetClientIP(c),
+	})
+	user, err := h.directorySSO.Login(ctx, identity, "")
+	if err != nil {
+		if pending := directoryPendingError(err); pending != "" {
+			pendingToken, tokenErr := h.directorySSO.CreatePendingToken(identity)
+			if tokenErr != nil {
+				redirectOAuthError(c, frontendCallback, "login_failed", "service_error", "")
+				return
+			}
+			fragment := url.Values{}
+			fragment.Set("error", pending)
+			fragment.Set("pending_oauth_token", pendingToken)
+			fragment.Set("redirect", redirectTo)
+			if affCode != "" {
+				fragment.Set("aff_code", affCode)
+			}
+			redirectWithFragment(c, frontendCallback, fragment)
+			return
+		}
+		redirectOAuthError(c, frontendCallback, "login_failed", infraerrors.Reason(err), infraerrors.Message(err))
+		return
+	}
+	tokenPair, challenge, err := h.completeSSOLogin(ctx, user, ip.GetClientIP(c))
+	if err != nil {
+		redirectOAuthError(c, frontendCallback, "login_failed", infraerrors.Reason(err), infraerrors.Message(err))
+		return
+	}
+	if challenge != nil {
+		redirectSecondFactor(c, frontendCallback, redirectTo, challenge)
+		return
+	}
+
+	fragment := url.Values{}
+	fragment.Set("access_token", tokenPair.AccessToken)
+	fragment.Set("refresh_token", tokenPair.RefreshToken)
+	fragment.Set("expires_in", fmt.Sprintf("%d", tokenPair.ExpiresIn))
+	fragment.Set("token_type", "Bearer")
+	fragment.Set("redirect", redirectTo)
+	redirectWithFragment(c, frontendCallback, fragment)
+}
+
+type completeDirectorySSORequest struct {
+	PendingOAuthToken string `json:"pending_oauth_token" binding:"required"`
+	InvitationCode    string `json:"invitation_code"     binding:"required"`
+	AffCode           string `json:"aff_code"`
+}
+
+// CompleteDirectorySSORegistration 为 LDAP/SAML 用户补全邀请码注册，并按 token 中的组同步权限
+// POST /api/v1/auth/sso/complete-registration
+func (h *AuthHandler) CompleteDirectorySSORegistration(c *gin.Context) {
+	if h.directorySSO == nil {
+		response.ErrorFrom(c, service.ErrLDAPDisabled)
+		return
+	}
+	var req completeDirectorySSORequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "INVALID_REQUEST", "message": err.Error()})
+		return
+	}
+
+	identity, err := h.authService.VerifyPendingDirectoryToken(req.PendingOAuthToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "INVALID_TOKEN", "message": "invalid or expired registration token"})
+		return
+	}
+
+	ctx := service.WithReferralSignup(c.Request.Context(), service.ReferralSignup{
+		Code:   req.AffCode,
+		Source: directoryReferralSource(identity.Provider),
+		IP:     ip.GetClientIP(c),
+	})
+	user, err := h.directorySSO.Login(ctx, identity, req.InvitationCode)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	tokenPair, challenge, err := h.completeSSOLogin(ctx, user, ip.GetClientIP(c))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	c.JSON(http.StatusOK, directoryTokenBody(tokenPair))
+}
+
+type linkDirectoryAccountRequest struct {
+	PendingOAuthToken string `json:"pending_oauth_token" binding:"required"`
+	Password          string `json:"password"            binding:"required"`
+}
+
+// LinkDirectoryAccount 用本地账号密码把 LDAP/SAML 身份关联到同邮箱的已有账号，随后按目录登录收尾
+// POST /api/v1/auth/sso/link
+func (h *AuthHandler) LinkDirectoryAccount(c *gin.Context) {
+	if h.directorySSO == nil {
+		response.ErrorFrom(c, service.ErrLDAPDisabled)
+		return
+	}
+	var req linkDirectoryAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "INVALID_REQUEST", "message": err.Error()})
+		return
+	}
+
+	identity, err := h.authService.VerifyPendingDirectoryToken(req.PendingOAuthToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "INVALID_TOKEN", "message": "invalid or expired registration token"})
+		return
+	}
+
+	user, err := h.directorySSO.LinkWithPassword(c.Request.Context(), identity, req.Password)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	tokenPair, challenge, err := h.completeSSOLogin(c.Request.Context(), user, ip.GetClientIP(c))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	c.JSON(http.StatusOK, directoryTokenBody(tokenPair))
+}
+
+// samlSameSite: ACS 是 IdP 页面跨站 POST 回来的，Lax cookie 不会被带上；
+// HTTPS 下使用 SameSite=None，HTTP（本地开发）只能退回 Lax，此时仅 allow_idp_initiated 可用。
+func samlSameSite(secure bool) http.SameSite {
+	if secure {
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+func samlSetCookie(c *gin.Context, name, value string, maxAgeSec int, secure bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     samlCookiePath,
+		MaxAge:   maxAgeSec,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: samlSameSite(secure),
+	})
+}
+
+func samlClearCookie(c *gin.Context, name string, secure bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     samlCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: samlSameSite(secure),
+	})
+}
@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net/url"
 	"strings"
 
 	"github.com/Wei-Shaw/sub2api/internal/config"
 	"github.com/Wei-Shaw/sub2api/internal/handler/dto"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/ip"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
 	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
@@ -23,10 +28,13 @@ type AuthHandler struct {
 	promoService  *service.PromoService
 	redeemService *service.RedeemService
 	totpService   *service.TotpService
+	directorySSO  *service.DirectorySSOService
+	twoFactor     *service.TwoFactorService
+	passkeys      *service.PasskeyService
 }
 
 // NewAuthHandler creates a new AuthHandler
-func NewAuthHandler(cfg *config.Config, authService *service.AuthService, userService *service.UserService, settingService *service.SettingService, promoService *service.PromoService, redeemService *service.RedeemService, totpService *service.TotpService) *AuthHandler {
+func NewAuthHandler(cfg *config.Config, authService *service.AuthService, userService *service.UserService, settingService *service.SettingService, promoService *service.PromoService, redeemService *service.RedeemService, totpService *service.TotpService, directorySSO *service.DirectorySSOService, twoFactor *service.TwoFactorService, passkeys *service.PasskeyService) *AuthHandler {
 	return &AuthHandler{
 		cfg:           cfg,
 		authService:   authService,
@@ -35,6 +43,9 @@ func NewAuthHandler(cfg *config.Config, authService *service.AuthService, userSe
 		promoService:  promoService,
 		redeemService: redeemService,
 		totpService:   totpService,
+		directorySSO:  directorySSO,
+		twoFactor:     twoFactor,
+		passkeys:      passkeys,
 	}
 }
 
@@ -46,6 +57,7 @@ type RegisterRequest struct {
 	TurnstileToken string `json:"turnstile_token"`
 	PromoCode      string `json:"promo_code"`      // 注册优惠码
 	InvitationCode string `json:"invitation_code"` // 邀请码
+	AffCode        string `json:"aff_code"`        // 推广返利码（可选）
 }
 
 // SendVerifyCodeRequest 发送验证码请求
@@ -79,6 +91,7 @@ type AuthResponse struct {
 // respondWithTokenPair 生成 Token 对并返回认证响应
 // 如果 Token 对生成失败，回退到只返回 Access Token（向后兼容）
 func (h *AuthHandler) respondWithTokenPair(c *gin.Context, user *service.User) {
+	h.authService.NotifyUserLogin(c.Request.Context(), user, ip.GetClientIP(c))
 	tokenPair, err := h.authService.GenerateTokenPair(c.Request.Context(), user, "")
 	if err != nil {
 		slog.Error("failed to generate token pair", "error", err, "user_id", user.ID)
@@ -119,7 +132,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	_, user, err := h.authService.RegisterWithVerification(c.Request.Context(), req.Email, req.Password, req.VerifyCode, req.PromoCode, req.InvitationCode)
+	ctx := service.WithReferralSignup(c.Request.Context(), service.ReferralSignup{
+		Code:   req.AffCode,
+		Source: service.ReferralSignupEmail,
+		IP:     ip.GetClientIP(c),
+	})
+	_, user, err := h.authService.RegisterWithVerification(ctx, req.Email, req.Password, req.VerifyCode, req.PromoCode, req.InvitationCode)
 	if err != nil {
 		response.ErrorFrom(c, err)
 		return
@@ -177,20 +195,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 	_ = token // token 由 authService.Login 返回但此处由 respondWithTokenPair 重新生成
 
-	// Check if TOTP 2FA is enabled for this user
-	if h.totpService != nil && h.settingSvc.IsTotpEnabled(c.Request.Context()) && user.TotpEnabled {
-		// Create a temporary login session for 2FA
-		tempToken, err := h.totpService.CreateLoginSession(c.Request.Context(), user.ID, user.Email)
-		if err != nil {
-			response.InternalError(c, "Failed to create 2FA session")
-			return
-		}
-
-		response.Success(c, TotpLoginResponse{
-			Requires2FA:     true,
-			TempToken:       tempToken,
-			UserEmailMasked: service.MaskEmail(user.Email),
-		})
+	// Check if a second factor (TOTP / passkey / recovery code) is required for this user
+	challenge, err := h.secondFactorChallenge(c.Request.Context(), user)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	if challenge != nil {
+		response.Success(c, challenge)
 		return
 	}
 
@@ -208,12 +220,68 @@ type TotpLoginResponse struct {
 	Requires2FA     bool   `json:"requires_2fa"`
 	TempToken       string `json:"temp_token,omitempty"`
 	UserEmailMasked string `json:"user_email_masked,omitempty"`
+	// Methods 可用的第二步验证方式：totp / passkey / recovery_code
+	Methods []string `json:"methods,omitempty"`
+}
+
+// secondFactorChallenge 签发 token 前检查第二步验证（TOTP / 通行密钥 / 恢复码）。
+// 密码、OAuth（LinuxDo / OIDC）与目录（LDAP / SAML）登录都必须经过该检查；
+// 需要第二步时创建临时登录会话并返回挑战，由 /auth/login/2fa 完成登录，无需时返回 nil。
+func (h *AuthHandler) secondFactorChallenge(ctx context.Context, user *service.User) (*TotpLoginResponse, error) {
+	if h.totpService == nil || h.twoFactor == nil {
+		return nil, nil
+	}
+	requirement, err := h.twoFactor.Requirement(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !requirement.Required() {
+		return nil, nil
+	}
+	tempToken, err := h.totpService.CreateLoginSession(ctx, user.ID, user.Email)
+	if err != nil {
+		return nil, infraerrors.InternalServer("LOGIN_SESSION_FAILED", "Failed to create 2FA session").WithCause(err)
+	}
+	return &TotpLoginResponse{
+		Requires2FA:     true,
+		TempToken:       tempToken,
+		UserEmailMasked: service.MaskEmail(user.Email),
+		Methods:         requirement.Methods,
+	}, nil
 }
 
-// Login2FARequest represents the 2FA login request
+// completeSSOLogin 第三方登录解析出用户后收尾：需要第二步验证时只返回挑战，否则签发 token pair
+func (h *AuthHandler) completeSSOLogin(ctx context.Context, user *service.User, clientIP string) (*service.TokenPair, *TotpLoginResponse, error) {
+	challenge, err := h.secondFactorChallenge(ctx, user)
+	if err != nil || challenge != nil {
+		return nil, challenge, err
+	}
+	h.authService.NotifyUserLogin(ctx, user, clientIP)
+	tokenPair, err := h.authService.GenerateTokenPair(ctx, user, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate token pair: %w", err)
+	}
+	return tokenPair, nil, nil
+}
+
+// redirectSecondFactor 通过 fragment 把第二步验证挑战交给前端回调页
+func redirectSecondFactor(c *gin.Context, frontendCallback, redirectTo string, challenge *TotpLoginResponse) {
+	fragment := url.Values{}
+	fragment.Set("requires_2fa", "true")
+	fragment.Set("temp_token", challenge.TempToken)
+	fragment.Set("user_email_masked", challenge.UserEmailMasked)
+	fragment.Set("methods", strings.Join(challenge.Methods, ","))
+	fragment.Set("redirect", redirectTo)
+	redirectWithFragment(c, frontendCallback, fragment)
+}
+
+// Login2FARequest represents the 2FA login request.
+// Exactly one of totp_code, recovery_code or webauthn (PublicKeyCredential JSON) is expected.
 type Login2FARequest struct {
-	TempToken string `json:"temp_token" binding:"required"`
-	TotpCode  string `json:"totp_code" binding:"required,len=6"`
+	TempToken    string          `json:"temp_token" binding:"required"`
+	TotpCode     string          `json:"totp_code" binding:"omitempty,len=6"`
+	RecoveryCode string          `json:"recovery_code" binding:"omitempty,max=32"`
+	WebAuthn     json.RawMessage `json:"webauthn"`
 }
 
 // Login2FA completes the login with 2FA verification
@@ -227,19 +295,12 @@ func (h *AuthHandler) Login2FA(c *gin.Context) {
 
 	slog.Debug("login_2fa_request",
 		"temp_token_len", len(req.TempToken),
-		"totp_code_len", len(req.TotpCode))
+		"totp_code_len", len(req.TotpCode),
+		"recovery_code", req.RecoveryCode != "",
+		"webauthn", len(req.WebAuthn) > 0)
 
-	// Get the login session
-	session, err := h.totpService.GetLoginSession(c.Request.Context(), req.TempToken)
-	if err != nil || session == nil {
-		tokenPrefix := ""
-		if len(req.TempToken) >= 8 {
-			tokenPrefix = req.TempToken[:8]
-		}
-		slog.Debug("login_2fa_session_invalid",
-			"temp_token_prefix", tokenPrefix,
-			"error", err)
-		response.BadRequest(c, "Invalid or expired 2FA session")
+	session, ok := h.loadLoginSession(c, req.TempToken)
+	if !ok {
 		return
 	}
 
@@ -247,8 +308,19 @@ func (h *AuthHandler) Login2FA(c *gin.Context) {
 		"user_id", session.UserID,
 		"email", session.Email)
 
-	// Verify the TOTP code
-	if err := h.totpService.VerifyCode(c.Request.Context(), session.UserID, req.TotpCode); err != nil {
+	// Get the user (before verification so the allowed methods can be re-evaluated)
+	user, err := h.userService.GetByID(c.Request.Context(), session.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+
+	// Verify the second factor
+	if err := h.twoFactor.Verify(c.Request.Context(), user, req.TempToken, service.TwoFactorLoginInput{
+		TotpCode:     req.TotpCode,
+		RecoveryCode: req.RecoveryCode,
+		WebAuthn:     req.WebAuthn,
+	}); err != nil {
 		slog.Debug("login_2fa_verify_failed",
 			"user_id", session.UserID,
 			"error", err)
@@ -256,22 +328,108 @@ func (h *AuthHandler) Login2FA(c *gin.Context) {
 		return
 	}
 
-	// Get the user (before session deletion so we can check backend mode)
+	// Backend mode: only admin can login (check BEFORE deleting session)
+	if h.settingSvc.IsBackendModeEnabled(c.Request.Context()) && !user.IsAdmin() {
+		response.Forbidden(c, "Backend mode is active. Only admin login is allowed.")
+		return
+	}
+
+	// Delete the login session (only after all checks pass)
+	_ = h.totpService.DeleteLoginSession(c.Request.Context(), req.TempToken)
+
+	h.respondWithTokenPair(c, user)
+}
+
+// Login2FAPasskeyRequest 请求 2FA 通行密钥 challenge
+type Login2FAPasskeyRequest struct {
+	TempToken string `json:"temp_token" binding:"required"`
+}
+
+// Login2FAPasskeyOptions returns WebAuthn assertion options for a pending 2FA login
+// POST /api/v1/auth/login/2fa/passkey/options
+func (h *AuthHandler) Login2FAPasskeyOptions(c *gin.Context) {
+	var req Login2FAPasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	session, ok := h.loadLoginSession(c, req.TempToken)
+	if !ok {
+		return
+	}
 	user, err := h.userService.GetByID(c.Request.Context(), session.UserID)
 	if err != nil {
 		response.ErrorFrom(c, err)
 		return
 	}
+	options, err := h.twoFactor.BeginPasskeyChallenge(c.Request.Context(), user, req.TempToken)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, options)
+}
 
-	// Backend mode: only admin can login (check BEFORE deleting session)
+// loadLoginSession 读取密码登录后创建的 2FA 临时会话；失败时已写入响应
+func (h *AuthHandler) loadLoginSession(c *gin.Context, tempToken string) (*service.TotpLoginSession, bool) {
+	session, err := h.totpService.GetLoginSession(c.Request.Context(), tempToken)
+	if err != nil || session == nil {
+		tokenPrefix := ""
+		if len(tempToken) >= 8 {
+			tokenPrefix = tempToken[:8]
+		}
+		slog.Debug("login_2fa_session_invalid",
+			"temp_token_prefix", tokenPrefix,
+			"error", err)
+		response.BadRequest(c, "Invalid or expired 2FA session")
+		return nil, false
+	}
+	return session, true
+}
+
+// PasskeyLoginOptions starts a passwordless (discoverable credential) login
+// POST /api/v1/auth/passkey/login/options
+func (h *AuthHandler) PasskeyLoginOptions(c *gin.Context) {
+	options, err := h.passkeys.BeginLogin(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, options)
+}
+
+// PasskeyLoginRequest 无密码登录断言
+type PasskeyLoginRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// PasskeyLogin completes a passwordless login. A user-verified passkey satisfies both factors.
+// POST /api/v1/auth/passkey/login
+func (h *AuthHandler) PasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	user, err := h.passkeys.FinishLogin(c.Request.Context(), req.SessionID, req.Credential)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	if !user.IsActive() {
+		response.ErrorFrom(c, service.ErrUserNotActive)
+		return
+	}
+
+	// Backend mode: only admin can login
 	if h.settingSvc.IsBackendModeEnabled(c.Request.Context()) && !user.IsAdmin() {
 		response.Forbidden(c, "Backend mode is active. Only admin login is allowed.")
 		return
 	}
 
-	// Delete the login session (only after all checks pass)
-	_ = h.totpService.DeleteLoginSession(c.Request.Context(), req.TempToken)
-
 	h.respondWithTokenPair(c, user)
 }
 
@@ -21,6 +21,7 @@ import (
 
 	"github.com/Wei-Shaw/sub2api/internal/config"
 	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ip"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/oauth"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
 	"github.com/Wei-Shaw/sub2api/internal/service"
@@ -37,6 +38,7 @@ const (
 	oidcOAuthVerifierCookie    = "oidc_oauth_verifier"
 	oidcOAuthRedirectCookie    = "oidc_oauth_redirect"
 	oidcOAuthNonceCookie       = "oidc_oauth_nonce"
+	oidcOAuthAffCookie         = "oidc_oauth_aff"
 	oidcOAuthCookieMaxAgeSec   = 10 * 60 // 10 minutes
 	oidcOAuthDefaultRedirectTo = "/dashboard"
 	oidcOAuthDefaultFrontendCB = "/auth/oidc/callback"
@@ -130,6 +132,9 @@ func (h *AuthHandler) OIDCOAuthStart(c *gin.Context) {
 	secureCookie := isRequestHTTPS(c)
 	oidcSetCookie(c, oidcOAuthStateCookieName, encodeCookieValue(state), oidcOAuthCookieMaxAgeSec, secureCookie)
 	oidcSetCookie(c, oidcOAuthRedirectCookie, encodeCookieValue(redirectTo), oidcOAuthCookieMaxAgeSec, secureCookie)
+	if affCode := service.NormalizeReferralCode(c.Query("aff")); affCode != "" {
+		oidcSetCookie(c, oidcOAuthAffCookie, encodeCookieValue(affCode), oidcOAuthCookieMaxAgeSec, secureCookie)
+	}
 
 	codeChallenge := ""
 	if cfg.UsePKCE {
@@ -199,6 +204,7 @@ func (h *AuthHandler) OIDCOAuthCallback(c *gin.Context) {
 		oidcClearCookie(c, oidcOAuthVerifierCookie, secureCookie)
 		oidcClearCookie(c, oidcOAuthRedirectCookie, secureCookie)
 		oidcClearCookie(c, oidcOAuthNonceCookie, secureCookie)
+		oidcClearCookie(c, oidcOAuthAffCookie, secureCookie)
 	}()
 
 	expectedState, err := readCookieDecoded(c, oidcOAuthStateCookieName)
@@ -314,8 +320,16 @@ func (h *AuthHandler) OIDCOAuthCallback(c *gin.Context) {
 		oidcFallbackUsername(subject),
 	)
 
+	// 推广返利码仅在首次注册时生效，已有账号登录时服务层会忽略。
+	affCode, _ := readCookieDecoded(c, oidcOAuthAffCookie)
+	ctx := service.WithReferralSignup(c.Request.Context(), service.ReferralSignup{
+		Code:   affCode,
+		Source: service.ReferralSignupOIDC,
+		IP:     ip.GetClientIP(c),
+	})
+
 	// 传入空邀请码；如果需要邀请码，服务层返回 ErrOAuthInvitationRequired
-	tokenPair, _, err := h.authService.LoginOrRegisterOAuthWithTokenPair(c.Request.Context(), email, username, "")
+	user, err := h.authService.LoginOrRegisterOAuthUser(ctx, email, username, "")
 	if err != nil {
 		if errors.Is(err, service.ErrOAuthInvitationRequired) {
 			pendingToken, tokenErr := h.authService.CreatePendingOAuthToken(email, username)
@@ -327,12 +341,24 @@ func (h *AuthHandler) OIDCOAuthCallback(c *gin.Context) {
 			fragment.Set("error", "invitation_required")
 			fragment.Set("pending_oauth_token", pendingToken)
 			fragment.Set("redirect", redirectTo)
+			if affCode != "" {
+				fragment.Set("aff_code", affCode)
+			}
 			redirectWithFragment(c, frontendCallback, fragment)
 			return
 		}
 		redirectOAuthError(c, frontendCallback, "login_failed", infraerrors.Reason(err), infraerrors.Message(err))
 		return
 	}
+	tokenPair, challenge, err := h.completeSSOLogin(ctx, user, ip.GetClientIP(c))
+	if err != nil {
+		redirectOAuthError(c, frontendCallback, "login_failed", infraerrors.Reason(err), infraerrors.Message(err))
+		return
+	}
+	if challenge != nil {
+		redirectSecondFactor(c, frontendCallback, redirectTo, challenge)
+		return
+	}
 
 	fragment := url.Values{}
 	fragment.Set("access_token", tokenPair.AccessToken)
@@ -346,6 +372,7 @@ func (h *AuthHandler) OIDCOAuthCallback(c *gin.Context) {
 type completeOIDCOAuthRequest struct {
 	PendingOAuthToken string `json:"pending_oauth_token" binding:"required"`
 	InvitationCode    string `json:"invitation_code"     binding:"required"`
+	AffCode           string `json:"aff_code"`
 }
 
 // CompleteOIDCOAuthRegistration completes a pending OAuth registration by validating
@@ -364,11 +391,25 @@ func (h *AuthHandler) CompleteOIDCOAuthRegistration(c *gin.Context) {
 		return
 	}
 
-	tokenPair, _, err := h.authService.LoginOrRegisterOAuthWithTokenPair(c.Request.Context(), email, username, req.InvitationCode)
+	ctx := service.WithReferralSignup(c.Request.Context(), service.ReferralSignup{
+		Code:   req.AffCode,
+		Source: service.ReferralSignupOIDC,
+		IP:     ip.GetClientIP(c),
+	})
+	user, err := h.authService.LoginOrRegisterOAuthUser(ctx, email, username, req.InvitationCode)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	tokenPair, challenge, err := h.completeSSOLogin(ctx, user, ip.GetClientIP(c))
 	if err != nil {
 		response.ErrorFrom(c, err)
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  tokenPair.AccessToken,
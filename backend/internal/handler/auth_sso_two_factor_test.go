@@ -0,0 +1,627 @@
+//go:build unit
+
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// 第三方登录（OAuth / LDAP / SAML）必须与密码登录一样经过第二步验证：
+// 启用了 TOTP 的账号只能拿到临时登录会话，不能直接拿到 token。
+
+type ssoTestUserRepo struct {
+	service.UserRepository
+	user *service.User
+}
+
+func (r *ssoTestUserRepo) GetByEmail(_ context.Context, _ string) (*service.User, error) {
+	u := *r.user
+	return &u, nil
+}
+
+func (r *ssoTestUserRepo) GetByID(_ context.Context, _ int64) (*service.User, error) {
+	u := *r.user
+	return &u, nil
+}
+
+type ssoTestLinkRepo struct {
+	links map[string]int64
+}
+
+func (r *ssoTestLinkRepo) GetUserID(_ context.Context, provider, subject string) (int64, error) {
+	if id, ok := r.links[provider+"|"+subject]; ok {
+		return id, nil
+	}
+	return 0, service.ErrUserNotFound
+}
+
+func (r *ssoTestLinkRepo) Link(_ context.Context, provider, subject string, userID int64) error {
+	r.links[provider+"|"+subject] = userID
+	return nil
+}
+
+type ssoTestSettingRepo struct {
+	service.SettingRepository
+	values map[string]string
+}
+
+func (r *ssoTestSettingRepo) GetValue(_ context.Context, key string) (string, error) {
+	if v, ok := r.values[key]; ok {
+		return v, nil
+	}
+	return "", service.ErrSettingNotFound
+}
+
+type ssoTestTotpCache struct {
+	service.TotpCache
+	sessions map[string]*service.TotpLoginSession
+}
+
+func (c *ssoTestTotpCache) SetLoginSession(_ context.Context, tempToken string, session *service.TotpLoginSession, _ time.Duration) error {
+	c.sessions[tempToken] = session
+	return nil
+}
+
+type ssoTestRecoveryRepo struct {
+	service.RecoveryCodeRepository
+}
+
+func (r *ssoTestRecoveryRepo) CountRemaining(_ context.Context, _ int64) (int, error) {
+	return 0, nil
+}
+
+type ssoTestRefreshCache struct {
+	service.RefreshTokenCache
+}
+
+func (c *ssoTestRefreshCache) StoreRefreshToken(_ context.Context, _ string, _ *service.RefreshTokenData, _ time.Duration) error {
+	return nil
+}
+
+func (c *ssoTestRefreshCache) AddToUserTokenSet(_ context.Context, _ int64, _ string, _ time.Duration) error {
+	return nil
+}
+
+func (c *ssoTestRefreshCache) AddToFamilyTokenSet(_ context.Context, _ string, _ string, _ time.Duration) error {
+	return nil
+}
+
+type ssoTestEnv struct {
+	handler     *AuthHandler
+	authService *service.AuthService
+	totpCache   *ssoTestTotpCache
+	links       *ssoTestLinkRepo
+	user        *service.User
+}
+
+func newSSOTestEnv(t *testing.T, cfg *config.Config, user *service.User) *ssoTestEnv {
+	t.Helper()
+	cfg.JWT.Secret = "sso-two-factor-test-secret"
+	cfg.JWT.AccessTokenExpireMinutes = 60
+	cfg.JWT.RefreshTokenExpireDays = 7
+
+	userRepo := &ssoTestUserRepo{user: user}
+	settingService := service.NewSettingService(&ssoTestSettingRepo{values: map[string]string{
+		service.SettingKeyTotpEnabled: "true",
+	}}, cfg)
+	totpCache := &ssoTestTotpCache{sessions: map[string]*service.TotpLoginSession{}}
+	totpService := service.NewTotpService(userRepo, nil, totpCache, settingService, nil, nil)
+	recovery := service.NewRecoveryCodeService(&ssoTestRecoveryRepo{}, totpService)
+	twoFactor := service.NewTwoFactorService(settingService, totpService, &service.PasskeyService{}, recovery)
+	authService := service.NewAuthService(nil, userRepo, nil, &ssoTestRefreshCache{}, cfg, nil, nil, nil, nil, nil, nil)
+	// 目录身份默认已关联到 fixture 账号；未关联的同邮箱账号需要先走 /auth/sso/link
+	links := &ssoTestLinkRepo{links: map[string]int64{
+		service.DirectoryProviderLDAP + "|CN=Alice,OU=Staff,DC=corp,DC=example": user.ID,
+		service.DirectoryProviderSAML + "|alice@corp.example":                   user.ID,
+	}}
+	directorySSO := service.NewDirectorySSOService(
+		authService,
+		userRepo,
+		links,
+		service.NewLDAPAuthService(cfg),
+		service.NewSAMLService(cfg),
+		service.NewDirectoryGroupSyncService(userRepo, nil, nil),
+	)
+	return &ssoTestEnv{
+		handler:     NewAuthHandler(cfg, authService, nil, nil, nil, nil, totpService, directorySSO, twoFactor, nil),
+		authService: authService,
+		totpCache:   totpCache,
+		links:       links,
+		user:        user,
+	}
+}
+
+func ssoTestUser(role string, totpEnabled bool) *service.User {
+	return &service.User{
+		ID:          7,
+		Email:       "alice@corp.example",
+		Username:    "alice",
+		Role:        role,
+		Status:      service.StatusActive,
+		TotpEnabled: totpEnabled,
+	}
+}
+
+func (e *ssoTestEnv) serve(req *http.Request, handle func(*gin.Context)) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+	handle(c)
+	c.Writer.WriteHeaderNow()
+	return rec
+}
+
+func (e *ssoTestEnv) requireSession(t *testing.T, tempToken string) {
+	t.Helper()
+	require.NotEmpty(t, tempToken)
+	session, ok := e.totpCache.sessions[tempToken]
+	require.True(t, ok, "temp token must reference a pending 2fa login session")
+	require.Equal(t, e.user.ID, session.UserID)
+}
+
+// requireChallengeBody 校验 JSON 响应只包含第二步验证挑战；wrapped 表示经过 response.Success 包装
+func (e *ssoTestEnv) requireChallengeBody(t *testing.T, rec *httptest.ResponseRecorder, wrapped bool) {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	if wrapped {
+		data, ok := body["data"].(map[string]any)
+		require.True(t, ok, rec.Body.String())
+		body = data
+	}
+	require.NotContains(t, body, "access_token")
+	require.NotContains(t, body, "refresh_token")
+	require.Equal(t, true, body["requires_2fa"])
+	require.Equal(t, []any{service.TwoFactorMethodTotp}, body["methods"])
+	tempToken, _ := body["temp_token"].(string)
+	e.requireSession(t, tempToken)
+}
+
+// requireChallengeRedirect 校验回调跳转的 fragment 只包含第二步验证挑战
+func (e *ssoTestEnv) requireChallengeRedirect(t *testing.T, rec *httptest.ResponseRecorder, redirectTo string) {
+	t.Helper()
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	fragment, err := url.ParseQuery(location.Fragment)
+	require.NoError(t, err)
+	require.Empty(t, fragment.Get("error"), location.Fragment)
+	require.Empty(t, fragment.Get("access_token"))
+	require.Empty(t, fragment.Get("refresh_token"))
+	require.Equal(t, "true", fragment.Get("requires_2fa"))
+	require.Equal(t, service.TwoFactorMethodTotp, fragment.Get("methods"))
+	require.Equal(t, service.MaskEmail(e.user.Email), fragment.Get("user_email_masked"))
+	require.Equal(t, redirectTo, fragment.Get("redirect"))
+	e.requireSession(t, fragment.Get("temp_token"))
+}
+
+func jsonRequest(t *testing.T, path string, body any) *http.Request {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(raw)))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// ---------------------------------------------------------------------------
+// LDAP
+// ---------------------------------------------------------------------------
+
+// ssoTestLDAPServer 是只实现 Bind / Search / Unbind 的最小 LDAPv3 服务端
+type ssoTestLDAPServer struct {
+	ln       net.Listener
+	userDN   string
+	password string
+}
+
+func startSSOTestLDAPServer(t *testing.T) *ssoTestLDAPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &ssoTestLDAPServer{ln: ln, userDN: "CN=Alice,OU=Staff,DC=corp,DC=example", password: "alice-pass"}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+	return srv
+}
+
+func (s *ssoTestLDAPServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name, _ := op.Children[1].Value.(string)
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if name == "" || (strings.EqualFold(name, s.userDN) && op.Children[2].Data.String() == s.password) {
+				code = ldap.LDAPResultSuccess
+			}
+			_, _ = conn.Write(ssoTestLDAPResult(msgID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			_, _ = conn.Write(ssoTestLDAPEntry(msgID, s.userDN, map[string]string{
+				"mail":        "alice@corp.example",
+				"displayName": "Alice",
+			}).Bytes())
+			_, _ = conn.Write(ssoTestLDAPResult(msgID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func ssoTestLDAPEnvelope(msgID int64, op *ber.Packet) *ber.Packet {
+	env := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	env.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	env.AppendChild(op)
+	return env
+}
+
+func ssoTestLDAPResult(msgID int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return ssoTestLDAPEnvelope(msgID, op)
+}
+
+func ssoTestLDAPEntry(msgID int64, dn string, values map[string]string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, value := range values {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return ssoTestLDAPEnvelope(msgID, op)
+}
+
+func ldapTestConfig(srv *ssoTestLDAPServer) *config.Config {
+	return &config.Config{LDAP: config.LDAPConnectConfig{
+		Enabled:           true,
+		URL:               "ldap://" + srv.ln.Addr().String(),
+		BaseDN:            "DC=corp,DC=example",
+		UserFilter:        "(sAMAccountName={username})",
+		EmailAttribute:    "mail",
+		UsernameAttribute: "displayName",
+		TimeoutSeconds:    5,
+	}}
+}
+
+func TestLDAPLogin_RequiresSecondFactor(t *testing.T) {
+	env := newSSOTestEnv(t, ldapTestConfig(startSSOTestLDAPServer(t)), ssoTestUser(service.RoleUser, true))
+
+	rec := env.serve(jsonRequest(t, "/api/v1/auth/ldap/login", gin.H{
+		"username": "alice",
+		"password": "alice-pass",
+	}), env.handler.LDAPLogin)
+
+	env.requireChallengeBody(t, rec, true)
+}
+
+func TestLDAPLogin_IssuesTokensWithoutSecondFactor(t *testing.T) {
+	env := newSSOTestEnv(t, ldapTestConfig(startSSOTestLDAPServer(t)), ssoTestUser(service.RoleUser, false))
+
+	rec := env.serve(jsonRequest(t, "/api/v1/auth/ldap/login", gin.H{
+		"username": "alice",
+		"password": "alice-pass",
+	}), env.handler.LDAPLogin)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.NotEmpty(t, body.Data["access_token"])
+	require.NotContains(t, body.Data, "requires_2fa")
+	require.Empty(t, env.totpCache.sessions)
+}
+
+// ---------------------------------------------------------------------------
+// SAML
+// ---------------------------------------------------------------------------
+
+type ssoTestSAMLSPProvider struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p *ssoTestSAMLSPProvider) GetServiceProvider(_ *http.Request, _ string) (*saml.EntityDescriptor, error) {
+	return p.metadata, nil
+}
+
+func newSSOTestSAMLIdP(t *testing.T) *saml.IdentityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "idp.corp.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	metadataURL, _ := url.Parse("https://idp.corp.example/metadata")
+	ssoURL, _ := url.Parse("https://idp.corp.example/sso")
+	return &saml.IdentityProvider{Key: key, Certificate: cert, MetadataURL: *metadataURL, SSOURL: *ssoURL}
+}
+
+func TestSAMLACS_RequiresSecondFactor(t *testing.T) {
+	idp := newSSOTestSAMLIdP(t)
+	idpMetadata, err := xml.Marshal(idp.Metadata())
+	require.NoError(t, err)
+	metadataFile := filepath.Join(t.TempDir(), "idp.xml")
+	require.NoError(t, os.WriteFile(metadataFile, idpMetadata, 0o600))
+
+	env := newSSOTestEnv(t, &config.Config{SAML: config.SAMLConnectConfig{
+		Enabled:         true,
+		RootURL:         "https://sub2api.example.com",
+		IDPMetadataFile: metadataFile,
+	}}, ssoTestUser(service.RoleUser, true))
+	sp := env.handler.directorySSO.SAML()
+
+	redirectURL, requestID, err := sp.StartLogin(context.Background(), "")
+	require.NoError(t, err)
+	spMetadata, err := sp.Metadata(context.Background())
+	require.NoError(t, err)
+	var entity saml.EntityDescriptor
+	require.NoError(t, xml.Unmarshal(spMetadata, &entity))
+	idp.ServiceProviderProvider = &ssoTestSAMLSPProvider{metadata: &entity}
+
+	authnHTTPReq, err := http.NewRequest(http.MethodGet, redirectURL, nil)
+	require.NoError(t, err)
+	authnReq, err := saml.NewIdpAuthnRequest(idp, authnHTTPReq)
+	require.NoError(t, err)
+	require.NoError(t, authnReq.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(authnReq, &saml.Session{
+		ID:        "session-1",
+		NameID:    "alice@corp.example",
+		UserEmail: "alice@corp.example",
+		UserName:  "alice",
+	}))
+	require.NoError(t, authnReq.MakeAssertionEl())
+	form, err := authnReq.PostBinding()
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/saml/acs", strings.NewReader(url.Values{"SAMLResponse": {form.SAMLResponse}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: samlRequestIDCookie, Value: encodeCookieValue(requestID)})
+	req.AddCookie(&http.Cookie{Name: samlRedirectCookie, Value: encodeCookieValue("/keys")})
+	rec := env.serve(req, env.handler.SAMLACS)
+
+	env.requireChallengeRedirect(t, rec, "/keys")
+}
+
+func TestCompleteDirectorySSORegistration_RequiresSecondFactor(t *testing.T) {
+	env := newSSOTestEnv(t, &config.Config{}, ssoTestUser(service.RoleUser, true))
+	pendingToken, err := env.authService.CreatePendingDirectoryToken(&service.DirectoryIdentity{
+		Provider: service.DirectoryProviderLDAP,
+		Subject:  "CN=Alice,OU=Staff,DC=corp,DC=example",
+		Email:    "alice@corp.example",
+		Username: "Alice",
+	})
+	require.NoError(t, err)
+
+	rec := env.serve(jsonRequest(t, "/api/v1/auth/sso/complete-registration", gin.H{
+		"pending_oauth_token": pendingToken,
+		"invitation_code":     "INVITE",
+	}), env.handler.CompleteDirectorySSORegistration)
+
+	env.requireChallengeBody(t, rec, false)
+}
+
+func TestLDAPLogin_UnlinkedExistingAccountRequiresLink(t *testing.T) {
+	env := newSSOTestEnv(t, ldapTestConfig(startSSOTestLDAPServer(t)), ssoTestUser(service.RoleUser, false))
+	delete(env.links.links, service.DirectoryProviderLDAP+"|CN=Alice,OU=Staff,DC=corp,DC=example")
+
+	rec := env.serve(jsonRequest(t, "/api/v1/auth/ldap/login", gin.H{
+		"username": "alice",
+		"password": "alice-pass",
+	}), env.handler.LDAPLogin)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "link_required", body.Data["error"])
+	require.NotEmpty(t, body.Data["pending_oauth_token"])
+	require.NotContains(t, body.Data, "access_token")
+	require.Empty(t, env.links.links[service.DirectoryProviderLDAP+"|CN=Alice,OU=Staff,DC=corp,DC=example"])
+}
+
+func TestLinkDirectoryAccount_RequiresSecondFactor(t *testing.T) {
+	user := ssoTestUser(service.RoleUser, true)
+	env := newSSOTestEnv(t, &config.Config{}, user)
+	delete(env.links.links, service.DirectoryProviderLDAP+"|CN=Alice,OU=Staff,DC=corp,DC=example")
+	hash, err := env.authService.HashPassword("local-pass")
+	require.NoError(t, err)
+	user.PasswordHash = hash
+	pendingToken, err := env.authService.CreatePendingDirectoryToken(&service.DirectoryIdentity{
+		Provider: service.DirectoryProviderLDAP,
+		Subject:  "CN=Alice,OU=Staff,DC=corp,DC=example",
+		Email:    "alice@corp.example",
+		Username: "Alice",
+	})
+	require.NoError(t, err)
+
+	rec := env.serve(jsonRequest(t, "/api/v1/auth/sso/link", gin.H{
+		"pending_oauth_token": pendingToken,
+		"password":            "local-pass",
+	}), env.handler.LinkDirectoryAccount)
+
+	env.requireChallengeBody(t, rec, false)
+	require.Equal(t, user.ID, env.links.links[service.DirectoryProviderLDAP+"|CN=Alice,OU=Staff,DC=corp,DC=example"])
+}
+
+// ---------------------------------------------------------------------------
+// OIDC / LinuxDo
+// ---------------------------------------------------------------------------
+
+func startSSOTestOIDCProvider(t *testing.T) *httptest.Server {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcJWKSet{Keys: []oidcJWK{buildRSAJWK("kid-1", &priv.PublicKey)}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, _ *http.Request) {
+		now := time.Now()
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, oidcIDTokenClaims{
+			Email: "alice@corp.example",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    srv.URL,
+				Subject:   "subject-1",
+				Audience:  jwt.ClaimStrings{"client-1"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+			},
+		})
+		tok.Header["kid"] = "kid-1"
+		signed, err := tok.SignedString(priv)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(gin.H{"access_token": "at-1", "token_type": "Bearer", "id_token": signed})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(gin.H{"id": 42, "sub": "subject-1", "email": "alice@corp.example", "username": "alice"})
+	})
+	return srv
+}
+
+func oauthCallbackRequest(path, stateCookie, redirectCookie string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path+"?code=code-1&state=state-1", nil)
+	req.AddCookie(&http.Cookie{Name: stateCookie, Value: encodeCookieValue("state-1")})
+	req.AddCookie(&http.Cookie{Name: redirectCookie, Value: encodeCookieValue("/keys")})
+	return req
+}
+
+func oidcTestConfig(provider *httptest.Server) *config.Config {
+	return &config.Config{OIDC: config.OIDCConnectConfig{
+		Enabled:             true,
+		ClientID:            "client-1",
+		ClientSecret:        "secret-1",
+		IssuerURL:           provider.URL,
+		AuthorizeURL:        provider.URL + "/authorize",
+		TokenURL:            provider.URL + "/token",
+		UserInfoURL:         provider.URL + "/userinfo",
+		JWKSURL:             provider.URL + "/jwks",
+		AllowedSigningAlgs:  "RS256",
+		RedirectURL:         "https://sub2api.example.com/api/v1/auth/oauth/oidc/callback",
+		FrontendRedirectURL: oidcOAuthDefaultFrontendCB,
+	}}
+}
+
+func linuxDoTestConfig(provider *httptest.Server) *config.Config {
+	return &config.Config{LinuxDo: config.LinuxDoConnectConfig{
+		Enabled:             true,
+		ClientID:            "client-1",
+		ClientSecret:        "secret-1",
+		AuthorizeURL:        provider.URL + "/authorize",
+		TokenURL:            provider.URL + "/token",
+		UserInfoURL:         provider.URL + "/userinfo",
+		RedirectURL:         "https://sub2api.example.com/api/v1/auth/oauth/linuxdo/callback",
+		FrontendRedirectURL: linuxDoOAuthDefaultFrontendCB,
+	}}
+}
+
+func TestOIDCOAuthCallback_RequiresSecondFactor(t *testing.T) {
+	env := newSSOTestEnv(t, oidcTestConfig(startSSOTestOIDCProvider(t)), ssoTestUser(service.RoleAdmin, true))
+
+	rec := env.serve(
+		oauthCallbackRequest("/api/v1/auth/oauth/oidc/callback", oidcOAuthStateCookieName, oidcOAuthRedirectCookie),
+		env.handler.OIDCOAuthCallback,
+	)
+
+	env.requireChallengeRedirect(t, rec, "/keys")
+}
+
+func TestCompleteOIDCOAuthRegistration_RequiresSecondFactor(t *testing.T) {
+	env := newSSOTestEnv(t, &config.Config{}, ssoTestUser(service.RoleAdmin, true))
+	pendingToken, err := env.authService.CreatePendingOAuthToken("alice@corp.example", "alice")
+	require.NoError(t, err)
+
+	rec := env.serve(jsonRequest(t, "/api/v1/auth/oauth/oidc/complete-registration", gin.H{
+		"pending_oauth_token": pendingToken,
+		"invitation_code":     "INVITE",
+	}), env.handler.CompleteOIDCOAuthRegistration)
+
+	env.requireChallengeBody(t, rec, false)
+}
+
+func TestLinuxDoOAuthCallback_RequiresSecondFactor(t *testing.T) {
+	env := newSSOTestEnv(t, linuxDoTestConfig(startSSOTestOIDCProvider(t)), ssoTestUser(service.RoleAdmin, true))
+
+	rec := env.serve(
+		oauthCallbackRequest("/api/v1/auth/oauth/linuxdo/callback", linuxDoOAuthStateCookieName, linuxDoOAuthRedirectCookie),
+		env.handler.LinuxDoOAuthCallback,
+	)
+
+	env.requireChallengeRedirect(t, rec, "/keys")
+}
+
+func TestCompleteLinuxDoOAuthRegistration_RequiresSecondFactor(t *testing.T) {
+	env := newSSOTestEnv(t, &config.Config{}, ssoTestUser(service.RoleAdmin, true))
+	pendingToken, err := env.authService.CreatePendingOAuthToken("linuxdo-42"+service.LinuxDoConnectSyntheticEmailDomain, "alice")
+	require.NoError(t, err)
+
+	rec := env.serve(jsonRequest(t, "/api/v1/auth/oauth/linuxdo/complete-registration", gin.H{
+		"pending_oauth_token": pendingToken,
+		"invitation_code":     "INVITE",
+	}), env.handler.CompleteLinuxDoOAuthRegistration)
+
+	env.requireChallengeBody(t, rec, false)
+}
@@ -33,6 +33,9 @@ type SystemSettings struct {
 	InvitationCodeEnabled            bool     `json:"invitation_code_enabled"`
 	TotpEnabled                      bool     `json:"totp_enabled"`                   // TOTP 双因素认证
 	TotpEncryptionKeyConfigured      bool     `json:"totp_encryption_key_configured"` // TOTP 加密密钥是否已配置
+	PasskeyEnabled                   bool     `json:"passkey_enabled"`                // 通行密钥（config.webauthn.enabled，只读）
+	PasskeyConfigError               string   `json:"passkey_config_error,omitempty"` // WebAuthn 配置无效的原因（只读）
+	RequirePasskeyForAdmins          bool     `json:"require_passkey_for_admins"`     // 管理员必须使用通行密钥登录
 
 	SMTPHost               string `json:"smtp_host"`
 	SMTPPort               int    `json:"smtp_port"`
@@ -189,6 +192,11 @@ type PublicSettings struct {
 	LinuxDoOAuthEnabled              bool             `json:"linuxdo_oauth_enabled"`
 	OIDCOAuthEnabled                 bool             `json:"oidc_oauth_enabled"`
 	OIDCOAuthProviderName            string           `json:"oidc_oauth_provider_name"`
+	LDAPLoginEnabled                 bool             `json:"ldap_login_enabled"`
+	LDAPProviderName                 string           `json:"ldap_provider_name"`
+	SAMLLoginEnabled                 bool             `json:"saml_login_enabled"`
+	SAMLProviderName                 string           `json:"saml_provider_name"`
+	PasskeyLoginEnabled              bool             `json:"passkey_login_enabled"`
 	SoraClientEnabled                bool             `json:"sora_client_enabled"`
 	BackendModeEnabled               bool             `json:"backend_mode_enabled"`
 	PaymentEnabled                   bool             `json:"payment_enabled"`
@@ -393,6 +393,10 @@ type UsageLog struct {
 	ImageSize  *string `json:"image_size"`
 	MediaType  *string `json:"media_type"`
 
+	// Realtime 音频 token（input_tokens / output_tokens 的子集）
+	AudioInputTokens  int `json:"audio_input_tokens,omitempty"`
+	AudioOutputTokens int `json:"audio_output_tokens,omitempty"`
+
 	// User-Agent
 	UserAgent *string `json:"user_agent"`
 
@@ -401,6 +405,8 @@ type UsageLog struct {
 
 	// BillingMode 计费模式：token/image
 	BillingMode *string `json:"billing_mode,omitempty"`
+	// ContextAction 上下文超长时分组策略执行的动作：truncate/route
+	ContextAction *string `json:"context_action,omitempty"`
 
 	CreatedAt time.Time `json:"created_at"`
 
@@ -18,6 +18,7 @@ const (
 	EndpointMessages        = "/v1/messages"
 	EndpointChatCompletions = "/v1/chat/completions"
 	EndpointResponses       = "/v1/responses"
+	EndpointRealtime        = "/v1/realtime"
 	EndpointGeminiModels    = "/v1beta/models"
 )
 
@@ -37,6 +38,7 @@ const (
 //	"/v1/chat/completions"       → "/v1/chat/completions"
 //	"/openai/v1/responses/foo"   → "/v1/responses"
 //	"/v1beta/models/gemini:gen"  → "/v1beta/models"
+//	"/realtime"                  → "/v1/realtime"
 func NormalizeInboundEndpoint(path string) string {
 	path = strings.TrimSpace(path)
 	switch {
@@ -48,6 +50,8 @@ func NormalizeInboundEndpoint(path string) string {
 		return EndpointResponses
 	case strings.Contains(path, EndpointGeminiModels):
 		return EndpointGeminiModels
+	case strings.HasSuffix(path, "/realtime"):
+		return EndpointRealtime
 	default:
 		return path
 	}
@@ -58,7 +62,8 @@ func NormalizeInboundEndpoint(path string) string {
 //
 // Platform-specific rules:
 //   - OpenAI always forwards to /v1/responses (with optional subpath
-//     such as /v1/responses/compact preserved from the raw URL).
+//     such as /v1/responses/compact preserved from the raw URL),
+//     except Realtime sessions which stay on /v1/realtime.
 //   - Anthropic  → /v1/messages
 //   - Gemini     → /v1beta/models
 //   - Antigravity → /v1/messages (Claude) or gemini (Gemini)
@@ -69,6 +74,9 @@ func DeriveUpstreamEndpoint(inbound, rawRequestPath, platform string) string {
 
 	switch platform {
 	case service.PlatformOpenAI:
+		if inbound == EndpointRealtime {
+			return EndpointRealtime
+		}
 		// OpenAI forwards everything to the Responses API.
 		// Preserve subresource suffix (e.g. /v1/responses/compact).
 		if suffix := responsesSubpathSuffix(rawRequestPath); suffix != "" {
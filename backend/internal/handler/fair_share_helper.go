@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FairShareHelper 分组内公平准入 Handler 层辅助
+// 在用户并发槽位之后、账号选择之前排队，流式请求等待期间发送 SSE ping
+type FairShareHelper struct {
+	fairShareService *service.FairShareService
+	pingFormat       SSEPingFormat
+	pingInterval     time.Duration
+}
+
+// NewFairShareHelper 创建公平准入辅助；fairShareService 为 nil 时直接放行
+func NewFairShareHelper(
+	fairShareService *service.FairShareService,
+	pingFormat SSEPingFormat,
+	pingInterval time.Duration,
+) *FairShareHelper {
+	if pingInterval <= 0 {
+		pingInterval = defaultPingInterval
+	}
+	return &FairShareHelper{
+		fairShareService: fairShareService,
+		pingFormat:       pingFormat,
+		pingInterval:     pingInterval,
+	}
+}
+
+// AcquireWithWait 等待分组准入
+// 返回的 releaseFunc 可重复调用；超时返回 ConcurrencyError{SlotType: "group"}
+func (h *FairShareHelper) AcquireWithWait(
+	c *gin.Context,
+	apiKey *service.APIKey,
+	platform string,
+	hasForcePlatform bool,
+	isStream bool,
+	streamStarted *bool,
+) (func(), error) {
+	noop := func() {}
+	if h == nil || h.fairShareService == nil || apiKey == nil || apiKey.GroupID == nil {
+		return noop, nil
+	}
+
+	ticket, err := h.fairShareService.Acquire(c.Request.Context(), service.FairShareRequest{
+		GroupID:          *apiKey.GroupID,
+		Platform:         platform,
+		HasForcePlatform: hasForcePlatform,
+		UserID:           apiKey.UserID,
+		APIKeyID:         apiKey.ID,
+	})
+	if err != nil || ticket == nil {
+		return noop, nil
+	}
+
+	select {
+	case <-ticket.Ready():
+		return ticket.Release, nil
+	default:
+	}
+
+	timeout := h.fairShareService.Settings(c.Request.Context()).MaxWait()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	if err := h.waitWithPing(c, ctx, ticket, isStream, streamStarted); err != nil {
+		ticket.Release()
+		return nil, err
+	}
+	return ticket.Release, nil
+}
+
+func (h *FairShareHelper) waitWithPing(
+	c *gin.Context,
+	ctx context.Context,
+	ticket *service.FairShareTicket,
+	isStream bool,
+	streamStarted *bool,
+) error {
+	needPing := isStream && h.pingFormat != ""
+
+	var flusher http.Flusher
+	if needPing {
+		var ok bool
+		flusher, ok = c.Writer.(http.Flusher)
+		if !ok {
+			needPing = false
+		}
+	}
+
+	var pingCh <-chan time.Time
+	if needPing {
+		pingTicker := time.NewTicker(h.pingInterval)
+		defer pingTicker.Stop()
+		pingCh = pingTicker.C
+	}
+
+	for {
+		select {
+		case <-ticket.Ready():
+			return nil
+
+		case <-ctx.Done():
+			return &ConcurrencyError{SlotType: "group", IsTimeout: true}
+
+		case <-pingCh:
+			if !*streamStarted {
+				c.Header("Content-Type", "text/event-stream")
+				c.Header("Cache-Control", "no-cache")
+				c.Header("Connection", "keep-alive")
+				c.Header("X-Accel-Buffering", "no")
+				*streamStarted = true
+			}
+			if _, err := fmt.Fprint(c.Writer, string(h.pingFormat)); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+}
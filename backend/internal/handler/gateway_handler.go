@@ -47,10 +47,14 @@ type GatewayHandler struct {
 	errorPassthroughService   *service.ErrorPassthroughService
 	concurrencyHelper         *ConcurrencyHelper
 	userMsgQueueHelper        *UserMsgQueueHelper
+	fairShareHelper           *FairShareHelper
 	maxAccountSwitches        int
 	maxAccountSwitchesGemini  int
 	cfg                       *config.Config
 	settingService            *service.SettingService
+	modelCatalogService       *service.ModelCatalogService
+	shadowService             *service.ShadowService
+	contextPolicyService      *service.ContextPolicyService
 }
 
 // NewGatewayHandler creates a new GatewayHandler
@@ -68,6 +72,10 @@ func NewGatewayHandler(
 	userMsgQueueService *service.UserMessageQueueService,
 	cfg *config.Config,
 	settingService *service.SettingService,
+	modelCatalogService *service.ModelCatalogService,
+	shadowService *service.ShadowService,
+	fairShareService *service.FairShareService,
+	contextPolicyService *service.ContextPolicyService,
 ) *GatewayHandler {
 	pingInterval := time.Duration(0)
 	maxAccountSwitches := 10
@@ -100,10 +108,14 @@ func NewGatewayHandler(
 		errorPassthroughService:   errorPassthroughService,
 		concurrencyHelper:         NewConcurrencyHelper(concurrencyService, SSEPingFormatClaude, pingInterval),
 		userMsgQueueHelper:        umqHelper,
+		fairShareHelper:           NewFairShareHelper(fairShareService, SSEPingFormatClaude, pingInterval),
 		maxAccountSwitches:        maxAccountSwitches,
 		maxAccountSwitchesGemini:  maxAccountSwitchesGemini,
 		cfg:                       cfg,
 		settingService:            settingService,
+		modelCatalogService:       modelCatalogService,
+		shadowService:             shadowService,
+		contextPolicyService:      contextPolicyService,
 	}
 }
 
@@ -189,6 +201,38 @@ func (h *GatewayHandler) Messages(c *gin.Context) {
 		return
 	}
 
+	// 上下文窗口策略：超长请求按分组策略拒绝 / 丢弃最早的轮次 / 切换长上下文模型
+	contextAction := ""
+	contextDecision, err := h.contextPolicyService.Apply(c.Request.Context(), apiKey.GroupID, reqModel, body, parsedReq.MaxTokens)
+	if err != nil {
+		reqLog.Info("gateway.context_window_exceeded", zap.Error(err))
+		h.errorResponse(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if contextDecision != nil {
+		reparsed, err := service.ParseGatewayRequest(contextDecision.Body, domain.PlatformAnthropic)
+		if err != nil {
+			h.errorResponse(c, http.StatusBadRequest, "invalid_request_error", "Failed to parse request body")
+			return
+		}
+		reqLog.Info("gateway.context_policy_applied",
+			zap.String("context_action", contextDecision.Action),
+			zap.String("target_model", contextDecision.Model),
+			zap.Int("estimated_tokens", contextDecision.EstimatedTokens),
+			zap.Int("limit", contextDecision.Limit),
+			zap.Int("dropped_messages", contextDecision.DroppedMessages),
+		)
+		contextAction = contextDecision.Action
+		body = contextDecision.Body
+		parsedReq = reparsed
+		if reqModel != parsedReq.Model {
+			reqModel = parsedReq.Model
+			reqLog = reqLog.With(zap.String("routed_model", reqModel))
+			channelMapping, _ = h.gatewayService.ResolveChannelMappingAndRestrict(c.Request.Context(), apiKey.GroupID, reqModel)
+		}
+		setOpsRequestContext(c, reqModel, reqStream, body)
+	}
+
 	// Track if we've started streaming (for error handling)
 	streamStarted := false
 
@@ -248,6 +292,15 @@ func (h *GatewayHandler) Messages(c *gin.Context) {
 		return
 	}
 
+	// 3. 分组内公平准入：分组满载时按用户权重排队，避免单个用户独占共享账号池
+	fairShareReleaseFunc, err := h.acquireGroupFairShare(c, apiKey, reqStream, &streamStarted)
+	if err != nil {
+		reqLog.Info("gateway.group_fair_share_wait_failed", zap.Error(err))
+		h.handleConcurrencyError(c, err, "group", streamStarted)
+		return
+	}
+	defer fairShareReleaseFunc()
+
 	// 设置请求所属分组 ID（用于渠道级功能判断，如 WebSearch 模拟）
 	parsedReq.GroupID = apiKey.GroupID
 
@@ -402,6 +455,11 @@ func (h *GatewayHandler) Messages(c *gin.Context) {
 			writerSizeBeforeForward := c.Writer.Size()
 			if account.Platform == service.PlatformAntigravity {
 				result, err = h.antigravityGatewayService.ForwardGemini(requestCtx, c, account, reqModel, "generateContent", reqStream, body, hasBoundSession)
+			} else if emulation := h.gatewayService.ResolveServerToolEmulation(requestCtx, account, apiKey.GroupID, body); emulation.Any() {
+				result, err = h.gatewayService.ForwardWithServerToolLoop(requestCtx, c, account, parsedReq, emulation,
+					func(hopCtx context.Context, hc *gin.Context, hopBody []byte) (*service.ForwardResult, error) {
+						return h.geminiCompatService.Forward(hopCtx, hc, account, hopBody)
+					})
 			} else {
 				result, err = h.geminiCompatService.Forward(requestCtx, c, account, body)
 			}
@@ -486,6 +544,7 @@ func (h *GatewayHandler) Messages(c *gin.Context) {
 					ForceCacheBilling:  fs.ForceCacheBilling,
 					APIKeyService:      h.apiKeyService,
 					ChannelUsageFields: channelMapping.ToUsageFields(reqModel, result.UpstreamModel),
+					ContextAction:      contextAction,
 				}); err != nil {
 					logger.L().With(
 						zap.String("component", "handler.gateway.messages"),
@@ -800,6 +859,19 @@ func (h *GatewayHandler) Messages(c *gin.Context) {
 				}
 			}
 
+			// 流量镜像：按分组 shadow 规则异步复制请求，不影响主请求响应
+			if h.shadowService != nil {
+				h.shadowService.Mirror(c, &service.ShadowMirrorInput{
+					APIKey:         currentAPIKey,
+					GroupID:        currentAPIKey.GroupID,
+					Body:           body,
+					Model:          reqModel,
+					Stream:         reqStream,
+					PrimaryAccount: account,
+					PrimaryResult:  result,
+				})
+			}
+
 			// 捕获请求信息（用于异步记录，避免在 goroutine 中访问 gin.Context）
 			userAgent := c.GetHeader("User-Agent")
 			clientIP := ip.GetClientIP(c)
@@ -828,6 +900,7 @@ func (h *GatewayHandler) Messages(c *gin.Context) {
 					ForceCacheBilling:  fs.ForceCacheBilling,
 					APIKeyService:      h.apiKeyService,
 					ChannelUsageFields: channelMapping.ToUsageFields(reqModel, result.UpstreamModel),
+					ContextAction:      contextAction,
 				}); err != nil {
 					logger.L().With(
 						zap.String("component", "handler.gateway.messages"),
@@ -849,56 +922,56 @@ func (h *GatewayHandler) Messages(c *gin.Context) {
 
 // Models handles listing available models
 // GET /v1/models
-// Returns models based on account configurations (model_mapping whitelist)
-// Falls back to default models if no whitelist is configured
+// Returns models based on account configurations (model_mapping whitelist) and channel pricing,
+// enriched with context window, capabilities and the effective price for the calling key.
+// Falls back to default models if no whitelist is configured.
+// Optional ?format=openai|anthropic|gemini overrides the response shape.
 func (h *GatewayHandler) Models(c *gin.Context) {
 	apiKey, _ := middleware2.GetAPIKeyFromContext(c)
 
-	var groupID *int64
 	var platform string
-
 	if apiKey != nil && apiKey.Group != nil {
-		groupID = &apiKey.Group.ID
 		platform = apiKey.Group.Platform
 	}
 	if forcedPlatform, ok := middleware2.GetForcePlatformFromContext(c); ok && strings.TrimSpace(forcedPlatform) != "" {
 		platform = forcedPlatform
 	}
 
-	// Get available models from account configurations (without platform filter)
-	availableModels := h.gatewayService.GetAvailableModels(c.Request.Context(), groupID, "")
-
-	if len(availableModels) > 0 {
-		// Build model list from whitelist
-		models := make([]claude.Model, 0, len(availableModels))
-		for _, modelID := range availableModels {
-			models = append(models, claude.Model{
-				ID:          modelID,
-				Type:        "model",
-				DisplayName: modelID,
-				CreatedAt:   "2024-01-01T00:00:00Z",
-			})
+	if h.modelCatalogService == nil {
+		var groupID *int64
+		if apiKey != nil && apiKey.Group != nil {
+			groupID = &apiKey.Group.ID
+		}
+		// 未注入模型目录时沿用账号模型白名单
+		if availableModels := h.gatewayService.GetAvailableModels(c.Request.Context(), groupID, ""); len(availableModels) > 0 {
+			models := make([]claude.Model, 0, len(availableModels))
+			for _, modelID := range availableModels {
+				models = append(models, claude.Model{
+					ID:          modelID,
+					Type:        "model",
+					DisplayName: modelID,
+					CreatedAt:   "2024-01-01T00:00:00Z",
+				})
+			}
+			c.JSON(http.StatusOK, gin.H{"object": "list", "data": models})
+			return
 		}
-		c.JSON(http.StatusOK, gin.H{
-			"object": "list",
-			"data":   models,
-		})
+		if platform == service.PlatformOpenAI {
+			c.JSON(http.StatusOK, gin.H{"object": "list", "data": openai.DefaultModels})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"object": "list", "data": claude.DefaultModels})
 		return
 	}
 
-	// Fallback to default models
-	if platform == "openai" {
-		c.JSON(http.StatusOK, gin.H{
-			"object": "list",
-			"data":   openai.DefaultModels,
-		})
-		return
+	// 模型目录：账号模型映射 + 渠道定价 + LiteLLM 元数据，价格按该 Key 的实际倍率换算
+	query := service.ModelCatalogQuery{Platform: platform}
+	if apiKey != nil {
+		query.Group = apiKey.Group
+		query.UserID = apiKey.UserID
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"object": "list",
-		"data":   claude.DefaultModels,
-	})
+	entries := h.modelCatalogService.List(c.Request.Context(), query)
+	c.JSON(http.StatusOK, buildModelsListResponse(resolveModelsFormat(c, platform), entries))
 }
 
 // AntigravityModels 返回 Antigravity 支持的全部模型
@@ -1228,6 +1301,18 @@ func (h *GatewayHandler) handleConcurrencyError(c *gin.Context, err error, slotT
 		fmt.Sprintf("Concurrency limit exceeded for %s, please retry later", slotType), streamStarted)
 }
 
+// acquireGroupFairShare 在分组内按权重公平排队（未开启时直接放行）
+func (h *GatewayHandler) acquireGroupFairShare(c *gin.Context, apiKey *service.APIKey, reqStream bool, streamStarted *bool) (func(), error) {
+	platform := ""
+	forcePlatform, hasForcePlatform := middleware2.GetForcePlatformFromContext(c)
+	if hasForcePlatform {
+		platform = forcePlatform
+	} else if apiKey.Group != nil {
+		platform = apiKey.Group.Platform
+	}
+	return h.fairShareHelper.AcquireWithWait(c, apiKey, platform, hasForcePlatform, reqStream, streamStarted)
+}
+
 func (h *GatewayHandler) handleFailoverExhausted(c *gin.Context, failoverErr *service.UpstreamFailoverError, platform string, streamStarted bool) {
 	statusCode := failoverErr.StatusCode
 	responseBody := failoverErr.ResponseBody
@@ -1704,6 +1789,10 @@ func billingErrorDetails(err error) (status int, code, message string) {
 		msg := pkgerrors.Message(err)
 		return http.StatusTooManyRequests, "rate_limit_exceeded", msg
 	}
+	if errors.Is(err, service.ErrBudgetExceeded) {
+		msg := pkgerrors.Message(err)
+		return http.StatusTooManyRequests, "budget_exceeded", msg
+	}
 	msg := pkgerrors.Message(err)
 	if msg == "" {
 		logger.L().With(
@@ -141,6 +141,14 @@ func (h *GatewayHandler) ChatCompletions(c *gin.Context) {
 		return
 	}
 
+	fairShareReleaseFunc, err := h.acquireGroupFairShare(c, apiKey, reqStream, &streamStarted)
+	if err != nil {
+		reqLog.Info("gateway.cc.group_fair_share_wait_failed", zap.Error(err))
+		h.handleConcurrencyError(c, err, "group", streamStarted)
+		return
+	}
+	defer fairShareReleaseFunc()
+
 	// Parse request for session hash
 	parsedReq, _ := service.ParseGatewayRequest(body, "chat_completions")
 	if parsedReq == nil {
@@ -146,6 +146,14 @@ func (h *GatewayHandler) Responses(c *gin.Context) {
 		return
 	}
 
+	fairShareReleaseFunc, err := h.acquireGroupFairShare(c, apiKey, reqStream, &streamStarted)
+	if err != nil {
+		reqLog.Info("gateway.responses.group_fair_share_wait_failed", zap.Error(err))
+		h.handleConcurrencyError(c, err, "group", streamStarted)
+		return
+	}
+	defer fairShareReleaseFunc()
+
 	// Parse request for session hash
 	parsedReq, _ := service.ParseGatewayRequest(body, "responses")
 	if parsedReq == nil {
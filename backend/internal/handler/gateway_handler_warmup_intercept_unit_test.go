@@ -161,6 +161,7 @@ func newTestGatewayHandler(t *testing.T, group *service.Group, accounts []*servi
 		nil, // httpUpstream
 		nil, // deferredService
 		nil, // claudeTokenProvider
+		nil, // vertexTokenProvider
 		nil, // sessionLimitCache
 		nil, // rpmCache
 		nil, // digestStore
@@ -169,6 +170,8 @@ func newTestGatewayHandler(t *testing.T, group *service.Group, accounts []*servi
 		nil, // channelService
 		nil, // resolver
 		nil, // balanceNotifyService
+		nil, // quotaForecastService
+		nil, // promptCacheService
 	)
 
 	// RunModeSimple：跳过计费检查，避免引入 repo/cache 依赖。
@@ -329,6 +329,12 @@ func (h *ConcurrencyHelper) waitForSlotWithPingTimeout(c *gin.Context, slotType
 		pingCh = pingTicker.C
 	}
 
+	// background 请求可能被更高优先级请求挤出账号等待队列
+	var preemptedCh <-chan struct{}
+	if slotType == "account" {
+		preemptedCh = service.RequestPreempted(ctx)
+	}
+
 	backoff := initialBackoff
 	timer := time.NewTimer(backoff)
 	defer timer.Stop()
@@ -341,6 +347,9 @@ func (h *ConcurrencyHelper) waitForSlotWithPingTimeout(c *gin.Context, slotType
 				IsTimeout: true,
 			}
 
+		case <-preemptedCh:
+			return nil, &ConcurrencyError{SlotType: slotType}
+
 		case <-pingCh:
 			// Send ping to keep connection alive
 			if !*streamStarted {
@@ -246,6 +246,14 @@ func (h *GatewayHandler) GeminiV1BetaModels(c *gin.Context) {
 		return
 	}
 
+	fairShareReleaseFunc, err := h.acquireGroupFairShare(c, apiKey, stream, &streamStarted)
+	if err != nil {
+		reqLog.Info("gemini.group_fair_share_wait_failed", zap.Error(err))
+		googleError(c, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	defer fairShareReleaseFunc()
+
 	// 3) select account (sticky session based on request body)
 	// 优先使用 Gemini CLI 的会话标识（privileged-user-id + tmp 目录哈希）
 	sessionHash := extractGeminiCLISessionHash(c, body)
@@ -32,6 +32,11 @@ type AdminHandlers struct {
 	ScheduledTest         *admin.ScheduledTestHandler
 	Channel               *admin.ChannelHandler
 	Payment               *admin.PaymentHandler
+	Referral              *admin.ReferralHandler
+	Shadow                *admin.ShadowHandler
+	Config                *admin.ConfigHandler
+	PromptCache           *admin.PromptCacheHandler
+	ContextPolicy         *admin.ContextPolicyHandler
 }
 
 // Handlers contains all HTTP handlers
@@ -48,8 +53,15 @@ type Handlers struct {
 	OpenAIGateway  *OpenAIGatewayHandler
 	Setting        *SettingHandler
 	Totp           *TotpHandler
+	Passkey        *PasskeyHandler
 	Payment        *PaymentHandler
 	PaymentWebhook *PaymentWebhookHandler
+	Referral       *ReferralHandler
+	Budget         *BudgetHandler
+	Privacy        *PrivacyHandler
+	ModelCatalog   *ModelCatalogHandler
+	OAuthServer    *OAuthServerHandler
+	SCIM           *SCIMHandler
 }
 
 // BuildInfo contains build-time information
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// /v1/models 响应格式
+const (
+	modelsFormatAnthropic = "anthropic"
+	modelsFormatOpenAI    = "openai"
+	modelsFormatGemini    = "gemini"
+)
+
+// ModelCatalogHandler 公开模型价格处理器（无需认证）
+type ModelCatalogHandler struct {
+	catalogService *service.ModelCatalogService
+}
+
+// NewModelCatalogHandler 创建模型价格处理器
+func NewModelCatalogHandler(catalogService *service.ModelCatalogService) *ModelCatalogHandler {
+	return &ModelCatalogHandler{catalogService: catalogService}
+}
+
+// GetPublicPricing 返回公开分组的模型目录与价格
+// GET /api/v1/pricing/public
+func (h *ModelCatalogHandler) GetPublicPricing(c *gin.Context) {
+	groups, err := h.catalogService.ListPublicPricing(c.Request.Context())
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{
+		"currency": "USD",
+		"unit":     "per_million_tokens",
+		"groups":   groups,
+	})
+}
+
+// anthropicCatalogModel Anthropic /v1/models 条目（附带目录扩展字段）
+type anthropicCatalogModel struct {
+	Type string `json:"type"`
+	service.ModelCatalogEntry
+}
+
+// openAICatalogModel OpenAI /v1/models 条目（附带目录扩展字段）
+type openAICatalogModel struct {
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	service.ModelCatalogEntry
+}
+
+// geminiCatalogModel Gemini models.list 条目（附带目录扩展字段）
+type geminiCatalogModel struct {
+	Name                       string                       `json:"name"`
+	BaseModelID                string                       `json:"baseModelId"`
+	DisplayName                string                       `json:"displayName"`
+	InputTokenLimit            int                          `json:"inputTokenLimit,omitempty"`
+	OutputTokenLimit           int                          `json:"outputTokenLimit,omitempty"`
+	SupportedGenerationMethods []string                     `json:"supportedGenerationMethods"`
+	Capabilities               service.ModelCapabilities    `json:"capabilities"`
+	Pricing                    *service.ModelCatalogPricing `json:"pricing,omitempty"`
+}
+
+// resolveModelsFormat 显式 ?format= 优先，否则按分组平台选择（与历史行为一致：非 OpenAI 返回 Anthropic 格式）
+func resolveModelsFormat(c *gin.Context, platform string) string {
+	switch strings.ToLower(strings.TrimSpace(c.Query("format"))) {
+	case modelsFormatOpenAI:
+		return modelsFormatOpenAI
+	case modelsFormatGemini:
+		return modelsFormatGemini
+	case modelsFormatAnthropic:
+		return modelsFormatAnthropic
+	}
+	if platform == service.PlatformOpenAI {
+		return modelsFormatOpenAI
+	}
+	return modelsFormatAnthropic
+}
+
+// buildModelsListResponse 将模型目录转换为指定客户端格式
+func buildModelsListResponse(format string, entries []service.ModelCatalogEntry) any {
+	switch format {
+	case modelsFormatOpenAI:
+		data := make([]openAICatalogModel, 0, len(entries))
+		for _, e := range entries {
+			created := int64(0)
+			if t, err := time.Parse(time.RFC3339, e.CreatedAt); err == nil {
+				created = t.Unix()
+			}
+			ownedBy := e.Provider
+			if ownedBy == "" {
+				ownedBy = e.Platform
+			}
+			data = append(data, openAICatalogModel{Object: "model", Created: created, OwnedBy: ownedBy, ModelCatalogEntry: e})
+		}
+		return gin.H{"object": "list", "data": data}
+	case modelsFormatGemini:
+		models := make([]geminiCatalogModel, 0, len(entries))
+		for _, e := range entries {
+			models = append(models, geminiCatalogModel{
+				Name:                       "models/" + e.ID,
+				BaseModelID:                e.ID,
+				DisplayName:                e.DisplayName,
+				InputTokenLimit:            e.ContextWindow,
+				OutputTokenLimit:           e.MaxOutputTokens,
+				SupportedGenerationMethods: []string{"generateContent", "streamGenerateContent"},
+				Capabilities:               e.Capabilities,
+				Pricing:                    e.Pricing,
+			})
+		}
+		return gin.H{"models": models}
+	default:
+		data := make([]anthropicCatalogModel, 0, len(entries))
+		for _, e := range entries {
+			data = append(data, anthropicCatalogModel{Type: "model", ModelCatalogEntry: e})
+		}
+		resp := gin.H{"object": "list", "data": data, "has_more": false}
+		if len(data) > 0 {
+			resp["first_id"] = data[0].ID
+			resp["last_id"] = data[len(data)-1].ID
+		}
+		return resp
+	}
+}
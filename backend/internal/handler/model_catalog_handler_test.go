@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildModelsListResponse_Shapes(t *testing.T) {
+	entries := []service.ModelCatalogEntry{{
+		ID:              "claude-sonnet-4-5-20250929",
+		DisplayName:     "Claude Sonnet 4.5",
+		CreatedAt:       "2025-09-29T00:00:00Z",
+		Provider:        "anthropic",
+		ContextWindow:   200000,
+		MaxOutputTokens: 64000,
+		Capabilities:    service.ModelCapabilities{Vision: true},
+		Pricing:         &service.ModelCatalogPricing{Currency: "USD", InputPerMTok: 3},
+	}}
+
+	decode := func(v any) map[string]any {
+		raw, err := json.Marshal(v)
+		require.NoError(t, err)
+		var out map[string]any
+		require.NoError(t, json.Unmarshal(raw, &out))
+		return out
+	}
+
+	anthropic := decode(buildModelsListResponse(modelsFormatAnthropic, entries))
+	item := anthropic["data"].([]any)[0].(map[string]any)
+	require.Equal(t, "model", item["type"])
+	require.Equal(t, "2025-09-29T00:00:00Z", item["created_at"])
+	require.EqualValues(t, 200000, item["context_window"])
+	require.Equal(t, "claude-sonnet-4-5-20250929", anthropic["first_id"])
+
+	openaiResp := decode(buildModelsListResponse(modelsFormatOpenAI, entries))
+	item = openaiResp["data"].([]any)[0].(map[string]any)
+	require.Equal(t, "model", item["object"])
+	require.EqualValues(t, 1759104000, item["created"])
+	require.Equal(t, "anthropic", item["owned_by"])
+	require.EqualValues(t, 3, item["pricing"].(map[string]any)["input_per_mtok"])
+
+	geminiResp := decode(buildModelsListResponse(modelsFormatGemini, entries))
+	item = geminiResp["models"].([]any)[0].(map[string]any)
+	require.Equal(t, "models/claude-sonnet-4-5-20250929", item["name"])
+	require.EqualValues(t, 200000, item["inputTokenLimit"])
+	require.EqualValues(t, 64000, item["outputTokenLimit"])
+}
+
+func TestResolveModelsFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newCtx := func(query string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1/models"+query, nil)
+		return c
+	}
+	require.Equal(t, modelsFormatOpenAI, resolveModelsFormat(newCtx(""), service.PlatformOpenAI))
+	require.Equal(t, modelsFormatAnthropic, resolveModelsFormat(newCtx(""), service.PlatformGemini))
+	require.Equal(t, modelsFormatGemini, resolveModelsFormat(newCtx("?format=gemini"), service.PlatformAnthropic))
+}
+
+type modelsAccountRepoStub struct {
+	service.AccountRepository
+	accounts []service.Account
+}
+
+func (r *modelsAccountRepoStub) ListSchedulable(context.Context) ([]service.Account, error) {
+	return r.accounts, nil
+}
+
+func TestGatewayHandlerModels_WithoutCatalogUsesWhitelist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	accountRepo := &modelsAccountRepoStub{accounts: []service.Account{{
+		ID:          1,
+		Platform:    service.PlatformAnthropic,
+		Credentials: map[string]any{"model_mapping": map[string]any{"claude-custom": "claude-sonnet-4-5"}},
+	}}}
+	gwSvc := service.NewGatewayService(accountRepo, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+		nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	h := &GatewayHandler{gatewayService: gwSvc}
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	h.Models(c)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	require.Equal(t, "claude-custom", resp.Data[0].ID)
+}
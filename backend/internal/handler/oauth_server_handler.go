@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthServerHandler exposes sub2api as an OAuth 2.0 authorization server for CLIs.
+// The device/token/revoke endpoints speak RFC 6749 JSON; the consent endpoints use the usual envelope.
+type OAuthServerHandler struct {
+	oauthServerService *service.OAuthServerService
+}
+
+// NewOAuthServerHandler creates a new OAuthServerHandler
+func NewOAuthServerHandler(oauthServerService *service.OAuthServerService) *OAuthServerHandler {
+	return &OAuthServerHandler{
+		oauthServerService: oauthServerService,
+	}
+}
+
+func oauthRequestBase(c *gin.Context) string {
+	scheme := "http"
+	if isRequestHTTPS(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// writeOAuthError renders token endpoint errors as {error, error_description}
+func writeOAuthError(c *gin.Context, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		logger.LegacyPrintf("handler.oauth_server", "[OAuthServer] internal error: %v", err)
+		oauthErr = &service.OAuthError{Status: http.StatusInternalServerError, Code: "server_error"}
+	}
+	c.Header("Cache-Control", "no-store")
+	body := gin.H{"error": oauthErr.Code}
+	if oauthErr.Description != "" {
+		body["error_description"] = oauthErr.Description
+	}
+	c.JSON(oauthErr.Status, body)
+}
+
+func (h *OAuthServerHandler) requireEnabledRFC(c *gin.Context) bool {
+	if !h.oauthServerService.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invalid_request", "error_description": "oauth authorization server is disabled"})
+		return false
+	}
+	return true
+}
+
+// Metadata returns authorization server metadata (RFC 8414)
+// GET /.well-known/oauth-authorization-server
+func (h *OAuthServerHandler) Metadata(c *gin.Context) {
+	if !h.requireEnabledRFC(c) {
+		return
+	}
+	c.JSON(http.StatusOK, h.oauthServerService.Metadata(c.Request.Context(), oauthRequestBase(c)))
+}
+
+// DeviceAuthorization starts a device code flow (RFC 8628)
+// POST /api/v1/oauth/device_authorization
+func (h *OAuthServerHandler) DeviceAuthorization(c *gin.Context) {
+	if !h.requireEnabledRFC(c) {
+		return
+	}
+	resp, err := h.oauthServerService.StartDeviceAuthorization(c.Request.Context(), c.PostForm("client_id"), c.PostForm("scope"), oauthRequestBase(c))
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// Token exchanges a device code, authorization code or refresh token for a scoped API key
+// POST /api/v1/oauth/token
+func (h *OAuthServerHandler) Token(c *gin.Context) {
+	if !h.requireEnabledRFC(c) {
+		return
+	}
+	var req service.OAuthTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		writeOAuthError(c, &service.OAuthError{Status: http.StatusBadRequest, Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	resp, err := h.oauthServerService.Token(c.Request.Context(), &req)
+	if err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke revokes a refresh token or an OAuth-issued API key (RFC 7009)
+// POST /api/v1/oauth/revoke
+func (h *OAuthServerHandler) Revoke(c *gin.Context) {
+	if !h.requireEnabledRFC(c) {
+		return
+	}
+	if err := h.oauthServerService.Revoke(c.Request.Context(), c.PostForm("client_id"), c.PostForm("token")); err != nil {
+		writeOAuthError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// GetConsent returns what the consent screen should show for a user code or an authorization request
+// GET /api/v1/oauth/consent
+func (h *OAuthServerHandler) GetConsent(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	if !h.oauthServerService.Enabled() {
+		response.ErrorFrom(c, service.ErrOAuthServerDisabled)
+		return
+	}
+
+	var (
+		consent *service.OAuthConsent
+		err     error
+	)
+	if userCode := c.Query("user_code"); userCode != "" {
+		consent, err = h.oauthServerService.GetDeviceConsent(c.Request.Context(), subject.UserID, userCode)
+	} else {
+		var req service.OAuthAuthorizeRequest
+		if bindErr := c.ShouldBindQuery(&req); bindErr != nil {
+			response.BadRequest(c, "Invalid request: "+bindErr.Error())
+			return
+		}
+		consent, err = h.oauthServerService.GetAuthorizeConsent(c.Request.Context(), subject.UserID, &req)
+	}
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, consent)
+}
+
+// ApproveDeviceRequest is the consent screen submission for a device code
+type ApproveDeviceRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	GroupID  int64  `json:"group_id"`
+	Approve  bool   `json:"approve"`
+}
+
+// ApproveDevice approves or denies a pending device code
+// POST /api/v1/oauth/device/approve
+func (h *OAuthServerHandler) ApproveDevice(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	if !h.oauthServerService.Enabled() {
+		response.ErrorFrom(c, service.ErrOAuthServerDisabled)
+		return
+	}
+	var req ApproveDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	if err := h.oauthServerService.ApproveDevice(c.Request.Context(), subject.UserID, req.UserCode, req.GroupID, req.Approve); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"approved": req.Approve})
+}
+
+// Authorize approves or denies an authorization code request and returns the client redirect
+// POST /api/v1/oauth/authorize
+func (h *OAuthServerHandler) Authorize(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	if !h.oauthServerService.Enabled() {
+		response.ErrorFrom(c, service.ErrOAuthServerDisabled)
+		return
+	}
+	var req service.OAuthAuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	redirectURL, err := h.oauthServerService.Authorize(c.Request.Context(), subject.UserID, &req)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"redirect_url": redirectURL})
+}
+
+// ListGrants lists CLI clients the user has authorized
+// GET /api/v1/oauth/grants
+func (h *OAuthServerHandler) ListGrants(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	grants, err := h.oauthServerService.ListGrants(c.Request.Context(), subject.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, grants)
+}
+
+// RevokeGrant revokes an authorization and deletes the key it issued
+// DELETE /api/v1/oauth/grants/:id
+func (h *OAuthServerHandler) RevokeGrant(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	grantID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid grant ID")
+		return
+	}
+	if err := h.oauthServerService.RevokeGrant(c.Request.Context(), subject.UserID, grantID); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"message": "Authorization revoked"})
+}
@@ -106,6 +106,12 @@ func (h *OpenAIGatewayHandler) ChatCompletions(c *gin.Context) {
 		return
 	}
 
+	fairShareReleaseFunc, admitted := h.acquireGroupFairShare(c, apiKey, reqStream, &streamStarted, reqLog)
+	if !admitted {
+		return
+	}
+	defer fairShareReleaseFunc()
+
 	sessionHash := h.gatewayService.GenerateSessionHash(c, body)
 	promptCacheKey := h.gatewayService.ExtractSessionID(c, body)
 
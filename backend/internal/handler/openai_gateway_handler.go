@@ -33,6 +33,7 @@ type OpenAIGatewayHandler struct {
 	usageRecordWorkerPool   *service.UsageRecordWorkerPool
 	errorPassthroughService *service.ErrorPassthroughService
 	concurrencyHelper       *ConcurrencyHelper
+	fairShareHelper         *FairShareHelper
 	maxAccountSwitches      int
 	cfg                     *config.Config
 }
@@ -63,6 +64,7 @@ func NewOpenAIGatewayHandler(
 	usageRecordWorkerPool *service.UsageRecordWorkerPool,
 	errorPassthroughService *service.ErrorPassthroughService,
 	cfg *config.Config,
+	fairShareService *service.FairShareService,
 ) *OpenAIGatewayHandler {
 	pingInterval := time.Duration(0)
 	maxAccountSwitches := 3
@@ -79,6 +81,7 @@ func NewOpenAIGatewayHandler(
 		usageRecordWorkerPool:   usageRecordWorkerPool,
 		errorPassthroughService: errorPassthroughService,
 		concurrencyHelper:       NewConcurrencyHelper(concurrencyService, SSEPingFormatComment, pingInterval),
+		fairShareHelper:         NewFairShareHelper(fairShareService, SSEPingFormatComment, pingInterval),
 		maxAccountSwitches:      maxAccountSwitches,
 		cfg:                     cfg,
 	}
@@ -228,6 +231,12 @@ func (h *OpenAIGatewayHandler) Responses(c *gin.Context) {
 		return
 	}
 
+	fairShareReleaseFunc, admitted := h.acquireGroupFairShare(c, apiKey, reqStream, &streamStarted, reqLog)
+	if !admitted {
+		return
+	}
+	defer fairShareReleaseFunc()
+
 	// Generate session hash (header first; fallback to prompt_cache_key)
 	sessionHash := h.gatewayService.GenerateSessionHash(c, sessionHashBody)
 
@@ -594,6 +603,12 @@ func (h *OpenAIGatewayHandler) Messages(c *gin.Context) {
 		return
 	}
 
+	fairShareReleaseFunc, admitted := h.acquireGroupFairShare(c, apiKey, reqStream, &streamStarted, reqLog)
+	if !admitted {
+		return
+	}
+	defer fairShareReleaseFunc()
+
 	sessionHash := h.gatewayService.GenerateSessionHash(c, body)
 	promptCacheKey := h.gatewayService.ExtractSessionID(c, body)
 
@@ -922,6 +937,23 @@ func (h *OpenAIGatewayHandler) acquireResponsesUserSlot(
 	return wrapReleaseOnDone(ctx, userReleaseFunc), true
 }
 
+// acquireGroupFairShare 在分组内按权重公平排队（未开启时直接放行）
+func (h *OpenAIGatewayHandler) acquireGroupFairShare(
+	c *gin.Context,
+	apiKey *service.APIKey,
+	reqStream bool,
+	streamStarted *bool,
+	reqLog *zap.Logger,
+) (func(), bool) {
+	releaseFunc, err := h.fairShareHelper.AcquireWithWait(c, apiKey, service.PlatformOpenAI, false, reqStream, streamStarted)
+	if err != nil {
+		reqLog.Info("openai.group_fair_share_wait_failed", zap.Error(err))
+		h.handleConcurrencyError(c, err, "group", *streamStarted)
+		return nil, false
+	}
+	return releaseFunc, true
+}
+
 func (h *OpenAIGatewayHandler) acquireResponsesAccountSlot(
 	c *gin.Context,
 	groupID *int64,
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ip"
+	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Realtime handles OpenAI Realtime API WebSocket sessions.
+// GET /v1/realtime?model=xxx
+//
+// 与 Responses WebSocket 不同，Realtime 的模型在查询参数中给出，
+// 因此鉴权、计费检查、账号选择与并发槽位都在升级前完成，失败时直接返回 HTTP 错误；
+// 用户与账号并发槽位在整个会话期间保持占用，每个 response.done 单独记录用量。
+func (h *OpenAIGatewayHandler) Realtime(c *gin.Context) {
+	if !isOpenAIWSUpgradeRequest(c.Request) {
+		h.errorResponse(c, http.StatusUpgradeRequired, "invalid_request_error", "WebSocket upgrade required (Upgrade: websocket)")
+		return
+	}
+	setOpenAIClientTransportWS(c)
+
+	apiKey, ok := middleware2.GetAPIKeyFromContext(c)
+	if !ok {
+		h.errorResponse(c, http.StatusUnauthorized, "authentication_error", "Invalid API key")
+		return
+	}
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		h.errorResponse(c, http.StatusInternalServerError, "api_error", "User context not found")
+		return
+	}
+	reqModel := strings.TrimSpace(c.Query("model"))
+	if reqModel == "" {
+		h.errorResponse(c, http.StatusBadRequest, "invalid_request_error", "model query parameter is required")
+		return
+	}
+
+	reqLog := requestLogger(
+		c,
+		"handler.openai_gateway.realtime",
+		zap.Int64("user_id", subject.UserID),
+		zap.Int64("api_key_id", apiKey.ID),
+		zap.Any("group_id", apiKey.GroupID),
+		zap.String("model", reqModel),
+	)
+	if !h.ensureResponsesDependencies(c, reqLog) {
+		return
+	}
+	clientIP := ip.GetClientIP(c)
+	userAgent := strings.TrimSpace(c.GetHeader("User-Agent"))
+	setOpsRequestContext(c, reqModel, true, nil)
+	setOpsEndpointContext(c, "", int16(service.RequestTypeWSV2))
+
+	ctx := c.Request.Context()
+	channelMapping, _ := h.gatewayService.ResolveChannelMappingAndRestrict(ctx, apiKey.GroupID, reqModel)
+	upstreamModel := reqModel
+	if channelMapping.Mapped {
+		upstreamModel = channelMapping.MappedModel
+	}
+	subscription, _ := middleware2.GetSubscriptionFromContext(c)
+
+	streamStarted := false
+	userReleaseFunc, acquired := h.acquireResponsesUserSlot(c, subject.UserID, subject.Concurrency, false, &streamStarted, reqLog)
+	if !acquired {
+		return
+	}
+	if userReleaseFunc != nil {
+		defer userReleaseFunc()
+	}
+
+	if err := h.billingCacheService.CheckBillingEligibility(ctx, apiKey.User, apiKey, apiKey.Group, subscription); err != nil {
+		reqLog.Info("openai.realtime_billing_eligibility_check_failed", zap.Error(err))
+		status, code, message := billingErrorDetails(err)
+		h.errorResponse(c, status, code, message)
+		return
+	}
+
+	fairShareReleaseFunc, admitted := h.acquireGroupFairShare(c, apiKey, false, &streamStarted, reqLog)
+	if !admitted {
+		return
+	}
+	defer fairShareReleaseFunc()
+
+	selection, scheduleDecision, err := h.gatewayService.SelectAccountWithScheduler(
+		ctx,
+		apiKey.GroupID,
+		"",
+		"",
+		reqModel,
+		nil,
+		service.OpenAIUpstreamTransportRealtime,
+	)
+	if err != nil {
+		reqLog.Warn("openai.realtime_account_select_failed", zap.Error(err))
+		h.errorResponse(c, http.StatusServiceUnavailable, "api_error", "No available accounts")
+		return
+	}
+	accountReleaseFunc, acquired := h.acquireResponsesAccountSlot(c, apiKey.GroupID, "", selection, false, &streamStarted, reqLog)
+	if !acquired {
+		return
+	}
+	if accountReleaseFunc != nil {
+		defer accountReleaseFunc()
+	}
+	account := selection.Account
+	setOpsSelectedAccount(c, account.ID, account.Platform)
+	reqLog.Debug("openai.realtime_account_selected",
+		zap.Int64("account_id", account.ID),
+		zap.String("account_name", account.Name),
+		zap.String("schedule_layer", scheduleDecision.Layer),
+		zap.Int("candidate_count", scheduleDecision.CandidateCount),
+	)
+
+	token, _, err := h.gatewayService.GetAccessToken(ctx, account)
+	if err != nil {
+		reqLog.Warn("openai.realtime_get_access_token_failed", zap.Int64("account_id", account.ID), zap.Error(err))
+		h.errorResponse(c, http.StatusBadGateway, "api_error", "Failed to get access token")
+		return
+	}
+
+	wsConn, err := coderws.Accept(c.Writer, c.Request, &coderws.AcceptOptions{
+		Subprotocols:    []string{service.OpenAIRealtimeSubprotocol},
+		CompressionMode: coderws.CompressionContextTakeover,
+	})
+	if err != nil {
+		reqLog.Warn("openai.realtime_accept_failed",
+			zap.Error(err),
+			zap.String("client_ip", clientIP),
+			zap.String("request_user_agent", userAgent),
+		)
+		return
+	}
+	defer func() {
+		_ = wsConn.CloseNow()
+	}()
+	wsConn.SetReadLimit(16 * 1024 * 1024)
+	reqLog.Info("openai.realtime_session_started", zap.Int64("account_id", account.ID))
+
+	onResponseDone := func(result *service.OpenAIForwardResult) {
+		h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, true, result.FirstTokenMs)
+		h.submitUsageRecordTask(func(taskCtx context.Context) {
+			if err := h.gatewayService.RecordUsage(taskCtx, &service.OpenAIRecordUsageInput{
+				Result:             result,
+				APIKey:             apiKey,
+				User:               apiKey.User,
+				Account:            account,
+				Subscription:       subscription,
+				InboundEndpoint:    GetInboundEndpoint(c),
+				UpstreamEndpoint:   GetUpstreamEndpoint(c, account.Platform),
+				UserAgent:          userAgent,
+				IPAddress:          clientIP,
+				RequestPayloadHash: service.HashUsageRequestPayload([]byte(result.RequestID)),
+				APIKeyService:      h.apiKeyService,
+				ChannelUsageFields: channelMapping.ToUsageFields(reqModel, result.UpstreamModel),
+			}); err != nil {
+				reqLog.Error("openai.realtime_record_usage_failed",
+					zap.Int64("account_id", account.ID),
+					zap.String("request_id", result.RequestID),
+					zap.Error(err),
+				)
+			}
+		})
+	}
+
+	if err := h.gatewayService.ProxyRealtimeWebSocket(ctx, c, wsConn, account, token, upstreamModel, onResponseDone); err != nil {
+		h.gatewayService.ReportOpenAIAccountScheduleResult(account.ID, false, nil)
+		closeStatus, closeReason := summarizeWSCloseErrorForLog(err)
+		reqLog.Warn("openai.realtime_proxy_failed",
+			zap.Int64("account_id", account.ID),
+			zap.Error(err),
+			zap.String("close_status", closeStatus),
+			zap.String("close_reason", closeReason),
+		)
+		var closeErr *service.OpenAIWSClientCloseError
+		if errors.As(err, &closeErr) {
+			closeOpenAIClientWS(wsConn, closeErr.StatusCode(), closeErr.Reason())
+			return
+		}
+		closeOpenAIClientWS(wsConn, coderws.StatusInternalError, "upstream websocket proxy failed")
+		return
+	}
+	closeOpenAIClientWS(wsConn, coderws.StatusNormalClosure, "")
+	reqLog.Info("openai.realtime_session_closed", zap.Int64("account_id", account.ID))
+}
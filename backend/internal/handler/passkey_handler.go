@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+// PasskeyHandler 当前用户的通行密钥与恢复码管理
+type PasskeyHandler struct {
+	passkeyService *service.PasskeyService
+	userService    *service.UserService
+	twoFactor      *service.TwoFactorService
+	recoveryCodes  *service.RecoveryCodeService
+}
+
+// NewPasskeyHandler creates a new PasskeyHandler
+func NewPasskeyHandler(passkeyService *service.PasskeyService, userService *service.UserService, twoFactor *service.TwoFactorService, recoveryCodes *service.RecoveryCodeService) *PasskeyHandler {
+	return &PasskeyHandler{
+		passkeyService: passkeyService,
+		userService:    userService,
+		twoFactor:      twoFactor,
+		recoveryCodes:  recoveryCodes,
+	}
+}
+
+// PasskeyIdentityRequest 敏感操作前的身份确认（与 TOTP 相同：邮箱验证码或密码）
+type PasskeyIdentityRequest struct {
+	EmailCode string `json:"email_code"`
+	Password  string `json:"password"`
+}
+
+// PasskeyRegisterRequest 完成注册
+type PasskeyRegisterRequest struct {
+	Name       string          `json:"name" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// PasskeyRenameRequest 重命名
+type PasskeyRenameRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// List 列出当前用户的通行密钥
+// GET /api/v1/user/passkeys
+func (h *PasskeyHandler) List(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	items, err := h.passkeyService.List(c.Request.Context(), subject.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{
+		"enabled":  h.passkeyService.Enabled(),
+		"passkeys": items,
+	})
+}
+
+// BeginRegistration 验证身份并返回 PublicKeyCredentialCreationOptions
+// POST /api/v1/user/passkeys/register/options
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	var req PasskeyIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req = PasskeyIdentityRequest{}
+	}
+	options, err := h.passkeyService.BeginRegistration(c.Request.Context(), subject.UserID, req.EmailCode, req.Password)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, options)
+}
+
+// FinishRegistration 保存通行密钥；首个第二因素会同时返回恢复码（仅此一次）
+// POST /api/v1/user/passkeys/register
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	var req PasskeyRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	passkey, err := h.passkeyService.FinishRegistration(c.Request.Context(), subject.UserID, req.Name, req.Credential)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	codes, err := h.recoveryCodes.IssueInitial(c.Request.Context(), subject.UserID)
+	if err != nil {
+		logger.LegacyPrintf("handler.passkey", "[Passkey] issue recovery codes for user %d failed: %v", subject.UserID, err)
+	}
+	response.Success(c, gin.H{"passkey": passkey, "recovery_codes": codes})
+}
+
+// Rename 修改通行密钥名称
+// PATCH /api/v1/user/passkeys/:id
+func (h *PasskeyHandler) Rename(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid passkey ID")
+		return
+	}
+	var req PasskeyRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	if err := h.passkeyService.Rename(c.Request.Context(), subject.UserID, id, req.Name); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"success": true})
+}
+
+// Delete 验证身份后删除通行密钥
+// DELETE /api/v1/user/passkeys/:id
+func (h *PasskeyHandler) Delete(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid passkey ID")
+		return
+	}
+	var req PasskeyIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req = PasskeyIdentityRequest{}
+	}
+	if err := h.passkeyService.Delete(c.Request.Context(), subject.UserID, id, req.EmailCode, req.Password); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	reconcileRecoveryCodes(c, h.userService, h.twoFactor, subject.UserID)
+	response.Success(c, gin.H{"success": true})
+}
+
+// GetRecoveryCodeStatus 返回剩余恢复码数量
+// GET /api/v1/user/recovery-codes
+func (h *PasskeyHandler) GetRecoveryCodeStatus(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	status, err := h.recoveryCodes.GetStatus(c.Request.Context(), subject.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, status)
+}
+
+// RegenerateRecoveryCodes 作废旧恢复码并返回新的一组（需验证身份）
+// POST /api/v1/user/recovery-codes/regenerate
+func (h *PasskeyHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+	var req PasskeyIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req = PasskeyIdentityRequest{}
+	}
+	ctx := c.Request.Context()
+	user, err := h.userService.GetByID(ctx, subject.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	hasSecondFactor, err := h.twoFactor.HasSecondFactor(ctx, user)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	codes, err := h.recoveryCodes.Regenerate(ctx, subject.UserID, hasSecondFactor, req.EmailCode, req.Password)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"recovery_codes": codes})
+}
+
+// reconcileRecoveryCodes 移除第二因素后调用；失败只记录日志，不影响主操作结果
+func reconcileRecoveryCodes(c *gin.Context, userService *service.UserService, twoFactor *service.TwoFactorService, userID int64) {
+	ctx := c.Request.Context()
+	user, err := userService.GetByID(ctx, userID)
+	if err == nil {
+		err = twoFactor.ReconcileRecoveryCodes(ctx, user)
+	}
+	if err != nil {
+		logger.LegacyPrintf("handler.passkey", "[2FA] reconcile recovery codes for user %d failed: %v", userID, err)
+	}
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivacyHandler handles self-service data export and account deletion
+type PrivacyHandler struct {
+	privacyService *service.PrivacyService
+}
+
+// NewPrivacyHandler creates a new PrivacyHandler
+func NewPrivacyHandler(privacyService *service.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+	}
+}
+
+// ListExports lists the user's data exports
+// GET /api/v1/user/privacy/exports
+func (h *PrivacyHandler) ListExports(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	exports, err := h.privacyService.ListExports(c.Request.Context(), subject.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, exports)
+}
+
+// RequestExport starts generating a data export archive
+// POST /api/v1/user/privacy/exports
+func (h *PrivacyHandler) RequestExport(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	export, err := h.privacyService.RequestExport(c.Request.Context(), subject.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Accepted(c, export)
+}
+
+// GetExport returns an export; ready exports include a short-lived download link
+// GET /api/v1/user/privacy/exports/:id
+func (h *PrivacyHandler) GetExport(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	exportID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid export ID")
+		return
+	}
+
+	export, err := h.privacyService.GetExport(c.Request.Context(), subject.UserID, exportID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, export)
+}
+
+// DownloadExport serves an export archive via a signed, time-limited link (no login required)
+// GET /api/v1/data-exports/:id/download?expires=...&sig=...
+func (h *PrivacyHandler) DownloadExport(c *gin.Context) {
+	exportID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, "Invalid export ID")
+		return
+	}
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+
+	export, err := h.privacyService.ResolveDownload(c.Request.Context(), exportID, expires, c.Query("sig"))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(export.FilePath, service.ExportFileName(export))
+}
+
+// GetDeletion returns the pending account deletion request
+// GET /api/v1/user/privacy/deletion
+func (h *PrivacyHandler) GetDeletion(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	req, err := h.privacyService.GetPendingDeletion(c.Request.Context(), subject.UserID)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, req)
+}
+
+// RequestDeletion schedules account deletion after the grace period
+// POST /api/v1/user/privacy/deletion
+func (h *PrivacyHandler) RequestDeletion(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req service.RequestDeletionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+	req.AuthTime = subject.AuthTime
+
+	deletion, err := h.privacyService.RequestDeletion(c.Request.Context(), subject.UserID, &req)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, deletion)
+}
+
+// CancelDeletion cancels a pending deletion request during the grace period
+// DELETE /api/v1/user/privacy/deletion
+func (h *PrivacyHandler) CancelDeletion(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.privacyService.CancelDeletion(c.Request.Context(), subject.UserID); err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, gin.H{"message": "Deletion request cancelled"})
+}
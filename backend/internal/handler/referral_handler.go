@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ip"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
+	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReferralHandler handles user-facing referral program requests
+type ReferralHandler struct {
+	referralService *service.ReferralService
+}
+
+// NewReferralHandler creates a new ReferralHandler
+func NewReferralHandler(referralService *service.ReferralService) *ReferralHandler {
+	return &ReferralHandler{
+		referralService: referralService,
+	}
+}
+
+// ReferralWithdrawRequest represents a request to move referral credit into balance
+type ReferralWithdrawRequest struct {
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+}
+
+// GetDashboard returns the user's referral code, link info and earnings
+// GET /api/v1/user/referral
+func (h *ReferralHandler) GetDashboard(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	dashboard, err := h.referralService.GetDashboard(c.Request.Context(), subject.UserID, ip.GetClientIP(c))
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, dashboard)
+}
+
+// ListReferees lists users referred by the current user
+// GET /api/v1/user/referral/referees
+func (h *ReferralHandler) ListReferees(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	page, pageSize := response.ParsePagination(c)
+	params := pagination.PaginationParams{Page: page, PageSize: pageSize}
+	relations, result, err := h.referralService.ListRelations(c.Request.Context(), params, service.ReferralListFilters{ReferrerID: subject.UserID})
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	for i := range relations {
+		// 邀请人只能看到脱敏后的被邀请人邮箱，且不暴露注册 IP。
+		relations[i].RefereeEmail = maskReferralEmail(relations[i].RefereeEmail)
+		relations[i].ReferrerEmail = ""
+		relations[i].RegisterIP = ""
+	}
+	response.Paginated(c, relations, result.Total, page, pageSize)
+}
+
+// ListCommissions lists commissions earned by the current user
+// GET /api/v1/user/referral/commissions
+func (h *ReferralHandler) ListCommissions(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	page, pageSize := response.ParsePagination(c)
+	params := pagination.PaginationParams{Page: page, PageSize: pageSize}
+	commissions, result, err := h.referralService.ListCommissions(c.Request.Context(), params, service.ReferralListFilters{ReferrerID: subject.UserID})
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	for i := range commissions {
+		commissions[i].RefereeEmail = maskReferralEmail(commissions[i].RefereeEmail)
+	}
+	response.Paginated(c, commissions, result.Total, page, pageSize)
+}
+
+// ListPayouts lists the user's recent referral payouts
+// GET /api/v1/user/referral/payouts
+func (h *ReferralHandler) ListPayouts(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	payouts, err := h.referralService.ListPayouts(c.Request.Context(), subject.UserID, 50)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, payouts)
+}
+
+// Withdraw moves withdrawable referral credit into the user's balance
+// POST /api/v1/user/referral/withdraw
+func (h *ReferralHandler) Withdraw(c *gin.Context) {
+	subject, ok := middleware2.GetAuthSubjectFromContext(c)
+	if !ok {
+		response.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var req ReferralWithdrawRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request: "+err.Error())
+		return
+	}
+
+	payout, err := h.referralService.WithdrawToBalance(c.Request.Context(), subject.UserID, req.Amount)
+	if err != nil {
+		response.ErrorFrom(c, err)
+		return
+	}
+	response.Success(c, payout)
+}
+
+// maskReferralEmail keeps the first character of the local part, e.g. "a***@example.com".
+func maskReferralEmail(email string) string {
+	at := strings.IndexByte(email, '@')
+	if at <= 0 {
+		return email
+	}
+	return email[:1] + "***" + email[at:]
+}
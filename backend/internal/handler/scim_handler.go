@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	scimContentType = "application/scim+json"
+	scimBasePath    = "/scim/v2"
+)
+
+// scimErrorTypes 错误 reason 到 RFC 7644 §3.12 scimType 的映射
+var scimErrorTypes = map[string]string{
+	service.ErrSCIMUniqueness.Reason:    "uniqueness",
+	service.ErrSCIMInvalidFilter.Reason: "invalidFilter",
+	service.ErrSCIMInvalidValue.Reason:  "invalidValue",
+	service.ErrSCIMInvalidPath.Reason:   "invalidPath",
+	service.ErrSCIMNoTarget.Reason:      "noTarget",
+	service.ErrSCIMMutability.Reason:    "mutability",
+	service.ErrSCIMInvalidSyntax.Reason: "invalidSyntax",
+}
+
+// SCIMHandler SCIM 2.0 供应端点，响应均为 application/scim+json
+type SCIMHandler struct {
+	scimService *service.SCIMService
+}
+
+// NewSCIMHandler creates a new SCIMHandler
+func NewSCIMHandler(scimService *service.SCIMService) *SCIMHandler {
+	return &SCIMHandler{scimService: scimService}
+}
+
+// Authenticate 校验 Authorization: Bearer <scim.bearer_token>；未启用时整个端点返回 404
+func (h *SCIMHandler) Authenticate(c *gin.Context) {
+	token := ""
+	if scheme, value, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(value)
+	}
+	if err := h.scimService.Authenticate(token); err != nil {
+		if infraerrors.Code(err) == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+		}
+		scimError(c, err)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// ServiceProviderConfig GET /scim/v2/ServiceProviderConfig
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{service.SCIMSchemaServiceProviderConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": 500},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Static bearer token configured as scim.bearer_token",
+			"primary":     true,
+		}},
+		"meta": gin.H{
+			"resourceType": "ServiceProviderConfig",
+			"location":     scimBaseURL(c) + "/ServiceProviderConfig",
+		},
+	})
+}
+
+// ResourceTypes GET /scim/v2/ResourceTypes
+func (h *SCIMHandler) ResourceTypes(c *gin.Context) {
+	base := scimBaseURL(c)
+	types := []any{
+		gin.H{
+			"schemas":  []string{service.SCIMSchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   service.SCIMSchemaUser,
+			"meta":     gin.H{"resourceType": "ResourceType", "location": base + "/ResourceTypes/User"},
+		},
+		gin.H{
+			"schemas":  []string{service.SCIMSchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   service.SCIMSchemaGroup,
+			"meta":     gin.H{"resourceType": "ResourceType", "location": base + "/ResourceTypes/Group"},
+		},
+	}
+	scimJSON(c, http.StatusOK, &service.SCIMListResponse{
+		Schemas:      []string{service.SCIMSchemaListResponse},
+		TotalResults: len(types),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+// ListUsers GET /scim/v2/Users?filter=userName eq "a@b.com"&startIndex=1&count=100
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	resp, err := h.scimService.ListUsers(c.Request.Context(), scimListQuery(c))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMListLocations(c, resp))
+}
+
+// GetUser GET /scim/v2/Users/:id
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.scimService.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMUserLocation(c, user))
+}
+
+// CreateUser POST /scim/v2/Users
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var in service.SCIMUserInput
+	if !bindSCIM(c, &in) {
+		return
+	}
+	user, err := h.scimService.CreateUser(c.Request.Context(), &in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	user = withSCIMUserLocation(c, user)
+	c.Header("Location", user.Meta.Location)
+	scimJSON(c, http.StatusCreated, user)
+}
+
+// ReplaceUser PUT /scim/v2/Users/:id
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	var in service.SCIMUserInput
+	if !bindSCIM(c, &in) {
+		return
+	}
+	user, err := h.scimService.ReplaceUser(c.Request.Context(), c.Param("id"), &in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMUserLocation(c, user))
+}
+
+// PatchUser PATCH /scim/v2/Users/:id
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+	user, err := h.scimService.PatchUser(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMUserLocation(c, user))
+}
+
+// DeleteUser DELETE /scim/v2/Users/:id（停用而非物理删除）
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.scimService.DeleteUser(c.Request.Context(), c.Param("id")); err != nil {
+		scimError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups GET /scim/v2/Groups
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	resp, err := h.scimService.ListGroups(c.Request.Context(), scimListQuery(c))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMListLocations(c, resp))
+}
+
+// GetGroup GET /scim/v2/Groups/:id
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.scimService.GetGroup(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMGroupLocation(c, group))
+}
+
+// CreateGroup POST /scim/v2/Groups
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	var in service.SCIMGroupInput
+	if !bindSCIM(c, &in) {
+		return
+	}
+	group, err := h.scimService.CreateGroup(c.Request.Context(), &in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	group = withSCIMGroupLocation(c, group)
+	c.Header("Location", group.Meta.Location)
+	scimJSON(c, http.StatusCreated, group)
+}
+
+// ReplaceGroup PUT /scim/v2/Groups/:id
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	var in service.SCIMGroupInput
+	if !bindSCIM(c, &in) {
+		return
+	}
+	group, err := h.scimService.ReplaceGroup(c.Request.Context(), c.Param("id"), &in)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMGroupLocation(c, group))
+}
+
+// PatchGroup PATCH /scim/v2/Groups/:id
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+	group, err := h.scimService.PatchGroup(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, withSCIMGroupLocation(c, group))
+}
+
+// DeleteGroup DELETE /scim/v2/Groups/:id（撤销全部成员的分组权限，分组保留）
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	if err := h.scimService.DeleteGroup(c.Request.Context(), c.Param("id")); err != nil {
+		scimError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func scimJSON(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", scimContentType+"; charset=utf-8")
+	c.JSON(status, body)
+}
+
+// scimError 输出 RFC 7644 §3.12 错误体；非业务错误统一按 500 处理且不暴露细节
+func scimError(c *gin.Context, err error) {
+	status := infraerrors.Code(err)
+	detail := infraerrors.Message(err)
+	if status >= http.StatusInternalServerError {
+		logger.LegacyPrintf("handler.scim", "[SCIM] %s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+		status = http.StatusInternalServerError
+		detail = "internal error"
+	}
+	body := gin.H{
+		"schemas": []string{service.SCIMSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType, ok := scimErrorTypes[infraerrors.Reason(err)]; ok {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+func bindSCIM(c *gin.Context, dst any) bool {
+	if err := c.ShouldBindJSON(dst); err != nil {
+		scimError(c, infraerrors.BadRequest(service.ErrSCIMInvalidSyntax.Reason, "invalid JSON body: "+err.Error()))
+		return false
+	}
+	return true
+}
+
+func scimListQuery(c *gin.Context) service.SCIMListQuery {
+	q := service.SCIMListQuery{Filter: c.Query("filter")}
+	q.StartIndex, _ = strconv.Atoi(c.Query("startIndex"))
+	q.Count, _ = strconv.Atoi(c.Query("count"))
+	return q
+}
+
+func scimBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if isRequestHTTPS(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + scimBasePath
+}
+
+func withSCIMUserLocation(c *gin.Context, user *service.SCIMUser) *service.SCIMUser {
+	user.Meta.Location = scimBaseURL(c) + "/Users/" + user.ID
+	return user
+}
+
+func withSCIMGroupLocation(c *gin.Context, group *service.SCIMGroup) *service.SCIMGroup {
+	group.Meta.Location = scimBaseURL(c) + "/Groups/" + group.ID
+	return group
+}
+
+func withSCIMListLocations(c *gin.Context, resp *service.SCIMListResponse) *service.SCIMListResponse {
+	for _, res := range resp.Resources {
+		switch v := res.(type) {
+		case *service.SCIMUser:
+			withSCIMUserLocation(c, v)
+		case *service.SCIMGroup:
+			withSCIMGroupLocation(c, v)
+		}
+	}
+	return resp
+}
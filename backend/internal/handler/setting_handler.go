@@ -58,6 +58,11 @@ func (h *SettingHandler) GetPublicSettings(c *gin.Context) {
 		LinuxDoOAuthEnabled:              settings.LinuxDoOAuthEnabled,
 		OIDCOAuthEnabled:                 settings.OIDCOAuthEnabled,
 		OIDCOAuthProviderName:            settings.OIDCOAuthProviderName,
+		LDAPLoginEnabled:                 settings.LDAPLoginEnabled,
+		LDAPProviderName:                 settings.LDAPProviderName,
+		SAMLLoginEnabled:                 settings.SAMLLoginEnabled,
+		SAMLProviderName:                 settings.SAMLProviderName,
+		PasskeyLoginEnabled:              settings.PasskeyLoginEnabled,
 		BackendModeEnabled:               settings.BackendModeEnabled,
 		PaymentEnabled:                   settings.PaymentEnabled,
 		Version:                          h.version,
@@ -3,6 +3,7 @@ package handler
 import (
 	"github.com/gin-gonic/gin"
 
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/response"
 	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
 	"github.com/Wei-Shaw/sub2api/internal/service"
@@ -10,13 +11,19 @@ import (
 
 // TotpHandler handles TOTP-related requests
 type TotpHandler struct {
-	totpService *service.TotpService
+	totpService   *service.TotpService
+	userService   *service.UserService
+	twoFactor     *service.TwoFactorService
+	recoveryCodes *service.RecoveryCodeService
 }
 
 // NewTotpHandler creates a new TotpHandler
-func NewTotpHandler(totpService *service.TotpService) *TotpHandler {
+func NewTotpHandler(totpService *service.TotpService, userService *service.UserService, twoFactor *service.TwoFactorService, recoveryCodes *service.RecoveryCodeService) *TotpHandler {
 	return &TotpHandler{
-		totpService: totpService,
+		totpService:   totpService,
+		userService:   userService,
+		twoFactor:     twoFactor,
+		recoveryCodes: recoveryCodes,
 	}
 }
 
@@ -124,7 +131,13 @@ func (h *TotpHandler) Enable(c *gin.Context) {
 		return
 	}
 
-	response.Success(c, gin.H{"success": true})
+	// 首次启用第二因素时发放恢复码（明文仅返回这一次）
+	codes, err := h.recoveryCodes.IssueInitial(c.Request.Context(), subject.UserID)
+	if err != nil {
+		logger.LegacyPrintf("handler.totp", "[TOTP] issue recovery codes for user %d failed: %v", subject.UserID, err)
+	}
+
+	response.Success(c, gin.H{"success": true, "recovery_codes": codes})
 }
 
 // TotpDisableRequest represents the request to disable TOTP
@@ -152,6 +165,7 @@ func (h *TotpHandler) Disable(c *gin.Context) {
 		response.ErrorFrom(c, err)
 		return
 	}
+	reconcileRecoveryCodes(c, h.userService, h.twoFactor, subject.UserID)
 
 	response.Success(c, gin.H{"success": true})
 }
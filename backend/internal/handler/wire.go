@@ -35,6 +35,11 @@ func ProvideAdminHandlers(
 	scheduledTestHandler *admin.ScheduledTestHandler,
 	channelHandler *admin.ChannelHandler,
 	paymentHandler *admin.PaymentHandler,
+	referralHandler *admin.ReferralHandler,
+	shadowHandler *admin.ShadowHandler,
+	configHandler *admin.ConfigHandler,
+	promptCacheHandler *admin.PromptCacheHandler,
+	contextPolicyHandler *admin.ContextPolicyHandler,
 ) *AdminHandlers {
 	return &AdminHandlers{
 		Dashboard:             dashboardHandler,
@@ -63,6 +68,11 @@ func ProvideAdminHandlers(
 		ScheduledTest:         scheduledTestHandler,
 		Channel:               channelHandler,
 		Payment:               paymentHandler,
+		Referral:              referralHandler,
+		Shadow:                shadowHandler,
+		Config:                configHandler,
+		PromptCache:           promptCacheHandler,
+		ContextPolicy:         contextPolicyHandler,
 	}
 }
 
@@ -90,8 +100,15 @@ func ProvideHandlers(
 	openaiGatewayHandler *OpenAIGatewayHandler,
 	settingHandler *SettingHandler,
 	totpHandler *TotpHandler,
+	passkeyHandler *PasskeyHandler,
 	paymentHandler *PaymentHandler,
 	paymentWebhookHandler *PaymentWebhookHandler,
+	referralHandler *ReferralHandler,
+	budgetHandler *BudgetHandler,
+	privacyHandler *PrivacyHandler,
+	modelCatalogHandler *ModelCatalogHandler,
+	oauthServerHandler *OAuthServerHandler,
+	scimHandler *SCIMHandler,
 	_ *service.IdempotencyCoordinator,
 	_ *service.IdempotencyCleanupService,
 ) *Handlers {
@@ -108,8 +125,15 @@ func ProvideHandlers(
 		OpenAIGateway:  openaiGatewayHandler,
 		Setting:        settingHandler,
 		Totp:           totpHandler,
+		Passkey:        passkeyHandler,
 		Payment:        paymentHandler,
 		PaymentWebhook: paymentWebhookHandler,
+		Referral:       referralHandler,
+		Budget:         budgetHandler,
+		Privacy:        privacyHandler,
+		ModelCatalog:   modelCatalogHandler,
+		OAuthServer:    oauthServerHandler,
+		SCIM:           scimHandler,
 	}
 }
 
@@ -126,9 +150,16 @@ var ProviderSet = wire.NewSet(
 	NewGatewayHandler,
 	NewOpenAIGatewayHandler,
 	NewTotpHandler,
+	NewPasskeyHandler,
 	ProvideSettingHandler,
 	NewPaymentHandler,
 	NewPaymentWebhookHandler,
+	NewReferralHandler,
+	NewBudgetHandler,
+	NewPrivacyHandler,
+	NewModelCatalogHandler,
+	NewOAuthServerHandler,
+	NewSCIMHandler,
 
 	// Admin handlers
 	admin.NewDashboardHandler,
@@ -157,6 +188,11 @@ var ProviderSet = wire.NewSet(
 	admin.NewScheduledTestHandler,
 	admin.NewChannelHandler,
 	admin.NewPaymentHandler,
+	admin.NewReferralHandler,
+	admin.NewShadowHandler,
+	admin.NewConfigHandler,
+	admin.NewPromptCacheHandler,
+	admin.NewContextPolicyHandler,
 
 	// AdminHandlers and Handlers constructors
 	ProvideAdminHandlers,
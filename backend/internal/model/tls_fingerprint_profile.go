@@ -52,3 +52,21 @@ func (p *TLSFingerprintProfile) ToTLSProfile() *tlsfingerprint.Profile {
 		Extensions:          p.Extensions,
 	}
 }
+
+// ApplyTLSProfile 用运行时 Profile（例如从 JA3/JA4 或抓取的 ClientHello 导入）覆盖 ClientHello 参数字段
+// 名称、描述、ID 等元数据保持不变
+func (p *TLSFingerprintProfile) ApplyTLSProfile(tp *tlsfingerprint.Profile) {
+	if tp == nil {
+		return
+	}
+	p.EnableGREASE = tp.EnableGREASE
+	p.CipherSuites = tp.CipherSuites
+	p.Curves = tp.Curves
+	p.PointFormats = tp.PointFormats
+	p.SignatureAlgorithms = tp.SignatureAlgorithms
+	p.ALPNProtocols = tp.ALPNProtocols
+	p.SupportedVersions = tp.SupportedVersions
+	p.KeyShareGroups = tp.KeyShareGroups
+	p.PSKModes = tp.PSKModes
+	p.Extensions = tp.Extensions
+}
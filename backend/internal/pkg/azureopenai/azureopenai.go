@@ -0,0 +1,142 @@
+// Package azureopenai provides Azure OpenAI helpers: resource endpoint URLs,
+// api-version handling, Entra ID client-credential token requests and
+// content-filter error parsing.
+package azureopenai
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// DefaultAPIVersion 未配置 api_version 时使用的版本（支持 Responses API 的最早稳定预览版）
+	DefaultAPIVersion = "2025-04-01-preview"
+	// APIVersionV1 Azure OpenAI v1 API：路径为 /openai/v1/...，无需 api-version 查询参数
+	APIVersionV1 = "v1"
+
+	// EntraScope Entra ID 客户端凭据换取 Azure OpenAI access token 的 scope
+	EntraScope = "https://cognitiveservices.azure.com/.default"
+	// DefaultAuthorityHost Entra ID 登录端点
+	DefaultAuthorityHost = "https://login.microsoftonline.com"
+
+	// ContentFilterCode Azure 内容过滤错误码
+	ContentFilterCode = "content_filter"
+)
+
+// TokenResponse is the Entra ID token endpoint response.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// EntraTokenURL returns the OAuth2 v2.0 token endpoint for a tenant.
+func EntraTokenURL(tenantID string) (string, error) {
+	tenantID = strings.TrimSpace(tenantID)
+	if tenantID == "" {
+		return "", errors.New("azureopenai: tenant_id is empty")
+	}
+	// tenant_id 仅允许 GUID / 域名字符，避免拼接出任意路径
+	for _, r := range tenantID {
+		if !(r == '-' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
+			return "", fmt.Errorf("azureopenai: invalid tenant_id %q", tenantID)
+		}
+	}
+	return DefaultAuthorityHost + "/" + tenantID + "/oauth2/v2.0/token", nil
+}
+
+func isV1(apiVersion string) bool {
+	return strings.EqualFold(strings.TrimSpace(apiVersion), APIVersionV1)
+}
+
+// ResponsesURL returns the Responses API endpoint (without api-version query)
+// for a resource endpoint such as https://my-resource.openai.azure.com.
+func ResponsesURL(endpoint, apiVersion string) string {
+	base := strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if isV1(apiVersion) {
+		return base + "/openai/v1/responses"
+	}
+	return base + "/openai/responses"
+}
+
+// ChatCompletionsURL returns the Chat Completions endpoint (without api-version query).
+// Legacy api-versions address the deployment in the path; the v1 API takes it as body model.
+func ChatCompletionsURL(endpoint, deployment, apiVersion string) string {
+	base := strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if isV1(apiVersion) {
+		return base + "/openai/v1/chat/completions"
+	}
+	return base + "/openai/deployments/" + url.PathEscape(deployment) + "/chat/completions"
+}
+
+// WithAPIVersion appends the api-version query parameter unless the v1 API is used.
+func WithAPIVersion(rawURL, apiVersion string) string {
+	apiVersion = strings.TrimSpace(apiVersion)
+	if apiVersion == "" {
+		apiVersion = DefaultAPIVersion
+	}
+	if isV1(apiVersion) {
+		return rawURL
+	}
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	return rawURL + sep + "api-version=" + url.QueryEscape(apiVersion)
+}
+
+// ContentFilterError describes a request or response blocked by Azure content filtering.
+type ContentFilterError struct {
+	Message string
+	// Categories lists filter categories that triggered, e.g. hate, violence, jailbreak.
+	Categories []string
+}
+
+// ParseContentFilterError detects an Azure content-filter error body:
+//
+//	{"error":{"code":"content_filter","message":"...","innererror":{"code":"ResponsibleAIPolicyViolation",
+//	  "content_filter_result":{"hate":{"filtered":true,"severity":"high"},...}}}}
+func ParseContentFilterError(body []byte) (*ContentFilterError, bool) {
+	if len(body) == 0 {
+		return nil, false
+	}
+	errObj := gjson.GetBytes(body, "error")
+	if !errObj.Exists() {
+		return nil, false
+	}
+	code := errObj.Get("code").String()
+	innerCode := errObj.Get("innererror.code").String()
+	if code != ContentFilterCode && innerCode != "ResponsibleAIPolicyViolation" {
+		return nil, false
+	}
+
+	cf := &ContentFilterError{Message: strings.TrimSpace(errObj.Get("message").String())}
+	results := errObj.Get("innererror.content_filter_result")
+	if !results.Exists() {
+		results = errObj.Get("content_filter_result")
+	}
+	results.ForEach(func(key, value gjson.Result) bool {
+		if value.Get("filtered").Bool() {
+			cf.Categories = append(cf.Categories, key.String())
+		}
+		return true
+	})
+	sort.Strings(cf.Categories)
+	if cf.Message == "" {
+		cf.Message = "The request was filtered by Azure OpenAI content management policy"
+	}
+	return cf, true
+}
+
+// Error returns the message annotated with the triggered categories.
+func (e *ContentFilterError) Error() string {
+	if len(e.Categories) == 0 {
+		return e.Message
+	}
+	return e.Message + " (filtered: " + strings.Join(e.Categories, ", ") + ")"
+}
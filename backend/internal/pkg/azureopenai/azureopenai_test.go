@@ -0,0 +1,45 @@
+package azureopenai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLs(t *testing.T) {
+	endpoint := "https://res.openai.azure.com/"
+
+	require.Equal(t, "https://res.openai.azure.com/openai/responses", ResponsesURL(endpoint, "2025-04-01-preview"))
+	require.Equal(t, "https://res.openai.azure.com/openai/v1/responses", ResponsesURL(endpoint, "v1"))
+	require.Equal(t, "https://res.openai.azure.com/openai/deployments/gpt-4o%2Fprod/chat/completions",
+		ChatCompletionsURL(endpoint, "gpt-4o/prod", "2024-10-21"))
+	require.Equal(t, "https://res.openai.azure.com/openai/v1/chat/completions", ChatCompletionsURL(endpoint, "gpt-4o", "V1"))
+
+	require.Equal(t, "https://x/openai/responses?api-version=2025-04-01-preview", WithAPIVersion("https://x/openai/responses", ""))
+	require.Equal(t, "https://x/openai/responses/compact?a=b&api-version=2024-10-21", WithAPIVersion("https://x/openai/responses/compact?a=b", "2024-10-21"))
+	require.Equal(t, "https://x/openai/v1/responses", WithAPIVersion("https://x/openai/v1/responses", "v1"))
+}
+
+func TestEntraTokenURL(t *testing.T) {
+	u, err := EntraTokenURL("72f988bf-86f1-41af-91ab-2d7cd011db47")
+	require.NoError(t, err)
+	require.Equal(t, "https://login.microsoftonline.com/72f988bf-86f1-41af-91ab-2d7cd011db47/oauth2/v2.0/token", u)
+
+	_, err = EntraTokenURL("")
+	require.Error(t, err)
+	_, err = EntraTokenURL("evil/../path")
+	require.Error(t, err)
+}
+
+func TestParseContentFilterError(t *testing.T) {
+	body := []byte(`{"error":{"message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy.","type":null,"param":"prompt","code":"content_filter","status":400,"innererror":{"code":"ResponsibleAIPolicyViolation","content_filter_result":{"hate":{"filtered":false,"severity":"safe"},"violence":{"filtered":true,"severity":"high"},"jailbreak":{"filtered":true,"detected":true}}}}}`)
+	cf, ok := ParseContentFilterError(body)
+	require.True(t, ok)
+	require.Equal(t, []string{"jailbreak", "violence"}, cf.Categories)
+	require.Contains(t, cf.Error(), "(filtered: jailbreak, violence)")
+
+	_, ok = ParseContentFilterError([]byte(`{"error":{"code":"rate_limit_exceeded","message":"slow down"}}`))
+	require.False(t, ok)
+	_, ok = ParseContentFilterError([]byte(`not json`))
+	require.False(t, ok)
+}
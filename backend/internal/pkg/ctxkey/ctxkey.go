@@ -55,4 +55,11 @@ const (
 
 	// ClaudeCodeVersion stores the extracted Claude Code version from User-Agent (e.g. "2.1.22")
 	ClaudeCodeVersion Key = "ctx_claude_code_version"
+
+	// ServerToolLoopHop 标识当前转发是服务端工具（web_search / web_fetch）循环中的一次上游调用，
+	// 防止 Forward 再次进入模拟逻辑造成递归。
+	ServerToolLoopHop Key = "ctx_server_tool_loop_hop"
+
+	// RequestPriority 当前请求所属 API Key 的优先级分道状态（*service.requestPriorityState）
+	RequestPriority Key = "ctx_request_priority"
 )
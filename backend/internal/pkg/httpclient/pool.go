@@ -16,11 +16,14 @@
 package httpclient
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/pkg/proxyurl"
@@ -57,7 +60,11 @@ type Options struct {
 var sharedClients sync.Map
 
 // 允许测试替换校验函数，生产默认指向真实实现。
-var validateResolvedIP = urlvalidator.ValidateResolvedIP
+var (
+	validateResolvedIP = urlvalidator.ValidateResolvedIP
+	validateDialIP     = urlvalidator.ValidateIP
+	lookupIPAddr       = net.DefaultResolver.LookupIPAddr
+)
 
 // GetClient 返回共享的 HTTP 客户端实例
 // 性能优化：相同配置复用同一客户端，避免重复创建 Transport
@@ -109,10 +116,9 @@ func buildTransport(opts Options) (*http.Transport, error) {
 		maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
 	}
 
+	dialer := &net.Dialer{Timeout: defaultDialTimeout}
 	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: defaultDialTimeout,
-		}).DialContext,
+		DialContext:           dialer.DialContext,
 		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
 		MaxIdleConns:          maxIdleConns,
 		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
@@ -131,6 +137,11 @@ func buildTransport(opts Options) (*http.Transport, error) {
 		return nil, err
 	}
 	if parsed == nil {
+		if opts.ValidateResolvedIP && !opts.AllowPrivateHosts {
+			// 直连时在拨号阶段重新解析并校验实际连接的 IP（含重定向后的新连接），
+			// RoundTrip 前的预校验与拨号各自解析一次，仅靠预校验会被 DNS Rebinding 绕过
+			transport.DialContext = validatedDialContext(dialer)
+		}
 		return transport, nil
 	}
 
@@ -155,6 +166,58 @@ func buildClientKey(opts Options) string {
 	)
 }
 
+// validatedDialContext 解析目标主机并只连接通过校验的地址；dialer.Control 再校验一次实际连接的 IP
+func validatedDialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := *dialer
+	d.Control = func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("dial address %s is not an ip", address)
+		}
+		return validateDialIP(ip)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else {
+			addrs, err := lookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, fmt.Errorf("dns resolution failed: %w", err)
+			}
+			for _, a := range addrs {
+				ips = append(ips, a.IP)
+			}
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("dns resolution failed: no addresses for %s", host)
+		}
+		// 任一解析结果不安全即拒绝，与 ValidateResolvedIP 的语义一致
+		for _, ip := range ips {
+			if err := validateDialIP(ip); err != nil {
+				return nil, err
+			}
+		}
+		var errs []error
+		for _, ip := range ips {
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
 type validatedTransport struct {
 	base           http.RoundTripper
 	validatedHosts sync.Map // map[string]time.Time, value 为过期时间
@@ -1,9 +1,13 @@
 package httpclient
 
 import (
+	"context"
 	"errors"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -113,3 +117,74 @@ func TestValidatedTransport_ValidationErrorStopsRoundTrip(t *testing.T) {
 	require.ErrorIs(t, err, expectedErr)
 	require.Equal(t, int32(0), atomic.LoadInt32(&baseCalls))
 }
+
+// stubDNS 模拟 DNS Rebinding：预校验看到公网地址，拨号时的解析结果由 addrs 决定
+func stubDNS(t *testing.T, addrs map[string]string) {
+	t.Helper()
+	originalValidate, originalLookup := validateResolvedIP, lookupIPAddr
+	t.Cleanup(func() { validateResolvedIP, lookupIPAddr = originalValidate, originalLookup })
+	validateResolvedIP = func(string) error { return nil }
+	lookupIPAddr = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		ip, ok := addrs[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+	}
+}
+
+func TestValidatedClient_RejectsRebindingAtDial(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer srv.Close()
+	stubDNS(t, map[string]string{"rebind.example": "127.0.0.1"})
+
+	client, err := buildClient(Options{ValidateResolvedIP: true})
+	require.NoError(t, err)
+	u, _ := url.Parse(srv.URL)
+	_, err = client.Get("http://rebind.example:" + u.Port() + "/")
+	require.ErrorContains(t, err, "resolved ip 127.0.0.1 is not allowed")
+	require.Equal(t, int32(0), atomic.LoadInt32(&hits))
+}
+
+func TestValidatedClient_RejectsRebindingOnRedirect(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, _ := url.Parse(srv.URL)
+		http.Redirect(w, r, "http://internal.example:"+u.Port()+"/admin", http.StatusFound)
+	}))
+	defer srv.Close()
+	stubDNS(t, map[string]string{"public.example": "127.0.0.1", "internal.example": "127.0.0.2"})
+
+	// 测试服务器只能监听回环地址，这里把 127.0.0.1 视为“公网”，其余仍走真实校验
+	originalDialIP := validateDialIP
+	t.Cleanup(func() { validateDialIP = originalDialIP })
+	validateDialIP = func(ip net.IP) error {
+		if ip.Equal(net.ParseIP("127.0.0.1")) {
+			return nil
+		}
+		return originalDialIP(ip)
+	}
+
+	client, err := buildClient(Options{ValidateResolvedIP: true})
+	require.NoError(t, err)
+	u, _ := url.Parse(srv.URL)
+	_, err = client.Get("http://public.example:" + u.Port() + "/")
+	require.ErrorContains(t, err, "resolved ip 127.0.0.2 is not allowed")
+}
+
+func TestValidatedClient_AllowPrivateSkipsDialValidation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client, err := buildClient(Options{ValidateResolvedIP: true, AllowPrivateHosts: true})
+	require.NoError(t, err)
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
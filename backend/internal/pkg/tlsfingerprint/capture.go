@@ -0,0 +1,237 @@
+package tlsfingerprint
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxClientHelloSize    = 64 << 10
+	captureConnTimeout    = 10 * time.Second
+	captureCertCommonName = "sub2api-tls-capture"
+)
+
+// ErrCaptureTimeout is returned when no ClientHello was received before the capture deadline.
+var ErrCaptureTimeout = errors.New("tlsfingerprint: capture timed out before a ClientHello was received")
+
+// CaptureServer is a one-shot TLS listener that records the first ClientHello it receives.
+// Point any client (curl, Node.js, a CLI) at https://<Addr>/ and the handshake is recorded;
+// the client gets back its JA3/JA4 as JSON (using a self-signed certificate, so the client
+// must skip verification — the ClientHello is recorded even if it aborts the handshake).
+type CaptureServer struct {
+	ln      net.Listener
+	tlsConf *tls.Config
+	done    chan struct{}
+	once    sync.Once
+
+	mu     sync.Mutex
+	hello  *ClientHello
+	raw    []byte
+	remote string
+	err    error
+}
+
+// StartCapture listens on addr (e.g. "127.0.0.1:0") and waits up to timeout for a ClientHello.
+func StartCapture(addr string, timeout time.Duration) (*CaptureServer, error) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("tlsfingerprint: listen %s: %w", addr, err)
+	}
+	s := &CaptureServer{
+		ln: ln,
+		tlsConf: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"http/1.1"},
+		},
+		done: make(chan struct{}),
+	}
+	go s.serve()
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { s.finish(nil, nil, "", ErrCaptureTimeout) })
+		go func() {
+			<-s.done
+			timer.Stop()
+		}()
+	}
+	return s, nil
+}
+
+// Addr returns the listener address.
+func (s *CaptureServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Done is closed once the capture finished (success, timeout or Close).
+func (s *CaptureServer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Result returns the captured ClientHello, its raw bytes and the client address.
+// It returns (nil, nil, "", nil) while the capture is still pending.
+func (s *CaptureServer) Result() (*ClientHello, []byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hello, s.raw, s.remote, s.err
+}
+
+// Wait blocks until the capture finishes or ctx is done.
+func (s *CaptureServer) Wait(ctx context.Context) (*ClientHello, error) {
+	select {
+	case <-s.done:
+		hello, _, _, err := s.Result()
+		return hello, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the capture. Pending Wait calls return net.ErrClosed.
+func (s *CaptureServer) Close() error {
+	s.finish(nil, nil, "", net.ErrClosed)
+	return nil
+}
+
+func (s *CaptureServer) finish(hello *ClientHello, raw []byte, remote string, err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.hello, s.raw, s.remote, s.err = hello, raw, remote, err
+		s.mu.Unlock()
+		_ = s.ln.Close()
+		close(s.done)
+	})
+}
+
+func (s *CaptureServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return // listener closed by finish
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *CaptureServer) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(captureConnTimeout))
+
+	raw, err := readClientHelloRecords(conn)
+	if err != nil {
+		return // not TLS (port scan, plain HTTP) — keep waiting for a real client
+	}
+	hello, err := ParseClientHello(raw)
+	if err != nil {
+		return
+	}
+	s.finish(hello, raw, conn.RemoteAddr().String(), nil)
+
+	// Complete the handshake so well-behaved clients get a response instead of a reset.
+	tlsConn := tls.Server(&replayConn{Conn: conn, prefix: bytes.NewReader(raw)}, s.tlsConf)
+	if err := tlsConn.Handshake(); err != nil {
+		return
+	}
+	if _, err := http.ReadRequest(bufio.NewReader(tlsConn)); err != nil {
+		return
+	}
+	body, _ := json.Marshal(FingerprintOf(hello))
+	_, _ = fmt.Fprintf(tlsConn, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+	_ = tlsConn.Close()
+}
+
+// readClientHelloRecords reads TLS handshake records until the first handshake message is complete.
+func readClientHelloRecords(r io.Reader) ([]byte, error) {
+	var raw []byte
+	msgLen := -1
+	body := 0
+	for {
+		var hdr [tlsRecordHeaderLen]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, err
+		}
+		if hdr[0] != tlsRecordTypeHandshake {
+			return nil, ErrNotClientHello
+		}
+		n := int(binary.BigEndian.Uint16(hdr[3:5]))
+		if len(raw)+tlsRecordHeaderLen+n > maxClientHelloSize {
+			return nil, fmt.Errorf("tlsfingerprint: ClientHello exceeds %d bytes", maxClientHelloSize)
+		}
+		frag := make([]byte, n)
+		if _, err := io.ReadFull(r, frag); err != nil {
+			return nil, err
+		}
+		raw = append(raw, hdr[:]...)
+		raw = append(raw, frag...)
+		body += n
+		if msgLen < 0 && body >= 4 {
+			msg := raw[tlsRecordHeaderLen:]
+			if msg[0] != tlsHandshakeClientHello {
+				return nil, ErrNotClientHello
+			}
+			msgLen = int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+		}
+		if msgLen >= 0 && body >= msgLen+4 {
+			return raw, nil
+		}
+	}
+}
+
+// replayConn replays already-consumed bytes before reading from the underlying connection.
+type replayConn struct {
+	net.Conn
+	prefix *bytes.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	if c.prefix.Len() > 0 {
+		return c.prefix.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tlsfingerprint: generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tlsfingerprint: generate serial: %w", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: captureCertCommonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("tlsfingerprint: create certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,440 @@
+package tlsfingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// TLS extension type IDs referenced when parsing and fingerprinting ClientHellos.
+const (
+	extServerName          uint16 = 0
+	extSupportedGroups     uint16 = 10
+	extECPointFormats      uint16 = 11
+	extSignatureAlgorithms uint16 = 13
+	extALPN                uint16 = 16
+	extSupportedVersions   uint16 = 43
+	extPSKModes            uint16 = 45
+	extKeyShare            uint16 = 51
+)
+
+const (
+	tlsRecordTypeHandshake  = 0x16
+	tlsHandshakeClientHello = 0x01
+	tlsRecordHeaderLen      = 5
+)
+
+// ErrNotClientHello is returned when the input is not a TLS ClientHello.
+var ErrNotClientHello = errors.New("tlsfingerprint: input is not a TLS ClientHello")
+
+// ClientHello is the fingerprint-relevant content of a TLS ClientHello.
+// Lists keep wire order and may contain GREASE values (as sent by the client).
+type ClientHello struct {
+	LegacyVersion       uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	ServerName          string
+	Curves              []uint16
+	PointFormats        []uint16
+	SignatureAlgorithms []uint16
+	ALPNProtocols       []string
+	SupportedVersions   []uint16
+	KeyShareGroups      []uint16
+	PSKModes            []uint16
+}
+
+// ParseClientHello parses a raw ClientHello. data may be one or more TLS records
+// (starting with 0x16) or a bare handshake message (starting with 0x01).
+func ParseClientHello(data []byte) (*ClientHello, error) {
+	if len(data) == 0 {
+		return nil, ErrNotClientHello
+	}
+	msg := data
+	if data[0] == tlsRecordTypeHandshake {
+		var err error
+		if msg, err = reassembleHandshake(data); err != nil {
+			return nil, err
+		}
+	}
+	if len(msg) < 4 || msg[0] != tlsHandshakeClientHello {
+		return nil, ErrNotClientHello
+	}
+	length := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+	if len(msg)-4 < length {
+		return nil, fmt.Errorf("tlsfingerprint: truncated ClientHello (want %d bytes, have %d)", length, len(msg)-4)
+	}
+	return parseClientHelloBody(msg[4 : 4+length])
+}
+
+// reassembleHandshake concatenates handshake record fragments until the first
+// handshake message is complete.
+func reassembleHandshake(data []byte) ([]byte, error) {
+	var msg []byte
+	for len(data) > 0 {
+		if len(data) < tlsRecordHeaderLen || data[0] != tlsRecordTypeHandshake {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < tlsRecordHeaderLen+n {
+			return nil, fmt.Errorf("tlsfingerprint: truncated TLS record")
+		}
+		msg = append(msg, data[tlsRecordHeaderLen:tlsRecordHeaderLen+n]...)
+		data = data[tlsRecordHeaderLen+n:]
+		if len(msg) >= 4 {
+			want := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+			if len(msg)-4 >= want {
+				break
+			}
+		}
+	}
+	if len(msg) == 0 {
+		return nil, ErrNotClientHello
+	}
+	return msg, nil
+}
+
+// byteReader is a minimal bounds-checked reader over a byte slice.
+type byteReader struct {
+	b   []byte
+	err error
+}
+
+func (r *byteReader) fail() {
+	if r.err == nil {
+		r.err = fmt.Errorf("tlsfingerprint: malformed ClientHello")
+	}
+	r.b = nil
+}
+
+func (r *byteReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.fail()
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *byteReader) u8() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (r *byteReader) u16() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (r *byteReader) u16List(n int) []uint16 {
+	b := r.bytes(n)
+	if b == nil || n%2 != 0 {
+		r.fail()
+		return nil
+	}
+	out := make([]uint16, 0, n/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		out = append(out, binary.BigEndian.Uint16(b[i:]))
+	}
+	return out
+}
+
+func (r *byteReader) u8List(n int) []uint16 {
+	b := r.bytes(n)
+	out := make([]uint16, 0, len(b))
+	for _, v := range b {
+		out = append(out, uint16(v))
+	}
+	return out
+}
+
+func parseClientHelloBody(body []byte) (*ClientHello, error) {
+	r := &byteReader{b: body}
+	ch := &ClientHello{LegacyVersion: uint16(r.u16())}
+	r.bytes(32)     // random
+	r.bytes(r.u8()) // legacy_session_id
+	ch.CipherSuites = r.u16List(r.u16())
+	r.bytes(r.u8()) // legacy_compression_methods
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.b) == 0 {
+		return ch, nil // no extensions (SSLv3-style hello)
+	}
+
+	exts := &byteReader{b: r.bytes(r.u16())}
+	for r.err == nil && exts.err == nil && len(exts.b) > 0 {
+		typ := uint16(exts.u16())
+		data := exts.bytes(exts.u16())
+		if exts.err != nil {
+			break
+		}
+		ch.Extensions = append(ch.Extensions, typ)
+		if err := ch.parseExtension(typ, data); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if exts.err != nil {
+		return nil, exts.err
+	}
+	return ch, nil
+}
+
+func (ch *ClientHello) parseExtension(typ uint16, data []byte) error {
+	r := &byteReader{b: data}
+	switch typ {
+	case extServerName:
+		list := &byteReader{b: r.bytes(r.u16())}
+		for list.err == nil && len(list.b) > 0 {
+			nameType := list.u8()
+			name := list.bytes(list.u16())
+			if nameType == 0 && ch.ServerName == "" {
+				ch.ServerName = string(name)
+			}
+		}
+		r.err = errors.Join(r.err, list.err)
+	case extSupportedGroups:
+		ch.Curves = r.u16List(r.u16())
+	case extECPointFormats:
+		ch.PointFormats = r.u8List(r.u8())
+	case extSignatureAlgorithms:
+		ch.SignatureAlgorithms = r.u16List(r.u16())
+	case extALPN:
+		list := &byteReader{b: r.bytes(r.u16())}
+		for list.err == nil && len(list.b) > 0 {
+			ch.ALPNProtocols = append(ch.ALPNProtocols, string(list.bytes(list.u8())))
+		}
+		r.err = errors.Join(r.err, list.err)
+	case extSupportedVersions:
+		ch.SupportedVersions = r.u16List(r.u8())
+	case extPSKModes:
+		ch.PSKModes = r.u8List(r.u8())
+	case extKeyShare:
+		list := &byteReader{b: r.bytes(r.u16())}
+		for list.err == nil && len(list.b) > 0 {
+			group := uint16(list.u16())
+			list.bytes(list.u16())
+			ch.KeyShareGroups = append(ch.KeyShareGroups, group)
+		}
+		r.err = errors.Join(r.err, list.err)
+	}
+	if r.err != nil {
+		return fmt.Errorf("tlsfingerprint: malformed extension %d: %w", typ, r.err)
+	}
+	return nil
+}
+
+// HasGREASE reports whether the ClientHello contains any GREASE value.
+func (ch *ClientHello) HasGREASE() bool {
+	for _, list := range [][]uint16{ch.CipherSuites, ch.Extensions, ch.Curves, ch.SupportedVersions, ch.KeyShareGroups, ch.SignatureAlgorithms} {
+		if slices.ContainsFunc(list, isGREASEValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToProfile converts the ClientHello into Profile fields consumed by buildClientHelloSpecFromProfile.
+// GREASE values keep their positions but are normalized to GREASE_PLACEHOLDER (0x0a0a);
+// utls replaces them with fresh random GREASE values on every handshake.
+func (ch *ClientHello) ToProfile(name string) *Profile {
+	return &Profile{
+		Name:                name,
+		EnableGREASE:        ch.HasGREASE(),
+		CipherSuites:        normalizeGREASE(ch.CipherSuites),
+		Curves:              normalizeGREASE(ch.Curves),
+		PointFormats:        slices.Clone(ch.PointFormats),
+		SignatureAlgorithms: withoutGREASE(ch.SignatureAlgorithms),
+		ALPNProtocols:       slices.Clone(ch.ALPNProtocols),
+		SupportedVersions:   normalizeGREASE(ch.SupportedVersions),
+		KeyShareGroups:      normalizeGREASE(ch.KeyShareGroups),
+		PSKModes:            slices.Clone(ch.PSKModes),
+		Extensions:          normalizeGREASE(ch.Extensions),
+	}
+}
+
+// --- JA3 ---
+
+// JA3 returns the JA3 fingerprint string: Version,Ciphers,Extensions,Curves,PointFormats.
+// GREASE values are excluded per the JA3 specification.
+func (ch *ClientHello) JA3() string {
+	return strings.Join([]string{
+		strconv.Itoa(int(ch.LegacyVersion)),
+		joinDecimal(withoutGREASE(ch.CipherSuites)),
+		joinDecimal(withoutGREASE(ch.Extensions)),
+		joinDecimal(withoutGREASE(ch.Curves)),
+		joinDecimal(ch.PointFormats),
+	}, ",")
+}
+
+// JA3Hash returns the MD5 hex digest of JA3().
+func (ch *ClientHello) JA3Hash() string {
+	sum := md5.Sum([]byte(ch.JA3()))
+	return hex.EncodeToString(sum[:])
+}
+
+// --- JA4 ---
+
+// JA4 returns the hashed JA4 fingerprint (e.g. t13d1714h1_5b57614c22b0_7baf387fc6ff).
+func (ch *ClientHello) JA4() string {
+	ciphers, exts, sigs := ch.ja4Lists(false)
+	return ch.ja4Prefix() + "_" + ja4Hash(ciphers) + "_" + ja4Hash(ja4ExtensionPart(exts, sigs))
+}
+
+// JA4Raw returns the unhashed JA4 (ja4_r). With original=true it returns ja4_ro, which keeps
+// wire order and includes the SNI/ALPN extensions, making it importable without losing order.
+func (ch *ClientHello) JA4Raw(original bool) string {
+	ciphers, exts, sigs := ch.ja4Lists(original)
+	out := ch.ja4Prefix() + "_" + ciphers + "_" + exts
+	if sigs != "" {
+		out += "_" + sigs
+	}
+	return out
+}
+
+func (ch *ClientHello) ja4Prefix() string {
+	sni := "i"
+	if slices.Contains(ch.Extensions, extServerName) {
+		sni = "d"
+	}
+	alpn := "00"
+	if len(ch.ALPNProtocols) > 0 && ch.ALPNProtocols[0] != "" {
+		alpn = ja4ALPNChars(ch.ALPNProtocols[0])
+	}
+	return fmt.Sprintf("t%s%s%02d%02d%s",
+		ja4VersionCode(ch.ja4Version()), sni,
+		min(len(withoutGREASE(ch.CipherSuites)), 99),
+		min(len(withoutGREASE(ch.Extensions)), 99),
+		alpn)
+}
+
+func (ch *ClientHello) ja4Version() uint16 {
+	var best uint16
+	for _, v := range withoutGREASE(ch.SupportedVersions) {
+		if v > best && v < 0xfe00 { // ignore DTLS codes when ordering
+			best = v
+		}
+	}
+	if best == 0 {
+		return ch.LegacyVersion
+	}
+	return best
+}
+
+// ja4Lists returns the comma-joined hex cipher, extension and signature algorithm lists.
+func (ch *ClientHello) ja4Lists(original bool) (string, string, string) {
+	ciphers := withoutGREASE(ch.CipherSuites)
+	exts := withoutGREASE(ch.Extensions)
+	if !original {
+		slices.Sort(ciphers)
+		exts = slices.DeleteFunc(exts, func(e uint16) bool { return e == extServerName || e == extALPN })
+		slices.Sort(exts)
+	}
+	return joinHex(ciphers), joinHex(exts), joinHex(withoutGREASE(ch.SignatureAlgorithms))
+}
+
+func ja4ExtensionPart(exts, sigs string) string {
+	if exts == "" {
+		return ""
+	}
+	if sigs == "" {
+		return exts
+	}
+	return exts + "_" + sigs
+}
+
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func ja4VersionCode(v uint16) string {
+	switch v {
+	case utls.VersionTLS13:
+		return "13"
+	case utls.VersionTLS12:
+		return "12"
+	case utls.VersionTLS11:
+		return "11"
+	case utls.VersionTLS10:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	default:
+		return "00"
+	}
+}
+
+func ja4ALPNChars(proto string) string {
+	first, last := proto[0], proto[len(proto)-1]
+	if isAlnum(first) && isAlnum(last) {
+		return string([]byte{first, last})
+	}
+	h := hex.EncodeToString([]byte(proto))
+	return string([]byte{h[0], h[len(h)-1]})
+}
+
+func isAlnum(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// --- helpers ---
+
+func normalizeGREASE(vals []uint16) []uint16 {
+	out := make([]uint16, len(vals))
+	for i, v := range vals {
+		if isGREASEValue(v) {
+			v = utls.GREASE_PLACEHOLDER
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func withoutGREASE(vals []uint16) []uint16 {
+	out := make([]uint16, 0, len(vals))
+	for _, v := range vals {
+		if !isGREASEValue(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func joinDecimal(vals []uint16) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinHex(vals []uint16) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
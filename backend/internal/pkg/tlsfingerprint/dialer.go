@@ -384,6 +384,10 @@ func buildClientHelloSpecFromProfile(profile *Profile) *utls.ClientHelloSpec {
 	keyShares := make([]utls.KeyShare, len(keyShareGroups))
 	for i, g := range keyShareGroups {
 		keyShares[i] = utls.KeyShare{Group: g}
+		if isGREASEValue(uint16(g)) {
+			// GREASE key shares carry a single dummy byte (as browsers send).
+			keyShares[i].Data = []byte{0}
+		}
 	}
 
 	// Determine extension order
@@ -416,8 +420,14 @@ func buildClientHelloSpecFromProfile(profile *Profile) *utls.ClientHelloSpec {
 			extensions = append(extensions, &utls.ALPNExtension{AlpnProtocols: alpnProtocols})
 		case 18: // signed_certificate_timestamp
 			extensions = append(extensions, &utls.SCTExtension{})
+		case 21: // padding
+			extensions = append(extensions, &utls.UtlsPaddingExtension{GetPaddingLen: utls.BoringPaddingStyle})
 		case 23: // extended_master_secret
 			extensions = append(extensions, &utls.ExtendedMasterSecretExtension{})
+		case 27: // compress_certificate
+			extensions = append(extensions, &utls.UtlsCompressCertExtension{Algorithms: []utls.CertCompressionAlgo{utls.CertCompressionBrotli}})
+		case 28: // record_size_limit
+			extensions = append(extensions, &utls.FakeRecordSizeLimitExtension{Limit: 0x4001})
 		case 35: // session_ticket
 			extensions = append(extensions, &utls.SessionTicketExtension{})
 		case 43: // supported_versions
@@ -428,6 +438,12 @@ func buildClientHelloSpecFromProfile(profile *Profile) *utls.ClientHelloSpec {
 			extensions = append(extensions, &utls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: signatureAlgorithms})
 		case 51: // key_share
 			extensions = append(extensions, &utls.KeyShareExtension{KeyShares: keyShares})
+		case 17513, 17613: // application_settings (ALPS, old and new codepoints)
+			if id == 17513 {
+				extensions = append(extensions, &utls.ApplicationSettingsExtension{SupportedProtocols: []string{"h2"}})
+			} else {
+				extensions = append(extensions, &utls.ApplicationSettingsExtensionNew{SupportedProtocols: []string{"h2"}})
+			}
 		case 0xfe0d: // encrypted_client_hello (ECH, 65037)
 			// Send GREASE ECH with random payload — mimics Node.js behavior when no real ECHConfig is available.
 			// An empty GenericExtension causes "error decoding message" from servers that validate ECH format.
@@ -0,0 +1,372 @@
+package tlsfingerprint
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// ProfileClientHello renders the ClientHello the dialer would send for profile
+// (nil uses the built-in defaults) and parses it back.
+// serverName controls whether SNI is present in the JA4 prefix; empty uses "example.com".
+func ProfileClientHello(profile *Profile, serverName string) (*ClientHello, error) {
+	if serverName == "" {
+		serverName = "example.com"
+	}
+	client, server := net.Pipe()
+	defer func() {
+		_ = client.Close()
+		_ = server.Close()
+	}()
+
+	uconn := utls.UClient(client, &utls.Config{ServerName: serverName, InsecureSkipVerify: true}, utls.HelloCustom)
+	if err := uconn.ApplyPreset(buildClientHelloSpecFromProfile(profile)); err != nil {
+		return nil, fmt.Errorf("apply TLS preset: %w", err)
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		return nil, fmt.Errorf("build handshake state: %w", err)
+	}
+	return ParseClientHello(uconn.HandshakeState.Hello.Raw)
+}
+
+// ParseJA3 parses a JA3 fingerprint string ("771,4865-4866,0-23-65281,29-23,0")
+// into the profile fields it carries: cipher suites, extension order, curves and point formats.
+// A JA3 hash cannot be reversed and is rejected.
+func ParseJA3(ja3 string) (*Profile, error) {
+	ja3 = strings.TrimSpace(ja3)
+	parts := strings.Split(ja3, ",")
+	if len(parts) != 5 {
+		if len(ja3) == 32 && !strings.ContainsAny(ja3, ",-") {
+			return nil, errors.New("tlsfingerprint: JA3 hash cannot be imported, provide the full JA3 string")
+		}
+		return nil, fmt.Errorf("tlsfingerprint: JA3 must have 5 comma-separated fields, got %d", len(parts))
+	}
+	version, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || version == 0 {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA3 version %q", parts[0])
+	}
+
+	var lists [4][]uint16
+	for i, field := range parts[1:] {
+		if lists[i], err = parseUintList(field, "-", 10); err != nil {
+			return nil, fmt.Errorf("tlsfingerprint: invalid JA3 field %d: %w", i+2, err)
+		}
+	}
+	if len(lists[0]) == 0 {
+		return nil, errors.New("tlsfingerprint: JA3 has no cipher suites")
+	}
+	return &Profile{
+		CipherSuites: lists[0],
+		Extensions:   lists[1],
+		Curves:       lists[2],
+		PointFormats: lists[3],
+	}, nil
+}
+
+// JA4Fingerprint is a parsed JA4 fingerprint. Hashed fingerprints only carry the
+// a-part metadata; raw fingerprints (ja4_r / ja4_ro) also carry the full lists.
+type JA4Fingerprint struct {
+	Raw                 string
+	Hashed              bool
+	Version             uint16
+	SNI                 bool
+	CipherCount         int
+	ExtensionCount      int
+	ALPN                string // first+last ALPN characters, "00" if none
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SignatureAlgorithms []uint16
+}
+
+// ParseJA4 parses a hashed JA4 (t13d1714h1_5b57614c22b0_7baf387fc6ff) or a raw
+// JA4 (t13d1714h1_1301,1302,..._000a,000b,..._0403,0804,...).
+func ParseJA4(ja4 string) (*JA4Fingerprint, error) {
+	ja4 = strings.TrimSpace(ja4)
+	parts := strings.Split(ja4, "_")
+	if len(parts) < 3 || len(parts) > 4 {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA4 %q", ja4)
+	}
+	a := parts[0]
+	if len(a) != 10 || (a[0] != 't' && a[0] != 'q' && a[0] != 'd') {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA4 prefix %q", a)
+	}
+	fp := &JA4Fingerprint{Raw: ja4, SNI: a[3] == 'd', ALPN: a[8:10]}
+	if fp.Version = ja4VersionFromCode(a[1:3]); fp.Version == 0 {
+		return nil, fmt.Errorf("tlsfingerprint: unknown JA4 TLS version %q", a[1:3])
+	}
+	if a[3] != 'd' && a[3] != 'i' {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA4 SNI flag %q", a[3:4])
+	}
+	var err error
+	if fp.CipherCount, err = strconv.Atoi(a[4:6]); err != nil {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA4 cipher count %q", a[4:6])
+	}
+	if fp.ExtensionCount, err = strconv.Atoi(a[6:8]); err != nil {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA4 extension count %q", a[6:8])
+	}
+
+	if len(parts) == 3 && len(parts[1]) == 12 && len(parts[2]) == 12 && !strings.Contains(parts[1], ",") {
+		fp.Hashed = true
+		return fp, nil
+	}
+	if fp.CipherSuites, err = parseUintList(parts[1], ",", 16); err != nil {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA4 cipher list: %w", err)
+	}
+	if fp.Extensions, err = parseUintList(parts[2], ",", 16); err != nil {
+		return nil, fmt.Errorf("tlsfingerprint: invalid JA4 extension list: %w", err)
+	}
+	if len(parts) == 4 {
+		if fp.SignatureAlgorithms, err = parseUintList(parts[3], ",", 16); err != nil {
+			return nil, fmt.Errorf("tlsfingerprint: invalid JA4 signature algorithm list: %w", err)
+		}
+	}
+	return fp, nil
+}
+
+// ToProfile converts a raw JA4 into profile fields. Hashed JA4 fingerprints cannot be
+// reversed and return an error. JA4 does not carry curves or point formats, and ja4_r
+// sorts ciphers and extensions, so the resulting order is only faithful for ja4_ro.
+func (fp *JA4Fingerprint) ToProfile() (*Profile, error) {
+	if fp.Hashed {
+		return nil, errors.New("tlsfingerprint: hashed JA4 cannot be imported, provide ja4_r/ja4_ro or a JA3 string")
+	}
+	p := &Profile{
+		CipherSuites:        slices.Clone(fp.CipherSuites),
+		SignatureAlgorithms: slices.Clone(fp.SignatureAlgorithms),
+		ALPNProtocols:       ja4ALPNProtocols(fp.ALPN),
+	}
+	if fp.Version == utls.VersionTLS13 {
+		p.SupportedVersions = []uint16{utls.VersionTLS13, utls.VersionTLS12}
+	}
+	exts := slices.Clone(fp.Extensions)
+	// ja4_r omits SNI and ALPN from the extension list; add them back (SNI first,
+	// ALPN last) so the dialer still sends them.
+	if fp.SNI && !slices.Contains(exts, extServerName) {
+		exts = append([]uint16{extServerName}, exts...)
+	}
+	if fp.ALPN != "00" && !slices.Contains(exts, extALPN) {
+		exts = append(exts, extALPN)
+	}
+	p.Extensions = exts
+	return p, nil
+}
+
+// Matches reports whether fp describes the given ClientHello. Hashed fingerprints are
+// compared against ch.JA4(); raw ones against ja4_r or ja4_ro depending on their shape.
+func (fp *JA4Fingerprint) Matches(ch *ClientHello) bool {
+	if fp.Hashed {
+		return fp.Raw == ch.JA4()
+	}
+	return fp.Raw == ch.JA4Raw(false) || fp.Raw == ch.JA4Raw(true)
+}
+
+func ja4VersionFromCode(code string) uint16 {
+	switch code {
+	case "13":
+		return utls.VersionTLS13
+	case "12":
+		return utls.VersionTLS12
+	case "11":
+		return utls.VersionTLS11
+	case "10":
+		return utls.VersionTLS10
+	case "s3":
+		return 0x0300
+	default:
+		return 0
+	}
+}
+
+// ja4ALPNProtocols maps the two-character JA4 ALPN code back to protocol names.
+func ja4ALPNProtocols(code string) []string {
+	switch code {
+	case "h1":
+		return []string{"http/1.1"}
+	case "h2":
+		return []string{"h2", "http/1.1"}
+	case "h3":
+		return []string{"h3"}
+	default:
+		return nil
+	}
+}
+
+func parseUintList(s, sep string, base int) ([]uint16, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	fields := strings.Split(s, sep)
+	out := make([]uint16, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseUint(strings.TrimSpace(f), base, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", f)
+		}
+		out = append(out, uint16(v))
+	}
+	return out, nil
+}
+
+// FieldDiff describes one differing ClientHello field.
+type FieldDiff struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// DiffResult is the outcome of comparing a profile against a reference fingerprint.
+type DiffResult struct {
+	Match       bool        `json:"match"`
+	JA3Match    bool        `json:"ja3_match"`
+	JA4Match    bool        `json:"ja4_match"`
+	Expected    Fingerprint `json:"expected"`
+	Actual      Fingerprint `json:"actual"`
+	Differences []FieldDiff `json:"differences"`
+}
+
+// Fingerprint bundles the JA3/JA4 representations of a ClientHello.
+type Fingerprint struct {
+	JA3     string `json:"ja3"`
+	JA3Hash string `json:"ja3_hash"`
+	JA4     string `json:"ja4"`
+	JA4R    string `json:"ja4_r"`
+	JA4RO   string `json:"ja4_ro"`
+}
+
+// FingerprintOf computes all JA3/JA4 representations of ch.
+func FingerprintOf(ch *ClientHello) Fingerprint {
+	return Fingerprint{
+		JA3:     ch.JA3(),
+		JA3Hash: ch.JA3Hash(),
+		JA4:     ch.JA4(),
+		JA4R:    ch.JA4Raw(false),
+		JA4RO:   ch.JA4Raw(true),
+	}
+}
+
+// Diff compares the ClientHello a profile produces (actual) against a reference
+// ClientHello (expected), e.g. one recorded by a capture session. GREASE values are ignored.
+func Diff(expected, actual *ClientHello) *DiffResult {
+	res := &DiffResult{Expected: FingerprintOf(expected), Actual: FingerprintOf(actual)}
+	res.JA3Match = res.Expected.JA3 == res.Actual.JA3
+	res.JA4Match = res.Expected.JA4 == res.Actual.JA4
+	res.Differences = diffFields(expected, actual, allDiffFields)
+	if expected.HasGREASE() != actual.HasGREASE() {
+		res.Differences = append(res.Differences, FieldDiff{
+			Field:    "grease",
+			Expected: strconv.FormatBool(expected.HasGREASE()),
+			Actual:   strconv.FormatBool(actual.HasGREASE()),
+		})
+	}
+	res.Match = len(res.Differences) == 0
+	return res
+}
+
+// DiffJA3 compares actual against a JA3 string. Only the fields JA3 carries are compared.
+func DiffJA3(ja3 string, actual *ClientHello) (*DiffResult, error) {
+	p, err := ParseJA3(ja3)
+	if err != nil {
+		return nil, err
+	}
+	version, _ := strconv.ParseUint(strings.SplitN(strings.TrimSpace(ja3), ",", 2)[0], 10, 16)
+	expected := &ClientHello{
+		LegacyVersion: uint16(version),
+		CipherSuites:  p.CipherSuites,
+		Extensions:    p.Extensions,
+		Curves:        p.Curves,
+		PointFormats:  p.PointFormats,
+	}
+	res := &DiffResult{
+		Expected: Fingerprint{JA3: expected.JA3(), JA3Hash: expected.JA3Hash()},
+		Actual:   FingerprintOf(actual),
+	}
+	res.JA3Match = res.Expected.JA3 == res.Actual.JA3
+	res.Differences = diffFields(expected, actual, []string{"cipher_suites", "extensions", "curves", "point_formats"})
+	if expected.LegacyVersion != actual.LegacyVersion {
+		res.Differences = append(res.Differences, FieldDiff{
+			Field:    "legacy_version",
+			Expected: strconv.Itoa(int(expected.LegacyVersion)),
+			Actual:   strconv.Itoa(int(actual.LegacyVersion)),
+		})
+	}
+	res.Match = res.JA3Match && len(res.Differences) == 0
+	return res, nil
+}
+
+// DiffJA4 compares actual against a JA4 fingerprint. Hashed fingerprints only report
+// whether the JA4 matches; raw fingerprints also report per-field differences.
+func DiffJA4(ja4 string, actual *ClientHello) (*DiffResult, error) {
+	fp, err := ParseJA4(ja4)
+	if err != nil {
+		return nil, err
+	}
+	res := &DiffResult{Actual: FingerprintOf(actual), JA4Match: fp.Matches(actual)}
+	switch {
+	case fp.Hashed:
+		res.Expected.JA4 = fp.Raw
+	case fp.Raw == res.Actual.JA4RO || (len(fp.Extensions) > 0 && slices.Contains(fp.Extensions, extServerName)):
+		res.Expected.JA4RO = fp.Raw
+	default:
+		res.Expected.JA4R = fp.Raw
+	}
+	if !fp.Hashed {
+		ciphers, exts := withoutGREASE(actual.CipherSuites), withoutGREASE(actual.Extensions)
+		expCiphers, expExts := slices.Clone(fp.CipherSuites), slices.Clone(fp.Extensions)
+		if res.Expected.JA4R != "" {
+			// ja4_r is sorted and excludes SNI/ALPN; normalize actual the same way.
+			slices.Sort(ciphers)
+			exts = slices.DeleteFunc(exts, func(e uint16) bool { return e == extServerName || e == extALPN })
+			slices.Sort(exts)
+		}
+		expected := &ClientHello{CipherSuites: expCiphers, Extensions: expExts, SignatureAlgorithms: fp.SignatureAlgorithms}
+		normalized := &ClientHello{CipherSuites: ciphers, Extensions: exts, SignatureAlgorithms: actual.SignatureAlgorithms}
+		res.Differences = diffFields(expected, normalized, []string{"cipher_suites", "extensions", "signature_algorithms"})
+	}
+	if prefix := actual.ja4Prefix(); !strings.HasPrefix(fp.Raw, prefix+"_") {
+		res.Differences = append(res.Differences, FieldDiff{Field: "ja4_a", Expected: strings.SplitN(fp.Raw, "_", 2)[0], Actual: prefix})
+	}
+	res.Match = res.JA4Match && len(res.Differences) == 0
+	return res, nil
+}
+
+var allDiffFields = []string{
+	"cipher_suites", "extensions", "curves", "point_formats", "signature_algorithms",
+	"supported_versions", "key_share_groups", "psk_modes", "alpn_protocols",
+}
+
+func diffFields(expected, actual *ClientHello, fields []string) []FieldDiff {
+	var diffs []FieldDiff
+	for _, field := range fields {
+		var exp, act string
+		switch field {
+		case "cipher_suites":
+			exp, act = joinDecimal(withoutGREASE(expected.CipherSuites)), joinDecimal(withoutGREASE(actual.CipherSuites))
+		case "extensions":
+			exp, act = joinDecimal(withoutGREASE(expected.Extensions)), joinDecimal(withoutGREASE(actual.Extensions))
+		case "curves":
+			exp, act = joinDecimal(withoutGREASE(expected.Curves)), joinDecimal(withoutGREASE(actual.Curves))
+		case "point_formats":
+			exp, act = joinDecimal(expected.PointFormats), joinDecimal(actual.PointFormats)
+		case "signature_algorithms":
+			exp, act = joinDecimal(withoutGREASE(expected.SignatureAlgorithms)), joinDecimal(withoutGREASE(actual.SignatureAlgorithms))
+		case "supported_versions":
+			exp, act = joinDecimal(withoutGREASE(expected.SupportedVersions)), joinDecimal(withoutGREASE(actual.SupportedVersions))
+		case "key_share_groups":
+			exp, act = joinDecimal(withoutGREASE(expected.KeyShareGroups)), joinDecimal(withoutGREASE(actual.KeyShareGroups))
+		case "psk_modes":
+			exp, act = joinDecimal(expected.PSKModes), joinDecimal(actual.PSKModes)
+		case "alpn_protocols":
+			exp, act = strings.Join(expected.ALPNProtocols, ","), strings.Join(actual.ALPNProtocols, ",")
+		}
+		if exp != act {
+			diffs = append(diffs, FieldDiff{Field: field, Expected: exp, Actual: act})
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,248 @@
+//go:build unit
+
+package tlsfingerprint
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+const (
+	defaultJA3Hash = "44f88fca027f27bab4bb08d4af15f23e"
+	defaultJA4     = "t13d1714h1_5b57614c22b0_7baf387fc6ff"
+)
+
+func TestProfileClientHelloDefaultFingerprint(t *testing.T) {
+	ch, err := ProfileClientHello(nil, "api.anthropic.com")
+	if err != nil {
+		t.Fatalf("ProfileClientHello: %v", err)
+	}
+	if got := ch.JA3Hash(); got != defaultJA3Hash {
+		t.Errorf("JA3 hash = %s, want %s (ja3=%s)", got, defaultJA3Hash, ch.JA3())
+	}
+	if got := ch.JA4(); got != defaultJA4 {
+		t.Errorf("JA4 = %s, want %s (ja4_r=%s)", got, defaultJA4, ch.JA4Raw(false))
+	}
+	if ch.ServerName != "api.anthropic.com" {
+		t.Errorf("ServerName = %q", ch.ServerName)
+	}
+	if !slices.Equal(ch.ALPNProtocols, []string{"http/1.1"}) {
+		t.Errorf("ALPN = %v", ch.ALPNProtocols)
+	}
+}
+
+func TestParseJA3RoundTrip(t *testing.T) {
+	def, err := ProfileClientHello(nil, "")
+	if err != nil {
+		t.Fatalf("ProfileClientHello: %v", err)
+	}
+	p, err := ParseJA3(def.JA3())
+	if err != nil {
+		t.Fatalf("ParseJA3: %v", err)
+	}
+	if !slices.Equal(p.CipherSuites, def.CipherSuites) || !slices.Equal(p.Extensions, def.Extensions) {
+		t.Fatalf("parsed profile lists differ: %+v", p)
+	}
+	ch, err := ProfileClientHello(p, "")
+	if err != nil {
+		t.Fatalf("ProfileClientHello(imported): %v", err)
+	}
+	if ch.JA3Hash() != defaultJA3Hash {
+		t.Errorf("imported JA3 hash = %s, want %s", ch.JA3Hash(), defaultJA3Hash)
+	}
+
+	res, err := DiffJA3(def.JA3(), ch)
+	if err != nil {
+		t.Fatalf("DiffJA3: %v", err)
+	}
+	if !res.Match {
+		t.Errorf("DiffJA3 should match, differences: %+v", res.Differences)
+	}
+}
+
+func TestParseJA3Errors(t *testing.T) {
+	for _, in := range []string{"", defaultJA3Hash, "771,,0,29,0", "abc,4865,0,29,0", "771,4865,x,29,0"} {
+		if _, err := ParseJA3(in); err == nil {
+			t.Errorf("ParseJA3(%q) expected error", in)
+		}
+	}
+}
+
+func TestParseJA4(t *testing.T) {
+	fp, err := ParseJA4(defaultJA4)
+	if err != nil {
+		t.Fatalf("ParseJA4: %v", err)
+	}
+	if !fp.Hashed || fp.Version != utls.VersionTLS13 || !fp.SNI || fp.CipherCount != 17 || fp.ExtensionCount != 14 || fp.ALPN != "h1" {
+		t.Fatalf("unexpected parse result: %+v", fp)
+	}
+	if _, err := fp.ToProfile(); err == nil {
+		t.Error("hashed JA4 should not be importable")
+	}
+
+	def, err := ProfileClientHello(nil, "")
+	if err != nil {
+		t.Fatalf("ProfileClientHello: %v", err)
+	}
+	if !fp.Matches(def) {
+		t.Error("hashed JA4 should match default profile")
+	}
+
+	ro, err := ParseJA4(def.JA4Raw(true))
+	if err != nil {
+		t.Fatalf("ParseJA4(ja4_ro): %v", err)
+	}
+	p, err := ro.ToProfile()
+	if err != nil {
+		t.Fatalf("ToProfile: %v", err)
+	}
+	if !slices.Equal(p.CipherSuites, def.CipherSuites) || !slices.Equal(p.Extensions, def.Extensions) {
+		t.Errorf("ja4_ro import lost ordering: %+v", p)
+	}
+	if !slices.Equal(p.ALPNProtocols, []string{"http/1.1"}) {
+		t.Errorf("ALPN = %v", p.ALPNProtocols)
+	}
+	ch, err := ProfileClientHello(p, "")
+	if err != nil {
+		t.Fatalf("ProfileClientHello(imported): %v", err)
+	}
+	if ch.JA4() != defaultJA4 {
+		t.Errorf("imported JA4 = %s, want %s", ch.JA4(), defaultJA4)
+	}
+
+	for _, in := range []string{"", "x13d1714h1_a_b", "t99d1714h1_5b57614c22b0_7baf387fc6ff", "t13d1714h1_zz_0000"} {
+		if _, err := ParseJA4(in); err == nil {
+			t.Errorf("ParseJA4(%q) expected error", in)
+		}
+	}
+}
+
+func TestDiffJA4ReportsFieldDifferences(t *testing.T) {
+	def, err := ProfileClientHello(nil, "")
+	if err != nil {
+		t.Fatalf("ProfileClientHello: %v", err)
+	}
+	other, err := ProfileClientHello(&Profile{CipherSuites: []uint16{0x1301, 0x1302}, ALPNProtocols: []string{"h2"}}, "")
+	if err != nil {
+		t.Fatalf("ProfileClientHello: %v", err)
+	}
+
+	res, err := DiffJA4(def.JA4Raw(false), other)
+	if err != nil {
+		t.Fatalf("DiffJA4: %v", err)
+	}
+	if res.Match || res.JA4Match {
+		t.Fatal("expected mismatch")
+	}
+	fields := make([]string, 0, len(res.Differences))
+	for _, d := range res.Differences {
+		fields = append(fields, d.Field)
+	}
+	if !slices.Contains(fields, "cipher_suites") || !slices.Contains(fields, "ja4_a") {
+		t.Errorf("differences = %v", fields)
+	}
+
+	res, err = DiffJA4(defaultJA4, def)
+	if err != nil {
+		t.Fatalf("DiffJA4: %v", err)
+	}
+	if !res.Match {
+		t.Errorf("expected match, got %+v", res.Differences)
+	}
+}
+
+func TestParseClientHelloGREASEToProfile(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = server.Close() }()
+
+	uconn := utls.UClient(client, &utls.Config{ServerName: "example.com", InsecureSkipVerify: true}, utls.HelloChrome_120)
+	go func() {
+		_ = uconn.Handshake()
+		_ = client.Close()
+	}()
+
+	raw, err := readClientHelloRecords(server)
+	if err != nil {
+		t.Fatalf("read ClientHello: %v", err)
+	}
+	ch, err := ParseClientHello(raw)
+	if err != nil {
+		t.Fatalf("ParseClientHello: %v", err)
+	}
+	if !ch.HasGREASE() || ch.ServerName != "example.com" {
+		t.Fatalf("unexpected ClientHello: grease=%v sni=%q", ch.HasGREASE(), ch.ServerName)
+	}
+
+	p := ch.ToProfile("chrome")
+	if !p.EnableGREASE || p.CipherSuites[0] != utls.GREASE_PLACEHOLDER {
+		t.Fatalf("GREASE not preserved: %+v", p)
+	}
+	replayed, err := ProfileClientHello(p, "example.com")
+	if err != nil {
+		t.Fatalf("ProfileClientHello(imported): %v", err)
+	}
+	if res := Diff(ch, replayed); !res.Match {
+		t.Errorf("imported profile differs from capture: %+v", res.Differences)
+	}
+}
+
+func TestParseClientHelloRejectsGarbage(t *testing.T) {
+	for _, in := range [][]byte{nil, []byte("GET / HTTP/1.1\r\n"), {0x16, 0x03, 0x01, 0x00, 0x10, 0x01}, {0x01, 0x00, 0x00, 0x05, 0x03}} {
+		if _, err := ParseClientHello(in); err == nil {
+			t.Errorf("ParseClientHello(%q) expected error", in)
+		}
+	}
+}
+
+func TestCaptureServerRecordsClientHello(t *testing.T) {
+	srv, err := StartCapture("127.0.0.1:0", 5*time.Second)
+	if err != nil {
+		t.Fatalf("StartCapture: %v", err)
+	}
+	defer func() { _ = srv.Close() }()
+
+	httpClient := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := httpClient.Get("https://" + srv.Addr() + "/")
+	if err != nil {
+		t.Fatalf("GET capture server: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hello, err := srv.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	var fp Fingerprint
+	if err := json.Unmarshal(body, &fp); err != nil {
+		t.Fatalf("decode response %q: %v", body, err)
+	}
+	if fp.JA4 != hello.JA4() || !strings.HasPrefix(fp.JA4, "t13") {
+		t.Errorf("response JA4 = %s, captured = %s", fp.JA4, hello.JA4())
+	}
+}
+
+func TestCaptureServerTimeout(t *testing.T) {
+	srv, err := StartCapture("127.0.0.1:0", 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("StartCapture: %v", err)
+	}
+	if _, err := srv.Wait(context.Background()); err != ErrCaptureTimeout {
+		t.Fatalf("Wait err = %v, want ErrCaptureTimeout", err)
+	}
+}
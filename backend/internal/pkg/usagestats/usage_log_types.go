@@ -258,6 +258,18 @@ type UsageStats struct {
 	Endpoints         []EndpointStat `json:"endpoints,omitempty"`
 	UpstreamEndpoints []EndpointStat `json:"upstream_endpoints,omitempty"`
 	EndpointPaths     []EndpointStat `json:"endpoint_paths,omitempty"`
+
+	PromptCacheSavings *PromptCacheSavingsStats `json:"prompt_cache_savings,omitempty"`
+}
+
+// PromptCacheSavingsStats 网关自动注入缓存断点产生的节省（仅统计注入过断点的请求）
+type PromptCacheSavingsStats struct {
+	Requests              int64   `json:"requests"`
+	CacheReadTokens       int64   `json:"cache_read_tokens"`
+	CacheCreation5mTokens int64   `json:"cache_creation_5m_tokens"`
+	CacheCreation1hTokens int64   `json:"cache_creation_1h_tokens"`
+	SavedCost             float64 `json:"saved_cost"`
+	ActualSavedCost       float64 `json:"actual_saved_cost"`
 }
 
 // BatchUserUsageStats represents usage stats for a single user
@@ -0,0 +1,156 @@
+// Package vertex provides Google Vertex AI helpers: service-account JWT
+// assertions for the OAuth token exchange and publisher model endpoints.
+package vertex
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultTokenURL Google OAuth2 token 端点（服务账号 JSON 未提供 token_uri 时使用）
+	DefaultTokenURL = "https://oauth2.googleapis.com/token"
+	// Scope Vertex AI 调用所需的 OAuth scope
+	Scope = "https://www.googleapis.com/auth/cloud-platform"
+	// GrantTypeJWTBearer 服务账号换取 access token 的 grant_type
+	GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	// DefaultRegion 未配置区域时使用全局端点
+	DefaultRegion = "global"
+
+	// AnthropicVersion Vertex 上 Claude rawPredict 请求体要求的 anthropic_version
+	AnthropicVersion = "vertex-2023-10-16"
+
+	assertionLifetime = time.Hour
+)
+
+// ServiceAccount is the subset of a Google service-account key file used for token exchange.
+type ServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// TokenResponse is the OAuth2 token endpoint response.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// ParseServiceAccount parses and validates a service-account key JSON.
+func ParseServiceAccount(raw string) (*ServiceAccount, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.New("vertex: service account json is empty")
+	}
+	var sa ServiceAccount
+	if err := json.Unmarshal([]byte(raw), &sa); err != nil {
+		return nil, fmt.Errorf("vertex: invalid service account json: %w", err)
+	}
+	if sa.Type != "" && sa.Type != "service_account" {
+		return nil, fmt.Errorf("vertex: unsupported credential type %q", sa.Type)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("vertex: service account json missing client_email or private_key")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("vertex: invalid private_key: %w", err)
+	}
+	sa.key = key
+	if sa.TokenURI == "" {
+		sa.TokenURI = DefaultTokenURL
+	}
+	// token_uri 来自用户上传的 JSON，仅允许 Google 官方 token 端点，避免把签名断言发往任意地址
+	if u, err := url.Parse(sa.TokenURI); err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Hostname(), ".googleapis.com") {
+		return nil, fmt.Errorf("vertex: untrusted token_uri %q", sa.TokenURI)
+	}
+	return &sa, nil
+}
+
+// Assertion builds the signed JWT exchanged for an access token (RFC 7523).
+func (sa *ServiceAccount) Assertion(now time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":   sa.ClientEmail,
+		"scope": Scope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if sa.PrivateKeyID != "" {
+		token.Header["kid"] = sa.PrivateKeyID
+	}
+	signed, err := token.SignedString(sa.key)
+	if err != nil {
+		return "", fmt.Errorf("vertex: sign assertion: %w", err)
+	}
+	return signed, nil
+}
+
+// BaseURL returns the regional Vertex AI endpoint; "global" uses the global host.
+func BaseURL(region string) string {
+	if region == "" || region == DefaultRegion {
+		return "https://aiplatform.googleapis.com"
+	}
+	return "https://" + region + "-aiplatform.googleapis.com"
+}
+
+func publisherModelURL(projectID, region, publisher, model, method string) string {
+	if region == "" {
+		region = DefaultRegion
+	}
+	return fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/%s/models/%s:%s",
+		BaseURL(region), url.PathEscape(projectID), url.PathEscape(region), publisher, url.PathEscape(model), method)
+}
+
+// ClaudeURL returns the rawPredict / streamRawPredict endpoint for an Anthropic model.
+func ClaudeURL(projectID, region, model string, stream bool) string {
+	method := "rawPredict"
+	if stream {
+		method = "streamRawPredict"
+	}
+	return publisherModelURL(projectID, region, "anthropic", model, method)
+}
+
+// GeminiURL returns the endpoint for a Google model action (generateContent,
+// streamGenerateContent, countTokens); streaming responses are requested as SSE.
+func GeminiURL(projectID, region, model, action string) string {
+	u := publisherModelURL(projectID, region, "google", model, action)
+	if action == "streamGenerateContent" {
+		u += "?alt=sse"
+	}
+	return u
+}
+
+// claudeDatedModel matches Anthropic API model IDs with a date suffix, e.g. claude-sonnet-4-5-20250929.
+var claudeDatedModel = regexp.MustCompile(`^(claude-[a-z0-9-]+?)-(\d{8})$`)
+
+// ClaudeModelID converts an Anthropic API model ID to the Vertex form
+// (claude-sonnet-4-5-20250929 → claude-sonnet-4-5@20250929) and drops the
+// "-thinking" alias suffix. IDs without a date suffix or already in Vertex form
+// are returned unchanged.
+func ClaudeModelID(model string) string {
+	model = strings.TrimSuffix(strings.TrimSpace(model), "-thinking")
+	if strings.Contains(model, "@") {
+		return model
+	}
+	if m := claudeDatedModel.FindStringSubmatch(model); m != nil {
+		return m[1] + "@" + m[2]
+	}
+	return model
+}
@@ -0,0 +1,87 @@
+package vertex
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func testServiceAccountJSON(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	raw, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "my-project",
+		"private_key_id": "kid-1",
+		"private_key":    string(pemKey),
+		"client_email":   "svc@my-project.iam.gserviceaccount.com",
+	})
+	require.NoError(t, err)
+	return string(raw), key
+}
+
+func TestParseServiceAccountAndAssertion(t *testing.T) {
+	raw, key := testServiceAccountJSON(t)
+	sa, err := ParseServiceAccount(raw)
+	require.NoError(t, err)
+	require.Equal(t, "my-project", sa.ProjectID)
+	require.Equal(t, DefaultTokenURL, sa.TokenURI)
+
+	now := time.Now()
+	assertion, err := sa.Assertion(now)
+	require.NoError(t, err)
+
+	parsed, err := jwt.Parse(assertion, func(token *jwt.Token) (any, error) { return &key.PublicKey, nil },
+		jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(DefaultTokenURL))
+	require.NoError(t, err)
+	claims := parsed.Claims.(jwt.MapClaims)
+	require.Equal(t, "svc@my-project.iam.gserviceaccount.com", claims["iss"])
+	require.Equal(t, Scope, claims["scope"])
+	require.Equal(t, "kid-1", parsed.Header["kid"])
+}
+
+func TestParseServiceAccount_Invalid(t *testing.T) {
+	_, err := ParseServiceAccount("")
+	require.Error(t, err)
+	_, err = ParseServiceAccount(`{"type":"authorized_user","client_email":"a","private_key":"b"}`)
+	require.Error(t, err)
+	_, err = ParseServiceAccount(`{"client_email":"a","private_key":"not a pem"}`)
+	require.Error(t, err)
+
+	raw, _ := testServiceAccountJSON(t)
+	var m map[string]string
+	require.NoError(t, json.Unmarshal([]byte(raw), &m))
+	m["token_uri"] = "https://attacker.example/token"
+	tampered, _ := json.Marshal(m)
+	_, err = ParseServiceAccount(string(tampered))
+	require.ErrorContains(t, err, "untrusted token_uri")
+}
+
+func TestEndpoints(t *testing.T) {
+	require.Equal(t,
+		"https://us-east5-aiplatform.googleapis.com/v1/projects/p/locations/us-east5/publishers/anthropic/models/claude-sonnet-4-5@20250929:streamRawPredict",
+		ClaudeURL("p", "us-east5", "claude-sonnet-4-5@20250929", true))
+	require.Equal(t,
+		"https://aiplatform.googleapis.com/v1/projects/p/locations/global/publishers/anthropic/models/claude-opus-4-6:rawPredict",
+		ClaudeURL("p", "", "claude-opus-4-6", false))
+	require.Equal(t,
+		"https://europe-west4-aiplatform.googleapis.com/v1/projects/p/locations/europe-west4/publishers/google/models/gemini-2.5-pro:streamGenerateContent?alt=sse",
+		GeminiURL("p", "europe-west4", "gemini-2.5-pro", "streamGenerateContent"))
+}
+
+func TestClaudeModelID(t *testing.T) {
+	require.Equal(t, "claude-sonnet-4-5@20250929", ClaudeModelID("claude-sonnet-4-5-20250929"))
+	require.Equal(t, "claude-3-5-haiku@20241022", ClaudeModelID("claude-3-5-haiku-20241022"))
+	require.Equal(t, "claude-opus-4-6", ClaudeModelID("claude-opus-4-6-thinking"))
+	require.Equal(t, "claude-haiku-4-5@20251001", ClaudeModelID("claude-haiku-4-5@20251001"))
+	require.Equal(t, "claude-sonnet-4-6", ClaudeModelID("claude-sonnet-4-6"))
+}
@@ -0,0 +1,268 @@
+package webfetch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// convertDocument turns a fetched body into text: HTML → markdown, PDF → plain text,
+// text-like types are passed through. Other media types are rejected.
+func convertDocument(body []byte, mediaType, rawContentType string, base *url.URL) (title, content string, err error) {
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		reader, err := charset.NewReader(bytes.NewReader(body), rawContentType)
+		if err != nil {
+			reader = bytes.NewReader(body)
+		}
+		return htmlToMarkdown(reader, base)
+	case mediaType == "application/pdf":
+		text := pdfToText(body)
+		if text == "" {
+			return "", "", fmt.Errorf("%w: no extractable text in pdf", ErrUnsupportedContentType)
+		}
+		return "", text, nil
+	case isTextMediaType(mediaType):
+		return "", strings.ToValidUTF8(string(body), ""), nil
+	default:
+		return "", "", fmt.Errorf("%w: %s", ErrUnsupportedContentType, mediaType)
+	}
+}
+
+func isTextMediaType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// --- HTML → markdown ---
+
+// skippedHTMLElements 不含正文的元素，整棵子树跳过
+var skippedHTMLElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"iframe": true, "nav": true, "footer": true, "form": true, "button": true, "select": true,
+}
+
+var blockHTMLElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "header": true,
+	"aside": true, "table": true, "tr": true, "ul": true, "ol": true, "dl": true, "dt": true,
+	"dd": true, "figure": true, "figcaption": true, "hr": true,
+}
+
+var excessiveNewlines = regexp.MustCompile(`\n{3,}`)
+
+type markdownWriter struct {
+	sb    strings.Builder
+	base  *url.URL
+	title string
+	pre   int
+}
+
+func htmlToMarkdown(r io.Reader, base *url.URL) (string, string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: parse html: %s", ErrUnsupportedContentType, err.Error())
+	}
+	w := &markdownWriter{base: base}
+	w.walk(doc)
+
+	lines := strings.Split(w.sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	content := excessiveNewlines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return w.title, strings.TrimSpace(content), nil
+}
+
+func (w *markdownWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+		// handled below
+	default:
+		w.children(n)
+		return
+	}
+
+	tag := n.Data
+	if skippedHTMLElements[tag] {
+		return
+	}
+	switch tag {
+	case "head":
+		if t := findHTMLElement(n, "title"); t != nil {
+			w.title = strings.TrimSpace(collapseWhitespace(nodeText(t)))
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(tag[1] - '0')
+		w.sb.WriteString("\n\n" + strings.Repeat("#", level) + " ")
+		w.children(n)
+		w.sb.WriteString("\n\n")
+	case "br":
+		w.sb.WriteString("\n")
+	case "li":
+		w.sb.WriteString("\n- ")
+		w.children(n)
+	case "pre":
+		w.sb.WriteString("\n\n```\n")
+		w.pre++
+		w.children(n)
+		w.pre--
+		w.sb.WriteString("\n```\n\n")
+	case "code":
+		if w.pre > 0 {
+			w.children(n)
+			return
+		}
+		w.sb.WriteString("`")
+		w.children(n)
+		w.sb.WriteString("`")
+	case "strong", "b":
+		w.wrap(n, "**")
+	case "em", "i":
+		w.wrap(n, "_")
+	case "blockquote":
+		w.sb.WriteString("\n\n> ")
+		w.children(n)
+		w.sb.WriteString("\n\n")
+	case "a":
+		w.link(n)
+	case "td", "th":
+		w.children(n)
+		w.sb.WriteString(" | ")
+	case "img":
+		if alt := strings.TrimSpace(htmlAttr(n, "alt")); alt != "" {
+			w.sb.WriteString("[image: " + alt + "]")
+		}
+	default:
+		if blockHTMLElements[tag] {
+			w.sb.WriteString("\n\n")
+			w.children(n)
+			w.sb.WriteString("\n\n")
+			return
+		}
+		w.children(n)
+	}
+}
+
+func (w *markdownWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+func (w *markdownWriter) wrap(n *html.Node, marker string) {
+	text := strings.TrimSpace(collapseWhitespace(nodeText(n)))
+	if text == "" {
+		return
+	}
+	w.sb.WriteString(marker + text + marker)
+}
+
+func (w *markdownWriter) link(n *html.Node) {
+	text := strings.TrimSpace(collapseWhitespace(nodeText(n)))
+	href := strings.TrimSpace(htmlAttr(n, "href"))
+	target := ""
+	if href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		if u, err := url.Parse(href); err == nil {
+			if w.base != nil {
+				u = w.base.ResolveReference(u)
+			}
+			if u.Scheme == "http" || u.Scheme == "https" {
+				target = u.String()
+			}
+		}
+	}
+	switch {
+	case text == "":
+		return
+	case target == "":
+		w.sb.WriteString(text)
+	default:
+		w.sb.WriteString("[" + text + "](" + target + ")")
+	}
+}
+
+func (w *markdownWriter) text(data string) {
+	if w.pre > 0 {
+		w.sb.WriteString(data)
+		return
+	}
+	text := collapseWhitespace(data)
+	if strings.TrimSpace(text) == "" {
+		if text != "" && !strings.HasSuffix(w.sb.String(), " ") && !strings.HasSuffix(w.sb.String(), "\n") {
+			w.sb.WriteString(" ")
+		}
+		return
+	}
+	w.sb.WriteString(text)
+}
+
+func collapseWhitespace(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\n' || r == '\t' || r == '\r' || r == '\f' {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && skippedHTMLElements[n.Data] {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func findHTMLElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findHTMLElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
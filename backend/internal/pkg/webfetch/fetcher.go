@@ -0,0 +1,208 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/httpclient"
+	"github.com/Wei-Shaw/sub2api/internal/util/urlvalidator"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	quotaKeyPrefix = "webfetch:quota:"
+	quotaKeyTTL    = 32 * 24 * time.Hour
+
+	fetchUserAgent = "Mozilla/5.0 (compatible; sub2api-webfetch/1.0)"
+	fetchAccept    = "text/html,application/xhtml+xml,application/pdf,text/plain;q=0.9,*/*;q=0.5"
+)
+
+// Fetcher downloads web pages for web_fetch emulation with SSRF protection:
+// every URL (including redirect targets) is checked against the scheme/host policy.
+// On direct connections the shared client re-resolves the host in its dialer and only
+// connects to validated public IPs, so DNS rebinding between the check and the dial
+// (or on a redirect) is rejected. Through an account proxy the proxy resolves the
+// target, so only the pre-request lookup applies.
+type Fetcher struct {
+	opts  Options
+	redis *redis.Client
+	now   func() time.Time
+}
+
+// NewFetcher creates a Fetcher; zero-valued limits fall back to defaults.
+func NewFetcher(opts Options, redisClient *redis.Client) *Fetcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MaxResponseBytes <= 0 {
+		opts.MaxResponseBytes = defaultMaxResponseBytes
+	}
+	if opts.MaxContentChars <= 0 {
+		opts.MaxContentChars = defaultMaxContentChars
+	}
+	if opts.MaxRedirects <= 0 {
+		opts.MaxRedirects = defaultMaxRedirects
+	}
+	return &Fetcher{opts: opts, redis: redisClient, now: time.Now}
+}
+
+// Fetch validates the URL, reserves quota, downloads the document and converts it to text.
+// Quota is rolled back when the fetch fails.
+func (f *Fetcher) Fetch(ctx context.Context, req FetchRequest) (*FetchResponse, error) {
+	target, err := f.validateURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := f.reserveQuota(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.fetch(ctx, target, req.ProxyURL)
+	if err != nil {
+		if reserved {
+			f.rollbackQuota(ctx)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (f *Fetcher) validateURL(raw string) (string, error) {
+	if _, err := urlvalidator.ValidateHTTPURL(raw, f.opts.AllowInsecureHTTP, urlvalidator.ValidationOptions{
+		AllowedHosts: f.opts.AllowedHosts,
+		AllowPrivate: f.opts.AllowPrivateHosts,
+	}); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrURLNotAllowed, err.Error())
+	}
+	return strings.TrimSpace(raw), nil
+}
+
+func (f *Fetcher) fetch(ctx context.Context, target, proxyURL string) (*FetchResponse, error) {
+	shared, err := httpclient.GetClient(httpclient.Options{
+		ProxyURL:           proxyURL,
+		Timeout:            f.opts.Timeout,
+		ValidateResolvedIP: true,
+		AllowPrivateHosts:  f.opts.AllowPrivateHosts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("webfetch: http client: %w", err)
+	}
+	// 共享客户端按值复制，仅覆盖重定向策略
+	client := *shared
+	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+		if len(via) > f.opts.MaxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrURLNotAccessible, f.opts.MaxRedirects)
+		}
+		_, err := f.validateURL(r.URL.String())
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrURLNotAllowed, err.Error())
+	}
+	httpReq.Header.Set("User-Agent", fetchUserAgent)
+	httpReq.Header.Set("Accept", fetchAccept)
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		if errors.Is(err, ErrURLNotAllowed) || errors.Is(err, ErrURLNotAccessible) {
+			return nil, err
+		}
+		// DNS Rebinding 校验失败（解析或拨号时得到私网地址）由共享客户端返回
+		if strings.Contains(err.Error(), "resolved ip") {
+			return nil, fmt.Errorf("%w: %s", ErrURLNotAllowed, err.Error())
+		}
+		return nil, fmt.Errorf("%w: %s", ErrURLNotAccessible, err.Error())
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("%w: status %d", ErrURLNotAccessible, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.opts.MaxResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: read body: %s", ErrURLNotAccessible, err.Error())
+	}
+	truncated := false
+	if int64(len(body)) > f.opts.MaxResponseBytes {
+		body = body[:f.opts.MaxResponseBytes]
+		truncated = true
+	}
+
+	rawContentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(rawContentType)
+	if err != nil || mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+
+	title, content, err := convertDocument(body, mediaType, rawContentType, resp.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(content) > f.opts.MaxContentChars {
+		content = string([]rune(content)[:f.opts.MaxContentChars])
+		truncated = true
+	}
+
+	return &FetchResponse{
+		URL:         resp.Request.URL.String(),
+		Title:       title,
+		ContentType: mediaType,
+		Content:     content,
+		Truncated:   truncated,
+		RetrievedAt: f.now().UTC(),
+	}, nil
+}
+
+// --- Quota management ---
+
+func (f *Fetcher) quotaKey() string {
+	return quotaKeyPrefix + f.now().UTC().Format("2006-01")
+}
+
+func (f *Fetcher) reserveQuota(ctx context.Context) (bool, error) {
+	if f.redis == nil {
+		return false, nil
+	}
+	key := f.quotaKey()
+	pipe := f.redis.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, quotaKeyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Warn("webfetch: quota INCR failed, allowing request", "error", err)
+		return false, nil
+	}
+	if f.opts.QuotaLimit > 0 && incr.Val() > f.opts.QuotaLimit {
+		f.rollbackQuota(ctx)
+		return false, ErrQuotaExceeded
+	}
+	return true, nil
+}
+
+func (f *Fetcher) rollbackQuota(ctx context.Context) {
+	if err := f.redis.Decr(ctx, f.quotaKey()).Err(); err != nil {
+		slog.Warn("webfetch: quota rollback DECR failed", "error", err)
+	}
+}
+
+// GetUsage returns the number of successful fetches in the current month.
+func (f *Fetcher) GetUsage(ctx context.Context) (int64, error) {
+	if f.redis == nil {
+		return 0, nil
+	}
+	val, err := f.redis.Get(ctx, f.quotaKey()).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return val, err
+}
@@ -0,0 +1,132 @@
+package webfetch
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFetcher(opts Options) *Fetcher {
+	opts.AllowInsecureHTTP = true
+	return NewFetcher(opts, nil)
+}
+
+func TestFetcher_Fetch_HTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Go Release</title><script>var x=1</script></head>` +
+			`<body><nav>menu</nav><h1>Go 1.26</h1><p>Released <b>today</b>. See <a href="/notes">notes</a>.</p>` +
+			`<ul><li>one</li><li>two</li></ul></body></html>`))
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(Options{AllowPrivateHosts: true})
+	resp, err := f.Fetch(context.Background(), FetchRequest{URL: srv.URL + "/page"})
+	require.NoError(t, err)
+	require.Equal(t, "Go Release", resp.Title)
+	require.Equal(t, "text/html", resp.ContentType)
+	require.Contains(t, resp.Content, "# Go 1.26")
+	require.Contains(t, resp.Content, "**today**")
+	require.Contains(t, resp.Content, "[notes]("+srv.URL+"/notes)")
+	require.Contains(t, resp.Content, "- one")
+	require.NotContains(t, resp.Content, "var x")
+	require.NotContains(t, resp.Content, "menu")
+}
+
+func TestFetcher_Fetch_BlocksPrivateHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("private host must not be requested")
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(Options{})
+	_, err := f.Fetch(context.Background(), FetchRequest{URL: srv.URL})
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+
+	_, err = f.Fetch(context.Background(), FetchRequest{URL: "http://localhost/admin"})
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+}
+
+func TestFetcher_Fetch_RejectsScheme(t *testing.T) {
+	f := NewFetcher(Options{AllowPrivateHosts: true}, nil)
+	_, err := f.Fetch(context.Background(), FetchRequest{URL: "http://example.com"})
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+
+	_, err = f.Fetch(context.Background(), FetchRequest{URL: "file:///etc/passwd"})
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+}
+
+func TestFetcher_Fetch_RedirectOutsideAllowlist(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("redirect target must not be requested")
+	}))
+	defer target.Close()
+	targetURL, err := url.Parse(target.URL)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+targetURL.Port(), http.StatusFound)
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(Options{AllowPrivateHosts: true, AllowedHosts: []string{"127.0.0.1"}})
+	_, err = f.Fetch(context.Background(), FetchRequest{URL: srv.URL})
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+}
+
+func TestFetcher_Fetch_Limits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(bytes.Repeat([]byte("a"), 4096))
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(Options{AllowPrivateHosts: true, MaxResponseBytes: 1024, MaxContentChars: 100})
+	resp, err := f.Fetch(context.Background(), FetchRequest{URL: srv.URL})
+	require.NoError(t, err)
+	require.True(t, resp.Truncated)
+	require.Len(t, resp.Content, 100)
+}
+
+func TestFetcher_Fetch_StatusAndContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte{0x89, 'P', 'N', 'G'})
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(Options{AllowPrivateHosts: true})
+	_, err := f.Fetch(context.Background(), FetchRequest{URL: srv.URL + "/missing"})
+	require.ErrorIs(t, err, ErrURLNotAccessible)
+
+	_, err = f.Fetch(context.Background(), FetchRequest{URL: srv.URL + "/image"})
+	require.ErrorIs(t, err, ErrUnsupportedContentType)
+}
+
+func TestPDFToText(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 712 Td (Hello PDF) Tj T* [(World) -250 (wide)] TJ ET")
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, _ = zw.Write(content)
+	_ = zw.Close()
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Length 10 /Filter /FlateDecode >>\nstream\n")
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n")
+	pdf.WriteString("2 0 obj\n<< /Length 5 >>\nstream\nBT (Plain \\(text\\)) Tj ET\nendstream\nendobj\n%%EOF")
+
+	text := pdfToText(pdf.Bytes())
+	require.Contains(t, text, "Hello PDF")
+	require.Contains(t, text, "World wide")
+	require.Contains(t, text, "Plain (text)")
+}
@@ -0,0 +1,215 @@
+package webfetch
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxPDFStreamBytes 单个内容流解压上限，防止压缩炸弹
+const maxPDFStreamBytes = 8 << 20
+
+// pdfToText is a best-effort PDF text extractor: it inflates FlateDecode content
+// streams and collects strings shown by the Tj/TJ/'/" text operators. PDFs using
+// custom font encodings or other filters yield little or no text.
+func pdfToText(data []byte) string {
+	var out strings.Builder
+	rest := data
+	for {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		dict := rest[:start]
+		if i := bytes.LastIndex(dict, []byte("<<")); i >= 0 {
+			dict = dict[i:]
+		}
+		body := rest[start+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := body[:end]
+		rest = body[end+len("endstream"):]
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, ok := inflatePDFStream(stream)
+			if !ok {
+				continue
+			}
+			stream = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		if text := extractPDFText(stream); strings.TrimSpace(text) != "" {
+			out.WriteString(text)
+			out.WriteString("\n")
+		}
+	}
+	return strings.TrimSpace(excessiveNewlines.ReplaceAllString(out.String(), "\n\n"))
+}
+
+func inflatePDFStream(stream []byte) ([]byte, bool) {
+	r, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = r.Close() }()
+	out, err := io.ReadAll(io.LimitReader(r, maxPDFStreamBytes))
+	if err != nil && len(out) == 0 {
+		return nil, false
+	}
+	return out, true
+}
+
+// extractPDFText walks a content stream and collects text-showing operands.
+func extractPDFText(stream []byte) string {
+	var sb strings.Builder
+	var operands []string
+	inArray := false
+	for i := 0; i < len(stream); {
+		c := stream[i]
+		switch {
+		case c == '(':
+			s, next := readPDFLiteral(stream, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(stream) && stream[i+1] != '<':
+			end := bytes.IndexByte(stream[i:], '>')
+			if end < 0 {
+				return sb.String()
+			}
+			operands = append(operands, decodePDFHex(stream[i+1:i+end]))
+			i += end + 1
+		case c == '[':
+			inArray = true
+			operands = operands[:0]
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(stream) && (stream[i] == '-' || stream[i] == '.' || (stream[i] >= '0' && stream[i] <= '9')) {
+				i++
+			}
+			// TJ 数组中较大的负偏移通常表示词间空格
+			if inArray && stream[start] == '-' && i-start >= 4 {
+				operands = append(operands, " ")
+			}
+		case isPDFRegular(c):
+			start := i
+			for i < len(stream) && isPDFRegular(stream[i]) {
+				i++
+			}
+			switch string(stream[start:i]) {
+			case "Tj", "TJ":
+				sb.WriteString(strings.Join(operands, ""))
+			case "'", "\"":
+				sb.WriteString("\n" + strings.Join(operands, ""))
+			case "T*", "Td", "TD", "ET":
+				sb.WriteString("\n")
+			}
+			if !inArray {
+				operands = operands[:0]
+			}
+		default:
+			i++
+		}
+	}
+	return sb.String()
+}
+
+func isPDFRegular(c byte) bool {
+	return c > ' ' && !strings.ContainsRune("()<>[]{}/%", rune(c)) && !(c >= '0' && c <= '9') && c != '-' && c != '.'
+}
+
+func readPDFLiteral(stream []byte, i int) (string, int) {
+	var buf []byte
+	depth := 0
+	for i < len(stream) {
+		c := stream[i]
+		switch {
+		case c == '\\' && i+1 < len(stream):
+			i++
+			switch e := stream[i]; e {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r', 't', 'b', 'f':
+				buf = append(buf, ' ')
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v, n := 0, 0
+					for n < 3 && i < len(stream) && stream[i] >= '0' && stream[i] <= '7' {
+						v = v*8 + int(stream[i]-'0')
+						i++
+						n++
+					}
+					buf = append(buf, byte(v))
+					continue
+				}
+				buf = append(buf, e)
+			}
+		case c == '(':
+			if depth > 0 {
+				buf = append(buf, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return decodePDFBytes(buf), i + 1
+			}
+			buf = append(buf, c)
+		default:
+			buf = append(buf, c)
+		}
+		i++
+	}
+	return decodePDFBytes(buf), i
+}
+
+func decodePDFHex(raw []byte) string {
+	clean := bytes.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, raw)
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	b, err := hex.DecodeString(string(clean))
+	if err != nil {
+		return ""
+	}
+	return decodePDFBytes(b)
+}
+
+// decodePDFBytes handles UTF-16BE strings (with BOM) and falls back to Latin-1.
+func decodePDFBytes(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		u := make([]uint16, 0, (len(b)-2)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,51 @@
+package webfetch
+
+import (
+	"errors"
+	"time"
+)
+
+// FetchRequest describes a URL to fetch.
+type FetchRequest struct {
+	URL      string
+	ProxyURL string // optional HTTP/SOCKS proxy URL (account proxy)
+}
+
+// FetchResponse holds a fetched document converted to plain text or markdown.
+type FetchResponse struct {
+	URL         string // final URL after redirects
+	Title       string
+	ContentType string // media type of the original response
+	Content     string
+	Truncated   bool // content was cut by MaxResponseBytes or MaxContentChars
+	RetrievedAt time.Time
+}
+
+// Options configures a Fetcher.
+type Options struct {
+	AllowedHosts      []string // optional host allowlist (supports *.example.com)
+	AllowPrivateHosts bool     // allow localhost/private IPs (trusted networks only)
+	AllowInsecureHTTP bool     // allow http:// URLs in addition to https://
+
+	Timeout          time.Duration // total request timeout
+	MaxResponseBytes int64         // max response body bytes to read
+	MaxContentChars  int           // max characters of converted content
+	MaxRedirects     int
+
+	QuotaLimit int64 // monthly fetch quota, 0 = unlimited
+}
+
+const (
+	defaultTimeout          = 30 * time.Second
+	defaultMaxResponseBytes = 10 << 20
+	defaultMaxContentChars  = 100000
+	defaultMaxRedirects     = 5
+)
+
+// Errors returned by Fetch. Callers map them to web_fetch_tool_error codes.
+var (
+	ErrURLNotAllowed          = errors.New("webfetch: url not allowed")
+	ErrURLNotAccessible       = errors.New("webfetch: url not accessible")
+	ErrUnsupportedContentType = errors.New("webfetch: unsupported content type")
+	ErrQuotaExceeded          = errors.New("webfetch: quota exceeded")
+)
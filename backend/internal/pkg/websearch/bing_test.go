@@ -0,0 +1,50 @@
+package websearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBingProvider_Name(t *testing.T) {
+	p := NewBingProvider("key", "", nil)
+	require.Equal(t, "bing", p.Name())
+	require.Equal(t, bingSearchEndpoint, p.endpoint)
+}
+
+func TestBingProvider_Search_Success(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "test-key", r.Header.Get("Ocp-Apim-Subscription-Key"))
+		require.Equal(t, "golang", r.URL.Query().Get("q"))
+		require.Equal(t, "4", r.URL.Query().Get("count"))
+		require.Equal(t, "Webpages", r.URL.Query().Get("responseFilter"))
+		_, _ = w.Write([]byte(`{"webPages":{"value":[
+			{"name":"Go","url":"https://go.dev","snippet":"Go lang","datePublished":"2024-03-01T00:00:00"}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	p := NewBingProvider("test-key", srv.URL, srv.Client())
+	resp, err := p.Search(context.Background(), SearchRequest{Query: "golang", MaxResults: 4})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	require.Equal(t, SearchResult{URL: "https://go.dev", Title: "Go", Snippet: "Go lang", PageAge: "2024-03-01T00:00:00"}, resp.Results[0])
+}
+
+func TestBingProvider_Search_ClampsCount(t *testing.T) {
+	var receivedCount string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedCount = r.URL.Query().Get("count")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	p := NewBingProvider("key", srv.URL, srv.Client())
+	resp, err := p.Search(context.Background(), SearchRequest{Query: "x", MaxResults: 500})
+	require.NoError(t, err)
+	require.Empty(t, resp.Results)
+	require.Equal(t, "50", receivedCount)
+}
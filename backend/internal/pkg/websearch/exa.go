@@ -0,0 +1,116 @@
+package websearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	exaSearchEndpoint     = "https://api.exa.ai/search"
+	exaProviderName       = "exa"
+	exaMaxResults         = 100
+	exaSnippetMaxChars    = 500
+	exaSearchTypeAuto     = "auto"
+	exaHighlightsPerURL   = 1
+	exaHighlightSentences = 3
+)
+
+// ExaProvider implements web search via the Exa Search API.
+type ExaProvider struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewExaProvider creates an Exa Search provider.
+// baseURL overrides the default endpoint (empty = https://api.exa.ai/search).
+// The caller is responsible for configuring the http.Client with proxy/timeouts.
+func NewExaProvider(apiKey, baseURL string, httpClient *http.Client) *ExaProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &ExaProvider{apiKey: apiKey, endpoint: resolveEndpoint(baseURL, exaSearchEndpoint), httpClient: httpClient}
+}
+
+func (e *ExaProvider) Name() string { return exaProviderName }
+
+func (e *ExaProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	payload := exaRequest{
+		Query:      req.Query,
+		NumResults: resolveMaxResults(req.MaxResults, exaMaxResults),
+		Type:       exaSearchTypeAuto,
+	}
+	payload.Contents.Text.MaxCharacters = exaSnippetMaxChars
+	payload.Contents.Highlights.HighlightsPerURL = exaHighlightsPerURL
+	payload.Contents.Highlights.NumSentences = exaHighlightSentences
+
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("exa: encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("exa: build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("x-api-key", e.apiKey)
+
+	body, err := doSearchRequest(e.httpClient, httpReq, exaProviderName)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw exaResponse
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("exa: decode response: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(raw.Results))
+	for _, r := range raw.Results {
+		// Highlights are query-relevant excerpts; fall back to the leading page text.
+		snippet := r.Text
+		if len(r.Highlights) > 0 && r.Highlights[0] != "" {
+			snippet = r.Highlights[0]
+		}
+		results = append(results, SearchResult{
+			URL:     r.URL,
+			Title:   r.Title,
+			Snippet: snippet,
+			PageAge: r.PublishedDate,
+		})
+	}
+
+	return &SearchResponse{Results: results, Query: req.Query}, nil
+}
+
+type exaRequest struct {
+	Query      string `json:"query"`
+	NumResults int    `json:"numResults"`
+	Type       string `json:"type"`
+	Contents   struct {
+		Text struct {
+			MaxCharacters int `json:"maxCharacters"`
+		} `json:"text"`
+		Highlights struct {
+			HighlightsPerURL int `json:"highlightsPerUrl"`
+			NumSentences     int `json:"numSentences"`
+		} `json:"highlights"`
+	} `json:"contents"`
+}
+
+type exaResponse struct {
+	Results []exaResult `json:"results"`
+}
+
+type exaResult struct {
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	PublishedDate string   `json:"publishedDate"`
+	Text          string   `json:"text"`
+	Highlights    []string `json:"highlights"`
+}
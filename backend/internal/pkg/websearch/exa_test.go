@@ -0,0 +1,55 @@
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExaProvider_Name(t *testing.T) {
+	p := NewExaProvider("key", "", nil)
+	require.Equal(t, "exa", p.Name())
+	require.Equal(t, exaSearchEndpoint, p.endpoint)
+}
+
+func TestExaProvider_Search_Success(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "test-key", r.Header.Get("x-api-key"))
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "golang", body["query"])
+		require.Equal(t, float64(3), body["numResults"])
+
+		_, _ = w.Write([]byte(`{"results":[
+			{"url":"https://go.dev","title":"Go","publishedDate":"2024-05-01","text":"full text","highlights":["Go is fast"]},
+			{"url":"https://pkg.go.dev","title":"Pkg","text":"Packages"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	p := NewExaProvider("test-key", srv.URL, srv.Client())
+	resp, err := p.Search(context.Background(), SearchRequest{Query: "golang", MaxResults: 3})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 2)
+	require.Equal(t, "Go is fast", resp.Results[0].Snippet)
+	require.Equal(t, "2024-05-01", resp.Results[0].PageAge)
+	require.Equal(t, "Packages", resp.Results[1].Snippet)
+}
+
+func TestExaProvider_Search_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid api key"}`))
+	}))
+	defer srv.Close()
+
+	p := NewExaProvider("bad", srv.URL, srv.Client())
+	_, err := p.Search(context.Background(), SearchRequest{Query: "x"})
+	require.ErrorContains(t, err, "exa: status 401")
+}
@@ -0,0 +1,248 @@
+package websearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	genericJSONProviderName   = "generic_json"
+	genericJSONDefaultParam   = "q"
+	genericJSONDefaultKeyHdr  = "Authorization"
+	genericJSONDefaultKeyPref = "Bearer "
+	genericJSONQueryToken     = "{{query}}"
+	genericJSONMaxToken       = "{{max_results}}"
+)
+
+// GenericJSONConfig describes how to call an arbitrary HTTP search API and map its JSON response.
+//
+// Paths use a JSONPath-style subset: "$.data.items", "$.items[0].link" or the
+// equivalent dotted form "data.items". Field paths are evaluated relative to each
+// element of the array selected by ResultsPath.
+type GenericJSONConfig struct {
+	Method       string            `json:"method,omitempty"`         // GET (default) | POST
+	QueryParam   string            `json:"query_param,omitempty"`    // GET: query string name for the search terms (default "q")
+	CountParam   string            `json:"count_param,omitempty"`    // GET: optional query string name for the result count
+	BodyTemplate string            `json:"body_template,omitempty"`  // POST: JSON body; {{query}} and {{max_results}} are substituted
+	APIKeyHeader string            `json:"api_key_header,omitempty"` // header carrying the API key (default "Authorization")
+	APIKeyPrefix string            `json:"api_key_prefix,omitempty"` // prefix for the key value (default "Bearer " with the default header)
+	Headers      map[string]string `json:"headers,omitempty"`        // extra static request headers
+	ResultsPath  string            `json:"results_path"`             // path to the result array
+	URLPath      string            `json:"url_path"`                 // per-result URL field
+	TitlePath    string            `json:"title_path"`               // per-result title field
+	SnippetPath  string            `json:"snippet_path,omitempty"`   // per-result snippet field
+	PageAgePath  string            `json:"page_age_path,omitempty"`  // per-result date/age field
+}
+
+// Validate checks that the mapping is complete and the request shape is consistent.
+func (c *GenericJSONConfig) Validate() error {
+	if c == nil {
+		return fmt.Errorf("generic config is required")
+	}
+	switch strings.ToUpper(strings.TrimSpace(c.Method)) {
+	case "", http.MethodGet:
+	case http.MethodPost:
+		if strings.TrimSpace(c.BodyTemplate) == "" {
+			return fmt.Errorf("body_template is required for POST")
+		}
+		if !strings.Contains(c.BodyTemplate, genericJSONQueryToken) {
+			return fmt.Errorf("body_template must contain %s", genericJSONQueryToken)
+		}
+	default:
+		return fmt.Errorf("unsupported method %q", c.Method)
+	}
+	if strings.TrimSpace(c.ResultsPath) == "" {
+		return fmt.Errorf("results_path is required")
+	}
+	if strings.TrimSpace(c.URLPath) == "" {
+		return fmt.Errorf("url_path is required")
+	}
+	if strings.TrimSpace(c.TitlePath) == "" {
+		return fmt.Errorf("title_path is required")
+	}
+	return nil
+}
+
+// GenericJSONProvider implements web search against any HTTP endpoint returning JSON.
+type GenericJSONProvider struct {
+	endpoint   string
+	apiKey     string
+	cfg        GenericJSONConfig
+	httpClient *http.Client
+}
+
+// NewGenericJSONProvider creates a provider calling baseURL with the given mapping.
+// apiKey is optional. The caller is responsible for configuring the http.Client with proxy/timeouts.
+func NewGenericJSONProvider(baseURL, apiKey string, cfg *GenericJSONConfig, httpClient *http.Client) *GenericJSONProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	p := &GenericJSONProvider{endpoint: strings.TrimSpace(baseURL), apiKey: apiKey, httpClient: httpClient}
+	if cfg != nil {
+		p.cfg = *cfg
+	}
+	return p
+}
+
+func (g *GenericJSONProvider) Name() string { return genericJSONProviderName }
+
+func (g *GenericJSONProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	if g.endpoint == "" {
+		return nil, fmt.Errorf("generic_json: base_url not configured")
+	}
+	if err := g.cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("generic_json: %w", err)
+	}
+	maxResults := resolveMaxResults(req.MaxResults, 0)
+
+	httpReq, err := g.buildRequest(ctx, req.Query, maxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := doSearchRequest(g.httpClient, httpReq, genericJSONProviderName)
+	if err != nil {
+		return nil, err
+	}
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("generic_json: decode response: invalid JSON")
+	}
+
+	items := gjson.GetBytes(body, toGJSONPath(g.cfg.ResultsPath))
+	if !items.IsArray() {
+		return nil, fmt.Errorf("generic_json: results_path %q does not resolve to an array", g.cfg.ResultsPath)
+	}
+
+	urlPath := toGJSONPath(g.cfg.URLPath)
+	titlePath := toGJSONPath(g.cfg.TitlePath)
+	snippetPath := toGJSONPath(g.cfg.SnippetPath)
+	agePath := toGJSONPath(g.cfg.PageAgePath)
+
+	results := make([]SearchResult, 0, maxResults)
+	for _, item := range items.Array() {
+		if len(results) >= maxResults {
+			break
+		}
+		u := strings.TrimSpace(item.Get(urlPath).String())
+		if u == "" {
+			continue
+		}
+		r := SearchResult{URL: u, Title: item.Get(titlePath).String()}
+		if g.cfg.SnippetPath != "" {
+			r.Snippet = item.Get(snippetPath).String()
+		}
+		if g.cfg.PageAgePath != "" {
+			r.PageAge = item.Get(agePath).String()
+		}
+		results = append(results, r)
+	}
+
+	return &SearchResponse{Results: results, Query: req.Query}, nil
+}
+
+func (g *GenericJSONProvider) buildRequest(ctx context.Context, query string, maxResults int) (*http.Request, error) {
+	var (
+		method = http.MethodGet
+		target = g.endpoint
+		body   io.Reader
+	)
+	if strings.EqualFold(strings.TrimSpace(g.cfg.Method), http.MethodPost) {
+		method = http.MethodPost
+		payload, err := renderGenericJSONBody(g.cfg.BodyTemplate, query, maxResults)
+		if err != nil {
+			return nil, fmt.Errorf("generic_json: %w", err)
+		}
+		body = bytes.NewReader(payload)
+	} else {
+		u, err := url.Parse(g.endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("generic_json: invalid base_url: %w", err)
+		}
+		q := u.Query()
+		param := strings.TrimSpace(g.cfg.QueryParam)
+		if param == "" {
+			param = genericJSONDefaultParam
+		}
+		q.Set(param, query)
+		if cp := strings.TrimSpace(g.cfg.CountParam); cp != "" {
+			q.Set(cp, strconv.Itoa(maxResults))
+		}
+		u.RawQuery = q.Encode()
+		target = u.String()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("generic_json: build request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if method == http.MethodPost {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range g.cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if g.apiKey != "" {
+		header, prefix := strings.TrimSpace(g.cfg.APIKeyHeader), g.cfg.APIKeyPrefix
+		if header == "" {
+			header = genericJSONDefaultKeyHdr
+			if prefix == "" {
+				prefix = genericJSONDefaultKeyPref
+			}
+		}
+		httpReq.Header.Set(header, prefix+g.apiKey)
+	}
+	return httpReq, nil
+}
+
+// renderGenericJSONBody substitutes the placeholders in tmpl with JSON-safe values.
+// {{query}} is replaced by the escaped string content (the template supplies the quotes),
+// {{max_results}} by a bare number.
+func renderGenericJSONBody(tmpl, query string, maxResults int) ([]byte, error) {
+	quoted, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("encode query: %w", err)
+	}
+	escaped := string(quoted[1 : len(quoted)-1])
+	out := strings.ReplaceAll(tmpl, genericJSONQueryToken, escaped)
+	out = strings.ReplaceAll(out, genericJSONMaxToken, strconv.Itoa(maxResults))
+	if !json.Valid([]byte(out)) {
+		return nil, fmt.Errorf("body_template does not render to valid JSON")
+	}
+	return []byte(out), nil
+}
+
+// toGJSONPath converts a JSONPath-style expression ("$.a.b[0].c", "$['a']") into gjson
+// syntax ("a.b.0.c"). Plain dotted paths pass through unchanged; "$" selects the root.
+func toGJSONPath(path string) string {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '[':
+			b.WriteByte('.')
+		case ']', '\'', '"':
+			// drop bracket terminators and quoted-key delimiters
+		default:
+			b.WriteByte(c)
+		}
+	}
+	out := strings.Trim(b.String(), ".")
+	for strings.Contains(out, "..") {
+		out = strings.ReplaceAll(out, "..", ".")
+	}
+	if out == "" {
+		return "@this"
+	}
+	return out
+}
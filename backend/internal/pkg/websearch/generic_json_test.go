@@ -0,0 +1,125 @@
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericJSONProvider_Name(t *testing.T) {
+	p := NewGenericJSONProvider("http://localhost", "", nil, nil)
+	require.Equal(t, "generic_json", p.Name())
+}
+
+func TestGenericJSONProvider_Search_GET(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodGet, r.Method)
+		require.Equal(t, "golang", r.URL.Query().Get("query"))
+		require.Equal(t, "2", r.URL.Query().Get("limit"))
+		require.Equal(t, "v1", r.URL.Query().Get("version")) // preserved from base_url
+		require.Equal(t, "Token secret", r.Header.Get("X-Auth"))
+		require.Equal(t, "yes", r.Header.Get("X-Extra"))
+		_, _ = w.Write([]byte(`{"data":{"items":[
+			{"link":"https://go.dev","meta":{"title":"Go"},"summary":["Go lang"],"date":"2024"},
+			{"link":"","meta":{"title":"skipped"}},
+			{"link":"https://pkg.go.dev","meta":{"title":"Pkg"}},
+			{"link":"https://tour.go.dev","meta":{"title":"Tour"}}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	p := NewGenericJSONProvider(srv.URL+"/api?version=v1", "secret", &GenericJSONConfig{
+		QueryParam:   "query",
+		CountParam:   "limit",
+		APIKeyHeader: "X-Auth",
+		APIKeyPrefix: "Token ",
+		Headers:      map[string]string{"X-Extra": "yes"},
+		ResultsPath:  "$.data.items",
+		URLPath:      "$.link",
+		TitlePath:    "$.meta.title",
+		SnippetPath:  "$.summary[0]",
+		PageAgePath:  "date",
+	}, srv.Client())
+
+	resp, err := p.Search(context.Background(), SearchRequest{Query: "golang", MaxResults: 2})
+	require.NoError(t, err)
+	require.Equal(t, []SearchResult{
+		{URL: "https://go.dev", Title: "Go", Snippet: "Go lang", PageAge: "2024"},
+		{URL: "https://pkg.go.dev", Title: "Pkg"},
+	}, resp.Results)
+}
+
+func TestGenericJSONProvider_Search_POSTTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Equal(t, "Bearer k", r.Header.Get("Authorization"))
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(raw, &body))
+		require.Equal(t, `say "hi"`, body["q"])
+		require.Equal(t, float64(5), body["n"])
+		_, _ = w.Write([]byte(`[{"u":"https://a.example","t":"A"}]`))
+	}))
+	defer srv.Close()
+
+	p := NewGenericJSONProvider(srv.URL, "k", &GenericJSONConfig{
+		Method:       "post",
+		BodyTemplate: `{"q":"{{query}}","n":{{max_results}}}`,
+		ResultsPath:  "$",
+		URLPath:      "u",
+		TitlePath:    "t",
+	}, srv.Client())
+
+	resp, err := p.Search(context.Background(), SearchRequest{Query: `say "hi"`})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	require.Equal(t, "https://a.example", resp.Results[0].URL)
+}
+
+func TestGenericJSONProvider_Search_ResultsPathNotArray(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"items":"nope"}}`))
+	}))
+	defer srv.Close()
+
+	p := NewGenericJSONProvider(srv.URL, "", &GenericJSONConfig{
+		ResultsPath: "$.data.items", URLPath: "url", TitlePath: "title",
+	}, srv.Client())
+	_, err := p.Search(context.Background(), SearchRequest{Query: "x"})
+	require.ErrorContains(t, err, "does not resolve to an array")
+}
+
+func TestGenericJSONConfig_Validate(t *testing.T) {
+	var nilCfg *GenericJSONConfig
+	require.Error(t, nilCfg.Validate())
+	require.ErrorContains(t, (&GenericJSONConfig{URLPath: "u", TitlePath: "t"}).Validate(), "results_path")
+	require.ErrorContains(t, (&GenericJSONConfig{ResultsPath: "r", TitlePath: "t"}).Validate(), "url_path")
+	require.ErrorContains(t, (&GenericJSONConfig{Method: "PUT", ResultsPath: "r", URLPath: "u", TitlePath: "t"}).Validate(), "unsupported method")
+	require.ErrorContains(t, (&GenericJSONConfig{Method: "POST", BodyTemplate: `{}`, ResultsPath: "r", URLPath: "u", TitlePath: "t"}).Validate(), "{{query}}")
+	require.NoError(t, (&GenericJSONConfig{ResultsPath: "r", URLPath: "u", TitlePath: "t"}).Validate())
+}
+
+func TestRenderGenericJSONBody_InvalidTemplate(t *testing.T) {
+	_, err := renderGenericJSONBody(`{"q":{{query}}}`, "x", 5)
+	require.ErrorContains(t, err, "valid JSON")
+}
+
+func TestToGJSONPath(t *testing.T) {
+	cases := map[string]string{
+		"$":                 "@this",
+		"":                  "@this",
+		"$.data.items":      "data.items",
+		"data.items":        "data.items",
+		"$.items[0].link":   "items.0.link",
+		"$['web']['value']": "web.value",
+	}
+	for in, want := range cases {
+		require.Equal(t, want, toGJSONPath(in), in)
+	}
+}
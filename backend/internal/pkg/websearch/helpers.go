@@ -1,5 +1,12 @@
 package websearch
 
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
 const (
 	maxResponseSize   = 1 << 20 // 1 MB
 	errorBodyTruncLen = 200
@@ -12,3 +19,42 @@ func truncateBody(body []byte) string {
 	}
 	return string(body[:errorBodyTruncLen]) + "...(truncated)"
 }
+
+// doSearchRequest executes httpReq and returns the (size-limited) body of a 200 response.
+// Errors are prefixed with the provider name, matching the per-provider error format.
+func doSearchRequest(httpClient *http.Client, httpReq *http.Request, provider string) ([]byte, error) {
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s: request failed: %w", provider, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%s: read body: %w", provider, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d: %s", provider, resp.StatusCode, truncateBody(body))
+	}
+	return body, nil
+}
+
+// resolveEndpoint returns baseURL (without trailing slash) or fallback when baseURL is empty.
+func resolveEndpoint(baseURL, fallback string) string {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		return fallback
+	}
+	return baseURL
+}
+
+// resolveMaxResults applies the default and an optional provider-specific upper bound.
+func resolveMaxResults(requested, upper int) int {
+	if requested <= 0 {
+		requested = defaultMaxResults
+	}
+	if upper > 0 && requested > upper {
+		requested = upper
+	}
+	return requested
+}
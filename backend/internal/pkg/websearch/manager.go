@@ -21,13 +21,15 @@ import (
 
 // ProviderConfig holds the configuration for a single search provider.
 type ProviderConfig struct {
-	Type         string `json:"type"`                    // ProviderTypeBrave | ProviderTypeTavily
-	APIKey       string `json:"api_key"`                 // secret
-	QuotaLimit   int64  `json:"quota_limit"`             // 0 = unlimited
-	SubscribedAt *int64 `json:"subscribed_at,omitempty"` // subscription start (unix seconds); quota resets monthly from this date
-	ProxyURL     string `json:"-"`                       // resolved proxy URL (not persisted)
-	ProxyID      int64  `json:"-"`                       // resolved proxy ID for unavailability tracking
-	ExpiresAt    *int64 `json:"expires_at,omitempty"`    // optional expiration (unix seconds)
+	Type         string             `json:"type"`                    // one of the ProviderType* constants
+	APIKey       string             `json:"api_key"`                 // secret (optional for searxng / generic_json)
+	BaseURL      string             `json:"base_url,omitempty"`      // endpoint; required for searxng / generic_json, optional override otherwise
+	Generic      *GenericJSONConfig `json:"generic,omitempty"`       // request/response mapping for generic_json
+	QuotaLimit   int64              `json:"quota_limit"`             // 0 = unlimited
+	SubscribedAt *int64             `json:"subscribed_at,omitempty"` // subscription start (unix seconds); quota resets monthly from this date
+	ProxyURL     string             `json:"-"`                       // resolved proxy URL (not persisted)
+	ProxyID      int64              `json:"-"`                       // resolved proxy ID for unavailability tracking
+	ExpiresAt    *int64             `json:"expires_at,omitempty"`    // optional expiration (unix seconds)
 }
 
 // Manager selects providers by quota-weighted load balancing and tracks quota via Redis.
@@ -133,7 +135,7 @@ func (m *Manager) SearchWithBestProvider(ctx context.Context, req SearchRequest)
 	return nil, "", fmt.Errorf("websearch: no available provider (all exhausted or failed)")
 }
 
-// filterAvailableProviders returns providers that have API keys, are not expired,
+// filterAvailableProviders returns providers that have the credentials/endpoint they need, are not expired,
 // and whose proxies are not marked unavailable.
 func (m *Manager) filterAvailableProviders(ctx context.Context, accountProxyURL string) []ProviderConfig {
 	var out []ProviderConfig
@@ -228,7 +230,10 @@ func mergeWeightedResults(withQuota, withoutQuota []weighted, capacity int) []Pr
 }
 
 func (m *Manager) isProviderAvailable(cfg ProviderConfig) bool {
-	if cfg.APIKey == "" {
+	if cfg.APIKey == "" && ProviderRequiresAPIKey(cfg.Type) {
+		return false
+	}
+	if strings.TrimSpace(cfg.BaseURL) == "" && ProviderRequiresBaseURL(cfg.Type) {
 		return false
 	}
 	if cfg.ExpiresAt != nil && time.Now().Unix() > *cfg.ExpiresAt {
@@ -464,6 +469,14 @@ func (m *Manager) buildProvider(cfg ProviderConfig, client *http.Client) Provide
 		return NewBraveProvider(cfg.APIKey, client)
 	case tavilyProviderName:
 		return NewTavilyProvider(cfg.APIKey, client)
+	case searxngProviderName:
+		return NewSearXNGProvider(cfg.BaseURL, cfg.APIKey, client)
+	case exaProviderName:
+		return NewExaProvider(cfg.APIKey, cfg.BaseURL, client)
+	case bingProviderName:
+		return NewBingProvider(cfg.APIKey, cfg.BaseURL, client)
+	case genericJSONProviderName:
+		return NewGenericJSONProvider(cfg.BaseURL, cfg.APIKey, cfg.Generic, client)
 	default:
 		slog.Warn("websearch: unknown provider type, falling back to brave",
 			"type", cfg.Type)
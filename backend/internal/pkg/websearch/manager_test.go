@@ -321,3 +321,47 @@ func TestManager_ResetUsage_NilRedis(t *testing.T) {
 	err := m.ResetUsage(context.Background(), "brave")
 	require.NoError(t, err)
 }
+
+// --- Self-hosted / keyless providers ---
+
+func TestIsProviderAvailable_KeylessProviders(t *testing.T) {
+	m := NewManager(nil, nil)
+	require.True(t, m.isProviderAvailable(ProviderConfig{Type: ProviderTypeSearXNG, BaseURL: "http://searx.local"}))
+	require.False(t, m.isProviderAvailable(ProviderConfig{Type: ProviderTypeSearXNG}), "searxng needs base_url")
+	require.True(t, m.isProviderAvailable(ProviderConfig{Type: ProviderTypeGenericJSON, BaseURL: "http://x"}))
+	require.False(t, m.isProviderAvailable(ProviderConfig{Type: ProviderTypeBing}), "bing needs api key")
+	require.False(t, m.isProviderAvailable(ProviderConfig{Type: ProviderTypeExa}), "exa needs api key")
+}
+
+func TestManager_SearchWithBestProvider_FailoverToSearXNG(t *testing.T) {
+	var bingCalls int
+	bing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		bingCalls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer bing.Close()
+	searx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"results":[{"url":"https://searx.example","title":"S","content":"from searxng"}]}`))
+	}))
+	defer searx.Close()
+
+	m := NewManager([]ProviderConfig{
+		// Quota-limited providers are tried first, so bing is attempted before searxng.
+		{Type: ProviderTypeBing, APIKey: "k", BaseURL: bing.URL, QuotaLimit: 100},
+		{Type: ProviderTypeSearXNG, BaseURL: searx.URL},
+	}, nil)
+	m.clientCache[""] = http.DefaultClient
+
+	resp, providerName, err := m.SearchWithBestProvider(context.Background(), SearchRequest{Query: "test"})
+	require.NoError(t, err)
+	require.Equal(t, 1, bingCalls)
+	require.Equal(t, ProviderTypeSearXNG, providerName)
+	require.Equal(t, "from searxng", resp.Results[0].Snippet)
+}
+
+func TestManager_BuildProvider_NewTypes(t *testing.T) {
+	m := NewManager(nil, nil)
+	for _, typ := range []string{ProviderTypeSearXNG, ProviderTypeExa, ProviderTypeBing, ProviderTypeGenericJSON} {
+		require.Equal(t, typ, m.buildProvider(ProviderConfig{Type: typ}, http.DefaultClient).Name())
+	}
+}
@@ -0,0 +1,101 @@
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	searxngProviderName = "searxng"
+	searxngSearchPath   = "/search"
+	searxngMaxResults   = 50
+)
+
+// SearXNGProvider implements web search via a (typically self-hosted) SearXNG instance.
+// The instance must have the "json" output format enabled in settings.yml.
+type SearXNGProvider struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewSearXNGProvider creates a SearXNG provider for the instance at baseURL.
+// apiKey is optional; when set it is sent as a Bearer token for instances behind an
+// authenticating reverse proxy.
+func NewSearXNGProvider(baseURL, apiKey string, httpClient *http.Client) *SearXNGProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &SearXNGProvider{baseURL: resolveEndpoint(baseURL, ""), apiKey: apiKey, httpClient: httpClient}
+}
+
+func (s *SearXNGProvider) Name() string { return searxngProviderName }
+
+func (s *SearXNGProvider) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	if s.baseURL == "" {
+		return nil, fmt.Errorf("searxng: base_url not configured")
+	}
+	u, err := url.Parse(s.baseURL + searxngSearchPath)
+	if err != nil {
+		return nil, fmt.Errorf("searxng: invalid base_url: %w", err)
+	}
+	q := u.Query()
+	q.Set("q", req.Query)
+	q.Set("format", "json")
+	q.Set("pageno", "1")
+	u.RawQuery = q.Encode()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("searxng: build request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if s.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	body, err := doSearchRequest(s.httpClient, httpReq, searxngProviderName)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw searxngResponse
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("searxng: decode response: %w", err)
+	}
+
+	// SearXNG has no result-count parameter; trim locally.
+	limit := resolveMaxResults(req.MaxResults, searxngMaxResults)
+	results := make([]SearchResult, 0, min(limit, len(raw.Results)))
+	for _, r := range raw.Results {
+		if len(results) >= limit {
+			break
+		}
+		if r.URL == "" {
+			continue
+		}
+		results = append(results, SearchResult{
+			URL:     r.URL,
+			Title:   r.Title,
+			Snippet: r.Content,
+			PageAge: r.PublishedDate,
+		})
+	}
+
+	return &SearchResponse{Results: results, Query: req.Query}, nil
+}
+
+// searxngResponse is the minimal structure of the SearXNG JSON output format.
+type searxngResponse struct {
+	Results []searxngResult `json:"results"`
+}
+
+type searxngResult struct {
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	Content       string `json:"content"`
+	PublishedDate string `json:"publishedDate"`
+}
@@ -25,6 +25,31 @@ const defaultMaxResults = 5
 
 // Provider type identifiers.
 const (
-	ProviderTypeBrave  = "brave"
-	ProviderTypeTavily = "tavily"
+	ProviderTypeBrave       = "brave"
+	ProviderTypeTavily      = "tavily"
+	ProviderTypeSearXNG     = "searxng"
+	ProviderTypeExa         = "exa"
+	ProviderTypeBing        = "bing"
+	ProviderTypeGenericJSON = "generic_json"
 )
+
+// ProviderRequiresAPIKey reports whether the provider type cannot work without an API key.
+// SearXNG instances and generic JSON endpoints are often self-hosted without authentication.
+func ProviderRequiresAPIKey(providerType string) bool {
+	switch providerType {
+	case ProviderTypeSearXNG, ProviderTypeGenericJSON:
+		return false
+	default:
+		return true
+	}
+}
+
+// ProviderRequiresBaseURL reports whether the provider type has no public default endpoint.
+func ProviderRequiresBaseURL(providerType string) bool {
+	switch providerType {
+	case ProviderTypeSearXNG, ProviderTypeGenericJSON:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type apiKeyPriorityRepository struct {
+	db *sql.DB
+}
+
+// NewAPIKeyPriorityRepository 创建 API Key 优先级数据访问实例
+func NewAPIKeyPriorityRepository(db *sql.DB) service.APIKeyPriorityRepository {
+	return &apiKeyPriorityRepository{db: db}
+}
+
+func (r *apiKeyPriorityRepository) ListAll(ctx context.Context) (map[int64]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT api_key_id, priority_class FROM api_key_priority_classes`)
+	if err != nil {
+		return nil, fmt.Errorf("list api key priority classes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make(map[int64]string)
+	for rows.Next() {
+		var apiKeyID int64
+		var class string
+		if err := rows.Scan(&apiKeyID, &class); err != nil {
+			return nil, fmt.Errorf("scan api key priority class: %w", err)
+		}
+		out[apiKeyID] = class
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list api key priority classes: %w", err)
+	}
+	return out, nil
+}
+
+func (r *apiKeyPriorityRepository) Set(ctx context.Context, apiKeyID int64, class string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO api_key_priority_classes (api_key_id, priority_class, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (api_key_id) DO UPDATE SET priority_class = EXCLUDED.priority_class, updated_at = NOW()`,
+		apiKeyID, class)
+	if err != nil {
+		return fmt.Errorf("set api key priority class: %w", err)
+	}
+	return nil
+}
+
+func (r *apiKeyPriorityRepository) Delete(ctx context.Context, apiKeyID int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM api_key_priority_classes WHERE api_key_id = $1`, apiKeyID); err != nil {
+		return fmt.Errorf("delete api key priority class: %w", err)
+	}
+	return nil
+}
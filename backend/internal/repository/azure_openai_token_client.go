@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/azureopenai"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/geminicli"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type azureOpenAITokenClient struct{}
+
+func NewAzureOpenAITokenClient() service.AzureOpenAITokenClient {
+	return &azureOpenAITokenClient{}
+}
+
+// ClientCredentials 使用 Entra ID 应用的 client_id/client_secret 换取 Azure OpenAI access token。
+func (c *azureOpenAITokenClient) ClientCredentials(ctx context.Context, tenantID, clientID, clientSecret, proxyURL string) (*azureopenai.TokenResponse, error) {
+	tokenURL, err := azureopenai.EntraTokenURL(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := createGeminiReqClient(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP client: %w", err)
+	}
+
+	formData := url.Values{}
+	formData.Set("grant_type", "client_credentials")
+	formData.Set("client_id", clientID)
+	formData.Set("client_secret", clientSecret)
+	formData.Set("scope", azureopenai.EntraScope)
+
+	var tokenResp azureopenai.TokenResponse
+	resp, err := client.R().
+		SetContext(ctx).
+		SetFormDataFromValues(formData).
+		SetSuccessResult(&tokenResp).
+		Post(tokenURL)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if !resp.IsSuccessState() {
+		return nil, fmt.Errorf("token exchange failed: status %d, body: %s", resp.StatusCode, geminicli.SanitizeBodyForLogs(resp.String()))
+	}
+	return &tokenResp, nil
+}
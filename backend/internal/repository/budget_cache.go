@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+	"github.com/redis/go-redis/v9"
+)
+
+const budgetSpendKeyPrefix = "budget:spend:"
+
+// incrBudgetSpendScript 仅在 key 存在时累加（缺失时由服务层从 usage_logs 聚合回填）
+var incrBudgetSpendScript = redis.NewScript(`
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		return false
+	end
+	return redis.call('INCRBYFLOAT', KEYS[1], ARGV[1])
+`)
+
+type budgetSpendCache struct {
+	rdb *redis.Client
+}
+
+// NewBudgetSpendCache 创建预算周期消费缓存
+func NewBudgetSpendCache(rdb *redis.Client) service.BudgetSpendCache {
+	return &budgetSpendCache{rdb: rdb}
+}
+
+func (c *budgetSpendCache) GetSpend(ctx context.Context, key string) (float64, bool, error) {
+	v, err := c.rdb.Get(ctx, budgetSpendKeyPrefix+key).Float64()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return v, true, nil
+}
+
+func (c *budgetSpendCache) SetSpend(ctx context.Context, key string, spend float64, ttl time.Duration) error {
+	return c.rdb.Set(ctx, budgetSpendKeyPrefix+key, strconv.FormatFloat(spend, 'f', -1, 64), ttl).Err()
+}
+
+func (c *budgetSpendCache) IncrSpend(ctx context.Context, key string, delta float64) (float64, bool, error) {
+	res, err := incrBudgetSpendScript.Run(ctx, c.rdb, []string{budgetSpendKeyPrefix + key}, strconv.FormatFloat(delta, 'f', -1, 64)).Text()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	v, err := strconv.ParseFloat(res, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return v, true, nil
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type budgetRepository struct {
+	db *sql.DB
+}
+
+// NewBudgetRepository 创建消费预算数据访问实例
+func NewBudgetRepository(db *sql.DB) service.BudgetRepository {
+	return &budgetRepository{db: db}
+}
+
+const usageBudgetColumns = `id, user_id, api_key_id, period, limit_usd, mode, alert_percent, enabled,
+	last_alert_period_start, last_alert_level, created_at, updated_at`
+
+func scanUsageBudget(row interface{ Scan(...any) error }) (*service.UsageBudget, error) {
+	b := &service.UsageBudget{}
+	var apiKeyID sql.NullInt64
+	var lastAlert sql.NullTime
+	err := row.Scan(&b.ID, &b.UserID, &apiKeyID, &b.Period, &b.LimitUSD, &b.Mode, &b.AlertPercent, &b.Enabled,
+		&lastAlert, &b.LastAlertLevel, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if apiKeyID.Valid {
+		id := apiKeyID.Int64
+		b.APIKeyID = &id
+	}
+	if lastAlert.Valid {
+		t := lastAlert.Time
+		b.LastAlertPeriodStart = &t
+	}
+	return b, nil
+}
+
+func (r *budgetRepository) ListByUser(ctx context.Context, userID int64) ([]*service.UsageBudget, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+usageBudgetColumns+` FROM usage_budgets WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list usage budgets: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []*service.UsageBudget
+	for rows.Next() {
+		b, err := scanUsageBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan usage budget: %w", err)
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (r *budgetRepository) GetByID(ctx context.Context, id int64) (*service.UsageBudget, error) {
+	b, err := scanUsageBudget(r.db.QueryRowContext(ctx,
+		`SELECT `+usageBudgetColumns+` FROM usage_budgets WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrBudgetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get usage budget: %w", err)
+	}
+	return b, nil
+}
+
+func (r *budgetRepository) Create(ctx context.Context, b *service.UsageBudget) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO usage_budgets (user_id, api_key_id, period, limit_usd, mode, alert_percent, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, b.UserID, b.APIKeyID, b.Period, b.LimitUSD, b.Mode, b.AlertPercent, b.Enabled).Scan(&b.ID, &b.CreatedAt, &b.UpdatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrBudgetDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("insert usage budget: %w", err)
+	}
+	return nil
+}
+
+func (r *budgetRepository) Update(ctx context.Context, b *service.UsageBudget) error {
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE usage_budgets
+		SET limit_usd = $3, mode = $4, alert_percent = $5, enabled = $6, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING updated_at
+	`, b.ID, b.UserID, b.LimitUSD, b.Mode, b.AlertPercent, b.Enabled).Scan(&b.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.ErrBudgetNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("update usage budget: %w", err)
+	}
+	return nil
+}
+
+func (r *budgetRepository) Delete(ctx context.Context, userID, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM usage_budgets WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete usage budget: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return service.ErrBudgetNotFound
+	}
+	return nil
+}
+
+func (r *budgetRepository) MarkAlerted(ctx context.Context, id int64, periodStart time.Time, level int) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE usage_budgets
+		SET last_alert_period_start = $2, last_alert_level = $3
+		WHERE id = $1
+		  AND (last_alert_period_start IS DISTINCT FROM $2 OR last_alert_level < $3)
+	`, id, periodStart, level)
+	if err != nil {
+		return false, fmt.Errorf("mark usage budget alerted: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *budgetRepository) GetSettings(ctx context.Context, userID int64) (*service.BudgetSettings, error) {
+	s := &service.BudgetSettings{UserID: userID, EmailEnabled: true}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT email_enabled, webhook_url, webhook_secret, spike_hourly_usd
+		FROM user_budget_settings WHERE user_id = $1
+	`, userID).Scan(&s.EmailEnabled, &s.WebhookURL, &s.WebhookSecret, &s.SpikeHourlyUSD)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get budget settings: %w", err)
+	}
+	return s, nil
+}
+
+func (r *budgetRepository) UpsertSettings(ctx context.Context, s *service.BudgetSettings) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_budget_settings (user_id, email_enabled, webhook_url, webhook_secret, spike_hourly_usd, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			email_enabled = EXCLUDED.email_enabled,
+			webhook_url = EXCLUDED.webhook_url,
+			webhook_secret = EXCLUDED.webhook_secret,
+			spike_hourly_usd = EXCLUDED.spike_hourly_usd,
+			updated_at = NOW()
+	`, s.UserID, s.EmailEnabled, s.WebhookURL, s.WebhookSecret, s.SpikeHourlyUSD)
+	if err != nil {
+		return fmt.Errorf("upsert budget settings: %w", err)
+	}
+	return nil
+}
+
+func (r *budgetRepository) MarkSpikeAlerted(ctx context.Context, userID int64, bucketStart time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE user_budget_settings
+		SET last_spike_alert_at = $2
+		WHERE user_id = $1
+		  AND (last_spike_alert_at IS NULL OR last_spike_alert_at < $2)
+	`, userID, bucketStart)
+	if err != nil {
+		return false, fmt.Errorf("mark budget spike alerted: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *budgetRepository) SumSpend(ctx context.Context, userID, apiKeyID int64, since time.Time) (float64, error) {
+	query := `SELECT COALESCE(SUM(actual_cost), 0) FROM usage_logs WHERE user_id = $1 AND created_at >= $2`
+	args := []any{userID, since}
+	if apiKeyID > 0 {
+		query += ` AND api_key_id = $3`
+		args = append(args, apiKeyID)
+	}
+	var total float64
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("sum budget spend: %w", err)
+	}
+	return total, nil
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	clusterStateKeyPrefix = "cluster:state:"
+	clusterOwnedKeyPrefix = "cluster:owned:"
+	clusterNodesKey       = "cluster:nodes"
+
+	// clusterOwnedIndexTTL 节点归属索引的兜底过期时间（节点下线后不再 prune 时自动回收）
+	clusterOwnedIndexTTL = 24 * time.Hour
+)
+
+type clusterStateCache struct {
+	rdb *redis.Client
+}
+
+// NewClusterStateCache 创建多副本共享状态缓存
+func NewClusterStateCache(rdb *redis.Client) service.ClusterStateCache {
+	return &clusterStateCache{rdb: rdb}
+}
+
+// buildClusterStateKey 格式: cluster:state:{kind}:{key}
+func buildClusterStateKey(kind, key string) string {
+	return clusterStateKeyPrefix + kind + ":" + key
+}
+
+// buildClusterOwnedKey 节点归属索引（ZSET，member=key，score=过期时间毫秒）
+// 格式: cluster:owned:{nodeID}:{kind}
+func buildClusterOwnedKey(nodeID, kind string) string {
+	return clusterOwnedKeyPrefix + nodeID + ":" + kind
+}
+
+func (c *clusterStateCache) SetBinding(ctx context.Context, kind, key string, binding service.ClusterBinding, ttl time.Duration) error {
+	payload, err := json.Marshal(binding)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ttl)
+	ownedKey := buildClusterOwnedKey(binding.NodeID, kind)
+	pipe := c.rdb.TxPipeline()
+	pipe.Set(ctx, buildClusterStateKey(kind, key), payload, ttl)
+	pipe.ZAdd(ctx, ownedKey, redis.Z{Score: float64(expiresAt.UnixMilli()), Member: key})
+	pipe.Expire(ctx, ownedKey, clusterOwnedIndexTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (c *clusterStateCache) GetBinding(ctx context.Context, kind, key string) (*service.ClusterBinding, error) {
+	raw, err := c.rdb.Get(ctx, buildClusterStateKey(kind, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeClusterBinding(raw), nil
+}
+
+func (c *clusterStateCache) GetBindings(ctx context.Context, kind string, keys []string) ([]*service.ClusterBinding, error) {
+	out := make([]*service.ClusterBinding, len(keys))
+	if len(keys) == 0 {
+		return out, nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = buildClusterStateKey(kind, key)
+	}
+	values, err := c.rdb.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if s, ok := v.(string); ok && i < len(out) {
+			out[i] = decodeClusterBinding([]byte(s))
+		}
+	}
+	return out, nil
+}
+
+func (c *clusterStateCache) DeleteBinding(ctx context.Context, kind, key string) error {
+	stateKey := buildClusterStateKey(kind, key)
+	raw, err := c.rdb.GetDel(ctx, stateKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b := decodeClusterBinding(raw); b != nil && b.NodeID != "" {
+		return c.rdb.ZRem(ctx, buildClusterOwnedKey(b.NodeID, kind), key).Err()
+	}
+	return nil
+}
+
+func (c *clusterStateCache) WriteBindings(ctx context.Context, writes []service.ClusterBindingWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	now := time.Now()
+	pipe := c.rdb.Pipeline()
+	deleted := make(map[int]*redis.StringCmd)
+	for i, w := range writes {
+		stateKey := buildClusterStateKey(w.Kind, w.Key)
+		if w.Delete {
+			deleted[i] = pipe.GetDel(ctx, stateKey)
+			continue
+		}
+		payload, err := json.Marshal(w.Binding)
+		if err != nil {
+			return err
+		}
+		ownedKey := buildClusterOwnedKey(w.Binding.NodeID, w.Kind)
+		pipe.Set(ctx, stateKey, payload, w.TTL)
+		pipe.ZAdd(ctx, ownedKey, redis.Z{Score: float64(now.Add(w.TTL).UnixMilli()), Member: w.Key})
+		pipe.Expire(ctx, ownedKey, clusterOwnedIndexTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	// 被删除的绑定可能由其他节点写入，按原值中的 NodeID 清理对应归属索引
+	cleanup := c.rdb.Pipeline()
+	for i, cmd := range deleted {
+		raw, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+		if b := decodeClusterBinding(raw); b != nil && b.NodeID != "" {
+			cleanup.ZRem(ctx, buildClusterOwnedKey(b.NodeID, writes[i].Kind), writes[i].Key)
+		}
+	}
+	if cleanup.Len() == 0 {
+		return nil
+	}
+	_, err := cleanup.Exec(ctx)
+	return err
+}
+
+func (c *clusterStateCache) RegisterNode(ctx context.Context, node service.ClusterNode) error {
+	payload, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	return c.rdb.HSet(ctx, clusterNodesKey, node.NodeID, payload).Err()
+}
+
+func (c *clusterStateCache) UnregisterNode(ctx context.Context, nodeID string) error {
+	return c.rdb.HDel(ctx, clusterNodesKey, nodeID).Err()
+}
+
+func (c *clusterStateCache) ListNodes(ctx context.Context, now time.Time) ([]service.ClusterNode, error) {
+	values, err := c.rdb.HGetAll(ctx, clusterNodesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]service.ClusterNode, 0, len(values))
+	var stale []string
+	for nodeID, raw := range values {
+		var node service.ClusterNode
+		if err := json.Unmarshal([]byte(raw), &node); err != nil || now.After(node.ExpiresAt) {
+			stale = append(stale, nodeID)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	if len(stale) > 0 {
+		// 心跳超时的节点直接移除，失败不影响查询结果
+		_ = c.rdb.HDel(ctx, clusterNodesKey, stale...).Err()
+	}
+	return nodes, nil
+}
+
+func (c *clusterStateCache) CountOwnedSessions(ctx context.Context, nodeID string, now time.Time) (map[string]int64, error) {
+	minScore := strconv.FormatInt(now.UnixMilli(), 10)
+	pipe := c.rdb.Pipeline()
+	cmds := make(map[string]*redis.IntCmd, len(service.ClusterSessionKinds))
+	for _, kind := range service.ClusterSessionKinds {
+		cmds[kind] = pipe.ZCount(ctx, buildClusterOwnedKey(nodeID, kind), minScore, "+inf")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(cmds))
+	for kind, cmd := range cmds {
+		counts[kind] = cmd.Val()
+	}
+	return counts, nil
+}
+
+func (c *clusterStateCache) ListOwnedSessions(ctx context.Context, nodeID string, now time.Time, limit int) ([]service.ClusterSessionOwnership, error) {
+	minScore := strconv.FormatInt(now.UnixMilli(), 10)
+	pipe := c.rdb.Pipeline()
+	cmds := make(map[string]*redis.ZSliceCmd, len(service.ClusterSessionKinds))
+	for _, kind := range service.ClusterSessionKinds {
+		cmds[kind] = pipe.ZRevRangeByScoreWithScores(ctx, buildClusterOwnedKey(nodeID, kind), &redis.ZRangeBy{
+			Min:   minScore,
+			Max:   "+inf",
+			Count: int64(limit),
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	out := make([]service.ClusterSessionOwnership, 0, limit)
+	for kind, cmd := range cmds {
+		for _, z := range cmd.Val() {
+			key, _ := z.Member.(string)
+			out = append(out, service.ClusterSessionOwnership{
+				Kind:      kind,
+				Key:       key,
+				NodeID:    nodeID,
+				ExpiresAt: time.UnixMilli(int64(z.Score)).UTC(),
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExpiresAt.After(out[j].ExpiresAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (c *clusterStateCache) PruneOwnedSessions(ctx context.Context, nodeID string, now time.Time) error {
+	maxScore := "(" + strconv.FormatInt(now.UnixMilli(), 10)
+	pipe := c.rdb.Pipeline()
+	for _, kind := range service.ClusterSessionKinds {
+		pipe.ZRemRangeByScore(ctx, buildClusterOwnedKey(nodeID, kind), "-inf", maxScore)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func decodeClusterBinding(raw []byte) *service.ClusterBinding {
+	var b service.ClusterBinding
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil
+	}
+	return &b
+}
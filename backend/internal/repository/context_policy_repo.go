@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type contextPolicyRepository struct {
+	db *sql.DB
+}
+
+// NewContextPolicyRepository 创建上下文窗口策略数据访问实例
+func NewContextPolicyRepository(db *sql.DB) service.ContextPolicyRepository {
+	return &contextPolicyRepository{db: db}
+}
+
+func (r *contextPolicyRepository) ListPolicies(ctx context.Context) ([]*service.ContextPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT group_id, enabled, action, long_context_model, context_window, reserve_tokens, updated_at
+		FROM group_context_policies`)
+	if err != nil {
+		return nil, fmt.Errorf("list context policies: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []*service.ContextPolicy
+	for rows.Next() {
+		p := &service.ContextPolicy{}
+		if err := rows.Scan(&p.GroupID, &p.Enabled, &p.Action, &p.LongContextModel,
+			&p.ContextWindow, &p.ReserveTokens, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *contextPolicyRepository) UpsertPolicy(ctx context.Context, p *service.ContextPolicy) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO group_context_policies
+			(group_id, enabled, action, long_context_model, context_window, reserve_tokens, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (group_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			action = EXCLUDED.action,
+			long_context_model = EXCLUDED.long_context_model,
+			context_window = EXCLUDED.context_window,
+			reserve_tokens = EXCLUDED.reserve_tokens,
+			updated_at = EXCLUDED.updated_at`,
+		p.GroupID, p.Enabled, p.Action, p.LongContextModel, p.ContextWindow, p.ReserveTokens, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("upsert context policy: %w", err)
+	}
+	return nil
+}
+
+func (r *contextPolicyRepository) DeletePolicy(ctx context.Context, groupID int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM group_context_policies WHERE group_id = $1`, groupID); err != nil {
+		return fmt.Errorf("delete context policy: %w", err)
+	}
+	return nil
+}
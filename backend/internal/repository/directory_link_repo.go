@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type directoryLinkRepository struct {
+	db *sql.DB
+}
+
+// NewDirectoryLinkRepository 创建目录身份关联数据访问实例
+func NewDirectoryLinkRepository(db *sql.DB) service.DirectoryLinkRepository {
+	return &directoryLinkRepository{db: db}
+}
+
+func (r *directoryLinkRepository) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	var userID int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT user_id FROM directory_user_links WHERE provider = $1 AND subject = $2`, provider, subject).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, service.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get directory user link: %w", err)
+	}
+	return userID, nil
+}
+
+func (r *directoryLinkRepository) Link(ctx context.Context, provider, subject string, userID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO directory_user_links (provider, subject, user_id) VALUES ($1, $2, $3)`, provider, subject, userID)
+	if isUniqueViolation(err) {
+		linked, getErr := r.GetUserID(ctx, provider, subject)
+		if getErr == nil && linked == userID {
+			return nil
+		}
+		return service.ErrDirectoryIdentityLinked
+	}
+	if err != nil {
+		return fmt.Errorf("create directory user link: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type oauthGrantRepository struct {
+	db *sql.DB
+}
+
+// NewOAuthGrantRepository 创建 OAuth 授权记录的数据访问实例
+func NewOAuthGrantRepository(db *sql.DB) service.OAuthGrantRepository {
+	return &oauthGrantRepository{db: db}
+}
+
+const oauthGrantColumns = `g.id, g.user_id, g.api_key_id, g.client_id, g.group_id, g.scope, g.refresh_token_hash,
+	g.refresh_expires_at, g.last_refreshed_at, g.revoked_at, g.created_at, g.updated_at`
+
+func scanOAuthGrant(row interface{ Scan(...any) error }, extra ...any) (*service.OAuthGrant, error) {
+	g := &service.OAuthGrant{}
+	var refreshHash sql.NullString
+	var refreshExpiresAt, lastRefreshedAt, revokedAt sql.NullTime
+	dest := append([]any{&g.ID, &g.UserID, &g.APIKeyID, &g.ClientID, &g.GroupID, &g.Scope, &refreshHash,
+		&refreshExpiresAt, &lastRefreshedAt, &revokedAt, &g.CreatedAt, &g.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	g.RefreshTokenHash = refreshHash.String
+	g.RefreshExpiresAt = nullTimePtr(refreshExpiresAt)
+	g.LastRefreshedAt = nullTimePtr(lastRefreshedAt)
+	g.RevokedAt = nullTimePtr(revokedAt)
+	return g, nil
+}
+
+func (r *oauthGrantRepository) getOne(ctx context.Context, where string, args ...any) (*service.OAuthGrant, error) {
+	grant, err := scanOAuthGrant(r.db.QueryRowContext(ctx,
+		`SELECT `+oauthGrantColumns+` FROM oauth_grants g WHERE `+where, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrOAuthGrantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get oauth grant: %w", err)
+	}
+	return grant, nil
+}
+
+func (r *oauthGrantRepository) Create(ctx context.Context, grant *service.OAuthGrant) error {
+	var refreshHash sql.NullString
+	if grant.RefreshTokenHash != "" {
+		refreshHash = sql.NullString{String: grant.RefreshTokenHash, Valid: true}
+	}
+	var refreshExpiresAt sql.NullTime
+	if grant.RefreshExpiresAt != nil {
+		refreshExpiresAt = sql.NullTime{Time: *grant.RefreshExpiresAt, Valid: true}
+	}
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO oauth_grants (user_id, api_key_id, client_id, group_id, scope, refresh_token_hash, refresh_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at`,
+		grant.UserID, grant.APIKeyID, grant.ClientID, grant.GroupID, grant.Scope, refreshHash, refreshExpiresAt,
+	).Scan(&grant.ID, &grant.CreatedAt, &grant.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create oauth grant: %w", err)
+	}
+	return nil
+}
+
+func (r *oauthGrantRepository) GetByID(ctx context.Context, id int64) (*service.OAuthGrant, error) {
+	return r.getOne(ctx, `g.id = $1`, id)
+}
+
+func (r *oauthGrantRepository) GetByRefreshTokenHash(ctx context.Context, hash string) (*service.OAuthGrant, error) {
+	return r.getOne(ctx, `g.refresh_token_hash = $1`, hash)
+}
+
+func (r *oauthGrantRepository) GetActiveByAPIKeyID(ctx context.Context, apiKeyID int64) (*service.OAuthGrant, error) {
+	return r.getOne(ctx, `g.api_key_id = $1 AND g.revoked_at IS NULL ORDER BY g.id DESC LIMIT 1`, apiKeyID)
+}
+
+func (r *oauthGrantRepository) ListByUser(ctx context.Context, userID int64) ([]*service.OAuthGrant, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+oauthGrantColumns+`, COALESCE(k.name, ''), COALESCE(k.status, ''), k.expires_at, (k.id IS NULL OR k.deleted_at IS NOT NULL)
+		FROM oauth_grants g
+		LEFT JOIN api_keys k ON k.id = g.api_key_id
+		WHERE g.user_id = $1
+		ORDER BY g.id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list oauth grants: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []*service.OAuthGrant
+	for rows.Next() {
+		var keyExpiresAt sql.NullTime
+		var name, status string
+		var deleted bool
+		grant, err := scanOAuthGrant(rows, &name, &status, &keyExpiresAt, &deleted)
+		if err != nil {
+			return nil, fmt.Errorf("scan oauth grant: %w", err)
+		}
+		grant.APIKeyName = name
+		grant.APIKeyStatus = status
+		grant.APIKeyExpiresAt = nullTimePtr(keyExpiresAt)
+		grant.APIKeyDeleted = deleted
+		out = append(out, grant)
+	}
+	return out, rows.Err()
+}
+
+func (r *oauthGrantRepository) RotateRefreshToken(ctx context.Context, id int64, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE oauth_grants
+		SET refresh_token_hash = $3, refresh_expires_at = $4, last_refreshed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL`,
+		id, oldHash, newHash, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Revoke 标记撤销并清除 refresh_token 摘要，使其无法再被兑换
+func (r *oauthGrantRepository) Revoke(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE oauth_grants
+		SET revoked_at = COALESCE(revoked_at, NOW()), refresh_token_hash = NULL, updated_at = NOW()
+		WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("revoke oauth grant: %w", err)
+	}
+	return nil
+}
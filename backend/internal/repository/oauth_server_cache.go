@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	oauthDeviceKeyPrefix     = "oauth:device:"
+	oauthUserCodeKeyPrefix   = "oauth:user_code:"
+	oauthDevicePollKeyPrefix = "oauth:device_poll:"
+	oauthAuthCodeKeyPrefix   = "oauth:code:"
+)
+
+type oauthServerCache struct {
+	rdb *redis.Client
+}
+
+// NewOAuthServerCache 创建设备码/授权码的 Redis 存储
+func NewOAuthServerCache(rdb *redis.Client) service.OAuthServerCache {
+	return &oauthServerCache{rdb: rdb}
+}
+
+func (c *oauthServerCache) SaveDeviceAuthorization(ctx context.Context, auth *service.OAuthDeviceAuthorization, ttl time.Duration) error {
+	// user_code 索引先占位，冲突时交由服务层重新生成
+	ok, err := c.rdb.SetNX(ctx, oauthUserCodeKeyPrefix+auth.UserCode, auth.DeviceCodeHash, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return service.ErrOAuthUserCodeCollision
+	}
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return fmt.Errorf("marshal device authorization: %w", err)
+	}
+	return c.rdb.Set(ctx, oauthDeviceKeyPrefix+auth.DeviceCodeHash, data, ttl).Err()
+}
+
+func (c *oauthServerCache) GetDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*service.OAuthDeviceAuthorization, error) {
+	return decodeOAuthCacheValue[service.OAuthDeviceAuthorization](c.rdb.Get(ctx, oauthDeviceKeyPrefix+deviceCodeHash).Bytes())
+}
+
+func (c *oauthServerCache) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*service.OAuthDeviceAuthorization, error) {
+	hash, err := c.rdb.Get(ctx, oauthUserCodeKeyPrefix+userCode).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.GetDeviceAuthorization(ctx, hash)
+}
+
+func (c *oauthServerCache) UpdateDeviceAuthorization(ctx context.Context, auth *service.OAuthDeviceAuthorization) error {
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return fmt.Errorf("marshal device authorization: %w", err)
+	}
+	ok, err := c.rdb.SetArgs(ctx, oauthDeviceKeyPrefix+auth.DeviceCodeHash, data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Result()
+	if errors.Is(err, redis.Nil) || (err == nil && ok != "OK") {
+		return service.ErrOAuthUserCodeNotFound
+	}
+	return err
+}
+
+func (c *oauthServerCache) ConsumeDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*service.OAuthDeviceAuthorization, error) {
+	auth, err := decodeOAuthCacheValue[service.OAuthDeviceAuthorization](c.rdb.GetDel(ctx, oauthDeviceKeyPrefix+deviceCodeHash).Bytes())
+	if err != nil || auth == nil {
+		return auth, err
+	}
+	_ = c.rdb.Del(ctx, oauthUserCodeKeyPrefix+auth.UserCode, oauthDevicePollKeyPrefix+deviceCodeHash).Err()
+	return auth, nil
+}
+
+func (c *oauthServerCache) TouchDevicePoll(ctx context.Context, deviceCodeHash string, now time.Time, ttl time.Duration) (time.Time, error) {
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	prev, err := c.rdb.SetArgs(ctx, oauthDevicePollKeyPrefix+deviceCodeHash, now.UnixMilli(), redis.SetArgs{TTL: ttl, Get: true}).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(prev, 10, 64)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (c *oauthServerCache) SaveAuthorizationCode(ctx context.Context, codeHash string, code *service.OAuthAuthorizationCode, ttl time.Duration) error {
+	data, err := json.Marshal(code)
+	if err != nil {
+		return fmt.Errorf("marshal authorization code: %w", err)
+	}
+	return c.rdb.Set(ctx, oauthAuthCodeKeyPrefix+codeHash, data, ttl).Err()
+}
+
+func (c *oauthServerCache) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*service.OAuthAuthorizationCode, error) {
+	return decodeOAuthCacheValue[service.OAuthAuthorizationCode](c.rdb.GetDel(ctx, oauthAuthCodeKeyPrefix+codeHash).Bytes())
+}
+
+func decodeOAuthCacheValue[T any](raw []byte, err error) (*T, error) {
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v T
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("decode oauth state: %w", err)
+	}
+	return &v, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+const passkeyCeremonyKeyPrefix = "passkey:ceremony:"
+
+// PasskeyCache implements service.PasskeyCache using Redis
+type PasskeyCache struct {
+	rdb *redis.Client
+}
+
+// NewPasskeyCache creates a new WebAuthn ceremony cache
+func NewPasskeyCache(rdb *redis.Client) service.PasskeyCache {
+	return &PasskeyCache{rdb: rdb}
+}
+
+// SetCeremony stores a WebAuthn ceremony session
+func (c *PasskeyCache) SetCeremony(ctx context.Context, key string, session *webauthn.SessionData, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("marshal passkey ceremony: %w", err)
+	}
+	if err := c.rdb.Set(ctx, passkeyCeremonyKeyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("set passkey ceremony: %w", err)
+	}
+	return nil
+}
+
+// TakeCeremony atomically reads and deletes a ceremony session so each challenge is single-use
+func (c *PasskeyCache) TakeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	data, err := c.rdb.GetDel(ctx, passkeyCeremonyKeyPrefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get passkey ceremony: %w", err)
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("unmarshal passkey ceremony: %w", err)
+	}
+	return &session, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type passkeyRepository struct {
+	db *sql.DB
+}
+
+// NewPasskeyRepository 创建 WebAuthn 通行密钥数据访问实例
+func NewPasskeyRepository(db *sql.DB) service.PasskeyRepository {
+	return &passkeyRepository{db: db}
+}
+
+func (r *passkeyRepository) ListByUser(ctx context.Context, userID int64) ([]service.PasskeyCredential, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, name, credential_id, credential, created_at, last_used_at
+		FROM user_webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list passkeys: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []service.PasskeyCredential
+	for rows.Next() {
+		var c service.PasskeyCredential
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CredentialID, &c.Credential, &c.CreatedAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("scan passkey: %w", err)
+		}
+		c.LastUsedAt = nullTimePtr(lastUsedAt)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (r *passkeyRepository) Create(ctx context.Context, cred *service.PasskeyCredential) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO user_webauthn_credentials (user_id, name, credential_id, credential)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		cred.UserID, cred.Name, cred.CredentialID, cred.Credential).Scan(&cred.ID, &cred.CreatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrPasskeyAlreadyRegistered
+	}
+	if err != nil {
+		return fmt.Errorf("create passkey: %w", err)
+	}
+	return nil
+}
+
+func (r *passkeyRepository) Rename(ctx context.Context, userID, id int64, name string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE user_webauthn_credentials SET name = $3 WHERE id = $1 AND user_id = $2`, id, userID, name)
+	if err != nil {
+		return fmt.Errorf("rename passkey: %w", err)
+	}
+	return passkeyAffected(res)
+}
+
+func (r *passkeyRepository) Delete(ctx context.Context, userID, id int64) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM user_webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete passkey: %w", err)
+	}
+	return passkeyAffected(res)
+}
+
+func (r *passkeyRepository) UpdateAfterLogin(ctx context.Context, id int64, credential []byte) error {
+	if _, err := r.db.ExecContext(ctx,
+		`UPDATE user_webauthn_credentials SET credential = $2, last_used_at = NOW() WHERE id = $1`, id, credential); err != nil {
+		return fmt.Errorf("update passkey after login: %w", err)
+	}
+	return nil
+}
+
+func (r *passkeyRepository) CountAdminsWithoutPasskey(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM users u
+		WHERE u.role = $1 AND u.status = $2 AND u.deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM user_webauthn_credentials c WHERE c.user_id = u.id)`,
+		service.RoleAdmin, service.StatusActive).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count admins without passkey: %w", err)
+	}
+	return n, nil
+}
+
+func passkeyAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("passkey rows affected: %w", err)
+	}
+	if n == 0 {
+		return service.ErrPasskeyNotFound
+	}
+	return nil
+}
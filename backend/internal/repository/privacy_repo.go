@@ -0,0 +1,409 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type privacyRepository struct {
+	db *sql.DB
+}
+
+// NewPrivacyRepository 创建数据导出与账号注销数据访问实例
+func NewPrivacyRepository(db *sql.DB) service.PrivacyRepository {
+	return &privacyRepository{db: db}
+}
+
+// exportSectionQueries 各数据分区的导出查询（每行输出一个 JSON 对象）。
+// API Key 只导出前后缀；上游账号等内部字段不导出。
+var exportSectionQueries = map[string]string{
+	service.DataExportSectionProfile: `
+		SELECT row_to_json(t) FROM (
+			SELECT id, email, username, role, balance, concurrency, status, total_recharged,
+				balance_notify_enabled, balance_notify_threshold_type, balance_notify_threshold,
+				balance_notify_extra_emails, totp_enabled, created_at, updated_at
+			FROM users WHERE id = $1
+		) t`,
+	service.DataExportSectionAttributes: `
+		SELECT row_to_json(t) FROM (
+			SELECT d.key, d.name, v.value, v.created_at, v.updated_at
+			FROM user_attribute_values v
+			JOIN user_attribute_definitions d ON d.id = v.attribute_id
+			WHERE v.user_id = $1
+			ORDER BY d.display_order, d.key
+		) t`,
+	service.DataExportSectionAPIKeys: `
+		SELECT row_to_json(t) FROM (
+			SELECT id, name, LEFT(key, 6) || '...' || RIGHT(key, 4) AS key_redacted, group_id, status,
+				ip_whitelist, ip_blacklist, quota, quota_used, expires_at, last_used_at,
+				created_at, updated_at, deleted_at
+			FROM api_keys WHERE user_id = $1
+			ORDER BY id
+		) t`,
+	service.DataExportSectionUsageLogs: `
+		SELECT row_to_json(t) FROM (
+			SELECT id, api_key_id, request_id, model, requested_model, group_id, subscription_id,
+				input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens,
+				total_cost, actual_cost, rate_multiplier, billing_type, stream, duration_ms,
+				first_token_ms, ip_address, user_agent, created_at
+			FROM usage_logs WHERE user_id = $1
+			ORDER BY created_at, id
+		) t`,
+	service.DataExportSectionPaymentOrders: `
+		SELECT row_to_json(t) FROM (
+			SELECT id, out_trade_no, order_type, payment_type, amount, pay_amount, fee_rate, status,
+				refund_amount, refund_reason, refund_at, user_email, user_name, user_notes,
+				client_ip, src_host, plan_id, subscription_group_id, subscription_days,
+				created_at, paid_at, completed_at, failed_at
+			FROM payment_orders WHERE user_id = $1
+			ORDER BY id
+		) t`,
+	service.DataExportSectionSubscriptions: `
+		SELECT row_to_json(t) FROM (
+			SELECT id, group_id, status, starts_at, expires_at, daily_usage_usd, weekly_usage_usd,
+				monthly_usage_usd, assigned_at, created_at, updated_at
+			FROM user_subscriptions WHERE user_id = $1
+			ORDER BY id
+		) t`,
+	service.DataExportSectionAnnouncementReads: `
+		SELECT row_to_json(t) FROM (
+			SELECT r.announcement_id, a.title, r.read_at
+			FROM announcement_reads r
+			JOIN announcements a ON a.id = r.announcement_id
+			WHERE r.user_id = $1
+			ORDER BY r.read_at
+		) t`,
+}
+
+const userDataExportColumns = `id, user_id, status, file_path, file_size, error_message, started_at, completed_at, expires_at, created_at`
+
+func scanUserDataExport(row interface{ Scan(...any) error }) (*service.UserDataExport, error) {
+	e := &service.UserDataExport{}
+	var startedAt, completedAt, expiresAt sql.NullTime
+	if err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.FilePath, &e.FileSize, &e.ErrorMessage,
+		&startedAt, &completedAt, &expiresAt, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	e.StartedAt = nullTimePtr(startedAt)
+	e.CompletedAt = nullTimePtr(completedAt)
+	e.ExpiresAt = nullTimePtr(expiresAt)
+	return e, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+func (r *privacyRepository) queryExports(ctx context.Context, query string, args ...any) ([]service.UserDataExport, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query data exports: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []service.UserDataExport
+	for rows.Next() {
+		e, err := scanUserDataExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan data export: %w", err)
+		}
+		out = append(out, *e)
+	}
+	return out, rows.Err()
+}
+
+func (r *privacyRepository) CreateExport(ctx context.Context, e *service.UserDataExport) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO user_data_exports (user_id, status, created_at)
+		VALUES ($1, $2, NOW())
+		RETURNING id, created_at
+	`, e.UserID, e.Status).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert data export: %w", err)
+	}
+	return nil
+}
+
+func (r *privacyRepository) GetExport(ctx context.Context, id int64) (*service.UserDataExport, error) {
+	e, err := scanUserDataExport(r.db.QueryRowContext(ctx,
+		`SELECT `+userDataExportColumns+` FROM user_data_exports WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrDataExportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get data export: %w", err)
+	}
+	return e, nil
+}
+
+func (r *privacyRepository) ListExports(ctx context.Context, userID int64, limit int) ([]service.UserDataExport, error) {
+	return r.queryExports(ctx,
+		`SELECT `+userDataExportColumns+` FROM user_data_exports WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`,
+		userID, limit)
+}
+
+func (r *privacyRepository) LatestExport(ctx context.Context, userID int64) (*service.UserDataExport, error) {
+	e, err := scanUserDataExport(r.db.QueryRowContext(ctx,
+		`SELECT `+userDataExportColumns+` FROM user_data_exports WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get latest data export: %w", err)
+	}
+	return e, nil
+}
+
+func (r *privacyRepository) ClaimPendingExport(ctx context.Context) (*service.UserDataExport, error) {
+	e, err := scanUserDataExport(r.db.QueryRowContext(ctx, `
+		UPDATE user_data_exports SET status = $1, started_at = NOW()
+		WHERE id = (
+			SELECT id FROM user_data_exports
+			WHERE status = $2
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+userDataExportColumns,
+		service.DataExportStatusProcessing, service.DataExportStatusPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim data export: %w", err)
+	}
+	return e, nil
+}
+
+func (r *privacyRepository) MarkExportReady(ctx context.Context, id int64, filePath string, fileSize int64, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_data_exports
+		SET status = $2, file_path = $3, file_size = $4, expires_at = $5, completed_at = NOW(), error_message = ''
+		WHERE id = $1
+	`, id, service.DataExportStatusReady, filePath, fileSize, expiresAt)
+	if err != nil {
+		return fmt.Errorf("mark data export ready: %w", err)
+	}
+	return nil
+}
+
+func (r *privacyRepository) MarkExportFailed(ctx context.Context, id int64, message string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_data_exports SET status = $2, error_message = $3, completed_at = NOW() WHERE id = $1
+	`, id, service.DataExportStatusFailed, message)
+	if err != nil {
+		return fmt.Errorf("mark data export failed: %w", err)
+	}
+	return nil
+}
+
+func (r *privacyRepository) RequeueStaleExports(ctx context.Context, startedBefore time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE user_data_exports SET status = $1, started_at = NULL
+		WHERE status = $2 AND started_at < $3
+	`, service.DataExportStatusPending, service.DataExportStatusProcessing, startedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("requeue stale data exports: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (r *privacyRepository) ListExpiredExports(ctx context.Context, now time.Time, limit int) ([]service.UserDataExport, error) {
+	return r.queryExports(ctx,
+		`SELECT `+userDataExportColumns+` FROM user_data_exports WHERE status = $1 AND expires_at <= $2 ORDER BY expires_at LIMIT $3`,
+		service.DataExportStatusReady, now, limit)
+}
+
+func (r *privacyRepository) MarkExportExpired(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE user_data_exports SET status = $2, file_path = '' WHERE id = $1`, id, service.DataExportStatusExpired)
+	if err != nil {
+		return fmt.Errorf("mark data export expired: %w", err)
+	}
+	return nil
+}
+
+func (r *privacyRepository) StreamExportSection(ctx context.Context, userID int64, section string, fn func(row json.RawMessage) error) error {
+	query, ok := exportSectionQueries[section]
+	if !ok {
+		return fmt.Errorf("unknown export section: %s", section)
+	}
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("query export section %s: %w", section, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return fmt.Errorf("scan export section %s: %w", section, err)
+		}
+		if err := fn(json.RawMessage(raw)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const accountDeletionColumns = `id, user_id, status, reason, scheduled_at, cancelled_at, completed_at, created_at`
+
+func scanAccountDeletion(row interface{ Scan(...any) error }) (*service.AccountDeletionRequest, error) {
+	d := &service.AccountDeletionRequest{}
+	var cancelledAt, completedAt sql.NullTime
+	if err := row.Scan(&d.ID, &d.UserID, &d.Status, &d.Reason, &d.ScheduledAt, &cancelledAt, &completedAt, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	d.CancelledAt = nullTimePtr(cancelledAt)
+	d.CompletedAt = nullTimePtr(completedAt)
+	return d, nil
+}
+
+func (r *privacyRepository) CreateDeletionRequest(ctx context.Context, d *service.AccountDeletionRequest) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO account_deletion_requests (user_id, status, reason, scheduled_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`, d.UserID, d.Status, d.Reason, d.ScheduledAt).Scan(&d.ID, &d.CreatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrDeletionRequestExists
+	}
+	if err != nil {
+		return fmt.Errorf("insert deletion request: %w", err)
+	}
+	return nil
+}
+
+func (r *privacyRepository) GetPendingDeletion(ctx context.Context, userID int64) (*service.AccountDeletionRequest, error) {
+	d, err := scanAccountDeletion(r.db.QueryRowContext(ctx,
+		`SELECT `+accountDeletionColumns+` FROM account_deletion_requests WHERE user_id = $1 AND status = $2`,
+		userID, service.DeletionStatusPending))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pending deletion: %w", err)
+	}
+	return d, nil
+}
+
+func (r *privacyRepository) CancelDeletionRequest(ctx context.Context, userID int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE account_deletion_requests SET status = $2, cancelled_at = NOW()
+		WHERE user_id = $1 AND status = $3
+	`, userID, service.DeletionStatusCancelled, service.DeletionStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("cancel deletion request: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *privacyRepository) ListDueDeletions(ctx context.Context, now time.Time, limit int) ([]service.AccountDeletionRequest, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountDeletionColumns+` FROM account_deletion_requests WHERE status = $1 AND scheduled_at <= $2 ORDER BY scheduled_at LIMIT $3`,
+		service.DeletionStatusPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list due deletions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []service.AccountDeletionRequest
+	for rows.Next() {
+		d, err := scanAccountDeletion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan deletion request: %w", err)
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// anonymizeStatements 匿名化用户数据的语句（$1 = user_id），按顺序在同一事务中执行
+var anonymizeStatements = []string{
+	// 用户主体：清除可识别信息并软删除，保留 id 以维持账单外键
+	`UPDATE users SET
+		email = 'deleted-' || id || '@deleted.invalid',
+		username = '', notes = '', wechat = '',
+		password_hash = '!deleted',
+		totp_secret_encrypted = NULL, totp_enabled = FALSE, totp_enabled_at = NULL,
+		balance_notify_enabled = FALSE, balance_notify_extra_emails = '[]',
+		status = 'disabled', updated_at = NOW(), deleted_at = COALESCE(deleted_at, NOW())
+	WHERE id = $1`,
+	`DELETE FROM user_attribute_values WHERE user_id = $1`,
+	`DELETE FROM announcement_reads WHERE user_id = $1`,
+	`DELETE FROM usage_budgets WHERE user_id = $1`,
+	`DELETE FROM user_budget_settings WHERE user_id = $1`,
+	// 登录凭据与外部身份绑定：用户仅软删除，外键级联不会触发，需显式清理
+	`DELETE FROM user_webauthn_credentials WHERE user_id = $1`,
+	`DELETE FROM user_recovery_codes WHERE user_id = $1`,
+	`DELETE FROM oauth_grants WHERE user_id = $1`,
+	`DELETE FROM scim_user_links WHERE user_id = $1`,
+	`DELETE FROM directory_user_links WHERE user_id = $1`,
+	// API Key：替换密钥并软删除，使其永久失效
+	`UPDATE api_keys SET
+		key = 'deleted-' || md5(key), name = 'deleted',
+		ip_whitelist = NULL, ip_blacklist = NULL,
+		status = 'disabled', updated_at = NOW(), deleted_at = COALESCE(deleted_at, NOW())
+	WHERE user_id = $1 AND key NOT LIKE 'deleted-%'`,
+	// 账单相关记录保留金额与时间，仅去除个人字段
+	`UPDATE usage_logs SET ip_address = NULL, user_agent = NULL
+	WHERE user_id = $1 AND (ip_address IS NOT NULL OR user_agent IS NOT NULL)`,
+	`UPDATE payment_orders SET
+		user_email = '', user_name = '', user_notes = NULL,
+		client_ip = '', src_host = '', src_url = NULL,
+		pay_url = NULL, qr_code = NULL, qr_code_img = NULL, updated_at = NOW()
+	WHERE user_id = $1`,
+	`UPDATE referral_accounts SET last_ip = '', updated_at = NOW() WHERE user_id = $1`,
+	`DELETE FROM referral_user_ips WHERE user_id = $1`,
+	`UPDATE referral_relations SET register_ip = '' WHERE referee_id = $1`,
+	`UPDATE user_data_exports SET status = 'expired', file_path = '' WHERE user_id = $1 AND status <> 'expired'`,
+}
+
+func (r *privacyRepository) AnonymizeUser(ctx context.Context, requestID, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// 先锁定申请，避免与撤销操作或其他实例并发执行
+	var status string
+	err = tx.QueryRowContext(ctx,
+		`SELECT status FROM account_deletion_requests WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+		requestID, userID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.ErrDeletionRequestNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("lock deletion request: %w", err)
+	}
+	if status != service.DeletionStatusPending {
+		return service.ErrDeletionRequestNotFound
+	}
+
+	for _, stmt := range anonymizeStatements {
+		if _, err := tx.ExecContext(ctx, stmt, userID); err != nil {
+			return fmt.Errorf("anonymize user: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE account_deletion_requests SET status = $2, reason = '', completed_at = NOW() WHERE id = $1
+	`, requestID, service.DeletionStatusCompleted); err != nil {
+		return fmt.Errorf("complete deletion request: %w", err)
+	}
+	return tx.Commit()
+}
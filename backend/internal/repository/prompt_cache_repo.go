@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/usagestats"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type promptCacheRepository struct {
+	db *sql.DB
+}
+
+// NewPromptCacheRepository 创建自动缓存断点数据访问实例
+func NewPromptCacheRepository(db *sql.DB) service.PromptCacheRepository {
+	return &promptCacheRepository{db: db}
+}
+
+func (r *promptCacheRepository) ListPolicies(ctx context.Context) ([]*service.PromptCachePolicy, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT group_id, enabled, ttl_mode, min_prefix_tokens, cache_tools, cache_system, cache_messages, updated_at
+		FROM group_prompt_cache_policies`)
+	if err != nil {
+		return nil, fmt.Errorf("list prompt cache policies: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []*service.PromptCachePolicy
+	for rows.Next() {
+		p := &service.PromptCachePolicy{}
+		if err := rows.Scan(&p.GroupID, &p.Enabled, &p.TTLMode, &p.MinPrefixTokens,
+			&p.CacheTools, &p.CacheSystem, &p.CacheMessages, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *promptCacheRepository) UpsertPolicy(ctx context.Context, p *service.PromptCachePolicy) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO group_prompt_cache_policies
+			(group_id, enabled, ttl_mode, min_prefix_tokens, cache_tools, cache_system, cache_messages, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (group_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			ttl_mode = EXCLUDED.ttl_mode,
+			min_prefix_tokens = EXCLUDED.min_prefix_tokens,
+			cache_tools = EXCLUDED.cache_tools,
+			cache_system = EXCLUDED.cache_system,
+			cache_messages = EXCLUDED.cache_messages,
+			updated_at = EXCLUDED.updated_at`,
+		p.GroupID, p.Enabled, p.TTLMode, p.MinPrefixTokens, p.CacheTools, p.CacheSystem, p.CacheMessages, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("upsert prompt cache policy: %w", err)
+	}
+	return nil
+}
+
+func (r *promptCacheRepository) DeletePolicy(ctx context.Context, groupID int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM group_prompt_cache_policies WHERE group_id = $1`, groupID); err != nil {
+		return fmt.Errorf("delete prompt cache policy: %w", err)
+	}
+	return nil
+}
+
+func (r *promptCacheRepository) InsertSavings(ctx context.Context, rec *service.PromptCacheSavingsRecord) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO prompt_cache_savings
+			(request_id, user_id, api_key_id, account_id, group_id, model, ttl, breakpoints,
+			 cache_read_tokens, cache_creation_5m_tokens, cache_creation_1h_tokens, saved_cost, actual_saved_cost, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		rec.RequestID, rec.UserID, rec.APIKeyID, rec.AccountID, nullInt64(rec.GroupID), rec.Model, rec.TTL, rec.Breakpoints,
+		rec.CacheReadTokens, rec.CacheCreation5mTokens, rec.CacheCreation1hTokens, rec.SavedCost, rec.ActualSavedCost, rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert prompt cache savings: %w", err)
+	}
+	return nil
+}
+
+func (r *promptCacheRepository) SumSavings(ctx context.Context, filters usagestats.UsageLogFilters) (*usagestats.PromptCacheSavingsStats, error) {
+	conditions := make([]string, 0, 7)
+	args := make([]any, 0, 7)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(cond, len(args)))
+	}
+	if filters.UserID > 0 {
+		add("user_id = $%d", filters.UserID)
+	}
+	if filters.APIKeyID > 0 {
+		add("api_key_id = $%d", filters.APIKeyID)
+	}
+	if filters.AccountID > 0 {
+		add("account_id = $%d", filters.AccountID)
+	}
+	if filters.GroupID > 0 {
+		add("group_id = $%d", filters.GroupID)
+	}
+	if filters.Model != "" {
+		add("model = $%d", filters.Model)
+	}
+	if filters.StartTime != nil {
+		add("created_at >= $%d", *filters.StartTime)
+	}
+	if filters.EndTime != nil {
+		add("created_at < $%d", *filters.EndTime)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	stats := &usagestats.PromptCacheSavingsStats{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			COALESCE(SUM(cache_read_tokens), 0),
+			COALESCE(SUM(cache_creation_5m_tokens), 0),
+			COALESCE(SUM(cache_creation_1h_tokens), 0),
+			COALESCE(SUM(saved_cost), 0),
+			COALESCE(SUM(actual_saved_cost), 0)
+		FROM prompt_cache_savings `+where, args...).Scan(
+		&stats.Requests, &stats.CacheReadTokens, &stats.CacheCreation5mTokens, &stats.CacheCreation1hTokens,
+		&stats.SavedCost, &stats.ActualSavedCost)
+	if err != nil {
+		return nil, fmt.Errorf("sum prompt cache savings: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,411 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type referralRepository struct {
+	db *sql.DB
+}
+
+// NewReferralRepository 创建邀请返佣数据访问实例
+func NewReferralRepository(db *sql.DB) service.ReferralRepository {
+	return &referralRepository{db: db}
+}
+
+func (r *referralRepository) runInTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const referralAccountColumns = `user_id, code, available_credit, total_commission, total_withdrawn, last_ip, created_at, updated_at`
+
+func scanReferralAccount(row interface{ Scan(...any) error }) (*service.ReferralAccount, error) {
+	a := &service.ReferralAccount{}
+	err := row.Scan(&a.UserID, &a.Code, &a.AvailableCredit, &a.TotalCommission, &a.TotalWithdrawn, &a.LastIP, &a.CreatedAt, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrReferralNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan referral account: %w", err)
+	}
+	return a, nil
+}
+
+func (r *referralRepository) GetAccount(ctx context.Context, userID int64) (*service.ReferralAccount, error) {
+	return scanReferralAccount(r.db.QueryRowContext(ctx,
+		`SELECT `+referralAccountColumns+` FROM referral_accounts WHERE user_id = $1`, userID))
+}
+
+func (r *referralRepository) GetAccountByCode(ctx context.Context, code string) (*service.ReferralAccount, error) {
+	return scanReferralAccount(r.db.QueryRowContext(ctx,
+		`SELECT `+referralAccountColumns+` FROM referral_accounts WHERE code = $1`, code))
+}
+
+func (r *referralRepository) CreateAccount(ctx context.Context, account *service.ReferralAccount) (bool, error) {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO referral_accounts (user_id, code, last_ip, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT DO NOTHING
+		RETURNING created_at, updated_at
+	`, account.UserID, account.Code, account.LastIP).Scan(&account.CreatedAt, &account.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("insert referral account: %w", err)
+	}
+	return true, nil
+}
+
+func (r *referralRepository) UpdateLastIP(ctx context.Context, userID int64, ip string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE referral_accounts SET last_ip = $2, updated_at = NOW() WHERE user_id = $1`, userID, ip)
+	return err
+}
+
+func (r *referralRepository) RecordUserIP(ctx context.Context, userID int64, ip, source string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO referral_user_ips (user_id, ip, source, last_seen_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, ip, source) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at
+	`, userID, ip, source)
+	if err != nil {
+		return fmt.Errorf("record referral user ip: %w", err)
+	}
+	return nil
+}
+
+func (r *referralRepository) HasUserIP(ctx context.Context, userID int64, ip string, loginSince time.Time) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM referral_user_ips
+			WHERE user_id = $1 AND ip = $2 AND (source = $3 OR last_seen_at >= $4)
+		)
+	`, userID, ip, service.ReferralIPRegister, loginSince).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check referral user ip: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *referralRepository) GetRelationByReferee(ctx context.Context, refereeID int64) (*service.ReferralRelation, error) {
+	rel := &service.ReferralRelation{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, referrer_id, referee_id, source, register_ip, created_at
+		FROM referral_relations WHERE referee_id = $1
+	`, refereeID).Scan(&rel.ID, &rel.ReferrerID, &rel.RefereeID, &rel.Source, &rel.RegisterIP, &rel.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrReferralNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get referral relation: %w", err)
+	}
+	return rel, nil
+}
+
+func (r *referralRepository) CreateRelation(ctx context.Context, relation *service.ReferralRelation) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO referral_relations (referrer_id, referee_id, source, register_ip, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`, relation.ReferrerID, relation.RefereeID, relation.Source, relation.RegisterIP).Scan(&relation.ID, &relation.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return service.ErrReferralAlreadyBound
+		}
+		return fmt.Errorf("insert referral relation: %w", err)
+	}
+	return nil
+}
+
+func (r *referralRepository) CountRelationsByIPSince(ctx context.Context, ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM referral_relations WHERE register_ip = $1 AND created_at >= $2`, ip, since,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count referral relations by ip: %w", err)
+	}
+	return count, nil
+}
+
+func referralFilterWhere(alias string, filters service.ReferralListFilters) (string, []any) {
+	where := []string{"1=1"}
+	args := []any{}
+	if filters.ReferrerID > 0 {
+		args = append(args, filters.ReferrerID)
+		where = append(where, fmt.Sprintf("%s.referrer_id = $%d", alias, len(args)))
+	}
+	if filters.RefereeID > 0 {
+		args = append(args, filters.RefereeID)
+		where = append(where, fmt.Sprintf("%s.referee_id = $%d", alias, len(args)))
+	}
+	return strings.Join(where, " AND "), args
+}
+
+func (r *referralRepository) ListRelations(ctx context.Context, params pagination.PaginationParams, filters service.ReferralListFilters) ([]service.ReferralRelation, *pagination.PaginationResult, error) {
+	whereClause, args := referralFilterWhere("rr", filters)
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM referral_relations rr WHERE "+whereClause, args...).Scan(&total); err != nil {
+		return nil, nil, fmt.Errorf("count referral relations: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT rr.id, rr.referrer_id, rr.referee_id, rr.source, rr.register_ip, rr.created_at,
+		       COALESCE(ee.email, ''), COALESCE(er.email, ''),
+		       COALESCE((SELECT SUM(rc.amount) FROM referral_commissions rc WHERE rc.referee_id = rr.referee_id), 0)
+		FROM referral_relations rr
+		LEFT JOIN users ee ON ee.id = rr.referee_id
+		LEFT JOIN users er ON er.id = rr.referrer_id
+		WHERE %s
+		ORDER BY rr.created_at DESC, rr.id DESC
+		LIMIT $%d OFFSET $%d`, whereClause, len(args)+1, len(args)+2)
+	args = append(args, params.Limit(), params.Offset())
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query referral relations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]service.ReferralRelation, 0)
+	for rows.Next() {
+		var rel service.ReferralRelation
+		if err := rows.Scan(&rel.ID, &rel.ReferrerID, &rel.RefereeID, &rel.Source, &rel.RegisterIP, &rel.CreatedAt,
+			&rel.RefereeEmail, &rel.ReferrerEmail, &rel.TotalCommission); err != nil {
+			return nil, nil, fmt.Errorf("scan referral relation: %w", err)
+		}
+		out = append(out, rel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate referral relations: %w", err)
+	}
+	return out, paginationResultFromTotal(total, params), nil
+}
+
+func (r *referralRepository) SumCommissionByReferee(ctx context.Context, refereeID int64) (float64, error) {
+	var sum float64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(amount), 0) FROM referral_commissions WHERE referee_id = $1`, refereeID,
+	).Scan(&sum)
+	if err != nil {
+		return 0, fmt.Errorf("sum referral commission: %w", err)
+	}
+	return sum, nil
+}
+
+func (r *referralRepository) CreditCommission(ctx context.Context, commission *service.ReferralCommission) (bool, error) {
+	inserted := false
+	err := r.runInTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO referral_commissions (referrer_id, referee_id, source_type, source_ref, base_amount, rate, amount, credit_mode, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+			ON CONFLICT (source_type, source_ref) DO NOTHING
+			RETURNING id, created_at
+		`, commission.ReferrerID, commission.RefereeID, commission.SourceType, commission.SourceRef,
+			commission.BaseAmount, commission.Rate, commission.Amount, commission.CreditMode,
+		).Scan(&commission.ID, &commission.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("insert referral commission: %w", err)
+		}
+		inserted = true
+
+		// 佣金钱包累计：邀请人必然已生成邀请码，对应 referral_accounts 行一定存在。
+		availableDelta := 0.0
+		if commission.CreditMode == service.ReferralCreditCredit {
+			availableDelta = commission.Amount
+		}
+		res, err := tx.ExecContext(ctx, `
+			UPDATE referral_accounts
+			SET total_commission = total_commission + $2, available_credit = available_credit + $3, updated_at = NOW()
+			WHERE user_id = $1
+		`, commission.ReferrerID, commission.Amount, availableDelta)
+		if err != nil {
+			return fmt.Errorf("update referral account: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("referral account missing for referrer %d", commission.ReferrerID)
+		}
+
+		if commission.CreditMode == service.ReferralCreditBalance {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE users SET balance = balance + $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`,
+				commission.ReferrerID, commission.Amount,
+			); err != nil {
+				return fmt.Errorf("credit referrer balance: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return inserted, nil
+}
+
+func (r *referralRepository) ListCommissions(ctx context.Context, params pagination.PaginationParams, filters service.ReferralListFilters) ([]service.ReferralCommission, *pagination.PaginationResult, error) {
+	whereClause, args := referralFilterWhere("rc", filters)
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM referral_commissions rc WHERE "+whereClause, args...).Scan(&total); err != nil {
+		return nil, nil, fmt.Errorf("count referral commissions: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT rc.id, rc.referrer_id, rc.referee_id, rc.source_type, rc.source_ref, rc.base_amount, rc.rate, rc.amount, rc.credit_mode, rc.created_at,
+		       COALESCE(u.email, '')
+		FROM referral_commissions rc
+		LEFT JOIN users u ON u.id = rc.referee_id
+		WHERE %s
+		ORDER BY rc.created_at DESC, rc.id DESC
+		LIMIT $%d OFFSET $%d`, whereClause, len(args)+1, len(args)+2)
+	args = append(args, params.Limit(), params.Offset())
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query referral commissions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]service.ReferralCommission, 0)
+	for rows.Next() {
+		var c service.ReferralCommission
+		if err := rows.Scan(&c.ID, &c.ReferrerID, &c.RefereeID, &c.SourceType, &c.SourceRef, &c.BaseAmount, &c.Rate, &c.Amount, &c.CreditMode, &c.CreatedAt,
+			&c.RefereeEmail); err != nil {
+			return nil, nil, fmt.Errorf("scan referral commission: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate referral commissions: %w", err)
+	}
+	return out, paginationResultFromTotal(total, params), nil
+}
+
+func (r *referralRepository) Payout(ctx context.Context, payout *service.ReferralPayout) error {
+	return r.runInTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE referral_accounts
+			SET available_credit = available_credit - $2, total_withdrawn = total_withdrawn + $2, updated_at = NOW()
+			WHERE user_id = $1 AND available_credit >= $2
+		`, payout.UserID, payout.Amount)
+		if err != nil {
+			return fmt.Errorf("deduct referral credit: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return service.ErrReferralInsufficientFunds
+		}
+		if payout.Method == service.ReferralPayoutBalance {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE users SET balance = balance + $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`,
+				payout.UserID, payout.Amount,
+			); err != nil {
+				return fmt.Errorf("credit user balance: %w", err)
+			}
+		}
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO referral_payouts (user_id, amount, method, note, created_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			RETURNING id, created_at
+		`, payout.UserID, payout.Amount, payout.Method, payout.Note).Scan(&payout.ID, &payout.CreatedAt)
+	})
+}
+
+func (r *referralRepository) ListPayouts(ctx context.Context, userID int64, limit int) ([]service.ReferralPayout, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, amount, method, note, created_at
+		FROM referral_payouts WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query referral payouts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]service.ReferralPayout, 0)
+	for rows.Next() {
+		var p service.ReferralPayout
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Amount, &p.Method, &p.Note, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan referral payout: %w", err)
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *referralRepository) GetStats(ctx context.Context, referrerID int64) (*service.ReferralStats, error) {
+	stats := &service.ReferralStats{}
+	relWhere, accWhere := "", ""
+	args := []any{}
+	if referrerID > 0 {
+		relWhere, accWhere = " WHERE referrer_id = $1", " WHERE user_id = $1"
+		args = append(args, referrerID)
+	}
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM referral_relations"+relWhere, args...).Scan(&stats.ReferralCount); err != nil {
+		return nil, fmt.Errorf("count referrals: %w", err)
+	}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(total_commission), 0), COALESCE(SUM(total_withdrawn), 0), COALESCE(SUM(available_credit), 0)
+		FROM referral_accounts`+accWhere, args...,
+	).Scan(&stats.TotalCommission, &stats.TotalWithdrawn, &stats.AvailableCredit)
+	if err != nil {
+		return nil, fmt.Errorf("sum referral accounts: %w", err)
+	}
+	return stats, nil
+}
+
+func (r *referralRepository) MaxUsageLogID(ctx context.Context) (int64, error) {
+	var id int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM usage_logs`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("max usage log id: %w", err)
+	}
+	return id, nil
+}
+
+func (r *referralRepository) AggregateRefereeUsage(ctx context.Context, fromID, toID int64) ([]service.ReferralUsageAggregate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rr.referee_id, rr.referrer_id, rr.created_at, SUM(ul.actual_cost)
+		FROM usage_logs ul
+		JOIN referral_relations rr ON rr.referee_id = ul.user_id
+		WHERE ul.id > $1 AND ul.id <= $2 AND ul.actual_cost > 0
+		GROUP BY rr.referee_id, rr.referrer_id, rr.created_at
+		ORDER BY rr.referee_id
+	`, fromID, toID)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate referee usage: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]service.ReferralUsageAggregate, 0)
+	for rows.Next() {
+		var agg service.ReferralUsageAggregate
+		if err := rows.Scan(&agg.RefereeID, &agg.ReferrerID, &agg.BoundAt, &agg.Cost); err != nil {
+			return nil, fmt.Errorf("scan referee usage: %w", err)
+		}
+		out = append(out, agg)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+	"github.com/lib/pq"
+)
+
+type scimRepository struct {
+	db *sql.DB
+}
+
+// NewSCIMRepository 创建 SCIM 供应数据访问实例
+func NewSCIMRepository(db *sql.DB) service.SCIMRepository {
+	return &scimRepository{db: db}
+}
+
+func (r *scimRepository) GetUserIDByExternalID(ctx context.Context, externalID string) (int64, error) {
+	var userID int64
+	err := r.db.QueryRowContext(ctx, `SELECT user_id FROM scim_user_links WHERE external_id = $1`, externalID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, service.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get scim user link: %w", err)
+	}
+	return userID, nil
+}
+
+func (r *scimRepository) ListExternalIDs(ctx context.Context, userIDs []int64) (map[int64]string, error) {
+	out := make(map[int64]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT user_id, external_id FROM scim_user_links WHERE user_id = ANY($1)`, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("list scim user links: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var userID int64
+		var externalID string
+		if err := rows.Scan(&userID, &externalID); err != nil {
+			return nil, fmt.Errorf("scan scim user link: %w", err)
+		}
+		out[userID] = externalID
+	}
+	return out, rows.Err()
+}
+
+func (r *scimRepository) SetExternalID(ctx context.Context, userID int64, externalID string) error {
+	if externalID == "" {
+		if _, err := r.db.ExecContext(ctx, `DELETE FROM scim_user_links WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("delete scim user link: %w", err)
+		}
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO scim_user_links (user_id, external_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET external_id = EXCLUDED.external_id, updated_at = NOW()`,
+		userID, externalID)
+	if isUniqueViolation(err) {
+		return service.ErrSCIMUniqueness
+	}
+	if err != nil {
+		return fmt.Errorf("set scim user link: %w", err)
+	}
+	return nil
+}
+
+func (r *scimRepository) ListGroupMemberIDs(ctx context.Context, groupID int64) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT uag.user_id
+		FROM user_allowed_groups uag
+		JOIN users u ON u.id = uag.user_id AND u.deleted_at IS NULL
+		WHERE uag.group_id = $1
+		ORDER BY uag.user_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("list scim group members: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var out []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("scan scim group member: %w", err)
+		}
+		out = append(out, userID)
+	}
+	return out, rows.Err()
+}
+
+func (r *scimRepository) DisableUserAPIKeys(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE api_keys SET status = $2, updated_at = NOW()
+		WHERE user_id = $1 AND deleted_at IS NULL AND status <> $2
+		RETURNING key`, userID, service.StatusAPIKeyDisabled)
+	if err != nil {
+		return nil, fmt.Errorf("disable user api keys: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("scan disabled api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type shadowRepository struct {
+	db *sql.DB
+}
+
+// NewShadowRepository 创建影子流量规则与对照记录的数据访问实例
+func NewShadowRepository(db *sql.DB) service.ShadowRepository {
+	return &shadowRepository{db: db}
+}
+
+const groupShadowRuleColumns = `id, group_id, shadow_group_id, sample_rate, model_patterns, max_concurrency, enabled, created_at, updated_at`
+
+func scanGroupShadowRule(row interface{ Scan(...any) error }) (*service.GroupShadowRule, error) {
+	r := &service.GroupShadowRule{}
+	var patterns []byte
+	if err := row.Scan(&r.ID, &r.GroupID, &r.ShadowGroupID, &r.SampleRate, &patterns, &r.MaxConcurrency, &r.Enabled, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if len(patterns) > 0 {
+		if err := json.Unmarshal(patterns, &r.ModelPatterns); err != nil {
+			return nil, fmt.Errorf("decode model_patterns: %w", err)
+		}
+	}
+	if r.ModelPatterns == nil {
+		r.ModelPatterns = []string{}
+	}
+	return r, nil
+}
+
+func (r *shadowRepository) listRules(ctx context.Context, where string, args ...any) ([]*service.GroupShadowRule, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+groupShadowRuleColumns+` FROM group_shadow_rules WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list shadow rules: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []*service.GroupShadowRule
+	for rows.Next() {
+		rule, err := scanGroupShadowRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan shadow rule: %w", err)
+		}
+		out = append(out, rule)
+	}
+	return out, rows.Err()
+}
+
+func (r *shadowRepository) ListRulesByGroup(ctx context.Context, groupID int64) ([]*service.GroupShadowRule, error) {
+	return r.listRules(ctx, `group_id = $1`, groupID)
+}
+
+func (r *shadowRepository) ListEnabledRules(ctx context.Context) ([]*service.GroupShadowRule, error) {
+	return r.listRules(ctx, `enabled = TRUE AND sample_rate > 0`)
+}
+
+func (r *shadowRepository) GetRule(ctx context.Context, id int64) (*service.GroupShadowRule, error) {
+	rule, err := scanGroupShadowRule(r.db.QueryRowContext(ctx,
+		`SELECT `+groupShadowRuleColumns+` FROM group_shadow_rules WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, service.ErrShadowRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get shadow rule: %w", err)
+	}
+	return rule, nil
+}
+
+func (r *shadowRepository) CreateRule(ctx context.Context, rule *service.GroupShadowRule) error {
+	patterns, err := json.Marshal(rule.ModelPatterns)
+	if err != nil {
+		return err
+	}
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO group_shadow_rules (group_id, shadow_group_id, sample_rate, model_patterns, max_concurrency, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4::jsonb, $5, $6, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, rule.GroupID, rule.ShadowGroupID, rule.SampleRate, string(patterns), rule.MaxConcurrency, rule.Enabled).
+		Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if isUniqueViolation(err) {
+		return service.ErrShadowRuleDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("insert shadow rule: %w", err)
+	}
+	return nil
+}
+
+func (r *shadowRepository) UpdateRule(ctx context.Context, rule *service.GroupShadowRule) error {
+	patterns, err := json.Marshal(rule.ModelPatterns)
+	if err != nil {
+		return err
+	}
+	err = r.db.QueryRowContext(ctx, `
+		UPDATE group_shadow_rules
+		SET sample_rate = $3, model_patterns = $4::jsonb, max_concurrency = $5, enabled = $6, updated_at = NOW()
+		WHERE id = $1 AND group_id = $2
+		RETURNING created_at, updated_at
+	`, rule.ID, rule.GroupID, rule.SampleRate, string(patterns), rule.MaxConcurrency, rule.Enabled).
+		Scan(&rule.CreatedAt, &rule.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return service.ErrShadowRuleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("update shadow rule: %w", err)
+	}
+	return nil
+}
+
+func (r *shadowRepository) DeleteRule(ctx context.Context, groupID, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM group_shadow_rules WHERE id = $1 AND group_id = $2`, id, groupID)
+	if err != nil {
+		return fmt.Errorf("delete shadow rule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return service.ErrShadowRuleNotFound
+	}
+	return nil
+}
+
+func (r *shadowRepository) InsertLog(ctx context.Context, l *service.ShadowUsageLog) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO shadow_usage_logs (
+			rule_id, group_id, shadow_group_id, user_id, api_key_id, model, stream,
+			primary_account_id, primary_duration_ms, primary_first_token_ms, primary_input_tokens, primary_output_tokens,
+			primary_cache_creation_tokens, primary_cache_read_tokens, primary_cost,
+			shadow_account_id, shadow_status, shadow_status_code, shadow_error, shadow_duration_ms, shadow_first_token_ms,
+			shadow_input_tokens, shadow_output_tokens, shadow_cache_creation_tokens, shadow_cache_read_tokens, shadow_cost,
+			created_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7,
+			$8, $9, $10, $11, $12,
+			$13, $14, $15,
+			$16, $17, $18, $19, $20, $21,
+			$22, $23, $24, $25, $26,
+			NOW()
+		)
+		RETURNING id, created_at
+	`,
+		l.RuleID, l.GroupID, l.ShadowGroupID, l.UserID, l.APIKeyID, l.Model, l.Stream,
+		l.PrimaryAccountID, l.PrimaryDurationMs, l.PrimaryFirstTokenMs, l.PrimaryInputTokens, l.PrimaryOutputTokens,
+		l.PrimaryCacheCreationTokens, l.PrimaryCacheReadTokens, l.PrimaryCost,
+		l.ShadowAccountID, l.ShadowStatus, l.ShadowStatusCode, l.ShadowError, l.ShadowDurationMs, l.ShadowFirstTokenMs,
+		l.ShadowInputTokens, l.ShadowOutputTokens, l.ShadowCacheCreationTokens, l.ShadowCacheReadTokens, l.ShadowCost,
+	).Scan(&l.ID, &l.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert shadow usage log: %w", err)
+	}
+	return nil
+}
+
+// shadowSideSelect 单侧指标的聚合表达式；延迟、token 与成本只统计影子成功的成对样本，保证两侧可直接比较
+func shadowSideSelect(prefix string) string {
+	const paired = `FILTER (WHERE shadow_status = 'success')`
+	return fmt.Sprintf(`
+		COALESCE(AVG(%[1]s_duration_ms) %[2]s, 0),
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY %[1]s_duration_ms) %[2]s, 0),
+		COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY %[1]s_duration_ms) %[2]s, 0),
+		COALESCE(AVG(%[1]s_first_token_ms) %[2]s, 0),
+		COALESCE(SUM(%[1]s_input_tokens) %[2]s, 0),
+		COALESCE(SUM(%[1]s_output_tokens) %[2]s, 0),
+		COALESCE(SUM(%[1]s_cache_creation_tokens) %[2]s, 0),
+		COALESCE(SUM(%[1]s_cache_read_tokens) %[2]s, 0),
+		COALESCE(SUM(%[1]s_cost) %[2]s, 0)`, prefix, paired)
+}
+
+var shadowComparisonSelect = `
+		COUNT(*),
+		COUNT(*) FILTER (WHERE shadow_status = 'skipped'),
+		COUNT(*) FILTER (WHERE shadow_status = 'error'),` +
+	shadowSideSelect("primary") + `,` +
+	shadowSideSelect("shadow")
+
+// scanShadowComparison 扫描 shadowComparisonSelect 结果，返回样本数、skipped 数与两侧指标
+func scanShadowComparison(row interface{ Scan(...any) error }, extra ...any) (samples, skipped int64, primary, shadow service.ShadowSideStats, err error) {
+	var shadowErrors int64
+	side := func(s *service.ShadowSideStats) []any {
+		return []any{&s.AvgDurationMs, &s.P50DurationMs, &s.P95DurationMs, &s.AvgFirstTokenMs,
+			&s.InputTokens, &s.OutputTokens, &s.CacheCreationTokens, &s.CacheReadTokens, &s.Cost}
+	}
+	dest := append([]any{}, extra...)
+	dest = append(dest, &samples, &skipped, &shadowErrors)
+	dest = append(dest, side(&primary)...)
+	dest = append(dest, side(&shadow)...)
+	if err = row.Scan(dest...); err != nil {
+		return
+	}
+	primary.Requests = samples
+	shadow.Requests = samples - skipped
+	shadow.Errors = shadowErrors
+	if shadow.Requests > 0 {
+		shadow.ErrorRate = float64(shadow.Errors) / float64(shadow.Requests)
+	}
+	return
+}
+
+func (r *shadowRepository) GetComparison(ctx context.Context, ruleID int64, start, end time.Time) (*service.ShadowComparisonReport, error) {
+	report := &service.ShadowComparisonReport{}
+	samples, skipped, primary, shadow, err := scanShadowComparison(r.db.QueryRowContext(ctx,
+		`SELECT `+shadowComparisonSelect+`
+		FROM shadow_usage_logs
+		WHERE rule_id = $1 AND created_at >= $2 AND created_at < $3`, ruleID, start, end))
+	if err != nil {
+		return nil, fmt.Errorf("shadow comparison: %w", err)
+	}
+	report.Samples, report.Skipped, report.Primary, report.Shadow = samples, skipped, primary, shadow
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT model, `+shadowComparisonSelect+`
+		FROM shadow_usage_logs
+		WHERE rule_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY model
+		ORDER BY COUNT(*) DESC, model`, ruleID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("shadow comparison by model: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var item service.ShadowModelComparison
+		if _, _, item.Primary, item.Shadow, err = scanShadowComparison(rows, &item.Model); err != nil {
+			return nil, fmt.Errorf("scan shadow comparison: %w", err)
+		}
+		report.ByModel = append(report.ByModel, item)
+	}
+	return report, rows.Err()
+}
@@ -86,6 +86,9 @@ func TestUsageLogRepositoryCreateSyncRequestTypeAndLegacyFields(t *testing.T) {
 			sqlmock.AnyArg(), // billing_tier
 			sqlmock.AnyArg(), // billing_mode
 			sqlmock.AnyArg(), // account_stats_cost
+			sqlmock.AnyArg(), // context_action
+			sqlmock.AnyArg(), // audio_input_tokens
+			sqlmock.AnyArg(), // audio_output_tokens
 			createdAt,
 		).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(int64(99), createdAt))
@@ -165,6 +168,9 @@ func TestUsageLogRepositoryCreate_PersistsServiceTier(t *testing.T) {
 			sqlmock.AnyArg(), // billing_tier
 			sqlmock.AnyArg(), // billing_mode
 			sqlmock.AnyArg(), // account_stats_cost
+			sqlmock.AnyArg(), // context_action
+			sqlmock.AnyArg(), // audio_input_tokens
+			sqlmock.AnyArg(), // audio_output_tokens
 			createdAt,
 		).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(int64(100), createdAt))
@@ -490,6 +496,9 @@ func TestScanUsageLogRequestTypeAndLegacyFallback(t *testing.T) {
 			sql.NullString{},  // billing_tier
 			sql.NullString{},  // billing_mode
 			sql.NullFloat64{}, // account_stats_cost
+			sql.NullString{},  // context_action
+			0,                 // audio_input_tokens
+			0,                 // audio_output_tokens
 			now,
 		}})
 		require.NoError(t, err)
@@ -538,6 +547,9 @@ func TestScanUsageLogRequestTypeAndLegacyFallback(t *testing.T) {
 			sql.NullString{},  // billing_tier
 			sql.NullString{},  // billing_mode
 			sql.NullFloat64{}, // account_stats_cost
+			sql.NullString{},  // context_action
+			0,                 // audio_input_tokens
+			0,                 // audio_output_tokens
 			now,
 		}})
 		require.NoError(t, err)
@@ -586,6 +598,9 @@ func TestScanUsageLogRequestTypeAndLegacyFallback(t *testing.T) {
 			sql.NullString{},  // billing_tier
 			sql.NullString{},  // billing_mode
 			sql.NullFloat64{}, // account_stats_cost
+			sql.NullString{},  // context_action
+			0,                 // audio_input_tokens
+			0,                 // audio_output_tokens
 			now,
 		}})
 		require.NoError(t, err)
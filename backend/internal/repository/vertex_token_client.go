@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/geminicli"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/vertex"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+)
+
+type vertexTokenClient struct{}
+
+func NewVertexTokenClient() service.VertexTokenClient {
+	return &vertexTokenClient{}
+}
+
+// ExchangeJWT 用服务账号签名的 JWT 断言换取 access token（RFC 7523 jwt-bearer）。
+func (c *vertexTokenClient) ExchangeJWT(ctx context.Context, tokenURL, assertion, proxyURL string) (*vertex.TokenResponse, error) {
+	client, err := createGeminiReqClient(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP client: %w", err)
+	}
+
+	formData := url.Values{}
+	formData.Set("grant_type", vertex.GrantTypeJWTBearer)
+	formData.Set("assertion", assertion)
+
+	var tokenResp vertex.TokenResponse
+	resp, err := client.R().
+		SetContext(ctx).
+		SetFormDataFromValues(formData).
+		SetSuccessResult(&tokenResp).
+		Post(tokenURL)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if !resp.IsSuccessState() {
+		return nil, fmt.Errorf("token exchange failed: status %d, body: %s", resp.StatusCode, geminicli.SanitizeBodyForLogs(resp.String()))
+	}
+	return &tokenResp, nil
+}
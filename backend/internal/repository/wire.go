@@ -89,6 +89,18 @@ var ProviderSet = wire.NewSet(
 	NewErrorPassthroughRepository,
 	NewTLSFingerprintProfileRepository,
 	NewChannelRepository,
+	NewReferralRepository,
+	NewBudgetRepository,
+	NewAPIKeyPriorityRepository,
+	NewPromptCacheRepository,
+	NewContextPolicyRepository,
+	NewPrivacyRepository,
+	NewShadowRepository,
+	NewOAuthGrantRepository,
+	NewSCIMRepository,
+	NewPasskeyRepository,
+	NewRecoveryCodeRepository,
+	NewDirectoryLinkRepository,
 
 	// Cache implementations
 	NewGatewayCache,
@@ -103,6 +115,7 @@ var ProviderSet = wire.NewSet(
 	NewUserMsgQueueCache,
 	NewDashboardCache,
 	NewEmailCache,
+	NewOAuthServerCache,
 	NewIdentityCache,
 	NewRedeemCache,
 	NewUpdateCache,
@@ -111,9 +124,12 @@ var ProviderSet = wire.NewSet(
 	NewSchedulerOutboxRepository,
 	NewProxyLatencyCache,
 	NewTotpCache,
+	NewPasskeyCache,
 	NewRefreshTokenCache,
 	NewErrorPassthroughCache,
 	NewTLSFingerprintProfileCache,
+	NewBudgetSpendCache,
+	NewClusterStateCache,
 
 	// Encryptors
 	NewAESEncryptor,
@@ -133,6 +149,8 @@ var ProviderSet = wire.NewSet(
 	NewOpenAIOAuthClient,
 	NewGeminiOAuthClient,
 	NewGeminiCliCodeAssistClient,
+	NewVertexTokenClient,
+	NewAzureOpenAITokenClient,
 	NewGeminiDriveClient,
 
 	ProvideEnt,
@@ -10,6 +10,7 @@ import (
 
 	"github.com/Wei-Shaw/sub2api/internal/config"
 	"github.com/Wei-Shaw/sub2api/internal/handler"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/webfetch"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/websearch"
 	middleware2 "github.com/Wei-Shaw/sub2api/internal/server/middleware"
 	"github.com/Wei-Shaw/sub2api/internal/service"
@@ -67,12 +68,14 @@ func ProvideRouter(
 		}
 		configs := make([]websearch.ProviderConfig, 0, len(cfg.Providers))
 		for _, p := range cfg.Providers {
-			if p.APIKey == "" {
+			if p.APIKey == "" && websearch.ProviderRequiresAPIKey(p.Type) {
 				continue
 			}
 			pc := websearch.ProviderConfig{
 				Type:       p.Type,
 				APIKey:     p.APIKey,
+				BaseURL:    p.BaseURL,
+				Generic:    p.Generic,
 				QuotaLimit: derefInt64(p.QuotaLimit),
 				ExpiresAt:  p.ExpiresAt,
 			}
@@ -95,6 +98,9 @@ func ProvideRouter(
 		service.SetWebSearchManager(websearch.NewManager(configs, redisClient))
 	})
 
+	// web_fetch 模拟抓取器：限制来自配置文件，启动时构建一次
+	service.SetWebFetcher(webfetch.NewFetcher(service.WebFetchOptionsFromConfig(cfg), redisClient))
+
 	return SetupRouter(r, handlers, jwtAuth, adminAuth, apiKeyAuth, apiKeyService, subscriptionService, opsService, settingService, cfg, redisClient)
 }
 
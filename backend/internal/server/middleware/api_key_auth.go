@@ -119,6 +119,7 @@ func apiKeyAuthWithSubscription(apiKeyService *service.APIKeyService, subscripti
 			})
 			c.Set(string(ContextKeyUserRole), apiKey.User.Role)
 			setGroupContext(c, apiKey.Group)
+			setPriorityContext(c, apiKeyService, apiKey)
 			_ = apiKeyService.TouchLastUsed(c.Request.Context(), apiKey.ID)
 			c.Next()
 			return
@@ -214,6 +215,7 @@ func apiKeyAuthWithSubscription(apiKeyService *service.APIKeyService, subscripti
 		})
 		c.Set(string(ContextKeyUserRole), apiKey.User.Role)
 		setGroupContext(c, apiKey.Group)
+		setPriorityContext(c, apiKeyService, apiKey)
 		_ = apiKeyService.TouchLastUsed(c.Request.Context(), apiKey.ID)
 
 		c.Next()
@@ -250,3 +252,9 @@ func setGroupContext(c *gin.Context, group *service.Group) {
 	ctx := context.WithValue(c.Request.Context(), ctxkey.Group, group)
 	c.Request = c.Request.WithContext(ctx)
 }
+
+// setPriorityContext 将 API Key 的优先级分道写入 request context，供账号槽位获取与等待队列使用
+func setPriorityContext(c *gin.Context, apiKeyService *service.APIKeyService, apiKey *service.APIKey) {
+	class := apiKeyService.PriorityClassOf(c.Request.Context(), apiKey.ID)
+	c.Request = c.Request.WithContext(service.WithRequestPriority(c.Request.Context(), class))
+}
@@ -1,12 +1,18 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
 
 // AuthSubject is the minimal authenticated identity stored in gin context.
 // Decision: {UserID int64, Concurrency int}
 type AuthSubject struct {
 	UserID      int64
 	Concurrency int
+	// AuthTime is when the JWT session was established; zero for API keys and legacy tokens.
+	AuthTime time.Time
 }
 
 func GetAuthSubjectFromContext(c *gin.Context) (AuthSubject, bool) {
@@ -3,6 +3,7 @@ package middleware
 import (
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/service"
 
@@ -68,10 +69,14 @@ func jwtAuth(authService *service.AuthService, userService *service.UserService)
 			return
 		}
 
-		c.Set(string(ContextKeyUser), AuthSubject{
+		subject := AuthSubject{
 			UserID:      user.ID,
 			Concurrency: user.Concurrency,
-		})
+		}
+		if claims.AuthTime > 0 {
+			subject.AuthTime = time.Unix(claims.AuthTime, 0)
+		}
+		c.Set(string(ContextKeyUser), subject)
 		c.Set(string(ContextKeyUserRole), user.Role)
 
 		c.Next()
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// NodeIDHeader 标识处理请求的副本，便于多副本部署时排查会话粘连问题
+const NodeIDHeader = "X-Sub2API-Node"
+
+// NodeIdentity 在响应头中写入当前副本标识
+func NodeIdentity(nodeID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if nodeID != "" {
+			c.Header(NodeIDHeader, nodeID)
+		}
+		c.Next()
+	}
+}
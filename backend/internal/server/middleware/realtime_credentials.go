@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// realtimeAPIKeySubprotocolPrefix 浏览器无法设置 Authorization 头，OpenAI Realtime 约定通过该子协议携带 Key
+const realtimeAPIKeySubprotocolPrefix = "openai-insecure-api-key."
+
+// RealtimeCredentials 为 Realtime WebSocket 握手归一化 API Key 的传递方式。
+//
+// 除 Authorization / x-api-key 头外，Realtime 客户端还可能通过子协议 openai-insecure-api-key.<key>
+// 或查询参数 api_key / key 传递 Key。该中间件需挂在 API Key 认证之前：
+// 将 Key 移入 Authorization 头，并从子协议与查询参数中移除，避免被回显给客户端或透传到上游。
+// 非 WebSocket 升级请求不做处理（查询参数中的 Key 仍由认证中间件拒绝）。
+func RealtimeCredentials() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isWebSocketUpgrade(c) {
+			c.Next()
+			return
+		}
+		// 两处都需要移除，子协议优先
+		key := extractRealtimeSubprotocolKey(c)
+		queryKey := extractRealtimeQueryKey(c)
+		if key == "" {
+			key = queryKey
+		}
+		if key != "" && strings.TrimSpace(c.GetHeader("Authorization")) == "" && strings.TrimSpace(c.GetHeader("x-api-key")) == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+key)
+		}
+		c.Next()
+	}
+}
+
+func isWebSocketUpgrade(c *gin.Context) bool {
+	if c == nil || c.Request == nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(c.GetHeader("Upgrade")), "websocket")
+}
+
+// extractRealtimeSubprotocolKey 提取并移除 openai-insecure-api-key.<key> 子协议
+func extractRealtimeSubprotocolKey(c *gin.Context) string {
+	values := c.Request.Header.Values("Sec-WebSocket-Protocol")
+	if len(values) == 0 {
+		return ""
+	}
+	key := ""
+	kept := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, protocol := range strings.Split(value, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if protocol == "" {
+				continue
+			}
+			if strings.HasPrefix(protocol, realtimeAPIKeySubprotocolPrefix) {
+				if key == "" {
+					key = strings.TrimSpace(strings.TrimPrefix(protocol, realtimeAPIKeySubprotocolPrefix))
+				}
+				continue
+			}
+			kept = append(kept, protocol)
+		}
+	}
+	c.Request.Header.Del("Sec-WebSocket-Protocol")
+	if len(kept) > 0 {
+		c.Request.Header.Set("Sec-WebSocket-Protocol", strings.Join(kept, ", "))
+	}
+	return key
+}
+
+// extractRealtimeQueryKey 提取并移除查询参数中的 Key。
+// 直接操作 URL 而非 c.Query，避免 gin 缓存移除前的查询参数。
+func extractRealtimeQueryKey(c *gin.Context) string {
+	if c.Request.URL == nil || c.Request.URL.RawQuery == "" {
+		return ""
+	}
+	query := c.Request.URL.Query()
+	key := strings.TrimSpace(query.Get("api_key"))
+	if key == "" {
+		key = strings.TrimSpace(query.Get("key"))
+	}
+	if !query.Has("api_key") && !query.Has("key") {
+		return ""
+	}
+	query.Del("api_key")
+	query.Del("key")
+	c.Request.URL.RawQuery = query.Encode()
+	return key
+}
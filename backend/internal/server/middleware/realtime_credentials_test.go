@@ -0,0 +1,66 @@
+//go:build unit
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func runRealtimeCredentials(t *testing.T, target string, headers map[string]string) (*http.Request, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var seen *http.Request
+	var queryKey string
+	r.GET("/v1/realtime", RealtimeCredentials(), func(c *gin.Context) {
+		seen = c.Request
+		queryKey = c.Query("api_key") + c.Query("key")
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, seen)
+	return seen, queryKey
+}
+
+func TestRealtimeCredentials_Subprotocol(t *testing.T) {
+	req, _ := runRealtimeCredentials(t, "/v1/realtime?model=gpt-realtime", map[string]string{
+		"Upgrade":                "websocket",
+		"Sec-WebSocket-Protocol": "realtime, openai-insecure-api-key.sk-test, openai-beta.realtime-v1",
+	})
+	require.Equal(t, "Bearer sk-test", req.Header.Get("Authorization"))
+	require.Equal(t, "realtime, openai-beta.realtime-v1", req.Header.Get("Sec-WebSocket-Protocol"))
+	require.Equal(t, "gpt-realtime", req.URL.Query().Get("model"))
+}
+
+func TestRealtimeCredentials_QueryKeyRemoved(t *testing.T) {
+	req, queryKey := runRealtimeCredentials(t, "/v1/realtime?model=gpt-realtime&api_key=sk-query", map[string]string{
+		"Upgrade": "websocket",
+	})
+	require.Equal(t, "Bearer sk-query", req.Header.Get("Authorization"))
+	require.Empty(t, queryKey, "后续中间件不应再看到查询参数中的 Key")
+	require.Equal(t, "model=gpt-realtime", req.URL.RawQuery)
+}
+
+func TestRealtimeCredentials_HeaderTakesPrecedence(t *testing.T) {
+	req, queryKey := runRealtimeCredentials(t, "/v1/realtime?key=sk-query", map[string]string{
+		"Upgrade":       "websocket",
+		"Authorization": "Bearer sk-header",
+	})
+	require.Equal(t, "Bearer sk-header", req.Header.Get("Authorization"))
+	require.Empty(t, queryKey)
+}
+
+func TestRealtimeCredentials_NonUpgradeUntouched(t *testing.T) {
+	req, queryKey := runRealtimeCredentials(t, "/v1/realtime?api_key=sk-query", nil)
+	require.Empty(t, req.Header.Get("Authorization"))
+	require.Equal(t, "sk-query", queryKey)
+}
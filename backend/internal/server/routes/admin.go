@@ -88,6 +88,12 @@ func RegisterAdminRoutes(
 
 		// 渠道管理
 		registerChannelRoutes(admin, h)
+
+		// 邀请返利
+		registerReferralRoutes(admin, h)
+
+		// 声明式配置（plan / apply）
+		registerConfigRoutes(admin, h)
 	}
 }
 
@@ -104,9 +110,14 @@ func registerOpsRoutes(admin *gin.RouterGroup, h *handler.Handlers) {
 		// Realtime ops signals
 		ops.GET("/concurrency", h.Admin.Ops.GetConcurrencyStats)
 		ops.GET("/user-concurrency", h.Admin.Ops.GetUserConcurrencyStats)
+		ops.GET("/fair-share", h.Admin.Ops.GetFairShareStats)
 		ops.GET("/account-availability", h.Admin.Ops.GetAccountAvailability)
 		ops.GET("/realtime-traffic", h.Admin.Ops.GetRealtimeTrafficSummary)
 
+		// Multi-replica nodes and session ownership
+		ops.GET("/cluster/nodes", h.Admin.Ops.GetClusterNodes)
+		ops.GET("/cluster/nodes/:node_id/sessions", h.Admin.Ops.ListClusterNodeSessions)
+
 		// Alerts (rules + events)
 		ops.GET("/alert-rules", h.Admin.Ops.ListAlertRules)
 		ops.POST("/alert-rules", h.Admin.Ops.CreateAlertRule)
@@ -244,6 +255,20 @@ func registerGroupRoutes(admin *gin.RouterGroup, h *handler.Handlers) {
 		groups.PUT("/:id/rate-multipliers", h.Admin.Group.BatchSetGroupRateMultipliers)
 		groups.DELETE("/:id/rate-multipliers", h.Admin.Group.ClearGroupRateMultipliers)
 		groups.GET("/:id/api-keys", h.Admin.Group.GetGroupAPIKeys)
+
+		// 流量镜像（shadow）规则
+		groups.GET("/:id/shadow-rules", h.Admin.Shadow.List)
+		groups.POST("/:id/shadow-rules", h.Admin.Shadow.Create)
+		groups.PUT("/:id/shadow-rules/:rule_id", h.Admin.Shadow.Update)
+		groups.DELETE("/:id/shadow-rules/:rule_id", h.Admin.Shadow.Delete)
+		groups.GET("/:id/shadow-rules/:rule_id/report", h.Admin.Shadow.GetReport)
+		// 自动缓存断点策略
+		groups.GET("/:id/prompt-cache-policy", h.Admin.PromptCache.GetPolicy)
+		groups.PUT("/:id/prompt-cache-policy", h.Admin.PromptCache.UpdatePolicy)
+		groups.DELETE("/:id/prompt-cache-policy", h.Admin.PromptCache.DeletePolicy)
+		groups.GET("/:id/context-policy", h.Admin.ContextPolicy.GetPolicy)
+		groups.PUT("/:id/context-policy", h.Admin.ContextPolicy.UpdatePolicy)
+		groups.DELETE("/:id/context-policy", h.Admin.ContextPolicy.DeletePolicy)
 	}
 }
 
@@ -404,6 +429,9 @@ func registerSettingsRoutes(admin *gin.RouterGroup, h *handler.Handlers) {
 		// 请求整流器配置
 		adminSettings.GET("/rectifier", h.Admin.Setting.GetRectifierSettings)
 		adminSettings.PUT("/rectifier", h.Admin.Setting.UpdateRectifierSettings)
+		// 分组内公平准入配置
+		adminSettings.GET("/fair-share", h.Admin.Setting.GetFairShareSettings)
+		adminSettings.PUT("/fair-share", h.Admin.Setting.UpdateFairShareSettings)
 		// Beta 策略配置
 		adminSettings.GET("/beta-policy", h.Admin.Setting.GetBetaPolicySettings)
 		adminSettings.PUT("/beta-policy", h.Admin.Setting.UpdateBetaPolicySettings)
@@ -549,6 +577,11 @@ func registerTLSFingerprintProfileRoutes(admin *gin.RouterGroup, h *handler.Hand
 		profiles.POST("", h.Admin.TLSFingerprintProfile.Create)
 		profiles.PUT("/:id", h.Admin.TLSFingerprintProfile.Update)
 		profiles.DELETE("/:id", h.Admin.TLSFingerprintProfile.Delete)
+		profiles.POST("/import", h.Admin.TLSFingerprintProfile.Import)
+		profiles.POST("/capture", h.Admin.TLSFingerprintProfile.StartCapture)
+		profiles.GET("/capture/:capture_id", h.Admin.TLSFingerprintProfile.GetCapture)
+		profiles.GET("/:id/fingerprint", h.Admin.TLSFingerprintProfile.ExportFingerprint)
+		profiles.POST("/:id/diff", h.Admin.TLSFingerprintProfile.Diff)
 	}
 }
 
@@ -563,3 +596,24 @@ func registerChannelRoutes(admin *gin.RouterGroup, h *handler.Handlers) {
 		channels.DELETE("/:id", h.Admin.Channel.Delete)
 	}
 }
+
+func registerReferralRoutes(admin *gin.RouterGroup, h *handler.Handlers) {
+	referrals := admin.Group("/referrals")
+	{
+		referrals.GET("/config", h.Admin.Referral.GetConfig)
+		referrals.PUT("/config", h.Admin.Referral.UpdateConfig)
+		referrals.GET("/stats", h.Admin.Referral.GetStats)
+		referrals.GET("/relations", h.Admin.Referral.ListRelations)
+		referrals.GET("/commissions", h.Admin.Referral.ListCommissions)
+		referrals.GET("/users/:id/payouts", h.Admin.Referral.ListUserPayouts)
+		referrals.POST("/users/:id/payouts", h.Admin.Referral.RecordPayout)
+	}
+}
+
+func registerConfigRoutes(admin *gin.RouterGroup, h *handler.Handlers) {
+	cfg := admin.Group("/config")
+	{
+		cfg.POST("/plan", h.Admin.Config.Plan)
+		cfg.POST("/apply", h.Admin.Config.Apply)
+	}
+}
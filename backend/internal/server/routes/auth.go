@@ -37,6 +37,16 @@ func RegisterAuthRoutes(
 		auth.POST("/login/2fa", rateLimiter.LimitWithOptions("auth-login-2fa", 20, time.Minute, middleware.RateLimitOptions{
 			FailureMode: middleware.RateLimitFailClose,
 		}), h.Auth.Login2FA)
+		auth.POST("/login/2fa/passkey/options", rateLimiter.LimitWithOptions("auth-login-2fa", 20, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.Auth.Login2FAPasskeyOptions)
+		// 通行密钥无密码登录（可发现凭据）
+		auth.POST("/passkey/login/options", rateLimiter.LimitWithOptions("auth-passkey-login", 30, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.Auth.PasskeyLoginOptions)
+		auth.POST("/passkey/login", rateLimiter.LimitWithOptions("auth-passkey-login", 30, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.Auth.PasskeyLogin)
 		auth.POST("/send-verify-code", rateLimiter.LimitWithOptions("auth-send-verify-code", 5, time.Minute, middleware.RateLimitOptions{
 			FailureMode: middleware.RateLimitFailClose,
 		}), h.Auth.SendVerifyCode)
@@ -78,6 +88,28 @@ func RegisterAuthRoutes(
 			}),
 			h.Auth.CompleteOIDCOAuthRegistration,
 		)
+		// 目录登录（LDAP 绑定 / SAML 2.0 SP），邀请码补全注册与已有账号关联各共用一个入口
+		auth.POST("/ldap/login", rateLimiter.LimitWithOptions("auth-ldap-login", 20, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.Auth.LDAPLogin)
+		auth.GET("/saml/metadata", h.Auth.SAMLMetadata)
+		auth.GET("/saml/login", h.Auth.SAMLLogin)
+		auth.POST("/saml/acs", rateLimiter.LimitWithOptions("auth-saml-acs", 30, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.Auth.SAMLACS)
+		auth.POST("/sso/complete-registration",
+			rateLimiter.LimitWithOptions("sso-complete", 10, time.Minute, middleware.RateLimitOptions{
+				FailureMode: middleware.RateLimitFailClose,
+			}),
+			h.Auth.CompleteDirectorySSORegistration,
+		)
+		// 关联已有本地账号需要校验本地密码，按补全注册的强度限流
+		auth.POST("/sso/link",
+			rateLimiter.LimitWithOptions("sso-link", 10, time.Minute, middleware.RateLimitOptions{
+				FailureMode: middleware.RateLimitFailClose,
+			}),
+			h.Auth.LinkDirectoryAccount,
+		)
 	}
 
 	// 公开设置（无需认证）
@@ -86,6 +118,9 @@ func RegisterAuthRoutes(
 		settings.GET("/public", h.Setting.GetPublicSettings)
 	}
 
+	// 公开模型价格（无需认证）
+	v1.GET("/pricing/public", h.ModelCatalog.GetPublicPricing)
+
 	// 需要认证的当前用户信息
 	authenticated := v1.Group("")
 	authenticated.Use(gin.HandlerFunc(jwtAuth))
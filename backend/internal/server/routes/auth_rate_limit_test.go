@@ -51,6 +51,9 @@ func TestAuthRoutesRateLimitFailCloseWhenRedisUnavailable(t *testing.T) {
 		"/api/v1/auth/register",
 		"/api/v1/auth/login",
 		"/api/v1/auth/login/2fa",
+		"/api/v1/auth/login/2fa/passkey/options",
+		"/api/v1/auth/passkey/login/options",
+		"/api/v1/auth/passkey/login",
 		"/api/v1/auth/send-verify-code",
 	}
 
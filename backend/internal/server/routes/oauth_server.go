@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/handler"
+	"github.com/Wei-Shaw/sub2api/internal/middleware"
+	servermiddleware "github.com/Wei-Shaw/sub2api/internal/server/middleware"
+	"github.com/Wei-Shaw/sub2api/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// RegisterOAuthServerRoutes 注册 OAuth 授权服务器路由（CLI 设备码 / 授权码 + PKCE 登录）
+func RegisterOAuthServerRoutes(
+	r *gin.Engine,
+	v1 *gin.RouterGroup,
+	h *handler.Handlers,
+	jwtAuth servermiddleware.JWTAuthMiddleware,
+	redisClient *redis.Client,
+	settingService *service.SettingService,
+) {
+	rateLimiter := middleware.NewRateLimiter(redisClient)
+
+	r.GET("/.well-known/oauth-authorization-server", h.OAuthServer.Metadata)
+
+	oauth := v1.Group("/oauth")
+	{
+		// 公开端点（RFC 6749 / 7009 / 8628），供 CLI 直接调用；设备码轮询按 interval 进行，令牌端点限额相应放宽
+		oauth.POST("/device_authorization", rateLimiter.LimitWithOptions("oauth-device-authorization", 10, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.OAuthServer.DeviceAuthorization)
+		oauth.POST("/token", rateLimiter.LimitWithOptions("oauth-token", 60, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.OAuthServer.Token)
+		oauth.POST("/revoke", rateLimiter.LimitWithOptions("oauth-revoke", 30, time.Minute, middleware.RateLimitOptions{
+			FailureMode: middleware.RateLimitFailClose,
+		}), h.OAuthServer.Revoke)
+
+		// 授权页与授权管理（需登录）
+		authenticated := oauth.Group("")
+		authenticated.Use(gin.HandlerFunc(jwtAuth))
+		authenticated.Use(servermiddleware.BackendModeUserGuard(settingService))
+		{
+			authenticated.GET("/consent", h.OAuthServer.GetConsent)
+			authenticated.POST("/device/approve", h.OAuthServer.ApproveDevice)
+			authenticated.POST("/authorize", h.OAuthServer.Authorize)
+			authenticated.GET("/grants", h.OAuthServer.ListGrants)
+			authenticated.DELETE("/grants/:id", h.OAuthServer.RevokeGrant)
+		}
+	}
+}
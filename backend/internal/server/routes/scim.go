@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"github.com/Wei-Shaw/sub2api/internal/handler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterSCIMRoutes 注册 SCIM 2.0 供应端点（RFC 7644），由 IdP 使用 scim.bearer_token 调用
+func RegisterSCIMRoutes(r *gin.Engine, h *handler.Handlers) {
+	scim := r.Group("/scim/v2")
+	scim.Use(h.SCIM.Authenticate)
+	{
+		scim.GET("/ServiceProviderConfig", h.SCIM.ServiceProviderConfig)
+		scim.GET("/ResourceTypes", h.SCIM.ResourceTypes)
+
+		scim.GET("/Users", h.SCIM.ListUsers)
+		scim.POST("/Users", h.SCIM.CreateUser)
+		scim.GET("/Users/:id", h.SCIM.GetUser)
+		scim.PUT("/Users/:id", h.SCIM.ReplaceUser)
+		scim.PATCH("/Users/:id", h.SCIM.PatchUser)
+		scim.DELETE("/Users/:id", h.SCIM.DeleteUser)
+
+		scim.GET("/Groups", h.SCIM.ListGroups)
+		scim.POST("/Groups", h.SCIM.CreateGroup)
+		scim.GET("/Groups/:id", h.SCIM.GetGroup)
+		scim.PUT("/Groups/:id", h.SCIM.ReplaceGroup)
+		scim.PATCH("/Groups/:id", h.SCIM.PatchGroup)
+		scim.DELETE("/Groups/:id", h.SCIM.DeleteGroup)
+	}
+}
@@ -15,6 +15,9 @@ func RegisterUserRoutes(
 	jwtAuth middleware.JWTAuthMiddleware,
 	settingService *service.SettingService,
 ) {
+	// 数据导出下载（签名短链，无需登录）
+	v1.GET("/data-exports/:id/download", h.Privacy.DownloadExport)
+
 	authenticated := v1.Group("")
 	authenticated.Use(gin.HandlerFunc(jwtAuth))
 	authenticated.Use(middleware.BackendModeUserGuard(settingService))
@@ -45,6 +48,55 @@ func RegisterUserRoutes(
 				totp.POST("/enable", h.Totp.Enable)
 				totp.POST("/disable", h.Totp.Disable)
 			}
+
+			// WebAuthn 通行密钥（可注册多个命名密钥）
+			passkeys := user.Group("/passkeys")
+			{
+				passkeys.GET("", h.Passkey.List)
+				passkeys.POST("/register/options", h.Passkey.BeginRegistration)
+				passkeys.POST("/register", h.Passkey.FinishRegistration)
+				passkeys.PATCH("/:id", h.Passkey.Rename)
+				passkeys.DELETE("/:id", h.Passkey.Delete)
+			}
+
+			// 2FA 恢复码（TOTP 与通行密钥共用）
+			recoveryCodes := user.Group("/recovery-codes")
+			{
+				recoveryCodes.GET("", h.Passkey.GetRecoveryCodeStatus)
+				recoveryCodes.POST("/regenerate", h.Passkey.RegenerateRecoveryCodes)
+			}
+
+			// 邀请返利
+			referral := user.Group("/referral")
+			{
+				referral.GET("", h.Referral.GetDashboard)
+				referral.GET("/referees", h.Referral.ListReferees)
+				referral.GET("/commissions", h.Referral.ListCommissions)
+				referral.GET("/payouts", h.Referral.ListPayouts)
+				referral.POST("/withdraw", h.Referral.Withdraw)
+			}
+
+			// 消费预算
+			budgets := user.Group("/budgets")
+			{
+				budgets.GET("", h.Budget.List)
+				budgets.POST("", h.Budget.Create)
+				budgets.GET("/settings", h.Budget.GetSettings)
+				budgets.PUT("/settings", h.Budget.UpdateSettings)
+				budgets.PUT("/:id", h.Budget.Update)
+				budgets.DELETE("/:id", h.Budget.Delete)
+			}
+
+			// 数据导出与账号注销
+			privacy := user.Group("/privacy")
+			{
+				privacy.GET("/exports", h.Privacy.ListExports)
+				privacy.POST("/exports", h.Privacy.RequestExport)
+				privacy.GET("/exports/:id", h.Privacy.GetExport)
+				privacy.GET("/deletion", h.Privacy.GetDeletion)
+				privacy.POST("/deletion", h.Privacy.RequestDeletion)
+				privacy.DELETE("/deletion", h.Privacy.CancelDeletion)
+			}
 		}
 
 		// API Key管理
@@ -55,6 +107,8 @@ func RegisterUserRoutes(
 			keys.POST("", h.APIKey.Create)
 			keys.PUT("/:id", h.APIKey.Update)
 			keys.DELETE("/:id", h.APIKey.Delete)
+			keys.GET("/:id/priority", h.APIKey.GetPriority)
+			keys.PUT("/:id/priority", h.APIKey.UpdatePriority)
 		}
 
 		// 用户可用分组（非管理员接口）
@@ -14,6 +14,8 @@ import (
 
 	"github.com/Wei-Shaw/sub2api/internal/config"
 	"github.com/Wei-Shaw/sub2api/internal/domain"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/azureopenai"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/vertex"
 )
 
 type Account struct {
@@ -832,6 +834,31 @@ func (a *Account) IsBedrockAPIKey() bool {
 	return a.IsBedrock() && a.GetCredential("auth_mode") == "apikey"
 }
 
+// IsVertex 返回是否为 Google Vertex AI 账号（Anthropic 平台走 rawPredict，Gemini 平台走 generateContent）
+func (a *Account) IsVertex() bool {
+	return a.Type == AccountTypeVertex && (a.Platform == PlatformAnthropic || a.Platform == PlatformGemini)
+}
+
+// GetVertexProjectID 返回 Vertex 项目 ID，未配置时使用服务账号 JSON 中的 project_id
+func (a *Account) GetVertexProjectID() string {
+	if projectID := strings.TrimSpace(a.GetCredential("vertex_project_id")); projectID != "" {
+		return projectID
+	}
+	var sa struct {
+		ProjectID string `json:"project_id"`
+	}
+	_ = json.Unmarshal([]byte(a.GetCredential("service_account_json")), &sa)
+	return strings.TrimSpace(sa.ProjectID)
+}
+
+// GetVertexRegion 返回 Vertex 区域，未配置时使用全局端点
+func (a *Account) GetVertexRegion() string {
+	if region := strings.TrimSpace(a.GetCredential("vertex_region")); region != "" {
+		return region
+	}
+	return vertex.DefaultRegion
+}
+
 // IsAPIKeyOrBedrock 返回账号类型是否支持配额和池模式等特性
 func (a *Account) IsAPIKeyOrBedrock() bool {
 	return a.Type == AccountTypeAPIKey || a.Type == AccountTypeBedrock
@@ -866,6 +893,55 @@ func (a *Account) GetOpenAIBaseURL() string {
 	return "https://api.openai.com"
 }
 
+// IsAzureOpenAI 返回是否为 Azure OpenAI 账号
+func (a *Account) IsAzureOpenAI() bool {
+	return a.IsOpenAI() && a.Type == AccountTypeAzure
+}
+
+// GetAzureEndpoint 返回 Azure OpenAI 资源端点，如 https://my-resource.openai.azure.com
+func (a *Account) GetAzureEndpoint() string {
+	if !a.IsAzureOpenAI() {
+		return ""
+	}
+	return strings.TrimSpace(a.GetCredential("azure_endpoint"))
+}
+
+// GetAzureAPIVersion 返回 api-version，未配置时使用默认版本；"v1" 表示使用 /openai/v1 路径
+func (a *Account) GetAzureAPIVersion() string {
+	if v := strings.TrimSpace(a.GetCredential("api_version")); v != "" {
+		return v
+	}
+	return azureopenai.DefaultAPIVersion
+}
+
+// IsAzureEntraAuth 返回是否使用 Entra ID 客户端凭据认证（credentials.auth_mode = "entra"），否则使用 api-key
+func (a *Account) IsAzureEntraAuth() bool {
+	return a.IsAzureOpenAI() && a.GetCredential("auth_mode") == "entra"
+}
+
+// UsesAzureChatCompletionsAPI 返回上游是否走 Chat Completions（部分部署未开放 Responses API）
+func (a *Account) UsesAzureChatCompletionsAPI() bool {
+	return a.IsAzureOpenAI() && a.GetCredential("azure_upstream_api") == "chat_completions"
+}
+
+// ResolveAzureDeployment 将（model_mapping 之后的）模型名解析为 Azure 部署名。
+// 部署映射来自 credentials.deployment_mapping（支持通配符），未命中时使用模型名本身。
+func (a *Account) ResolveAzureDeployment(model string) string {
+	raw, _ := a.Credentials["deployment_mapping"].(map[string]any)
+	if len(raw) > 0 {
+		mapping := make(map[string]string, len(raw))
+		for k, v := range raw {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				mapping[k] = strings.TrimSpace(s)
+			}
+		}
+		if deployment, ok := resolveRequestedModelInMapping(mapping, model); ok {
+			return deployment
+		}
+	}
+	return model
+}
+
 func (a *Account) GetOpenAIAccessToken() string {
 	if !a.IsOpenAI() {
 		return ""
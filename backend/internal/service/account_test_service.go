@@ -18,12 +18,15 @@ import (
 	"time"
 
 	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/azureopenai"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/claude"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/geminicli"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/openai"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/vertex"
 	"github.com/Wei-Shaw/sub2api/internal/util/urlvalidator"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
 )
 
 // sseDataPrefix matches SSE data lines with optional whitespace after colon.
@@ -58,6 +61,8 @@ const (
 type AccountTestService struct {
 	accountRepo               AccountRepository
 	geminiTokenProvider       *GeminiTokenProvider
+	vertexTokenProvider       *VertexTokenProvider
+	azureTokenProvider        *AzureOpenAITokenProvider
 	antigravityGatewayService *AntigravityGatewayService
 	httpUpstream              HTTPUpstream
 	cfg                       *config.Config
@@ -68,6 +73,8 @@ type AccountTestService struct {
 func NewAccountTestService(
 	accountRepo AccountRepository,
 	geminiTokenProvider *GeminiTokenProvider,
+	vertexTokenProvider *VertexTokenProvider,
+	azureTokenProvider *AzureOpenAITokenProvider,
 	antigravityGatewayService *AntigravityGatewayService,
 	httpUpstream HTTPUpstream,
 	cfg *config.Config,
@@ -76,6 +83,8 @@ func NewAccountTestService(
 	return &AccountTestService{
 		accountRepo:               accountRepo,
 		geminiTokenProvider:       geminiTokenProvider,
+		vertexTokenProvider:       vertexTokenProvider,
+		azureTokenProvider:        azureTokenProvider,
 		antigravityGatewayService: antigravityGatewayService,
 		httpUpstream:              httpUpstream,
 		cfg:                       cfg,
@@ -203,6 +212,9 @@ func (s *AccountTestService) testClaudeAccountConnection(c *gin.Context, account
 	if account.IsBedrock() {
 		return s.testBedrockAccountConnection(c, ctx, account, testModelID)
 	}
+	if account.IsVertex() {
+		return s.testVertexClaudeAccountConnection(c, ctx, account, testModelID)
+	}
 
 	// Determine authentication method and API URL
 	var authToken string
@@ -409,6 +421,77 @@ func (s *AccountTestService) testBedrockAccountConnection(c *gin.Context, ctx co
 	return nil
 }
 
+// testVertexClaudeAccountConnection tests a Vertex AI Claude account using non-streaming rawPredict
+func (s *AccountTestService) testVertexClaudeAccountConnection(c *gin.Context, ctx context.Context, account *Account, testModelID string) error {
+	testModelID = ResolveVertexClaudeModelID(account, testModelID)
+	projectID := account.GetVertexProjectID()
+	if projectID == "" {
+		return s.sendErrorAndEnd(c, "No Vertex project_id configured")
+	}
+	if s.vertexTokenProvider == nil {
+		return s.sendErrorAndEnd(c, "Vertex token provider not configured")
+	}
+
+	// Set SSE headers (test UI expects SSE)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Flush()
+
+	vertexPayload := map[string]any{
+		"anthropic_version": vertex.AnthropicVersion,
+		"messages": []map[string]any{
+			{
+				"role": "user",
+				"content": []map[string]any{
+					{
+						"type": "text",
+						"text": "hi",
+					},
+				},
+			},
+		},
+		"max_tokens": 256,
+	}
+	vertexBody, _ := json.Marshal(vertexPayload)
+
+	s.sendEvent(c, TestEvent{Type: "test_start", Model: testModelID})
+
+	accessToken, err := s.vertexTokenProvider.GetAccessToken(ctx, account)
+	if err != nil {
+		return s.sendErrorAndEnd(c, fmt.Sprintf("Failed to get access token: %s", err.Error()))
+	}
+
+	apiURL := vertex.ClaudeURL(projectID, account.GetVertexRegion(), testModelID, false)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(vertexBody))
+	if err != nil {
+		return s.sendErrorAndEnd(c, "Failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := s.httpUpstream.DoWithTLS(req, resolveAccountProxyURL(account), account.ID, account.Concurrency, nil)
+	if err != nil {
+		return s.sendErrorAndEnd(c, fmt.Sprintf("Request failed: %s", err.Error()))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return s.sendErrorAndEnd(c, fmt.Sprintf("API returned %d: %s", resp.StatusCode, string(body)))
+	}
+
+	text := gjson.GetBytes(body, "content.0.text").String()
+	if text == "" {
+		text = "(empty response)"
+	}
+
+	s.sendEvent(c, TestEvent{Type: "content", Text: text})
+	s.sendEvent(c, TestEvent{Type: "test_complete", Success: true})
+	return nil
+}
+
 // testOpenAIAccountConnection tests an OpenAI account's connection
 func (s *AccountTestService) testOpenAIAccountConnection(c *gin.Context, account *Account, modelID string) error {
 	ctx := c.Request.Context()
@@ -419,8 +502,8 @@ func (s *AccountTestService) testOpenAIAccountConnection(c *gin.Context, account
 		testModelID = openai.DefaultTestModel
 	}
 
-	// For API Key accounts with model mapping, map the model
-	if account.Type == "apikey" {
+	// For API Key / Azure accounts with model mapping, map the model
+	if account.Type == "apikey" || account.Type == AccountTypeAzure {
 		mapping := account.GetModelMapping()
 		if len(mapping) > 0 {
 			if mappedModel, exists := mapping[testModelID]; exists {
@@ -462,6 +545,8 @@ func (s *AccountTestService) testOpenAIAccountConnection(c *gin.Context, account
 			return s.sendErrorAndEnd(c, fmt.Sprintf("Invalid base URL: %s", err.Error()))
 		}
 		apiURL = strings.TrimSuffix(normalizedBaseURL, "/") + "/responses"
+	} else if account.IsAzureOpenAI() {
+		return s.testAzureOpenAIAccountConnection(c, ctx, account, testModelID)
 	} else {
 		return s.sendErrorAndEnd(c, fmt.Sprintf("Unsupported account type: %s", account.Type))
 	}
@@ -541,8 +626,8 @@ func (s *AccountTestService) testGeminiAccountConnection(c *gin.Context, account
 		testModelID = geminicli.DefaultTestModel
 	}
 
-	// For API Key accounts with model mapping, map the model
-	if account.Type == AccountTypeAPIKey {
+	// For API Key / Vertex accounts with model mapping, map the model
+	if account.Type == AccountTypeAPIKey || account.Type == AccountTypeVertex {
 		mapping := account.GetModelMapping()
 		if len(mapping) > 0 {
 			if mappedModel, exists := mapping[testModelID]; exists {
@@ -570,6 +655,8 @@ func (s *AccountTestService) testGeminiAccountConnection(c *gin.Context, account
 		req, err = s.buildGeminiAPIKeyRequest(ctx, account, testModelID, payload)
 	case AccountTypeOAuth:
 		req, err = s.buildGeminiOAuthRequest(ctx, account, testModelID, payload)
+	case AccountTypeVertex:
+		req, err = s.buildGeminiVertexRequest(ctx, account, testModelID, payload)
 	default:
 		return s.sendErrorAndEnd(c, fmt.Sprintf("Unsupported account type: %s", account.Type))
 	}
@@ -685,6 +772,30 @@ func (s *AccountTestService) buildGeminiAPIKeyRequest(ctx context.Context, accou
 	return req, nil
 }
 
+// buildGeminiVertexRequest builds request for Gemini models on Vertex AI
+func (s *AccountTestService) buildGeminiVertexRequest(ctx context.Context, account *Account, modelID string, payload []byte) (*http.Request, error) {
+	if s.vertexTokenProvider == nil {
+		return nil, fmt.Errorf("vertex token provider not configured")
+	}
+	projectID := account.GetVertexProjectID()
+	if projectID == "" {
+		return nil, fmt.Errorf("no Vertex project_id configured")
+	}
+	accessToken, err := s.vertexTokenProvider.GetAccessToken(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	fullURL := vertex.GeminiURL(projectID, account.GetVertexRegion(), modelID, "streamGenerateContent")
+	req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return req, nil
+}
+
 // buildGeminiOAuthRequest builds request for Gemini OAuth accounts
 func (s *AccountTestService) buildGeminiOAuthRequest(ctx context.Context, account *Account, modelID string, payload []byte) (*http.Request, error) {
 	if s.geminiTokenProvider == nil {
@@ -972,6 +1083,98 @@ func (s *AccountTestService) processClaudeStream(c *gin.Context, body io.Reader)
 	}
 }
 
+// testAzureOpenAIAccountConnection tests an Azure OpenAI account against its deployment,
+// using the Responses API or Chat Completions according to azure_upstream_api.
+func (s *AccountTestService) testAzureOpenAIAccountConnection(c *gin.Context, ctx context.Context, account *Account, testModelID string) error {
+	endpoint := account.GetAzureEndpoint()
+	if endpoint == "" {
+		return s.sendErrorAndEnd(c, "No Azure endpoint configured")
+	}
+	normalizedEndpoint, err := s.validateUpstreamBaseURL(endpoint)
+	if err != nil {
+		return s.sendErrorAndEnd(c, fmt.Sprintf("Invalid Azure endpoint: %s", err.Error()))
+	}
+
+	var authToken string
+	if account.IsAzureEntraAuth() {
+		if s.azureTokenProvider == nil {
+			return s.sendErrorAndEnd(c, "Azure token provider not configured")
+		}
+		authToken, err = s.azureTokenProvider.GetAccessToken(ctx, account)
+		if err != nil {
+			return s.sendErrorAndEnd(c, fmt.Sprintf("Failed to get access token: %s", err.Error()))
+		}
+	} else {
+		authToken = account.GetCredential("api_key")
+		if authToken == "" {
+			return s.sendErrorAndEnd(c, "No API key available")
+		}
+	}
+
+	// Set SSE headers
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Flush()
+
+	deployment := account.ResolveAzureDeployment(testModelID)
+	apiVersion := account.GetAzureAPIVersion()
+	chatMode := account.UsesAzureChatCompletionsAPI()
+
+	var apiURL string
+	var payload map[string]any
+	if chatMode {
+		apiURL = azureopenai.ChatCompletionsURL(normalizedEndpoint, deployment, apiVersion)
+		payload = map[string]any{
+			"model":    deployment,
+			"messages": []map[string]any{{"role": "user", "content": "hi"}},
+		}
+	} else {
+		apiURL = azureopenai.ResponsesURL(normalizedEndpoint, apiVersion)
+		payload = createOpenAITestPayload(deployment, false)
+	}
+	apiURL = azureopenai.WithAPIVersion(apiURL, apiVersion)
+	payloadBytes, _ := json.Marshal(payload)
+
+	s.sendEvent(c, TestEvent{Type: "test_start", Model: testModelID})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return s.sendErrorAndEnd(c, "Failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setOpenAIUpstreamAuthHeader(req, account, authToken)
+
+	resp, err := s.httpUpstream.DoWithTLS(req, resolveAccountProxyURL(account), account.ID, account.Concurrency, nil)
+	if err != nil {
+		return s.sendErrorAndEnd(c, fmt.Sprintf("Request failed: %s", err.Error()))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnauthorized && s.accountRepo != nil {
+			errMsg := fmt.Sprintf("Authentication failed (401): %s", string(body))
+			_ = s.accountRepo.SetError(ctx, account.ID, errMsg)
+		}
+		return s.sendErrorAndEnd(c, fmt.Sprintf("API returned %d: %s", resp.StatusCode, string(body)))
+	}
+
+	if !chatMode {
+		return s.processOpenAIStream(c, resp.Body)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return s.sendErrorAndEnd(c, fmt.Sprintf("Failed to read response: %s", err.Error()))
+	}
+	if text := gjson.GetBytes(body, "choices.0.message.content").String(); text != "" {
+		s.sendEvent(c, TestEvent{Type: "content", Text: text})
+	}
+	s.sendEvent(c, TestEvent{Type: "test_complete", Success: true})
+	return nil
+}
+
 // processOpenAIStream processes the SSE stream from OpenAI Responses API
 func (s *AccountTestService) processOpenAIStream(c *gin.Context, body io.Reader) error {
 	reader := bufio.NewReader(body)
@@ -266,6 +266,7 @@ type AccountUsageService struct {
 	cache                   *UsageCache
 	identityCache           IdentityCache
 	tlsFPProfileService     *TLSFingerprintProfileService
+	quotaForecastService    *QuotaForecastService
 }
 
 // NewAccountUsageService 创建AccountUsageService实例
@@ -278,6 +279,7 @@ func NewAccountUsageService(
 	cache *UsageCache,
 	identityCache IdentityCache,
 	tlsFPProfileService *TLSFingerprintProfileService,
+	quotaForecastService *QuotaForecastService,
 ) *AccountUsageService {
 	return &AccountUsageService{
 		accountRepo:             accountRepo,
@@ -288,6 +290,7 @@ func NewAccountUsageService(
 		cache:                   cache,
 		identityCache:           identityCache,
 		tlsFPProfileService:     tlsFPProfileService,
+		quotaForecastService:    quotaForecastService,
 	}
 }
 
@@ -808,10 +811,13 @@ func (s *AccountUsageService) getAntigravityUsage(ctx context.Context, account *
 		}
 
 		enrichUsageWithAccountError(fetchResult.UsageInfo, account)
+		now := time.Now()
 		s.cache.antigravityCache.Store(account.ID, &antigravityUsageCache{
 			usageInfo: fetchResult.UsageInfo,
-			timestamp: time.Now(),
+			timestamp: now,
 		})
+		// 分模型额度作为调度额度预测的采样来源
+		s.quotaForecastService.ObserveAntigravityQuota(account.ID, fetchResult.UsageInfo.AntigravityQuota, now)
 		return fetchResult.UsageInfo, nil
 	})
 
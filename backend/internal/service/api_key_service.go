@@ -158,6 +158,8 @@ type CreateAPIKeyRequest struct {
 	// Quota fields
 	Quota         float64 `json:"quota"`           // Quota limit in USD (0 = unlimited)
 	ExpiresInDays *int    `json:"expires_in_days"` // Days until expiry (nil = never expires)
+	// ExpiresAt 精确过期时间，仅供内部签发短期 Key（如 OAuth 授权）使用，优先于 ExpiresInDays
+	ExpiresAt *time.Time `json:"-"`
 
 	// Rate limit fields (0 = unlimited)
 	RateLimit5h float64 `json:"rate_limit_5h"`
@@ -206,6 +208,7 @@ type APIKeyService struct {
 	authGroup             singleflight.Group
 	lastUsedTouchL1       sync.Map // keyID -> nextAllowedAt(time.Time)
 	lastUsedTouchSF       singleflight.Group
+	priorityService       *RequestPriorityService
 }
 
 // NewAPIKeyService 创建API Key服务实例
@@ -237,6 +240,21 @@ func (s *APIKeyService) SetRateLimitCacheInvalidator(inv RateLimitCacheInvalidat
 	s.rateLimitCacheInvalid = inv
 }
 
+// SetRequestPriorityService sets the optional API key priority class resolver.
+func (s *APIKeyService) SetRequestPriorityService(priority *RequestPriorityService) {
+	s.priorityService = priority
+}
+
+// PriorityClassOf returns the priority class (interactive / normal / background) of an API key.
+func (s *APIKeyService) PriorityClassOf(ctx context.Context, apiKeyID int64) string {
+	return s.priorityService.ClassOf(ctx, apiKeyID)
+}
+
+// SetPriorityClass updates the priority class of an API key and returns the normalized class.
+func (s *APIKeyService) SetPriorityClass(ctx context.Context, apiKeyID int64, class string) (string, error) {
+	return s.priorityService.SetClass(ctx, apiKeyID, class)
+}
+
 func (s *APIKeyService) compileAPIKeyIPRules(apiKey *APIKey) {
 	if apiKey == nil {
 		return
@@ -412,7 +430,10 @@ func (s *APIKeyService) Create(ctx context.Context, userID int64, req CreateAPIK
 	}
 
 	// Set expiration time if specified
-	if req.ExpiresInDays != nil && *req.ExpiresInDays > 0 {
+	if req.ExpiresAt != nil {
+		expiresAt := *req.ExpiresAt
+		apiKey.ExpiresAt = &expiresAt
+	} else if req.ExpiresInDays != nil && *req.ExpiresInDays > 0 {
 		expiresAt := time.Now().AddDate(0, 0, *req.ExpiresInDays)
 		apiKey.ExpiresAt = &expiresAt
 	}
@@ -55,6 +55,8 @@ type JWTClaims struct {
 	Email        string `json:"email"`
 	Role         string `json:"role"`
 	TokenVersion int64  `json:"token_version"` // Used to invalidate tokens on password change
+	// AuthTime 本次登录完成的时间（Unix 秒），刷新 token 时保持不变，用于敏感操作判断是否为新近登录
+	AuthTime int64 `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -71,12 +73,51 @@ type AuthService struct {
 	emailQueueService  *EmailQueueService
 	promoService       *PromoService
 	defaultSubAssigner DefaultSubscriptionAssigner
+	registrationObs    UserRegistrationObserver
+	loginObs           UserLoginObserver
 }
 
 type DefaultSubscriptionAssigner interface {
 	AssignOrExtendSubscription(ctx context.Context, input *AssignSubscriptionInput) (*UserSubscription, bool, error)
 }
 
+// UserRegistrationObserver is notified after a new user account has been created
+// (email registration and first-time OAuth login). Implementations must not fail registration.
+type UserRegistrationObserver interface {
+	OnUserRegistered(ctx context.Context, user *User)
+}
+
+// SetRegistrationObserver 注入新用户注册回调（如邀请返佣归因）
+func (s *AuthService) SetRegistrationObserver(observer UserRegistrationObserver) {
+	s.registrationObs = observer
+}
+
+func (s *AuthService) notifyUserRegistered(ctx context.Context, user *User) {
+	if s.registrationObs == nil || user == nil || user.ID <= 0 {
+		return
+	}
+	s.registrationObs.OnUserRegistered(ctx, user)
+}
+
+// UserLoginObserver is notified when a login completes and tokens are issued to the user.
+// Implementations must not fail the login.
+type UserLoginObserver interface {
+	OnUserLogin(ctx context.Context, user *User, ip string)
+}
+
+// SetLoginObserver 注入登录成功回调（如记录邀请人登录 IP）
+func (s *AuthService) SetLoginObserver(observer UserLoginObserver) {
+	s.loginObs = observer
+}
+
+// NotifyUserLogin 在登录签发 token 后调用（密码、第二步验证、通行密钥、第三方登录）
+func (s *AuthService) NotifyUserLogin(ctx context.Context, user *User, ip string) {
+	if s == nil || s.loginObs == nil || user == nil || user.ID <= 0 {
+		return
+	}
+	s.loginObs.OnUserLogin(ctx, user, ip)
+}
+
 // NewAuthService 创建认证服务实例
 func NewAuthService(
 	entClient *dbent.Client,
@@ -206,6 +247,7 @@ func (s *AuthService) RegisterWithVerification(ctx context.Context, email, passw
 		return "", nil, ErrServiceUnavailable
 	}
 	s.assignDefaultSubscriptions(ctx, user.ID)
+	s.notifyUserRegistered(ctx, user)
 
 	// 标记邀请码为已使用（如果使用了邀请码）
 	if invitationRedeemCode != nil {
@@ -502,6 +544,7 @@ func (s *AuthService) LoginOrRegisterOAuth(ctx context.Context, email, username
 			} else {
 				user = newUser
 				s.assignDefaultSubscriptions(ctx, user.ID)
+				s.notifyUserRegistered(ctx, user)
 			}
 		} else {
 			logger.LegacyPrintf("service.auth", "[Auth] Database error during oauth login: %v", err)
@@ -528,21 +571,26 @@ func (s *AuthService) LoginOrRegisterOAuth(ctx context.Context, email, username
 	return token, user, nil
 }
 
-// LoginOrRegisterOAuthWithTokenPair 用于第三方 OAuth/SSO 登录，返回完整的 TokenPair。
-// 与 LoginOrRegisterOAuth 功能相同，但返回 TokenPair 而非单个 token。
+// LoginOrRegisterOAuthUser 用于第三方 OAuth/SSO 登录，解析身份对应的用户（首次登录视为注册），不签发 token。
+// 调用方需先完成第二步验证检查，再通过 GenerateTokenPair 签发 token。
 // invitationCode 仅在邀请码注册模式下新用户注册时使用；已有账号登录时忽略。
-func (s *AuthService) LoginOrRegisterOAuthWithTokenPair(ctx context.Context, email, username, invitationCode string) (*TokenPair, *User, error) {
-	// 检查 refreshTokenCache 是否可用
-	if s.refreshTokenCache == nil {
-		return nil, nil, errors.New("refresh token cache not configured")
-	}
+func (s *AuthService) LoginOrRegisterOAuthUser(ctx context.Context, email, username, invitationCode string) (*User, error) {
+	return s.resolveOAuthUser(ctx, email, username, invitationCode, true)
+}
 
+// RegisterOAuthUser 与 LoginOrRegisterOAuthUser 相同，但邮箱已被占用时返回 ErrEmailExists，
+// 不会绑定到已有账号。用于目录登录这类必须显式关联本地账号的场景。
+func (s *AuthService) RegisterOAuthUser(ctx context.Context, email, username, invitationCode string) (*User, error) {
+	return s.resolveOAuthUser(ctx, email, username, invitationCode, false)
+}
+
+func (s *AuthService) resolveOAuthUser(ctx context.Context, email, username, invitationCode string, bindExisting bool) (*User, error) {
 	email = strings.TrimSpace(email)
 	if email == "" || len(email) > 255 {
-		return nil, nil, infraerrors.BadRequest("INVALID_EMAIL", "invalid email")
+		return nil, infraerrors.BadRequest("INVALID_EMAIL", "invalid email")
 	}
 	if _, err := mail.ParseAddress(email); err != nil {
-		return nil, nil, infraerrors.BadRequest("INVALID_EMAIL", "invalid email")
+		return nil, infraerrors.BadRequest("INVALID_EMAIL", "invalid email")
 	}
 
 	username = strings.TrimSpace(username)
@@ -551,25 +599,28 @@ func (s *AuthService) LoginOrRegisterOAuthWithTokenPair(ctx context.Context, ema
 	}
 
 	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err == nil && !bindExisting {
+		return nil, ErrEmailExists
+	}
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			// OAuth 首次登录视为注册
 			if s.settingService == nil || !s.settingService.IsRegistrationEnabled(ctx) {
-				return nil, nil, ErrRegDisabled
+				return nil, ErrRegDisabled
 			}
 
 			// 检查是否需要邀请码
 			var invitationRedeemCode *RedeemCode
 			if s.settingService != nil && s.settingService.IsInvitationCodeEnabled(ctx) {
 				if invitationCode == "" {
-					return nil, nil, ErrOAuthInvitationRequired
+					return nil, ErrOAuthInvitationRequired
 				}
 				redeemCode, err := s.redeemRepo.GetByCode(ctx, invitationCode)
 				if err != nil {
-					return nil, nil, ErrInvitationCodeInvalid
+					return nil, ErrInvitationCodeInvalid
 				}
 				if redeemCode.Type != RedeemTypeInvitation || redeemCode.Status != StatusUnused {
-					return nil, nil, ErrInvitationCodeInvalid
+					return nil, ErrInvitationCodeInvalid
 				}
 				invitationRedeemCode = redeemCode
 			}
@@ -577,11 +628,11 @@ func (s *AuthService) LoginOrRegisterOAuthWithTokenPair(ctx context.Context, ema
 			randomPassword, err := randomHexString(32)
 			if err != nil {
 				logger.LegacyPrintf("service.auth", "[Auth] Failed to generate random password for oauth signup: %v", err)
-				return nil, nil, ErrServiceUnavailable
+				return nil, ErrServiceUnavailable
 			}
 			hashedPassword, err := s.HashPassword(randomPassword)
 			if err != nil {
-				return nil, nil, fmt.Errorf("hash password: %w", err)
+				return nil, fmt.Errorf("hash password: %w", err)
 			}
 
 			defaultBalance := s.cfg.Default.UserBalance
@@ -605,63 +656,71 @@ func (s *AuthService) LoginOrRegisterOAuthWithTokenPair(ctx context.Context, ema
 				tx, err := s.entClient.Tx(ctx)
 				if err != nil {
 					logger.LegacyPrintf("service.auth", "[Auth] Failed to begin transaction for oauth registration: %v", err)
-					return nil, nil, ErrServiceUnavailable
+					return nil, ErrServiceUnavailable
 				}
 				defer func() { _ = tx.Rollback() }()
 				txCtx := dbent.NewTxContext(ctx, tx)
 
 				if err := s.userRepo.Create(txCtx, newUser); err != nil {
 					if errors.Is(err, ErrEmailExists) {
+						if !bindExisting {
+							return nil, ErrEmailExists
+						}
 						user, err = s.userRepo.GetByEmail(ctx, email)
 						if err != nil {
 							logger.LegacyPrintf("service.auth", "[Auth] Database error getting user after conflict: %v", err)
-							return nil, nil, ErrServiceUnavailable
+							return nil, ErrServiceUnavailable
 						}
 					} else {
 						logger.LegacyPrintf("service.auth", "[Auth] Database error creating oauth user: %v", err)
-						return nil, nil, ErrServiceUnavailable
+						return nil, ErrServiceUnavailable
 					}
 				} else {
 					if err := s.redeemRepo.Use(txCtx, invitationRedeemCode.ID, newUser.ID); err != nil {
-						return nil, nil, ErrInvitationCodeInvalid
+						return nil, ErrInvitationCodeInvalid
 					}
 					if err := tx.Commit(); err != nil {
 						logger.LegacyPrintf("service.auth", "[Auth] Failed to commit oauth registration transaction: %v", err)
-						return nil, nil, ErrServiceUnavailable
+						return nil, ErrServiceUnavailable
 					}
 					user = newUser
 					s.assignDefaultSubscriptions(ctx, user.ID)
+					s.notifyUserRegistered(ctx, user)
 				}
 			} else {
 				if err := s.userRepo.Create(ctx, newUser); err != nil {
 					if errors.Is(err, ErrEmailExists) {
+						if !bindExisting {
+							return nil, ErrEmailExists
+						}
 						user, err = s.userRepo.GetByEmail(ctx, email)
 						if err != nil {
 							logger.LegacyPrintf("service.auth", "[Auth] Database error getting user after conflict: %v", err)
-							return nil, nil, ErrServiceUnavailable
+							return nil, ErrServiceUnavailable
 						}
 					} else {
 						logger.LegacyPrintf("service.auth", "[Auth] Database error creating oauth user: %v", err)
-						return nil, nil, ErrServiceUnavailable
+						return nil, ErrServiceUnavailable
 					}
 				} else {
 					user = newUser
 					s.assignDefaultSubscriptions(ctx, user.ID)
 					if invitationRedeemCode != nil {
 						if err := s.redeemRepo.Use(ctx, invitationRedeemCode.ID, user.ID); err != nil {
-							return nil, nil, ErrInvitationCodeInvalid
+							return nil, ErrInvitationCodeInvalid
 						}
 					}
+					s.notifyUserRegistered(ctx, user)
 				}
 			}
 		} else {
 			logger.LegacyPrintf("service.auth", "[Auth] Database error during oauth login: %v", err)
-			return nil, nil, ErrServiceUnavailable
+			return nil, ErrServiceUnavailable
 		}
 	}
 
 	if !user.IsActive() {
-		return nil, nil, ErrUserNotActive
+		return nil, ErrUserNotActive
 	}
 
 	if user.Username == "" && username != "" {
@@ -671,11 +730,7 @@ func (s *AuthService) LoginOrRegisterOAuthWithTokenPair(ctx context.Context, ema
 		}
 	}
 
-	tokenPair, err := s.GenerateTokenPair(ctx, user, "")
-	if err != nil {
-		return nil, nil, fmt.Errorf("generate token pair: %w", err)
-	}
-	return tokenPair, user, nil
+	return user, nil
 }
 
 // pendingOAuthTokenTTL is the validity period for pending OAuth tokens.
@@ -688,22 +743,37 @@ type pendingOAuthClaims struct {
 	Email    string `json:"email"`
 	Username string `json:"username"`
 	Purpose  string `json:"purpose"`
+	// Provider / Subject / Groups 仅目录登录（LDAP/SAML）使用，补全注册后关联目录身份并按组映射同步权限
+	Provider string   `json:"provider,omitempty"`
+	Subject  string   `json:"subject,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // CreatePendingOAuthToken generates a short-lived JWT that carries the OAuth identity
 // while waiting for the user to supply an invitation code.
 func (s *AuthService) CreatePendingOAuthToken(email, username string) (string, error) {
+	return s.signPendingOAuthClaims(&pendingOAuthClaims{Email: email, Username: username})
+}
+
+// CreatePendingDirectoryToken 与 CreatePendingOAuthToken 相同，额外携带目录来源与组成员
+func (s *AuthService) CreatePendingDirectoryToken(identity *DirectoryIdentity) (string, error) {
+	return s.signPendingOAuthClaims(&pendingOAuthClaims{
+		Email:    identity.Email,
+		Username: identity.Username,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Groups:   identity.Groups,
+	})
+}
+
+func (s *AuthService) signPendingOAuthClaims(claims *pendingOAuthClaims) (string, error) {
 	now := time.Now()
-	claims := &pendingOAuthClaims{
-		Email:    email,
-		Username: username,
-		Purpose:  pendingOAuthPurpose,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(pendingOAuthTokenTTL)),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-		},
+	claims.Purpose = pendingOAuthPurpose
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(pendingOAuthTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(s.cfg.JWT.Secret))
@@ -712,8 +782,37 @@ func (s *AuthService) CreatePendingOAuthToken(email, username string) (string, e
 // VerifyPendingOAuthToken validates a pending OAuth token and returns the embedded identity.
 // Returns ErrInvalidToken when the token is invalid or expired.
 func (s *AuthService) VerifyPendingOAuthToken(tokenStr string) (email, username string, err error) {
+	claims, err := s.parsePendingOAuthClaims(tokenStr)
+	if err != nil {
+		return "", "", err
+	}
+	return claims.Email, claims.Username, nil
+}
+
+// VerifyPendingDirectoryToken 校验目录登录签发的 pending token；LinuxDo/OIDC 的 token 没有 provider，会被拒绝
+func (s *AuthService) VerifyPendingDirectoryToken(tokenStr string) (*DirectoryIdentity, error) {
+	claims, err := s.parsePendingOAuthClaims(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Provider != DirectoryProviderLDAP && claims.Provider != DirectoryProviderSAML {
+		return nil, ErrInvalidToken
+	}
+	if strings.TrimSpace(claims.Subject) == "" {
+		return nil, ErrInvalidToken
+	}
+	return &DirectoryIdentity{
+		Provider: claims.Provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Username: claims.Username,
+		Groups:   claims.Groups,
+	}, nil
+}
+
+func (s *AuthService) parsePendingOAuthClaims(tokenStr string) (*pendingOAuthClaims, error) {
 	if len(tokenStr) > maxTokenLength {
-		return "", "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
 	token, parseErr := parser.ParseWithClaims(tokenStr, &pendingOAuthClaims{}, func(t *jwt.Token) (any, error) {
@@ -723,16 +822,16 @@ func (s *AuthService) VerifyPendingOAuthToken(tokenStr string) (email, username
 		return []byte(s.cfg.JWT.Secret), nil
 	})
 	if parseErr != nil {
-		return "", "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 	claims, ok := token.Claims.(*pendingOAuthClaims)
 	if !ok || !token.Valid {
-		return "", "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 	if claims.Purpose != pendingOAuthPurpose {
-		return "", "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
-	return claims.Email, claims.Username, nil
+	return claims, nil
 }
 
 func (s *AuthService) assignDefaultSubscriptions(ctx context.Context, userID int64) {
@@ -834,12 +933,18 @@ func randomHexString(byteLength int) (string, error) {
 func isReservedEmail(email string) bool {
 	normalized := strings.ToLower(strings.TrimSpace(email))
 	return strings.HasSuffix(normalized, LinuxDoConnectSyntheticEmailDomain) ||
-		strings.HasSuffix(normalized, OIDCConnectSyntheticEmailDomain)
+		strings.HasSuffix(normalized, OIDCConnectSyntheticEmailDomain) ||
+		strings.HasSuffix(normalized, DirectorySSOSyntheticEmailDomain)
 }
 
 // GenerateToken 生成JWT access token
 // 使用新的access_token_expire_minutes配置项（如果配置了），否则回退到expire_hour
 func (s *AuthService) GenerateToken(user *User) (string, error) {
+	return s.generateAccessToken(user, time.Now().Unix())
+}
+
+// generateAccessToken 签发 access token；authTime 为登录完成时间，刷新时沿用原值
+func (s *AuthService) generateAccessToken(user *User, authTime int64) (string, error) {
 	now := time.Now()
 	var expiresAt time.Time
 	if s.cfg.JWT.AccessTokenExpireMinutes > 0 {
@@ -854,6 +959,7 @@ func (s *AuthService) GenerateToken(user *User) (string, error) {
 		Email:        user.Email,
 		Role:         user.Role,
 		TokenVersion: user.TokenVersion,
+		AuthTime:     authTime,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -924,7 +1030,7 @@ func (s *AuthService) RefreshToken(ctx context.Context, oldTokenString string) (
 	}
 
 	// 生成新token
-	return s.GenerateToken(user)
+	return s.generateAccessToken(user, claims.AuthTime)
 }
 
 // IsPasswordResetEnabled 检查是否启用密码重置功能
@@ -1097,19 +1203,24 @@ type TokenPairWithUser struct {
 // GenerateTokenPair 生成Access Token和Refresh Token对
 // familyID: 可选的Token家族ID，用于Token轮转时保持家族关系
 func (s *AuthService) GenerateTokenPair(ctx context.Context, user *User, familyID string) (*TokenPair, error) {
+	return s.generateTokenPair(ctx, user, familyID, time.Now().Unix())
+}
+
+// generateTokenPair 签发 token 对；authTime 为登录完成时间，Token 轮转时沿用原值
+func (s *AuthService) generateTokenPair(ctx context.Context, user *User, familyID string, authTime int64) (*TokenPair, error) {
 	// 检查 refreshTokenCache 是否可用
 	if s.refreshTokenCache == nil {
 		return nil, errors.New("refresh token cache not configured")
 	}
 
 	// 生成Access Token
-	accessToken, err := s.GenerateToken(user)
+	accessToken, err := s.generateAccessToken(user, authTime)
 	if err != nil {
 		return nil, fmt.Errorf("generate access token: %w", err)
 	}
 
 	// 生成Refresh Token
-	refreshToken, err := s.generateRefreshToken(ctx, user, familyID)
+	refreshToken, err := s.generateRefreshToken(ctx, user, familyID, authTime)
 	if err != nil {
 		return nil, fmt.Errorf("generate refresh token: %w", err)
 	}
@@ -1122,7 +1233,7 @@ func (s *AuthService) GenerateTokenPair(ctx context.Context, user *User, familyI
 }
 
 // generateRefreshToken 生成并存储Refresh Token
-func (s *AuthService) generateRefreshToken(ctx context.Context, user *User, familyID string) (string, error) {
+func (s *AuthService) generateRefreshToken(ctx context.Context, user *User, familyID string, authTime int64) (string, error) {
 	// 生成随机Token
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -1149,6 +1260,7 @@ func (s *AuthService) generateRefreshToken(ctx context.Context, user *User, fami
 		UserID:       user.ID,
 		TokenVersion: user.TokenVersion,
 		FamilyID:     familyID,
+		AuthTime:     authTime,
 		CreatedAt:    now,
 		ExpiresAt:    now.Add(ttl),
 	}
@@ -1239,8 +1351,8 @@ func (s *AuthService) RefreshTokenPair(ctx context.Context, refreshToken string)
 		// 继续处理，不影响主流程
 	}
 
-	// 生成新的Token对，保持同一个家族ID
-	pair, err := s.GenerateTokenPair(ctx, user, data.FamilyID)
+	// 生成新的Token对，保持同一个家族ID与登录时间
+	pair, err := s.generateTokenPair(ctx, user, data.FamilyID, data.AuthTime)
 	if err != nil {
 		return nil, err
 	}
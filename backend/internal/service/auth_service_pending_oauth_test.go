@@ -144,3 +144,53 @@ func TestVerifyPendingOAuthToken_TooLong(t *testing.T) {
 	_, _, err := svc.VerifyPendingOAuthToken(string(giant))
 	require.ErrorIs(t, err, ErrInvalidToken)
 }
+
+// TestVerifyPendingDirectoryToken_CarriesGroups 目录登录的 pending token 携带来源、目录主体与组成员，OIDC token 不能冒充。
+func TestVerifyPendingDirectoryToken_CarriesGroups(t *testing.T) {
+	svc := newAuthServiceForPendingOAuthTest()
+
+	token, err := svc.CreatePendingDirectoryToken(&DirectoryIdentity{
+		Provider: DirectoryProviderLDAP,
+		Subject:  "CN=Alice,OU=Staff,DC=corp,DC=example",
+		Email:    "alice@corp.example",
+		Username: "Alice",
+		Groups:   []string{"ai-users"},
+	})
+	require.NoError(t, err)
+
+	identity, err := svc.VerifyPendingDirectoryToken(token)
+	require.NoError(t, err)
+	require.Equal(t, DirectoryProviderLDAP, identity.Provider)
+	require.Equal(t, "CN=Alice,OU=Staff,DC=corp,DC=example", identity.Subject)
+	require.Equal(t, "alice@corp.example", identity.Email)
+	require.Equal(t, []string{"ai-users"}, identity.Groups)
+
+	// 目录 token 仍可走旧接口解析
+	email, _, err := svc.VerifyPendingOAuthToken(token)
+	require.NoError(t, err)
+	require.Equal(t, "alice@corp.example", email)
+
+	oidcToken, err := svc.CreatePendingOAuthToken("user@example.com", "bob")
+	require.NoError(t, err)
+	_, err = svc.VerifyPendingDirectoryToken(oidcToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+// TestGenerateAccessToken_PreservesAuthTime 刷新签发的 access token 应沿用原登录时间。
+func TestGenerateAccessToken_PreservesAuthTime(t *testing.T) {
+	svc := newAuthServiceForPendingOAuthTest()
+	user := &User{ID: 7, Email: "user@example.com", Role: RoleUser}
+
+	token, err := svc.GenerateToken(user)
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(token)
+	require.NoError(t, err)
+	require.InDelta(t, time.Now().Unix(), claims.AuthTime, 5)
+
+	loginAt := time.Now().Add(-2 * time.Hour).Unix()
+	token, err = svc.generateAccessToken(user, loginAt)
+	require.NoError(t, err)
+	claims, err = svc.ValidateToken(token)
+	require.NoError(t, err)
+	require.Equal(t, loginAt, claims.AuthTime)
+}
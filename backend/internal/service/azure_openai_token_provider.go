@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/azureopenai"
+)
+
+const (
+	azureTokenCacheSkew   = 5 * time.Minute
+	azureTokenLockTTL     = 30 * time.Second
+	azureTokenLockWait    = 200 * time.Millisecond
+	azureTokenLockRetries = 10
+)
+
+// AzureOpenAITokenClient exchanges Entra ID application credentials for an access token.
+type AzureOpenAITokenClient interface {
+	ClientCredentials(ctx context.Context, tenantID, clientID, clientSecret, proxyURL string) (*azureopenai.TokenResponse, error)
+}
+
+// AzureOpenAITokenProvider manages access_token for Azure OpenAI accounts using Entra ID auth.
+// Like Vertex, tokens are minted on demand and only kept in the shared token cache.
+type AzureOpenAITokenProvider struct {
+	tokenClient AzureOpenAITokenClient
+	tokenCache  GeminiTokenCache
+}
+
+func NewAzureOpenAITokenProvider(tokenClient AzureOpenAITokenClient, tokenCache GeminiTokenCache) *AzureOpenAITokenProvider {
+	return &AzureOpenAITokenProvider{
+		tokenClient: tokenClient,
+		tokenCache:  tokenCache,
+	}
+}
+
+func (p *AzureOpenAITokenProvider) GetAccessToken(ctx context.Context, account *Account) (string, error) {
+	if account == nil {
+		return "", errors.New("account is nil")
+	}
+	if !account.IsAzureEntraAuth() {
+		return "", errors.New("not an azure entra account")
+	}
+
+	cacheKey := AzureOpenAITokenCacheKey(account)
+
+	// 1) Try cache first.
+	if token := p.cachedToken(ctx, cacheKey); token != "" {
+		return token, nil
+	}
+
+	// 2) 分布式锁避免多实例同时换取 token；未抢到锁时短暂等待持锁方写入缓存
+	if p.tokenCache != nil {
+		locked, lockErr := p.tokenCache.AcquireRefreshLock(ctx, cacheKey, azureTokenLockTTL)
+		switch {
+		case lockErr != nil:
+			slog.Warn("azure_token_lock_failed", "account_id", account.ID, "error", lockErr)
+		case locked:
+			defer func() { _ = p.tokenCache.ReleaseRefreshLock(ctx, cacheKey) }()
+		default:
+			for i := 0; i < azureTokenLockRetries; i++ {
+				if err := sleepWithContext(ctx, azureTokenLockWait); err != nil {
+					return "", err
+				}
+				if token := p.cachedToken(ctx, cacheKey); token != "" {
+					return token, nil
+				}
+			}
+			slog.Debug("azure_token_lock_held_exchange_anyway", "account_id", account.ID)
+		}
+	}
+
+	// 3) Client-credentials exchange.
+	tenantID := strings.TrimSpace(account.GetCredential("azure_tenant_id"))
+	clientID := strings.TrimSpace(account.GetCredential("azure_client_id"))
+	clientSecret := strings.TrimSpace(account.GetCredential("azure_client_secret"))
+	if tenantID == "" || clientID == "" || clientSecret == "" {
+		return "", errors.New("azure_tenant_id, azure_client_id and azure_client_secret are required for entra auth")
+	}
+	if p.tokenClient == nil {
+		return "", errors.New("azure token client not configured")
+	}
+	resp, err := p.tokenClient.ClientCredentials(ctx, tenantID, clientID, clientSecret, resolveAccountProxyURL(account))
+	if err != nil {
+		return "", fmt.Errorf("azure token exchange: %w", err)
+	}
+	accessToken := strings.TrimSpace(resp.AccessToken)
+	if accessToken == "" {
+		return "", errors.New("azure token exchange returned empty access_token")
+	}
+
+	// 4) Populate cache with TTL.
+	if p.tokenCache != nil {
+		ttl := time.Duration(resp.ExpiresIn) * time.Second
+		switch {
+		case ttl > azureTokenCacheSkew:
+			ttl -= azureTokenCacheSkew
+		case ttl <= 0:
+			ttl = time.Minute
+		}
+		if err := p.tokenCache.SetAccessToken(ctx, cacheKey, accessToken, ttl); err != nil {
+			slog.Warn("azure_token_cache_set_failed", "account_id", account.ID, "error", err)
+		}
+	}
+	return accessToken, nil
+}
+
+func (p *AzureOpenAITokenProvider) cachedToken(ctx context.Context, cacheKey string) string {
+	if p.tokenCache == nil {
+		return ""
+	}
+	token, err := p.tokenCache.GetAccessToken(ctx, cacheKey)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// AzureOpenAITokenCacheKey 缓存键包含应用凭据的摘要，轮换 client_secret 后自动使用新的缓存项。
+func AzureOpenAITokenCacheKey(account *Account) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(account.GetCredential("azure_tenant_id")) + "\n" +
+		strings.TrimSpace(account.GetCredential("azure_client_id")) + "\n" +
+		strings.TrimSpace(account.GetCredential("azure_client_secret"))))
+	return "azure:account:" + strconv.FormatInt(account.ID, 10) + ":" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,86 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/azureopenai"
+	"github.com/stretchr/testify/require"
+)
+
+type azureTokenClientStub struct {
+	calls    int
+	tenantID string
+	clientID string
+	resp     *azureopenai.TokenResponse
+	err      error
+}
+
+func (s *azureTokenClientStub) ClientCredentials(ctx context.Context, tenantID, clientID, clientSecret, proxyURL string) (*azureopenai.TokenResponse, error) {
+	s.calls++
+	s.tenantID = tenantID
+	s.clientID = clientID
+	return s.resp, s.err
+}
+
+func newAzureEntraTestAccount() *Account {
+	return &Account{
+		ID:       9,
+		Platform: PlatformOpenAI,
+		Type:     AccountTypeAzure,
+		Credentials: map[string]any{
+			"azure_endpoint":      "https://res.openai.azure.com",
+			"auth_mode":           "entra",
+			"azure_tenant_id":     "tenant-1",
+			"azure_client_id":     "client-1",
+			"azure_client_secret": "secret-1",
+		},
+	}
+}
+
+func TestAzureOpenAITokenProvider_ExchangesAndCaches(t *testing.T) {
+	cache := newVertexTokenCacheStub()
+	client := &azureTokenClientStub{resp: &azureopenai.TokenResponse{AccessToken: "entra-token", ExpiresIn: 3600}}
+	provider := NewAzureOpenAITokenProvider(client, cache)
+	account := newAzureEntraTestAccount()
+
+	token, err := provider.GetAccessToken(context.Background(), account)
+	require.NoError(t, err)
+	require.Equal(t, "entra-token", token)
+	require.Equal(t, "tenant-1", client.tenantID)
+	require.Equal(t, "client-1", client.clientID)
+
+	cacheKey := AzureOpenAITokenCacheKey(account)
+	require.Equal(t, 55*time.Minute, cache.ttls[cacheKey])
+
+	token, err = provider.GetAccessToken(context.Background(), account)
+	require.NoError(t, err)
+	require.Equal(t, "entra-token", token)
+	require.Equal(t, 1, client.calls)
+}
+
+func TestAzureOpenAITokenProvider_Errors(t *testing.T) {
+	provider := NewAzureOpenAITokenProvider(&azureTokenClientStub{err: errors.New("boom")}, nil)
+
+	_, err := provider.GetAccessToken(context.Background(), &Account{Platform: PlatformOpenAI, Type: AccountTypeAzure})
+	require.ErrorContains(t, err, "not an azure entra account")
+
+	account := newAzureEntraTestAccount()
+	delete(account.Credentials, "azure_client_secret")
+	_, err = provider.GetAccessToken(context.Background(), account)
+	require.ErrorContains(t, err, "required for entra auth")
+
+	_, err = provider.GetAccessToken(context.Background(), newAzureEntraTestAccount())
+	require.ErrorContains(t, err, "boom")
+}
+
+func TestAzureOpenAITokenCacheKey_ChangesWithSecret(t *testing.T) {
+	a := newAzureEntraTestAccount()
+	b := newAzureEntraTestAccount()
+	b.Credentials["azure_client_secret"] = "rotated"
+	require.NotEqual(t, AzureOpenAITokenCacheKey(a), AzureOpenAITokenCacheKey(b))
+}
@@ -89,6 +89,7 @@ type BillingCacheService struct {
 	apiKeyRateLimitLoader apiKeyRateLimitLoader
 	cfg                   *config.Config
 	circuitBreaker        *billingCircuitBreaker
+	budgetEnforcer        BudgetEnforcer
 
 	cacheWriteChan     chan cacheWriteTask
 	cacheWriteWg       sync.WaitGroup
@@ -103,6 +104,12 @@ type BillingCacheService struct {
 	cacheWriteDropClosedLastLog int64
 }
 
+// BudgetEnforcer 用户自定义消费预算检查（BudgetService）
+type BudgetEnforcer interface {
+	CheckBudgets(ctx context.Context, userID, apiKeyID int64) error
+	RecordSpend(userID, apiKeyID int64, cost float64)
+}
+
 // NewBillingCacheService 创建计费缓存服务
 func NewBillingCacheService(cache BillingCache, userRepo UserRepository, subRepo UserSubscriptionRepository, apiKeyRepo APIKeyRepository, cfg *config.Config) *BillingCacheService {
 	svc := &BillingCacheService{
@@ -664,9 +671,29 @@ func (s *BillingCacheService) CheckBillingEligibility(ctx context.Context, user
 		}
 	}
 
+	// Check user-configured hard budgets
+	if s.budgetEnforcer != nil && user != nil && apiKey != nil {
+		if err := s.budgetEnforcer.CheckBudgets(ctx, user.ID, apiKey.ID); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// SetBudgetEnforcer 注入用户消费预算检查（可选）
+func (s *BillingCacheService) SetBudgetEnforcer(enforcer BudgetEnforcer) {
+	s.budgetEnforcer = enforcer
+}
+
+// RecordBudgetSpend 计费完成后累加预算周期消费（异步，不阻塞请求）
+func (s *BillingCacheService) RecordBudgetSpend(userID, apiKeyID int64, cost float64) {
+	if s == nil || s.budgetEnforcer == nil || cost <= 0 {
+		return
+	}
+	s.budgetEnforcer.RecordSpend(userID, apiKeyID, cost)
+}
+
 // checkBalanceEligibility 检查余额模式资格
 func (s *BillingCacheService) checkBalanceEligibility(ctx context.Context, userID int64) error {
 	balance, err := s.GetUserBalance(ctx, userID)
@@ -57,6 +57,9 @@ type ModelPricing struct {
 	LongContextInputMultiplier     float64 // 长上下文整次会话输入倍率
 	LongContextOutputMultiplier    float64 // 长上下文整次会话输出倍率
 	ImageOutputPricePerToken       float64 // 图片输出 token 价格 (USD)
+	AudioInputPricePerToken        float64 // 音频输入 token 价格 (USD)，为 0 时按文本输入价格
+	AudioOutputPricePerToken       float64 // 音频输出 token 价格 (USD)，为 0 时按文本输出价格
+	AudioCacheReadPricePerToken    float64 // 音频缓存读取 token 价格 (USD)，为 0 时按文本缓存读取价格
 }
 
 const (
@@ -96,6 +99,10 @@ type UsageTokens struct {
 	CacheCreation5mTokens int
 	CacheCreation1hTokens int
 	ImageOutputTokens     int
+	// 音频 token（Realtime），分别是 InputTokens / OutputTokens / CacheReadTokens 的子集
+	AudioInputTokens     int
+	AudioOutputTokens    int
+	AudioCacheReadTokens int
 }
 
 // CostBreakdown 费用明细
@@ -362,6 +369,9 @@ func (s *BillingService) GetModelPricing(model string) (*ModelPricing, error) {
 				LongContextInputMultiplier:     litellmPricing.LongContextInputCostMultiplier,
 				LongContextOutputMultiplier:    litellmPricing.LongContextOutputCostMultiplier,
 				ImageOutputPricePerToken:       litellmPricing.OutputCostPerImageToken,
+				AudioInputPricePerToken:        litellmPricing.InputCostPerAudioToken,
+				AudioOutputPricePerToken:       litellmPricing.OutputCostPerAudioToken,
+				AudioCacheReadPricePerToken:    litellmPricing.CacheReadInputAudioTokenCost,
 			}), nil
 		}
 	}
@@ -516,14 +526,19 @@ func (s *BillingService) computeTokenBreakdown(
 	}
 
 	bd := &CostBreakdown{}
-	bd.InputCost = float64(tokens.InputTokens) * inputPrice
+	// 音频 token 按独立费率计入输入/输出/缓存读取费用
+	textInputTokens, audioInputTokens := splitAudioTokens(tokens.InputTokens, tokens.AudioInputTokens)
+	bd.InputCost = float64(textInputTokens)*inputPrice +
+		float64(audioInputTokens)*priceOrFallback(pricing.AudioInputPricePerToken, inputPrice)
 
 	// 分离图片输出 token 与文本输出 token
 	textOutputTokens := tokens.OutputTokens - tokens.ImageOutputTokens
 	if textOutputTokens < 0 {
 		textOutputTokens = 0
 	}
-	bd.OutputCost = float64(textOutputTokens) * outputPrice
+	textOutputTokens, audioOutputTokens := splitAudioTokens(textOutputTokens, tokens.AudioOutputTokens)
+	bd.OutputCost = float64(textOutputTokens)*outputPrice +
+		float64(audioOutputTokens)*priceOrFallback(pricing.AudioOutputPricePerToken, outputPrice)
 
 	// 图片输出 token 费用（独立费率）
 	if tokens.ImageOutputTokens > 0 {
@@ -537,7 +552,9 @@ func (s *BillingService) computeTokenBreakdown(
 	// 缓存创建费用
 	bd.CacheCreationCost = s.computeCacheCreationCost(pricing, tokens)
 
-	bd.CacheReadCost = float64(tokens.CacheReadTokens) * cacheReadPrice
+	textCacheReadTokens, audioCacheReadTokens := splitAudioTokens(tokens.CacheReadTokens, tokens.AudioCacheReadTokens)
+	bd.CacheReadCost = float64(textCacheReadTokens)*cacheReadPrice +
+		float64(audioCacheReadTokens)*priceOrFallback(pricing.AudioCacheReadPricePerToken, cacheReadPrice)
 
 	if tierMultiplier != 1.0 {
 		bd.InputCost *= tierMultiplier
@@ -554,6 +571,24 @@ func (s *BillingService) computeTokenBreakdown(
 	return bd
 }
 
+// splitAudioTokens 从总 token 中拆出音频部分，返回 (文本, 音频)。
+func splitAudioTokens(total, audio int) (int, int) {
+	if audio <= 0 {
+		return total, 0
+	}
+	if audio > total {
+		audio = total
+	}
+	return total - audio, audio
+}
+
+func priceOrFallback(price, fallback float64) float64 {
+	if price > 0 {
+		return price
+	}
+	return fallback
+}
+
 // computeCacheCreationCost 计算缓存创建费用（支持 5m/1h 分类或标准计费）。
 func (s *BillingService) computeCacheCreationCost(pricing *ModelPricing, tokens UsageTokens) float64 {
 	if pricing.SupportsCacheBreakdown && (pricing.CacheCreation5mPrice > 0 || pricing.CacheCreation1hPrice > 0) {
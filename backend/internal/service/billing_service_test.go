@@ -838,3 +838,52 @@ func TestGetModelPricingWithChannel_UnknownModelReturnsError(t *testing.T) {
 	require.Nil(t, pricing)
 	require.Contains(t, err.Error(), "pricing not found")
 }
+
+func TestCalculateCost_AudioTokensUseAudioPricing(t *testing.T) {
+	pricingSvc := &PricingService{
+		pricingData: map[string]*LiteLLMModelPricing{
+			"gpt-realtime": {
+				InputCostPerToken:            4e-6,
+				OutputCostPerToken:           16e-6,
+				CacheReadInputTokenCost:      0.4e-6,
+				InputCostPerAudioToken:       32e-6,
+				OutputCostPerAudioToken:      64e-6,
+				CacheReadInputAudioTokenCost: 0.4e-6,
+			},
+		},
+	}
+	svc := NewBillingService(&config.Config{}, pricingSvc)
+
+	// 输入 56（其中音频 36），缓存命中 64（全部为音频），输出 60（其中音频 48）
+	cost, err := svc.CalculateCost("gpt-realtime", UsageTokens{
+		InputTokens:          56,
+		OutputTokens:         60,
+		CacheReadTokens:      64,
+		AudioInputTokens:     36,
+		AudioOutputTokens:    48,
+		AudioCacheReadTokens: 64,
+	}, 1.0)
+	require.NoError(t, err)
+
+	require.InDelta(t, 20*4e-6+36*32e-6, cost.InputCost, 1e-12)
+	require.InDelta(t, 12*16e-6+48*64e-6, cost.OutputCost, 1e-12)
+	require.InDelta(t, 64*0.4e-6, cost.CacheReadCost, 1e-12)
+	require.InDelta(t, cost.InputCost+cost.OutputCost+cost.CacheReadCost, cost.TotalCost, 1e-12)
+}
+
+func TestCalculateCost_AudioTokensFallBackToTextPricing(t *testing.T) {
+	svc := newTestBillingService()
+
+	tokens := UsageTokens{InputTokens: 1000, OutputTokens: 500}
+	textCost, err := svc.CalculateCost("gpt-5.1", tokens, 1.0)
+	require.NoError(t, err)
+
+	// 未配置音频价格时，音频 token 按文本价格计费，总价不变
+	tokens.AudioInputTokens = 400
+	tokens.AudioOutputTokens = 800 // 超出总输出时按总输出截断
+	audioCost, err := svc.CalculateCost("gpt-5.1", tokens, 1.0)
+	require.NoError(t, err)
+	require.InDelta(t, textCost.InputCost, audioCost.InputCost, 1e-12)
+	require.InDelta(t, textCost.OutputCost, audioCost.OutputCost, 1e-12)
+	require.InDelta(t, textCost.TotalCost, audioCost.TotalCost, 1e-12)
+}
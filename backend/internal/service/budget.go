@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/timezone"
+)
+
+// 预算周期
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// 预算模式：soft 仅通知，hard 超限后拒绝请求
+const (
+	BudgetModeSoft = "soft"
+	BudgetModeHard = "hard"
+)
+
+// 预算告警级别（按周期去重，只升不降）
+const (
+	BudgetAlertLevelNone      = 0
+	BudgetAlertLevelThreshold = 1
+	BudgetAlertLevelExceeded  = 2
+)
+
+// Webhook 事件类型
+const (
+	BudgetEventThreshold = "budget.threshold"
+	BudgetEventExceeded  = "budget.exceeded"
+	BudgetEventSpike     = "budget.spike"
+)
+
+const (
+	defaultBudgetAlertPercent = 80
+	maxBudgetsPerUser         = 20
+)
+
+var (
+	ErrBudgetNotFound      = infraerrors.NotFound("BUDGET_NOT_FOUND", "budget not found")
+	ErrBudgetExceeded      = infraerrors.TooManyRequests("BUDGET_EXCEEDED", "spending budget exceeded")
+	ErrBudgetLimitReached  = infraerrors.BadRequest("BUDGET_LIMIT_REACHED", "too many budgets")
+	ErrBudgetDuplicate     = infraerrors.Conflict("BUDGET_DUPLICATE", "a budget for this period and scope already exists")
+	ErrBudgetInvalidPeriod = infraerrors.BadRequest("BUDGET_INVALID_PERIOD", "period must be daily, weekly or monthly")
+	ErrBudgetInvalidMode   = infraerrors.BadRequest("BUDGET_INVALID_MODE", "mode must be soft or hard")
+	ErrBudgetInvalidLimit  = infraerrors.BadRequest("BUDGET_INVALID_LIMIT", "limit_usd must be greater than 0")
+	ErrBudgetInvalidAlert  = infraerrors.BadRequest("BUDGET_INVALID_ALERT_PERCENT", "alert_percent must be between 1 and 100")
+	ErrBudgetAPIKeyInvalid = infraerrors.BadRequest("BUDGET_API_KEY_INVALID", "api key not found")
+	ErrBudgetWebhookURL    = infraerrors.BadRequest("BUDGET_WEBHOOK_URL_INVALID", "webhook_url must be a public https URL")
+)
+
+// UsageBudget 用户级（APIKeyID 为空）或 API Key 级消费预算
+type UsageBudget struct {
+	ID                   int64      `json:"id"`
+	UserID               int64      `json:"user_id"`
+	APIKeyID             *int64     `json:"api_key_id"`
+	Period               string     `json:"period"`
+	LimitUSD             float64    `json:"limit_usd"`
+	Mode                 string     `json:"mode"`
+	AlertPercent         int        `json:"alert_percent"`
+	Enabled              bool       `json:"enabled"`
+	LastAlertPeriodStart *time.Time `json:"-"`
+	LastAlertLevel       int        `json:"-"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// AppliesTo 判断预算是否作用于指定 API Key 的请求
+func (b *UsageBudget) AppliesTo(apiKeyID int64) bool {
+	return b.APIKeyID == nil || *b.APIKeyID == apiKeyID
+}
+
+// ScopeKeyID 返回预算作用的 API Key ID，用户级预算返回 0
+func (b *UsageBudget) ScopeKeyID() int64 {
+	if b.APIKeyID == nil {
+		return 0
+	}
+	return *b.APIKeyID
+}
+
+// UsageBudgetStatus 预算及其当前周期消费
+type UsageBudgetStatus struct {
+	*UsageBudget
+	SpentUSD    float64   `json:"spent_usd"`
+	Percent     float64   `json:"percent"`
+	PeriodStart time.Time `json:"period_start"`
+	ResetsAt    time.Time `json:"resets_at"`
+	Blocked     bool      `json:"blocked"`
+}
+
+// BudgetSettings 用户级预算通知设置
+type BudgetSettings struct {
+	UserID         int64   `json:"user_id"`
+	EmailEnabled   bool    `json:"email_enabled"`
+	WebhookURL     string  `json:"webhook_url"`
+	WebhookSecret  string  `json:"webhook_secret,omitempty"`
+	SpikeHourlyUSD float64 `json:"spike_hourly_usd"` // 单个自然小时内消费达到该值时告警，0 表示关闭
+}
+
+// BudgetRepository 预算数据访问接口
+type BudgetRepository interface {
+	ListByUser(ctx context.Context, userID int64) ([]*UsageBudget, error)
+	GetByID(ctx context.Context, id int64) (*UsageBudget, error)
+	Create(ctx context.Context, budget *UsageBudget) error
+	Update(ctx context.Context, budget *UsageBudget) error
+	Delete(ctx context.Context, userID, id int64) error
+	// MarkAlerted 条件更新告警状态：仅当周期变化或级别提升时更新并返回 true（多实例下保证只通知一次）
+	MarkAlerted(ctx context.Context, id int64, periodStart time.Time, level int) (bool, error)
+
+	GetSettings(ctx context.Context, userID int64) (*BudgetSettings, error)
+	UpsertSettings(ctx context.Context, settings *BudgetSettings) error
+	// MarkSpikeAlerted 条件更新突增告警时间：同一小时内只返回一次 true
+	MarkSpikeAlerted(ctx context.Context, userID int64, bucketStart time.Time) (bool, error)
+
+	// SumSpend 汇总 usage_logs.actual_cost；apiKeyID 为 0 时统计用户全部 Key
+	SumSpend(ctx context.Context, userID, apiKeyID int64, since time.Time) (float64, error)
+}
+
+// BudgetSpendCache 预算周期消费缓存（Redis），缺失时从 usage_logs 聚合回填
+type BudgetSpendCache interface {
+	GetSpend(ctx context.Context, key string) (float64, bool, error)
+	SetSpend(ctx context.Context, key string, spend float64, ttl time.Duration) error
+	// IncrSpend 仅在 key 存在时累加，返回累加后的值与是否命中
+	IncrSpend(ctx context.Context, key string, delta float64) (float64, bool, error)
+}
+
+// budgetPeriodBounds 返回预算周期的起止时间（按系统时区）
+func budgetPeriodBounds(period string, now time.Time) (time.Time, time.Time) {
+	switch period {
+	case BudgetPeriodWeekly:
+		start := timezone.StartOfWeek(now)
+		return start, start.AddDate(0, 0, 7)
+	case BudgetPeriodMonthly:
+		start := timezone.StartOfMonth(now)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start := timezone.StartOfDay(now)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+func isValidBudgetPeriod(period string) bool {
+	return period == BudgetPeriodDaily || period == BudgetPeriodWeekly || period == BudgetPeriodMonthly
+}
+
+func isValidBudgetMode(mode string) bool {
+	return mode == BudgetModeSoft || mode == BudgetModeHard
+}
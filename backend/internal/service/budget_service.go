@@ -0,0 +1,830 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/httpclient"
+	"github.com/Wei-Shaw/sub2api/internal/util/urlvalidator"
+)
+
+const (
+	// 预算列表本地缓存时间：热路径每个请求都要读取预算配置
+	budgetLocalCacheTTL = 30 * time.Second
+	budgetLocalCacheMax = 10000
+	// 周期消费缓存时间：过期后重新从 usage_logs 聚合，修正异步累加可能产生的偏差
+	budgetSpendCacheTTL  = 5 * time.Minute
+	budgetRecordTimeout  = 5 * time.Second
+	budgetWebhookTimeout = 10 * time.Second
+	budgetSpikePeriod    = "hourly"
+	// 消费累加工作池：固定 worker + 有界队列，队列满时丢弃（周期消费缓存过期后会从 usage_logs 重新聚合）
+	budgetRecordWorkerCount     = 4
+	budgetRecordBufferSize      = 1000
+	budgetRecordDropLogInterval = 5 * time.Second
+)
+
+// budgetSpendTask 一次计费后的预算累加任务
+type budgetSpendTask struct {
+	userID   int64
+	apiKeyID int64
+	cost     float64
+}
+
+// BudgetEmailQueue 预算告警邮件投递（EmailQueueService）
+type BudgetEmailQueue interface {
+	EnqueueNotification(email, subject, body string) error
+}
+
+type budgetUserReader interface {
+	GetByID(ctx context.Context, id int64) (*User, error)
+}
+
+type budgetAPIKeyOwnership interface {
+	VerifyOwnership(ctx context.Context, userID int64, apiKeyIDs []int64) ([]int64, error)
+}
+
+// CreateBudgetInput 创建预算请求
+type CreateBudgetInput struct {
+	APIKeyID     *int64  `json:"api_key_id"`
+	Period       string  `json:"period"`
+	LimitUSD     float64 `json:"limit_usd"`
+	Mode         string  `json:"mode"`
+	AlertPercent *int    `json:"alert_percent"`
+	Enabled      *bool   `json:"enabled"`
+}
+
+// UpdateBudgetInput 更新预算请求（部分更新；周期与作用范围不可修改）
+type UpdateBudgetInput struct {
+	LimitUSD     *float64 `json:"limit_usd"`
+	Mode         *string  `json:"mode"`
+	AlertPercent *int     `json:"alert_percent"`
+	Enabled      *bool    `json:"enabled"`
+}
+
+// UpdateBudgetSettingsInput 更新预算通知设置（部分更新）
+type UpdateBudgetSettingsInput struct {
+	EmailEnabled   *bool    `json:"email_enabled"`
+	WebhookURL     *string  `json:"webhook_url"`
+	WebhookSecret  *string  `json:"webhook_secret"`
+	SpikeHourlyUSD *float64 `json:"spike_hourly_usd"`
+}
+
+// BudgetSettingsView 返回给用户的通知设置（不回显 webhook secret）
+type BudgetSettingsView struct {
+	EmailEnabled     bool    `json:"email_enabled"`
+	WebhookURL       string  `json:"webhook_url"`
+	WebhookSecretSet bool    `json:"webhook_secret_set"`
+	SpikeHourlyUSD   float64 `json:"spike_hourly_usd"`
+}
+
+// BudgetWebhookPayload 预算告警 webhook 请求体
+type BudgetWebhookPayload struct {
+	Event       string    `json:"event"`
+	UserID      int64     `json:"user_id"`
+	BudgetID    int64     `json:"budget_id,omitempty"`
+	APIKeyID    *int64    `json:"api_key_id,omitempty"`
+	Period      string    `json:"period"`
+	Mode        string    `json:"mode,omitempty"`
+	LimitUSD    float64   `json:"limit_usd"`
+	SpentUSD    float64   `json:"spent_usd"`
+	Percent     float64   `json:"percent"`
+	PeriodStart time.Time `json:"period_start"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+type budgetLocalEntry struct {
+	budgets   []*UsageBudget
+	settings  *BudgetSettings
+	expiresAt time.Time
+}
+
+// BudgetService 用户自助消费预算：日/周/月限额，soft 仅通知，hard 超限拒绝请求。
+// 周期消费取自 usage_logs 聚合并缓存在 Redis 中，每次计费后异步累加。
+type BudgetService struct {
+	repo        BudgetRepository
+	cache       BudgetSpendCache
+	userRepo    budgetUserReader
+	apiKeyRepo  budgetAPIKeyOwnership
+	emailQueue  BudgetEmailQueue
+	settingRepo SettingRepository
+	httpClient  *http.Client
+	now         func() time.Time
+
+	localMu sync.Mutex
+	local   map[int64]*budgetLocalEntry
+	// alertMu 保护本地缓存预算上的 LastAlert* 快照（多个 worker 共享同一 *UsageBudget）
+	alertMu sync.Mutex
+
+	recordChan        chan budgetSpendTask
+	recordWg          sync.WaitGroup
+	recordStopOnce    sync.Once
+	recordMu          sync.RWMutex
+	stopped           atomic.Bool
+	recordDropCount   atomic.Uint64
+	recordDropLastLog atomic.Int64
+}
+
+// NewBudgetService 创建预算服务
+func NewBudgetService(
+	repo BudgetRepository,
+	cache BudgetSpendCache,
+	userRepo UserRepository,
+	apiKeyRepo APIKeyRepository,
+	emailQueue *EmailQueueService,
+	settingRepo SettingRepository,
+) *BudgetService {
+	var queue BudgetEmailQueue
+	if emailQueue != nil {
+		queue = emailQueue
+	}
+	client, err := httpclient.GetClient(httpclient.Options{
+		Timeout:            budgetWebhookTimeout,
+		ValidateResolvedIP: true,
+	})
+	if err != nil {
+		slog.Warn("budget: webhook http client unavailable", "error", err)
+		client = nil
+	}
+	return newBudgetService(repo, cache, userRepo, apiKeyRepo, queue, settingRepo, client)
+}
+
+func newBudgetService(
+	repo BudgetRepository,
+	cache BudgetSpendCache,
+	userRepo budgetUserReader,
+	apiKeyRepo budgetAPIKeyOwnership,
+	emailQueue BudgetEmailQueue,
+	settingRepo SettingRepository,
+	client *http.Client,
+) *BudgetService {
+	svc := &BudgetService{
+		repo:        repo,
+		cache:       cache,
+		userRepo:    userRepo,
+		apiKeyRepo:  apiKeyRepo,
+		emailQueue:  emailQueue,
+		settingRepo: settingRepo,
+		httpClient:  client,
+		now:         time.Now,
+		local:       make(map[int64]*budgetLocalEntry),
+	}
+	svc.startRecordWorkers()
+	return svc
+}
+
+// Stop 关闭消费累加工作池，等待已入队任务处理完毕
+func (s *BudgetService) Stop() {
+	s.recordStopOnce.Do(func() {
+		s.stopped.Store(true)
+
+		s.recordMu.Lock()
+		ch := s.recordChan
+		s.recordChan = nil
+		if ch != nil {
+			close(ch)
+		}
+		s.recordMu.Unlock()
+
+		s.recordWg.Wait()
+	})
+}
+
+func (s *BudgetService) startRecordWorkers() {
+	ch := make(chan budgetSpendTask, budgetRecordBufferSize)
+	s.recordChan = ch
+	for i := 0; i < budgetRecordWorkerCount; i++ {
+		s.recordWg.Add(1)
+		go s.recordWorker(ch)
+	}
+}
+
+func (s *BudgetService) recordWorker(ch <-chan budgetSpendTask) {
+	defer s.recordWg.Done()
+	for task := range ch {
+		s.runRecordTask(task)
+	}
+}
+
+func (s *BudgetService) runRecordTask(task budgetSpendTask) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic in budget RecordSpend", "recover", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), budgetRecordTimeout)
+	defer cancel()
+	s.recordSpend(ctx, task.userID, task.apiKeyID, task.cost)
+}
+
+// ============================================
+// 用户自助管理
+// ============================================
+
+// ListStatus 返回用户全部预算及当前周期消费
+func (s *BudgetService) ListStatus(ctx context.Context, userID int64) ([]UsageBudgetStatus, error) {
+	budgets, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	out := make([]UsageBudgetStatus, 0, len(budgets))
+	for _, b := range budgets {
+		start, end := budgetPeriodBounds(b.Period, now)
+		spent, err := s.currentSpend(ctx, userID, b.ScopeKeyID(), b.Period, start, end)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, UsageBudgetStatus{
+			UsageBudget: b,
+			SpentUSD:    spent,
+			Percent:     budgetPercent(spent, b.LimitUSD),
+			PeriodStart: start,
+			ResetsAt:    end,
+			Blocked:     b.Enabled && b.Mode == BudgetModeHard && spent >= b.LimitUSD,
+		})
+	}
+	return out, nil
+}
+
+// Create 创建预算
+func (s *BudgetService) Create(ctx context.Context, userID int64, input *CreateBudgetInput) (*UsageBudget, error) {
+	budget := &UsageBudget{
+		UserID:       userID,
+		Period:       strings.TrimSpace(input.Period),
+		LimitUSD:     input.LimitUSD,
+		Mode:         strings.TrimSpace(input.Mode),
+		AlertPercent: defaultBudgetAlertPercent,
+		Enabled:      true,
+	}
+	if budget.Mode == "" {
+		budget.Mode = BudgetModeSoft
+	}
+	if input.AlertPercent != nil {
+		budget.AlertPercent = *input.AlertPercent
+	}
+	if input.Enabled != nil {
+		budget.Enabled = *input.Enabled
+	}
+	if input.APIKeyID != nil && *input.APIKeyID > 0 {
+		owned, err := s.apiKeyRepo.VerifyOwnership(ctx, userID, []int64{*input.APIKeyID})
+		if err != nil {
+			return nil, err
+		}
+		if len(owned) == 0 {
+			return nil, ErrBudgetAPIKeyInvalid
+		}
+		keyID := *input.APIKeyID
+		budget.APIKeyID = &keyID
+	}
+	if err := validateBudget(budget); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxBudgetsPerUser {
+		return nil, ErrBudgetLimitReached
+	}
+	if err := s.repo.Create(ctx, budget); err != nil {
+		return nil, err
+	}
+	s.invalidateLocal(userID)
+	return budget, nil
+}
+
+// Update 更新预算
+func (s *BudgetService) Update(ctx context.Context, userID, id int64, input *UpdateBudgetInput) (*UsageBudget, error) {
+	budget, err := s.getOwned(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if input.LimitUSD != nil {
+		budget.LimitUSD = *input.LimitUSD
+	}
+	if input.Mode != nil {
+		budget.Mode = strings.TrimSpace(*input.Mode)
+	}
+	if input.AlertPercent != nil {
+		budget.AlertPercent = *input.AlertPercent
+	}
+	if input.Enabled != nil {
+		budget.Enabled = *input.Enabled
+	}
+	if err := validateBudget(budget); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, budget); err != nil {
+		return nil, err
+	}
+	s.invalidateLocal(userID)
+	return budget, nil
+}
+
+// Delete 删除预算
+func (s *BudgetService) Delete(ctx context.Context, userID, id int64) error {
+	if _, err := s.getOwned(ctx, userID, id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, userID, id); err != nil {
+		return err
+	}
+	s.invalidateLocal(userID)
+	return nil
+}
+
+// GetSettings 返回用户预算通知设置
+func (s *BudgetService) GetSettings(ctx context.Context, userID int64) (*BudgetSettingsView, error) {
+	settings, err := s.repo.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return settings.view(), nil
+}
+
+// UpdateSettings 更新用户预算通知设置
+func (s *BudgetService) UpdateSettings(ctx context.Context, userID int64, input *UpdateBudgetSettingsInput) (*BudgetSettingsView, error) {
+	settings, err := s.repo.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if input.EmailEnabled != nil {
+		settings.EmailEnabled = *input.EmailEnabled
+	}
+	if input.WebhookURL != nil {
+		raw := strings.TrimSpace(*input.WebhookURL)
+		if raw != "" {
+			normalized, err := urlvalidator.ValidateHTTPURL(raw, false, urlvalidator.ValidationOptions{})
+			if err != nil {
+				return nil, ErrBudgetWebhookURL.WithCause(err)
+			}
+			raw = normalized
+		}
+		settings.WebhookURL = raw
+	}
+	if input.WebhookSecret != nil {
+		settings.WebhookSecret = strings.TrimSpace(*input.WebhookSecret)
+	}
+	if input.SpikeHourlyUSD != nil {
+		if *input.SpikeHourlyUSD < 0 || math.IsNaN(*input.SpikeHourlyUSD) {
+			return nil, infraerrors.BadRequest("BUDGET_INVALID_SPIKE", "spike_hourly_usd must be >= 0")
+		}
+		settings.SpikeHourlyUSD = *input.SpikeHourlyUSD
+	}
+	settings.UserID = userID
+	if err := s.repo.UpsertSettings(ctx, settings); err != nil {
+		return nil, err
+	}
+	s.invalidateLocal(userID)
+	return settings.view(), nil
+}
+
+func (s *BudgetService) getOwned(ctx context.Context, userID, id int64) (*UsageBudget, error) {
+	budget, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if budget == nil || budget.UserID != userID {
+		return nil, ErrBudgetNotFound
+	}
+	return budget, nil
+}
+
+func validateBudget(b *UsageBudget) error {
+	if !isValidBudgetPeriod(b.Period) {
+		return ErrBudgetInvalidPeriod
+	}
+	if !isValidBudgetMode(b.Mode) {
+		return ErrBudgetInvalidMode
+	}
+	if !(b.LimitUSD > 0) || math.IsInf(b.LimitUSD, 0) {
+		return ErrBudgetInvalidLimit
+	}
+	if b.AlertPercent < 1 || b.AlertPercent > 100 {
+		return ErrBudgetInvalidAlert
+	}
+	return nil
+}
+
+func (s *BudgetSettings) view() *BudgetSettingsView {
+	return &BudgetSettingsView{
+		EmailEnabled:     s.EmailEnabled,
+		WebhookURL:       s.WebhookURL,
+		WebhookSecretSet: s.WebhookSecret != "",
+		SpikeHourlyUSD:   s.SpikeHourlyUSD,
+	}
+}
+
+// ============================================
+// 热路径：计费资格检查与消费累加
+// ============================================
+
+// CheckBudgets 检查 hard 模式预算；任一作用于本次请求的预算已用尽则返回 ErrBudgetExceeded。
+// 读取失败时放行，避免预算存储故障影响正常请求。
+func (s *BudgetService) CheckBudgets(ctx context.Context, userID, apiKeyID int64) error {
+	entry, err := s.loadLocal(ctx, userID)
+	if err != nil || len(entry.budgets) == 0 {
+		return nil
+	}
+	now := s.now()
+	for _, b := range entry.budgets {
+		if !b.Enabled || b.Mode != BudgetModeHard || !b.AppliesTo(apiKeyID) {
+			continue
+		}
+		start, end := budgetPeriodBounds(b.Period, now)
+		spent, err := s.currentSpend(ctx, userID, b.ScopeKeyID(), b.Period, start, end)
+		if err != nil {
+			slog.Warn("budget: load spend failed", "user_id", userID, "budget_id", b.ID, "error", err)
+			continue
+		}
+		if spent >= b.LimitUSD {
+			return infraerrors.TooManyRequests(ErrBudgetExceeded.Reason,
+				fmt.Sprintf("%s budget of $%.2f exceeded (spent $%.2f), resets at %s",
+					b.Period, b.LimitUSD, spent, end.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
+
+// RecordSpend 在计费完成后异步累加周期消费，并检查告警阈值。
+func (s *BudgetService) RecordSpend(userID, apiKeyID int64, cost float64) {
+	if cost <= 0 || userID <= 0 {
+		return
+	}
+	if s.stopped.Load() {
+		return
+	}
+	s.recordMu.RLock()
+	defer s.recordMu.RUnlock()
+	if s.recordChan == nil {
+		return
+	}
+	select {
+	case s.recordChan <- budgetSpendTask{userID: userID, apiKeyID: apiKeyID, cost: cost}:
+	default:
+		// 队列满时不阻塞计费流程；周期消费缓存过期后会从 usage_logs 重新聚合
+		s.logRecordDrop(userID)
+	}
+}
+
+// logRecordDrop 节流记录队列满导致的丢弃
+func (s *BudgetService) logRecordDrop(userID int64) {
+	dropped := s.recordDropCount.Add(1)
+	now := time.Now().UnixNano()
+	last := s.recordDropLastLog.Load()
+	if now-last < int64(budgetRecordDropLogInterval) || !s.recordDropLastLog.CompareAndSwap(last, now) {
+		return
+	}
+	slog.Warn("budget: record queue full, spend update dropped", "user_id", userID, "dropped_total", dropped)
+}
+
+func (s *BudgetService) recordSpend(ctx context.Context, userID, apiKeyID int64, cost float64) {
+	entry, err := s.loadLocal(ctx, userID)
+	if err != nil {
+		return
+	}
+	now := s.now()
+	for _, b := range entry.budgets {
+		if !b.Enabled || !b.AppliesTo(apiKeyID) {
+			continue
+		}
+		start, end := budgetPeriodBounds(b.Period, now)
+		spent, err := s.addSpend(ctx, userID, b.ScopeKeyID(), b.Period, start, end, cost)
+		if err != nil {
+			slog.Warn("budget: update spend failed", "user_id", userID, "budget_id", b.ID, "error", err)
+			continue
+		}
+		s.maybeAlertBudget(ctx, entry.settings, b, spent, start)
+	}
+
+	if entry.settings != nil && entry.settings.SpikeHourlyUSD > 0 {
+		start := now.Truncate(time.Hour)
+		spent, err := s.addSpend(ctx, userID, 0, budgetSpikePeriod, start, start.Add(time.Hour), cost)
+		if err == nil && spent >= entry.settings.SpikeHourlyUSD {
+			s.maybeAlertSpike(ctx, entry.settings, spent, start)
+		}
+	}
+}
+
+func (s *BudgetService) maybeAlertBudget(ctx context.Context, settings *BudgetSettings, b *UsageBudget, spent float64, periodStart time.Time) {
+	level := BudgetAlertLevelNone
+	switch {
+	case spent >= b.LimitUSD:
+		level = BudgetAlertLevelExceeded
+	case spent >= b.LimitUSD*float64(b.AlertPercent)/100:
+		level = BudgetAlertLevelThreshold
+	}
+	if level == BudgetAlertLevelNone {
+		return
+	}
+	// 本地快照先过滤一次，避免每个请求都访问数据库
+	if s.alertedLocally(b, periodStart, level) {
+		return
+	}
+	marked, err := s.repo.MarkAlerted(ctx, b.ID, periodStart, level)
+	if err != nil {
+		slog.Warn("budget: mark alerted failed", "budget_id", b.ID, "error", err)
+		return
+	}
+	ps := periodStart
+	s.alertMu.Lock()
+	b.LastAlertPeriodStart, b.LastAlertLevel = &ps, level
+	s.alertMu.Unlock()
+	if !marked {
+		return
+	}
+
+	event := BudgetEventThreshold
+	if level == BudgetAlertLevelExceeded {
+		event = BudgetEventExceeded
+	}
+	s.notify(ctx, settings, &BudgetWebhookPayload{
+		Event:       event,
+		UserID:      b.UserID,
+		BudgetID:    b.ID,
+		APIKeyID:    b.APIKeyID,
+		Period:      b.Period,
+		Mode:        b.Mode,
+		LimitUSD:    b.LimitUSD,
+		SpentUSD:    spent,
+		Percent:     budgetPercent(spent, b.LimitUSD),
+		PeriodStart: periodStart,
+		Timestamp:   s.now(),
+	})
+}
+
+// alertedLocally 本地快照中该预算本周期是否已发送过不低于 level 的告警
+func (s *BudgetService) alertedLocally(b *UsageBudget, periodStart time.Time, level int) bool {
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+	return b.LastAlertPeriodStart != nil && b.LastAlertPeriodStart.Equal(periodStart) && b.LastAlertLevel >= level
+}
+
+func (s *BudgetService) maybeAlertSpike(ctx context.Context, settings *BudgetSettings, spent float64, bucketStart time.Time) {
+	marked, err := s.repo.MarkSpikeAlerted(ctx, settings.UserID, bucketStart)
+	if err != nil || !marked {
+		return
+	}
+	s.notify(ctx, settings, &BudgetWebhookPayload{
+		Event:       BudgetEventSpike,
+		UserID:      settings.UserID,
+		Period:      budgetSpikePeriod,
+		LimitUSD:    settings.SpikeHourlyUSD,
+		SpentUSD:    spent,
+		Percent:     budgetPercent(spent, settings.SpikeHourlyUSD),
+		PeriodStart: bucketStart,
+		Timestamp:   s.now(),
+	})
+}
+
+// currentSpend 读取周期消费：优先 Redis，缺失时从 usage_logs 聚合并回填
+func (s *BudgetService) currentSpend(ctx context.Context, userID, apiKeyID int64, period string, start, end time.Time) (float64, error) {
+	key := budgetSpendKey(userID, apiKeyID, period, start)
+	if s.cache != nil {
+		if v, ok, err := s.cache.GetSpend(ctx, key); err == nil && ok {
+			return v, nil
+		}
+	}
+	spent, err := s.repo.SumSpend(ctx, userID, apiKeyID, start)
+	if err != nil {
+		return 0, err
+	}
+	if s.cache != nil {
+		if err := s.cache.SetSpend(ctx, key, spent, budgetSpendTTL(s.now(), end)); err != nil {
+			slog.Debug("budget: set spend cache failed", "key", key, "error", err)
+		}
+	}
+	return spent, nil
+}
+
+// addSpend 累加本次消费并返回最新周期消费。缓存缺失时直接从 usage_logs 聚合（已包含或即将包含本次消费）。
+func (s *BudgetService) addSpend(ctx context.Context, userID, apiKeyID int64, period string, start, end time.Time, cost float64) (float64, error) {
+	if s.cache != nil {
+		key := budgetSpendKey(userID, apiKeyID, period, start)
+		if v, ok, err := s.cache.IncrSpend(ctx, key, cost); err == nil && ok {
+			return v, nil
+		}
+	}
+	return s.currentSpend(ctx, userID, apiKeyID, period, start, end)
+}
+
+func budgetSpendKey(userID, apiKeyID int64, period string, start time.Time) string {
+	return fmt.Sprintf("%d:%d:%s:%d", userID, apiKeyID, period, start.Unix())
+}
+
+func budgetSpendTTL(now, end time.Time) time.Duration {
+	ttl := end.Sub(now)
+	if ttl <= 0 || ttl > budgetSpendCacheTTL {
+		return budgetSpendCacheTTL
+	}
+	return ttl
+}
+
+func budgetPercent(spent, limit float64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return math.Round(spent/limit*10000) / 100
+}
+
+// loadLocal 读取用户预算与通知设置（进程内短缓存）
+func (s *BudgetService) loadLocal(ctx context.Context, userID int64) (*budgetLocalEntry, error) {
+	now := s.now()
+	s.localMu.Lock()
+	if e, ok := s.local[userID]; ok && now.Before(e.expiresAt) {
+		s.localMu.Unlock()
+		return e, nil
+	}
+	s.localMu.Unlock()
+
+	budgets, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entry := &budgetLocalEntry{budgets: budgets, expiresAt: now.Add(budgetLocalCacheTTL)}
+	if len(budgets) > 0 {
+		if entry.settings, err = s.repo.GetSettings(ctx, userID); err != nil {
+			return nil, err
+		}
+	} else if settings, err := s.repo.GetSettings(ctx, userID); err == nil && settings.SpikeHourlyUSD > 0 {
+		entry.settings = settings
+	}
+
+	s.localMu.Lock()
+	if len(s.local) >= budgetLocalCacheMax {
+		for id, e := range s.local {
+			if !now.Before(e.expiresAt) {
+				delete(s.local, id)
+			}
+		}
+	}
+	s.local[userID] = entry
+	s.localMu.Unlock()
+	return entry, nil
+}
+
+func (s *BudgetService) invalidateLocal(userID int64) {
+	s.localMu.Lock()
+	delete(s.local, userID)
+	s.localMu.Unlock()
+}
+
+// ============================================
+// 通知
+// ============================================
+
+func (s *BudgetService) notify(ctx context.Context, settings *BudgetSettings, payload *BudgetWebhookPayload) {
+	if settings == nil {
+		return
+	}
+	if settings.EmailEnabled {
+		s.sendBudgetEmail(ctx, payload)
+	}
+	if settings.WebhookURL != "" {
+		if err := s.sendWebhook(ctx, settings, payload); err != nil {
+			slog.Warn("budget: webhook delivery failed", "user_id", payload.UserID, "event", payload.Event, "error", err)
+		}
+	}
+}
+
+func (s *BudgetService) sendBudgetEmail(ctx context.Context, payload *BudgetWebhookPayload) {
+	if s.emailQueue == nil || s.userRepo == nil {
+		return
+	}
+	user, err := s.userRepo.GetByID(ctx, payload.UserID)
+	if err != nil || user == nil {
+		return
+	}
+	recipients := filterVerifiedEmails(append([]NotifyEmailEntry{{Email: user.Email, Verified: true}}, user.BalanceNotifyExtraEmails...))
+	if len(recipients) == 0 {
+		return
+	}
+
+	siteName := defaultSiteName
+	if s.settingRepo != nil {
+		if name, err := s.settingRepo.GetValue(ctx, SettingKeySiteName); err == nil && name != "" {
+			siteName = name
+		}
+	}
+	subject, body := buildBudgetAlertEmail(siteName, payload)
+	for _, to := range recipients {
+		if err := s.emailQueue.EnqueueNotification(to, subject, body); err != nil {
+			slog.Warn("budget: enqueue alert email failed", "to", to, "error", err)
+		}
+	}
+}
+
+func (s *BudgetService) sendWebhook(ctx context.Context, settings *BudgetSettings, payload *BudgetWebhookPayload) error {
+	if s.httpClient == nil {
+		return fmt.Errorf("webhook client unavailable")
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sub2API-Event", payload.Event)
+	if settings.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(settings.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Sub2API-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var budgetPeriodLabels = map[string]string{
+	BudgetPeriodDaily:   "日预算 / Daily",
+	BudgetPeriodWeekly:  "周预算 / Weekly",
+	BudgetPeriodMonthly: "月预算 / Monthly",
+	budgetSpikePeriod:   "小时突增 / Hourly spike",
+}
+
+// budgetAlertEmailTemplate 预算告警邮件模板
+// Format args: siteName, title, periodLabel, spent, limit, percent, note.
+const budgetAlertEmailTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background-color: #f5f5f5; margin: 0; padding: 20px; }
+        .container { max-width: 600px; margin: 0 auto; background-color: #fff; border-radius: 8px; overflow: hidden; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+        .header { background: linear-gradient(135deg, #f59e0b 0%%, #d97706 100%%); color: white; padding: 30px; text-align: center; }
+        .header h1 { margin: 0; font-size: 24px; }
+        .content { padding: 40px 30px; }
+        .metric { display: flex; justify-content: space-between; padding: 12px 0; border-bottom: 1px solid #eee; }
+        .metric-label { color: #666; }
+        .metric-value { font-weight: bold; color: #333; }
+        .info { color: #666; font-size: 14px; line-height: 1.6; margin-top: 20px; text-align: center; }
+        .footer { background-color: #f8f9fa; padding: 20px; text-align: center; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header"><h1>%s</h1></div>
+        <div class="content">
+            <p style="font-size: 18px; color: #333; text-align: center;">%s</p>
+            <div class="metric"><span class="metric-label">周期 / Period</span><span class="metric-value">%s</span></div>
+            <div class="metric"><span class="metric-label">已消费 / Spent</span><span class="metric-value">$%.2f</span></div>
+            <div class="metric"><span class="metric-label">预算 / Budget</span><span class="metric-value">$%.2f</span></div>
+            <div class="metric"><span class="metric-label">使用率 / Used</span><span class="metric-value">%.1f%%</span></div>
+            <div class="info">%s</div>
+        </div>
+        <div class="footer"><p>此邮件由系统自动发送，请勿回复。</p></div>
+    </div>
+</body>
+</html>`
+
+func buildBudgetAlertEmail(siteName string, p *BudgetWebhookPayload) (subject, body string) {
+	title := "预算提醒 / Budget Alert"
+	note := "<p>消费已达到预算提醒阈值。</p><p>Your spending has reached the alert threshold of this budget.</p>"
+	switch p.Event {
+	case BudgetEventExceeded:
+		title = "预算已用尽 / Budget Exceeded"
+		note = "<p>消费已达到预算上限。</p><p>Your spending has reached the budget limit.</p>"
+		if p.Mode == BudgetModeHard {
+			note += "<p>在周期重置前，相关请求将被拒绝。</p><p>Requests are blocked until the period resets.</p>"
+		}
+	case BudgetEventSpike:
+		title = "消费突增提醒 / Spending Spike"
+		note = "<p>本小时消费已超过突增提醒阈值，请检查是否存在异常调用（例如失控的 Agent 循环）。</p><p>Spending in the current hour exceeded your spike threshold. Check for runaway usage such as an agent loop.</p>"
+	}
+	periodLabel := budgetPeriodLabels[p.Period]
+	if periodLabel == "" {
+		periodLabel = p.Period
+	}
+	if p.APIKeyID != nil {
+		periodLabel = fmt.Sprintf("%s · API Key #%d", periodLabel, *p.APIKeyID)
+	}
+	subject = fmt.Sprintf("[%s] %s", sanitizeEmailHeader(siteName), title)
+	body = fmt.Sprintf(budgetAlertEmailTemplate, html.EscapeString(siteName), title, html.EscapeString(periodLabel), p.SpentUSD, p.LimitUSD, p.Percent, note)
+	return subject, body
+}
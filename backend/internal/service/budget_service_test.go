@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type budgetRepoStub struct {
+	mu         sync.Mutex
+	budgets    map[int64]*UsageBudget
+	settings   map[int64]*BudgetSettings
+	spend      float64
+	sumCalls   int
+	spikeMarks map[int64]time.Time
+	nextID     int64
+}
+
+func newBudgetRepoStub() *budgetRepoStub {
+	return &budgetRepoStub{
+		budgets:    map[int64]*UsageBudget{},
+		settings:   map[int64]*BudgetSettings{},
+		spikeMarks: map[int64]time.Time{},
+	}
+}
+
+func (r *budgetRepoStub) ListByUser(_ context.Context, userID int64) ([]*UsageBudget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*UsageBudget
+	for id := int64(1); id <= r.nextID; id++ {
+		if b, ok := r.budgets[id]; ok && b.UserID == userID {
+			cp := *b
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *budgetRepoStub) GetByID(_ context.Context, id int64) (*UsageBudget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.budgets[id]
+	if !ok {
+		return nil, ErrBudgetNotFound
+	}
+	cp := *b
+	return &cp, nil
+}
+
+func (r *budgetRepoStub) Create(_ context.Context, b *UsageBudget) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.budgets {
+		if existing.UserID == b.UserID && existing.ScopeKeyID() == b.ScopeKeyID() && existing.Period == b.Period {
+			return ErrBudgetDuplicate
+		}
+	}
+	r.nextID++
+	b.ID = r.nextID
+	cp := *b
+	r.budgets[b.ID] = &cp
+	return nil
+}
+
+func (r *budgetRepoStub) Update(_ context.Context, b *UsageBudget) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *b
+	r.budgets[b.ID] = &cp
+	return nil
+}
+
+func (r *budgetRepoStub) Delete(_ context.Context, _ int64, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.budgets, id)
+	return nil
+}
+
+func (r *budgetRepoStub) MarkAlerted(_ context.Context, id int64, periodStart time.Time, level int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.budgets[id]
+	if b.LastAlertPeriodStart != nil && b.LastAlertPeriodStart.Equal(periodStart) && b.LastAlertLevel >= level {
+		return false, nil
+	}
+	ps := periodStart
+	b.LastAlertPeriodStart, b.LastAlertLevel = &ps, level
+	return true, nil
+}
+
+func (r *budgetRepoStub) GetSettings(_ context.Context, userID int64) (*BudgetSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.settings[userID]; ok {
+		cp := *s
+		return &cp, nil
+	}
+	return &BudgetSettings{UserID: userID, EmailEnabled: true}, nil
+}
+
+func (r *budgetRepoStub) UpsertSettings(_ context.Context, s *BudgetSettings) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *s
+	r.settings[s.UserID] = &cp
+	return nil
+}
+
+func (r *budgetRepoStub) MarkSpikeAlerted(_ context.Context, userID int64, bucketStart time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.spikeMarks[userID]; ok && !last.Before(bucketStart) {
+		return false, nil
+	}
+	r.spikeMarks[userID] = bucketStart
+	return true, nil
+}
+
+func (r *budgetRepoStub) SumSpend(context.Context, int64, int64, time.Time) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sumCalls++
+	return r.spend, nil
+}
+
+type budgetCacheStub struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (c *budgetCacheStub) GetSpend(_ context.Context, key string) (float64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	return v, ok, nil
+}
+
+func (c *budgetCacheStub) SetSpend(_ context.Context, key string, spend float64, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = spend
+	return nil
+}
+
+func (c *budgetCacheStub) IncrSpend(_ context.Context, key string, delta float64) (float64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		return 0, false, nil
+	}
+	c.values[key] = v + delta
+	return v + delta, true, nil
+}
+
+type budgetUserStub struct{}
+
+func (budgetUserStub) GetByID(_ context.Context, id int64) (*User, error) {
+	return &User{ID: id, Email: "owner@example.com"}, nil
+}
+
+type budgetKeyOwnershipStub struct{ owned map[int64]bool }
+
+func (s budgetKeyOwnershipStub) VerifyOwnership(_ context.Context, _ int64, ids []int64) ([]int64, error) {
+	var out []int64
+	for _, id := range ids {
+		if s.owned[id] {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+type budgetEmailStub struct {
+	mu       sync.Mutex
+	subjects []string
+}
+
+func (q *budgetEmailStub) EnqueueNotification(_, subject, _ string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.subjects = append(q.subjects, subject)
+	return nil
+}
+
+func newBudgetServiceForTest(repo *budgetRepoStub, email *budgetEmailStub, client *http.Client) *BudgetService {
+	var queue BudgetEmailQueue
+	if email != nil {
+		queue = email
+	}
+	svc := newBudgetService(repo, &budgetCacheStub{values: map[string]float64{}}, budgetUserStub{},
+		budgetKeyOwnershipStub{owned: map[int64]bool{7: true}}, queue, nil, client)
+	svc.now = func() time.Time { return time.Date(2026, 3, 18, 10, 30, 0, 0, time.UTC) }
+	return svc
+}
+
+func TestBudgetService_RecordSpendWorkersShareCachedBudgets(t *testing.T) {
+	repo := newBudgetRepoStub()
+	email := &budgetEmailStub{}
+	svc := newBudgetServiceForTest(repo, email, nil)
+	ctx := context.Background()
+
+	b, err := svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 10})
+	require.NoError(t, err)
+	start, _ := budgetPeriodBounds(b.Period, svc.now())
+	cache := svc.cache.(*budgetCacheStub)
+	key := budgetSpendKey(1, 0, b.Period, start)
+	cache.values[key] = 0
+
+	// 多个 worker 并发累加并更新同一份本地缓存预算的告警快照（-race 下验证）
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			svc.RecordSpend(1, 3, 1)
+		}()
+	}
+	wg.Wait()
+	svc.Stop()
+
+	require.Equal(t, 50.0, cache.values[key])
+	require.NotEmpty(t, email.subjects)
+	require.LessOrEqual(t, len(email.subjects), 2)
+	require.Contains(t, email.subjects[len(email.subjects)-1], "Budget Exceeded")
+
+	// 停止后不再入队
+	svc.RecordSpend(1, 3, 1)
+	require.Equal(t, 50.0, cache.values[key])
+}
+
+func TestBudgetPeriodBounds(t *testing.T) {
+	now := time.Date(2026, 3, 18, 10, 30, 0, 0, time.Local) // Wednesday
+	start, end := budgetPeriodBounds(BudgetPeriodDaily, now)
+	require.Equal(t, time.Date(2026, 3, 18, 0, 0, 0, 0, time.Local), start)
+	require.Equal(t, start.AddDate(0, 0, 1), end)
+
+	start, end = budgetPeriodBounds(BudgetPeriodWeekly, now)
+	require.Equal(t, time.Monday, start.Weekday())
+	require.Equal(t, 7*24*time.Hour, end.Sub(start))
+
+	start, end = budgetPeriodBounds(BudgetPeriodMonthly, now)
+	require.Equal(t, 1, start.Day())
+	require.Equal(t, time.April, end.Month())
+}
+
+func TestBudgetService_CreateValidation(t *testing.T) {
+	repo := newBudgetRepoStub()
+	svc := newBudgetServiceForTest(repo, nil, nil)
+	ctx := context.Background()
+
+	_, err := svc.Create(ctx, 1, &CreateBudgetInput{Period: "yearly", LimitUSD: 10})
+	require.ErrorIs(t, err, ErrBudgetInvalidPeriod)
+	_, err = svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 0})
+	require.ErrorIs(t, err, ErrBudgetInvalidLimit)
+	_, err = svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 10, Mode: "block"})
+	require.ErrorIs(t, err, ErrBudgetInvalidMode)
+	foreignKey := int64(99)
+	_, err = svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 10, APIKeyID: &foreignKey})
+	require.ErrorIs(t, err, ErrBudgetAPIKeyInvalid)
+
+	b, err := svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 10})
+	require.NoError(t, err)
+	require.Equal(t, BudgetModeSoft, b.Mode)
+	require.Equal(t, defaultBudgetAlertPercent, b.AlertPercent)
+
+	_, err = svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 20})
+	require.ErrorIs(t, err, ErrBudgetDuplicate)
+
+	_, err = svc.Update(ctx, 2, b.ID, &UpdateBudgetInput{})
+	require.ErrorIs(t, err, ErrBudgetNotFound)
+}
+
+func TestBudgetService_CheckBudgetsHardModeBlocksByScope(t *testing.T) {
+	repo := newBudgetRepoStub()
+	svc := newBudgetServiceForTest(repo, nil, nil)
+	ctx := context.Background()
+
+	keyID := int64(7)
+	_, err := svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 5, Mode: BudgetModeHard, APIKeyID: &keyID})
+	require.NoError(t, err)
+	soft, err := svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodMonthly, LimitUSD: 1})
+	require.NoError(t, err)
+
+	repo.spend = 4.99
+	require.NoError(t, svc.CheckBudgets(ctx, 1, keyID))
+
+	svc.recordSpend(ctx, 1, keyID, 0.02)
+	err = svc.CheckBudgets(ctx, 1, keyID)
+	require.ErrorIs(t, err, ErrBudgetExceeded)
+
+	// 其他 Key 不受 Key 级预算影响，soft 预算超限也不拦截
+	require.NoError(t, svc.CheckBudgets(ctx, 1, 8))
+
+	statuses, err := svc.ListStatus(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	require.True(t, statuses[0].Blocked)
+	require.Equal(t, soft.ID, statuses[1].ID)
+	require.False(t, statuses[1].Blocked)
+}
+
+func TestBudgetService_AlertsDedupedPerPeriodAndLevel(t *testing.T) {
+	repo := newBudgetRepoStub()
+	email := &budgetEmailStub{}
+	svc := newBudgetServiceForTest(repo, email, nil)
+	ctx := context.Background()
+
+	_, err := svc.Create(ctx, 1, &CreateBudgetInput{Period: BudgetPeriodDaily, LimitUSD: 10})
+	require.NoError(t, err)
+
+	repo.spend = 7
+	svc.recordSpend(ctx, 1, 3, 1) // 缓存未命中，以 usage_logs 聚合值 7 回填，低于 80%
+	require.Empty(t, email.subjects)
+
+	svc.recordSpend(ctx, 1, 3, 1) // 8 → threshold
+	svc.recordSpend(ctx, 1, 3, 1) // 9 → threshold already sent
+	require.Len(t, email.subjects, 1)
+	require.Contains(t, email.subjects[0], "Budget Alert")
+
+	svc.recordSpend(ctx, 1, 3, 1) // 10 → exceeded
+	svc.recordSpend(ctx, 1, 3, 1)
+	require.Len(t, email.subjects, 2)
+	require.Contains(t, email.subjects[1], "Budget Exceeded")
+
+	// 关闭邮件后不再投递
+	disabled := false
+	_, err = svc.UpdateSettings(ctx, 1, &UpdateBudgetSettingsInput{EmailEnabled: &disabled})
+	require.NoError(t, err)
+	svc.now = func() time.Time { return time.Date(2026, 3, 19, 10, 30, 0, 0, time.UTC) }
+	repo.spend = 20
+	svc.recordSpend(ctx, 1, 3, 1)
+	require.Len(t, email.subjects, 2)
+}
+
+func TestBudgetService_WebhookSignedAndSpikeAlert(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []BudgetWebhookPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if r.Header.Get("X-Sub2API-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var p BudgetWebhookPayload
+		_ = json.Unmarshal(body, &p)
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	repo := newBudgetRepoStub()
+	repo.settings[1] = &BudgetSettings{UserID: 1, WebhookURL: srv.URL, WebhookSecret: "s3cret", SpikeHourlyUSD: 3}
+	svc := newBudgetServiceForTest(repo, nil, srv.Client())
+	ctx := context.Background()
+
+	repo.spend = 2
+	svc.recordSpend(ctx, 1, 3, 1)
+	require.Empty(t, payloads)
+	svc.recordSpend(ctx, 1, 3, 1) // 3 → spike
+	svc.recordSpend(ctx, 1, 3, 1) // 同一小时不重复告警
+
+	require.Len(t, payloads, 1)
+	require.Equal(t, BudgetEventSpike, payloads[0].Event)
+	require.InDelta(t, 3.0, payloads[0].SpentUSD, 1e-9)
+
+	view, err := svc.GetSettings(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, view.WebhookSecretSet)
+
+	insecure := "http://127.0.0.1/hook"
+	_, err = svc.UpdateSettings(ctx, 1, &UpdateBudgetSettingsInput{WebhookURL: &insecure})
+	require.ErrorIs(t, err, ErrBudgetWebhookURL)
+}
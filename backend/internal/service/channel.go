@@ -236,6 +236,19 @@ func (c *Channel) IsWebSearchEmulationEnabled(platform string) bool {
 	return ok && enabled
 }
 
+// IsWebFetchEmulationEnabled 返回该渠道是否为指定平台启用了 web fetch 模拟。
+func (c *Channel) IsWebFetchEmulationEnabled(platform string) bool {
+	if c == nil || c.FeaturesConfig == nil {
+		return false
+	}
+	wfe, ok := c.FeaturesConfig[featureKeyWebFetchEmulation].(map[string]any)
+	if !ok {
+		return false
+	}
+	enabled, ok := wfe[platform].(bool)
+	return ok && enabled
+}
+
 // deepCopyFeaturesConfig creates a deep copy of FeaturesConfig to prevent cache pollution.
 func deepCopyFeaturesConfig(src map[string]any) map[string]any {
 	dst := make(map[string]any, len(src))
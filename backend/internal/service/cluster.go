@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// 集群共享状态的会话类型（同时用作 Redis key 的命名空间）
+const (
+	ClusterSessionKindDigest        = "digest"
+	ClusterSessionKindWSSessionConn = "ws_session_conn"
+	ClusterSessionKindWSTurnState   = "ws_turn_state"
+)
+
+// ClusterSessionKinds 运维面板按节点统计的会话类型
+var ClusterSessionKinds = []string{
+	ClusterSessionKindDigest,
+	ClusterSessionKindWSSessionConn,
+	ClusterSessionKindWSTurnState,
+}
+
+// ClusterBinding 跨副本共享的一条会话绑定
+type ClusterBinding struct {
+	// NodeID 写入该绑定的副本（即会话归属节点）
+	NodeID string `json:"n"`
+	// Value 绑定值：摘要会话为 uuid，WS 为 conn_id / turn_state
+	Value     string `json:"v"`
+	AccountID int64  `json:"a,omitempty"`
+}
+
+// ClusterBindingWrite 批量写入的一条操作；Delete 为 true 时删除绑定（忽略 Binding/TTL）
+type ClusterBindingWrite struct {
+	Kind    string
+	Key     string
+	Binding ClusterBinding
+	TTL     time.Duration
+	Delete  bool
+}
+
+// ClusterNode 副本节点信息
+type ClusterNode struct {
+	NodeID     string    `json:"node_id"`
+	Hostname   string    `json:"hostname"`
+	StartedAt  time.Time `json:"started_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// 以下字段仅在查询时填充
+	Self          bool             `json:"self"`
+	OwnedSessions map[string]int64 `json:"owned_sessions,omitempty"`
+}
+
+// ClusterSessionOwnership 会话归属记录（运维面板展示）
+type ClusterSessionOwnership struct {
+	Kind      string    `json:"kind"`
+	Key       string    `json:"key"`
+	NodeID    string    `json:"node_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ClusterStateCache 多副本共享状态存储（Redis 实现）
+type ClusterStateCache interface {
+	SetBinding(ctx context.Context, kind, key string, binding ClusterBinding, ttl time.Duration) error
+	// GetBinding 不存在时返回 nil, nil
+	GetBinding(ctx context.Context, kind, key string) (*ClusterBinding, error)
+	// GetBindings 批量读取，返回切片与 keys 一一对应，缺失项为 nil
+	GetBindings(ctx context.Context, kind string, keys []string) ([]*ClusterBinding, error)
+	DeleteBinding(ctx context.Context, kind, key string) error
+	// WriteBindings 按顺序批量写入/删除绑定（单次 pipeline），供异步写入器使用
+	WriteBindings(ctx context.Context, writes []ClusterBindingWrite) error
+
+	RegisterNode(ctx context.Context, node ClusterNode) error
+	UnregisterNode(ctx context.Context, nodeID string) error
+	// ListNodes 返回未过期的节点
+	ListNodes(ctx context.Context, now time.Time) ([]ClusterNode, error)
+	CountOwnedSessions(ctx context.Context, nodeID string, now time.Time) (map[string]int64, error)
+	ListOwnedSessions(ctx context.Context, nodeID string, now time.Time, limit int) ([]ClusterSessionOwnership, error)
+	// PruneOwnedSessions 清理节点归属索引中已过期的条目
+	PruneOwnedSessions(ctx context.Context, nodeID string, now time.Time) error
+}
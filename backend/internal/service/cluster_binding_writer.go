@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const (
+	clusterBindingWriterMaxPending    = 8192
+	clusterBindingWriterBatchSize     = 256
+	clusterBindingWriterFlushInterval = 50 * time.Millisecond
+)
+
+// clusterBindingWriter 把共享会话绑定的写入移出请求路径：入队即返回，
+// 后台按批（单次 pipeline）写入 ClusterStateCache。
+//
+// 共享存储只是跨副本的补充，本地缓存才是权威：积压超过上限时直接丢弃新写入，
+// 写入失败只记录日志，其他副本最多表现为一次未命中。
+// 由 ClusterService 统一持有，停机时 stop 写出剩余积压并退出后台 goroutine。
+type clusterBindingWriter struct {
+	shared ClusterStateCache
+
+	mu      sync.Mutex
+	pending []ClusterBindingWrite
+	// flushMu 保证批次按入队顺序落库（同一 key 的写入与删除不会乱序）
+	flushMu sync.Mutex
+
+	wake      chan struct{}
+	startOnce sync.Once
+	dropped   atomic.Int64
+
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	stopped  atomic.Bool
+}
+
+func newClusterBindingWriter(shared ClusterStateCache) *clusterBindingWriter {
+	return &clusterBindingWriter{
+		shared: shared,
+		wake:   make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (w *clusterBindingWriter) set(kind, key string, binding ClusterBinding, ttl time.Duration) {
+	w.enqueue(ClusterBindingWrite{Kind: kind, Key: key, Binding: binding, TTL: ttl})
+}
+
+func (w *clusterBindingWriter) delete(kind, key string) {
+	w.enqueue(ClusterBindingWrite{Kind: kind, Key: key, Delete: true})
+}
+
+func (w *clusterBindingWriter) enqueue(write ClusterBindingWrite) {
+	if w.stopped.Load() {
+		return
+	}
+	w.startOnce.Do(func() { go w.run() })
+
+	w.mu.Lock()
+	if len(w.pending) >= clusterBindingWriterMaxPending {
+		w.mu.Unlock()
+		if w.dropped.Add(1)%1000 == 1 {
+			logger.LegacyPrintf("service.cluster", "[Cluster] binding writer backlog full, dropped=%d", w.dropped.Load())
+		}
+		return
+	}
+	w.pending = append(w.pending, write)
+	full := len(w.pending) >= clusterBindingWriterBatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *clusterBindingWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(clusterBindingWriterFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		case <-w.stopCh:
+			return
+		}
+		w.flush()
+	}
+}
+
+// stop 停止后台写入：不再接受新写入，等待后台 goroutine 退出后写出剩余积压
+func (w *clusterBindingWriter) stop() {
+	if w == nil {
+		return
+	}
+	w.stopOnce.Do(func() {
+		w.stopped.Store(true)
+		started := true
+		w.startOnce.Do(func() { started = false })
+		close(w.stopCh)
+		if started {
+			<-w.done
+		}
+		w.flush()
+	})
+}
+
+// flush 同步写出当前积压（测试中也用于等待写入完成）
+func (w *clusterBindingWriter) flush() {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	for len(batch) > 0 {
+		n := min(len(batch), clusterBindingWriterBatchSize)
+		ctx, cancel := context.WithTimeout(context.Background(), clusterStateTimeout)
+		if err := w.shared.WriteBindings(ctx, batch[:n]); err != nil {
+			logger.LegacyPrintf("service.cluster", "[Cluster] shared binding write failed: count=%d err=%v", n, err)
+		}
+		cancel()
+		batch = batch[n:]
+	}
+}
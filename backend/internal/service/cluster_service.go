@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const (
+	clusterStateTimeout          = 3 * time.Second
+	clusterNodeTTLMultiplier     = 3
+	clusterSessionListMaxLimit   = 500
+	clusterSessionListDefaultMax = 100
+)
+
+// ClusterService 多副本节点身份与心跳。
+// 启用 cluster.enabled 后，摘要会话与 WS 粘连状态通过 ClusterStateCache 在副本间共享，
+// 每个副本定期上报心跳，运维面板据此展示各节点及其持有的会话。
+type ClusterService struct {
+	cache     ClusterStateCache
+	enabled   bool
+	nodeID    string
+	hostname  string
+	interval  time.Duration
+	startedAt time.Time
+
+	now func() time.Time
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	writersMu sync.Mutex
+	writers   []*clusterBindingWriter
+	stopped   bool
+}
+
+// NewClusterService 创建集群服务
+func NewClusterService(cache ClusterStateCache, cfg *config.Config) *ClusterService {
+	s := &ClusterService{
+		cache:     cache,
+		interval:  10 * time.Second,
+		startedAt: time.Now(),
+		now:       time.Now,
+		stopCh:    make(chan struct{}),
+	}
+	s.hostname, _ = os.Hostname()
+	if cfg != nil {
+		s.enabled = cfg.Cluster.Enabled && cache != nil
+		s.nodeID = strings.TrimSpace(cfg.Cluster.NodeID)
+		if cfg.Cluster.HeartbeatIntervalSeconds > 0 {
+			s.interval = time.Duration(cfg.Cluster.HeartbeatIntervalSeconds) * time.Second
+		}
+	}
+	if s.nodeID == "" {
+		s.nodeID = s.hostname
+	}
+	return s
+}
+
+// Enabled 是否启用跨副本共享
+func (s *ClusterService) Enabled() bool {
+	return s != nil && s.enabled
+}
+
+// NodeID 当前副本标识
+func (s *ClusterService) NodeID() string {
+	if s == nil {
+		return ""
+	}
+	return s.nodeID
+}
+
+// SharedCache 返回跨副本共享存储；未启用时返回 nil（各 store 退化为进程内实现）
+func (s *ClusterService) SharedCache() ClusterStateCache {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.cache
+}
+
+// Start 启动心跳
+func (s *ClusterService) Start() {
+	if !s.Enabled() {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		s.heartbeat()
+		for {
+			select {
+			case <-ticker.C:
+				s.heartbeat()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// trackBindingWriter 登记会话存储的异步写入器，Stop 时统一写出积压并退出；
+// 已停止时立即停止该写入器。
+func (s *ClusterService) trackBindingWriter(w *clusterBindingWriter) {
+	if s == nil || w == nil {
+		return
+	}
+	s.writersMu.Lock()
+	if s.stopped {
+		s.writersMu.Unlock()
+		w.stop()
+		return
+	}
+	s.writers = append(s.writers, w)
+	s.writersMu.Unlock()
+}
+
+// Stop 停止心跳，写出待同步的会话绑定并注销节点
+func (s *ClusterService) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	s.wg.Wait()
+
+	s.writersMu.Lock()
+	writers := s.writers
+	s.writers = nil
+	s.stopped = true
+	s.writersMu.Unlock()
+	for _, w := range writers {
+		w.stop()
+	}
+	if !s.Enabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStateTimeout)
+	defer cancel()
+	if err := s.cache.UnregisterNode(ctx, s.nodeID); err != nil {
+		logger.LegacyPrintf("service.cluster", "[Cluster] unregister node failed: node=%s err=%v", s.nodeID, err)
+	}
+}
+
+func (s *ClusterService) heartbeat() {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStateTimeout)
+	defer cancel()
+	now := s.now()
+	node := ClusterNode{
+		NodeID:     s.nodeID,
+		Hostname:   s.hostname,
+		StartedAt:  s.startedAt,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.interval * clusterNodeTTLMultiplier),
+	}
+	if err := s.cache.RegisterNode(ctx, node); err != nil {
+		logger.LegacyPrintf("service.cluster", "[Cluster] heartbeat failed: node=%s err=%v", s.nodeID, err)
+		return
+	}
+	if err := s.cache.PruneOwnedSessions(ctx, s.nodeID, now); err != nil {
+		logger.LegacyPrintf("service.cluster", "[Cluster] prune owned sessions failed: node=%s err=%v", s.nodeID, err)
+	}
+}
+
+// ListNodes 返回存活节点及各自持有的会话数量。未启用时仅返回当前节点。
+func (s *ClusterService) ListNodes(ctx context.Context) ([]ClusterNode, error) {
+	if s == nil {
+		return []ClusterNode{}, nil
+	}
+	now := s.now()
+	if !s.Enabled() {
+		return []ClusterNode{{
+			NodeID:     s.nodeID,
+			Hostname:   s.hostname,
+			StartedAt:  s.startedAt,
+			LastSeenAt: now,
+			Self:       true,
+		}}, nil
+	}
+	nodes, err := s.cache.ListNodes(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	for i := range nodes {
+		nodes[i].Self = nodes[i].NodeID == s.nodeID
+		counts, err := s.cache.CountOwnedSessions(ctx, nodes[i].NodeID, now)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i].OwnedSessions = counts
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	return nodes, nil
+}
+
+// ListSessions 返回指定节点持有的会话（按过期时间倒序）
+func (s *ClusterService) ListSessions(ctx context.Context, nodeID string, limit int) ([]ClusterSessionOwnership, error) {
+	if !s.Enabled() {
+		return []ClusterSessionOwnership{}, nil
+	}
+	if limit <= 0 {
+		limit = clusterSessionListDefaultMax
+	}
+	if limit > clusterSessionListMaxLimit {
+		limit = clusterSessionListMaxLimit
+	}
+	nodeID = strings.TrimSpace(nodeID)
+	if nodeID == "" {
+		nodeID = s.nodeID
+	}
+	return s.cache.ListOwnedSessions(ctx, nodeID, s.now(), limit)
+}
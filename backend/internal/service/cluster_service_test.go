@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+// memClusterStateCache 进程内共享的 ClusterStateCache，模拟多个副本共用一个 Redis
+type memClusterStateCache struct {
+	mu       sync.Mutex
+	bindings map[string]memClusterBinding
+	nodes    map[string]ClusterNode
+}
+
+type memClusterBinding struct {
+	binding   ClusterBinding
+	expiresAt time.Time
+}
+
+func newMemClusterStateCache() *memClusterStateCache {
+	return &memClusterStateCache{
+		bindings: make(map[string]memClusterBinding),
+		nodes:    make(map[string]ClusterNode),
+	}
+}
+
+func (c *memClusterStateCache) SetBinding(_ context.Context, kind, key string, binding ClusterBinding, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bindings[kind+"|"+key] = memClusterBinding{binding: binding, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (c *memClusterStateCache) GetBinding(_ context.Context, kind, key string) (*ClusterBinding, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.bindings[kind+"|"+key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil, nil
+	}
+	b := e.binding
+	return &b, nil
+}
+
+func (c *memClusterStateCache) GetBindings(ctx context.Context, kind string, keys []string) ([]*ClusterBinding, error) {
+	out := make([]*ClusterBinding, len(keys))
+	for i, key := range keys {
+		out[i], _ = c.GetBinding(ctx, kind, key)
+	}
+	return out, nil
+}
+
+func (c *memClusterStateCache) DeleteBinding(_ context.Context, kind, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.bindings, kind+"|"+key)
+	return nil
+}
+
+func (c *memClusterStateCache) WriteBindings(ctx context.Context, writes []ClusterBindingWrite) error {
+	for _, w := range writes {
+		if w.Delete {
+			_ = c.DeleteBinding(ctx, w.Kind, w.Key)
+			continue
+		}
+		_ = c.SetBinding(ctx, w.Kind, w.Key, w.Binding, w.TTL)
+	}
+	return nil
+}
+
+func (c *memClusterStateCache) RegisterNode(_ context.Context, node ClusterNode) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nodes[node.NodeID] = node
+	return nil
+}
+
+func (c *memClusterStateCache) UnregisterNode(_ context.Context, nodeID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.nodes, nodeID)
+	return nil
+}
+
+func (c *memClusterStateCache) ListNodes(_ context.Context, now time.Time) ([]ClusterNode, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]ClusterNode, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		if now.Before(n.ExpiresAt) {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func (c *memClusterStateCache) CountOwnedSessions(ctx context.Context, nodeID string, now time.Time) (map[string]int64, error) {
+	sessions, _ := c.ListOwnedSessions(ctx, nodeID, now, 1<<30)
+	counts := make(map[string]int64)
+	for _, s := range sessions {
+		counts[s.Kind]++
+	}
+	return counts, nil
+}
+
+func (c *memClusterStateCache) ListOwnedSessions(_ context.Context, nodeID string, now time.Time, limit int) ([]ClusterSessionOwnership, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]ClusterSessionOwnership, 0)
+	for k, e := range c.bindings {
+		if e.binding.NodeID != nodeID || now.After(e.expiresAt) {
+			continue
+		}
+		kind, key, _ := strings.Cut(k, "|")
+		out = append(out, ClusterSessionOwnership{Kind: kind, Key: key, NodeID: nodeID, ExpiresAt: e.expiresAt})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (c *memClusterStateCache) PruneOwnedSessions(context.Context, string, time.Time) error {
+	return nil
+}
+
+func newTestClusterService(cache ClusterStateCache, nodeID string, enabled bool) *ClusterService {
+	cfg := &config.Config{}
+	cfg.Cluster.Enabled = enabled
+	cfg.Cluster.NodeID = nodeID
+	cfg.Cluster.HeartbeatIntervalSeconds = 10
+	return NewClusterService(cache, cfg)
+}
+
+func TestDigestSessionStore_SharedAcrossReplicas(t *testing.T) {
+	shared := newMemClusterStateCache()
+	nodeA := NewDigestSessionStore()
+	nodeA.EnableClusterSharing(shared, "node-a")
+	nodeB := NewDigestSessionStore()
+	nodeB.EnableClusterSharing(shared, "node-b")
+
+	nodeA.Save(1, "prefix", "u:a-m:b", "uuid-1", 10, "")
+	nodeA.writer.flush()
+
+	uuid, accountID, matched, found := nodeB.Find(1, "prefix", "u:a-m:b-u:c")
+	require.True(t, found)
+	require.Equal(t, "uuid-1", uuid)
+	require.Equal(t, int64(10), accountID)
+	require.Equal(t, "u:a-m:b", matched)
+
+	// 后续轮次落在 B 上：保存更长 chain 并删除旧 key
+	nodeB.Save(1, "prefix", "u:a-m:b-u:c-m:d", "uuid-1", 10, matched)
+	nodeB.writer.flush()
+	b, err := shared.GetBinding(context.Background(), ClusterSessionKindDigest, buildNS(1, "prefix")+"u:a-m:b")
+	require.NoError(t, err)
+	require.Nil(t, b, "old chain should be removed from shared store")
+
+	// A 本地仍有短链：本地优先命中，不再访问共享存储
+	uuid, _, matched, found = nodeA.Find(1, "prefix", "u:a-m:b-u:c-m:d-u:e")
+	require.True(t, found)
+	require.Equal(t, "uuid-1", uuid)
+	require.Equal(t, "u:a-m:b", matched)
+
+	// 第三个副本本地无记录，从共享存储拿到 B 保存的最长匹配
+	nodeC := NewDigestSessionStore()
+	nodeC.EnableClusterSharing(shared, "node-c")
+	_, _, matched, found = nodeC.Find(1, "prefix", "u:a-m:b-u:c-m:d-u:e")
+	require.True(t, found)
+	require.Equal(t, "u:a-m:b-u:c-m:d", matched)
+}
+
+// failingClusterStateCache 所有共享存储调用都失败，并统计调用次数
+type failingClusterStateCache struct {
+	memClusterStateCache
+	reads  atomic.Int64
+	writes atomic.Int64
+}
+
+func (c *failingClusterStateCache) GetBinding(context.Context, string, string) (*ClusterBinding, error) {
+	c.reads.Add(1)
+	return nil, errors.New("redis down")
+}
+
+func (c *failingClusterStateCache) GetBindings(context.Context, string, []string) ([]*ClusterBinding, error) {
+	c.reads.Add(1)
+	return nil, errors.New("redis down")
+}
+
+func (c *failingClusterStateCache) SetBinding(context.Context, string, string, ClusterBinding, time.Duration) error {
+	c.writes.Add(1)
+	return errors.New("redis down")
+}
+
+func (c *failingClusterStateCache) WriteBindings(context.Context, []ClusterBindingWrite) error {
+	c.writes.Add(1)
+	return errors.New("redis down")
+}
+
+func TestDigestSessionStore_SharedFailuresAreCacheMisses(t *testing.T) {
+	shared := &failingClusterStateCache{}
+	store := NewDigestSessionStore()
+	store.EnableClusterSharing(shared, "node-a")
+
+	// 写入只入队，不在请求路径上访问共享存储
+	store.Save(1, "prefix", "u:a", "uuid-1", 10, "")
+	require.Zero(t, shared.writes.Load())
+
+	// 本地命中不访问共享存储
+	_, _, _, found := store.Find(1, "prefix", "u:a-m:b")
+	require.True(t, found)
+	require.Zero(t, shared.reads.Load())
+
+	// 本地未命中且共享存储出错：按未命中处理
+	_, _, _, found = store.Find(2, "prefix", "u:x")
+	require.False(t, found)
+	require.Equal(t, int64(1), shared.reads.Load())
+
+	// 未命中被短暂记住：同一 chain 不再同步访问共享存储
+	_, _, _, found = store.Find(2, "prefix", "u:x")
+	require.False(t, found)
+	require.Equal(t, int64(1), shared.reads.Load())
+
+	store.writer.flush()
+	require.Equal(t, int64(1), shared.writes.Load())
+}
+
+func TestDigestSessionStore_SharedMissIsRemembered(t *testing.T) {
+	shared := &countingClusterStateCache{memClusterStateCache: *newMemClusterStateCache()}
+	store := NewDigestSessionStore()
+	store.EnableClusterSharing(shared, "node-a")
+
+	for range 3 {
+		_, _, _, found := store.Find(1, "prefix", "u:a-m:b")
+		require.False(t, found)
+	}
+	require.Equal(t, int64(1), shared.reads.Load())
+
+	// 更长的 chain 是新的查询键，仍会访问共享存储
+	_, _, _, found := store.Find(1, "prefix", "u:a-m:b-u:c")
+	require.False(t, found)
+	require.Equal(t, int64(2), shared.reads.Load())
+}
+
+// countingClusterStateCache 统计批量读取次数的内存共享存储
+type countingClusterStateCache struct {
+	memClusterStateCache
+	reads atomic.Int64
+}
+
+func (c *countingClusterStateCache) GetBindings(ctx context.Context, kind string, keys []string) ([]*ClusterBinding, error) {
+	c.reads.Add(1)
+	return c.memClusterStateCache.GetBindings(ctx, kind, keys)
+}
+
+func TestClusterService_StopFlushesBindingWriters(t *testing.T) {
+	shared := newMemClusterStateCache()
+	svc := newTestClusterService(shared, "node-a", true)
+	store := NewDigestSessionStore()
+	store.EnableClusterSharing(svc.SharedCache(), svc.NodeID())
+	svc.trackBindingWriter(store.writer)
+
+	store.Save(1, "p", "u:a", "uuid", 3, "")
+	svc.Stop()
+
+	b, err := shared.GetBinding(context.Background(), ClusterSessionKindDigest, buildNS(1, "p")+"u:a")
+	require.NoError(t, err)
+	require.NotNil(t, b, "pending writes are flushed on stop")
+	select {
+	case <-store.writer.done:
+	default:
+		t.Fatal("writer goroutine should have exited")
+	}
+
+	// 停止后的写入直接丢弃；之后登记的写入器立即停止
+	store.Save(1, "p", "u:b", "uuid", 3, "")
+	store.writer.flush()
+	b, err = shared.GetBinding(context.Background(), ClusterSessionKindDigest, buildNS(1, "p")+"u:b")
+	require.NoError(t, err)
+	require.Nil(t, b)
+
+	late := newClusterBindingWriter(shared)
+	svc.trackBindingWriter(late)
+	require.True(t, late.stopped.Load())
+}
+
+func TestDigestSessionStore_WithoutSharingStaysLocal(t *testing.T) {
+	nodeA := NewDigestSessionStore()
+	nodeB := NewDigestSessionStore()
+
+	nodeA.Save(1, "prefix", "u:a", "uuid-1", 10, "")
+	_, _, _, found := nodeB.Find(1, "prefix", "u:a")
+	require.False(t, found)
+}
+
+func TestOpenAIWSStateStore_SharedTurnStateAndOwnership(t *testing.T) {
+	shared := newMemClusterStateCache()
+	nodeA := NewClusterOpenAIWSStateStore(nil, shared, "node-a")
+	nodeB := NewClusterOpenAIWSStateStore(nil, shared, "node-b")
+
+	nodeA.BindSessionTurnState(7, "sess", "turn-1", time.Minute)
+	nodeA.BindSessionConn(7, "sess", "conn-a", time.Minute)
+	nodeA.BindResponseConn("resp_1", "conn-a", time.Minute)
+	nodeA.(*defaultOpenAIWSStateStore).writer.flush()
+
+	state, ok := nodeB.GetSessionTurnState(7, "sess")
+	require.True(t, ok)
+	require.Equal(t, "turn-1", state)
+
+	// 连接无法跨进程复用：B 不应返回 A 的 conn_id
+	_, ok = nodeB.GetSessionConn(7, "sess")
+	require.False(t, ok)
+	_, ok = nodeB.GetResponseConn("resp_1")
+	require.False(t, ok)
+
+	owned, err := shared.ListOwnedSessions(context.Background(), "node-a", time.Now(), 10)
+	require.NoError(t, err)
+	kinds := make([]string, 0, len(owned))
+	for _, o := range owned {
+		kinds = append(kinds, o.Kind)
+	}
+	// response -> conn_id 只在本地，不写共享存储
+	require.ElementsMatch(t, []string{ClusterSessionKindWSTurnState, ClusterSessionKindWSSessionConn}, kinds)
+
+	nodeA.DeleteSessionTurnState(7, "sess")
+	nodeB.DeleteSessionTurnState(7, "sess")
+	nodeA.(*defaultOpenAIWSStateStore).writer.flush()
+	nodeB.(*defaultOpenAIWSStateStore).writer.flush()
+	_, ok = nodeB.GetSessionTurnState(7, "sess")
+	require.False(t, ok)
+}
+
+func TestOpenAIWSStateStore_SharedTurnStateFailuresAreCacheMisses(t *testing.T) {
+	shared := &failingClusterStateCache{}
+	store := NewClusterOpenAIWSStateStore(nil, shared, "node-a")
+
+	store.BindSessionTurnState(7, "sess", "turn-1", time.Minute)
+	require.Zero(t, shared.writes.Load(), "shared writes must not block the request path")
+	state, ok := store.GetSessionTurnState(7, "sess")
+	require.True(t, ok)
+	require.Equal(t, "turn-1", state)
+	require.Zero(t, shared.reads.Load())
+
+	_, ok = store.GetSessionTurnState(7, "other")
+	require.False(t, ok)
+	_, ok = store.GetSessionTurnState(7, "other")
+	require.False(t, ok)
+	require.Equal(t, int64(1), shared.reads.Load(), "shared misses are remembered briefly")
+}
+
+func TestClusterService_ListNodesWithOwnership(t *testing.T) {
+	shared := newMemClusterStateCache()
+	svcA := newTestClusterService(shared, "node-a", true)
+	svcB := newTestClusterService(shared, "node-b", true)
+	svcA.heartbeat()
+	svcB.heartbeat()
+
+	store := NewDigestSessionStore()
+	store.EnableClusterSharing(svcB.SharedCache(), svcB.NodeID())
+	store.Save(1, "p", "u:a", "uuid", 3, "")
+	store.writer.flush()
+
+	nodes, err := svcA.ListNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	require.Equal(t, "node-a", nodes[0].NodeID)
+	require.True(t, nodes[0].Self)
+	require.False(t, nodes[1].Self)
+	require.Equal(t, int64(1), nodes[1].OwnedSessions[ClusterSessionKindDigest])
+
+	sessions, err := svcA.ListSessions(context.Background(), "node-b", 0)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, buildNS(1, "p")+"u:a", sessions[0].Key)
+
+	svcB.Stop()
+	nodes, err = svcA.ListNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+}
+
+func TestClusterService_DisabledReportsSelfOnly(t *testing.T) {
+	svc := newTestClusterService(newMemClusterStateCache(), "solo", false)
+	require.Nil(t, svc.SharedCache())
+
+	nodes, err := svc.ListNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	require.Equal(t, "solo", nodes[0].NodeID)
+	require.True(t, nodes[0].Self)
+
+	sessions, err := svc.ListSessions(context.Background(), "", 10)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}
@@ -85,7 +85,8 @@ const (
 
 // ConcurrencyService manages concurrent request limiting for accounts and users
 type ConcurrencyService struct {
-	cache ConcurrencyCache
+	cache    ConcurrencyCache
+	priority *RequestPriorityService
 }
 
 // NewConcurrencyService creates a new ConcurrencyService
@@ -93,6 +94,11 @@ func NewConcurrencyService(cache ConcurrencyCache) *ConcurrencyService {
 	return &ConcurrencyService{cache: cache}
 }
 
+// SetRequestPriorityService 注入 API Key 优先级分道（账号槽位让位 / background 限额 / 等待队列抢占）
+func (s *ConcurrencyService) SetRequestPriorityService(priority *RequestPriorityService) {
+	s.priority = priority
+}
+
 // AcquireResult represents the result of acquiring a concurrency slot
 type AcquireResult struct {
 	Acquired    bool
@@ -135,10 +141,15 @@ func (s *ConcurrencyService) AcquireAccountSlot(ctx context.Context, accountID i
 		}, nil
 	}
 
+	// 有更高优先级请求在该账号上等待时让位
+	if s.priority.shouldYield(ctx, accountID) {
+		return &AcquireResult{Acquired: false}, nil
+	}
+
 	// Generate unique request ID for this slot
 	requestID := generateRequestID()
 
-	acquired, err := s.cache.AcquireAccountSlot(ctx, accountID, maxConcurrency, requestID)
+	acquired, err := s.cache.AcquireAccountSlot(ctx, accountID, s.priority.effectiveMaxConcurrency(ctx, maxConcurrency), requestID)
 	if err != nil {
 		return nil, err
 	}
@@ -146,13 +157,13 @@ func (s *ConcurrencyService) AcquireAccountSlot(ctx context.Context, accountID i
 	if acquired {
 		return &AcquireResult{
 			Acquired: true,
-			ReleaseFunc: func() {
+			ReleaseFunc: s.priority.trackAcquired(ctx, func() {
 				bgCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer cancel()
 				if err := s.cache.ReleaseAccountSlot(bgCtx, accountID, requestID); err != nil {
 					logger.LegacyPrintf("service.concurrency", "Warning: failed to release account slot for %d (req=%s): %v", accountID, requestID, err)
 				}
-			},
+			}),
 		}, nil
 	}
 
@@ -248,7 +259,14 @@ func (s *ConcurrencyService) IncrementAccountWaitCount(ctx context.Context, acco
 	result, err := s.cache.IncrementAccountWaitCount(ctx, accountID, maxWait)
 	if err != nil {
 		logger.LegacyPrintf("service.concurrency", "Warning: increment wait count failed for account %d: %v", accountID, err)
-		return true, nil
+		result = true
+	}
+	// 队列已满时，更高优先级请求接管一个 background 等待者的位置
+	if !result && s.priority.preemptFor(ctx, accountID) {
+		result = true
+	}
+	if result {
+		s.priority.registerWaiter(ctx, accountID)
 	}
 	return result, nil
 }
@@ -258,6 +276,10 @@ func (s *ConcurrencyService) DecrementAccountWaitCount(ctx context.Context, acco
 	if s.cache == nil {
 		return
 	}
+	// 等待位置已转交给抢占者时不再递减
+	if s.priority.unregisterWaiter(ctx, accountID) {
+		return
+	}
 
 	bgCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -267,6 +289,11 @@ func (s *ConcurrencyService) DecrementAccountWaitCount(ctx context.Context, acco
 	}
 }
 
+// PriorityClassStats returns per priority class slot usage of this instance (nil when priority lanes are not wired).
+func (s *ConcurrencyService) PriorityClassStats() []PriorityClassStats {
+	return s.priority.Stats()
+}
+
 // GetAccountWaitingCount gets current wait queue count for an account.
 func (s *ConcurrencyService) GetAccountWaitingCount(ctx context.Context, accountID int64) (int, error) {
 	if s.cache == nil {
@@ -0,0 +1,1519 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/model"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+)
+
+const (
+	configListPageSize      = 500
+	configRollbackTimeout   = 2 * time.Minute
+	configApplyOperationKey = "config-apply"
+)
+
+// configChannelStore 渠道读写（由 ChannelService 实现）
+type configChannelStore interface {
+	List(ctx context.Context, params pagination.PaginationParams, status, search string) ([]Channel, *pagination.PaginationResult, error)
+	Create(ctx context.Context, input *CreateChannelInput) (*Channel, error)
+	Update(ctx context.Context, id int64, input *UpdateChannelInput) (*Channel, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// configErrorRuleStore 错误透传规则读写（由 ErrorPassthroughService 实现）
+type configErrorRuleStore interface {
+	List(ctx context.Context) ([]*model.ErrorPassthroughRule, error)
+	Create(ctx context.Context, rule *model.ErrorPassthroughRule) (*model.ErrorPassthroughRule, error)
+	Update(ctx context.Context, rule *model.ErrorPassthroughRule) (*model.ErrorPassthroughRule, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// configTLSProfileStore TLS 指纹模板读写（由 TLSFingerprintProfileService 实现）
+type configTLSProfileStore interface {
+	List(ctx context.Context) ([]*model.TLSFingerprintProfile, error)
+	Create(ctx context.Context, profile *model.TLSFingerprintProfile) (*model.TLSFingerprintProfile, error)
+	Update(ctx context.Context, profile *model.TLSFingerprintProfile) (*model.TLSFingerprintProfile, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// configSettingStore 系统设置读写（由 SettingService 实现）
+type configSettingStore interface {
+	GetAllSettings(ctx context.Context) (*SystemSettings, error)
+	UpdateSettings(ctx context.Context, settings *SystemSettings) error
+}
+
+// ConfigAsCodeService 声明式配置：plan 计算期望状态与线上状态的差异，apply 按依赖顺序执行差异。
+//
+// 各资源由不同的 repository 各自管理事务（ent / database/sql 混用），无法放进同一个数据库事务，
+// 因此 apply 采用补偿式事务：任一步失败时按相反顺序撤销已执行的步骤（新建的删除、更新的恢复原值）。
+// 所有写入都经过既有的 service 方法，校验规则与缓存失效与后台操作保持一致。
+type ConfigAsCodeService struct {
+	adminService AdminService
+	channels     configChannelStore
+	errorRules   configErrorRuleStore
+	tlsProfiles  configTLSProfileStore
+	settings     configSettingStore
+	lockService  *SystemOperationLockService
+
+	lookupEnv func(string) (string, bool)
+}
+
+// NewConfigAsCodeService 创建声明式配置服务
+func NewConfigAsCodeService(
+	adminService AdminService,
+	channelService *ChannelService,
+	errorPassthroughService *ErrorPassthroughService,
+	tlsProfileService *TLSFingerprintProfileService,
+	settingService *SettingService,
+	lockService *SystemOperationLockService,
+) *ConfigAsCodeService {
+	s := &ConfigAsCodeService{
+		adminService: adminService,
+		lockService:  lockService,
+		lookupEnv:    os.LookupEnv,
+	}
+	if channelService != nil {
+		s.channels = channelService
+	}
+	if errorPassthroughService != nil {
+		s.errorRules = errorPassthroughService
+	}
+	if tlsProfileService != nil {
+		s.tlsProfiles = tlsProfileService
+	}
+	if settingService != nil {
+		s.settings = settingService
+	}
+	return s
+}
+
+// configLiveObject 线上资源（spec 形式的完整字段）
+type configLiveObject struct {
+	id   int64
+	spec map[string]any
+}
+
+// configLiveState 一次 plan 读取到的线上状态
+type configLiveState struct {
+	objects   map[string]map[string]*configLiveObject // kind -> name -> object
+	ambiguous map[string]map[string]bool              // kind -> 重名的资源名
+	settings  *SystemSettings
+}
+
+func newConfigLiveState() *configLiveState {
+	return &configLiveState{
+		objects:   make(map[string]map[string]*configLiveObject),
+		ambiguous: make(map[string]map[string]bool),
+	}
+}
+
+func (st *configLiveState) add(kind, name string, id int64, spec any) error {
+	m, err := toConfigMap(spec)
+	if err != nil {
+		return err
+	}
+	if st.objects[kind] == nil {
+		st.objects[kind] = make(map[string]*configLiveObject)
+		st.ambiguous[kind] = make(map[string]bool)
+	}
+	if _, dup := st.objects[kind][name]; dup {
+		st.ambiguous[kind][name] = true
+	}
+	st.objects[kind][name] = &configLiveObject{id: id, spec: m}
+	return nil
+}
+
+func (st *configLiveState) get(kind, name string) (*configLiveObject, error) {
+	if st.ambiguous[kind][name] {
+		return nil, infraerrors.Conflict(ErrConfigAmbiguousName.Reason,
+			fmt.Sprintf("%s/%s: multiple live resources share this name, rename them before managing by spec", kind, name))
+	}
+	return st.objects[kind][name], nil
+}
+
+// configRefs apply 阶段的名称 -> ID 映射（线上资源 + 本次新建）
+type configRefs map[string]map[string]int64
+
+func (r configRefs) set(kind, name string, id int64) {
+	if r[kind] == nil {
+		r[kind] = make(map[string]int64)
+	}
+	r[kind][name] = id
+}
+
+func (r configRefs) resolve(kind, name string) (int64, error) {
+	if id, ok := r[kind][name]; ok {
+		return id, nil
+	}
+	return 0, infraerrors.BadRequest(ErrConfigUnknownRef.Reason, fmt.Sprintf("unknown %s %q", kind, name))
+}
+
+func (r configRefs) resolveAll(kind string, names []string) ([]int64, error) {
+	ids := make([]int64, 0, len(names))
+	for _, name := range names {
+		id, err := r.resolve(kind, name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// configStep plan 中的一个可执行变更
+type configStep struct {
+	change ConfigChange
+	id     int64          // 线上 ID；新建时为 0
+	live   map[string]any // 线上完整状态；新建时为 nil
+	target map[string]any // live 与 desired 合并后的目标状态
+}
+
+// Plan 计算 spec 与线上状态的差异（敏感字段脱敏）
+func (s *ConfigAsCodeService) Plan(ctx context.Context, spec *ConfigSpec) (*ConfigPlan, error) {
+	plan, _, _, err := s.plan(ctx, spec)
+	return plan, err
+}
+
+// Apply 重新计算 plan 并按顺序执行；expectedHash 非空时要求与审阅过的 plan 一致。
+// 任一步失败会撤销此前已执行的步骤，并返回失败原因。
+func (s *ConfigAsCodeService) Apply(ctx context.Context, spec *ConfigSpec, expectedHash string) (result *ConfigApplyResult, err error) {
+	if s.lockService != nil {
+		lock, lockErr := s.lockService.Acquire(ctx, configApplyOperationKey)
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		defer func() {
+			reason := ""
+			if err != nil {
+				reason = err.Error()
+			}
+			_ = s.lockService.Release(context.WithoutCancel(ctx), lock, err == nil, reason)
+		}()
+	}
+
+	plan, steps, state, err := s.plan(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if expectedHash != "" && expectedHash != plan.Hash {
+		return nil, ErrConfigPlanStale
+	}
+
+	refs := configRefs{}
+	for kind, objects := range state.objects {
+		for name, obj := range objects {
+			if !state.ambiguous[kind][name] {
+				refs.set(kind, name, obj.id)
+			}
+		}
+	}
+
+	undo := make([]func(context.Context) error, 0, len(steps))
+	for _, step := range steps {
+		rollback, stepErr := s.applyStep(ctx, refs, state, step)
+		if stepErr != nil {
+			rolledBack, rollbackErrs := s.rollback(ctx, undo)
+			return nil, configApplyError(step, stepErr, rolledBack, rollbackErrs)
+		}
+		undo = append(undo, rollback)
+	}
+	if len(steps) > 0 {
+		logger.LegacyPrintf("service.config_as_code", "[ConfigAsCode] applied %d change(s), plan=%s", len(steps), plan.Hash)
+	}
+	return &ConfigApplyResult{Plan: plan, Applied: len(steps)}, nil
+}
+
+func (s *ConfigAsCodeService) rollback(ctx context.Context, undo []func(context.Context) error) (int, []string) {
+	rbCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), configRollbackTimeout)
+	defer cancel()
+	rolledBack := 0
+	var errs []string
+	for i := len(undo) - 1; i >= 0; i-- {
+		if err := undo[i](rbCtx); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		rolledBack++
+	}
+	if len(errs) > 0 {
+		logger.LegacyPrintf("service.config_as_code", "[ConfigAsCode] rollback incomplete: %s", strings.Join(errs, "; "))
+	}
+	return rolledBack, errs
+}
+
+func configApplyError(step *configStep, err error, rolledBack int, rollbackErrs []string) error {
+	code := http.StatusInternalServerError
+	msg := err.Error()
+	var appErr *infraerrors.ApplicationError
+	if errors.As(err, &appErr) {
+		code = int(appErr.Code)
+		msg = appErr.Message
+	}
+	message := fmt.Sprintf("%s %s/%s failed: %s (rolled back %d change(s))",
+		step.change.Action, step.change.Kind, step.change.Name, msg, rolledBack)
+	metadata := map[string]string{
+		"kind":        step.change.Kind,
+		"name":        step.change.Name,
+		"rolled_back": strconv.Itoa(rolledBack),
+	}
+	if len(rollbackErrs) > 0 {
+		message += fmt.Sprintf("; rollback incomplete: %s", strings.Join(rollbackErrs, "; "))
+		metadata["rollback_errors"] = strconv.Itoa(len(rollbackErrs))
+	}
+	return infraerrors.New(code, "CONFIG_APPLY_FAILED", message).WithMetadata(metadata).WithCause(err)
+}
+
+// ---------- plan ----------
+
+func (s *ConfigAsCodeService) plan(ctx context.Context, spec *ConfigSpec) (*ConfigPlan, []*configStep, *configLiveState, error) {
+	if spec == nil {
+		spec = &ConfigSpec{}
+	}
+	normalizeConfigSpec(spec)
+	state, err := s.loadLiveState(ctx, spec)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	p := &configPlanner{state: state, lookupEnv: s.lookupEnv, declared: map[string]map[string]bool{}}
+	for _, item := range spec.Proxies {
+		if err := p.add(ConfigKindProxy, item.Name, item, p.checkProxy(item)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, item := range spec.TLSFingerprintProfiles {
+		if err := p.add(ConfigKindTLSFingerprintProfile, item.Name, item, nil); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, item := range spec.Groups {
+		if err := p.add(ConfigKindGroup, item.Name, item, p.checkGroup(item)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, item := range spec.Accounts {
+		if err := p.add(ConfigKindAccount, item.Name, item, p.checkAccount(item)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, item := range spec.Channels {
+		if err := p.add(ConfigKindChannel, item.Name, item, p.checkChannel(item)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	for _, item := range spec.ErrorPassthroughRules {
+		if err := p.add(ConfigKindErrorPassthroughRule, item.Name, item, nil); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if len(spec.Settings) > 0 {
+		if err := p.addSettings(spec.Settings); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	changes := make([]ConfigChange, 0, len(p.steps))
+	for _, step := range p.steps {
+		changes = append(changes, step.change)
+	}
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sum := sha256.Sum256(raw)
+	plan := &ConfigPlan{
+		Hash:    hex.EncodeToString(sum[:]),
+		Changes: redactConfigChanges(changes),
+		Summary: p.summary,
+	}
+	return plan, p.steps, state, nil
+}
+
+// configPlanner 逐个资源对齐线上状态并生成变更步骤
+type configPlanner struct {
+	state     *configLiveState
+	lookupEnv func(string) (string, bool)
+	declared  map[string]map[string]bool
+	steps     []*configStep
+	summary   ConfigPlanSummary
+}
+
+// add 对齐一个资源；check 在解析 env 前执行引用与必填字段校验（isCreate 由 add 传入）
+func (p *configPlanner) add(kind, name string, item any, check func(isCreate bool) error) error {
+	if strings.TrimSpace(name) == "" {
+		return configSpecError("%s: name is required", kind)
+	}
+	if p.declared[kind][name] {
+		return configSpecError("%s/%s: declared more than once", kind, name)
+	}
+	live, err := p.state.get(kind, name)
+	if err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(live == nil); err != nil {
+			return err
+		}
+	}
+	desired, err := toConfigMap(item)
+	if err != nil {
+		return err
+	}
+	if err := resolveConfigEnvRefs(kind+"/"+name, desired, p.lookupEnv); err != nil {
+		return err
+	}
+	if p.declared[kind] == nil {
+		p.declared[kind] = make(map[string]bool)
+	}
+	p.declared[kind][name] = true
+
+	if live == nil {
+		p.steps = append(p.steps, &configStep{
+			change: ConfigChange{Kind: kind, Name: name, Action: ConfigChangeActionCreate, Fields: diffConfigMaps("", desired, nil)},
+			target: desired,
+		})
+		p.summary.Create++
+		return nil
+	}
+	fields := diffConfigMaps("", desired, live.spec)
+	if len(fields) == 0 {
+		p.summary.Unchanged++
+		return nil
+	}
+	p.steps = append(p.steps, &configStep{
+		change: ConfigChange{Kind: kind, Name: name, Action: ConfigChangeActionUpdate, Fields: fields},
+		id:     live.id,
+		live:   live.spec,
+		target: mergeConfigMaps(live.spec, desired),
+	})
+	p.summary.Update++
+	return nil
+}
+
+func (p *configPlanner) addSettings(settings map[string]any) error {
+	if p.state.settings == nil {
+		return configSpecError("settings: setting service unavailable")
+	}
+	fields := configSettingFields()
+	for key := range settings {
+		if _, ok := fields[key]; !ok {
+			return configSpecError("settings: unknown setting %q", key)
+		}
+	}
+	desired, err := toConfigMap(settings)
+	if err != nil {
+		return err
+	}
+	if err := resolveConfigEnvRefs(ConfigKindSettings, desired, p.lookupEnv); err != nil {
+		return err
+	}
+	live, err := settingsToConfigMap(p.state.settings)
+	if err != nil {
+		return err
+	}
+	changes := diffConfigMaps("", desired, live)
+	if len(changes) == 0 {
+		p.summary.Unchanged++
+		return nil
+	}
+	p.steps = append(p.steps, &configStep{
+		change: ConfigChange{Kind: ConfigKindSettings, Name: configSettingsResourceName, Action: ConfigChangeActionUpdate, Fields: changes},
+		live:   live,
+		target: mergeConfigMaps(live, desired),
+	})
+	p.summary.Update++
+	return nil
+}
+
+// refExists 引用须指向线上资源或本文件中已声明（且先于引用方执行）的资源
+func (p *configPlanner) refExists(owner, kind, name string) error {
+	if p.declared[kind][name] {
+		return nil
+	}
+	obj, err := p.state.get(kind, name)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return infraerrors.BadRequest(ErrConfigUnknownRef.Reason,
+			fmt.Sprintf("%s: unknown %s %q (must exist or be declared earlier in the spec)", owner, kind, name))
+	}
+	return nil
+}
+
+func (p *configPlanner) checkProxy(item ConfigProxySpec) func(bool) error {
+	return func(isCreate bool) error {
+		if isCreate && (item.Protocol == nil || item.Host == nil || item.Port == nil) {
+			return configSpecError("%s/%s: protocol, host and port are required to create a proxy", ConfigKindProxy, item.Name)
+		}
+		return nil
+	}
+}
+
+func (p *configPlanner) checkGroup(item ConfigGroupSpec) func(bool) error {
+	return func(isCreate bool) error {
+		owner := ConfigKindGroup + "/" + item.Name
+		if item.FallbackGroup != nil && *item.FallbackGroup != "" {
+			if *item.FallbackGroup == item.Name {
+				return configSpecError("%s: fallback_group cannot reference itself", owner)
+			}
+			return p.refExists(owner, ConfigKindGroup, *item.FallbackGroup)
+		}
+		return nil
+	}
+}
+
+func (p *configPlanner) checkAccount(item ConfigAccountSpec) func(bool) error {
+	return func(isCreate bool) error {
+		owner := ConfigKindAccount + "/" + item.Name
+		if isCreate && (item.Platform == nil || item.Type == nil || len(item.Credentials) == 0) {
+			return configSpecError("%s: platform, type and credentials are required to create an account", owner)
+		}
+		if item.Proxy != nil && *item.Proxy != "" {
+			if err := p.refExists(owner, ConfigKindProxy, *item.Proxy); err != nil {
+				return err
+			}
+		}
+		if item.Groups != nil {
+			for _, g := range *item.Groups {
+				if err := p.refExists(owner, ConfigKindGroup, g); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func (p *configPlanner) checkChannel(item ConfigChannelSpec) func(bool) error {
+	return func(isCreate bool) error {
+		owner := ConfigKindChannel + "/" + item.Name
+		if item.Groups != nil {
+			for _, g := range *item.Groups {
+				if err := p.refExists(owner, ConfigKindGroup, g); err != nil {
+					return err
+				}
+			}
+		}
+		if item.AccountStatsPricingRules != nil {
+			for i, rule := range *item.AccountStatsPricingRules {
+				if len(rule.Groups) == 0 && len(rule.Accounts) == 0 {
+					return configSpecError("%s: account_stats_pricing_rules[%d] must have at least one group or account", owner, i)
+				}
+				for _, g := range rule.Groups {
+					if err := p.refExists(owner, ConfigKindGroup, g); err != nil {
+						return err
+					}
+				}
+				for _, a := range rule.Accounts {
+					if err := p.refExists(owner, ConfigKindAccount, a); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// normalizeConfigSpec 补齐与后台一致的默认值，避免未写出的默认值在每次 plan 中反复出现差异
+func normalizeConfigSpec(spec *ConfigSpec) {
+	for i := range spec.Channels {
+		ch := &spec.Channels[i]
+		if ch.ModelPricing != nil {
+			normalizeConfigPricing(*ch.ModelPricing, PlatformAnthropic)
+		}
+		if ch.AccountStatsPricingRules != nil {
+			for j := range *ch.AccountStatsPricingRules {
+				normalizeConfigPricing((*ch.AccountStatsPricingRules)[j].Pricing, "")
+			}
+		}
+	}
+}
+
+func normalizeConfigPricing(pricing []ConfigModelPricingSpec, defaultPlatform string) {
+	for i := range pricing {
+		if pricing[i].BillingMode == "" {
+			pricing[i].BillingMode = string(BillingModeToken)
+		}
+		if pricing[i].Platform == "" {
+			pricing[i].Platform = defaultPlatform
+		}
+		if pricing[i].Models == nil {
+			pricing[i].Models = []string{}
+		}
+	}
+}
+
+// ---------- 线上状态 ----------
+
+func (s *ConfigAsCodeService) loadLiveState(ctx context.Context, spec *ConfigSpec) (*configLiveState, error) {
+	st := newConfigLiveState()
+	needProxies := len(spec.Proxies) > 0 || len(spec.Accounts) > 0
+	needGroups := len(spec.Groups) > 0 || len(spec.Accounts) > 0 || len(spec.Channels) > 0
+	needAccounts := len(spec.Accounts) > 0 || len(spec.Channels) > 0
+
+	proxyNames := map[int64]string{}
+	if needProxies {
+		proxies, err := s.listAllProxies(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list proxies: %w", err)
+		}
+		for i := range proxies {
+			proxyNames[proxies[i].ID] = proxies[i].Name
+			if err := st.add(ConfigKindProxy, proxies[i].Name, proxies[i].ID, proxyToConfigSpec(&proxies[i])); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(spec.TLSFingerprintProfiles) > 0 {
+		if s.tlsProfiles == nil {
+			return nil, configSpecError("tls_fingerprint_profiles: service unavailable")
+		}
+		profiles, err := s.tlsProfiles.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list tls fingerprint profiles: %w", err)
+		}
+		for _, profile := range profiles {
+			if err := st.add(ConfigKindTLSFingerprintProfile, profile.Name, profile.ID, tlsProfileToConfigSpec(profile)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	groupNames := map[int64]string{}
+	if needGroups {
+		groups, err := s.listAllGroups(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list groups: %w", err)
+		}
+		for i := range groups {
+			groupNames[groups[i].ID] = groups[i].Name
+		}
+		for i := range groups {
+			if err := st.add(ConfigKindGroup, groups[i].Name, groups[i].ID, groupToConfigSpec(&groups[i], groupNames)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	accountNames := map[int64]string{}
+	if needAccounts {
+		accounts, err := s.listAllAccounts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list accounts: %w", err)
+		}
+		for i := range accounts {
+			accountNames[accounts[i].ID] = accounts[i].Name
+			if err := st.add(ConfigKindAccount, accounts[i].Name, accounts[i].ID, accountToConfigSpec(&accounts[i], proxyNames, groupNames)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(spec.Channels) > 0 {
+		if s.channels == nil {
+			return nil, configSpecError("channels: service unavailable")
+		}
+		channels, err := s.listAllChannels(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list channels: %w", err)
+		}
+		for i := range channels {
+			if err := st.add(ConfigKindChannel, channels[i].Name, channels[i].ID, channelToConfigSpec(&channels[i], groupNames, accountNames)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(spec.ErrorPassthroughRules) > 0 {
+		if s.errorRules == nil {
+			return nil, configSpecError("error_passthrough_rules: service unavailable")
+		}
+		rules, err := s.errorRules.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list error passthrough rules: %w", err)
+		}
+		for _, rule := range rules {
+			if err := st.add(ConfigKindErrorPassthroughRule, rule.Name, rule.ID, errorRuleToConfigSpec(rule)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(spec.Settings) > 0 && s.settings != nil {
+		settings, err := s.settings.GetAllSettings(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get settings: %w", err)
+		}
+		st.settings = settings
+	}
+	return st, nil
+}
+
+func (s *ConfigAsCodeService) listAllProxies(ctx context.Context) ([]Proxy, error) {
+	var out []Proxy
+	for page := 1; ; page++ {
+		items, total, err := s.adminService.ListProxies(ctx, page, configListPageSize, "", "", "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+		if len(items) == 0 || int64(len(out)) >= total {
+			return out, nil
+		}
+	}
+}
+
+func (s *ConfigAsCodeService) listAllGroups(ctx context.Context) ([]Group, error) {
+	var out []Group
+	for page := 1; ; page++ {
+		items, total, err := s.adminService.ListGroups(ctx, page, configListPageSize, "", "", "", nil, "", "")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+		if len(items) == 0 || int64(len(out)) >= total {
+			return out, nil
+		}
+	}
+}
+
+func (s *ConfigAsCodeService) listAllAccounts(ctx context.Context) ([]Account, error) {
+	var out []Account
+	for page := 1; ; page++ {
+		items, total, err := s.adminService.ListAccounts(ctx, page, configListPageSize, "", "", "", "", 0, "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+		if len(items) == 0 || int64(len(out)) >= total {
+			return out, nil
+		}
+	}
+}
+
+func (s *ConfigAsCodeService) listAllChannels(ctx context.Context) ([]Channel, error) {
+	var out []Channel
+	for page := 1; ; page++ {
+		items, result, err := s.channels.List(ctx, pagination.PaginationParams{Page: page, PageSize: configListPageSize}, "", "")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+		if len(items) == 0 || result == nil || int64(len(out)) >= result.Total {
+			return out, nil
+		}
+	}
+}
+
+// ---------- apply ----------
+
+func (s *ConfigAsCodeService) applyStep(ctx context.Context, refs configRefs, state *configLiveState, step *configStep) (func(context.Context) error, error) {
+	switch step.change.Kind {
+	case ConfigKindProxy:
+		return s.applyProxy(ctx, refs, step)
+	case ConfigKindTLSFingerprintProfile:
+		return s.applyTLSProfile(ctx, refs, step)
+	case ConfigKindGroup:
+		return s.applyGroup(ctx, refs, step)
+	case ConfigKindAccount:
+		return s.applyAccount(ctx, refs, step)
+	case ConfigKindChannel:
+		return s.applyChannel(ctx, refs, step)
+	case ConfigKindErrorPassthroughRule:
+		return s.applyErrorRule(ctx, refs, step)
+	case ConfigKindSettings:
+		return s.applySettings(ctx, state, step)
+	}
+	return nil, fmt.Errorf("unsupported config kind %q", step.change.Kind)
+}
+
+func (s *ConfigAsCodeService) applyProxy(ctx context.Context, refs configRefs, step *configStep) (func(context.Context) error, error) {
+	var target ConfigProxySpec
+	if err := fromConfigMap(step.target, &target); err != nil {
+		return nil, err
+	}
+	if step.live == nil {
+		proxy, err := s.adminService.CreateProxy(ctx, &CreateProxyInput{
+			Name:     target.Name,
+			Protocol: derefString(target.Protocol),
+			Host:     derefString(target.Host),
+			Port:     derefInt(target.Port),
+			Username: derefString(target.Username),
+			Password: derefString(target.Password),
+		})
+		if err != nil {
+			return nil, err
+		}
+		refs.set(ConfigKindProxy, target.Name, proxy.ID)
+		undo := func(ctx context.Context) error { return s.adminService.DeleteProxy(ctx, proxy.ID) }
+		if status := derefString(target.Status); status != "" && status != proxy.Status {
+			if _, err := s.adminService.UpdateProxy(ctx, proxy.ID, &UpdateProxyInput{Status: status}); err != nil {
+				_ = undo(context.WithoutCancel(ctx))
+				return nil, err
+			}
+		}
+		return undo, nil
+	}
+
+	var live ConfigProxySpec
+	if err := fromConfigMap(step.live, &live); err != nil {
+		return nil, err
+	}
+	if _, err := s.adminService.UpdateProxy(ctx, step.id, configProxyUpdateInput(&target)); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		_, err := s.adminService.UpdateProxy(ctx, step.id, configProxyUpdateInput(&live))
+		return err
+	}, nil
+}
+
+func configProxyUpdateInput(spec *ConfigProxySpec) *UpdateProxyInput {
+	return &UpdateProxyInput{
+		Name:     spec.Name,
+		Protocol: derefString(spec.Protocol),
+		Host:     derefString(spec.Host),
+		Port:     derefInt(spec.Port),
+		Username: derefString(spec.Username),
+		Password: derefString(spec.Password),
+		Status:   derefString(spec.Status),
+	}
+}
+
+func (s *ConfigAsCodeService) applyTLSProfile(ctx context.Context, refs configRefs, step *configStep) (func(context.Context) error, error) {
+	var target ConfigTLSProfileSpec
+	if err := fromConfigMap(step.target, &target); err != nil {
+		return nil, err
+	}
+	if step.live == nil {
+		created, err := s.tlsProfiles.Create(ctx, configTLSProfileModel(&target, 0))
+		if err != nil {
+			return nil, err
+		}
+		refs.set(ConfigKindTLSFingerprintProfile, target.Name, created.ID)
+		return func(ctx context.Context) error { return s.tlsProfiles.Delete(ctx, created.ID) }, nil
+	}
+
+	var live ConfigTLSProfileSpec
+	if err := fromConfigMap(step.live, &live); err != nil {
+		return nil, err
+	}
+	if _, err := s.tlsProfiles.Update(ctx, configTLSProfileModel(&target, step.id)); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		_, err := s.tlsProfiles.Update(ctx, configTLSProfileModel(&live, step.id))
+		return err
+	}, nil
+}
+
+func configTLSProfileModel(spec *ConfigTLSProfileSpec, id int64) *model.TLSFingerprintProfile {
+	return &model.TLSFingerprintProfile{
+		ID:                  id,
+		Name:                spec.Name,
+		Description:         spec.Description,
+		EnableGREASE:        spec.EnableGREASE != nil && *spec.EnableGREASE,
+		CipherSuites:        derefSlice(spec.CipherSuites),
+		Curves:              derefSlice(spec.Curves),
+		PointFormats:        derefSlice(spec.PointFormats),
+		SignatureAlgorithms: derefSlice(spec.SignatureAlgorithms),
+		ALPNProtocols:       derefSlice(spec.ALPNProtocols),
+		SupportedVersions:   derefSlice(spec.SupportedVersions),
+		KeyShareGroups:      derefSlice(spec.KeyShareGroups),
+		PSKModes:            derefSlice(spec.PSKModes),
+		Extensions:          derefSlice(spec.Extensions),
+	}
+}
+
+func (s *ConfigAsCodeService) applyGroup(ctx context.Context, refs configRefs, step *configStep) (func(context.Context) error, error) {
+	var target ConfigGroupSpec
+	if err := fromConfigMap(step.target, &target); err != nil {
+		return nil, err
+	}
+	if step.live == nil {
+		input := &CreateGroupInput{
+			Name:             target.Name,
+			Description:      derefString(target.Description),
+			Platform:         derefString(target.Platform),
+			RateMultiplier:   1,
+			IsExclusive:      target.IsExclusive != nil && *target.IsExclusive,
+			SubscriptionType: derefString(target.SubscriptionType),
+			DailyLimitUSD:    target.DailyLimitUSD,
+			WeeklyLimitUSD:   target.WeeklyLimitUSD,
+			MonthlyLimitUSD:  target.MonthlyLimitUSD,
+			ClaudeCodeOnly:   target.ClaudeCodeOnly != nil && *target.ClaudeCodeOnly,
+		}
+		if target.RateMultiplier != nil {
+			input.RateMultiplier = *target.RateMultiplier
+		}
+		if target.FallbackGroup != nil && *target.FallbackGroup != "" {
+			id, err := refs.resolve(ConfigKindGroup, *target.FallbackGroup)
+			if err != nil {
+				return nil, err
+			}
+			input.FallbackGroupID = &id
+		}
+		group, err := s.adminService.CreateGroup(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		refs.set(ConfigKindGroup, target.Name, group.ID)
+		undo := func(ctx context.Context) error { return s.adminService.DeleteGroup(ctx, group.ID) }
+		if status := derefString(target.Status); status != "" && status != group.Status {
+			if _, err := s.adminService.UpdateGroup(ctx, group.ID, &UpdateGroupInput{Status: status}); err != nil {
+				_ = undo(context.WithoutCancel(ctx))
+				return nil, err
+			}
+		}
+		return undo, nil
+	}
+
+	var live ConfigGroupSpec
+	if err := fromConfigMap(step.live, &live); err != nil {
+		return nil, err
+	}
+	input, err := configGroupUpdateInput(&target, refs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.adminService.UpdateGroup(ctx, step.id, input); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		restore, err := configGroupUpdateInput(&live, refs)
+		if err != nil {
+			return err
+		}
+		_, err = s.adminService.UpdateGroup(ctx, step.id, restore)
+		return err
+	}, nil
+}
+
+func configGroupUpdateInput(spec *ConfigGroupSpec, refs configRefs) (*UpdateGroupInput, error) {
+	input := &UpdateGroupInput{
+		Name:             spec.Name,
+		Description:      derefString(spec.Description),
+		Platform:         derefString(spec.Platform),
+		RateMultiplier:   spec.RateMultiplier,
+		IsExclusive:      spec.IsExclusive,
+		Status:           derefString(spec.Status),
+		SubscriptionType: derefString(spec.SubscriptionType),
+		DailyLimitUSD:    spec.DailyLimitUSD,
+		WeeklyLimitUSD:   spec.WeeklyLimitUSD,
+		MonthlyLimitUSD:  spec.MonthlyLimitUSD,
+		ClaudeCodeOnly:   spec.ClaudeCodeOnly,
+	}
+	if spec.FallbackGroup != nil {
+		var id int64 // 0 表示清除降级分组
+		if *spec.FallbackGroup != "" {
+			resolved, err := refs.resolve(ConfigKindGroup, *spec.FallbackGroup)
+			if err != nil {
+				return nil, err
+			}
+			id = resolved
+		}
+		input.FallbackGroupID = &id
+	}
+	return input, nil
+}
+
+func (s *ConfigAsCodeService) applyAccount(ctx context.Context, refs configRefs, step *configStep) (func(context.Context) error, error) {
+	var target ConfigAccountSpec
+	if err := fromConfigMap(step.target, &target); err != nil {
+		return nil, err
+	}
+	if step.live == nil {
+		input := &CreateAccountInput{
+			Name:           target.Name,
+			Notes:          target.Notes,
+			Platform:       derefString(target.Platform),
+			Type:           derefString(target.Type),
+			Credentials:    target.Credentials,
+			Extra:          target.Extra,
+			Concurrency:    derefInt(target.Concurrency),
+			Priority:       derefInt(target.Priority),
+			RateMultiplier: target.RateMultiplier,
+		}
+		if target.Proxy != nil && *target.Proxy != "" {
+			id, err := refs.resolve(ConfigKindProxy, *target.Proxy)
+			if err != nil {
+				return nil, err
+			}
+			input.ProxyID = &id
+		}
+		if target.Groups != nil {
+			ids, err := refs.resolveAll(ConfigKindGroup, *target.Groups)
+			if err != nil {
+				return nil, err
+			}
+			input.GroupIDs = ids
+			input.SkipDefaultGroupBind = true
+		}
+		account, err := s.adminService.CreateAccount(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		refs.set(ConfigKindAccount, target.Name, account.ID)
+		undo := func(ctx context.Context) error { return s.adminService.DeleteAccount(ctx, account.ID) }
+		if status := derefString(target.Status); status != "" && status != account.Status {
+			if _, err := s.adminService.UpdateAccount(ctx, account.ID, &UpdateAccountInput{Status: status}); err != nil {
+				_ = undo(context.WithoutCancel(ctx))
+				return nil, err
+			}
+		}
+		return undo, nil
+	}
+
+	var live ConfigAccountSpec
+	if err := fromConfigMap(step.live, &live); err != nil {
+		return nil, err
+	}
+	input, err := configAccountUpdateInput(&target, refs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.adminService.UpdateAccount(ctx, step.id, input); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		restore, err := configAccountUpdateInput(&live, refs)
+		if err != nil {
+			return err
+		}
+		_, err = s.adminService.UpdateAccount(ctx, step.id, restore)
+		return err
+	}, nil
+}
+
+func configAccountUpdateInput(spec *ConfigAccountSpec, refs configRefs) (*UpdateAccountInput, error) {
+	input := &UpdateAccountInput{
+		Name:           spec.Name,
+		Notes:          spec.Notes,
+		Type:           derefString(spec.Type),
+		Credentials:    spec.Credentials,
+		Extra:          spec.Extra,
+		Concurrency:    spec.Concurrency,
+		Priority:       spec.Priority,
+		RateMultiplier: spec.RateMultiplier,
+		Status:         derefString(spec.Status),
+	}
+	if spec.Proxy != nil {
+		var id int64 // 0 表示解除代理
+		if *spec.Proxy != "" {
+			resolved, err := refs.resolve(ConfigKindProxy, *spec.Proxy)
+			if err != nil {
+				return nil, err
+			}
+			id = resolved
+		}
+		input.ProxyID = &id
+	}
+	if spec.Groups != nil {
+		ids, err := refs.resolveAll(ConfigKindGroup, *spec.Groups)
+		if err != nil {
+			return nil, err
+		}
+		input.GroupIDs = &ids
+	}
+	return input, nil
+}
+
+func (s *ConfigAsCodeService) applyChannel(ctx context.Context, refs configRefs, step *configStep) (func(context.Context) error, error) {
+	var target ConfigChannelSpec
+	if err := fromConfigMap(step.target, &target); err != nil {
+		return nil, err
+	}
+	if step.live == nil {
+		input := &CreateChannelInput{
+			Name:                       target.Name,
+			Description:                derefString(target.Description),
+			ModelMapping:               target.ModelMapping,
+			BillingModelSource:         derefString(target.BillingModelSource),
+			RestrictModels:             target.RestrictModels != nil && *target.RestrictModels,
+			ApplyPricingToAccountStats: target.ApplyPricingToAccountStats != nil && *target.ApplyPricingToAccountStats,
+		}
+		if target.Groups != nil {
+			ids, err := refs.resolveAll(ConfigKindGroup, *target.Groups)
+			if err != nil {
+				return nil, err
+			}
+			input.GroupIDs = ids
+		}
+		if target.ModelPricing != nil {
+			input.ModelPricing = configPricingToService(*target.ModelPricing)
+		}
+		if target.AccountStatsPricingRules != nil {
+			rules, err := configStatsRulesToService(*target.AccountStatsPricingRules, refs)
+			if err != nil {
+				return nil, err
+			}
+			input.AccountStatsPricingRules = rules
+		}
+		channel, err := s.channels.Create(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		refs.set(ConfigKindChannel, target.Name, channel.ID)
+		undo := func(ctx context.Context) error { return s.channels.Delete(ctx, channel.ID) }
+		if status := derefString(target.Status); status != "" && status != channel.Status {
+			if _, err := s.channels.Update(ctx, channel.ID, &UpdateChannelInput{Status: status}); err != nil {
+				_ = undo(context.WithoutCancel(ctx))
+				return nil, err
+			}
+		}
+		return undo, nil
+	}
+
+	var live ConfigChannelSpec
+	if err := fromConfigMap(step.live, &live); err != nil {
+		return nil, err
+	}
+	input, err := configChannelUpdateInput(&target, refs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.channels.Update(ctx, step.id, input); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		restore, err := configChannelUpdateInput(&live, refs)
+		if err != nil {
+			return err
+		}
+		_, err = s.channels.Update(ctx, step.id, restore)
+		return err
+	}, nil
+}
+
+func configChannelUpdateInput(spec *ConfigChannelSpec, refs configRefs) (*UpdateChannelInput, error) {
+	input := &UpdateChannelInput{
+		Name:                       spec.Name,
+		Description:                spec.Description,
+		Status:                     derefString(spec.Status),
+		ModelMapping:               spec.ModelMapping,
+		BillingModelSource:         derefString(spec.BillingModelSource),
+		RestrictModels:             spec.RestrictModels,
+		ApplyPricingToAccountStats: spec.ApplyPricingToAccountStats,
+	}
+	if spec.Groups != nil {
+		ids, err := refs.resolveAll(ConfigKindGroup, *spec.Groups)
+		if err != nil {
+			return nil, err
+		}
+		input.GroupIDs = &ids
+	}
+	if spec.ModelPricing != nil {
+		pricing := configPricingToService(*spec.ModelPricing)
+		input.ModelPricing = &pricing
+	}
+	if spec.AccountStatsPricingRules != nil {
+		rules, err := configStatsRulesToService(*spec.AccountStatsPricingRules, refs)
+		if err != nil {
+			return nil, err
+		}
+		input.AccountStatsPricingRules = &rules
+	}
+	return input, nil
+}
+
+func configPricingToService(specs []ConfigModelPricingSpec) []ChannelModelPricing {
+	out := make([]ChannelModelPricing, 0, len(specs))
+	for _, p := range specs {
+		intervals := make([]PricingInterval, 0, len(p.Intervals))
+		for _, iv := range p.Intervals {
+			intervals = append(intervals, PricingInterval{
+				MinTokens:       iv.MinTokens,
+				MaxTokens:       iv.MaxTokens,
+				TierLabel:       iv.TierLabel,
+				InputPrice:      iv.InputPrice,
+				OutputPrice:     iv.OutputPrice,
+				CacheWritePrice: iv.CacheWritePrice,
+				CacheReadPrice:  iv.CacheReadPrice,
+				PerRequestPrice: iv.PerRequestPrice,
+				SortOrder:       iv.SortOrder,
+			})
+		}
+		out = append(out, ChannelModelPricing{
+			Platform:         p.Platform,
+			Models:           p.Models,
+			BillingMode:      BillingMode(p.BillingMode),
+			InputPrice:       p.InputPrice,
+			OutputPrice:      p.OutputPrice,
+			CacheWritePrice:  p.CacheWritePrice,
+			CacheReadPrice:   p.CacheReadPrice,
+			ImageOutputPrice: p.ImageOutputPrice,
+			PerRequestPrice:  p.PerRequestPrice,
+			Intervals:        intervals,
+		})
+	}
+	return out
+}
+
+func configStatsRulesToService(specs []ConfigAccountStatsPricingRuleSpec, refs configRefs) ([]AccountStatsPricingRule, error) {
+	out := make([]AccountStatsPricingRule, 0, len(specs))
+	for i, r := range specs {
+		groupIDs, err := refs.resolveAll(ConfigKindGroup, r.Groups)
+		if err != nil {
+			return nil, err
+		}
+		accountIDs, err := refs.resolveAll(ConfigKindAccount, r.Accounts)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, AccountStatsPricingRule{
+			Name:       r.Name,
+			GroupIDs:   groupIDs,
+			AccountIDs: accountIDs,
+			SortOrder:  i,
+			Pricing:    configPricingToService(r.Pricing),
+		})
+	}
+	return out, nil
+}
+
+func (s *ConfigAsCodeService) applyErrorRule(ctx context.Context, refs configRefs, step *configStep) (func(context.Context) error, error) {
+	var target ConfigErrorPassthroughRuleSpec
+	if err := fromConfigMap(step.target, &target); err != nil {
+		return nil, err
+	}
+	if step.live == nil {
+		rule := configErrorRuleModel(&target, 0)
+		if target.Enabled == nil {
+			rule.Enabled = true
+		}
+		if target.MatchMode == nil {
+			rule.MatchMode = model.MatchModeAny
+		}
+		created, err := s.errorRules.Create(ctx, rule)
+		if err != nil {
+			return nil, err
+		}
+		refs.set(ConfigKindErrorPassthroughRule, target.Name, created.ID)
+		return func(ctx context.Context) error { return s.errorRules.Delete(ctx, created.ID) }, nil
+	}
+
+	var live ConfigErrorPassthroughRuleSpec
+	if err := fromConfigMap(step.live, &live); err != nil {
+		return nil, err
+	}
+	if _, err := s.errorRules.Update(ctx, configErrorRuleModel(&target, step.id)); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		_, err := s.errorRules.Update(ctx, configErrorRuleModel(&live, step.id))
+		return err
+	}, nil
+}
+
+func configErrorRuleModel(spec *ConfigErrorPassthroughRuleSpec, id int64) *model.ErrorPassthroughRule {
+	return &model.ErrorPassthroughRule{
+		ID:              id,
+		Name:            spec.Name,
+		Enabled:         spec.Enabled != nil && *spec.Enabled,
+		Priority:        derefInt(spec.Priority),
+		ErrorCodes:      derefSlice(spec.ErrorCodes),
+		Keywords:        derefSlice(spec.Keywords),
+		MatchMode:       derefString(spec.MatchMode),
+		Platforms:       derefSlice(spec.Platforms),
+		PassthroughCode: spec.PassthroughCode != nil && *spec.PassthroughCode,
+		ResponseCode:    spec.ResponseCode,
+		PassthroughBody: spec.PassthroughBody != nil && *spec.PassthroughBody,
+		CustomMessage:   spec.CustomMessage,
+		SkipMonitoring:  spec.SkipMonitoring != nil && *spec.SkipMonitoring,
+		Description:     spec.Description,
+	}
+}
+
+func (s *ConfigAsCodeService) applySettings(ctx context.Context, state *configLiveState, step *configStep) (func(context.Context) error, error) {
+	target := *state.settings
+	if err := configMapToSettings(step.target, &target); err != nil {
+		return nil, err
+	}
+	if err := s.settings.UpdateSettings(ctx, &target); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		restore := *state.settings
+		return s.settings.UpdateSettings(ctx, &restore)
+	}, nil
+}
+
+// ---------- 线上对象 -> spec ----------
+
+func proxyToConfigSpec(p *Proxy) ConfigProxySpec {
+	return ConfigProxySpec{
+		Name:     p.Name,
+		Protocol: configPtr(p.Protocol),
+		Host:     configPtr(p.Host),
+		Port:     configPtr(p.Port),
+		Username: configPtr(p.Username),
+		Password: configPtr(p.Password),
+		Status:   configPtr(p.Status),
+	}
+}
+
+func tlsProfileToConfigSpec(p *model.TLSFingerprintProfile) ConfigTLSProfileSpec {
+	description := ""
+	if p.Description != nil {
+		description = *p.Description
+	}
+	return ConfigTLSProfileSpec{
+		Name:                p.Name,
+		Description:         &description,
+		EnableGREASE:        configPtr(p.EnableGREASE),
+		CipherSuites:        configSlicePtr(p.CipherSuites),
+		Curves:              configSlicePtr(p.Curves),
+		PointFormats:        configSlicePtr(p.PointFormats),
+		SignatureAlgorithms: configSlicePtr(p.SignatureAlgorithms),
+		ALPNProtocols:       configSlicePtr(p.ALPNProtocols),
+		SupportedVersions:   configSlicePtr(p.SupportedVersions),
+		KeyShareGroups:      configSlicePtr(p.KeyShareGroups),
+		PSKModes:            configSlicePtr(p.PSKModes),
+		Extensions:          configSlicePtr(p.Extensions),
+	}
+}
+
+func groupToConfigSpec(g *Group, groupNames map[int64]string) ConfigGroupSpec {
+	fallback := ""
+	if g.FallbackGroupID != nil {
+		fallback = groupNames[*g.FallbackGroupID]
+	}
+	return ConfigGroupSpec{
+		Name:             g.Name,
+		Description:      configPtr(g.Description),
+		Platform:         configPtr(g.Platform),
+		RateMultiplier:   configPtr(g.RateMultiplier),
+		IsExclusive:      configPtr(g.IsExclusive),
+		Status:           configPtr(g.Status),
+		SubscriptionType: configPtr(g.SubscriptionType),
+		DailyLimitUSD:    g.DailyLimitUSD,
+		WeeklyLimitUSD:   g.WeeklyLimitUSD,
+		MonthlyLimitUSD:  g.MonthlyLimitUSD,
+		ClaudeCodeOnly:   configPtr(g.ClaudeCodeOnly),
+		FallbackGroup:    &fallback,
+	}
+}
+
+func accountToConfigSpec(a *Account, proxyNames, groupNames map[int64]string) ConfigAccountSpec {
+	proxy := ""
+	if a.ProxyID != nil {
+		proxy = proxyNames[*a.ProxyID]
+	}
+	groups := make([]string, 0, len(a.GroupIDs))
+	for _, id := range a.GroupIDs {
+		groups = append(groups, groupNames[id])
+	}
+	notes := ""
+	if a.Notes != nil {
+		notes = *a.Notes
+	}
+	return ConfigAccountSpec{
+		Name:           a.Name,
+		Platform:       configPtr(a.Platform),
+		Type:           configPtr(a.Type),
+		Notes:          &notes,
+		Credentials:    a.Credentials,
+		Extra:          a.Extra,
+		Proxy:          &proxy,
+		Concurrency:    configPtr(a.Concurrency),
+		Priority:       configPtr(a.Priority),
+		RateMultiplier: configPtr(a.BillingRateMultiplier()),
+		Status:         configPtr(a.Status),
+		Groups:         &groups,
+	}
+}
+
+func channelToConfigSpec(c *Channel, groupNames, accountNames map[int64]string) ConfigChannelSpec {
+	groups := make([]string, 0, len(c.GroupIDs))
+	for _, id := range c.GroupIDs {
+		groups = append(groups, groupNames[id])
+	}
+	pricing := serviceToConfigPricing(c.ModelPricing, PlatformAnthropic)
+	rules := make([]ConfigAccountStatsPricingRuleSpec, 0, len(c.AccountStatsPricingRules))
+	for _, r := range c.AccountStatsPricingRules {
+		rule := ConfigAccountStatsPricingRuleSpec{Name: r.Name, Pricing: serviceToConfigPricing(r.Pricing, "")}
+		for _, id := range r.GroupIDs {
+			rule.Groups = append(rule.Groups, groupNames[id])
+		}
+		for _, id := range r.AccountIDs {
+			rule.Accounts = append(rule.Accounts, accountNames[id])
+		}
+		rules = append(rules, rule)
+	}
+	return ConfigChannelSpec{
+		Name:                       c.Name,
+		Description:                configPtr(c.Description),
+		Status:                     configPtr(c.Status),
+		BillingModelSource:         configPtr(c.BillingModelSource),
+		RestrictModels:             configPtr(c.RestrictModels),
+		Groups:                     &groups,
+		ModelPricing:               &pricing,
+		ModelMapping:               c.ModelMapping,
+		ApplyPricingToAccountStats: configPtr(c.ApplyPricingToAccountStats),
+		AccountStatsPricingRules:   &rules,
+	}
+}
+
+func serviceToConfigPricing(pricing []ChannelModelPricing, defaultPlatform string) []ConfigModelPricingSpec {
+	out := make([]ConfigModelPricingSpec, 0, len(pricing))
+	for _, p := range pricing {
+		spec := ConfigModelPricingSpec{
+			Platform:         p.Platform,
+			Models:           p.Models,
+			BillingMode:      string(p.BillingMode),
+			InputPrice:       p.InputPrice,
+			OutputPrice:      p.OutputPrice,
+			CacheWritePrice:  p.CacheWritePrice,
+			CacheReadPrice:   p.CacheReadPrice,
+			ImageOutputPrice: p.ImageOutputPrice,
+			PerRequestPrice:  p.PerRequestPrice,
+		}
+		for _, iv := range p.Intervals {
+			spec.Intervals = append(spec.Intervals, ConfigPricingIntervalSpec{
+				MinTokens:       iv.MinTokens,
+				MaxTokens:       iv.MaxTokens,
+				TierLabel:       iv.TierLabel,
+				InputPrice:      iv.InputPrice,
+				OutputPrice:     iv.OutputPrice,
+				CacheWritePrice: iv.CacheWritePrice,
+				CacheReadPrice:  iv.CacheReadPrice,
+				PerRequestPrice: iv.PerRequestPrice,
+				SortOrder:       iv.SortOrder,
+			})
+		}
+		out = append(out, spec)
+	}
+	normalizeConfigPricing(out, defaultPlatform)
+	return out
+}
+
+func errorRuleToConfigSpec(r *model.ErrorPassthroughRule) ConfigErrorPassthroughRuleSpec {
+	description := ""
+	if r.Description != nil {
+		description = *r.Description
+	}
+	customMessage := ""
+	if r.CustomMessage != nil {
+		customMessage = *r.CustomMessage
+	}
+	return ConfigErrorPassthroughRuleSpec{
+		Name:            r.Name,
+		Enabled:         configPtr(r.Enabled),
+		Priority:        configPtr(r.Priority),
+		ErrorCodes:      configSlicePtr(r.ErrorCodes),
+		Keywords:        configSlicePtr(r.Keywords),
+		MatchMode:       configPtr(r.MatchMode),
+		Platforms:       configSlicePtr(r.Platforms),
+		PassthroughCode: configPtr(r.PassthroughCode),
+		ResponseCode:    r.ResponseCode,
+		PassthroughBody: configPtr(r.PassthroughBody),
+		CustomMessage:   &customMessage,
+		SkipMonitoring:  configPtr(r.SkipMonitoring),
+		Description:     &description,
+	}
+}
+
+// configSettingFields 返回 snake_case key -> SystemSettings 字段下标（*_configured 只读字段除外）
+func configSettingFields() map[string]int {
+	t := reflect.TypeOf(SystemSettings{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key := configSnakeName(f.Name)
+		if strings.HasSuffix(key, "_configured") {
+			continue
+		}
+		fields[key] = i
+	}
+	return fields
+}
+
+func settingsToConfigMap(settings *SystemSettings) (map[string]any, error) {
+	v := reflect.ValueOf(settings).Elem()
+	out := make(map[string]any)
+	for key, idx := range configSettingFields() {
+		data, err := json.Marshal(v.Field(idx).Interface())
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+func configMapToSettings(m map[string]any, settings *SystemSettings) error {
+	v := reflect.ValueOf(settings).Elem()
+	fields := configSettingFields()
+	for key, value := range m {
+		idx, ok := fields[key]
+		if !ok {
+			return configSpecError("settings: unknown setting %q", key)
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, v.Field(idx).Addr().Interface()); err != nil {
+			return configSpecError("settings.%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// ---------- 小工具 ----------
+
+func configPtr[T any](v T) *T {
+	return &v
+}
+
+func configSlicePtr[T any](s []T) *[]T {
+	if s == nil {
+		s = []T{}
+	}
+	return &s
+}
+
+func derefSlice[T any](s *[]T) []T {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefInt(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type configAdminStub struct {
+	AdminService
+
+	proxies     map[int64]*Proxy
+	groups      map[int64]*Group
+	nextID      int64
+	failGroup   string
+	deleted     []int64
+	groupInputs []*UpdateGroupInput
+}
+
+func newConfigAdminStub() *configAdminStub {
+	return &configAdminStub{proxies: map[int64]*Proxy{}, groups: map[int64]*Group{}, nextID: 100}
+}
+
+func (s *configAdminStub) ListProxies(_ context.Context, page, _ int, _, _, _, _, _ string) ([]Proxy, int64, error) {
+	if page > 1 {
+		return nil, int64(len(s.proxies)), nil
+	}
+	out := make([]Proxy, 0, len(s.proxies))
+	for _, p := range s.proxies {
+		out = append(out, *p)
+	}
+	return out, int64(len(out)), nil
+}
+
+func (s *configAdminStub) CreateProxy(_ context.Context, in *CreateProxyInput) (*Proxy, error) {
+	s.nextID++
+	p := &Proxy{ID: s.nextID, Name: in.Name, Protocol: in.Protocol, Host: in.Host, Port: in.Port, Username: in.Username, Password: in.Password, Status: StatusActive}
+	s.proxies[p.ID] = p
+	return p, nil
+}
+
+func (s *configAdminStub) UpdateProxy(_ context.Context, id int64, in *UpdateProxyInput) (*Proxy, error) {
+	p := s.proxies[id]
+	if in.Host != "" {
+		p.Host = in.Host
+	}
+	if in.Port != 0 {
+		p.Port = in.Port
+	}
+	if in.Password != "" {
+		p.Password = in.Password
+	}
+	if in.Status != "" {
+		p.Status = in.Status
+	}
+	return p, nil
+}
+
+func (s *configAdminStub) DeleteProxy(_ context.Context, id int64) error {
+	s.deleted = append(s.deleted, id)
+	delete(s.proxies, id)
+	return nil
+}
+
+func (s *configAdminStub) ListGroups(_ context.Context, page, _ int, _, _, _ string, _ *bool, _, _ string) ([]Group, int64, error) {
+	if page > 1 {
+		return nil, int64(len(s.groups)), nil
+	}
+	out := make([]Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		out = append(out, *g)
+	}
+	return out, int64(len(out)), nil
+}
+
+func (s *configAdminStub) CreateGroup(_ context.Context, in *CreateGroupInput) (*Group, error) {
+	if in.Name == s.failGroup {
+		return nil, errors.New("boom")
+	}
+	s.nextID++
+	g := &Group{ID: s.nextID, Name: in.Name, Platform: in.Platform, RateMultiplier: in.RateMultiplier, Status: StatusActive, FallbackGroupID: in.FallbackGroupID}
+	s.groups[g.ID] = g
+	return g, nil
+}
+
+func (s *configAdminStub) UpdateGroup(_ context.Context, id int64, in *UpdateGroupInput) (*Group, error) {
+	s.groupInputs = append(s.groupInputs, in)
+	g := s.groups[id]
+	if in.RateMultiplier != nil {
+		g.RateMultiplier = *in.RateMultiplier
+	}
+	if in.FallbackGroupID != nil {
+		if *in.FallbackGroupID == 0 {
+			g.FallbackGroupID = nil
+		} else {
+			id := *in.FallbackGroupID
+			g.FallbackGroupID = &id
+		}
+	}
+	return g, nil
+}
+
+func (s *configAdminStub) DeleteGroup(_ context.Context, id int64) error {
+	s.deleted = append(s.deleted, id)
+	delete(s.groups, id)
+	return nil
+}
+
+type configSettingStub struct {
+	settings SystemSettings
+	updates  int
+}
+
+func (s *configSettingStub) GetAllSettings(context.Context) (*SystemSettings, error) {
+	cp := s.settings
+	return &cp, nil
+}
+
+func (s *configSettingStub) UpdateSettings(_ context.Context, settings *SystemSettings) error {
+	s.updates++
+	s.settings = *settings
+	return nil
+}
+
+func newConfigServiceForTest(admin *configAdminStub, env map[string]string) *ConfigAsCodeService {
+	svc := NewConfigAsCodeService(admin, nil, nil, nil, nil, nil)
+	svc.lookupEnv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	return svc
+}
+
+func mustParseConfigSpec(t *testing.T, data string) *ConfigSpec {
+	t.Helper()
+	spec, err := ParseConfigSpec([]byte(data))
+	require.NoError(t, err)
+	return spec
+}
+
+func TestParseConfigSpecRejectsUnknownFields(t *testing.T) {
+	_, err := ParseConfigSpec([]byte("groups:\n  - name: a\n    rate_multipler: 2\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rate_multipler")
+
+	spec, err := ParseConfigSpec([]byte(`{"groups":[{"name":"a","rate_multiplier":2}]}`))
+	require.NoError(t, err)
+	require.Len(t, spec.Groups, 1)
+	require.Equal(t, 2.0, *spec.Groups[0].RateMultiplier)
+}
+
+func TestConfigPlanDiffsAgainstLiveState(t *testing.T) {
+	admin := newConfigAdminStub()
+	admin.proxies[1] = &Proxy{ID: 1, Name: "hk", Protocol: "http", Host: "10.0.0.1", Port: 8080, Password: "old", Status: StatusActive}
+	admin.groups[2] = &Group{ID: 2, Name: "claude", Platform: PlatformAnthropic, RateMultiplier: 1, Status: StatusActive}
+	svc := newConfigServiceForTest(admin, map[string]string{"HK_PROXY_PASSWORD": "new"})
+
+	spec := mustParseConfigSpec(t, `
+proxies:
+  - name: hk
+    host: 10.0.0.1
+    password: ${HK_PROXY_PASSWORD}
+groups:
+  - name: claude
+    rate_multiplier: 1
+  - name: claude-vip
+    platform: anthropic
+    rate_multiplier: 1.5
+    fallback_group: claude
+`)
+	plan, err := svc.Plan(context.Background(), spec)
+	require.NoError(t, err)
+	require.Equal(t, ConfigPlanSummary{Create: 1, Update: 1, Unchanged: 1}, plan.Summary)
+	require.NotEmpty(t, plan.Hash)
+
+	require.Len(t, plan.Changes, 2)
+	proxyChange := plan.Changes[0]
+	require.Equal(t, ConfigKindProxy, proxyChange.Kind)
+	require.Equal(t, ConfigChangeActionUpdate, proxyChange.Action)
+	require.Equal(t, []ConfigFieldChange{{Path: "password", Before: configSensitiveRedacted, After: configSensitiveRedacted, Sensitive: true}}, proxyChange.Fields)
+
+	groupChange := plan.Changes[1]
+	require.Equal(t, ConfigChangeActionCreate, groupChange.Action)
+	require.Equal(t, "claude-vip", groupChange.Name)
+
+	again, err := svc.Plan(context.Background(), spec)
+	require.NoError(t, err)
+	require.Equal(t, plan.Hash, again.Hash)
+}
+
+func TestConfigPlanValidation(t *testing.T) {
+	svc := newConfigServiceForTest(newConfigAdminStub(), map[string]string{})
+	ctx := context.Background()
+
+	_, err := svc.Plan(ctx, mustParseConfigSpec(t, "proxies:\n  - {name: p, protocol: http, host: h, port: 1, password: hunter2}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "proxies/p.password")
+
+	_, err = svc.Plan(ctx, mustParseConfigSpec(t, "proxies:\n  - {name: p, protocol: http, host: h, port: 1, password: '${MISSING}'}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "MISSING")
+
+	_, err = svc.Plan(ctx, mustParseConfigSpec(t, "groups:\n  - {name: a, fallback_group: b}\n  - {name: b}\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "declared earlier")
+
+	_, err = svc.Plan(ctx, mustParseConfigSpec(t, "groups:\n  - {name: a}\n  - {name: a}\n"))
+	require.Error(t, err)
+
+	_, err = svc.Plan(ctx, mustParseConfigSpec(t, "proxies:\n  - {name: p}\n"))
+	require.Error(t, err)
+}
+
+func TestConfigApplyCreatesWithReferences(t *testing.T) {
+	admin := newConfigAdminStub()
+	svc := newConfigServiceForTest(admin, nil)
+	ctx := context.Background()
+
+	spec := mustParseConfigSpec(t, `
+groups:
+  - {name: base, platform: anthropic}
+  - {name: vip, platform: anthropic, rate_multiplier: 2, fallback_group: base}
+`)
+	plan, err := svc.Plan(ctx, spec)
+	require.NoError(t, err)
+
+	_, err = svc.Apply(ctx, spec, "stale")
+	require.ErrorIs(t, err, ErrConfigPlanStale)
+
+	result, err := svc.Apply(ctx, spec, plan.Hash)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Applied)
+	require.Len(t, admin.groups, 2)
+
+	var baseID int64
+	for _, g := range admin.groups {
+		if g.Name == "base" {
+			baseID = g.ID
+		}
+	}
+	for _, g := range admin.groups {
+		if g.Name == "vip" {
+			require.NotNil(t, g.FallbackGroupID)
+			require.Equal(t, baseID, *g.FallbackGroupID)
+			require.Equal(t, 2.0, g.RateMultiplier)
+		}
+	}
+
+	replan, err := svc.Plan(ctx, spec)
+	require.NoError(t, err)
+	require.Empty(t, replan.Changes)
+	require.Equal(t, 2, replan.Summary.Unchanged)
+}
+
+func TestConfigApplyRollsBackOnFailure(t *testing.T) {
+	admin := newConfigAdminStub()
+	admin.groups[2] = &Group{ID: 2, Name: "existing", Platform: PlatformAnthropic, RateMultiplier: 1, Status: StatusActive}
+	admin.failGroup = "broken"
+	svc := newConfigServiceForTest(admin, nil)
+
+	spec := mustParseConfigSpec(t, `
+proxies:
+  - {name: p1, protocol: http, host: h, port: 1}
+groups:
+  - {name: existing, rate_multiplier: 3}
+  - {name: broken, platform: anthropic}
+`)
+	_, err := svc.Apply(context.Background(), spec, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "groups/broken")
+	require.Contains(t, err.Error(), "rolled back 2 change(s)")
+
+	require.Empty(t, admin.proxies)
+	require.Equal(t, 1.0, admin.groups[2].RateMultiplier)
+}
+
+func TestConfigSettingsPlanAndApply(t *testing.T) {
+	settings := &configSettingStub{settings: SystemSettings{SiteName: "old", SMTPHost: "smtp.example.com"}}
+	svc := newConfigServiceForTest(newConfigAdminStub(), map[string]string{"SMTP_PASSWORD": "pw"})
+	svc.settings = settings
+	ctx := context.Background()
+
+	_, err := svc.Plan(ctx, mustParseConfigSpec(t, "settings:\n  no_such_setting: 1\n"))
+	require.Error(t, err)
+
+	spec := mustParseConfigSpec(t, "settings:\n  site_name: new\n  smtp_host: smtp.example.com\n  smtp_password: ${SMTP_PASSWORD}\n")
+	plan, err := svc.Plan(ctx, spec)
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 1)
+	require.Len(t, plan.Changes[0].Fields, 2)
+
+	_, err = svc.Apply(ctx, spec, plan.Hash)
+	require.NoError(t, err)
+	require.Equal(t, "new", settings.settings.SiteName)
+	require.Equal(t, "pw", settings.settings.SMTPPassword)
+	require.Equal(t, 1, settings.updates)
+}
+
+func TestConfigSnakeName(t *testing.T) {
+	require.Equal(t, "smtp_host", configSnakeName("SMTPHost"))
+	require.Equal(t, "linux_do_connect_client_id", configSnakeName("LinuxDoConnectClientID"))
+	require.Equal(t, "totp_enabled", configSnakeName("TotpEnabled"))
+	require.True(t, isSensitiveConfigKey("refresh_token"))
+	require.False(t, isSensitiveConfigKey("max_tokens"))
+	require.False(t, isSensitiveConfigKey("smtp_password_configured"))
+}
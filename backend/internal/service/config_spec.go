@@ -0,0 +1,421 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// 声明式配置（config-as-code）资源类型，同时也是 apply 的执行顺序
+const (
+	ConfigKindProxy                 = "proxies"
+	ConfigKindTLSFingerprintProfile = "tls_fingerprint_profiles"
+	ConfigKindGroup                 = "groups"
+	ConfigKindAccount               = "accounts"
+	ConfigKindChannel               = "channels"
+	ConfigKindErrorPassthroughRule  = "error_passthrough_rules"
+	ConfigKindSettings              = "settings"
+)
+
+const (
+	ConfigChangeActionCreate = "create"
+	ConfigChangeActionUpdate = "update"
+)
+
+const (
+	configSettingsResourceName       = "system"
+	configSensitiveRedacted          = "(sensitive)"
+	maxConfigSpecBytes         int64 = 4 << 20
+)
+
+var (
+	ErrConfigSpecInvalid   = infraerrors.BadRequest("CONFIG_SPEC_INVALID", "invalid config spec")
+	ErrConfigInlineSecret  = infraerrors.BadRequest("CONFIG_INLINE_SECRET", "secrets must be referenced as ${ENV_VAR}, not inlined")
+	ErrConfigEnvMissing    = infraerrors.BadRequest("CONFIG_ENV_MISSING", "referenced environment variable is not set")
+	ErrConfigUnknownRef    = infraerrors.BadRequest("CONFIG_UNKNOWN_REFERENCE", "config spec references an unknown resource")
+	ErrConfigAmbiguousName = infraerrors.Conflict("CONFIG_AMBIGUOUS_NAME", "multiple live resources share this name")
+	ErrConfigPlanStale     = infraerrors.Conflict("CONFIG_PLAN_STALE", "live state changed since the plan was generated, re-run plan")
+)
+
+// configEnvRefPattern 环境变量引用：整个字符串必须是 ${NAME}
+var configEnvRefPattern = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// ConfigSpec 声明式配置文件（YAML 或 JSON）。
+//
+// 资源按 name 与线上状态对齐：
+//   - 未写出的字段不受管理，保持线上值；
+//   - 列表字段整体替换，map 字段（credentials/extra/model_mapping/settings）按 key 合并；
+//   - 不在文件中的线上资源不会被删除；
+//   - 密码、密钥、token 等敏感字段只能写成 ${ENV_VAR}，由服务端进程的环境变量解析。
+type ConfigSpec struct {
+	Proxies                []ConfigProxySpec                `json:"proxies,omitempty" yaml:"proxies,omitempty"`
+	TLSFingerprintProfiles []ConfigTLSProfileSpec           `json:"tls_fingerprint_profiles,omitempty" yaml:"tls_fingerprint_profiles,omitempty"`
+	Groups                 []ConfigGroupSpec                `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Accounts               []ConfigAccountSpec              `json:"accounts,omitempty" yaml:"accounts,omitempty"`
+	Channels               []ConfigChannelSpec              `json:"channels,omitempty" yaml:"channels,omitempty"`
+	ErrorPassthroughRules  []ConfigErrorPassthroughRuleSpec `json:"error_passthrough_rules,omitempty" yaml:"error_passthrough_rules,omitempty"`
+	// Settings 系统设置，key 为 SystemSettings 字段的 snake_case 形式（如 smtp_host）
+	Settings map[string]any `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// ConfigProxySpec 代理
+type ConfigProxySpec struct {
+	Name     string  `json:"name" yaml:"name"`
+	Protocol *string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Host     *string `json:"host,omitempty" yaml:"host,omitempty"`
+	Port     *int    `json:"port,omitempty" yaml:"port,omitempty"`
+	Username *string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password *string `json:"password,omitempty" yaml:"password,omitempty"`
+	Status   *string `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// ConfigTLSProfileSpec TLS 指纹模板
+type ConfigTLSProfileSpec struct {
+	Name                string    `json:"name" yaml:"name"`
+	Description         *string   `json:"description,omitempty" yaml:"description,omitempty"`
+	EnableGREASE        *bool     `json:"enable_grease,omitempty" yaml:"enable_grease,omitempty"`
+	CipherSuites        *[]uint16 `json:"cipher_suites,omitempty" yaml:"cipher_suites,omitempty"`
+	Curves              *[]uint16 `json:"curves,omitempty" yaml:"curves,omitempty"`
+	PointFormats        *[]uint16 `json:"point_formats,omitempty" yaml:"point_formats,omitempty"`
+	SignatureAlgorithms *[]uint16 `json:"signature_algorithms,omitempty" yaml:"signature_algorithms,omitempty"`
+	ALPNProtocols       *[]string `json:"alpn_protocols,omitempty" yaml:"alpn_protocols,omitempty"`
+	SupportedVersions   *[]uint16 `json:"supported_versions,omitempty" yaml:"supported_versions,omitempty"`
+	KeyShareGroups      *[]uint16 `json:"key_share_groups,omitempty" yaml:"key_share_groups,omitempty"`
+	PSKModes            *[]uint16 `json:"psk_modes,omitempty" yaml:"psk_modes,omitempty"`
+	Extensions          *[]uint16 `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+}
+
+// ConfigGroupSpec 分组
+type ConfigGroupSpec struct {
+	Name             string   `json:"name" yaml:"name"`
+	Description      *string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Platform         *string  `json:"platform,omitempty" yaml:"platform,omitempty"`
+	RateMultiplier   *float64 `json:"rate_multiplier,omitempty" yaml:"rate_multiplier,omitempty"`
+	IsExclusive      *bool    `json:"is_exclusive,omitempty" yaml:"is_exclusive,omitempty"`
+	Status           *string  `json:"status,omitempty" yaml:"status,omitempty"`
+	SubscriptionType *string  `json:"subscription_type,omitempty" yaml:"subscription_type,omitempty"`
+	DailyLimitUSD    *float64 `json:"daily_limit_usd,omitempty" yaml:"daily_limit_usd,omitempty"`
+	WeeklyLimitUSD   *float64 `json:"weekly_limit_usd,omitempty" yaml:"weekly_limit_usd,omitempty"`
+	MonthlyLimitUSD  *float64 `json:"monthly_limit_usd,omitempty" yaml:"monthly_limit_usd,omitempty"`
+	ClaudeCodeOnly   *bool    `json:"claude_code_only,omitempty" yaml:"claude_code_only,omitempty"`
+	// FallbackGroup 降级分组名称，空字符串表示清除；须为线上已有分组或在本文件中先声明
+	FallbackGroup *string `json:"fallback_group,omitempty" yaml:"fallback_group,omitempty"`
+}
+
+// ConfigAccountSpec 上游账号
+type ConfigAccountSpec struct {
+	Name           string         `json:"name" yaml:"name"`
+	Platform       *string        `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Type           *string        `json:"type,omitempty" yaml:"type,omitempty"`
+	Notes          *string        `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Credentials    map[string]any `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	Extra          map[string]any `json:"extra,omitempty" yaml:"extra,omitempty"`
+	Proxy          *string        `json:"proxy,omitempty" yaml:"proxy,omitempty"` // 代理名称，空字符串表示不使用代理
+	Concurrency    *int           `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	Priority       *int           `json:"priority,omitempty" yaml:"priority,omitempty"`
+	RateMultiplier *float64       `json:"rate_multiplier,omitempty" yaml:"rate_multiplier,omitempty"`
+	Status         *string        `json:"status,omitempty" yaml:"status,omitempty"`
+	Groups         *[]string      `json:"groups,omitempty" yaml:"groups,omitempty"` // 分组名称列表
+}
+
+// ConfigChannelSpec 渠道（含模型定价、模型映射与账号统计定价规则）
+type ConfigChannelSpec struct {
+	Name                       string                               `json:"name" yaml:"name"`
+	Description                *string                              `json:"description,omitempty" yaml:"description,omitempty"`
+	Status                     *string                              `json:"status,omitempty" yaml:"status,omitempty"`
+	BillingModelSource         *string                              `json:"billing_model_source,omitempty" yaml:"billing_model_source,omitempty"`
+	RestrictModels             *bool                                `json:"restrict_models,omitempty" yaml:"restrict_models,omitempty"`
+	Groups                     *[]string                            `json:"groups,omitempty" yaml:"groups,omitempty"`
+	ModelPricing               *[]ConfigModelPricingSpec            `json:"model_pricing,omitempty" yaml:"model_pricing,omitempty"`
+	ModelMapping               map[string]map[string]string         `json:"model_mapping,omitempty" yaml:"model_mapping,omitempty"`
+	ApplyPricingToAccountStats *bool                                `json:"apply_pricing_to_account_stats,omitempty" yaml:"apply_pricing_to_account_stats,omitempty"`
+	AccountStatsPricingRules   *[]ConfigAccountStatsPricingRuleSpec `json:"account_stats_pricing_rules,omitempty" yaml:"account_stats_pricing_rules,omitempty"`
+}
+
+// ConfigModelPricingSpec 渠道模型定价
+type ConfigModelPricingSpec struct {
+	Platform         string                      `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Models           []string                    `json:"models" yaml:"models"`
+	BillingMode      string                      `json:"billing_mode,omitempty" yaml:"billing_mode,omitempty"`
+	InputPrice       *float64                    `json:"input_price,omitempty" yaml:"input_price,omitempty"`
+	OutputPrice      *float64                    `json:"output_price,omitempty" yaml:"output_price,omitempty"`
+	CacheWritePrice  *float64                    `json:"cache_write_price,omitempty" yaml:"cache_write_price,omitempty"`
+	CacheReadPrice   *float64                    `json:"cache_read_price,omitempty" yaml:"cache_read_price,omitempty"`
+	ImageOutputPrice *float64                    `json:"image_output_price,omitempty" yaml:"image_output_price,omitempty"`
+	PerRequestPrice  *float64                    `json:"per_request_price,omitempty" yaml:"per_request_price,omitempty"`
+	Intervals        []ConfigPricingIntervalSpec `json:"intervals,omitempty" yaml:"intervals,omitempty"`
+}
+
+// ConfigPricingIntervalSpec 定价区间
+type ConfigPricingIntervalSpec struct {
+	MinTokens       int      `json:"min_tokens" yaml:"min_tokens"`
+	MaxTokens       *int     `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`
+	TierLabel       string   `json:"tier_label,omitempty" yaml:"tier_label,omitempty"`
+	InputPrice      *float64 `json:"input_price,omitempty" yaml:"input_price,omitempty"`
+	OutputPrice     *float64 `json:"output_price,omitempty" yaml:"output_price,omitempty"`
+	CacheWritePrice *float64 `json:"cache_write_price,omitempty" yaml:"cache_write_price,omitempty"`
+	CacheReadPrice  *float64 `json:"cache_read_price,omitempty" yaml:"cache_read_price,omitempty"`
+	PerRequestPrice *float64 `json:"per_request_price,omitempty" yaml:"per_request_price,omitempty"`
+	SortOrder       int      `json:"sort_order,omitempty" yaml:"sort_order,omitempty"`
+}
+
+// ConfigAccountStatsPricingRuleSpec 账号统计定价规则（分组/账号按名称引用）
+type ConfigAccountStatsPricingRuleSpec struct {
+	Name     string                   `json:"name" yaml:"name"`
+	Groups   []string                 `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Accounts []string                 `json:"accounts,omitempty" yaml:"accounts,omitempty"`
+	Pricing  []ConfigModelPricingSpec `json:"pricing,omitempty" yaml:"pricing,omitempty"`
+}
+
+// ConfigErrorPassthroughRuleSpec 错误透传规则
+type ConfigErrorPassthroughRuleSpec struct {
+	Name            string    `json:"name" yaml:"name"`
+	Enabled         *bool     `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Priority        *int      `json:"priority,omitempty" yaml:"priority,omitempty"`
+	ErrorCodes      *[]int    `json:"error_codes,omitempty" yaml:"error_codes,omitempty"`
+	Keywords        *[]string `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	MatchMode       *string   `json:"match_mode,omitempty" yaml:"match_mode,omitempty"`
+	Platforms       *[]string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	PassthroughCode *bool     `json:"passthrough_code,omitempty" yaml:"passthrough_code,omitempty"`
+	ResponseCode    *int      `json:"response_code,omitempty" yaml:"response_code,omitempty"`
+	PassthroughBody *bool     `json:"passthrough_body,omitempty" yaml:"passthrough_body,omitempty"`
+	CustomMessage   *string   `json:"custom_message,omitempty" yaml:"custom_message,omitempty"`
+	SkipMonitoring  *bool     `json:"skip_monitoring,omitempty" yaml:"skip_monitoring,omitempty"`
+	Description     *string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// ConfigPlan plan 结果：期望状态与线上状态的差异
+type ConfigPlan struct {
+	// Hash 差异内容摘要；apply 时传入可确保执行的正是审阅过的 plan
+	Hash    string            `json:"hash"`
+	Changes []ConfigChange    `json:"changes"`
+	Summary ConfigPlanSummary `json:"summary"`
+}
+
+// ConfigPlanSummary plan 统计
+type ConfigPlanSummary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Unchanged int `json:"unchanged"`
+}
+
+// ConfigChange 单个资源的变更
+type ConfigChange struct {
+	Kind   string              `json:"kind"`
+	Name   string              `json:"name"`
+	Action string              `json:"action"`
+	Fields []ConfigFieldChange `json:"fields"`
+}
+
+// ConfigFieldChange 字段级变更，敏感字段的值以 (sensitive) 代替
+type ConfigFieldChange struct {
+	Path      string `json:"path"`
+	Before    any    `json:"before"`
+	After     any    `json:"after"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// ConfigApplyResult apply 结果
+type ConfigApplyResult struct {
+	Plan    *ConfigPlan `json:"plan"`
+	Applied int         `json:"applied"`
+}
+
+// ParseConfigSpec 解析 YAML/JSON 配置文件（JSON 是 YAML 的子集），拒绝未知字段以便尽早发现拼写错误
+func ParseConfigSpec(data []byte) (*ConfigSpec, error) {
+	if int64(len(data)) > maxConfigSpecBytes {
+		return nil, ErrConfigSpecInvalid.WithCause(fmt.Errorf("spec exceeds %d bytes", maxConfigSpecBytes))
+	}
+	spec := &ConfigSpec{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, configSpecError("parse spec: %v", err)
+	}
+	return spec, nil
+}
+
+func configSpecError(format string, args ...any) error {
+	return infraerrors.BadRequest(ErrConfigSpecInvalid.Reason, fmt.Sprintf(format, args...))
+}
+
+// isSensitiveConfigKey 判断字段是否为敏感字段（只允许 ${ENV} 引用，输出时脱敏）
+func isSensitiveConfigKey(key string) bool {
+	k := strings.ToLower(key)
+	if strings.HasSuffix(k, "_configured") {
+		return false
+	}
+	if k == "token" || strings.HasSuffix(k, "_token") {
+		return true
+	}
+	for _, marker := range []string{"password", "secret", "api_key", "apikey", "private_key", "session_key", "cookie"} {
+		if strings.Contains(k, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConfigEnvRefs 校验敏感字段未内联明文，并将 ${ENV} 引用替换为环境变量的值
+func resolveConfigEnvRefs(path string, m map[string]any, lookup func(string) (string, bool)) error {
+	for key, value := range m {
+		fieldPath := joinConfigPath(path, key)
+		switch v := value.(type) {
+		case map[string]any:
+			if err := resolveConfigEnvRefs(fieldPath, v, lookup); err != nil {
+				return err
+			}
+		case string:
+			match := configEnvRefPattern.FindStringSubmatch(v)
+			if match == nil {
+				if isSensitiveConfigKey(key) && v != "" {
+					return infraerrors.BadRequest(ErrConfigInlineSecret.Reason,
+						fmt.Sprintf("%s: secrets must be referenced as ${ENV_VAR}, not inlined", fieldPath))
+				}
+				continue
+			}
+			resolved, ok := lookup(match[1])
+			if !ok {
+				return infraerrors.BadRequest(ErrConfigEnvMissing.Reason,
+					fmt.Sprintf("%s: environment variable %s is not set", fieldPath, match[1]))
+			}
+			m[key] = resolved
+		}
+	}
+	return nil
+}
+
+// toConfigMap 将 spec 结构体转为通用 map（经 JSON 往返，未声明的字段被 omitempty 省略）
+func toConfigMap(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// fromConfigMap 将通用 map 还原为 spec 结构体
+func fromConfigMap(m map[string]any, out any) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// mergeConfigMaps 以 live 为底叠加 desired：map 递归合并，其余值（含列表）整体替换
+func mergeConfigMaps(live, desired map[string]any) map[string]any {
+	out := make(map[string]any, len(live)+len(desired))
+	for k, v := range live {
+		out[k] = v
+	}
+	for k, v := range desired {
+		dm, dok := v.(map[string]any)
+		lm, lok := out[k].(map[string]any)
+		if dok && lok {
+			out[k] = mergeConfigMaps(lm, dm)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// diffConfigMaps 对比 desired 中声明的字段与线上值，返回字段级差异（按路径排序）
+func diffConfigMaps(path string, desired, live map[string]any) []ConfigFieldChange {
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var changes []ConfigFieldChange
+	for _, k := range keys {
+		fieldPath := joinConfigPath(path, k)
+		dv := desired[k]
+		var lv any
+		if live != nil {
+			lv = live[k]
+		}
+		if dm, ok := dv.(map[string]any); ok {
+			lm, _ := lv.(map[string]any)
+			changes = append(changes, diffConfigMaps(fieldPath, dm, lm)...)
+			continue
+		}
+		if reflect.DeepEqual(dv, lv) {
+			continue
+		}
+		changes = append(changes, ConfigFieldChange{
+			Path:      fieldPath,
+			Before:    lv,
+			After:     dv,
+			Sensitive: isSensitiveConfigKey(k),
+		})
+	}
+	return changes
+}
+
+func joinConfigPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// redactConfigChanges 返回脱敏后的副本（敏感字段只提示是否变化，不输出值）
+func redactConfigChanges(changes []ConfigChange) []ConfigChange {
+	out := make([]ConfigChange, len(changes))
+	for i, c := range changes {
+		fields := make([]ConfigFieldChange, len(c.Fields))
+		for j, f := range c.Fields {
+			if f.Sensitive {
+				if f.Before != nil && f.Before != "" {
+					f.Before = configSensitiveRedacted
+				}
+				if f.After != nil && f.After != "" {
+					f.After = configSensitiveRedacted
+				}
+			}
+			fields[j] = f
+		}
+		c.Fields = fields
+		out[i] = c
+	}
+	return out
+}
+
+// configSnakeName 将 Go 字段名转为 snake_case（SMTPHost -> smtp_host，LinuxDoConnectClientID -> linux_do_connect_client_id）
+func configSnakeName(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		upper := r >= 'A' && r <= 'Z'
+		if upper && i > 0 {
+			prev := runes[i-1]
+			prevLowerOrDigit := (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9')
+			nextLower := i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z'
+			prevUpper := prev >= 'A' && prev <= 'Z'
+			if prevLowerOrDigit || (prevUpper && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		if upper {
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// 上下文窗口超限时的处理动作
+const (
+	ContextActionReject   = "reject"
+	ContextActionTruncate = "truncate"
+	ContextActionRoute    = "route"
+)
+
+const (
+	defaultContextReserveTokens = 2048
+	maxContextReserveTokens     = 100000
+	maxContextWindowOverride    = 10000000
+
+	// 本地估算中无法按文本计算的内容块使用固定值
+	contextImageBlockTokens = 1600
+	// base64 文档（PDF）按编码长度粗略折算，约每页 1.5k~3k token
+	contextBase64DocCharsPerToken = 32
+	contextMinDocumentTokens      = 1500
+	contextMessageOverheadTokens  = 4
+)
+
+var (
+	ErrInvalidContextAction      = infraerrors.BadRequest("INVALID_CONTEXT_ACTION", "action must be reject, truncate or route")
+	ErrContextRouteModelRequired = infraerrors.BadRequest("CONTEXT_ROUTE_MODEL_REQUIRED", "long_context_model is required when action is route")
+	ErrInvalidContextWindow      = infraerrors.BadRequest("INVALID_CONTEXT_WINDOW", "context_window must be between 0 and 10000000")
+	ErrInvalidContextReserve     = infraerrors.BadRequest("INVALID_CONTEXT_RESERVE", "reserve_tokens must be between 0 and 100000")
+)
+
+// ContextPolicy 分组级上下文窗口超限策略（opt-in，未配置的分组不做任何检查）
+type ContextPolicy struct {
+	GroupID int64  `json:"group_id"`
+	Enabled bool   `json:"enabled"`
+	Action  string `json:"action"`
+	// LongContextModel action=route 时切换到的长上下文模型
+	LongContextModel string `json:"long_context_model"`
+	// ContextWindow 覆盖模型目录中的上下文窗口，0 表示使用模型目录
+	ContextWindow int `json:"context_window"`
+	// ReserveTokens 为本地估算误差预留的余量
+	ReserveTokens int       `json:"reserve_tokens"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// DefaultContextPolicy 返回分组的默认（未启用）策略
+func DefaultContextPolicy(groupID int64) *ContextPolicy {
+	return &ContextPolicy{
+		GroupID:       groupID,
+		Action:        ContextActionReject,
+		ReserveTokens: defaultContextReserveTokens,
+	}
+}
+
+// Normalize 规范化并校验策略
+func (p *ContextPolicy) Normalize() error {
+	p.Action = strings.ToLower(strings.TrimSpace(p.Action))
+	p.LongContextModel = strings.TrimSpace(p.LongContextModel)
+	switch p.Action {
+	case "":
+		p.Action = ContextActionReject
+	case ContextActionReject, ContextActionTruncate:
+	case ContextActionRoute:
+		if p.LongContextModel == "" {
+			return ErrContextRouteModelRequired
+		}
+	default:
+		return ErrInvalidContextAction
+	}
+	if p.ContextWindow < 0 || p.ContextWindow > maxContextWindowOverride {
+		return ErrInvalidContextWindow
+	}
+	if p.ReserveTokens < 0 || p.ReserveTokens > maxContextReserveTokens {
+		return ErrInvalidContextReserve
+	}
+	return nil
+}
+
+// ContextPolicyRepository 上下文窗口策略存储
+type ContextPolicyRepository interface {
+	ListPolicies(ctx context.Context) ([]*ContextPolicy, error)
+	UpsertPolicy(ctx context.Context, policy *ContextPolicy) error
+	DeletePolicy(ctx context.Context, groupID int64) error
+}
+
+// ContextPolicyDecision 单次请求执行策略后的结果（仅在实际改写请求时返回）
+type ContextPolicyDecision struct {
+	// Action truncate / route，写入 usage_logs.context_action
+	Action string
+	Body   []byte
+	// Model 执行后的请求模型（route 时为长上下文模型）
+	Model           string
+	EstimatedTokens int
+	Limit           int
+	DroppedMessages int
+}
+
+// ContextWindowExceededError 请求超出上下文窗口且策略无法处理
+type ContextWindowExceededError struct {
+	Model           string
+	EstimatedTokens int
+	Limit           int
+}
+
+func (e *ContextWindowExceededError) Error() string {
+	return fmt.Sprintf("prompt is too long: estimated %d tokens > %d maximum for model %s (including max_tokens); please shorten or compact the conversation",
+		e.EstimatedTokens, e.Limit, e.Model)
+}
+
+// contextInputLimit 返回请求输入可用的 token 上限；max_tokens 与输入共享上下文窗口
+func contextInputLimit(window, reserve, maxTokens int) int {
+	limit := window - reserve
+	if maxTokens > 0 && maxTokens < limit {
+		limit -= maxTokens
+	}
+	return limit
+}
+
+// estimateClaudeRequestTokens 本地估算 Claude Messages 请求的输入 token 数，
+// 返回除 messages 以外部分（system + tools）的估算值与每条消息的估算值。
+func estimateClaudeRequestTokens(body []byte) (int, []int) {
+	base := 0
+	system := gjson.GetBytes(body, "system")
+	switch {
+	case system.Type == gjson.String:
+		base += estimateTokensForText(system.String())
+	case system.IsArray():
+		system.ForEach(func(_, block gjson.Result) bool {
+			base += estimateContextBlockTokens(block)
+			return true
+		})
+	}
+	gjson.GetBytes(body, "tools").ForEach(func(_, tool gjson.Result) bool {
+		base += estimateTokensForText(tool.Raw)
+		return true
+	})
+
+	messages := gjson.GetBytes(body, "messages").Array()
+	perMessage := make([]int, len(messages))
+	for i, msg := range messages {
+		perMessage[i] = contextMessageOverheadTokens + estimateContextContentTokens(msg.Get("content"))
+	}
+	return base, perMessage
+}
+
+func estimateContextContentTokens(content gjson.Result) int {
+	if content.Type == gjson.String {
+		return estimateTokensForText(content.String())
+	}
+	total := 0
+	content.ForEach(func(_, block gjson.Result) bool {
+		total += estimateContextBlockTokens(block)
+		return true
+	})
+	return total
+}
+
+func estimateContextBlockTokens(block gjson.Result) int {
+	switch block.Get("type").String() {
+	case "text":
+		return estimateTokensForText(block.Get("text").String())
+	case "thinking":
+		return estimateTokensForText(block.Get("thinking").String())
+	case "redacted_thinking":
+		return estimateTokensForText(block.Get("data").String())
+	case "tool_use", "server_tool_use":
+		return estimateTokensForText(block.Get("name").String()) + estimateTokensForText(block.Get("input").Raw)
+	case "tool_result", "web_search_tool_result":
+		return estimateContextContentTokens(block.Get("content"))
+	case "image":
+		return contextImageBlockTokens
+	case "document":
+		source := block.Get("source")
+		switch source.Get("type").String() {
+		case "text":
+			return estimateTokensForText(source.Get("data").String())
+		case "content":
+			return estimateContextContentTokens(source.Get("content"))
+		case "base64":
+			if n := len(source.Get("data").String()) / contextBase64DocCharsPerToken; n > contextMinDocumentTokens {
+				return n
+			}
+		}
+		return contextMinDocumentTokens
+	}
+	return estimateTokensForText(block.Raw)
+}
+
+// isContextTurnBoundary 判断消息是否为新一轮对话的起点：
+// user 消息且不包含 tool_result（tool_result 必须紧跟对应的 tool_use，不能作为保留部分的开头）。
+func isContextTurnBoundary(msg gjson.Result) bool {
+	if msg.Get("role").String() != "user" {
+		return false
+	}
+	content := msg.Get("content")
+	if !content.IsArray() {
+		return true
+	}
+	boundary := true
+	content.ForEach(func(_, block gjson.Result) bool {
+		if block.Get("type").String() == "tool_result" {
+			boundary = false
+			return false
+		}
+		return true
+	})
+	return boundary
+}
+
+// truncateContextMessages 从最早的轮次开始整轮丢弃消息，直到估算值不超过 limit。
+//
+// 只在轮次边界（不含 tool_result 的 user 消息）处截断，因此 tool_use/tool_result 始终成对保留；
+// 保留的消息原样输出、不改写任何内容块，assistant 消息中的 thinking 签名保持有效。
+// 即使只保留最后一轮仍超限时返回 ok=false。
+func truncateContextMessages(body []byte, base int, perMessage []int, limit int) (out []byte, dropped int, estimated int, ok bool) {
+	messages := gjson.GetBytes(body, "messages").Array()
+	if len(messages) != len(perMessage) || len(messages) < 2 {
+		return body, 0, 0, false
+	}
+	suffix := make([]int, len(messages)+1)
+	for i := len(messages) - 1; i >= 0; i-- {
+		suffix[i] = suffix[i+1] + perMessage[i]
+	}
+	for k := 1; k < len(messages); k++ {
+		if !isContextTurnBoundary(messages[k]) || base+suffix[k] > limit {
+			continue
+		}
+		var b strings.Builder
+		b.WriteByte('[')
+		for i, msg := range messages[k:] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(msg.Raw)
+		}
+		b.WriteByte(']')
+		next, setOK := setJSONRawBytes(body, "messages", []byte(b.String()))
+		if !setOK {
+			return body, 0, 0, false
+		}
+		return next, k, base + suffix[k], true
+	}
+	return body, 0, 0, false
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const contextPolicyCacheTTL = 30 * time.Second
+
+// ContextPolicyService 分组级上下文窗口超限处理
+//
+//   - 策略保存在 group_context_policies 表中，进程内整表缓存；
+//   - 上下文窗口取自策略覆盖值或模型目录（LiteLLM max_input_tokens），未知时不做处理；
+//   - 输入 token 使用与 count_tokens 本地回退一致的估算方式，max_tokens 与输入共享窗口；
+//   - 超限时按策略拒绝、整轮丢弃最早的对话或切换到长上下文模型。
+type ContextPolicyService struct {
+	repo         ContextPolicyRepository
+	groupRepo    GroupRepository
+	modelCatalog *ModelCatalogService
+	now          func() time.Time
+
+	policyMu     sync.RWMutex
+	policies     map[int64]*ContextPolicy
+	policiesAt   time.Time
+	policyReload sync.Mutex
+}
+
+// NewContextPolicyService 创建上下文窗口策略服务
+func NewContextPolicyService(repo ContextPolicyRepository, groupRepo GroupRepository, modelCatalog *ModelCatalogService) *ContextPolicyService {
+	return &ContextPolicyService{
+		repo:         repo,
+		groupRepo:    groupRepo,
+		modelCatalog: modelCatalog,
+		now:          time.Now,
+	}
+}
+
+// policyFor 返回分组的已启用策略（未配置或未启用时返回 nil）
+func (s *ContextPolicyService) policyFor(ctx context.Context, groupID *int64) *ContextPolicy {
+	if s == nil || s.repo == nil || groupID == nil || *groupID <= 0 {
+		return nil
+	}
+	s.policyMu.RLock()
+	policies, loadedAt := s.policies, s.policiesAt
+	s.policyMu.RUnlock()
+
+	if policies == nil || s.now().Sub(loadedAt) >= contextPolicyCacheTTL {
+		// 只允许一个请求回源，其他请求继续使用旧缓存
+		if s.policyReload.TryLock() {
+			s.reloadPolicies(ctx)
+			s.policyReload.Unlock()
+			s.policyMu.RLock()
+			policies = s.policies
+			s.policyMu.RUnlock()
+		}
+	}
+	if policy := policies[*groupID]; policy != nil && policy.Enabled {
+		return policy
+	}
+	return nil
+}
+
+func (s *ContextPolicyService) reloadPolicies(ctx context.Context) {
+	list, err := s.repo.ListPolicies(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.context_policy", "Warning: load context policies failed: %v", err)
+		s.policyMu.Lock()
+		// 失败时推迟下一次回源，避免每个请求都打到数据库
+		if s.policies == nil {
+			s.policies = map[int64]*ContextPolicy{}
+		}
+		s.policiesAt = s.now()
+		s.policyMu.Unlock()
+		return
+	}
+	policies := make(map[int64]*ContextPolicy, len(list))
+	for _, p := range list {
+		if p != nil {
+			policies[p.GroupID] = p
+		}
+	}
+	s.policyMu.Lock()
+	s.policies = policies
+	s.policiesAt = s.now()
+	s.policyMu.Unlock()
+}
+
+func (s *ContextPolicyService) invalidatePolicies() {
+	s.policyMu.Lock()
+	s.policies = nil
+	s.policyMu.Unlock()
+}
+
+// contextWindow 解析模型的上下文窗口，未知时返回 0
+func (s *ContextPolicyService) contextWindow(ctx context.Context, groupID *int64, model string) int {
+	if s.modelCatalog == nil {
+		return 0
+	}
+	return s.modelCatalog.ContextWindow(ctx, groupID, model)
+}
+
+// Apply 按分组策略检查 Claude Messages 请求是否超出上下文窗口。
+//
+// 未启用策略、窗口未知或未超限时返回 (nil, nil)；
+// 截断或切换模型时返回改写后的请求；无法处理时返回 *ContextWindowExceededError。
+func (s *ContextPolicyService) Apply(ctx context.Context, groupID *int64, model string, body []byte, maxTokens int) (*ContextPolicyDecision, error) {
+	policy := s.policyFor(ctx, groupID)
+	if policy == nil || len(body) == 0 {
+		return nil, nil
+	}
+	window := policy.ContextWindow
+	if window <= 0 {
+		window = s.contextWindow(ctx, groupID, model)
+	}
+	if window <= 0 {
+		return nil, nil
+	}
+	limit := contextInputLimit(window, policy.ReserveTokens, maxTokens)
+	// 不能按请求体字节数提前跳过：URL 图片、小文档等固定估算块的编码远小于其估算值
+	base, perMessage := estimateClaudeRequestTokens(body)
+	estimated := base
+	for _, n := range perMessage {
+		estimated += n
+	}
+	if estimated <= limit {
+		return nil, nil
+	}
+	exceeded := &ContextWindowExceededError{Model: model, EstimatedTokens: estimated, Limit: limit}
+
+	switch policy.Action {
+	case ContextActionTruncate:
+		out, dropped, remaining, ok := truncateContextMessages(body, base, perMessage, limit)
+		if !ok {
+			return nil, exceeded
+		}
+		return &ContextPolicyDecision{
+			Action:          ContextActionTruncate,
+			Body:            out,
+			Model:           model,
+			EstimatedTokens: remaining,
+			Limit:           limit,
+			DroppedMessages: dropped,
+		}, nil
+	case ContextActionRoute:
+		target := policy.LongContextModel
+		if target == "" || target == model {
+			return nil, exceeded
+		}
+		// 长上下文模型窗口未知时信任管理员配置直接切换
+		if targetWindow := s.contextWindow(ctx, groupID, target); targetWindow > 0 {
+			targetLimit := contextInputLimit(targetWindow, policy.ReserveTokens, maxTokens)
+			if estimated > targetLimit {
+				exceeded.Model, exceeded.Limit = target, targetLimit
+				return nil, exceeded
+			}
+			limit = targetLimit
+		}
+		out, ok := setJSONValueBytes(body, "model", target)
+		if !ok {
+			return nil, exceeded
+		}
+		return &ContextPolicyDecision{
+			Action:          ContextActionRoute,
+			Body:            out,
+			Model:           target,
+			EstimatedTokens: estimated,
+			Limit:           limit,
+		}, nil
+	}
+	return nil, exceeded
+}
+
+// GetPolicy 获取分组策略（未配置时返回默认的未启用策略）
+func (s *ContextPolicyService) GetPolicy(ctx context.Context, groupID int64) (*ContextPolicy, error) {
+	list, err := s.repo.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p != nil && p.GroupID == groupID {
+			return p, nil
+		}
+	}
+	return DefaultContextPolicy(groupID), nil
+}
+
+// SetPolicy 创建或更新分组策略
+func (s *ContextPolicyService) SetPolicy(ctx context.Context, policy *ContextPolicy) (*ContextPolicy, error) {
+	if err := policy.Normalize(); err != nil {
+		return nil, err
+	}
+	if s.groupRepo != nil {
+		if _, err := s.groupRepo.GetByIDLite(ctx, policy.GroupID); err != nil {
+			if errors.Is(err, ErrGroupNotFound) {
+				return nil, ErrGroupNotFound
+			}
+			return nil, fmt.Errorf("get group: %w", err)
+		}
+	}
+	policy.UpdatedAt = s.now()
+	if err := s.repo.UpsertPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+	s.invalidatePolicies()
+	return policy, nil
+}
+
+// DeletePolicy 删除分组策略（恢复为不检查）
+func (s *ContextPolicyService) DeletePolicy(ctx context.Context, groupID int64) error {
+	if err := s.repo.DeletePolicy(ctx, groupID); err != nil {
+		return err
+	}
+	s.invalidatePolicies()
+	return nil
+}
@@ -0,0 +1,164 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+type contextPolicyRepoStub struct {
+	policies  []*ContextPolicy
+	listCalls int
+}
+
+func (r *contextPolicyRepoStub) ListPolicies(ctx context.Context) ([]*ContextPolicy, error) {
+	r.listCalls++
+	return r.policies, nil
+}
+
+func (r *contextPolicyRepoStub) UpsertPolicy(ctx context.Context, policy *ContextPolicy) error {
+	r.policies = append(r.policies, policy)
+	return nil
+}
+
+func (r *contextPolicyRepoStub) DeletePolicy(ctx context.Context, groupID int64) error {
+	return nil
+}
+
+// contextPolicyTestBody 构造一段带工具调用与 thinking 签名的长对话，每轮约 1000 token
+func contextPolicyTestBody() []byte {
+	filler := strings.Repeat("word ", 800)
+	return []byte(`{"model":"claude-sonnet-4-5","max_tokens":1000,"system":"be brief","messages":[` +
+		`{"role":"user","content":"` + filler + `"},` +
+		`{"role":"assistant","content":[{"type":"thinking","thinking":"plan","signature":"sig-1"},{"type":"tool_use","id":"t1","name":"read","input":{"path":"a"}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"` + filler + `"}]},` +
+		`{"role":"assistant","content":[{"type":"text","text":"` + filler + `"}]},` +
+		`{"role":"user","content":"next task"},` +
+		`{"role":"assistant","content":[{"type":"thinking","thinking":"again","signature":"sig-2"},{"type":"tool_use","id":"t2","name":"read","input":{"path":"b"}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"t2","content":"` + filler + `"}]}]}`)
+}
+
+func TestTruncateContextMessages_KeepsToolPairsAndSignatures(t *testing.T) {
+	body := contextPolicyTestBody()
+	base, perMessage := estimateClaudeRequestTokens(body)
+	require.Len(t, perMessage, 7)
+	require.Greater(t, perMessage[0], 900)
+
+	// 只够保留最后一轮：tool_result 所在的 user 消息（index 2、6）不能作为截断起点
+	out, dropped, estimated, ok := truncateContextMessages(body, base, perMessage, 1500)
+	require.True(t, ok)
+	require.Equal(t, 4, dropped)
+	require.LessOrEqual(t, estimated, 1500)
+
+	messages := gjson.GetBytes(out, "messages").Array()
+	require.Len(t, messages, 3)
+	require.Equal(t, "next task", messages[0].Get("content").String())
+	require.Equal(t, "sig-2", messages[1].Get("content.0.signature").String())
+	require.Equal(t, "t2", messages[2].Get("content.0.tool_use_id").String())
+	require.Equal(t, "be brief", gjson.GetBytes(out, "system").String())
+
+	_, _, _, ok = truncateContextMessages(body, base, perMessage, 500)
+	require.False(t, ok)
+}
+
+func TestEstimateContextBlockTokens_FixedBlocks(t *testing.T) {
+	image := gjson.Parse(`{"type":"image","source":{"type":"base64","data":"` + strings.Repeat("A", 100000) + `"}}`)
+	require.Equal(t, contextImageBlockTokens, estimateContextBlockTokens(image))
+
+	doc := gjson.Parse(`{"type":"document","source":{"type":"base64","data":"` + strings.Repeat("A", 320000) + `"}}`)
+	require.Equal(t, 10000, estimateContextBlockTokens(doc))
+
+	textDoc := gjson.Parse(`{"type":"document","source":{"type":"text","data":"abcdefgh"}}`)
+	require.Equal(t, 2, estimateContextBlockTokens(textDoc))
+}
+
+func TestContextInputLimit(t *testing.T) {
+	require.Equal(t, 200000-2048-64000, contextInputLimit(200000, 2048, 64000))
+	require.Equal(t, 200000-2048, contextInputLimit(200000, 2048, 0))
+	// max_tokens 本身超出窗口时由上游校验，不再从输入上限中扣除
+	require.Equal(t, 200000-2048, contextInputLimit(200000, 2048, 500000))
+}
+
+func TestContextPolicyService_Apply(t *testing.T) {
+	repo := &contextPolicyRepoStub{policies: []*ContextPolicy{
+		{GroupID: 1, Enabled: true, Action: ContextActionReject, ContextWindow: 3000},
+		{GroupID: 2, Enabled: true, Action: ContextActionTruncate, ContextWindow: 3000},
+		{GroupID: 3, Enabled: true, Action: ContextActionRoute, LongContextModel: "claude-sonnet-4-5-1m", ContextWindow: 3000},
+		{GroupID: 4, Enabled: false, Action: ContextActionReject, ContextWindow: 3000},
+		{GroupID: 5, Enabled: true, Action: ContextActionReject, ContextWindow: 1000000},
+	}}
+	svc := NewContextPolicyService(repo, nil, nil)
+	ctx := context.Background()
+	body := contextPolicyTestBody()
+	group := func(id int64) *int64 { return &id }
+
+	decision, err := svc.Apply(ctx, group(1), "claude-sonnet-4-5", body, 1000)
+	require.Nil(t, decision)
+	var exceeded *ContextWindowExceededError
+	require.True(t, errors.As(err, &exceeded))
+	require.Equal(t, 2000, exceeded.Limit)
+	require.Contains(t, err.Error(), "prompt is too long")
+
+	decision, err = svc.Apply(ctx, group(2), "claude-sonnet-4-5", body, 1000)
+	require.NoError(t, err)
+	require.Equal(t, ContextActionTruncate, decision.Action)
+	require.Equal(t, 4, decision.DroppedMessages)
+	require.Equal(t, "claude-sonnet-4-5", decision.Model)
+
+	decision, err = svc.Apply(ctx, group(3), "claude-sonnet-4-5", body, 1000)
+	require.NoError(t, err)
+	require.Equal(t, ContextActionRoute, decision.Action)
+	require.Equal(t, "claude-sonnet-4-5-1m", gjson.GetBytes(decision.Body, "model").String())
+	require.Len(t, gjson.GetBytes(decision.Body, "messages").Array(), 7)
+
+	for _, groupID := range []*int64{group(4), group(5), group(9), nil} {
+		decision, err = svc.Apply(ctx, groupID, "claude-sonnet-4-5", body, 1000)
+		require.NoError(t, err)
+		require.Nil(t, decision)
+	}
+	require.Equal(t, 1, repo.listCalls)
+
+	// 未配置窗口覆盖且模型目录不可用时不做处理
+	repo.policies = []*ContextPolicy{{GroupID: 6, Enabled: true, Action: ContextActionReject}}
+	svc.invalidatePolicies()
+	decision, err = svc.Apply(ctx, group(6), "claude-sonnet-4-5", body, 1000)
+	require.NoError(t, err)
+	require.Nil(t, decision)
+
+	// URL 图片按固定 token 估算，请求体很小也可能超出上限
+	repo.policies = []*ContextPolicy{{GroupID: 7, Enabled: true, Action: ContextActionReject, ContextWindow: 3000}}
+	svc.invalidatePolicies()
+	imageBlock := `{"type":"image","source":{"type":"url","url":"https://example.com/a.png"}}`
+	small := []byte(`{"model":"claude-sonnet-4-5","messages":[{"role":"user","content":[` + imageBlock + `,` + imageBlock + `]}]}`)
+	require.Less(t, len(small), 2000)
+	decision, err = svc.Apply(ctx, group(7), "claude-sonnet-4-5", small, 1000)
+	require.Nil(t, decision)
+	require.True(t, errors.As(err, &exceeded))
+	require.Greater(t, exceeded.EstimatedTokens, exceeded.Limit)
+
+	var nilSvc *ContextPolicyService
+	decision, err = nilSvc.Apply(ctx, group(1), "claude-sonnet-4-5", body, 1000)
+	require.NoError(t, err)
+	require.Nil(t, decision)
+}
+
+func TestContextPolicy_Normalize(t *testing.T) {
+	policy := &ContextPolicy{Action: " Truncate "}
+	require.NoError(t, policy.Normalize())
+	require.Equal(t, ContextActionTruncate, policy.Action)
+
+	policy = &ContextPolicy{}
+	require.NoError(t, policy.Normalize())
+	require.Equal(t, ContextActionReject, policy.Action)
+
+	require.ErrorIs(t, (&ContextPolicy{Action: "summarize"}).Normalize(), ErrInvalidContextAction)
+	require.ErrorIs(t, (&ContextPolicy{Action: ContextActionRoute, LongContextModel: " "}).Normalize(), ErrContextRouteModelRequired)
+	require.ErrorIs(t, (&ContextPolicy{ContextWindow: -1}).Normalize(), ErrInvalidContextWindow)
+	require.ErrorIs(t, (&ContextPolicy{ReserveTokens: -1}).Normalize(), ErrInvalidContextReserve)
+}
@@ -1,15 +1,22 @@
 package service
 
 import (
+	"context"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
 	gocache "github.com/patrickmn/go-cache"
 )
 
-// digestSessionTTL 摘要会话默认 TTL
-const digestSessionTTL = 5 * time.Minute
+const (
+	// digestSessionTTL 摘要会话默认 TTL
+	digestSessionTTL = 5 * time.Minute
+	// digestSharedMissTTL 共享存储未命中后短时间内不再重复查询同一 chain，
+	// 避免新会话的每次请求都同步访问 Redis
+	digestSharedMissTTL = 10 * time.Second
+)
 
 // sessionEntry flat cache 条目
 type sessionEntry struct {
@@ -17,10 +24,18 @@ type sessionEntry struct {
 	accountID int64
 }
 
-// DigestSessionStore 内存摘要会话存储（flat cache 实现）
+// DigestSessionStore 摘要会话存储（flat cache 实现）
 // key: "{groupID}:{prefixHash}|{digestChain}" → *sessionEntry
+//
+// 默认仅进程内有效；多副本部署时通过 EnableClusterSharing 异步写入 ClusterStateCache，
+// 本地 cache 优先，只有本地完全未命中时才查共享存储（未命中结果短暂缓存），共享存储出错按未命中处理。
 type DigestSessionStore struct {
 	cache *gocache.Cache
+
+	shared       ClusterStateCache
+	writer       *clusterBindingWriter
+	sharedMisses *gocache.Cache
+	nodeID       string
 }
 
 // NewDigestSessionStore 创建内存摘要会话存储
@@ -30,6 +45,17 @@ func NewDigestSessionStore() *DigestSessionStore {
 	}
 }
 
+// EnableClusterSharing 启用跨副本共享，需在处理请求前调用。
+func (s *DigestSessionStore) EnableClusterSharing(shared ClusterStateCache, nodeID string) {
+	if s == nil || shared == nil {
+		return
+	}
+	s.shared = shared
+	s.writer = newClusterBindingWriter(shared)
+	s.sharedMisses = gocache.New(digestSharedMissTTL, time.Minute)
+	s.nodeID = nodeID
+}
+
 // Save 保存摘要会话。oldDigestChain 为 Find 返回的 matchedChain，用于删旧 key。
 func (s *DigestSessionStore) Save(groupID int64, prefixHash, digestChain, uuid string, accountID int64, oldDigestChain string) {
 	if digestChain == "" {
@@ -37,9 +63,18 @@ func (s *DigestSessionStore) Save(groupID int64, prefixHash, digestChain, uuid s
 	}
 	ns := buildNS(groupID, prefixHash)
 	s.cache.Set(ns+digestChain, &sessionEntry{uuid: uuid, accountID: accountID}, gocache.DefaultExpiration)
-	if oldDigestChain != "" && oldDigestChain != digestChain {
+	removeOld := oldDigestChain != "" && oldDigestChain != digestChain
+	if removeOld {
 		s.cache.Delete(ns + oldDigestChain)
 	}
+
+	if s.writer == nil {
+		return
+	}
+	s.writer.set(ClusterSessionKindDigest, ns+digestChain, ClusterBinding{NodeID: s.nodeID, Value: uuid, AccountID: accountID}, digestSessionTTL)
+	if removeOld {
+		s.writer.delete(ClusterSessionKindDigest, ns+oldDigestChain)
+	}
 }
 
 // Find 查找摘要会话，从完整 chain 逐段截断，返回最长匹配及对应 matchedChain。
@@ -48,18 +83,58 @@ func (s *DigestSessionStore) Find(groupID int64, prefixHash, digestChain string)
 		return "", 0, "", false
 	}
 	ns := buildNS(groupID, prefixHash)
-	chain := digestChain
-	for {
+	chains := digestChainCandidates(digestChain)
+
+	for _, chain := range chains {
 		if val, ok := s.cache.Get(ns + chain); ok {
 			if e, ok := val.(*sessionEntry); ok {
 				return e.uuid, e.accountID, chain, true
 			}
 		}
+	}
+	if s.shared == nil {
+		return "", 0, "", false
+	}
+	if _, missed := s.sharedMisses.Get(ns + digestChain); missed {
+		return "", 0, "", false
+	}
+
+	// 本地完全未命中：会话可能由其他副本建立，批量查询全部候选
+	keys := make([]string, len(chains))
+	for i, chain := range chains {
+		keys[i] = ns + chain
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStateTimeout)
+	defer cancel()
+	bindings, err := s.shared.GetBindings(ctx, ClusterSessionKindDigest, keys)
+	if err != nil {
+		// 共享存储不可用时按未命中处理
+		logger.LegacyPrintf("service.digest_session", "[DigestSession] shared find failed: %v", err)
+		s.sharedMisses.SetDefault(ns+digestChain, struct{}{})
+		return "", 0, "", false
+	}
+	for i, b := range bindings {
+		if b == nil || i >= len(chains) {
+			continue
+		}
+		s.cache.Set(keys[i], &sessionEntry{uuid: b.Value, accountID: b.AccountID}, gocache.DefaultExpiration)
+		return b.Value, b.AccountID, chains[i], true
+	}
+	s.sharedMisses.SetDefault(ns+digestChain, struct{}{})
+	return "", 0, "", false
+}
+
+// digestChainCandidates 返回从完整 chain 逐段截断得到的候选（由长到短）
+func digestChainCandidates(digestChain string) []string {
+	chains := []string{digestChain}
+	chain := digestChain
+	for {
 		i := strings.LastIndex(chain, "-")
 		if i < 0 {
-			return "", 0, "", false
+			return chains
 		}
 		chain = chain[:i]
+		chains = append(chains, chain)
 	}
 }
 
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+)
+
+// DirectorySubscriptionNote 标记由目录组同步分配的订阅；只有带此标记的订阅会在失去组成员资格时被撤销。
+const DirectorySubscriptionNote = "assigned by directory group sync"
+
+// DirectoryIdentity 是 LDAP/SAML 登录后得到的用户身份
+type DirectoryIdentity struct {
+	Provider string   // ldap / saml
+	Subject  string   // LDAP DN 或 SAML NameID
+	Email    string   // 目录中没有邮箱时为合成邮箱
+	Username string   // 显示名
+	Groups   []string // 原始组成员（DN 或组名）
+}
+
+type directorySyncUserStore interface {
+	GetByID(ctx context.Context, id int64) (*User, error)
+	UpdateConcurrency(ctx context.Context, id int64, amount int) error
+	AddGroupToAllowedGroups(ctx context.Context, userID int64, groupID int64) error
+	RemoveGroupFromUserAllowedGroups(ctx context.Context, userID int64, groupID int64) error
+}
+
+type directorySyncSubscriptions interface {
+	GetActiveSubscription(ctx context.Context, userID, groupID int64) (*UserSubscription, error)
+	AssignOrExtendSubscription(ctx context.Context, input *AssignSubscriptionInput) (*UserSubscription, bool, error)
+	RevokeSubscription(ctx context.Context, subscriptionID int64) error
+}
+
+// DirectoryGroupSyncService 在每次目录登录时按组映射重算用户的分组权限、订阅与并发数
+type DirectoryGroupSyncService struct {
+	userRepo             directorySyncUserStore
+	subscriptions        directorySyncSubscriptions
+	authCacheInvalidator APIKeyAuthCacheInvalidator
+}
+
+// NewDirectoryGroupSyncService creates a new DirectoryGroupSyncService
+func NewDirectoryGroupSyncService(userRepo UserRepository, subscriptionService *SubscriptionService, authCacheInvalidator APIKeyAuthCacheInvalidator) *DirectoryGroupSyncService {
+	return &DirectoryGroupSyncService{
+		userRepo:             userRepo,
+		subscriptions:        subscriptionService,
+		authCacheInvalidator: authCacheInvalidator,
+	}
+}
+
+// directoryGroupKeys 把目录组归一化为可比较的键：小写全名，DN 额外加入首个 RDN 的值（CN=Dev,OU=... → dev）
+func directoryGroupKeys(groups []string) map[string]struct{} {
+	keys := make(map[string]struct{}, len(groups)*2)
+	for _, g := range groups {
+		g = strings.ToLower(strings.TrimSpace(g))
+		if g == "" {
+			continue
+		}
+		keys[g] = struct{}{}
+		if !strings.Contains(g, "=") {
+			continue
+		}
+		first := g
+		if idx := strings.Index(g, ","); idx >= 0 {
+			first = g[:idx]
+		}
+		if eq := strings.Index(first, "="); eq >= 0 {
+			if v := strings.TrimSpace(first[eq+1:]); v != "" {
+				keys[v] = struct{}{}
+			}
+		}
+	}
+	return keys
+}
+
+// MatchDirectoryGroupMappings 返回与用户组成员匹配的映射
+func MatchDirectoryGroupMappings(mappings []config.DirectoryGroupMapping, groups []string) []config.DirectoryGroupMapping {
+	keys := directoryGroupKeys(groups)
+	var matched []config.DirectoryGroupMapping
+	for _, m := range mappings {
+		if _, ok := keys[strings.ToLower(strings.TrimSpace(m.DirectoryGroup))]; ok {
+			matched = append(matched, m)
+		}
+	}
+	return matched
+}
+
+// Sync 按组映射同步用户权限。映射中出现过的分组视为目录托管：
+// 命中的加上，未命中的从 allowed_groups 移除，并撤销由同步分配的订阅。
+// 并发数取命中映射中的最大值；没有命中任何映射时保持不变。管理员账号从不同步。
+func (s *DirectoryGroupSyncService) Sync(ctx context.Context, userID int64, mappings []config.DirectoryGroupMapping, groups []string) error {
+	if len(mappings) == 0 {
+		return nil
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	if user.IsAdmin() {
+		return nil
+	}
+
+	managedGroups := make(map[int64]struct{})
+	managedSubs := make(map[int64]struct{})
+	for _, m := range mappings {
+		for _, gid := range m.AllowedGroupIDs {
+			managedGroups[gid] = struct{}{}
+		}
+		for _, sub := range m.Subscriptions {
+			managedSubs[sub.GroupID] = struct{}{}
+		}
+	}
+
+	wantGroups := make(map[int64]struct{})
+	wantSubs := make(map[int64]int) // groupID → validity days（取最大）
+	concurrency := 0
+	for _, m := range MatchDirectoryGroupMappings(mappings, groups) {
+		for _, gid := range m.AllowedGroupIDs {
+			wantGroups[gid] = struct{}{}
+		}
+		for _, sub := range m.Subscriptions {
+			if sub.ValidityDays > wantSubs[sub.GroupID] {
+				wantSubs[sub.GroupID] = sub.ValidityDays
+			}
+		}
+		if m.Concurrency > concurrency {
+			concurrency = m.Concurrency
+		}
+	}
+
+	changed := false
+	current := make(map[int64]struct{}, len(user.AllowedGroups))
+	for _, gid := range user.AllowedGroups {
+		current[gid] = struct{}{}
+	}
+	for _, gid := range sortedGroupIDs(managedGroups) {
+		_, want := wantGroups[gid]
+		_, has := current[gid]
+		switch {
+		case want && !has:
+			if err := s.userRepo.AddGroupToAllowedGroups(ctx, userID, gid); err != nil {
+				return fmt.Errorf("add allowed group %d: %w", gid, err)
+			}
+			changed = true
+		case !want && has:
+			if err := s.userRepo.RemoveGroupFromUserAllowedGroups(ctx, userID, gid); err != nil {
+				return fmt.Errorf("remove allowed group %d: %w", gid, err)
+			}
+			changed = true
+		}
+	}
+
+	for _, gid := range sortedGroupIDs(managedSubs) {
+		active, err := s.subscriptions.GetActiveSubscription(ctx, userID, gid)
+		if err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+			return fmt.Errorf("get subscription for group %d: %w", gid, err)
+		}
+		days, want := wantSubs[gid]
+		switch {
+		case want && active == nil:
+			if _, _, err := s.subscriptions.AssignOrExtendSubscription(ctx, &AssignSubscriptionInput{
+				UserID:       userID,
+				GroupID:      gid,
+				ValidityDays: days,
+				Notes:        DirectorySubscriptionNote,
+			}); err != nil {
+				return fmt.Errorf("assign subscription for group %d: %w", gid, err)
+			}
+			changed = true
+		case !want && active != nil && active.Notes == DirectorySubscriptionNote:
+			if err := s.subscriptions.RevokeSubscription(ctx, active.ID); err != nil {
+				return fmt.Errorf("revoke subscription %d: %w", active.ID, err)
+			}
+			changed = true
+		}
+	}
+
+	if concurrency > 0 && concurrency != user.Concurrency {
+		if err := s.userRepo.UpdateConcurrency(ctx, userID, concurrency-user.Concurrency); err != nil {
+			return fmt.Errorf("update concurrency: %w", err)
+		}
+		changed = true
+	}
+
+	if changed && s.authCacheInvalidator != nil {
+		s.authCacheInvalidator.InvalidateAuthCacheByUserID(ctx, userID)
+	}
+	return nil
+}
+
+func sortedGroupIDs(set map[int64]struct{}) []int64 {
+	ids := make([]int64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
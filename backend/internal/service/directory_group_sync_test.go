@@ -0,0 +1,178 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type directorySyncUserStoreStub struct {
+	user        *User
+	added       []int64
+	removed     []int64
+	concurrency []int
+}
+
+func (s *directorySyncUserStoreStub) GetByID(_ context.Context, _ int64) (*User, error) {
+	cp := *s.user
+	return &cp, nil
+}
+
+func (s *directorySyncUserStoreStub) UpdateConcurrency(_ context.Context, _ int64, amount int) error {
+	s.concurrency = append(s.concurrency, amount)
+	s.user.Concurrency += amount
+	return nil
+}
+
+func (s *directorySyncUserStoreStub) AddGroupToAllowedGroups(_ context.Context, _ int64, groupID int64) error {
+	s.added = append(s.added, groupID)
+	s.user.AllowedGroups = append(s.user.AllowedGroups, groupID)
+	return nil
+}
+
+func (s *directorySyncUserStoreStub) RemoveGroupFromUserAllowedGroups(_ context.Context, _ int64, groupID int64) error {
+	s.removed = append(s.removed, groupID)
+	kept := s.user.AllowedGroups[:0]
+	for _, id := range s.user.AllowedGroups {
+		if id != groupID {
+			kept = append(kept, id)
+		}
+	}
+	s.user.AllowedGroups = kept
+	return nil
+}
+
+type directorySyncSubscriptionsStub struct {
+	active   map[int64]*UserSubscription
+	assigned []*AssignSubscriptionInput
+	revoked  []int64
+	nextID   int64
+}
+
+func (s *directorySyncSubscriptionsStub) GetActiveSubscription(_ context.Context, _ int64, groupID int64) (*UserSubscription, error) {
+	if sub, ok := s.active[groupID]; ok {
+		return sub, nil
+	}
+	return nil, ErrSubscriptionNotFound
+}
+
+func (s *directorySyncSubscriptionsStub) AssignOrExtendSubscription(_ context.Context, input *AssignSubscriptionInput) (*UserSubscription, bool, error) {
+	s.nextID++
+	s.assigned = append(s.assigned, input)
+	sub := &UserSubscription{ID: s.nextID, UserID: input.UserID, GroupID: input.GroupID, Notes: input.Notes}
+	s.active[input.GroupID] = sub
+	return sub, false, nil
+}
+
+func (s *directorySyncSubscriptionsStub) RevokeSubscription(_ context.Context, subscriptionID int64) error {
+	s.revoked = append(s.revoked, subscriptionID)
+	for gid, sub := range s.active {
+		if sub.ID == subscriptionID {
+			delete(s.active, gid)
+		}
+	}
+	return nil
+}
+
+type directorySyncInvalidatorStub struct {
+	userIDs []int64
+}
+
+func (s *directorySyncInvalidatorStub) InvalidateAuthCacheByKey(context.Context, string)    {}
+func (s *directorySyncInvalidatorStub) InvalidateAuthCacheByGroupID(context.Context, int64) {}
+func (s *directorySyncInvalidatorStub) InvalidateAuthCacheByUserID(_ context.Context, userID int64) {
+	s.userIDs = append(s.userIDs, userID)
+}
+
+func newDirectorySyncForTest(user *User) (*DirectoryGroupSyncService, *directorySyncUserStoreStub, *directorySyncSubscriptionsStub, *directorySyncInvalidatorStub) {
+	users := &directorySyncUserStoreStub{user: user}
+	subs := &directorySyncSubscriptionsStub{active: map[int64]*UserSubscription{}, nextID: 100}
+	inv := &directorySyncInvalidatorStub{}
+	return &DirectoryGroupSyncService{userRepo: users, subscriptions: subs, authCacheInvalidator: inv}, users, subs, inv
+}
+
+var testDirectoryMappings = []config.DirectoryGroupMapping{
+	{
+		DirectoryGroup:  "CN=AI-Users,OU=Groups,DC=corp,DC=example",
+		AllowedGroupIDs: []int64{10},
+		Concurrency:     3,
+	},
+	{
+		DirectoryGroup:  "ai-power",
+		AllowedGroupIDs: []int64{11},
+		Subscriptions:   []config.DirectorySubscriptionMapping{{GroupID: 20, ValidityDays: 30}},
+		Concurrency:     8,
+	},
+}
+
+func TestMatchDirectoryGroupMappings_DNAndCN(t *testing.T) {
+	matched := MatchDirectoryGroupMappings(testDirectoryMappings, []string{
+		"cn=ai-users,ou=groups,dc=corp,dc=example",
+		"CN=AI-Power,OU=Groups,DC=corp,DC=example",
+		"CN=Other,OU=Groups,DC=corp,DC=example",
+	})
+	require.Len(t, matched, 2)
+}
+
+func TestDirectoryGroupSync_GrantsOnJoin(t *testing.T) {
+	svc, users, subs, inv := newDirectorySyncForTest(&User{ID: 1, Concurrency: 5, AllowedGroups: []int64{99}})
+
+	err := svc.Sync(context.Background(), 1, testDirectoryMappings, []string{"CN=AI-Users,OU=Groups,DC=corp,DC=example", "ai-power"})
+	require.NoError(t, err)
+
+	require.Equal(t, []int64{10, 11}, users.added)
+	require.Empty(t, users.removed, "groups not managed by any mapping must be left alone")
+	require.Len(t, subs.assigned, 1)
+	require.Equal(t, int64(20), subs.assigned[0].GroupID)
+	require.Equal(t, 30, subs.assigned[0].ValidityDays)
+	require.Equal(t, DirectorySubscriptionNote, subs.assigned[0].Notes)
+	require.Equal(t, 8, users.user.Concurrency, "highest matching concurrency wins")
+	require.Equal(t, []int64{1}, inv.userIDs)
+}
+
+func TestDirectoryGroupSync_RevokesOnLeave(t *testing.T) {
+	svc, users, subs, _ := newDirectorySyncForTest(&User{ID: 1, Concurrency: 8, AllowedGroups: []int64{10, 11, 99}})
+	subs.active[20] = &UserSubscription{ID: 7, GroupID: 20, Notes: DirectorySubscriptionNote}
+
+	err := svc.Sync(context.Background(), 1, testDirectoryMappings, []string{"CN=AI-Users,OU=Groups,DC=corp,DC=example"})
+	require.NoError(t, err)
+
+	require.Empty(t, users.added)
+	require.Equal(t, []int64{11}, users.removed)
+	require.Equal(t, []int64{7}, subs.revoked)
+	require.Equal(t, 3, users.user.Concurrency)
+}
+
+func TestDirectoryGroupSync_KeepsManualSubscription(t *testing.T) {
+	svc, _, subs, inv := newDirectorySyncForTest(&User{ID: 1, Concurrency: 5})
+	subs.active[20] = &UserSubscription{ID: 7, GroupID: 20, Notes: "bought via payment"}
+
+	err := svc.Sync(context.Background(), 1, testDirectoryMappings, nil)
+	require.NoError(t, err)
+
+	require.Empty(t, subs.revoked, "subscriptions not assigned by sync must survive")
+	require.Empty(t, inv.userIDs, "nothing changed, cache untouched")
+}
+
+func TestDirectoryGroupSync_NoMappingsIsNoop(t *testing.T) {
+	svc, users, _, _ := newDirectorySyncForTest(&User{ID: 1, AllowedGroups: []int64{10}})
+	require.NoError(t, svc.Sync(context.Background(), 1, nil, []string{"ai-users"}))
+	require.Empty(t, users.added)
+	require.Empty(t, users.removed)
+}
+
+func TestDirectoryGroupSync_SkipsAdmin(t *testing.T) {
+	svc, users, subs, inv := newDirectorySyncForTest(&User{ID: 1, Role: RoleAdmin, Concurrency: 50, AllowedGroups: []int64{10, 11}})
+	subs.active[20] = &UserSubscription{ID: 7, GroupID: 20, Notes: DirectorySubscriptionNote}
+
+	require.NoError(t, svc.Sync(context.Background(), 1, testDirectoryMappings, nil))
+	require.Empty(t, users.added)
+	require.Empty(t, users.removed)
+	require.Empty(t, users.concurrency)
+	require.Empty(t, subs.revoked)
+	require.Empty(t, inv.userIDs)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+var (
+	ErrDirectorySyncFailed     = infraerrors.ServiceUnavailable("DIRECTORY_SYNC_FAILED", "failed to sync directory group permissions")
+	ErrDirectoryLinkRequired   = infraerrors.Conflict("DIRECTORY_LINK_REQUIRED", "an account with this email already exists; sign in with its password to link the directory identity")
+	ErrDirectoryAdminForbidden = infraerrors.Forbidden("DIRECTORY_ADMIN_FORBIDDEN", "administrator accounts cannot sign in with directory SSO")
+	ErrDirectoryIdentityLinked = infraerrors.Conflict("DIRECTORY_IDENTITY_LINKED", "this directory identity is already linked to another account")
+)
+
+// DirectoryLinkRepository 保存目录身份（provider + subject）与本地账号的显式关联
+type DirectoryLinkRepository interface {
+	// GetUserID 返回目录身份关联的用户 ID；未关联时返回 ErrUserNotFound
+	GetUserID(ctx context.Context, provider, subject string) (int64, error)
+	// Link 关联目录身份与用户；该身份已关联其他用户时返回 ErrDirectoryIdentityLinked
+	Link(ctx context.Context, provider, subject string, userID int64) error
+}
+
+// DirectorySSOService 串联 LDAP/SAML 身份、OAuth 式登录注册（含邀请码 pending 流程）与目录组同步。
+// 目录身份只按 (provider, subject) 关联到本地账号，绝不按邮箱自动绑定已有账号：
+// 否则任何能控制目录邮箱属性的人都能接管同邮箱的本地账号（包括管理员）。
+type DirectorySSOService struct {
+	authService *AuthService
+	userRepo    UserRepository
+	links       DirectoryLinkRepository
+	ldap        *LDAPAuthService
+	saml        *SAMLService
+	groupSync   *DirectoryGroupSyncService
+}
+
+// NewDirectorySSOService creates a new DirectorySSOService
+func NewDirectorySSOService(authService *AuthService, userRepo UserRepository, links DirectoryLinkRepository, ldap *LDAPAuthService, saml *SAMLService, groupSync *DirectoryGroupSyncService) *DirectorySSOService {
+	return &DirectorySSOService{
+		authService: authService,
+		userRepo:    userRepo,
+		links:       links,
+		ldap:        ldap,
+		saml:        saml,
+		groupSync:   groupSync,
+	}
+}
+
+// LDAP 返回 LDAP 认证服务
+func (s *DirectorySSOService) LDAP() *LDAPAuthService {
+	return s.ldap
+}
+
+// SAML 返回 SAML SP 服务
+func (s *DirectorySSOService) SAML() *SAMLService {
+	return s.saml
+}
+
+func (s *DirectorySSOService) groupMappings(provider string) []config.DirectoryGroupMapping {
+	switch provider {
+	case DirectoryProviderLDAP:
+		return s.ldap.GroupMappings()
+	case DirectoryProviderSAML:
+		return s.saml.GroupMappings()
+	}
+	return nil
+}
+
+// Login 以目录身份登录：已关联的身份直接登录，未关联且邮箱未被占用时注册新账号并建立关联，
+// 成功后按组映射同步权限。不签发 token：调用方需先完成第二步验证检查。
+// 邮箱已属于本地账号时返回 ErrDirectoryLinkRequired（管理员账号返回 ErrDirectoryAdminForbidden），
+// 需要邀请码时返回 ErrOAuthInvitationRequired，两者都应通过 CreatePendingToken 走后续流程。
+func (s *DirectorySSOService) Login(ctx context.Context, identity *DirectoryIdentity, invitationCode string) (*User, error) {
+	if strings.TrimSpace(identity.Subject) == "" {
+		return nil, ErrInvalidToken
+	}
+	userID, err := s.links.GetUserID(ctx, identity.Provider, identity.Subject)
+	var user *User
+	switch {
+	case err == nil:
+		user, err = s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			logger.LegacyPrintf("service.directory_sso", "[DirectorySSO] load linked user failed: provider=%s user=%d err=%v", identity.Provider, userID, err)
+			return nil, ErrServiceUnavailable
+		}
+		if !user.IsActive() {
+			return nil, ErrUserNotActive
+		}
+	case errors.Is(err, ErrUserNotFound):
+		user, err = s.authService.RegisterOAuthUser(ctx, identity.Email, identity.Username, invitationCode)
+		if errors.Is(err, ErrEmailExists) {
+			return nil, s.linkRequiredError(ctx, identity.Email)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.links.Link(ctx, identity.Provider, identity.Subject, user.ID); err != nil {
+			return nil, err
+		}
+	default:
+		logger.LegacyPrintf("service.directory_sso", "[DirectorySSO] lookup link failed: provider=%s err=%v", identity.Provider, err)
+		return nil, ErrServiceUnavailable
+	}
+	if err := s.sync(ctx, user, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkWithPassword 把目录身份显式关联到同邮箱的本地账号。调用方持有目录登录签发的 pending token
+// （证明目录身份），这里再校验本地账号密码（证明账号所有权）；管理员账号不允许关联。
+func (s *DirectorySSOService) LinkWithPassword(ctx context.Context, identity *DirectoryIdentity, password string) (*User, error) {
+	if strings.TrimSpace(identity.Subject) == "" {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		logger.LegacyPrintf("service.directory_sso", "[DirectorySSO] load user for link failed: provider=%s err=%v", identity.Provider, err)
+		return nil, ErrServiceUnavailable
+	}
+	if !s.authService.CheckPassword(password, user.PasswordHash) {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.IsActive() {
+		return nil, ErrUserNotActive
+	}
+	if user.IsAdmin() {
+		return nil, ErrDirectoryAdminForbidden
+	}
+	if err := s.links.Link(ctx, identity.Provider, identity.Subject, user.ID); err != nil {
+		return nil, err
+	}
+	if err := s.sync(ctx, user, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *DirectorySSOService) linkRequiredError(ctx context.Context, email string) error {
+	existing, err := s.userRepo.GetByEmail(ctx, email)
+	if err == nil && existing.IsAdmin() {
+		return ErrDirectoryAdminForbidden
+	}
+	return ErrDirectoryLinkRequired
+}
+
+func (s *DirectorySSOService) sync(ctx context.Context, user *User, identity *DirectoryIdentity) error {
+	if err := s.groupSync.Sync(ctx, user.ID, s.groupMappings(identity.Provider), identity.Groups); err != nil {
+		// 同步失败时不下发 token：否则用户可能带着已被撤销的目录权限继续使用
+		logger.LegacyPrintf("service.directory_sso", "[DirectorySSO] group sync failed: provider=%s user=%d err=%v", identity.Provider, user.ID, err)
+		return ErrDirectorySyncFailed
+	}
+	return nil
+}
+
+// CreatePendingToken 为需要邀请码的目录用户签发 pending token。
+// 只保留命中映射的组，避免 AD 大量 memberOf 撑爆 token。
+func (s *DirectorySSOService) CreatePendingToken(identity *DirectoryIdentity) (string, error) {
+	pending := *identity
+	pending.Groups = nil
+	for _, m := range MatchDirectoryGroupMappings(s.groupMappings(identity.Provider), identity.Groups) {
+		pending.Groups = append(pending.Groups, m.DirectoryGroup)
+	}
+	return s.authService.CreatePendingDirectoryToken(&pending)
+}
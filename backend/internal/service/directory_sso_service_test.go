@@ -0,0 +1,228 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type directoryUserRepoStub struct {
+	UserRepository
+	byID   map[int64]*User
+	nextID int64
+}
+
+func (s *directoryUserRepoStub) add(u *User) *User {
+	s.byID[u.ID] = u
+	return u
+}
+
+func (s *directoryUserRepoStub) GetByID(_ context.Context, id int64) (*User, error) {
+	if u, ok := s.byID[id]; ok {
+		cp := *u
+		return &cp, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *directoryUserRepoStub) GetByEmail(_ context.Context, email string) (*User, error) {
+	for _, u := range s.byID {
+		if u.Email == email {
+			cp := *u
+			return &cp, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *directoryUserRepoStub) Create(_ context.Context, u *User) error {
+	if _, err := s.GetByEmail(context.Background(), u.Email); err == nil {
+		return ErrEmailExists
+	}
+	s.nextID++
+	u.ID = s.nextID
+	cp := *u
+	s.byID[u.ID] = &cp
+	return nil
+}
+
+func (s *directoryUserRepoStub) UpdateConcurrency(_ context.Context, id int64, amount int) error {
+	s.byID[id].Concurrency += amount
+	return nil
+}
+
+func (s *directoryUserRepoStub) AddGroupToAllowedGroups(_ context.Context, userID int64, groupID int64) error {
+	s.byID[userID].AllowedGroups = append(s.byID[userID].AllowedGroups, groupID)
+	return nil
+}
+
+func (s *directoryUserRepoStub) RemoveGroupFromUserAllowedGroups(_ context.Context, userID int64, groupID int64) error {
+	u := s.byID[userID]
+	kept := u.AllowedGroups[:0]
+	for _, id := range u.AllowedGroups {
+		if id != groupID {
+			kept = append(kept, id)
+		}
+	}
+	u.AllowedGroups = kept
+	return nil
+}
+
+type directoryLinkRepoStub struct {
+	links map[string]int64
+}
+
+func (s *directoryLinkRepoStub) GetUserID(_ context.Context, provider, subject string) (int64, error) {
+	if id, ok := s.links[provider+"|"+subject]; ok {
+		return id, nil
+	}
+	return 0, ErrUserNotFound
+}
+
+func (s *directoryLinkRepoStub) Link(_ context.Context, provider, subject string, userID int64) error {
+	key := provider + "|" + subject
+	if id, ok := s.links[key]; ok && id != userID {
+		return ErrDirectoryIdentityLinked
+	}
+	s.links[key] = userID
+	return nil
+}
+
+func newDirectorySSOServiceForTest(t *testing.T) (*DirectorySSOService, *directoryUserRepoStub, *directoryLinkRepoStub) {
+	t.Helper()
+	cfg := &config.Config{
+		JWT: config.JWTConfig{Secret: "test-secret", ExpireHour: 1},
+		LDAP: config.LDAPConnectConfig{GroupMappings: []config.DirectoryGroupMapping{
+			{DirectoryGroup: "ai-users", AllowedGroupIDs: []int64{10}, Concurrency: 8},
+		}},
+	}
+	users := &directoryUserRepoStub{byID: map[int64]*User{}, nextID: 100}
+	links := &directoryLinkRepoStub{links: map[string]int64{}}
+	settingService := NewSettingService(&settingRepoStub{values: map[string]string{
+		SettingKeyRegistrationEnabled: "true",
+	}}, cfg)
+	authService := NewAuthService(nil, users, nil, nil, cfg, settingService, nil, nil, nil, nil, nil)
+	svc := NewDirectorySSOService(authService, users, links, NewLDAPAuthService(cfg), NewSAMLService(cfg),
+		NewDirectoryGroupSyncService(users, nil, nil))
+	return svc, users, links
+}
+
+func testDirectoryIdentity() *DirectoryIdentity {
+	return &DirectoryIdentity{
+		Provider: DirectoryProviderLDAP,
+		Subject:  "CN=Alice,OU=Staff,DC=corp,DC=example",
+		Email:    "alice@corp.example",
+		Username: "Alice",
+		Groups:   []string{"CN=AI-Users,OU=Groups,DC=corp,DC=example"},
+	}
+}
+
+func mustHashPassword(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func TestDirectorySSOLogin_RegistersAndLinksNewUser(t *testing.T) {
+	svc, users, links := newDirectorySSOServiceForTest(t)
+	ctx := context.Background()
+
+	user, err := svc.Login(ctx, testDirectoryIdentity(), "")
+	require.NoError(t, err)
+	require.Equal(t, "alice@corp.example", user.Email)
+	require.Equal(t, user.ID, links.links[DirectoryProviderLDAP+"|CN=Alice,OU=Staff,DC=corp,DC=example"])
+	require.Equal(t, []int64{10}, users.byID[user.ID].AllowedGroups)
+
+	// 再次登录走关联，即使目录邮箱已变化也不会注册新账号
+	identity := testDirectoryIdentity()
+	identity.Email = "alice.liddell@corp.example"
+	again, err := svc.Login(ctx, identity, "")
+	require.NoError(t, err)
+	require.Equal(t, user.ID, again.ID)
+	require.Len(t, users.byID, 1)
+}
+
+func TestDirectorySSOLogin_DoesNotBindExistingLocalAccount(t *testing.T) {
+	svc, users, links := newDirectorySSOServiceForTest(t)
+	local := users.add(&User{ID: 1, Email: "alice@corp.example", Role: RoleUser, Status: StatusActive, Concurrency: 2, AllowedGroups: []int64{}})
+
+	_, err := svc.Login(context.Background(), testDirectoryIdentity(), "")
+	require.ErrorIs(t, err, ErrDirectoryLinkRequired)
+	require.Empty(t, links.links)
+	require.Empty(t, local.AllowedGroups, "unlinked accounts must not be group-synced")
+	require.Equal(t, 2, local.Concurrency)
+}
+
+func TestDirectorySSOLogin_RejectsAdminAccount(t *testing.T) {
+	svc, users, links := newDirectorySSOServiceForTest(t)
+	admin := users.add(&User{ID: 1, Email: "alice@corp.example", Role: RoleAdmin, Status: StatusActive, Concurrency: 50})
+
+	_, err := svc.Login(context.Background(), testDirectoryIdentity(), "")
+	require.ErrorIs(t, err, ErrDirectoryAdminForbidden)
+	require.Empty(t, links.links)
+	require.Equal(t, 50, admin.Concurrency)
+}
+
+func TestDirectorySSOLinkWithPassword(t *testing.T) {
+	svc, users, links := newDirectorySSOServiceForTest(t)
+	ctx := context.Background()
+	local := users.add(&User{
+		ID:            1,
+		Email:         "alice@corp.example",
+		PasswordHash:  mustHashPassword(t, "local-pass"),
+		Role:          RoleUser,
+		Status:        StatusActive,
+		Concurrency:   2,
+		AllowedGroups: []int64{},
+	})
+
+	_, err := svc.LinkWithPassword(ctx, testDirectoryIdentity(), "wrong-pass")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	require.Empty(t, links.links)
+
+	user, err := svc.LinkWithPassword(ctx, testDirectoryIdentity(), "local-pass")
+	require.NoError(t, err)
+	require.Equal(t, local.ID, user.ID)
+	require.Equal(t, local.ID, links.links[DirectoryProviderLDAP+"|CN=Alice,OU=Staff,DC=corp,DC=example"])
+	require.Equal(t, []int64{10}, local.AllowedGroups)
+	require.Equal(t, 8, local.Concurrency)
+
+	// 关联后目录登录直接命中该账号
+	again, err := svc.Login(ctx, testDirectoryIdentity(), "")
+	require.NoError(t, err)
+	require.Equal(t, local.ID, again.ID)
+}
+
+func TestDirectorySSOLinkWithPassword_RejectsAdmin(t *testing.T) {
+	svc, users, links := newDirectorySSOServiceForTest(t)
+	users.add(&User{
+		ID:           1,
+		Email:        "alice@corp.example",
+		PasswordHash: mustHashPassword(t, "admin-pass"),
+		Role:         RoleAdmin,
+		Status:       StatusActive,
+	})
+
+	_, err := svc.LinkWithPassword(context.Background(), testDirectoryIdentity(), "admin-pass")
+	require.ErrorIs(t, err, ErrDirectoryAdminForbidden)
+	require.Empty(t, links.links)
+}
+
+func TestDirectorySSOLogin_LinkedAdminIsNotGroupSynced(t *testing.T) {
+	svc, users, links := newDirectorySSOServiceForTest(t)
+	// 目录注册后被提升为管理员的账号：可以登录，但目录组不再改写其权限
+	admin := users.add(&User{ID: 1, Email: "alice@corp.example", Role: RoleAdmin, Status: StatusActive, Concurrency: 50})
+	links.links[DirectoryProviderLDAP+"|CN=Alice,OU=Staff,DC=corp,DC=example"] = admin.ID
+
+	user, err := svc.Login(context.Background(), testDirectoryIdentity(), "")
+	require.NoError(t, err)
+	require.Equal(t, admin.ID, user.ID)
+	require.Empty(t, admin.AllowedGroups)
+	require.Equal(t, 50, admin.Concurrency)
+}
@@ -33,6 +33,8 @@ const (
 	AccountTypeAPIKey     = domain.AccountTypeAPIKey     // API Key类型账号
 	AccountTypeUpstream   = domain.AccountTypeUpstream   // 上游透传类型账号（通过 Base URL + API Key 连接上游）
 	AccountTypeBedrock    = domain.AccountTypeBedrock    // AWS Bedrock 类型账号（通过 SigV4 签名或 API Key 连接 Bedrock，由 credentials.auth_mode 区分）
+	AccountTypeVertex     = domain.AccountTypeVertex     // Google Vertex AI 类型账号（服务账号 JSON 换取 access token，支持 Claude 与 Gemini 模型）
+	AccountTypeAzure      = domain.AccountTypeAzure      // Azure OpenAI 类型账号（资源端点 + 部署名映射，API Key 或 Entra ID 客户端凭据认证）
 )
 
 // Redeem type constants
@@ -74,6 +76,15 @@ const LinuxDoConnectSyntheticEmailDomain = "@linuxdo-connect.invalid"
 // OIDCConnectSyntheticEmailDomain 是 OIDC 用户的合成邮箱后缀（RFC 保留域名）。
 const OIDCConnectSyntheticEmailDomain = "@oidc-connect.invalid"
 
+// DirectorySSOSyntheticEmailDomain 是 LDAP/SAML 中缺少邮箱属性的用户的合成邮箱后缀（RFC 保留域名）。
+const DirectorySSOSyntheticEmailDomain = "@directory-sso.invalid"
+
+// Directory SSO providers
+const (
+	DirectoryProviderLDAP = "ldap"
+	DirectoryProviderSAML = "saml"
+)
+
 // Setting keys
 const (
 	// 注册设置
@@ -102,6 +113,9 @@ const (
 	// TOTP 双因素认证设置
 	SettingKeyTotpEnabled = "totp_enabled" // 是否启用 TOTP 2FA 功能
 
+	// WebAuthn 通行密钥设置（功能开关在 config.webauthn）
+	SettingKeyRequirePasskeyForAdmins = "require_passkey_for_admins" // 管理员登录必须使用通行密钥
+
 	// LinuxDo Connect OAuth 登录设置
 	SettingKeyLinuxDoConnectEnabled      = "linuxdo_connect_enabled"
 	SettingKeyLinuxDoConnectClientID     = "linuxdo_connect_client_id"
@@ -261,6 +275,13 @@ const (
 
 	// Web Search Emulation
 	SettingKeyWebSearchEmulationConfig = "web_search_emulation_config" // JSON 配置
+
+	// Referral Program
+	SettingKeyReferralConfig         = "referral_config"          // JSON 配置
+	SettingKeyReferralUsageWatermark = "referral_usage_watermark" // 消费佣金结算游标（usage_logs.id）
+
+	// Fair Share
+	SettingKeyFairShareSettings = "fair_share_settings" // 分组内公平准入配置（JSON）
 )
 
 // AdminAPIKeyPrefix is the prefix for admin API keys (distinct from user "sk-" keys).
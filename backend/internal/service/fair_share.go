@@ -0,0 +1,101 @@
+package service
+
+import "time"
+
+// 公平调度租户类型
+const (
+	FairShareTenantUser   = "user"
+	FairShareTenantAPIKey = "api_key"
+)
+
+// FairShareSettings 分组内公平调度配置（DB: fair_share_settings）
+//
+// 开启后，同一分组内的用户（或 API Key）按权重分享分组账号总并发：
+// 分组未满载时请求直接放行；满载后新请求进入分组等待队列，按差额轮询（DRR）出队，
+// 已超出公平份额 + 突发额度的租户会让位给其他租户。
+type FairShareSettings struct {
+	Enabled bool `json:"enabled"`
+	// PerAPIKey 以 API Key 为调度单位（默认以用户为单位）
+	PerAPIKey bool `json:"per_api_key"`
+	// BurstAllowance 允许租户在公平份额之外额外占用的并发数
+	BurstAllowance int `json:"burst_allowance"`
+	// DefaultWeight 未单独配置权重的租户使用的默认权重
+	DefaultWeight float64 `json:"default_weight"`
+	// MaxWaitSeconds 分组等待队列的最长等待时间
+	MaxWaitSeconds int `json:"max_wait_seconds"`
+	// UserWeights 用户权重（user_id -> weight）
+	UserWeights map[int64]float64 `json:"user_weights,omitempty"`
+	// APIKeyWeights API Key 权重（api_key_id -> weight），仅 PerAPIKey 模式生效，未配置时回退到所属用户权重
+	APIKeyWeights map[int64]float64 `json:"api_key_weights,omitempty"`
+}
+
+// DefaultFairShareSettings 返回默认的公平调度配置（默认关闭）
+func DefaultFairShareSettings() *FairShareSettings {
+	return &FairShareSettings{
+		Enabled:        false,
+		BurstAllowance: 2,
+		DefaultWeight:  1,
+		MaxWaitSeconds: 60,
+	}
+}
+
+// weightFor 解析租户权重
+func (s *FairShareSettings) weightFor(userID, apiKeyID int64) float64 {
+	if s.PerAPIKey {
+		if w, ok := s.APIKeyWeights[apiKeyID]; ok && w > 0 {
+			return w
+		}
+	}
+	if w, ok := s.UserWeights[userID]; ok && w > 0 {
+		return w
+	}
+	if s.DefaultWeight > 0 {
+		return s.DefaultWeight
+	}
+	return 1
+}
+
+// MaxWait 返回分组等待队列的最长等待时间
+func (s *FairShareSettings) MaxWait() time.Duration {
+	if s == nil || s.MaxWaitSeconds <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(s.MaxWaitSeconds) * time.Second
+}
+
+// FairShareRequest 一次公平调度准入请求
+type FairShareRequest struct {
+	GroupID          int64
+	Platform         string
+	HasForcePlatform bool
+	UserID           int64
+	APIKeyID         int64
+}
+
+// FairShareGroupStats 分组公平调度实时状态
+type FairShareGroupStats struct {
+	GroupID   int64                  `json:"group_id"`
+	Capacity  int                    `json:"capacity"`
+	InFlight  int                    `json:"in_flight"`
+	Waiting   int                    `json:"waiting"`
+	AvgHoldMs int64                  `json:"avg_hold_ms"`
+	Tenants   []FairShareTenantStats `json:"tenants"`
+}
+
+// FairShareTenantStats 租户（用户或 API Key）公平调度实时状态
+type FairShareTenantStats struct {
+	TenantType string  `json:"tenant_type"`
+	TenantID   int64   `json:"tenant_id"`
+	UserID     int64   `json:"user_id"`
+	Weight     float64 `json:"weight"`
+	InFlight   int     `json:"in_flight"`
+	Waiting    int     `json:"waiting"`
+	// FairShare 当前活跃租户下的公平份额（含突发额度）
+	FairShare int `json:"fair_share"`
+	// QueuePosition 队首请求预计的出队位置（1 起，无等待时为 0）
+	QueuePosition int `json:"queue_position"`
+	// EstimatedWaitMs 队首请求的预计等待时间
+	EstimatedWaitMs int64 `json:"estimated_wait_ms"`
+	// OldestWaitMs 队首请求已等待时间
+	OldestWaitMs int64 `json:"oldest_wait_ms"`
+}
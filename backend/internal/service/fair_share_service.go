@@ -0,0 +1,465 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	fairShareSettingsTTL = 10 * time.Second
+	fairShareCapacityTTL = 15 * time.Second
+	// fairShareHoldEWMAAlpha 平均占用时长的 EWMA 平滑系数
+	fairShareHoldEWMAAlpha = 0.2
+)
+
+// FairShareService 分组内加权公平准入
+//
+// 分组总容量 = 分组内可调度账号的并发上限之和。分组未满载且无人排队时请求直接放行；
+// 满载后请求进入按租户（用户或 API Key）划分的等待队列，由差额轮询（DRR）按权重出队：
+// 每个租户的公平份额为 ceil(容量 × 权重 / 活跃租户总权重) + 突发额度，
+// 已超出份额的租户让位于其他租户；仅当没有其他租户排队时才继续使用空闲容量（work-conserving）。
+//
+// 准入状态保存在进程内存中，多副本部署时每个实例独立调度各自承接的流量。
+type FairShareService struct {
+	loadSettings func(ctx context.Context) (*FairShareSettings, error)
+	loadCapacity func(ctx context.Context, req FairShareRequest) (int, error)
+	now          func() time.Time
+
+	mu         sync.Mutex
+	settings   *FairShareSettings
+	settingsAt time.Time
+	capacities map[string]fairShareCapacityEntry
+	groups     map[int64]*fairShareGroup
+}
+
+type fairShareCapacityEntry struct {
+	capacity int
+	at       time.Time
+}
+
+type fairShareGroup struct {
+	id       int64
+	capacity int
+	burst    int
+	inflight int
+	waiting  int
+	tenants  map[string]*fairShareTenant
+	// active 有排队请求的租户，按 DRR 轮询顺序排列
+	active  []*fairShareTenant
+	cursor  int
+	avgHold time.Duration
+}
+
+type fairShareTenant struct {
+	key        string
+	tenantType string
+	tenantID   int64
+	userID     int64
+	weight     float64
+	inflight   int
+	queue      []*FairShareTicket
+	deficit    float64
+	// credited 本轮 DRR 访问是否已累加 quantum
+	credited bool
+}
+
+// FairShareTicket 公平准入凭证
+//
+// Ready() 关闭表示已获准入；无论是否获准，调用方都必须调用 Release()
+// （未获准时为取消排队，已获准时为归还容量），Release 可重复调用。
+type FairShareTicket struct {
+	svc        *FairShareService
+	group      *fairShareGroup
+	tenant     *fairShareTenant
+	ready      chan struct{}
+	admitted   bool
+	released   bool
+	enqueuedAt time.Time
+	admittedAt time.Time
+}
+
+// NewFairShareService 创建公平准入服务
+func NewFairShareService(settingService *SettingService, snapshotService *SchedulerSnapshotService) *FairShareService {
+	s := &FairShareService{
+		now:        time.Now,
+		capacities: make(map[string]fairShareCapacityEntry),
+		groups:     make(map[int64]*fairShareGroup),
+	}
+	if settingService != nil {
+		s.loadSettings = settingService.GetFairShareSettings
+	}
+	if snapshotService != nil {
+		s.loadCapacity = func(ctx context.Context, req FairShareRequest) (int, error) {
+			groupID := req.GroupID
+			accounts, _, err := snapshotService.ListSchedulableAccounts(ctx, &groupID, req.Platform, req.HasForcePlatform)
+			if err != nil {
+				return 0, err
+			}
+			return fairShareCapacityOf(accounts), nil
+		}
+	}
+	return s
+}
+
+// fairShareCapacityOf 计算分组总并发；存在不限并发的账号时返回 0（不做公平准入）
+func fairShareCapacityOf(accounts []Account) int {
+	total := 0
+	for i := range accounts {
+		if !accounts[i].IsSchedulable() {
+			continue
+		}
+		if accounts[i].Concurrency <= 0 {
+			return 0
+		}
+		total += accounts[i].Concurrency
+	}
+	return total
+}
+
+// Settings 返回当前生效的公平准入配置（带进程内缓存）
+func (s *FairShareService) Settings(ctx context.Context) *FairShareSettings {
+	if s == nil {
+		return DefaultFairShareSettings()
+	}
+	now := s.now()
+	s.mu.Lock()
+	if s.settings != nil && now.Sub(s.settingsAt) < fairShareSettingsTTL {
+		settings := s.settings
+		s.mu.Unlock()
+		return settings
+	}
+	s.mu.Unlock()
+
+	settings := DefaultFairShareSettings()
+	if s.loadSettings != nil {
+		if loaded, err := s.loadSettings(ctx); err == nil && loaded != nil {
+			settings = loaded
+		}
+	}
+	s.mu.Lock()
+	s.settings = settings
+	s.settingsAt = now
+	s.mu.Unlock()
+	return settings
+}
+
+func (s *FairShareService) capacity(ctx context.Context, req FairShareRequest) int {
+	if s.loadCapacity == nil {
+		return 0
+	}
+	key := fmt.Sprintf("%d:%s:%t", req.GroupID, req.Platform, req.HasForcePlatform)
+	now := s.now()
+	s.mu.Lock()
+	entry, ok := s.capacities[key]
+	s.mu.Unlock()
+	if ok && now.Sub(entry.at) < fairShareCapacityTTL {
+		return entry.capacity
+	}
+
+	capacity, err := s.loadCapacity(ctx, req)
+	if err != nil {
+		// 加载失败时沿用旧值，避免抖动
+		if ok {
+			return entry.capacity
+		}
+		return 0
+	}
+	s.mu.Lock()
+	s.capacities[key] = fairShareCapacityEntry{capacity: capacity, at: now}
+	s.mu.Unlock()
+	return capacity
+}
+
+// Acquire 申请分组准入
+//
+// 未开启、无分组或分组不限并发时返回 nil ticket（直接放行）。
+// 返回的 ticket 可能尚未获准，调用方需等待 Ready() 或自行超时后 Release()。
+func (s *FairShareService) Acquire(ctx context.Context, req FairShareRequest) (*FairShareTicket, error) {
+	if s == nil || req.GroupID <= 0 {
+		return nil, nil
+	}
+	settings := s.Settings(ctx)
+	if settings == nil || !settings.Enabled {
+		return nil, nil
+	}
+	capacity := s.capacity(ctx, req)
+	if capacity <= 0 {
+		return nil, nil
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.groups[req.GroupID]
+	if g == nil {
+		g = &fairShareGroup{id: req.GroupID, tenants: make(map[string]*fairShareTenant)}
+		s.groups[req.GroupID] = g
+	}
+	g.capacity = capacity
+	g.burst = max(settings.BurstAllowance, 0)
+
+	t := g.tenantLocked(settings, req)
+	ticket := &FairShareTicket{
+		svc:        s,
+		group:      g,
+		tenant:     t,
+		ready:      make(chan struct{}),
+		enqueuedAt: now,
+	}
+	if g.waiting == 0 && g.inflight < g.capacity {
+		g.admitLocked(ticket, now)
+		return ticket, nil
+	}
+
+	if len(t.queue) == 0 {
+		g.active = append(g.active, t)
+	}
+	t.queue = append(t.queue, ticket)
+	g.waiting++
+	g.dispatchLocked(now)
+	return ticket, nil
+}
+
+// Ready 获准后关闭
+func (t *FairShareTicket) Ready() <-chan struct{} {
+	return t.ready
+}
+
+// Release 取消排队或归还容量（幂等）
+func (t *FairShareTicket) Release() {
+	if t == nil || t.svc == nil {
+		return
+	}
+	s := t.svc
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.released {
+		return
+	}
+	t.released = true
+
+	g := t.group
+	tenant := t.tenant
+	if t.admitted {
+		g.inflight--
+		tenant.inflight--
+		hold := now.Sub(t.admittedAt)
+		if g.avgHold <= 0 {
+			g.avgHold = hold
+		} else {
+			g.avgHold = time.Duration(fairShareHoldEWMAAlpha*float64(hold) + (1-fairShareHoldEWMAAlpha)*float64(g.avgHold))
+		}
+	} else {
+		for i, queued := range tenant.queue {
+			if queued == t {
+				tenant.queue = append(tenant.queue[:i], tenant.queue[i+1:]...)
+				g.waiting--
+				break
+			}
+		}
+		if len(tenant.queue) == 0 {
+			g.deactivateLocked(tenant)
+		}
+	}
+
+	if tenant.inflight <= 0 && len(tenant.queue) == 0 {
+		delete(g.tenants, tenant.key)
+	}
+	g.dispatchLocked(now)
+}
+
+func (g *fairShareGroup) tenantLocked(settings *FairShareSettings, req FairShareRequest) *fairShareTenant {
+	tenantType, tenantID := FairShareTenantUser, req.UserID
+	if settings.PerAPIKey && req.APIKeyID > 0 {
+		tenantType, tenantID = FairShareTenantAPIKey, req.APIKeyID
+	}
+	key := fmt.Sprintf("%s:%d", tenantType, tenantID)
+	t := g.tenants[key]
+	if t == nil {
+		t = &fairShareTenant{key: key, tenantType: tenantType, tenantID: tenantID, userID: req.UserID}
+		g.tenants[key] = t
+	}
+	t.weight = settings.weightFor(req.UserID, req.APIKeyID)
+	return t
+}
+
+func (g *fairShareGroup) admitLocked(ticket *FairShareTicket, now time.Time) {
+	ticket.admitted = true
+	ticket.admittedAt = now
+	g.inflight++
+	ticket.tenant.inflight++
+	close(ticket.ready)
+}
+
+func (g *fairShareGroup) deactivateLocked(t *fairShareTenant) {
+	for i, active := range g.active {
+		if active != t {
+			continue
+		}
+		g.active = append(g.active[:i], g.active[i+1:]...)
+		if i < g.cursor {
+			g.cursor--
+		}
+		if g.cursor >= len(g.active) {
+			g.cursor = 0
+		}
+		break
+	}
+	t.deficit = 0
+	t.credited = false
+}
+
+// activeWeight 返回占用中或排队中租户的总权重
+func (g *fairShareGroup) activeWeight() float64 {
+	total := 0.0
+	for _, t := range g.tenants {
+		if t.inflight > 0 || len(t.queue) > 0 {
+			total += t.weight
+		}
+	}
+	return total
+}
+
+// fairShareOf 租户公平份额（含突发额度）
+func (g *fairShareGroup) fairShareOf(t *fairShareTenant, activeWeight float64) int {
+	if activeWeight <= 0 {
+		return g.capacity + g.burst
+	}
+	return int(math.Ceil(float64(g.capacity)*t.weight/activeWeight)) + g.burst
+}
+
+func (g *fairShareGroup) dispatchLocked(now time.Time) {
+	for g.inflight < g.capacity && g.waiting > 0 {
+		t := g.pickLocked()
+		if t == nil {
+			return
+		}
+		ticket := t.queue[0]
+		t.queue = t.queue[1:]
+		g.waiting--
+		if len(t.queue) == 0 {
+			g.deactivateLocked(t)
+		}
+		g.admitLocked(ticket, now)
+	}
+}
+
+// pickLocked 按 DRR 选出下一个出队租户
+//
+// 每次访问租户时累加 quantum = 权重 / 最小活跃权重（因此至少为 1），每出队一个请求消耗 1；
+// 已超出公平份额的租户本轮跳过且不累加。若所有排队租户均已超额，
+// 则选择 inflight/权重 最小者继续使用空闲容量。
+func (g *fairShareGroup) pickLocked() *fairShareTenant {
+	n := len(g.active)
+	if n == 0 {
+		return nil
+	}
+	minWeight := math.MaxFloat64
+	for _, t := range g.active {
+		minWeight = math.Min(minWeight, t.weight)
+	}
+	activeWeight := g.activeWeight()
+
+	if g.cursor >= n {
+		g.cursor = 0
+	}
+	for visits := 0; visits <= n; visits++ {
+		t := g.active[g.cursor]
+		if t.inflight < g.fairShareOf(t, activeWeight) {
+			if !t.credited {
+				t.deficit += t.weight / minWeight
+				t.credited = true
+			}
+			if t.deficit >= 1 {
+				t.deficit--
+				return t
+			}
+		}
+		t.credited = false
+		g.cursor = (g.cursor + 1) % n
+	}
+
+	var best *fairShareTenant
+	bestRatio := math.MaxFloat64
+	for _, t := range g.active {
+		if ratio := float64(t.inflight) / t.weight; ratio < bestRatio {
+			best, bestRatio = t, ratio
+		}
+	}
+	return best
+}
+
+// Snapshot 返回各分组的实时公平准入状态
+func (s *FairShareService) Snapshot() []FairShareGroupStats {
+	if s == nil {
+		return nil
+	}
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]FairShareGroupStats, 0, len(s.groups))
+	for _, g := range s.groups {
+		// 空闲分组保留容量与平均占用时长，但不出现在实时视图中
+		if len(g.tenants) == 0 {
+			continue
+		}
+		activeWeight := g.activeWeight()
+		waitingWeight := 0.0
+		for _, t := range g.active {
+			waitingWeight += t.weight
+		}
+
+		stats := FairShareGroupStats{
+			GroupID:   g.id,
+			Capacity:  g.capacity,
+			InFlight:  g.inflight,
+			Waiting:   g.waiting,
+			AvgHoldMs: g.avgHold.Milliseconds(),
+			Tenants:   make([]FairShareTenantStats, 0, len(g.tenants)),
+		}
+		for _, t := range g.tenants {
+			ts := FairShareTenantStats{
+				TenantType: t.tenantType,
+				TenantID:   t.tenantID,
+				UserID:     t.userID,
+				Weight:     t.weight,
+				InFlight:   t.inflight,
+				Waiting:    len(t.queue),
+				FairShare:  g.fairShareOf(t, activeWeight),
+			}
+			if len(t.queue) > 0 {
+				// DRR 下每出队 1 个请求，排队租户总权重 / 本租户权重 次调度中约有 1 次轮到本租户
+				position := int(math.Ceil(waitingWeight / t.weight))
+				if position > g.waiting {
+					position = g.waiting
+				}
+				ts.QueuePosition = max(position, 1)
+				if g.capacity > 0 {
+					ts.EstimatedWaitMs = int64(ts.QueuePosition) * g.avgHold.Milliseconds() / int64(g.capacity)
+				}
+				ts.OldestWaitMs = now.Sub(t.queue[0].enqueuedAt).Milliseconds()
+			}
+			stats.Tenants = append(stats.Tenants, ts)
+		}
+		sort.Slice(stats.Tenants, func(i, j int) bool {
+			a, b := stats.Tenants[i], stats.Tenants[j]
+			if a.Waiting != b.Waiting {
+				return a.Waiting > b.Waiting
+			}
+			if a.InFlight != b.InFlight {
+				return a.InFlight > b.InFlight
+			}
+			return a.TenantID < b.TenantID
+		})
+		out = append(out, stats)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GroupID < out[j].GroupID })
+	return out
+}
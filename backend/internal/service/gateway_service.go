@@ -27,6 +27,7 @@ import (
 	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/usagestats"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/vertex"
 	"github.com/Wei-Shaw/sub2api/internal/util/responseheaders"
 	"github.com/Wei-Shaw/sub2api/internal/util/urlvalidator"
 	"github.com/cespare/xxhash/v2"
@@ -68,6 +69,15 @@ type forceCacheBillingKeyType struct{}
 type accountWithLoad struct {
 	account  *Account
 	loadInfo *AccountLoadInfo
+	// quota 订阅额度预测结果（非订阅账号为零值）
+	quota QuotaForecast
+	// quotaResetRank 额度窗口重置先后排名，由 assignQuotaResetRanks 计算，越小越早重置
+	quotaResetRank int64
+}
+
+// effectiveLoadRate 负载率叠加额度压力惩罚：接近耗尽的账号被视为更忙，从而被逐步排空
+func (a accountWithLoad) effectiveLoadRate() int {
+	return a.loadInfo.LoadRate + a.quota.LoadPenalty()
 }
 
 var ForceCacheBillingContextKey = forceCacheBillingKeyType{}
@@ -503,6 +513,9 @@ type ForwardResult struct {
 	// 图片生成计费字段（图片生成模型使用）
 	ImageCount int    // 生成的图片数量
 	ImageSize  string // 图片尺寸 "1K", "2K", "4K"
+
+	// PromptCache 网关自动注入的缓存断点（nil 表示未注入）
+	PromptCache *PromptCacheInjection
 }
 
 // UpstreamFailoverError indicates an upstream error that should trigger account failover.
@@ -554,6 +567,7 @@ type GatewayService struct {
 	deferredService       *DeferredService
 	concurrencyService    *ConcurrencyService
 	claudeTokenProvider   *ClaudeTokenProvider
+	vertexTokenProvider   *VertexTokenProvider
 	sessionLimitCache     SessionLimitCache // 会话数量限制缓存（仅 Anthropic OAuth/SetupToken）
 	rpmCache              RPMCache          // RPM 计数缓存（仅 Anthropic OAuth/SetupToken）
 	userGroupRateResolver *userGroupRateResolver
@@ -570,6 +584,8 @@ type GatewayService struct {
 	debugGatewayBodyFile  atomic.Pointer[os.File] // non-nil when SUB2API_DEBUG_GATEWAY_BODY is set
 	tlsFPProfileService   *TLSFingerprintProfileService
 	balanceNotifyService  *BalanceNotifyService
+	quotaForecastService  *QuotaForecastService
+	promptCacheService    *PromptCacheService
 }
 
 // NewGatewayService creates a new GatewayService
@@ -592,6 +608,7 @@ func NewGatewayService(
 	httpUpstream HTTPUpstream,
 	deferredService *DeferredService,
 	claudeTokenProvider *ClaudeTokenProvider,
+	vertexTokenProvider *VertexTokenProvider,
 	sessionLimitCache SessionLimitCache,
 	rpmCache RPMCache,
 	digestStore *DigestSessionStore,
@@ -600,6 +617,8 @@ func NewGatewayService(
 	channelService *ChannelService,
 	resolver *ModelPricingResolver,
 	balanceNotifyService *BalanceNotifyService,
+	quotaForecastService *QuotaForecastService,
+	promptCacheService *PromptCacheService,
 ) *GatewayService {
 	userGroupRateTTL := resolveUserGroupRateCacheTTL(cfg)
 	modelsListTTL := resolveModelsListCacheTTL(cfg)
@@ -624,6 +643,7 @@ func NewGatewayService(
 		httpUpstream:         httpUpstream,
 		deferredService:      deferredService,
 		claudeTokenProvider:  claudeTokenProvider,
+		vertexTokenProvider:  vertexTokenProvider,
 		sessionLimitCache:    sessionLimitCache,
 		rpmCache:             rpmCache,
 		userGroupRateCache:   gocache.New(userGroupRateTTL, time.Minute),
@@ -635,6 +655,8 @@ func NewGatewayService(
 		channelService:       channelService,
 		resolver:             resolver,
 		balanceNotifyService: balanceNotifyService,
+		quotaForecastService: quotaForecastService,
+		promptCacheService:   promptCacheService,
 	}
 	svc.userGroupRateResolver = newUserGroupRateResolver(
 		userGroupRateRepo,
@@ -1517,25 +1539,34 @@ func (s *GatewayService) SelectAccountWithLoadAwareness(ctx context.Context, gro
 
 			// 3. 按负载感知排序
 			var routingAvailable []accountWithLoad
+			now := time.Now()
 			for _, acc := range routingCandidates {
 				loadInfo := routingLoadMap[acc.ID]
 				if loadInfo == nil {
 					loadInfo = &AccountLoadInfo{AccountID: acc.ID}
 				}
 				if loadInfo.LoadRate < 100 {
-					routingAvailable = append(routingAvailable, accountWithLoad{account: acc, loadInfo: loadInfo})
+					routingAvailable = append(routingAvailable, accountWithLoad{
+						account:  acc,
+						loadInfo: loadInfo,
+						quota:    s.quotaForecastService.Forecast(acc, requestedModel, now),
+					})
 				}
 			}
 
 			if len(routingAvailable) > 0 {
-				// 排序：优先级 > 负载率 > 最后使用时间
+				// 排序：优先级 > 负载率（含额度压力） > 额度窗口重置先后 > 最后使用时间
+				assignQuotaResetRanks(routingAvailable)
 				sort.SliceStable(routingAvailable, func(i, j int) bool {
 					a, b := routingAvailable[i], routingAvailable[j]
 					if a.account.Priority != b.account.Priority {
 						return a.account.Priority < b.account.Priority
 					}
-					if a.loadInfo.LoadRate != b.loadInfo.LoadRate {
-						return a.loadInfo.LoadRate < b.loadInfo.LoadRate
+					if a.effectiveLoadRate() != b.effectiveLoadRate() {
+						return a.effectiveLoadRate() < b.effectiveLoadRate()
+					}
+					if a.quotaResetRank != b.quotaResetRank {
+						return a.quotaResetRank < b.quotaResetRank
 					}
 					switch {
 					case a.account.LastUsedAt == nil && b.account.LastUsedAt != nil:
@@ -1701,6 +1732,7 @@ func (s *GatewayService) SelectAccountWithLoadAwareness(ctx context.Context, gro
 		}
 	} else {
 		var available []accountWithLoad
+		now := time.Now()
 		for _, acc := range candidates {
 			loadInfo := loadMap[acc.ID]
 			if loadInfo == nil {
@@ -1710,17 +1742,20 @@ func (s *GatewayService) SelectAccountWithLoadAwareness(ctx context.Context, gro
 				available = append(available, accountWithLoad{
 					account:  acc,
 					loadInfo: loadInfo,
+					quota:    s.quotaForecastService.Forecast(acc, requestedModel, now),
 				})
 			}
 		}
 
-		// 分层过滤选择：优先级 → 负载率 → LRU
+		// 分层过滤选择：优先级 → 负载率（含额度压力） → 额度窗口最早重置 → LRU
 		for len(available) > 0 {
 			// 1. 取优先级最小的集合
 			candidates := filterByMinPriority(available)
 			// 2. 取负载率最低的集合
 			candidates = filterByMinLoadRate(candidates)
-			// 3. LRU 选择最久未用的账号
+			// 3. 取额度窗口最早重置的集合（先用掉即将过期的额度）
+			candidates = filterBySoonestQuotaReset(candidates)
+			// 4. LRU 选择最久未用的账号
 			selected := selectByLRU(candidates, preferOAuth)
 			if selected == nil {
 				break
@@ -2453,26 +2488,61 @@ func filterByMinPriority(accounts []accountWithLoad) []accountWithLoad {
 	return result
 }
 
-// filterByMinLoadRate 过滤出负载率最低的账号集合
+// filterByMinLoadRate 过滤出负载率（含额度压力惩罚）最低的账号集合
 func filterByMinLoadRate(accounts []accountWithLoad) []accountWithLoad {
 	if len(accounts) == 0 {
 		return accounts
 	}
-	minLoadRate := accounts[0].loadInfo.LoadRate
+	minLoadRate := accounts[0].effectiveLoadRate()
 	for _, acc := range accounts[1:] {
-		if acc.loadInfo.LoadRate < minLoadRate {
-			minLoadRate = acc.loadInfo.LoadRate
+		if acc.effectiveLoadRate() < minLoadRate {
+			minLoadRate = acc.effectiveLoadRate()
+		}
+	}
+	result := make([]accountWithLoad, 0, len(accounts))
+	for _, acc := range accounts {
+		if acc.effectiveLoadRate() == minLoadRate {
+			result = append(result, acc)
 		}
 	}
+	return result
+}
+
+// filterBySoonestQuotaReset 过滤出额度窗口最早重置的账号集合
+func filterBySoonestQuotaReset(accounts []accountWithLoad) []accountWithLoad {
+	if len(accounts) <= 1 {
+		return accounts
+	}
+	assignQuotaResetRanks(accounts)
 	result := make([]accountWithLoad, 0, len(accounts))
 	for _, acc := range accounts {
-		if acc.loadInfo.LoadRate == minLoadRate {
+		if acc.quotaResetRank == 0 {
 			result = append(result, acc)
 		}
 	}
 	return result
 }
 
+// assignQuotaResetRanks 按额度窗口重置时间（30 分钟分桶）计算排名：
+// 最早重置的分桶为 0，其余为与最早分桶的距离。
+// 没有额度窗口的账号（API Key 等）排名同样为 0，避免因缺少数据而被饿死。
+func assignQuotaResetRanks(accounts []accountWithLoad) {
+	var minBucket int64
+	found := false
+	for _, acc := range accounts {
+		if bucket, ok := acc.quota.resetBucket(); ok && (!found || bucket < minBucket) {
+			minBucket = bucket
+			found = true
+		}
+	}
+	for i := range accounts {
+		accounts[i].quotaResetRank = 0
+		if bucket, ok := accounts[i].quota.resetBucket(); ok {
+			accounts[i].quotaResetRank = bucket - minBucket
+		}
+	}
+}
+
 // selectByLRU 从集合中选择最久未用的账号
 // 如果有多个账号具有相同的最小 LastUsedAt，则随机选择一个
 func selectByLRU(accounts []accountWithLoad, preferOAuth bool) *accountWithLoad {
@@ -2556,7 +2626,7 @@ func sortAccountsByPriorityAndLastUsed(accounts []*Account, preferOAuth bool) {
 	shuffleWithinPriorityAndLastUsed(accounts, preferOAuth)
 }
 
-// shuffleWithinSortGroups 对排序后的 accountWithLoad 切片，按 (Priority, LoadRate, LastUsedAt) 分组后组内随机打乱。
+// shuffleWithinSortGroups 对排序后的 accountWithLoad 切片，按 (Priority, LoadRate, 额度重置排名, LastUsedAt) 分组后组内随机打乱。
 // 防止并发请求读取同一快照时，确定性排序导致所有请求命中相同账号。
 func shuffleWithinSortGroups(accounts []accountWithLoad) {
 	if len(accounts) <= 1 {
@@ -2582,7 +2652,10 @@ func sameAccountWithLoadGroup(a, b accountWithLoad) bool {
 	if a.account.Priority != b.account.Priority {
 		return false
 	}
-	if a.loadInfo.LoadRate != b.loadInfo.LoadRate {
+	if a.effectiveLoadRate() != b.effectiveLoadRate() {
+		return false
+	}
+	if a.quotaResetRank != b.quotaResetRank {
 		return false
 	}
 	return sameLastUsedAt(a.account.LastUsedAt, b.account.LastUsedAt)
@@ -3458,6 +3531,8 @@ func (s *GatewayService) GetAccessToken(ctx context.Context, account *Account) (
 		return apiKey, "apikey", nil
 	case AccountTypeBedrock:
 		return "", "bedrock", nil // Bedrock 使用 SigV4 签名或 API Key，由 forwardBedrock 处理
+	case AccountTypeVertex:
+		return "", "vertex", nil // Vertex 使用服务账号换取的 access token，由 forwardVertex 处理
 	default:
 		return "", "", fmt.Errorf("unsupported account type: %s", account.Type)
 	}
@@ -3935,9 +4010,9 @@ func (s *GatewayService) Forward(ctx context.Context, c *gin.Context, account *A
 		return nil, fmt.Errorf("parse request: empty request")
 	}
 
-	// Web Search 模拟：纯 web_search 请求时，直接调用搜索 API 构造响应
-	if account != nil && s.shouldEmulateWebSearch(ctx, account, parsed.GroupID, parsed.Body) {
-		return s.handleWebSearchEmulation(ctx, c, account, parsed)
+	// 服务端工具模拟：上游不支持原生 web_search / web_fetch 时，由网关执行工具并循环调用上游
+	if emulation := s.ResolveServerToolEmulation(ctx, account, parsed.GroupID, parsed.Body); emulation.Any() {
+		return s.handleServerToolEmulation(ctx, c, account, parsed, emulation)
 	}
 
 	if account != nil && account.IsAnthropicAPIKeyPassthroughEnabled() {
@@ -3962,6 +4037,9 @@ func (s *GatewayService) Forward(ctx context.Context, c *gin.Context, account *A
 	if account != nil && account.IsBedrock() {
 		return s.forwardBedrock(ctx, c, account, parsed, startTime)
 	}
+	if account != nil && account.IsVertex() && account.Platform == PlatformAnthropic {
+		return s.forwardVertex(ctx, c, account, parsed, startTime)
+	}
 
 	// Beta policy: evaluate once; block check + cache filter set for buildUpstreamRequest.
 	// Always overwrite the cache to prevent stale values from a previous retry with a different account.
@@ -4029,6 +4107,12 @@ func (s *GatewayService) Forward(ctx context.Context, c *gin.Context, account *A
 	// 强制执行 cache_control 块数量限制（最多 4 个）
 	body = enforceCacheControlLimit(body)
 
+	// 分组启用自动缓存断点时，在剩余断点预算内为 tools / system / 对话前缀注入 cache_control
+	var promptCache *PromptCacheInjection
+	if account.Platform == PlatformAnthropic {
+		body, promptCache = s.promptCacheService.Apply(ctx, parsed.GroupID, reqModel, body)
+	}
+
 	// 应用模型映射：
 	// - APIKey 账号：使用账号级别的显式映射（如果配置），否则透传原始模型名
 	// - OAuth/SetupToken 账号：使用 Anthropic 标准映射（短ID → 长ID）
@@ -4512,6 +4596,7 @@ func (s *GatewayService) Forward(ctx context.Context, c *gin.Context, account *A
 		Duration:         time.Since(startTime),
 		FirstTokenMs:     firstTokenMs,
 		ClientDisconnect: clientDisconnect,
+		PromptCache:      promptCache,
 	}, nil
 }
 
@@ -5238,7 +5323,7 @@ func (s *GatewayService) forwardBedrock(
 
 	// 错误/failover 处理
 	if resp.StatusCode >= 400 {
-		return s.handleBedrockUpstreamErrors(ctx, resp, c, account)
+		return s.handleCloudUpstreamErrors(ctx, resp, c, account, "Bedrock")
 	}
 
 	// 响应处理
@@ -5275,6 +5360,108 @@ func (s *GatewayService) forwardBedrock(
 	}, nil
 }
 
+// forwardVertex 转发 Claude 请求到 Google Vertex AI（rawPredict / streamRawPredict）
+// Vertex 上 Claude 的请求与响应均为 Anthropic Messages 格式，响应复用标准处理流程。
+func (s *GatewayService) forwardVertex(
+	ctx context.Context,
+	c *gin.Context,
+	account *Account,
+	parsed *ParsedRequest,
+	startTime time.Time,
+) (*ForwardResult, error) {
+	reqModel := parsed.Model
+	reqStream := parsed.Stream
+
+	mappedModel := ResolveVertexClaudeModelID(account, reqModel)
+	if mappedModel == "" {
+		return nil, fmt.Errorf("unsupported vertex model: %s", reqModel)
+	}
+	if mappedModel != reqModel {
+		logger.LegacyPrintf("service.gateway", "[Vertex] Model mapping: %s -> %s (account: %s)", reqModel, mappedModel, account.Name)
+	}
+
+	projectID := account.GetVertexProjectID()
+	if projectID == "" {
+		return nil, fmt.Errorf("vertex project_id not configured for account %d", account.ID)
+	}
+	region := account.GetVertexRegion()
+	if s.vertexTokenProvider == nil {
+		return nil, errors.New("vertex token provider not configured")
+	}
+
+	vertexBody, err := PrepareVertexClaudeRequestBody(parsed.Body)
+	if err != nil {
+		return nil, fmt.Errorf("prepare vertex request body: %w", err)
+	}
+
+	betaHeader := ""
+	if c != nil && c.Request != nil {
+		betaHeader = c.GetHeader("anthropic-beta")
+	}
+	targetURL := vertex.ClaudeURL(projectID, region, mappedModel, reqStream)
+	proxyURL := resolveAccountProxyURL(account)
+
+	logger.LegacyPrintf("service.gateway", "[Vertex] 命中 Vertex 分支: account=%d name=%s model=%s->%s region=%s stream=%v",
+		account.ID, account.Name, reqModel, mappedModel, region, reqStream)
+
+	resp, err := s.executeCloudUpstream(ctx, c, account, proxyURL, "Vertex", func() (*http.Request, error) {
+		token, err := s.vertexTokenProvider.GetAccessToken(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(vertexBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if betaHeader != "" {
+			req.Header.Set("anthropic-beta", betaHeader)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		return s.handleCloudUpstreamErrors(ctx, resp, c, account, "Vertex")
+	}
+
+	var usage *ClaudeUsage
+	var firstTokenMs *int
+	var clientDisconnect bool
+	if reqStream {
+		streamResult, err := s.handleStreamingResponse(ctx, resp, c, account, startTime, reqModel, mappedModel, false)
+		if err != nil {
+			return nil, err
+		}
+		usage = streamResult.usage
+		firstTokenMs = streamResult.firstTokenMs
+		clientDisconnect = streamResult.clientDisconnect
+	} else {
+		usage, err = s.handleNonStreamingResponse(ctx, resp, c, account, reqModel, mappedModel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if usage == nil {
+		usage = &ClaudeUsage{}
+	}
+
+	return &ForwardResult{
+		RequestID:        resp.Header.Get("request-id"),
+		Usage:            *usage,
+		Model:            reqModel, // 使用原始模型用于计费（渠道定价）和日志
+		UpstreamModel:    mappedModel,
+		Stream:           reqStream,
+		Duration:         time.Since(startTime),
+		FirstTokenMs:     firstTokenMs,
+		ClientDisconnect: clientDisconnect,
+	}, nil
+}
+
 // executeBedrockUpstream 执行 Bedrock 上游请求（含重试逻辑）
 func (s *GatewayService) executeBedrockUpstream(
 	ctx context.Context,
@@ -5287,17 +5474,30 @@ func (s *GatewayService) executeBedrockUpstream(
 	signer *BedrockSigner,
 	apiKey string,
 	proxyURL string,
+) (*http.Response, error) {
+	return s.executeCloudUpstream(ctx, c, account, proxyURL, "Bedrock", func() (*http.Request, error) {
+		if account.IsBedrockAPIKey() {
+			return s.buildUpstreamRequestBedrockAPIKey(ctx, body, modelID, region, stream, apiKey)
+		}
+		return s.buildUpstreamRequestBedrock(ctx, body, modelID, region, stream, signer)
+	})
+}
+
+// executeCloudUpstream 执行云厂商直连上游（Bedrock / Vertex）请求（含重试逻辑），每次重试重新构建请求
+func (s *GatewayService) executeCloudUpstream(
+	ctx context.Context,
+	c *gin.Context,
+	account *Account,
+	proxyURL string,
+	logTag string,
+	buildReq func() (*http.Request, error),
 ) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 	retryStart := time.Now()
 	for attempt := 1; attempt <= maxRetryAttempts; attempt++ {
 		var upstreamReq *http.Request
-		if account.IsBedrockAPIKey() {
-			upstreamReq, err = s.buildUpstreamRequestBedrockAPIKey(ctx, body, modelID, region, stream, apiKey)
-		} else {
-			upstreamReq, err = s.buildUpstreamRequestBedrock(ctx, body, modelID, region, stream, signer)
-		}
+		upstreamReq, err = buildReq()
 		if err != nil {
 			return nil, err
 		}
@@ -5361,8 +5561,8 @@ func (s *GatewayService) executeBedrockUpstream(
 						return ""
 					}(),
 				})
-				logger.LegacyPrintf("service.gateway", "[Bedrock] account %d: upstream error %d, retry %d/%d after %v",
-					account.ID, resp.StatusCode, attempt, maxRetryAttempts, delay)
+				logger.LegacyPrintf("service.gateway", "[%s] account %d: upstream error %d, retry %d/%d after %v",
+					logTag, account.ID, resp.StatusCode, attempt, maxRetryAttempts, delay)
 				if err := sleepWithContext(ctx, delay); err != nil {
 					return nil, err
 				}
@@ -5379,12 +5579,13 @@ func (s *GatewayService) executeBedrockUpstream(
 	return resp, nil
 }
 
-// handleBedrockUpstreamErrors 处理 Bedrock 上游 4xx/5xx 错误（failover + 错误响应）
-func (s *GatewayService) handleBedrockUpstreamErrors(
+// handleCloudUpstreamErrors 处理 Bedrock / Vertex 上游 4xx/5xx 错误（failover + 错误响应）
+func (s *GatewayService) handleCloudUpstreamErrors(
 	ctx context.Context,
 	resp *http.Response,
 	c *gin.Context,
 	account *Account,
+	logTag string,
 ) (*ForwardResult, error) {
 	// retry exhausted + failover
 	if s.shouldRetryUpstreamError(account, resp.StatusCode) {
@@ -5393,8 +5594,8 @@ func (s *GatewayService) handleBedrockUpstreamErrors(
 			_ = resp.Body.Close()
 			resp.Body = io.NopCloser(bytes.NewReader(respBody))
 
-			logger.LegacyPrintf("service.gateway", "[Bedrock] Upstream error (retry exhausted, failover): Account=%d(%s) Status=%d Body=%s",
-				account.ID, account.Name, resp.StatusCode, truncateString(string(respBody), 1000))
+			logger.LegacyPrintf("service.gateway", "[%s] Upstream error (retry exhausted, failover): Account=%d(%s) Status=%d Body=%s",
+				logTag, account.ID, account.Name, resp.StatusCode, truncateString(string(respBody), 1000))
 
 			s.handleRetryExhaustedSideEffects(ctx, resp, account)
 			appendOpsUpstreamError(c, OpsUpstreamErrorEvent{
@@ -7297,6 +7498,7 @@ type RecordUsageInput struct {
 	RequestPayloadHash string             // 请求体语义哈希，用于降低 request_id 误复用时的静默误去重风险
 	ForceCacheBilling  bool               // 强制缓存计费：将 input_tokens 转为 cache_read 计费（用于粘性会话切换）
 	APIKeyService      APIKeyQuotaUpdater // 可选：用于更新API Key配额
+	ContextAction      string             // 上下文窗口策略执行的动作（truncate/route），空表示未触发
 
 	ChannelUsageFields // 渠道映射信息（由 handler 在 Forward 前解析）
 }
@@ -7382,6 +7584,11 @@ func postUsageBilling(ctx context.Context, p *postUsageBillingParams, deps *bill
 		}
 	}
 
+	// 预算消费只在计费后累加一次，不会与 finalize 路径重复
+	if cost.ActualCost > 0 {
+		deps.billingCacheService.RecordBudgetSpend(p.User.ID, p.APIKey.ID, cost.ActualCost)
+	}
+
 	// NOTE: finalizePostUsageBilling is NOT called here to avoid double-queuing
 	// cache updates. The legacy path does DB writes directly; the finalize path
 	// does cache queue + notifications. Notifications are dispatched separately
@@ -7522,6 +7729,10 @@ func finalizePostUsageBilling(p *postUsageBillingParams, deps *billingDeps, resu
 		deps.billingCacheService.QueueUpdateAPIKeyRateLimitUsage(p.APIKey.ID, p.Cost.ActualCost)
 	}
 
+	if p.Cost.ActualCost > 0 && p.User != nil && p.APIKey != nil {
+		deps.billingCacheService.RecordBudgetSpend(p.User.ID, p.APIKey.ID, p.Cost.ActualCost)
+	}
+
 	deps.deferredService.ScheduleLastUsedUpdate(p.Account.ID)
 
 	// Notification checks run async — all parameters are already captured,
@@ -7695,6 +7906,7 @@ func (s *GatewayService) RecordUsage(ctx context.Context, input *RecordUsageInpu
 		RequestPayloadHash: input.RequestPayloadHash,
 		ForceCacheBilling:  input.ForceCacheBilling,
 		APIKeyService:      input.APIKeyService,
+		ContextAction:      input.ContextAction,
 		ChannelUsageFields: input.ChannelUsageFields,
 	}, &recordUsageOpts{
 		EnableClaudePath: true,
@@ -7757,6 +7969,7 @@ type recordUsageCoreInput struct {
 	RequestPayloadHash string
 	ForceCacheBilling  bool
 	APIKeyService      APIKeyQuotaUpdater
+	ContextAction      string
 	ChannelUsageFields
 }
 
@@ -7827,6 +8040,11 @@ func (s *GatewayService) recordUsageCore(ctx context.Context, input *recordUsage
 	usageLog := s.buildRecordUsageLog(ctx, input, result, apiKey, user, account, subscription,
 		requestedModel, multiplier, accountRateMultiplier, billingType, cacheTTLOverridden, cost, opts)
 
+	// 自动缓存断点：记录本次请求的缓存节省
+	if result.PromptCache != nil {
+		s.promptCacheService.RecordSavings(ctx, result.PromptCache, usageLog, result.Usage, billingModel)
+	}
+
 	// 计算账号统计定价费用（使用最终上游模型匹配自定义规则）
 	if apiKey.GroupID != nil {
 		applyAccountStatsCost(ctx, usageLog, s.channelService, s.billingService,
@@ -8039,6 +8257,7 @@ func (s *GatewayService) buildRecordUsageLog(
 		AccountRateMultiplier: &accountRateMultiplier,
 		BillingType:           billingType,
 		BillingMode:           resolveBillingMode(result, cost),
+		ContextAction:         optionalTrimmedStringPtr(input.ContextAction),
 		Stream:                result.Stream,
 		DurationMs:            &durationMs,
 		FirstTokenMs:          result.FirstTokenMs,
@@ -8221,6 +8440,10 @@ func (s *GatewayService) ForwardCountTokens(ctx context.Context, c *gin.Context,
 		s.countTokensError(c, http.StatusNotFound, "not_found_error", "count_tokens endpoint is not supported for Bedrock")
 		return nil
 	}
+	if account != nil && account.IsVertex() {
+		s.countTokensError(c, http.StatusNotFound, "not_found_error", "count_tokens endpoint is not supported for Vertex")
+		return nil
+	}
 
 	body := parsed.Body
 	reqModel := parsed.Model
@@ -8827,6 +9050,34 @@ func (s *GatewayService) GetAvailableModels(ctx context.Context, groupID *int64,
 	return cloneStringSlice(models)
 }
 
+// GetAvailableModelTargets 返回分组内账号 model_mapping 的「请求模型 → 上游模型」映射。
+// 多个账号对同一模型映射到不同上游时，按账号列表顺序取首个。
+func (s *GatewayService) GetAvailableModelTargets(ctx context.Context, groupID *int64, platform string) map[string]string {
+	var accounts []Account
+	var err error
+	if groupID != nil {
+		accounts, err = s.accountRepo.ListSchedulableByGroupID(ctx, *groupID)
+	} else {
+		accounts, err = s.accountRepo.ListSchedulable(ctx)
+	}
+	if err != nil {
+		return nil
+	}
+
+	targets := make(map[string]string)
+	for i := range accounts {
+		if platform != "" && accounts[i].Platform != platform {
+			continue
+		}
+		for model, target := range accounts[i].GetModelMapping() {
+			if _, exists := targets[model]; !exists {
+				targets[model] = target
+			}
+		}
+	}
+	return targets
+}
+
 func (s *GatewayService) InvalidateAvailableModelsCache(groupID *int64, platform string) {
 	if s == nil || s.modelsListCache == nil {
 		return
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/webfetch"
+	"github.com/tidwall/gjson"
+)
+
+// Web fetch emulation constants
+const (
+	toolTypeWebFetchPrefix = "web_fetch"
+	toolNameWebFetch       = "web_fetch"
+
+	// webFetchMaxURLLength 与 Anthropic web_fetch 的 URL 长度限制一致
+	webFetchMaxURLLength = 250
+
+	// featureKeyWebFetchEmulation is the key used in Channel.FeaturesConfig.
+	featureKeyWebFetchEmulation = "web_fetch_emulation"
+)
+
+// webFetcherPtr stores *webfetch.Fetcher atomically for concurrent safety.
+var webFetcherPtr atomic.Pointer[webfetch.Fetcher]
+
+// SetWebFetcher wires the webfetch.Fetcher into the gateway (goroutine-safe).
+func SetWebFetcher(f *webfetch.Fetcher) {
+	webFetcherPtr.Store(f)
+}
+
+func getWebFetcher() *webfetch.Fetcher {
+	return webFetcherPtr.Load()
+}
+
+// WebFetchOptionsFromConfig derives fetcher options from gateway.web_fetch limits and security.url_allowlist.
+// 私网地址仅在开启白名单且显式允许私网时放行：抓取目标由模型决定，默认必须阻断 SSRF。
+func WebFetchOptionsFromConfig(cfg *config.Config) webfetch.Options {
+	opts := webfetch.Options{AllowInsecureHTTP: true}
+	if cfg != nil {
+		allowlist := cfg.Security.URLAllowlist
+		opts.AllowInsecureHTTP = allowlist.AllowInsecureHTTP
+		if allowlist.Enabled {
+			opts.AllowedHosts = allowlist.WebFetchHosts
+			opts.AllowPrivateHosts = allowlist.AllowPrivateHosts
+		}
+		wf := cfg.Gateway.WebFetch
+		opts.Timeout = time.Duration(wf.TimeoutSeconds) * time.Second
+		opts.MaxResponseBytes = wf.MaxResponseBytes
+		opts.MaxContentChars = wf.MaxContentChars
+		opts.MaxRedirects = wf.MaxRedirects
+		opts.QuotaLimit = wf.QuotaLimit
+	}
+	return opts
+}
+
+// shouldEmulateWebFetch checks whether web_fetch tool calls should be executed by the gateway.
+//
+// Judgment chain: not a loop hop → fetcher exists → has web_fetch tool → channel enabled for the account platform.
+func (s *GatewayService) shouldEmulateWebFetch(ctx context.Context, account *Account, groupID *int64, body []byte) bool {
+	if isServerToolLoopHop(ctx) || getWebFetcher() == nil {
+		return false
+	}
+	if !hasWebFetchToolInBody(body) {
+		return false
+	}
+	if groupID == nil || s.channelService == nil {
+		return false
+	}
+	ch, err := s.channelService.GetChannelForGroup(ctx, *groupID)
+	if err != nil || ch == nil {
+		return false
+	}
+	return ch.IsWebFetchEmulationEnabled(account.Platform)
+}
+
+// hasWebFetchToolInBody checks if any tool in the body is a web_fetch server tool.
+func hasWebFetchToolInBody(body []byte) bool {
+	for _, tool := range gjson.GetBytes(body, "tools").Array() {
+		if isWebFetchToolJSON(tool) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWebFetchToolJSON(tool gjson.Result) bool {
+	if strings.HasPrefix(tool.Get("type").String(), toolTypeWebFetchPrefix) {
+		return true
+	}
+	// 带 input_schema 的是客户端自定义函数工具，即使同名也不拦截
+	return !tool.Get("input_schema").Exists() && tool.Get("name").String() == toolNameWebFetch
+}
+
+func doWebFetch(ctx context.Context, account *Account, rawURL string) (*webfetch.FetchResponse, error) {
+	fetcher := getWebFetcher()
+	if fetcher == nil {
+		return nil, fmt.Errorf("web fetch emulation: fetcher not initialized")
+	}
+	resp, err := fetcher.Fetch(ctx, webfetch.FetchRequest{URL: rawURL, ProxyURL: resolveAccountProxyURL(account)})
+	if err != nil {
+		slog.Warn("web fetch emulation: fetch failed", "account_id", account.ID, "error", err)
+		return nil, fmt.Errorf("web fetch emulation: %w", err)
+	}
+	return resp, nil
+}
+
+// webFetchErrorCode maps fetch errors to web_fetch_tool_error codes.
+func webFetchErrorCode(err error) string {
+	switch {
+	case errors.Is(err, webfetch.ErrURLNotAllowed):
+		return "url_not_allowed"
+	case errors.Is(err, webfetch.ErrURLNotAccessible):
+		return "url_not_accessible"
+	case errors.Is(err, webfetch.ErrUnsupportedContentType):
+		return "unsupported_content_type"
+	case errors.Is(err, webfetch.ErrQuotaExceeded):
+		return "too_many_requests"
+	default:
+		return "unavailable"
+	}
+}
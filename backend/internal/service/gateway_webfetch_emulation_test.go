@@ -0,0 +1,90 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/webfetch"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+var webFetchToolBody = []byte(`{"tools":[{"type":"web_fetch_20250910","name":"web_fetch"}]}`)
+
+func TestIsWebFetchToolJSON(t *testing.T) {
+	require.True(t, isWebFetchToolJSON(gjson.Parse(`{"type":"web_fetch_20250910","name":"web_fetch"}`)))
+	require.True(t, isWebFetchToolJSON(gjson.Parse(`{"name":"web_fetch"}`)))
+	require.False(t, isWebFetchToolJSON(gjson.Parse(`{"name":"web_fetch","input_schema":{"type":"object"}}`)))
+	require.False(t, isWebFetchToolJSON(gjson.Parse(`{"type":"web_search_20250305","name":"web_search"}`)))
+}
+
+func TestShouldEmulateWebFetch_ChannelEnabled(t *testing.T) {
+	SetWebFetcher(webfetch.NewFetcher(webfetch.Options{}, nil))
+	defer SetWebFetcher(nil)
+
+	ch := &Channel{
+		ID:     10,
+		Status: StatusActive,
+		FeaturesConfig: map[string]any{
+			featureKeyWebFetchEmulation: map[string]any{PlatformAnthropic: true},
+		},
+	}
+	svc := &GatewayService{channelService: newChannelServiceWithCache(42, ch)}
+	account := newAnthropicAPIKeyAccount(WebSearchModeDefault)
+	groupID := int64(42)
+	require.True(t, svc.shouldEmulateWebFetch(context.Background(), account, &groupID, webFetchToolBody))
+
+	hopCtx := context.WithValue(context.Background(), ctxkey.ServerToolLoopHop, true)
+	require.False(t, svc.shouldEmulateWebFetch(hopCtx, account, &groupID, webFetchToolBody))
+
+	emulation := svc.ResolveServerToolEmulation(context.Background(), account, &groupID, webFetchToolBody)
+	require.Equal(t, ServerToolEmulation{WebFetch: true}, emulation)
+}
+
+func TestShouldEmulateWebFetch_ChannelDisabled(t *testing.T) {
+	SetWebFetcher(webfetch.NewFetcher(webfetch.Options{}, nil))
+	defer SetWebFetcher(nil)
+
+	ch := &Channel{ID: 10, Status: StatusActive}
+	svc := &GatewayService{channelService: newChannelServiceWithCache(42, ch)}
+	groupID := int64(42)
+	require.False(t, svc.shouldEmulateWebFetch(context.Background(), newAnthropicAPIKeyAccount(WebSearchModeDefault), &groupID, webFetchToolBody))
+}
+
+func TestShouldEmulateWebFetch_NilFetcher(t *testing.T) {
+	SetWebFetcher(nil)
+	svc := &GatewayService{}
+	groupID := int64(42)
+	require.False(t, svc.shouldEmulateWebFetch(context.Background(), newAnthropicAPIKeyAccount(WebSearchModeDefault), &groupID, webFetchToolBody))
+}
+
+func TestWebFetchErrorCode(t *testing.T) {
+	require.Equal(t, "url_not_allowed", webFetchErrorCode(fmt.Errorf("wrap: %w", webfetch.ErrURLNotAllowed)))
+	require.Equal(t, "url_not_accessible", webFetchErrorCode(webfetch.ErrURLNotAccessible))
+	require.Equal(t, "unsupported_content_type", webFetchErrorCode(webfetch.ErrUnsupportedContentType))
+	require.Equal(t, "too_many_requests", webFetchErrorCode(webfetch.ErrQuotaExceeded))
+	require.Equal(t, "unavailable", webFetchErrorCode(errors.New("boom")))
+}
+
+func TestWebFetchOptionsFromConfig_PrivateHostsRequireAllowlist(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.URLAllowlist.AllowPrivateHosts = true
+	cfg.Security.URLAllowlist.WebFetchHosts = []string{"docs.example.com"}
+	cfg.Gateway.WebFetch.MaxRedirects = 3
+
+	opts := WebFetchOptionsFromConfig(cfg)
+	require.False(t, opts.AllowPrivateHosts)
+	require.Empty(t, opts.AllowedHosts)
+	require.Equal(t, 3, opts.MaxRedirects)
+
+	cfg.Security.URLAllowlist.Enabled = true
+	opts = WebFetchOptionsFromConfig(cfg)
+	require.True(t, opts.AllowPrivateHosts)
+	require.Equal(t, []string{"docs.example.com"}, opts.AllowedHosts)
+}
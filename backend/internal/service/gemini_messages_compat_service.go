@@ -49,6 +49,7 @@ type GeminiMessagesCompatService struct {
 	cache                     GatewayCache
 	schedulerSnapshot         *SchedulerSnapshotService
 	tokenProvider             *GeminiTokenProvider
+	vertexTokenProvider       *VertexTokenProvider
 	rateLimitService          *RateLimitService
 	httpUpstream              HTTPUpstream
 	antigravityGatewayService *AntigravityGatewayService
@@ -62,6 +63,7 @@ func NewGeminiMessagesCompatService(
 	cache GatewayCache,
 	schedulerSnapshot *SchedulerSnapshotService,
 	tokenProvider *GeminiTokenProvider,
+	vertexTokenProvider *VertexTokenProvider,
 	rateLimitService *RateLimitService,
 	httpUpstream HTTPUpstream,
 	antigravityGatewayService *AntigravityGatewayService,
@@ -73,6 +75,7 @@ func NewGeminiMessagesCompatService(
 		cache:                     cache,
 		schedulerSnapshot:         schedulerSnapshot,
 		tokenProvider:             tokenProvider,
+		vertexTokenProvider:       vertexTokenProvider,
 		rateLimitService:          rateLimitService,
 		httpUpstream:              httpUpstream,
 		antigravityGatewayService: antigravityGatewayService,
@@ -579,7 +582,7 @@ func (s *GeminiMessagesCompatService) Forward(ctx context.Context, c *gin.Contex
 
 	originalModel := req.Model
 	mappedModel := req.Model
-	if account.Type == AccountTypeAPIKey {
+	if account.Type == AccountTypeAPIKey || account.Type == AccountTypeVertex {
 		mappedModel = account.GetMappedModel(req.Model)
 	}
 
@@ -712,6 +715,16 @@ func (s *GeminiMessagesCompatService) Forward(ctx context.Context, c *gin.Contex
 		}
 		requestIDHeader = "x-request-id"
 
+	case AccountTypeVertex:
+		buildReq = func(ctx context.Context) (*http.Request, string, error) {
+			action := "generateContent"
+			if req.Stream {
+				action = "streamGenerateContent"
+			}
+			return s.buildVertexGeminiRequest(ctx, account, mappedModel, action, normalizeGeminiRequestForAIStudio(geminiReq))
+		}
+		requestIDHeader = "x-request-id"
+
 	default:
 		return nil, fmt.Errorf("unsupported account type: %s", account.Type)
 	}
@@ -1094,7 +1107,7 @@ func (s *GeminiMessagesCompatService) ForwardNative(ctx context.Context, c *gin.
 	body = ensureGeminiFunctionCallThoughtSignatures(body)
 
 	mappedModel := originalModel
-	if account.Type == AccountTypeAPIKey {
+	if account.Type == AccountTypeAPIKey || account.Type == AccountTypeVertex {
 		mappedModel = account.GetMappedModel(originalModel)
 	}
 
@@ -1213,6 +1226,12 @@ func (s *GeminiMessagesCompatService) ForwardNative(ctx context.Context, c *gin.
 		}
 		requestIDHeader = "x-request-id"
 
+	case AccountTypeVertex:
+		buildReq = func(ctx context.Context) (*http.Request, string, error) {
+			return s.buildVertexGeminiRequest(ctx, account, mappedModel, upstreamAction, body)
+		}
+		requestIDHeader = "x-request-id"
+
 	default:
 		return nil, s.writeGoogleError(c, http.StatusBadGateway, "Unsupported account type: "+account.Type)
 	}
@@ -3316,6 +3335,10 @@ func isClaudeWebSearchToolMap(tool map[string]any) bool {
 	if strings.HasPrefix(toolType, "web_search") || toolType == "google_search" {
 		return true
 	}
+	// 带 input_schema 的是普通函数工具（含网关 web search 工具循环注入的 web_search）
+	if _, ok := tool["input_schema"]; ok {
+		return false
+	}
 
 	name, _ := tool["name"].(string)
 	switch strings.TrimSpace(name) {
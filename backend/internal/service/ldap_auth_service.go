@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrLDAPDisabled           = infraerrors.NotFound("LDAP_DISABLED", "ldap login is disabled")
+	ErrLDAPInvalidCredentials = infraerrors.Unauthorized("LDAP_INVALID_CREDENTIALS", "invalid username or password")
+	ErrLDAPUnavailable        = infraerrors.ServiceUnavailable("LDAP_UNAVAILABLE", "directory server is unavailable")
+)
+
+// LDAPAuthService 通过 LDAP 绑定校验用户名密码（兼容 Active Directory）
+type LDAPAuthService struct {
+	cfg config.LDAPConnectConfig
+}
+
+// NewLDAPAuthService creates a new LDAPAuthService
+func NewLDAPAuthService(cfg *config.Config) *LDAPAuthService {
+	s := &LDAPAuthService{}
+	if cfg != nil {
+		s.cfg = cfg.LDAP
+	}
+	return s
+}
+
+// Enabled 返回 LDAP 登录是否启用
+func (s *LDAPAuthService) Enabled() bool {
+	return s != nil && s.cfg.Enabled
+}
+
+// GroupMappings 返回目录组映射
+func (s *LDAPAuthService) GroupMappings() []config.DirectoryGroupMapping {
+	return s.cfg.GroupMappings
+}
+
+// Authenticate 用服务账号查找用户，再以用户 DN + 密码绑定验证，返回目录身份
+func (s *LDAPAuthService) Authenticate(ctx context.Context, username, password string) (*DirectoryIdentity, error) {
+	if !s.Enabled() {
+		return nil, ErrLDAPDisabled
+	}
+	username = strings.TrimSpace(username)
+	// 空密码会触发 unauthenticated bind（RFC 4513 5.1.2），部分服务器会直接返回成功
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.ldap", "[LDAP] connect failed: %v", err)
+		return nil, ErrLDAPUnavailable
+	}
+	defer func() { _ = conn.Close() }()
+
+	if s.cfg.BindDN != "" {
+		if err := conn.Bind(s.cfg.BindDN, s.cfg.BindPassword); err != nil {
+			logger.LegacyPrintf("service.ldap", "[LDAP] service bind failed: %v", err)
+			return nil, ErrLDAPUnavailable
+		}
+	}
+
+	entry, err := s.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		logger.LegacyPrintf("service.ldap", "[LDAP] user bind failed: %v", err)
+		return nil, ErrLDAPUnavailable
+	}
+
+	email := strings.TrimSpace(entry.GetAttributeValue(s.cfg.EmailAttribute))
+	if email == "" {
+		email = DirectorySyntheticEmail("ldap", entry.DN)
+	}
+	return &DirectoryIdentity{
+		Provider: DirectoryProviderLDAP,
+		Subject:  entry.DN,
+		Email:    email,
+		Username: firstNonEmptyString(strings.TrimSpace(entry.GetAttributeValue(s.cfg.UsernameAttribute)), username),
+		Groups:   entry.GetAttributeValues(s.cfg.GroupAttribute),
+	}, nil
+}
+
+func (s *LDAPAuthService) dial(ctx context.Context) (*ldap.Conn, error) {
+	timeout := time.Duration(s.cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	u, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: s.cfg.InsecureSkipVerify, //nolint:gosec // 由管理员显式开启，用于内网自签证书
+		MinVersion:         tls.VersionTLS12,
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	conn, err := ldap.DialURL(s.cfg.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+	if s.cfg.StartTLS && strings.EqualFold(u.Scheme, "ldap") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (s *LDAPAuthService) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(s.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	attrs := []string{"dn"}
+	for _, attr := range []string{s.cfg.EmailAttribute, s.cfg.UsernameAttribute, s.cfg.GroupAttribute} {
+		if attr != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	req := ldap.NewSearchRequest(
+		s.cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, // 只需判断是否唯一
+		s.cfg.TimeoutSeconds,
+		false,
+		filter,
+		attrs,
+		nil,
+	)
+	result, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			logger.LegacyPrintf("service.ldap", "[LDAP] user filter matched more than one entry")
+			return nil, ErrLDAPInvalidCredentials
+		}
+		var ldapErr *ldap.Error
+		if errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.LDAPResultNoSuchObject {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		logger.LegacyPrintf("service.ldap", "[LDAP] search failed: %v", err)
+		return nil, ErrLDAPUnavailable
+	}
+	if len(result.Entries) != 1 {
+		// 不区分“用户不存在”与“匹配多个”，避免枚举
+		return nil, ErrLDAPInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// DirectorySyntheticEmail 为没有邮箱属性的目录用户生成稳定的合成邮箱
+func DirectorySyntheticEmail(provider, subject string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(subject))))
+	return provider + "-" + hex.EncodeToString(sum[:16]) + DirectorySSOSyntheticEmailDomain
+}
+
+func firstNonEmptyString(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testLDAPServer 是只实现 Bind / Search / Unbind 的最小 LDAPv3 服务端，足够驱动 go-ldap 客户端
+type testLDAPServer struct {
+	ln       net.Listener
+	bindDN   string
+	bindPass string
+	entries  []testLDAPEntry
+
+	mu      sync.Mutex
+	filters []string
+}
+
+func startTestLDAPServer(t *testing.T, entries []testLDAPEntry) *testLDAPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &testLDAPServer{ln: ln, bindDN: "CN=svc,DC=corp,DC=example", bindPass: "svc-secret", entries: entries}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+	return srv
+}
+
+func (s *testLDAPServer) url() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+func (s *testLDAPServer) searchFilters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.filters...)
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if name == s.bindDN && password == s.bindPass {
+				code = ldap.LDAPResultSuccess
+			}
+			for _, e := range s.entries {
+				if strings.EqualFold(e.dn, name) && password != "" && e.password == password {
+					code = ldap.LDAPResultSuccess
+				}
+			}
+			_, _ = conn.Write(testLDAPResult(msgID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			s.mu.Lock()
+			s.filters = append(s.filters, filter)
+			s.mu.Unlock()
+			for _, e := range s.entries {
+				if !strings.Contains(filter, "(sAMAccountName="+e.attrs["sAMAccountName"][0]+")") {
+					continue
+				}
+				_, _ = conn.Write(testLDAPSearchEntry(msgID, e).Bytes())
+			}
+			_, _ = conn.Write(testLDAPResult(msgID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func testLDAPEnvelope(msgID int64, op *ber.Packet) *ber.Packet {
+	env := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	env.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+	env.AppendChild(op)
+	return env
+}
+
+func testLDAPResult(msgID int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return testLDAPEnvelope(msgID, op)
+}
+
+func testLDAPSearchEntry(msgID int64, e testLDAPEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return testLDAPEnvelope(msgID, op)
+}
+
+func newLDAPAuthServiceForTest(srv *testLDAPServer) *LDAPAuthService {
+	return NewLDAPAuthService(&config.Config{LDAP: config.LDAPConnectConfig{
+		Enabled:           true,
+		URL:               srv.url(),
+		BindDN:            srv.bindDN,
+		BindPassword:      srv.bindPass,
+		BaseDN:            "DC=corp,DC=example",
+		UserFilter:        "(&(objectClass=user)(sAMAccountName={username}))",
+		EmailAttribute:    "mail",
+		UsernameAttribute: "displayName",
+		GroupAttribute:    "memberOf",
+		TimeoutSeconds:    5,
+	}})
+}
+
+var testLDAPAlice = testLDAPEntry{
+	dn:       "CN=Alice,OU=Staff,DC=corp,DC=example",
+	password: "alice-pass",
+	attrs: map[string][]string{
+		"sAMAccountName": {"alice"},
+		"mail":           {"alice@corp.example"},
+		"displayName":    {"Alice Liddell"},
+		"memberOf":       {"CN=AI-Users,OU=Groups,DC=corp,DC=example", "CN=Staff,OU=Groups,DC=corp,DC=example"},
+	},
+}
+
+func TestLDAPAuthenticate_Success(t *testing.T) {
+	srv := startTestLDAPServer(t, []testLDAPEntry{testLDAPAlice})
+	svc := newLDAPAuthServiceForTest(srv)
+
+	identity, err := svc.Authenticate(context.Background(), "alice", "alice-pass")
+	require.NoError(t, err)
+	require.Equal(t, DirectoryProviderLDAP, identity.Provider)
+	require.Equal(t, testLDAPAlice.dn, identity.Subject)
+	require.Equal(t, "alice@corp.example", identity.Email)
+	require.Equal(t, "Alice Liddell", identity.Username)
+	require.ElementsMatch(t, testLDAPAlice.attrs["memberOf"], identity.Groups)
+}
+
+func TestLDAPAuthenticate_WrongPassword(t *testing.T) {
+	srv := startTestLDAPServer(t, []testLDAPEntry{testLDAPAlice})
+	_, err := newLDAPAuthServiceForTest(srv).Authenticate(context.Background(), "alice", "nope")
+	require.ErrorIs(t, err, ErrLDAPInvalidCredentials)
+}
+
+func TestLDAPAuthenticate_EmptyPasswordRejectedBeforeBind(t *testing.T) {
+	srv := startTestLDAPServer(t, []testLDAPEntry{testLDAPAlice})
+	_, err := newLDAPAuthServiceForTest(srv).Authenticate(context.Background(), "alice", "")
+	require.ErrorIs(t, err, ErrLDAPInvalidCredentials)
+	require.Empty(t, srv.searchFilters())
+}
+
+func TestLDAPAuthenticate_UnknownUser(t *testing.T) {
+	srv := startTestLDAPServer(t, []testLDAPEntry{testLDAPAlice})
+	_, err := newLDAPAuthServiceForTest(srv).Authenticate(context.Background(), "mallory", "x")
+	require.ErrorIs(t, err, ErrLDAPInvalidCredentials)
+}
+
+func TestLDAPAuthenticate_FilterIsEscaped(t *testing.T) {
+	srv := startTestLDAPServer(t, []testLDAPEntry{testLDAPAlice})
+	_, err := newLDAPAuthServiceForTest(srv).Authenticate(context.Background(), "*)(sAMAccountName=alice", "alice-pass")
+	require.ErrorIs(t, err, ErrLDAPInvalidCredentials)
+	filters := srv.searchFilters()
+	require.Len(t, filters, 1)
+	require.NotContains(t, filters[0], "(sAMAccountName=alice)")
+}
+
+func TestLDAPAuthenticate_SyntheticEmail(t *testing.T) {
+	bob := testLDAPEntry{
+		dn:       "CN=Bob,OU=Staff,DC=corp,DC=example",
+		password: "bob-pass",
+		attrs:    map[string][]string{"sAMAccountName": {"bob"}},
+	}
+	srv := startTestLDAPServer(t, []testLDAPEntry{bob})
+
+	identity, err := newLDAPAuthServiceForTest(srv).Authenticate(context.Background(), "bob", "bob-pass")
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(identity.Email, DirectorySSOSyntheticEmailDomain))
+	require.True(t, isReservedEmail(identity.Email))
+	require.Equal(t, "bob", identity.Username)
+}
+
+func TestLDAPAuthenticate_ServerDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	svc := NewLDAPAuthService(&config.Config{LDAP: config.LDAPConnectConfig{
+		Enabled: true, URL: "ldap://" + addr, BaseDN: "DC=x", UserFilter: "(uid={username})", TimeoutSeconds: 1,
+	}})
+	_, err = svc.Authenticate(context.Background(), "alice", "pw")
+	require.ErrorIs(t, err, ErrLDAPUnavailable)
+}
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/claude"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/gemini"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/openai"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+const (
+	modelCatalogCacheTTL = time.Minute
+	// modelCatalogDefaultCreatedAt 无法推断发布日期时使用的占位时间（与历史 /v1/models 保持一致）
+	modelCatalogDefaultCreatedAt = "2024-01-01T00:00:00Z"
+	tokensPerMillion             = 1_000_000
+)
+
+// modelDateSuffixRegex 匹配模型 ID 末尾的发布日期（如 claude-opus-4-5-20251101）
+var modelDateSuffixRegex = regexp.MustCompile(`-(20\d{2})(\d{2})(\d{2})$`)
+
+// ModelCapabilities 模型能力
+type ModelCapabilities struct {
+	Vision        bool `json:"vision"`
+	ToolUse       bool `json:"tool_use"`
+	Thinking      bool `json:"thinking"`
+	PromptCaching bool `json:"prompt_caching"`
+	PDFInput      bool `json:"pdf_input"`
+}
+
+// ModelCatalogPricing 模型价格（USD / 百万 token，已乘以倍率）
+type ModelCatalogPricing struct {
+	Currency          string  `json:"currency"`
+	BillingMode       string  `json:"billing_mode"`
+	Source            string  `json:"source"`
+	RateMultiplier    float64 `json:"rate_multiplier"`
+	InputPerMTok      float64 `json:"input_per_mtok"`
+	OutputPerMTok     float64 `json:"output_per_mtok"`
+	CacheWritePerMTok float64 `json:"cache_write_per_mtok"`
+	CacheReadPerMTok  float64 `json:"cache_read_per_mtok"`
+	PerRequest        float64 `json:"per_request,omitempty"`
+	// Tiered 渠道配置了区间/分层定价，上述价格为首个区间的价格
+	Tiered bool `json:"tiered,omitempty"`
+}
+
+// ModelCatalogEntry 模型目录条目
+type ModelCatalogEntry struct {
+	ID              string               `json:"id"`
+	DisplayName     string               `json:"display_name"`
+	CreatedAt       string               `json:"created_at"`
+	Platform        string               `json:"platform,omitempty"`
+	Provider        string               `json:"provider,omitempty"`
+	UpstreamModel   string               `json:"upstream_model,omitempty"`
+	Mode            string               `json:"mode,omitempty"`
+	ContextWindow   int                  `json:"context_window,omitempty"`
+	MaxOutputTokens int                  `json:"max_output_tokens,omitempty"`
+	Capabilities    ModelCapabilities    `json:"capabilities"`
+	Pricing         *ModelCatalogPricing `json:"pricing,omitempty"`
+}
+
+// ModelCatalogQuery 模型目录查询条件
+type ModelCatalogQuery struct {
+	// Group API Key 所属分组；nil 表示未绑定分组
+	Group *Group
+	// UserID 非 0 时应用用户专属分组倍率
+	UserID int64
+	// Platform 覆盖分组平台（如 /antigravity 强制平台路由）
+	Platform string
+}
+
+// PublicPricingGroup 公开价格页的分组信息
+type PublicPricingGroup struct {
+	ID             int64               `json:"id"`
+	Name           string              `json:"name"`
+	Description    string              `json:"description,omitempty"`
+	Platform       string              `json:"platform"`
+	RateMultiplier float64             `json:"rate_multiplier"`
+	Models         []ModelCatalogEntry `json:"models"`
+}
+
+// ModelCatalogService 模型目录：合并账号模型映射、渠道定价与 LiteLLM 元数据，
+// 给出模型的上下文长度、能力以及指定 Key 实际支付的价格。
+type ModelCatalogService struct {
+	gatewayService *GatewayService
+	pricingService *PricingService
+	resolver       *ModelPricingResolver
+	channelService *ChannelService
+	groupRepo      GroupRepository
+	cfg            *config.Config
+
+	cache *gocache.Cache
+}
+
+// NewModelCatalogService 创建模型目录服务
+func NewModelCatalogService(
+	gatewayService *GatewayService,
+	pricingService *PricingService,
+	resolver *ModelPricingResolver,
+	channelService *ChannelService,
+	groupRepo GroupRepository,
+	cfg *config.Config,
+) *ModelCatalogService {
+	return &ModelCatalogService{
+		gatewayService: gatewayService,
+		pricingService: pricingService,
+		resolver:       resolver,
+		channelService: channelService,
+		groupRepo:      groupRepo,
+		cfg:            cfg,
+		cache:          gocache.New(modelCatalogCacheTTL, 2*modelCatalogCacheTTL),
+	}
+}
+
+// List 返回 API Key 可用的模型目录，价格已应用分组/用户倍率
+func (s *ModelCatalogService) List(ctx context.Context, q ModelCatalogQuery) []ModelCatalogEntry {
+	var groupID *int64
+	platform := strings.TrimSpace(q.Platform)
+	if q.Group != nil {
+		id := q.Group.ID
+		groupID = &id
+		if platform == "" {
+			platform = q.Group.Platform
+		}
+	}
+
+	base := s.groupCatalog(ctx, groupID, platform)
+	multiplier := s.rateMultiplier(ctx, q.Group, q.UserID)
+	return applyCatalogMultiplier(base, multiplier)
+}
+
+// ListPublicPricing 返回所有公开（非专属）分组的模型价格，供前端价格页展示
+func (s *ModelCatalogService) ListPublicPricing(ctx context.Context) ([]PublicPricingGroup, error) {
+	if cached, ok := s.cache.Get("public"); ok {
+		if groups, ok := cached.([]PublicPricingGroup); ok {
+			return groups, nil
+		}
+	}
+	groups, err := s.groupRepo.ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	out := make([]PublicPricingGroup, 0, len(groups))
+	for i := range groups {
+		g := &groups[i]
+		if g.IsExclusive {
+			continue
+		}
+		id := g.ID
+		multiplier := s.rateMultiplier(ctx, g, 0)
+		out = append(out, PublicPricingGroup{
+			ID:             g.ID,
+			Name:           g.Name,
+			Description:    g.Description,
+			Platform:       g.Platform,
+			RateMultiplier: multiplier,
+			Models:         applyCatalogMultiplier(s.groupCatalog(ctx, &id, g.Platform), multiplier),
+		})
+	}
+	s.cache.Set("public", out, gocache.DefaultExpiration)
+	return out, nil
+}
+
+// rateMultiplier 费率倍数（优先级：用户专属 > 分组默认 > 系统默认），与计费逻辑一致
+func (s *ModelCatalogService) rateMultiplier(ctx context.Context, group *Group, userID int64) float64 {
+	multiplier := 1.0
+	if s.cfg != nil {
+		multiplier = s.cfg.Default.RateMultiplier
+	}
+	if group == nil {
+		return multiplier
+	}
+	if userID > 0 && s.gatewayService != nil {
+		return s.gatewayService.getUserGroupRateMultiplier(ctx, userID, group.ID, group.RateMultiplier)
+	}
+	return group.RateMultiplier
+}
+
+// groupCatalog 构建分组模型目录（未乘倍率，按分组+平台短缓存）
+func (s *ModelCatalogService) groupCatalog(ctx context.Context, groupID *int64, platform string) []ModelCatalogEntry {
+	cacheKey := "group:" + modelsListCacheKey(groupID, platform)
+	if cached, ok := s.cache.Get(cacheKey); ok {
+		if entries, ok := cached.([]ModelCatalogEntry); ok {
+			return entries
+		}
+	}
+
+	defaults := defaultCatalogModels(platform)
+	ids := s.catalogModelIDs(ctx, groupID, platform, defaults)
+
+	var targets map[string]string
+	if s.gatewayService != nil {
+		targets = s.gatewayService.GetAvailableModelTargets(ctx, groupID, "")
+	}
+
+	entries := make([]ModelCatalogEntry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, s.buildEntry(ctx, groupID, platform, id, targets[id], defaults[id]))
+	}
+	s.cache.Set(cacheKey, entries, gocache.DefaultExpiration)
+	return entries
+}
+
+// catalogModelIDs 合并账号模型映射与渠道定价中的模型；均为空时使用平台默认模型
+func (s *ModelCatalogService) catalogModelIDs(ctx context.Context, groupID *int64, platform string, defaults map[string]ModelCatalogEntry) []string {
+	set := make(map[string]struct{})
+	if s.gatewayService != nil {
+		for _, id := range s.gatewayService.GetAvailableModels(ctx, groupID, "") {
+			set[id] = struct{}{}
+		}
+	}
+	var channel *Channel
+	if groupID != nil && s.channelService != nil {
+		channel, _ = s.channelService.GetChannelForGroup(ctx, *groupID)
+	}
+	if channel != nil {
+		for _, p := range channel.ModelPricing {
+			if platform != "" && p.Platform != "" && p.Platform != platform {
+				continue
+			}
+			for _, m := range p.Models {
+				if m = strings.TrimSpace(m); m != "" {
+					set[m] = struct{}{}
+				}
+			}
+		}
+	}
+	if len(set) == 0 {
+		for id := range defaults {
+			set[id] = struct{}{}
+		}
+	}
+
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		if channel != nil && channel.RestrictModels && s.channelService.IsModelRestricted(ctx, *groupID, id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *ModelCatalogService) buildEntry(ctx context.Context, groupID *int64, platform, id, accountTarget string, known ModelCatalogEntry) ModelCatalogEntry {
+	entry := ModelCatalogEntry{
+		ID:          id,
+		DisplayName: known.DisplayName,
+		CreatedAt:   known.CreatedAt,
+		Platform:    platform,
+	}
+	if entry.DisplayName == "" {
+		entry.DisplayName = id
+	}
+	if entry.CreatedAt == "" {
+		entry.CreatedAt = modelCreatedAtFromID(id)
+	}
+
+	// 上游模型：渠道映射优先，其次账号 model_mapping
+	upstream := id
+	if groupID != nil && s.channelService != nil {
+		if mapped := s.channelService.ResolveChannelMapping(ctx, *groupID, id); mapped.MappedModel != "" {
+			upstream = mapped.MappedModel
+		}
+	}
+	if upstream == id && accountTarget != "" {
+		upstream = accountTarget
+	}
+	if upstream != id {
+		entry.UpstreamModel = upstream
+	}
+
+	if meta := s.lookupLiteLLM(id, upstream); meta != nil {
+		entry.Provider = meta.LiteLLMProvider
+		entry.Mode = meta.Mode
+		entry.ContextWindow = meta.MaxInputTokens
+		entry.MaxOutputTokens = meta.MaxOutputTokens
+		entry.Capabilities = ModelCapabilities{
+			Vision:        meta.SupportsVision,
+			ToolUse:       meta.SupportsFunctionCalling,
+			Thinking:      meta.SupportsReasoning,
+			PromptCaching: meta.SupportsPromptCaching,
+			PDFInput:      meta.SupportsPDFInput,
+		}
+	}
+
+	entry.Pricing = s.basePricing(ctx, groupID, id, upstream)
+	return entry
+}
+
+// ContextWindow 返回模型的上下文窗口（按分组渠道映射解析上游模型），未知时返回 0
+func (s *ModelCatalogService) ContextWindow(ctx context.Context, groupID *int64, model string) int {
+	if s == nil || model == "" {
+		return 0
+	}
+	upstream := model
+	if groupID != nil && s.channelService != nil {
+		if mapped := s.channelService.ResolveChannelMapping(ctx, *groupID, model); mapped.MappedModel != "" {
+			upstream = mapped.MappedModel
+		}
+	}
+	if meta := s.lookupLiteLLM(model, upstream); meta != nil {
+		return meta.MaxInputTokens
+	}
+	return 0
+}
+
+// lookupLiteLLM 优先按上游模型查找元数据，其次按请求模型
+func (s *ModelCatalogService) lookupLiteLLM(id, upstream string) *LiteLLMModelPricing {
+	if s.pricingService == nil || strings.Contains(id, "*") {
+		return nil
+	}
+	if upstream != "" && upstream != id {
+		if meta := s.pricingService.GetModelPricing(upstream); meta != nil {
+			return meta
+		}
+	}
+	return s.pricingService.GetModelPricing(id)
+}
+
+// basePricing 解析未乘倍率的价格：渠道定价按请求模型匹配，LiteLLM 价格按上游模型匹配
+func (s *ModelCatalogService) basePricing(ctx context.Context, groupID *int64, id, upstream string) *ModelCatalogPricing {
+	if s.resolver == nil || strings.Contains(id, "*") {
+		return nil
+	}
+	resolved := s.resolver.Resolve(ctx, PricingInput{Model: id, GroupID: groupID})
+	if resolved.Source == PricingSourceFallback && upstream != id {
+		resolved = s.resolver.Resolve(ctx, PricingInput{Model: upstream, GroupID: groupID})
+	}
+	if resolved.Source == PricingSourceFallback {
+		return nil
+	}
+
+	p := &ModelCatalogPricing{
+		Currency:    "USD",
+		BillingMode: string(resolved.Mode),
+		Source:      resolved.Source,
+	}
+	switch resolved.Mode {
+	case BillingModePerRequest, BillingModeImage:
+		p.PerRequest = resolved.DefaultPerRequestPrice
+		if len(resolved.RequestTiers) > 0 {
+			p.Tiered = true
+			if p.PerRequest == 0 && resolved.RequestTiers[0].PerRequestPrice != nil {
+				p.PerRequest = *resolved.RequestTiers[0].PerRequestPrice
+			}
+		}
+	default:
+		mp := resolved.BasePricing
+		if len(resolved.Intervals) > 0 {
+			p.Tiered = true
+			mp = intervalToModelPricing(&resolved.Intervals[0], resolved.SupportsCacheBreakdown)
+		}
+		if mp != nil {
+			p.InputPerMTok = mp.InputPricePerToken * tokensPerMillion
+			p.OutputPerMTok = mp.OutputPricePerToken * tokensPerMillion
+			p.CacheWritePerMTok = mp.CacheCreationPricePerToken * tokensPerMillion
+			p.CacheReadPerMTok = mp.CacheReadPricePerToken * tokensPerMillion
+		}
+	}
+	return p
+}
+
+// applyCatalogMultiplier 复制目录并按倍率换算价格（缓存中的条目不可修改）
+func applyCatalogMultiplier(base []ModelCatalogEntry, multiplier float64) []ModelCatalogEntry {
+	out := make([]ModelCatalogEntry, len(base))
+	for i, e := range base {
+		if e.Pricing != nil {
+			p := *e.Pricing
+			p.RateMultiplier = multiplier
+			p.InputPerMTok *= multiplier
+			p.OutputPerMTok *= multiplier
+			p.CacheWritePerMTok *= multiplier
+			p.CacheReadPerMTok *= multiplier
+			p.PerRequest *= multiplier
+			e.Pricing = &p
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// defaultCatalogModels 平台默认模型（账号未配置模型映射时展示），附带已知的展示名与发布时间
+func defaultCatalogModels(platform string) map[string]ModelCatalogEntry {
+	out := make(map[string]ModelCatalogEntry)
+	switch platform {
+	case PlatformOpenAI:
+		for _, m := range openai.DefaultModels {
+			out[m.ID] = ModelCatalogEntry{
+				ID:          m.ID,
+				DisplayName: m.DisplayName,
+				CreatedAt:   time.Unix(m.Created, 0).UTC().Format(time.RFC3339),
+			}
+		}
+	case PlatformGemini:
+		for _, m := range gemini.DefaultModels() {
+			id := strings.TrimPrefix(m.Name, "models/")
+			out[id] = ModelCatalogEntry{ID: id, DisplayName: m.DisplayName}
+		}
+	default:
+		for _, m := range claude.DefaultModels {
+			out[m.ID] = ModelCatalogEntry{ID: m.ID, DisplayName: m.DisplayName, CreatedAt: m.CreatedAt}
+		}
+	}
+	return out
+}
+
+// modelCreatedAtFromID 从模型 ID 的日期后缀推断发布时间
+func modelCreatedAtFromID(id string) string {
+	m := modelDateSuffixRegex.FindStringSubmatch(id)
+	if m == nil {
+		return modelCatalogDefaultCreatedAt
+	}
+	t, err := time.Parse("20060102", m[1]+m[2]+m[3])
+	if err != nil {
+		return modelCatalogDefaultCreatedAt
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+const testCatalogLiteLLMJSON = `{
+	"sample_spec": {"max_tokens": "LEGACY parameter"},
+	"claude-sonnet-4-5-20250929": {
+		"input_cost_per_token": 3e-06,
+		"output_cost_per_token": 1.5e-05,
+		"cache_creation_input_token_cost": 3.75e-06,
+		"cache_read_input_token_cost": 3e-07,
+		"litellm_provider": "anthropic",
+		"mode": "chat",
+		"max_input_tokens": 200000,
+		"max_output_tokens": 64000,
+		"supports_vision": true,
+		"supports_function_calling": true,
+		"supports_reasoning": true,
+		"supports_prompt_caching": true,
+		"supports_pdf_input": true
+	},
+	"legacy-model": {
+		"input_cost_per_token": 1e-06,
+		"output_cost_per_token": 2e-06,
+		"max_tokens": 4096,
+		"max_input_tokens": "bogus"
+	}
+}`
+
+func newTestModelCatalogService(t *testing.T, multiplier float64) *ModelCatalogService {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Default.RateMultiplier = multiplier
+	pricing := NewPricingService(cfg, nil)
+	data, err := pricing.parsePricingData([]byte(testCatalogLiteLLMJSON))
+	require.NoError(t, err)
+	pricing.pricingData = data
+	resolver := NewModelPricingResolver(nil, NewBillingService(cfg, pricing))
+	return NewModelCatalogService(nil, pricing, resolver, nil, nil, cfg)
+}
+
+func TestPricingService_ParsesCapabilities(t *testing.T) {
+	svc := newTestModelCatalogService(t, 1)
+
+	meta := svc.pricingService.GetModelPricing("claude-sonnet-4-5-20250929")
+	require.NotNil(t, meta)
+	require.Equal(t, 200000, meta.MaxInputTokens)
+	require.Equal(t, 64000, meta.MaxOutputTokens)
+	require.True(t, meta.SupportsVision)
+	require.True(t, meta.SupportsReasoning)
+
+	// 能力字段类型异常不影响价格条目；max_tokens 作为最大输出回退
+	legacy := svc.pricingService.GetModelPricing("legacy-model")
+	require.NotNil(t, legacy)
+	require.InDelta(t, 1e-06, legacy.InputCostPerToken, 1e-12)
+	require.Equal(t, 4096, legacy.MaxOutputTokens)
+	require.Zero(t, legacy.MaxInputTokens)
+}
+
+func TestModelCatalogService_DefaultModelsWithEffectivePrice(t *testing.T) {
+	svc := newTestModelCatalogService(t, 2)
+
+	entries := svc.List(context.Background(), ModelCatalogQuery{})
+	require.NotEmpty(t, entries)
+
+	var sonnet *ModelCatalogEntry
+	for i := range entries {
+		if entries[i].ID == "claude-sonnet-4-5-20250929" {
+			sonnet = &entries[i]
+		}
+	}
+	require.NotNil(t, sonnet, "default claude models should be listed")
+	require.Equal(t, 200000, sonnet.ContextWindow)
+	require.Equal(t, 64000, sonnet.MaxOutputTokens)
+	require.Equal(t, ModelCapabilities{Vision: true, ToolUse: true, Thinking: true, PromptCaching: true, PDFInput: true}, sonnet.Capabilities)
+	require.NotNil(t, sonnet.Pricing)
+	require.Equal(t, PricingSourceLiteLLM, sonnet.Pricing.Source)
+	require.InDelta(t, 2.0, sonnet.Pricing.RateMultiplier, 1e-9)
+	require.InDelta(t, 6.0, sonnet.Pricing.InputPerMTok, 1e-9)
+	require.InDelta(t, 30.0, sonnet.Pricing.OutputPerMTok, 1e-9)
+	require.InDelta(t, 0.6, sonnet.Pricing.CacheReadPerMTok, 1e-9)
+
+	// 缓存中的基础价格不应被倍率污染
+	again := svc.List(context.Background(), ModelCatalogQuery{})
+	for _, e := range again {
+		if e.ID == sonnet.ID {
+			require.InDelta(t, 6.0, e.Pricing.InputPerMTok, 1e-9)
+		}
+	}
+}
+
+func TestModelCatalogService_GroupMultiplier(t *testing.T) {
+	svc := newTestModelCatalogService(t, 1)
+	require.InDelta(t, 1.5, svc.rateMultiplier(context.Background(), &Group{ID: 1, RateMultiplier: 1.5}, 0), 1e-9)
+	require.InDelta(t, 1.0, svc.rateMultiplier(context.Background(), nil, 0), 1e-9)
+}
+
+func TestModelCreatedAtFromID(t *testing.T) {
+	require.Equal(t, "2025-11-01T00:00:00Z", modelCreatedAtFromID("claude-opus-4-5-20251101"))
+	require.Equal(t, modelCatalogDefaultCreatedAt, modelCreatedAtFromID("gpt-5.4"))
+}
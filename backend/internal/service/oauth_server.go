@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+)
+
+// OAuth 授权服务器常量（RFC 6749 / RFC 7636 / RFC 8628）
+const (
+	OAuthGrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	OAuthGrantTypeAuthorizationCode = "authorization_code"
+	OAuthGrantTypeRefreshToken      = "refresh_token"
+
+	OAuthScopeOfflineAccess = "offline_access"
+	oauthScopeGroupPrefix   = "group:"
+
+	OAuthDefaultClientID = "sub2api-cli"
+
+	oauthDeviceStatusPending  = "pending"
+	oauthDeviceStatusApproved = "approved"
+	oauthDeviceStatusDenied   = "denied"
+
+	oauthRefreshTokenPrefix = "s2r_"
+	// 用户码字符集去掉了易混淆的元音与 0/1/I/O（RFC 8628 §6.1 建议）
+	oauthUserCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	oauthUserCodeLength   = 8
+)
+
+// oauthPlatformScopes 以平台名作为 scope 时，授权页只列出对应平台的分组
+var oauthPlatformScopes = []string{PlatformAnthropic, PlatformOpenAI, PlatformGemini, PlatformAntigravity}
+
+// 面向用户授权页的错误（统一响应格式）
+var (
+	ErrOAuthServerDisabled     = infraerrors.NotFound("OAUTH_SERVER_DISABLED", "oauth authorization server is disabled")
+	ErrOAuthUnknownClient      = infraerrors.BadRequest("OAUTH_UNKNOWN_CLIENT", "unknown oauth client")
+	ErrOAuthInvalidRedirectURI = infraerrors.BadRequest("OAUTH_INVALID_REDIRECT_URI", "redirect_uri is not registered for this client")
+	ErrOAuthInvalidScope       = infraerrors.BadRequest("OAUTH_INVALID_SCOPE", "invalid scope")
+	ErrOAuthPKCERequired       = infraerrors.BadRequest("OAUTH_PKCE_REQUIRED", "code_challenge with method S256 is required")
+	ErrOAuthUserCodeNotFound   = infraerrors.NotFound("OAUTH_USER_CODE_NOT_FOUND", "the code is invalid or has expired")
+	ErrOAuthUserCodeUsed       = infraerrors.Conflict("OAUTH_USER_CODE_USED", "this code has already been used")
+	ErrOAuthGroupNotInScope    = infraerrors.BadRequest("OAUTH_GROUP_NOT_IN_SCOPE", "the selected group is not allowed by the requested scope")
+	ErrOAuthGrantNotFound      = infraerrors.NotFound("OAUTH_GRANT_NOT_FOUND", "authorization not found")
+)
+
+// OAuthError 令牌端点错误，按 RFC 6749 §5.2 输出 {error, error_description}
+type OAuthError struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(status int, code, description string) *OAuthError {
+	return &OAuthError{Status: status, Code: code, Description: description}
+}
+
+var (
+	errOAuthAuthorizationPending = newOAuthError(http.StatusBadRequest, "authorization_pending", "the user has not yet approved the request")
+	errOAuthSlowDown             = newOAuthError(http.StatusBadRequest, "slow_down", "polling too frequently")
+	errOAuthAccessDenied         = newOAuthError(http.StatusBadRequest, "access_denied", "the user denied the request")
+	errOAuthExpiredToken         = newOAuthError(http.StatusBadRequest, "expired_token", "the device code has expired")
+)
+
+// OAuthServerClient 已注册的公开客户端
+type OAuthServerClient struct {
+	ClientID     string
+	Name         string
+	RedirectURIs []string
+}
+
+// OAuthDeviceAuthorization 设备码授权的短期状态（Redis）
+type OAuthDeviceAuthorization struct {
+	DeviceCodeHash string    `json:"device_code_hash"`
+	UserCode       string    `json:"user_code"`
+	ClientID       string    `json:"client_id"`
+	Scope          string    `json:"scope"`
+	Status         string    `json:"status"`
+	UserID         int64     `json:"user_id,omitempty"`
+	GroupID        int64     `json:"group_id,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// OAuthAuthorizationCode 授权码的短期状态（Redis），一次性消费
+type OAuthAuthorizationCode struct {
+	ClientID      string    `json:"client_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	CodeChallenge string    `json:"code_challenge"`
+	UserID        int64     `json:"user_id"`
+	GroupID       int64     `json:"group_id"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// OAuthServerCache 设备码/授权码的短期存储
+type OAuthServerCache interface {
+	// SaveDeviceAuthorization 同时写入 device_code 摘要与 user_code 两个索引
+	SaveDeviceAuthorization(ctx context.Context, auth *OAuthDeviceAuthorization, ttl time.Duration) error
+	GetDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*OAuthDeviceAuthorization, error)
+	GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*OAuthDeviceAuthorization, error)
+	// UpdateDeviceAuthorization 保留剩余 TTL 覆盖写入；记录不存在时返回 ErrOAuthUserCodeNotFound
+	UpdateDeviceAuthorization(ctx context.Context, auth *OAuthDeviceAuthorization) error
+	// ConsumeDeviceAuthorization 原子取出并删除，保证同一设备码只能兑换一次；不存在时返回 nil, nil
+	ConsumeDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*OAuthDeviceAuthorization, error)
+	// TouchDevicePoll 记录本次轮询时间并返回上次轮询时间（首次为零值）
+	TouchDevicePoll(ctx context.Context, deviceCodeHash string, now time.Time, ttl time.Duration) (time.Time, error)
+
+	SaveAuthorizationCode(ctx context.Context, codeHash string, code *OAuthAuthorizationCode, ttl time.Duration) error
+	// ConsumeAuthorizationCode 原子取出并删除；不存在时返回 nil, nil
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*OAuthAuthorizationCode, error)
+}
+
+// OAuthGrant 经用户授权签发的 API Key 及其 refresh_token
+type OAuthGrant struct {
+	ID               int64      `json:"id"`
+	UserID           int64      `json:"user_id"`
+	APIKeyID         int64      `json:"api_key_id"`
+	ClientID         string     `json:"client_id"`
+	ClientName       string     `json:"client_name"`
+	GroupID          int64      `json:"group_id"`
+	Scope            string     `json:"scope"`
+	RefreshTokenHash string     `json:"-"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+	LastRefreshedAt  *time.Time `json:"last_refreshed_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	// 以下字段由列表查询关联 api_keys 填充
+	APIKeyName      string     `json:"api_key_name,omitempty"`
+	APIKeyStatus    string     `json:"api_key_status,omitempty"`
+	APIKeyExpiresAt *time.Time `json:"api_key_expires_at,omitempty"`
+	APIKeyDeleted   bool       `json:"api_key_deleted"`
+}
+
+// OAuthGrantRepository oauth_grants 表访问
+type OAuthGrantRepository interface {
+	Create(ctx context.Context, grant *OAuthGrant) error
+	GetByID(ctx context.Context, id int64) (*OAuthGrant, error)
+	GetByRefreshTokenHash(ctx context.Context, hash string) (*OAuthGrant, error)
+	GetActiveByAPIKeyID(ctx context.Context, apiKeyID int64) (*OAuthGrant, error)
+	ListByUser(ctx context.Context, userID int64) ([]*OAuthGrant, error)
+	// RotateRefreshToken 仅当当前摘要仍为 oldHash 且未撤销时替换，返回是否成功（并发刷新只有一个成功）
+	RotateRefreshToken(ctx context.Context, id int64, oldHash, newHash string, expiresAt time.Time) (bool, error)
+	Revoke(ctx context.Context, id int64) error
+}
+
+// OAuthDeviceAuthorizationResponse RFC 8628 §3.2
+type OAuthDeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// OAuthTokenRequest 令牌端点参数（application/x-www-form-urlencoded）
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	ClientID     string `form:"client_id"`
+	DeviceCode   string `form:"device_code"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+}
+
+// OAuthTokenResponse RFC 6749 §5.1；access_token 即绑定分组的 sub2api API Key
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+	GroupID      int64  `json:"group_id"`
+}
+
+// OAuthAuthorizeRequest 授权码模式参数（授权页提交时附带用户选择）
+type OAuthAuthorizeRequest struct {
+	ClientID            string `json:"client_id" form:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+	GroupID             int64  `json:"group_id"`
+	Approve             bool   `json:"approve"`
+}
+
+// OAuthConsentGroup 授权页可选分组
+type OAuthConsentGroup struct {
+	ID             int64   `json:"id"`
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	Platform       string  `json:"platform"`
+	RateMultiplier float64 `json:"rate_multiplier"`
+}
+
+// OAuthConsent 授权页展示内容
+type OAuthConsent struct {
+	ClientID      string              `json:"client_id"`
+	ClientName    string              `json:"client_name"`
+	Scope         string              `json:"scope"`
+	OfflineAccess bool                `json:"offline_access"`
+	KeyTTLSeconds int                 `json:"key_ttl_seconds"`
+	Groups        []OAuthConsentGroup `json:"groups"`
+	UserCode      string              `json:"user_code,omitempty"`
+}
+
+// oauthScope 解析后的 scope：group:<id> 固定分组，平台名限定分组平台，offline_access 申请 refresh_token
+type oauthScope struct {
+	GroupIDs  []int64
+	Platforms []string
+	Offline   bool
+}
+
+func parseOAuthScope(raw string) (*oauthScope, error) {
+	scope := &oauthScope{}
+	for _, token := range strings.Fields(raw) {
+		switch {
+		case token == OAuthScopeOfflineAccess:
+			scope.Offline = true
+		case strings.HasPrefix(token, oauthScopeGroupPrefix):
+			id, err := strconv.ParseInt(strings.TrimPrefix(token, oauthScopeGroupPrefix), 10, 64)
+			if err != nil || id <= 0 {
+				return nil, ErrOAuthInvalidScope.WithMetadata(map[string]string{"scope": token})
+			}
+			if !slices.Contains(scope.GroupIDs, id) {
+				scope.GroupIDs = append(scope.GroupIDs, id)
+			}
+		case slices.Contains(oauthPlatformScopes, token):
+			if !slices.Contains(scope.Platforms, token) {
+				scope.Platforms = append(scope.Platforms, token)
+			}
+		default:
+			return nil, ErrOAuthInvalidScope.WithMetadata(map[string]string{"scope": token})
+		}
+	}
+	return scope, nil
+}
+
+// allows 判断分组是否落在 scope 范围内；未限定分组与平台时允许用户任选
+func (s *oauthScope) allows(group *Group) bool {
+	if len(s.GroupIDs) > 0 && !slices.Contains(s.GroupIDs, group.ID) {
+		return false
+	}
+	if len(s.Platforms) > 0 && !slices.Contains(s.Platforms, group.Platform) {
+		return false
+	}
+	return true
+}
+
+// grantedScope 签发后的实际 scope：收敛为用户选定的单个分组
+func (s *oauthScope) grantedScope(groupID int64) string {
+	granted := fmt.Sprintf("%s%d", oauthScopeGroupPrefix, groupID)
+	if s.Offline {
+		granted += " " + OAuthScopeOfflineAccess
+	}
+	return granted
+}
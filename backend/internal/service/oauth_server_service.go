@@ -0,0 +1,775 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+// ErrOAuthUserCodeCollision 用户码已被占用（由缓存实现返回，服务层重新生成）
+var ErrOAuthUserCodeCollision = errors.New("oauth user code collision")
+
+// oauthAPIKeyStore 签发与维护 Key 所需的 APIKeyService 能力
+type oauthAPIKeyStore interface {
+	Create(ctx context.Context, userID int64, req CreateAPIKeyRequest) (*APIKey, error)
+	GetByID(ctx context.Context, id int64) (*APIKey, error)
+	GetByKey(ctx context.Context, key string) (*APIKey, error)
+	Update(ctx context.Context, id int64, userID int64, req UpdateAPIKeyRequest) (*APIKey, error)
+	Delete(ctx context.Context, id int64, userID int64) error
+	GetAvailableGroups(ctx context.Context, userID int64) ([]Group, error)
+}
+
+type oauthFrontendURLProvider interface {
+	GetFrontendURL(ctx context.Context) string
+}
+
+// OAuthServerService 让 sub2api 充当 OAuth 2.0 授权服务器：
+// CLI 通过设备码（RFC 8628）或授权码 + PKCE（RFC 7636）发起请求，用户登录后在授权页选择分组，
+// 令牌端点签发绑定该分组的短期 API Key；申请 offline_access 时附带 refresh_token 用于续期。
+type OAuthServerService struct {
+	cfg       config.OAuthServerConfig
+	jwtCfg    config.JWTConfig
+	cache     OAuthServerCache
+	grantRepo OAuthGrantRepository
+	apiKeys   oauthAPIKeyStore
+	frontend  oauthFrontendURLProvider
+	now       func() time.Time
+}
+
+// NewOAuthServerService 创建 OAuth 授权服务器服务
+func NewOAuthServerService(
+	cfg *config.Config,
+	cache OAuthServerCache,
+	grantRepo OAuthGrantRepository,
+	apiKeyService *APIKeyService,
+	settingService *SettingService,
+) *OAuthServerService {
+	s := &OAuthServerService{
+		cache:     cache,
+		grantRepo: grantRepo,
+		apiKeys:   apiKeyService,
+		now:       time.Now,
+	}
+	if cfg != nil {
+		s.cfg = cfg.OAuthServer
+		s.jwtCfg = cfg.JWT
+	}
+	if settingService != nil {
+		s.frontend = settingService
+	}
+	return s
+}
+
+// Enabled 是否开放授权端点
+func (s *OAuthServerService) Enabled() bool {
+	return s != nil && s.cfg.Enabled
+}
+
+func (s *OAuthServerService) clients() []OAuthServerClient {
+	if len(s.cfg.Clients) == 0 {
+		return []OAuthServerClient{{
+			ClientID:     OAuthDefaultClientID,
+			Name:         "sub2api CLI",
+			RedirectURIs: []string{"http://127.0.0.1/callback", "http://localhost/callback"},
+		}}
+	}
+	out := make([]OAuthServerClient, 0, len(s.cfg.Clients))
+	for _, c := range s.cfg.Clients {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			name = strings.TrimSpace(c.ClientID)
+		}
+		out = append(out, OAuthServerClient{ClientID: strings.TrimSpace(c.ClientID), Name: name, RedirectURIs: c.RedirectURIs})
+	}
+	return out
+}
+
+func (s *OAuthServerService) lookupClient(clientID string) (*OAuthServerClient, error) {
+	clientID = strings.TrimSpace(clientID)
+	for _, c := range s.clients() {
+		if c.ClientID == clientID {
+			return &c, nil
+		}
+	}
+	return nil, ErrOAuthUnknownClient
+}
+
+func (s *OAuthServerService) keyTTL() time.Duration {
+	return time.Duration(s.cfg.KeyTTLMinutes) * time.Minute
+}
+
+func (s *OAuthServerService) refreshTTL() time.Duration {
+	days := s.cfg.RefreshTokenTTLDays
+	if days <= 0 {
+		days = s.jwtCfg.RefreshTokenExpireDays
+	}
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// baseURL 优先使用后台配置的前端地址，未配置时回退为请求来源
+func (s *OAuthServerService) baseURL(ctx context.Context, requestBase string) string {
+	if s.frontend != nil {
+		if u := strings.TrimSpace(s.frontend.GetFrontendURL(ctx)); u != "" {
+			return strings.TrimRight(u, "/")
+		}
+	}
+	return strings.TrimRight(requestBase, "/")
+}
+
+// Metadata RFC 8414 授权服务器元数据
+func (s *OAuthServerService) Metadata(ctx context.Context, requestBase string) map[string]any {
+	base := s.baseURL(ctx, requestBase)
+	api := strings.TrimRight(requestBase, "/") + "/api/v1/oauth"
+	return map[string]any{
+		"issuer":                                base,
+		"authorization_endpoint":                base + "/oauth/authorize",
+		"device_authorization_endpoint":         api + "/device_authorization",
+		"token_endpoint":                        api + "/token",
+		"revocation_endpoint":                   api + "/revoke",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{OAuthGrantTypeDeviceCode, OAuthGrantTypeAuthorizationCode, OAuthGrantTypeRefreshToken},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"none"},
+		"scopes_supported":                      append([]string{OAuthScopeOfflineAccess, oauthScopeGroupPrefix + "<id>"}, oauthPlatformScopes...),
+	}
+}
+
+// ─── 设备码 ───
+
+// StartDeviceAuthorization 设备授权端点：签发 device_code 与供用户输入的 user_code
+func (s *OAuthServerService) StartDeviceAuthorization(ctx context.Context, clientID, scope, requestBase string) (*OAuthDeviceAuthorizationResponse, error) {
+	if _, err := s.lookupClient(clientID); err != nil {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "unknown client_id")
+	}
+	if _, err := parseOAuthScope(scope); err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", err.Error())
+	}
+
+	deviceCode, err := randomHexString(32)
+	if err != nil {
+		return nil, fmt.Errorf("generate device code: %w", err)
+	}
+	ttl := time.Duration(s.cfg.DeviceCodeTTLSeconds) * time.Second
+	auth := &OAuthDeviceAuthorization{
+		DeviceCodeHash: oauthTokenHash(deviceCode),
+		ClientID:       strings.TrimSpace(clientID),
+		Scope:          strings.Join(strings.Fields(scope), " "),
+		Status:         oauthDeviceStatusPending,
+		ExpiresAt:      s.now().Add(ttl),
+	}
+
+	const maxAttempts = 5
+	for attempt := 0; ; attempt++ {
+		auth.UserCode, err = generateOAuthUserCode()
+		if err != nil {
+			return nil, fmt.Errorf("generate user code: %w", err)
+		}
+		err = s.cache.SaveDeviceAuthorization(ctx, auth, ttl)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrOAuthUserCodeCollision) || attempt+1 >= maxAttempts {
+			return nil, fmt.Errorf("save device authorization: %w", err)
+		}
+	}
+
+	verificationURI := s.baseURL(ctx, requestBase) + "/oauth/device"
+	return &OAuthDeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                auth.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(auth.UserCode),
+		ExpiresIn:               s.cfg.DeviceCodeTTLSeconds,
+		Interval:                s.cfg.PollIntervalSeconds,
+	}, nil
+}
+
+func (s *OAuthServerService) loadPendingDevice(ctx context.Context, userCode string) (*OAuthDeviceAuthorization, error) {
+	normalized, ok := normalizeOAuthUserCode(userCode)
+	if !ok {
+		return nil, ErrOAuthUserCodeNotFound
+	}
+	auth, err := s.cache.GetDeviceAuthorizationByUserCode(ctx, normalized)
+	if err != nil {
+		return nil, fmt.Errorf("get device authorization: %w", err)
+	}
+	if auth == nil || !s.now().Before(auth.ExpiresAt) {
+		return nil, ErrOAuthUserCodeNotFound
+	}
+	if auth.Status != oauthDeviceStatusPending {
+		return nil, ErrOAuthUserCodeUsed
+	}
+	return auth, nil
+}
+
+// GetDeviceConsent 授权页：根据用户码展示客户端与可选分组
+func (s *OAuthServerService) GetDeviceConsent(ctx context.Context, userID int64, userCode string) (*OAuthConsent, error) {
+	auth, err := s.loadPendingDevice(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+	consent, err := s.buildConsent(ctx, userID, auth.ClientID, auth.Scope)
+	if err != nil {
+		return nil, err
+	}
+	consent.UserCode = auth.UserCode
+	return consent, nil
+}
+
+// ApproveDevice 授权页提交：批准（绑定所选分组）或拒绝设备码请求
+func (s *OAuthServerService) ApproveDevice(ctx context.Context, userID int64, userCode string, groupID int64, approve bool) error {
+	auth, err := s.loadPendingDevice(ctx, userCode)
+	if err != nil {
+		return err
+	}
+	if !approve {
+		auth.Status = oauthDeviceStatusDenied
+		auth.UserID = userID
+		return s.cache.UpdateDeviceAuthorization(ctx, auth)
+	}
+	scope, err := parseOAuthScope(auth.Scope)
+	if err != nil {
+		return err
+	}
+	if _, err := s.selectGroup(ctx, userID, scope, groupID); err != nil {
+		return err
+	}
+	auth.Status = oauthDeviceStatusApproved
+	auth.UserID = userID
+	auth.GroupID = groupID
+	if err := s.cache.UpdateDeviceAuthorization(ctx, auth); err != nil {
+		return err
+	}
+	logger.LegacyPrintf("service.oauth_server", "[OAuthServer] device code approved: user=%d client=%s group=%d", userID, auth.ClientID, groupID)
+	return nil
+}
+
+// ─── 授权码 + PKCE ───
+
+func (s *OAuthServerService) validateAuthorizeRequest(req *OAuthAuthorizeRequest) (*OAuthServerClient, *oauthScope, error) {
+	client, err := s.lookupClient(req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !oauthRedirectURIAllowed(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, ErrOAuthInvalidRedirectURI
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) < 43 || len(req.CodeChallenge) > 128 {
+		return nil, nil, ErrOAuthPKCERequired
+	}
+	scope, err := parseOAuthScope(req.Scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, scope, nil
+}
+
+// GetAuthorizeConsent 授权页：校验授权码请求参数并展示可选分组
+func (s *OAuthServerService) GetAuthorizeConsent(ctx context.Context, userID int64, req *OAuthAuthorizeRequest) (*OAuthConsent, error) {
+	if _, _, err := s.validateAuthorizeRequest(req); err != nil {
+		return nil, err
+	}
+	return s.buildConsent(ctx, userID, req.ClientID, req.Scope)
+}
+
+// Authorize 授权页提交：返回携带 code（或 error=access_denied）与 state 的回调地址
+func (s *OAuthServerService) Authorize(ctx context.Context, userID int64, req *OAuthAuthorizeRequest) (string, error) {
+	client, scope, err := s.validateAuthorizeRequest(req)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	if !req.Approve {
+		params.Set("error", "access_denied")
+		return appendOAuthQuery(req.RedirectURI, params)
+	}
+	if _, err := s.selectGroup(ctx, userID, scope, req.GroupID); err != nil {
+		return "", err
+	}
+
+	code, err := randomHexString(32)
+	if err != nil {
+		return "", fmt.Errorf("generate authorization code: %w", err)
+	}
+	ttl := time.Duration(s.cfg.AuthCodeTTLSeconds) * time.Second
+	if err := s.cache.SaveAuthorizationCode(ctx, oauthTokenHash(code), &OAuthAuthorizationCode{
+		ClientID:      client.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(strings.Fields(req.Scope), " "),
+		CodeChallenge: req.CodeChallenge,
+		UserID:        userID,
+		GroupID:       req.GroupID,
+		ExpiresAt:     s.now().Add(ttl),
+	}, ttl); err != nil {
+		return "", fmt.Errorf("save authorization code: %w", err)
+	}
+	params.Set("code", code)
+	return appendOAuthQuery(req.RedirectURI, params)
+}
+
+func (s *OAuthServerService) buildConsent(ctx context.Context, userID int64, clientID, rawScope string) (*OAuthConsent, error) {
+	client, err := s.lookupClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := parseOAuthScope(rawScope)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.apiKeys.GetAvailableGroups(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list available groups: %w", err)
+	}
+	consent := &OAuthConsent{
+		ClientID:      client.ClientID,
+		ClientName:    client.Name,
+		Scope:         rawScope,
+		OfflineAccess: scope.Offline,
+		KeyTTLSeconds: int(s.keyTTL() / time.Second),
+		Groups:        []OAuthConsentGroup{},
+	}
+	for i := range groups {
+		g := &groups[i]
+		if !scope.allows(g) {
+			continue
+		}
+		consent.Groups = append(consent.Groups, OAuthConsentGroup{
+			ID:             g.ID,
+			Name:           g.Name,
+			Description:    g.Description,
+			Platform:       g.Platform,
+			RateMultiplier: g.RateMultiplier,
+		})
+	}
+	return consent, nil
+}
+
+// selectGroup 校验用户选择的分组既在 scope 范围内，也是用户当前可用的分组
+func (s *OAuthServerService) selectGroup(ctx context.Context, userID int64, scope *oauthScope, groupID int64) (*Group, error) {
+	if groupID <= 0 {
+		return nil, ErrOAuthGroupNotInScope
+	}
+	groups, err := s.apiKeys.GetAvailableGroups(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list available groups: %w", err)
+	}
+	for i := range groups {
+		if groups[i].ID == groupID {
+			if !scope.allows(&groups[i]) {
+				return nil, ErrOAuthGroupNotInScope
+			}
+			return &groups[i], nil
+		}
+	}
+	return nil, ErrGroupNotAllowed
+}
+
+// ─── 令牌端点 ───
+
+// Token 令牌端点，按 grant_type 分派；错误均为 *OAuthError
+func (s *OAuthServerService) Token(ctx context.Context, req *OAuthTokenRequest) (*OAuthTokenResponse, error) {
+	if _, err := s.lookupClient(req.ClientID); err != nil {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "unknown client_id")
+	}
+	switch req.GrantType {
+	case OAuthGrantTypeDeviceCode:
+		return s.exchangeDeviceCode(ctx, req)
+	case OAuthGrantTypeAuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, req)
+	case OAuthGrantTypeRefreshToken:
+		return s.refresh(ctx, req)
+	default:
+		return nil, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type is not supported")
+	}
+}
+
+func (s *OAuthServerService) exchangeDeviceCode(ctx context.Context, req *OAuthTokenRequest) (*OAuthTokenResponse, error) {
+	if req.DeviceCode == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "device_code is required")
+	}
+	hash := oauthTokenHash(req.DeviceCode)
+	auth, err := s.cache.GetDeviceAuthorization(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("get device authorization: %w", err)
+	}
+	now := s.now()
+	if auth == nil || !now.Before(auth.ExpiresAt) {
+		return nil, errOAuthExpiredToken
+	}
+	if auth.ClientID != strings.TrimSpace(req.ClientID) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "device_code was issued to another client")
+	}
+
+	last, err := s.cache.TouchDevicePoll(ctx, hash, now, auth.ExpiresAt.Sub(now))
+	if err != nil {
+		return nil, fmt.Errorf("record device poll: %w", err)
+	}
+	if !last.IsZero() && now.Sub(last) < time.Duration(s.cfg.PollIntervalSeconds)*time.Second {
+		return nil, errOAuthSlowDown
+	}
+
+	switch auth.Status {
+	case oauthDeviceStatusPending:
+		return nil, errOAuthAuthorizationPending
+	case oauthDeviceStatusDenied:
+		_, _ = s.cache.ConsumeDeviceAuthorization(ctx, hash)
+		return nil, errOAuthAccessDenied
+	}
+
+	consumed, err := s.cache.ConsumeDeviceAuthorization(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("consume device authorization: %w", err)
+	}
+	if consumed == nil || consumed.Status != oauthDeviceStatusApproved {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "device_code has already been used")
+	}
+	return s.issue(ctx, consumed.ClientID, consumed.UserID, consumed.GroupID, consumed.Scope)
+}
+
+func (s *OAuthServerService) exchangeAuthorizationCode(ctx context.Context, req *OAuthTokenRequest) (*OAuthTokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+	}
+	code, err := s.cache.ConsumeAuthorizationCode(ctx, oauthTokenHash(req.Code))
+	if err != nil {
+		return nil, fmt.Errorf("consume authorization code: %w", err)
+	}
+	if code == nil || !s.now().Before(code.ExpiresAt) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+	}
+	if code.ClientID != strings.TrimSpace(req.ClientID) || code.RedirectURI != req.RedirectURI {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "client_id or redirect_uri does not match the authorization request")
+	}
+	if !verifyPKCES256(req.CodeVerifier, code.CodeChallenge) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+	}
+	return s.issue(ctx, code.ClientID, code.UserID, code.GroupID, code.Scope)
+}
+
+// issue 为用户创建绑定分组的短期 API Key，并记录授权；offline_access 时同时签发 refresh_token
+func (s *OAuthServerService) issue(ctx context.Context, clientID string, userID, groupID int64, rawScope string) (*OAuthTokenResponse, error) {
+	client, err := s.lookupClient(clientID)
+	if err != nil {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "unknown client_id")
+	}
+	scope, err := parseOAuthScope(rawScope)
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", err.Error())
+	}
+
+	now := s.now()
+	expiresAt := now.Add(s.keyTTL())
+	key, err := s.apiKeys.Create(ctx, userID, CreateAPIKeyRequest{
+		Name:      truncateString(client.Name+" (OAuth)", 100),
+		GroupID:   &groupID,
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, ErrGroupNotAllowed) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "the approved group is no longer available to the user")
+		}
+		return nil, fmt.Errorf("create api key: %w", err)
+	}
+
+	grant := &OAuthGrant{
+		UserID:   userID,
+		APIKeyID: key.ID,
+		ClientID: client.ClientID,
+		GroupID:  groupID,
+		Scope:    scope.grantedScope(groupID),
+	}
+	var refreshToken string
+	if scope.Offline {
+		if refreshToken, err = generateOAuthRefreshToken(); err != nil {
+			_ = s.apiKeys.Delete(ctx, key.ID, userID)
+			return nil, err
+		}
+		refreshExpiresAt := now.Add(s.refreshTTL())
+		grant.RefreshTokenHash = oauthTokenHash(refreshToken)
+		grant.RefreshExpiresAt = &refreshExpiresAt
+	}
+	if err := s.grantRepo.Create(ctx, grant); err != nil {
+		_ = s.apiKeys.Delete(ctx, key.ID, userID)
+		return nil, fmt.Errorf("create oauth grant: %w", err)
+	}
+
+	logger.LegacyPrintf("service.oauth_server", "[OAuthServer] issued key: user=%d client=%s group=%d key_id=%d grant=%d offline=%v",
+		userID, client.ClientID, groupID, key.ID, grant.ID, scope.Offline)
+	return &OAuthTokenResponse{
+		AccessToken:  key.Key,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.keyTTL() / time.Second),
+		RefreshToken: refreshToken,
+		Scope:        grant.Scope,
+		GroupID:      groupID,
+	}, nil
+}
+
+// refresh 顺延 Key 有效期并轮换 refresh_token；Key 已在用户 Key 列表中删除或停用时授权随之失效
+func (s *OAuthServerService) refresh(ctx context.Context, req *OAuthTokenRequest) (*OAuthTokenResponse, error) {
+	invalid := func(desc string) error { return newOAuthError(http.StatusBadRequest, "invalid_grant", desc) }
+	if req.RefreshToken == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+	oldHash := oauthTokenHash(req.RefreshToken)
+	grant, err := s.grantRepo.GetByRefreshTokenHash(ctx, oldHash)
+	if errors.Is(err, ErrOAuthGrantNotFound) {
+		return nil, invalid("refresh_token is invalid")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get oauth grant: %w", err)
+	}
+	now := s.now()
+	if grant.RevokedAt != nil {
+		return nil, invalid("authorization has been revoked")
+	}
+	if grant.RefreshExpiresAt == nil || !now.Before(*grant.RefreshExpiresAt) {
+		return nil, invalid("refresh_token has expired")
+	}
+	if grant.ClientID != strings.TrimSpace(req.ClientID) {
+		return nil, invalid("refresh_token was issued to another client")
+	}
+
+	key, err := s.apiKeys.GetByID(ctx, grant.APIKeyID)
+	if err != nil || key.UserID != grant.UserID {
+		if err == nil || errors.Is(err, ErrAPIKeyNotFound) {
+			_ = s.grantRepo.Revoke(ctx, grant.ID)
+			return nil, invalid("the API key has been deleted")
+		}
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	if key.Status != StatusActive && key.Status != StatusAPIKeyExpired {
+		return nil, invalid("the API key is disabled")
+	}
+
+	newRefresh, err := generateOAuthRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.grantRepo.RotateRefreshToken(ctx, grant.ID, oldHash, oauthTokenHash(newRefresh), now.Add(s.refreshTTL()))
+	if err != nil {
+		return nil, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	if !rotated {
+		return nil, invalid("refresh_token has already been used")
+	}
+
+	expiresAt := now.Add(s.keyTTL())
+	if _, err := s.apiKeys.Update(ctx, key.ID, key.UserID, UpdateAPIKeyRequest{
+		ExpiresAt:   &expiresAt,
+		IPWhitelist: key.IPWhitelist,
+		IPBlacklist: key.IPBlacklist,
+	}); err != nil {
+		return nil, fmt.Errorf("extend api key: %w", err)
+	}
+
+	return &OAuthTokenResponse{
+		AccessToken:  key.Key,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.keyTTL() / time.Second),
+		RefreshToken: newRefresh,
+		Scope:        grant.Scope,
+		GroupID:      grant.GroupID,
+	}, nil
+}
+
+// Revoke RFC 7009：refresh_token 或 OAuth 签发的 Key 均可撤销；未知令牌按规范视为成功
+func (s *OAuthServerService) Revoke(ctx context.Context, clientID, token string) error {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return newOAuthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+	if _, err := s.lookupClient(clientID); err != nil {
+		return newOAuthError(http.StatusUnauthorized, "invalid_client", "unknown client_id")
+	}
+
+	var grant *OAuthGrant
+	var err error
+	if strings.HasPrefix(token, oauthRefreshTokenPrefix) {
+		grant, err = s.grantRepo.GetByRefreshTokenHash(ctx, oauthTokenHash(token))
+	} else {
+		var key *APIKey
+		key, err = s.apiKeys.GetByKey(ctx, token)
+		if err == nil {
+			grant, err = s.grantRepo.GetActiveByAPIKeyID(ctx, key.ID)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, ErrOAuthGrantNotFound) || errors.Is(err, ErrAPIKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("lookup token: %w", err)
+	}
+	if grant.ClientID != strings.TrimSpace(clientID) || grant.RevokedAt != nil {
+		return nil
+	}
+	return s.revokeGrant(ctx, grant)
+}
+
+func (s *OAuthServerService) revokeGrant(ctx context.Context, grant *OAuthGrant) error {
+	if err := s.grantRepo.Revoke(ctx, grant.ID); err != nil {
+		return fmt.Errorf("revoke oauth grant: %w", err)
+	}
+	if err := s.apiKeys.Delete(ctx, grant.APIKeyID, grant.UserID); err != nil && !errors.Is(err, ErrAPIKeyNotFound) {
+		return fmt.Errorf("delete api key: %w", err)
+	}
+	logger.LegacyPrintf("service.oauth_server", "[OAuthServer] grant revoked: grant=%d user=%d key_id=%d", grant.ID, grant.UserID, grant.APIKeyID)
+	return nil
+}
+
+// ─── 用户授权管理 ───
+
+// ListGrants 用户已授权的 CLI 客户端
+func (s *OAuthServerService) ListGrants(ctx context.Context, userID int64) ([]*OAuthGrant, error) {
+	grants, err := s.grantRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if grants == nil {
+		grants = []*OAuthGrant{}
+	}
+	for _, g := range grants {
+		g.ClientName = g.ClientID
+		if client, err := s.lookupClient(g.ClientID); err == nil {
+			g.ClientName = client.Name
+		}
+	}
+	return grants, nil
+}
+
+// RevokeGrant 用户撤销授权：作废 refresh_token 并删除签发的 Key
+func (s *OAuthServerService) RevokeGrant(ctx context.Context, userID, grantID int64) error {
+	grant, err := s.grantRepo.GetByID(ctx, grantID)
+	if err != nil {
+		return err
+	}
+	if grant.UserID != userID {
+		return ErrOAuthGrantNotFound
+	}
+	if grant.RevokedAt != nil {
+		return nil
+	}
+	return s.revokeGrant(ctx, grant)
+}
+
+// ─── helpers ───
+
+func oauthTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateOAuthRefreshToken() (string, error) {
+	raw, err := randomHexString(32)
+	if err != nil {
+		return "", fmt.Errorf("generate refresh token: %w", err)
+	}
+	return oauthRefreshTokenPrefix + raw, nil
+}
+
+// generateOAuthUserCode 生成 XXXX-XXXX 形式的用户码
+func generateOAuthUserCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(oauthUserCodeAlphabet)))
+	for i := 0; i < oauthUserCodeLength; i++ {
+		if i == oauthUserCodeLength/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(oauthUserCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeOAuthUserCode 容忍大小写、空格与分隔符差异
+func normalizeOAuthUserCode(input string) (string, bool) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		if strings.ContainsRune(oauthUserCodeAlphabet, r) {
+			b.WriteRune(r)
+		} else if r != '-' && r != ' ' {
+			return "", false
+		}
+	}
+	code := b.String()
+	if len(code) != oauthUserCodeLength {
+		return "", false
+	}
+	return code[:oauthUserCodeLength/2] + "-" + code[oauthUserCodeLength/2:], true
+}
+
+func verifyPKCES256(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// oauthRedirectURIAllowed 精确匹配；回环地址按 RFC 8252 §7.3 忽略端口
+func oauthRedirectURIAllowed(registered []string, redirectURI string) bool {
+	target, err := url.Parse(redirectURI)
+	if err != nil || target.Scheme == "" || target.Host == "" || target.Fragment != "" {
+		return false
+	}
+	for _, candidate := range registered {
+		if candidate == redirectURI {
+			return true
+		}
+		reg, err := url.Parse(candidate)
+		if err != nil || !isLoopbackHost(reg.Hostname()) {
+			continue
+		}
+		if reg.Scheme == target.Scheme && reg.Hostname() == target.Hostname() && reg.Path == target.Path {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func appendOAuthQuery(redirectURI string, params url.Values) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", ErrOAuthInvalidRedirectURI
+	}
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Set(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
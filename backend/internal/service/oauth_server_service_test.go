@@ -0,0 +1,469 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type oauthCacheStub struct {
+	mu      sync.Mutex
+	devices map[string]*OAuthDeviceAuthorization
+	codes   map[string]string
+	polls   map[string]time.Time
+	auth    map[string]*OAuthAuthorizationCode
+}
+
+func newOAuthCacheStub() *oauthCacheStub {
+	return &oauthCacheStub{
+		devices: map[string]*OAuthDeviceAuthorization{},
+		codes:   map[string]string{},
+		polls:   map[string]time.Time{},
+		auth:    map[string]*OAuthAuthorizationCode{},
+	}
+}
+
+func (c *oauthCacheStub) SaveDeviceAuthorization(_ context.Context, auth *OAuthDeviceAuthorization, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.codes[auth.UserCode]; ok {
+		return ErrOAuthUserCodeCollision
+	}
+	cp := *auth
+	c.devices[auth.DeviceCodeHash] = &cp
+	c.codes[auth.UserCode] = auth.DeviceCodeHash
+	return nil
+}
+
+func (c *oauthCacheStub) GetDeviceAuthorization(_ context.Context, hash string) (*OAuthDeviceAuthorization, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.devices[hash]; ok {
+		cp := *d
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (c *oauthCacheStub) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*OAuthDeviceAuthorization, error) {
+	c.mu.Lock()
+	hash, ok := c.codes[userCode]
+	c.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	return c.GetDeviceAuthorization(ctx, hash)
+}
+
+func (c *oauthCacheStub) UpdateDeviceAuthorization(_ context.Context, auth *OAuthDeviceAuthorization) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.devices[auth.DeviceCodeHash]; !ok {
+		return ErrOAuthUserCodeNotFound
+	}
+	cp := *auth
+	c.devices[auth.DeviceCodeHash] = &cp
+	return nil
+}
+
+func (c *oauthCacheStub) ConsumeDeviceAuthorization(_ context.Context, hash string) (*OAuthDeviceAuthorization, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.devices[hash]
+	if !ok {
+		return nil, nil
+	}
+	delete(c.devices, hash)
+	delete(c.codes, d.UserCode)
+	return d, nil
+}
+
+func (c *oauthCacheStub) TouchDevicePoll(_ context.Context, hash string, now time.Time, _ time.Duration) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev := c.polls[hash]
+	c.polls[hash] = now
+	return prev, nil
+}
+
+func (c *oauthCacheStub) SaveAuthorizationCode(_ context.Context, hash string, code *OAuthAuthorizationCode, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auth[hash] = code
+	return nil
+}
+
+func (c *oauthCacheStub) ConsumeAuthorizationCode(_ context.Context, hash string) (*OAuthAuthorizationCode, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	code := c.auth[hash]
+	delete(c.auth, hash)
+	return code, nil
+}
+
+type oauthGrantRepoStub struct {
+	mu     sync.Mutex
+	grants map[int64]*OAuthGrant
+	nextID int64
+}
+
+func newOAuthGrantRepoStub() *oauthGrantRepoStub {
+	return &oauthGrantRepoStub{grants: map[int64]*OAuthGrant{}}
+}
+
+func (r *oauthGrantRepoStub) Create(_ context.Context, g *OAuthGrant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	g.ID = r.nextID
+	cp := *g
+	r.grants[g.ID] = &cp
+	return nil
+}
+
+func (r *oauthGrantRepoStub) find(match func(*OAuthGrant) bool) (*OAuthGrant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range r.grants {
+		if match(g) {
+			cp := *g
+			return &cp, nil
+		}
+	}
+	return nil, ErrOAuthGrantNotFound
+}
+
+func (r *oauthGrantRepoStub) GetByID(_ context.Context, id int64) (*OAuthGrant, error) {
+	return r.find(func(g *OAuthGrant) bool { return g.ID == id })
+}
+
+func (r *oauthGrantRepoStub) GetByRefreshTokenHash(_ context.Context, hash string) (*OAuthGrant, error) {
+	return r.find(func(g *OAuthGrant) bool { return g.RefreshTokenHash != "" && g.RefreshTokenHash == hash })
+}
+
+func (r *oauthGrantRepoStub) GetActiveByAPIKeyID(_ context.Context, keyID int64) (*OAuthGrant, error) {
+	return r.find(func(g *OAuthGrant) bool { return g.APIKeyID == keyID && g.RevokedAt == nil })
+}
+
+func (r *oauthGrantRepoStub) ListByUser(_ context.Context, userID int64) ([]*OAuthGrant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*OAuthGrant
+	for _, g := range r.grants {
+		if g.UserID == userID {
+			cp := *g
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *oauthGrantRepoStub) RotateRefreshToken(_ context.Context, id int64, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.grants[id]
+	if !ok || g.RevokedAt != nil || g.RefreshTokenHash != oldHash {
+		return false, nil
+	}
+	g.RefreshTokenHash = newHash
+	g.RefreshExpiresAt = &expiresAt
+	return true, nil
+}
+
+func (r *oauthGrantRepoStub) Revoke(_ context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if g, ok := r.grants[id]; ok {
+		now := time.Now()
+		g.RevokedAt = &now
+		g.RefreshTokenHash = ""
+	}
+	return nil
+}
+
+type oauthAPIKeyStoreStub struct {
+	mu     sync.Mutex
+	keys   map[int64]*APIKey
+	groups []Group
+	nextID int64
+}
+
+func (s *oauthAPIKeyStoreStub) Create(_ context.Context, userID int64, req CreateAPIKeyRequest) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	key := &APIKey{ID: s.nextID, UserID: userID, Key: "sk-oauth-" + string(rune('a'+s.nextID)), Name: req.Name, GroupID: req.GroupID, Status: StatusActive, ExpiresAt: req.ExpiresAt}
+	s.keys[key.ID] = key
+	cp := *key
+	return &cp, nil
+}
+
+func (s *oauthAPIKeyStoreStub) GetByID(_ context.Context, id int64) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[id]; ok {
+		cp := *k
+		return &cp, nil
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (s *oauthAPIKeyStoreStub) GetByKey(_ context.Context, key string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keys {
+		if k.Key == key {
+			cp := *k
+			return &cp, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (s *oauthAPIKeyStoreStub) Update(_ context.Context, id, _ int64, req UpdateAPIKeyRequest) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	if req.ExpiresAt != nil {
+		k.ExpiresAt = req.ExpiresAt
+	}
+	cp := *k
+	return &cp, nil
+}
+
+func (s *oauthAPIKeyStoreStub) Delete(_ context.Context, id, _ int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *oauthAPIKeyStoreStub) GetAvailableGroups(context.Context, int64) ([]Group, error) {
+	return s.groups, nil
+}
+
+type oauthServerFixture struct {
+	svc    *OAuthServerService
+	cache  *oauthCacheStub
+	grants *oauthGrantRepoStub
+	keys   *oauthAPIKeyStoreStub
+	now    time.Time
+}
+
+func newOAuthServerFixture() *oauthServerFixture {
+	f := &oauthServerFixture{
+		cache:  newOAuthCacheStub(),
+		grants: newOAuthGrantRepoStub(),
+		keys: &oauthAPIKeyStoreStub{keys: map[int64]*APIKey{}, groups: []Group{
+			{ID: 1, Name: "claude", Platform: PlatformAnthropic},
+			{ID: 2, Name: "codex", Platform: PlatformOpenAI},
+		}},
+		now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	cfg := &config.Config{OAuthServer: config.OAuthServerConfig{
+		Enabled:              true,
+		DeviceCodeTTLSeconds: 600,
+		PollIntervalSeconds:  5,
+		AuthCodeTTLSeconds:   120,
+		KeyTTLMinutes:        60,
+		RefreshTokenTTLDays:  30,
+	}}
+	f.svc = NewOAuthServerService(cfg, f.cache, f.grants, nil, nil)
+	f.svc.apiKeys = f.keys
+	f.svc.now = func() time.Time { return f.now }
+	return f
+}
+
+func requireOAuthErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var oauthErr *OAuthError
+	require.True(t, errors.As(err, &oauthErr), "expected OAuthError, got %v", err)
+	require.Equal(t, code, oauthErr.Code)
+}
+
+func TestOAuthServer_DeviceFlowIssuesScopedKey(t *testing.T) {
+	f := newOAuthServerFixture()
+	ctx := context.Background()
+
+	start, err := f.svc.StartDeviceAuthorization(ctx, OAuthDefaultClientID, "anthropic offline_access", "https://api.example.com")
+	require.NoError(t, err)
+	require.Regexp(t, `^[A-Z]{4}-[A-Z]{4}$`, start.UserCode)
+	require.Equal(t, "https://api.example.com/oauth/device", start.VerificationURI)
+
+	tokenReq := &OAuthTokenRequest{GrantType: OAuthGrantTypeDeviceCode, ClientID: OAuthDefaultClientID, DeviceCode: start.DeviceCode}
+	_, err = f.svc.Token(ctx, tokenReq)
+	requireOAuthErrorCode(t, err, "authorization_pending")
+
+	f.now = f.now.Add(time.Second)
+	_, err = f.svc.Token(ctx, tokenReq)
+	requireOAuthErrorCode(t, err, "slow_down")
+
+	consent, err := f.svc.GetDeviceConsent(ctx, 7, strings.ToLower(strings.ReplaceAll(start.UserCode, "-", "")))
+	require.NoError(t, err)
+	require.Len(t, consent.Groups, 1, "platform scope filters groups")
+	require.Equal(t, int64(1), consent.Groups[0].ID)
+
+	require.ErrorIs(t, f.svc.ApproveDevice(ctx, 7, start.UserCode, 2, true), ErrOAuthGroupNotInScope)
+	require.NoError(t, f.svc.ApproveDevice(ctx, 7, start.UserCode, 1, true))
+
+	f.now = f.now.Add(6 * time.Second)
+	resp, err := f.svc.Token(ctx, tokenReq)
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.AccessToken)
+	require.True(t, strings.HasPrefix(resp.RefreshToken, oauthRefreshTokenPrefix))
+	require.Equal(t, "group:1 offline_access", resp.Scope)
+	require.Equal(t, 3600, resp.ExpiresIn)
+
+	key, err := f.keys.GetByKey(ctx, resp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), key.UserID)
+	require.Equal(t, int64(1), *key.GroupID)
+	require.Equal(t, f.now.Add(time.Hour), *key.ExpiresAt)
+
+	f.now = f.now.Add(6 * time.Second)
+	_, err = f.svc.Token(ctx, tokenReq)
+	requireOAuthErrorCode(t, err, "expired_token")
+}
+
+func TestOAuthServer_DeviceFlowDenied(t *testing.T) {
+	f := newOAuthServerFixture()
+	ctx := context.Background()
+
+	start, err := f.svc.StartDeviceAuthorization(ctx, OAuthDefaultClientID, "", "http://localhost")
+	require.NoError(t, err)
+	require.NoError(t, f.svc.ApproveDevice(ctx, 7, start.UserCode, 0, false))
+	require.ErrorIs(t, f.svc.ApproveDevice(ctx, 7, start.UserCode, 1, true), ErrOAuthUserCodeUsed)
+
+	_, err = f.svc.Token(ctx, &OAuthTokenRequest{GrantType: OAuthGrantTypeDeviceCode, ClientID: OAuthDefaultClientID, DeviceCode: start.DeviceCode})
+	requireOAuthErrorCode(t, err, "access_denied")
+	require.Empty(t, f.keys.keys)
+}
+
+func TestOAuthServer_AuthorizationCodeWithPKCE(t *testing.T) {
+	f := newOAuthServerFixture()
+	ctx := context.Background()
+
+	verifier := strings.Repeat("v", 64)
+	sum := sha256.Sum256([]byte(verifier))
+	req := &OAuthAuthorizeRequest{
+		ClientID:            OAuthDefaultClientID,
+		RedirectURI:         "http://127.0.0.1:53682/callback",
+		Scope:               "group:2",
+		State:               "xyz",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+		GroupID:             2,
+		Approve:             true,
+	}
+
+	_, err := f.svc.Authorize(ctx, 7, &OAuthAuthorizeRequest{ClientID: req.ClientID, RedirectURI: "https://evil.example.com/callback", CodeChallenge: req.CodeChallenge, CodeChallengeMethod: "S256"})
+	require.ErrorIs(t, err, ErrOAuthInvalidRedirectURI)
+
+	redirect, err := f.svc.Authorize(ctx, 7, req)
+	require.NoError(t, err)
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+	require.Equal(t, "xyz", u.Query().Get("state"))
+	code := u.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	tokenReq := &OAuthTokenRequest{GrantType: OAuthGrantTypeAuthorizationCode, ClientID: OAuthDefaultClientID, Code: code, RedirectURI: req.RedirectURI, CodeVerifier: strings.Repeat("w", 64)}
+	_, err = f.svc.Token(ctx, tokenReq)
+	requireOAuthErrorCode(t, err, "invalid_grant")
+
+	// 授权码一次性：校验失败后同样作废
+	tokenReq.CodeVerifier = verifier
+	_, err = f.svc.Token(ctx, tokenReq)
+	requireOAuthErrorCode(t, err, "invalid_grant")
+
+	redirect, err = f.svc.Authorize(ctx, 7, req)
+	require.NoError(t, err)
+	u, _ = url.Parse(redirect)
+	tokenReq.Code = u.Query().Get("code")
+	resp, err := f.svc.Token(ctx, tokenReq)
+	require.NoError(t, err)
+	require.Equal(t, "group:2", resp.Scope)
+	require.Empty(t, resp.RefreshToken, "no offline_access, no refresh token")
+}
+
+func TestOAuthServer_RefreshRotatesAndRevokesDeletedKey(t *testing.T) {
+	f := newOAuthServerFixture()
+	ctx := context.Background()
+
+	resp, err := f.svc.issue(ctx, OAuthDefaultClientID, 7, 1, "offline_access")
+	require.NoError(t, err)
+
+	f.now = f.now.Add(50 * time.Minute)
+	refreshed, err := f.svc.Token(ctx, &OAuthTokenRequest{GrantType: OAuthGrantTypeRefreshToken, ClientID: OAuthDefaultClientID, RefreshToken: resp.RefreshToken})
+	require.NoError(t, err)
+	require.Equal(t, resp.AccessToken, refreshed.AccessToken)
+	require.NotEqual(t, resp.RefreshToken, refreshed.RefreshToken)
+	key, _ := f.keys.GetByKey(ctx, refreshed.AccessToken)
+	require.Equal(t, f.now.Add(time.Hour), *key.ExpiresAt)
+
+	_, err = f.svc.Token(ctx, &OAuthTokenRequest{GrantType: OAuthGrantTypeRefreshToken, ClientID: OAuthDefaultClientID, RefreshToken: resp.RefreshToken})
+	requireOAuthErrorCode(t, err, "invalid_grant")
+
+	// 用户在 Key 列表中删除 Key 后，refresh_token 随之失效
+	require.NoError(t, f.keys.Delete(ctx, key.ID, 7))
+	_, err = f.svc.Token(ctx, &OAuthTokenRequest{GrantType: OAuthGrantTypeRefreshToken, ClientID: OAuthDefaultClientID, RefreshToken: refreshed.RefreshToken})
+	requireOAuthErrorCode(t, err, "invalid_grant")
+	grants, err := f.svc.ListGrants(ctx, 7)
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.NotNil(t, grants[0].RevokedAt)
+}
+
+func TestOAuthServer_RevokeByAccessToken(t *testing.T) {
+	f := newOAuthServerFixture()
+	ctx := context.Background()
+
+	resp, err := f.svc.issue(ctx, OAuthDefaultClientID, 7, 1, "offline_access")
+	require.NoError(t, err)
+
+	requireOAuthErrorCode(t, f.svc.Revoke(ctx, "other-client", resp.AccessToken), "invalid_client")
+	require.Len(t, f.keys.keys, 1)
+	require.NoError(t, f.svc.Revoke(ctx, OAuthDefaultClientID, "sk-unknown"))
+	require.NoError(t, f.svc.Revoke(ctx, OAuthDefaultClientID, resp.AccessToken))
+	require.Empty(t, f.keys.keys)
+
+	_, err = f.svc.Token(ctx, &OAuthTokenRequest{GrantType: OAuthGrantTypeRefreshToken, ClientID: OAuthDefaultClientID, RefreshToken: resp.RefreshToken})
+	requireOAuthErrorCode(t, err, "invalid_grant")
+}
+
+func TestParseOAuthScope(t *testing.T) {
+	scope, err := parseOAuthScope("group:3 openai offline_access group:3")
+	require.NoError(t, err)
+	require.Equal(t, []int64{3}, scope.GroupIDs)
+	require.Equal(t, []string{PlatformOpenAI}, scope.Platforms)
+	require.True(t, scope.Offline)
+	require.True(t, scope.allows(&Group{ID: 3, Platform: PlatformOpenAI}))
+	require.False(t, scope.allows(&Group{ID: 3, Platform: PlatformAnthropic}))
+	require.False(t, scope.allows(&Group{ID: 4, Platform: PlatformOpenAI}))
+
+	_, err = parseOAuthScope("admin")
+	require.ErrorIs(t, err, ErrOAuthInvalidScope)
+	_, err = parseOAuthScope("group:abc")
+	require.ErrorIs(t, err, ErrOAuthInvalidScope)
+}
+
+func TestOAuthRedirectURIAllowed(t *testing.T) {
+	registered := []string{"http://127.0.0.1/callback", "https://app.example.com/cb"}
+	require.True(t, oauthRedirectURIAllowed(registered, "http://127.0.0.1:9999/callback"))
+	require.True(t, oauthRedirectURIAllowed(registered, "https://app.example.com/cb"))
+	require.False(t, oauthRedirectURIAllowed(registered, "https://app.example.com:8443/cb"))
+	require.False(t, oauthRedirectURIAllowed(registered, "http://127.0.0.1:9999/other"))
+	require.False(t, oauthRedirectURIAllowed(registered, "http://127.0.0.1.evil.com/callback"))
+}
@@ -370,6 +370,7 @@ type openAIAccountCandidateScore struct {
 	errorRate float64
 	ttft      float64
 	hasTTFT   bool
+	quota     QuotaForecast
 }
 
 type openAIAccountCandidateHeap []openAIAccountCandidateScore
@@ -629,6 +630,9 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 	loadRateSumSquares := 0.0
 	minTTFT, maxTTFT := 0.0, 0.0
 	hasTTFTSample := false
+	var minResetBucket, maxResetBucket int64
+	hasResetSample := false
+	now := time.Now()
 	candidates := make([]openAIAccountCandidateScore, 0, len(filtered))
 	for _, account := range filtered {
 		loadInfo := loadMap[account.ID]
@@ -658,6 +662,20 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 				}
 			}
 		}
+		quota := s.service.quotaForecastService.Forecast(account, req.RequestedModel, now)
+		if bucket, ok := quota.resetBucket(); ok {
+			if !hasResetSample {
+				minResetBucket, maxResetBucket = bucket, bucket
+				hasResetSample = true
+			} else {
+				if bucket < minResetBucket {
+					minResetBucket = bucket
+				}
+				if bucket > maxResetBucket {
+					maxResetBucket = bucket
+				}
+			}
+		}
 		loadRate := float64(loadInfo.LoadRate)
 		loadRateSum += loadRate
 		loadRateSumSquares += loadRate * loadRate
@@ -667,6 +685,7 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 			errorRate: errorRate,
 			ttft:      ttft,
 			hasTTFT:   hasTTFT,
+			quota:     quota,
 		})
 	}
 	loadSkew := calcLoadSkewByMoments(loadRateSum, loadRateSumSquares, len(candidates))
@@ -685,12 +704,20 @@ func (s *defaultOpenAIAccountScheduler) selectByLoadBalance(
 		if item.hasTTFT && hasTTFTSample && maxTTFT > minTTFT {
 			ttftFactor = 1 - clamp01((item.ttft-minTTFT)/(maxTTFT-minTTFT))
 		}
+		// 额度因子：以预测的额度余量为主，窗口越早重置越优先（先用掉即将过期的额度）；
+		// 无额度窗口的账号（API Key 等）视为满分，避免被饿死。
+		resetFactor := 1.0
+		if bucket, ok := item.quota.resetBucket(); ok && maxResetBucket > minResetBucket {
+			resetFactor = 1 - clamp01(float64(bucket-minResetBucket)/float64(maxResetBucket-minResetBucket))
+		}
+		quotaFactor := 0.8*(1-clamp01(item.quota.Pressure)) + 0.2*resetFactor
 
 		item.score = weights.Priority*priorityFactor +
 			weights.Load*loadFactor +
 			weights.Queue*queueFactor +
 			weights.ErrorRate*errorFactor +
-			weights.TTFT*ttftFactor
+			weights.TTFT*ttftFactor +
+			weights.Quota*quotaFactor
 	}
 
 	topK := s.service.openAIWSLBTopK()
@@ -755,6 +782,9 @@ func (s *defaultOpenAIAccountScheduler) isAccountTransportCompatible(account *Ac
 	if requiredTransport == OpenAIUpstreamTransportAny || requiredTransport == OpenAIUpstreamTransportHTTPSSE {
 		return true
 	}
+	if requiredTransport == OpenAIUpstreamTransportRealtime {
+		return account != nil && account.IsOpenAI() && account.Type == AccountTypeAPIKey
+	}
 	if s == nil || s.service == nil || account == nil {
 		return false
 	}
@@ -901,6 +931,7 @@ func (s *OpenAIGatewayService) openAIWSSchedulerWeights() GatewayOpenAIWSSchedul
 			Queue:     s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Queue,
 			ErrorRate: s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.ErrorRate,
 			TTFT:      s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.TTFT,
+			Quota:     s.cfg.Gateway.OpenAIWS.SchedulerScoreWeights.Quota,
 		}
 	}
 	return GatewayOpenAIWSSchedulerScoreWeightsView{
@@ -909,6 +940,7 @@ func (s *OpenAIGatewayService) openAIWSSchedulerWeights() GatewayOpenAIWSSchedul
 		Queue:     0.7,
 		ErrorRate: 0.8,
 		TTFT:      0.5,
+		Quota:     1.0,
 	}
 }
 
@@ -918,6 +950,7 @@ type GatewayOpenAIWSSchedulerScoreWeightsView struct {
 	Queue     float64
 	ErrorRate float64
 	TTFT      float64
+	Quota     float64
 }
 
 func clamp01(value float64) float64 {
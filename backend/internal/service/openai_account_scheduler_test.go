@@ -961,6 +961,12 @@ func TestDefaultOpenAIAccountScheduler_IsAccountTransportCompatible_Branches(t *
 		},
 	}
 	require.True(t, scheduler.isAccountTransportCompatible(account, OpenAIUpstreamTransportResponsesWebsocketV2))
+
+	// Realtime 仅允许 OpenAI API Key 账号
+	require.False(t, scheduler.isAccountTransportCompatible(nil, OpenAIUpstreamTransportRealtime))
+	require.True(t, scheduler.isAccountTransportCompatible(account, OpenAIUpstreamTransportRealtime))
+	oauthAccount := &Account{ID: 8802, Platform: PlatformOpenAI, Type: AccountTypeOAuth}
+	require.False(t, scheduler.isAccountTransportCompatible(oauthAccount, OpenAIUpstreamTransportRealtime))
 }
 
 func int64PtrForTest(v int64) *int64 {
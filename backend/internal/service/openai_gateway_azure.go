@@ -0,0 +1,343 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/azureopenai"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/util/responseheaders"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"go.uber.org/zap"
+)
+
+// buildAzureResponsesURL 组装 Azure OpenAI Responses 端点：
+// {endpoint}/openai/responses[/suffix]?api-version=...（v1 API 为 /openai/v1/responses，无查询参数）
+func (s *OpenAIGatewayService) buildAzureResponsesURL(account *Account, c *gin.Context) (string, error) {
+	endpoint := account.GetAzureEndpoint()
+	if endpoint == "" {
+		return "", errors.New("azure_endpoint not found in credentials")
+	}
+	validatedURL, err := s.validateUpstreamBaseURL(endpoint)
+	if err != nil {
+		return "", err
+	}
+	apiVersion := account.GetAzureAPIVersion()
+	targetURL := azureopenai.ResponsesURL(validatedURL, apiVersion)
+	targetURL = appendOpenAIResponsesRequestPathSuffix(targetURL, openAIResponsesRequestPathSuffix(c))
+	return azureopenai.WithAPIVersion(targetURL, apiVersion), nil
+}
+
+// buildAzureChatCompletionsURL 组装 Azure OpenAI Chat Completions 端点（旧版 api-version 在路径中携带部署名）。
+func (s *OpenAIGatewayService) buildAzureChatCompletionsURL(account *Account, deployment string) (string, error) {
+	endpoint := account.GetAzureEndpoint()
+	if endpoint == "" {
+		return "", errors.New("azure_endpoint not found in credentials")
+	}
+	validatedURL, err := s.validateUpstreamBaseURL(endpoint)
+	if err != nil {
+		return "", err
+	}
+	apiVersion := account.GetAzureAPIVersion()
+	return azureopenai.WithAPIVersion(azureopenai.ChatCompletionsURL(validatedURL, deployment, apiVersion), apiVersion), nil
+}
+
+// rewriteAzureDeploymentModel 将请求体 model 改写为 Azure 部署名。
+func rewriteAzureDeploymentModel(account *Account, body []byte) []byte {
+	model := gjson.GetBytes(body, "model").String()
+	if model == "" {
+		return body
+	}
+	deployment := account.ResolveAzureDeployment(model)
+	if deployment == model {
+		return body
+	}
+	if rewritten, err := sjson.SetBytes(body, "model", deployment); err == nil {
+		return rewritten
+	}
+	return body
+}
+
+// setOpenAIUpstreamAuthHeader 注入上游认证头：Azure api-key 模式使用 api-key 头，其余使用 Bearer。
+func setOpenAIUpstreamAuthHeader(req *http.Request, account *Account, token string) {
+	if account.IsAzureOpenAI() && !account.IsAzureEntraAuth() {
+		req.Header.Del("authorization")
+		req.Header.Set("api-key", token)
+		return
+	}
+	req.Header.Del("api-key")
+	req.Header.Set("authorization", "Bearer "+token)
+}
+
+// normalizeAzureContentFilterError 将 Azure 内容过滤错误改写为 OpenAI 风格错误体，
+// message 附带触发的过滤类别，code 固定为 content_filter，便于错误透传规则按关键词匹配。
+// 非 Azure 账号或非内容过滤错误原样返回。
+func normalizeAzureContentFilterError(account *Account, body []byte) ([]byte, bool) {
+	if account == nil || !account.IsAzureOpenAI() {
+		return body, false
+	}
+	cf, ok := azureopenai.ParseContentFilterError(body)
+	if !ok {
+		return body, false
+	}
+	normalized, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"type":       "invalid_request_error",
+			"code":       azureopenai.ContentFilterCode,
+			"message":    cf.Error(),
+			"categories": cf.Categories,
+		},
+	})
+	if err != nil {
+		return body, true
+	}
+	return normalized, true
+}
+
+// forwardAzureChatCompletions 将 Chat Completions 请求原样转发到 Azure 部署的 /chat/completions
+// （账号 azure_upstream_api = chat_completions 时使用，适用于未开放 Responses API 的部署）。
+func (s *OpenAIGatewayService) forwardAzureChatCompletions(
+	ctx context.Context,
+	c *gin.Context,
+	account *Account,
+	body []byte,
+	originalModel string,
+	billingModel string,
+	upstreamModel string,
+	clientStream bool,
+	includeUsage bool,
+	startTime time.Time,
+) (*OpenAIForwardResult, error) {
+	deployment := account.ResolveAzureDeployment(upstreamModel)
+	upstreamBody, err := sjson.SetBytes(body, "model", deployment)
+	if err != nil {
+		return nil, fmt.Errorf("rewrite model for azure chat completions: %w", err)
+	}
+	if clientStream {
+		// 流式请求强制 include_usage，否则无法计费；客户端未要求时过滤掉末尾的 usage chunk
+		upstreamBody, err = sjson.SetBytes(upstreamBody, "stream_options.include_usage", true)
+		if err != nil {
+			return nil, fmt.Errorf("set stream_options for azure chat completions: %w", err)
+		}
+	}
+
+	token, _, err := s.GetAccessToken(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("get access token: %w", err)
+	}
+	targetURL, err := s.buildAzureChatCompletionsURL(account, deployment)
+	if err != nil {
+		return nil, fmt.Errorf("build upstream request: %w", err)
+	}
+	upstreamReq, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(upstreamBody))
+	if err != nil {
+		return nil, fmt.Errorf("build upstream request: %w", err)
+	}
+	setOpenAIUpstreamAuthHeader(upstreamReq, account, token)
+	upstreamReq.Header.Set("content-type", "application/json")
+	if customUA := account.GetOpenAIUserAgent(); customUA != "" {
+		upstreamReq.Header.Set("user-agent", customUA)
+	}
+
+	logger.L().Debug("openai chat_completions: azure native upstream",
+		zap.Int64("account_id", account.ID),
+		zap.String("original_model", originalModel),
+		zap.String("upstream_model", upstreamModel),
+		zap.String("deployment", deployment),
+		zap.Bool("stream", clientStream),
+	)
+
+	proxyURL := ""
+	if account.Proxy != nil {
+		proxyURL = account.Proxy.URL()
+	}
+	resp, err := s.httpUpstream.Do(upstreamReq, proxyURL, account.ID, account.Concurrency)
+	if err != nil {
+		safeErr := sanitizeUpstreamErrorMessage(err.Error())
+		setOpsUpstreamError(c, 0, safeErr, "")
+		appendOpsUpstreamError(c, OpsUpstreamErrorEvent{
+			Platform:           account.Platform,
+			AccountID:          account.ID,
+			AccountName:        account.Name,
+			UpstreamStatusCode: 0,
+			Kind:               "request_error",
+			Message:            safeErr,
+		})
+		writeChatCompletionsError(c, http.StatusBadGateway, "upstream_error", "Upstream request failed")
+		return nil, fmt.Errorf("upstream request failed: %s", safeErr)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+		upstreamMsg := sanitizeUpstreamErrorMessage(strings.TrimSpace(extractUpstreamErrorMessage(respBody)))
+		if s.shouldFailoverOpenAIUpstreamResponse(resp.StatusCode, upstreamMsg, respBody) {
+			appendOpsUpstreamError(c, OpsUpstreamErrorEvent{
+				Platform:           account.Platform,
+				AccountID:          account.ID,
+				AccountName:        account.Name,
+				UpstreamStatusCode: resp.StatusCode,
+				UpstreamRequestID:  resp.Header.Get("x-request-id"),
+				Kind:               "failover",
+				Message:            upstreamMsg,
+			})
+			if s.rateLimitService != nil {
+				s.rateLimitService.HandleUpstreamError(ctx, account, resp.StatusCode, resp.Header, respBody)
+			}
+			return nil, &UpstreamFailoverError{
+				StatusCode:             resp.StatusCode,
+				ResponseBody:           respBody,
+				RetryableOnSameAccount: account.IsPoolMode() && isPoolModeRetryableStatus(resp.StatusCode),
+			}
+		}
+		return s.handleChatCompletionsErrorResponse(resp, c, account)
+	}
+
+	if clientStream {
+		return s.handleAzureChatStreamingResponse(resp, c, originalModel, billingModel, upstreamModel, includeUsage, startTime)
+	}
+	return s.handleAzureChatNonStreamingResponse(resp, c, originalModel, billingModel, upstreamModel, startTime)
+}
+
+// parseChatCompletionsUsage 解析 Chat Completions usage（prompt_tokens/completion_tokens/cached_tokens）。
+func parseChatCompletionsUsage(usage gjson.Result) OpenAIUsage {
+	return OpenAIUsage{
+		InputTokens:          int(usage.Get("prompt_tokens").Int()),
+		OutputTokens:         int(usage.Get("completion_tokens").Int()),
+		CacheReadInputTokens: int(usage.Get("prompt_tokens_details.cached_tokens").Int()),
+	}
+}
+
+func (s *OpenAIGatewayService) handleAzureChatNonStreamingResponse(
+	resp *http.Response,
+	c *gin.Context,
+	originalModel string,
+	billingModel string,
+	upstreamModel string,
+	startTime time.Time,
+) (*OpenAIForwardResult, error) {
+	requestID := resp.Header.Get("x-request-id")
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		writeChatCompletionsError(c, http.StatusBadGateway, "api_error", "Failed to read upstream response")
+		return nil, fmt.Errorf("read azure chat completions response: %w", err)
+	}
+	usage := parseChatCompletionsUsage(gjson.GetBytes(respBody, "usage"))
+	if rewritten, err := sjson.SetBytes(respBody, "model", originalModel); err == nil {
+		respBody = rewritten
+	}
+
+	if s.responseHeaderFilter != nil {
+		responseheaders.WriteFilteredHeaders(c.Writer.Header(), resp.Header, s.responseHeaderFilter)
+	}
+	c.Data(http.StatusOK, "application/json", respBody)
+
+	return &OpenAIForwardResult{
+		RequestID:     requestID,
+		Usage:         usage,
+		Model:         originalModel,
+		BillingModel:  billingModel,
+		UpstreamModel: upstreamModel,
+		Stream:        false,
+		Duration:      time.Since(startTime),
+	}, nil
+}
+
+func (s *OpenAIGatewayService) handleAzureChatStreamingResponse(
+	resp *http.Response,
+	c *gin.Context,
+	originalModel string,
+	billingModel string,
+	upstreamModel string,
+	includeUsage bool,
+	startTime time.Time,
+) (*OpenAIForwardResult, error) {
+	requestID := resp.Header.Get("x-request-id")
+
+	if s.responseHeaderFilter != nil {
+		responseheaders.WriteFilteredHeaders(c.Writer.Header(), resp.Header, s.responseHeaderFilter)
+	}
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	var usage OpenAIUsage
+	var firstTokenMs *int
+
+	scanner := bufio.NewScanner(resp.Body)
+	maxLineSize := defaultMaxLineSize
+	if s.cfg != nil && s.cfg.Gateway.MaxLineSize > 0 {
+		maxLineSize = s.cfg.Gateway.MaxLineSize
+	}
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		payload := line[6:]
+		if payload != "[DONE]" {
+			if firstTokenMs == nil {
+				ms := int(time.Since(startTime).Milliseconds())
+				firstTokenMs = &ms
+			}
+			if u := gjson.Get(payload, "usage"); u.Exists() && u.Type != gjson.Null {
+				usage = parseChatCompletionsUsage(u)
+				// 末尾 usage chunk（choices 为空）仅在客户端请求 include_usage 时下发
+				if !includeUsage && len(gjson.Get(payload, "choices").Array()) == 0 {
+					continue
+				}
+				if !includeUsage {
+					if stripped, err := sjson.Delete(payload, "usage"); err == nil {
+						payload = stripped
+					}
+				}
+			}
+			if gjson.Get(payload, "model").String() != "" {
+				if rewritten, err := sjson.Set(payload, "model", originalModel); err == nil {
+					payload = rewritten
+				}
+			}
+		}
+		if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", payload); err != nil {
+			logger.L().Info("openai chat_completions stream: client disconnected",
+				zap.String("request_id", requestID),
+			)
+			break
+		}
+		c.Writer.Flush()
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		logger.L().Warn("openai chat_completions stream: read error",
+			zap.Error(err),
+			zap.String("request_id", requestID),
+		)
+	}
+
+	return &OpenAIForwardResult{
+		RequestID:     requestID,
+		Usage:         usage,
+		Model:         originalModel,
+		BillingModel:  billingModel,
+		UpstreamModel: upstreamModel,
+		Stream:        true,
+		Duration:      time.Since(startTime),
+		FirstTokenMs:  firstTokenMs,
+	}, nil
+}
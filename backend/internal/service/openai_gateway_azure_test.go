@@ -0,0 +1,181 @@
+//go:build unit
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newAzureOpenAITestAccount(credentials map[string]any) *Account {
+	creds := map[string]any{
+		"azure_endpoint": "https://res.openai.azure.com",
+		"api_key":        "azure-key",
+		"deployment_mapping": map[string]any{
+			"gpt-5":   "prod-gpt5",
+			"gpt-4o*": "prod-4o",
+		},
+	}
+	for k, v := range credentials {
+		creds[k] = v
+	}
+	return &Account{
+		ID:          31,
+		Name:        "azure-test",
+		Platform:    PlatformOpenAI,
+		Type:        AccountTypeAzure,
+		Concurrency: 1,
+		Credentials: creds,
+		Status:      StatusActive,
+		Schedulable: true,
+	}
+}
+
+func newAzureOpenAITestService(upstream HTTPUpstream) *OpenAIGatewayService {
+	cfg := &config.Config{
+		Security: config.SecurityConfig{
+			URLAllowlist: config.URLAllowlistConfig{Enabled: false},
+		},
+	}
+	return &OpenAIGatewayService{cfg: cfg, httpUpstream: upstream}
+}
+
+func TestAccount_ResolveAzureDeployment(t *testing.T) {
+	account := newAzureOpenAITestAccount(nil)
+
+	require.Equal(t, "prod-gpt5", account.ResolveAzureDeployment("gpt-5"))
+	require.Equal(t, "prod-4o", account.ResolveAzureDeployment("gpt-4o-mini"))
+	require.Equal(t, "o3", account.ResolveAzureDeployment("o3"))
+	require.Equal(t, "2025-04-01-preview", account.GetAzureAPIVersion())
+	require.False(t, account.IsAzureEntraAuth())
+	require.False(t, account.UsesAzureChatCompletionsAPI())
+}
+
+func TestOpenAIBuildUpstreamRequest_Azure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	c.Request.Header.Set("api-key", "client-supplied")
+
+	svc := newAzureOpenAITestService(nil)
+	account := newAzureOpenAITestAccount(map[string]any{"api_version": "2025-04-01-preview"})
+
+	req, err := svc.buildUpstreamRequest(c.Request.Context(), c, account, []byte(`{"model":"gpt-5","input":"hi"}`), "azure-key", true, "", false)
+	require.NoError(t, err)
+	require.Equal(t, "https://res.openai.azure.com/openai/responses?api-version=2025-04-01-preview", req.URL.String())
+	require.Equal(t, "azure-key", req.Header.Get("api-key"))
+	require.Empty(t, req.Header.Get("authorization"))
+
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, "prod-gpt5", gjson.GetBytes(body, "model").String())
+}
+
+func TestOpenAIBuildUpstreamRequest_AzureEntraV1(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses/compact", nil)
+
+	svc := newAzureOpenAITestService(nil)
+	account := newAzureOpenAITestAccount(map[string]any{"api_version": "v1", "auth_mode": "entra"})
+
+	req, err := svc.buildUpstreamRequestOpenAIPassthrough(c.Request.Context(), c, account, []byte(`{"model":"o3"}`), "entra-token")
+	require.NoError(t, err)
+	require.Equal(t, "https://res.openai.azure.com/openai/v1/responses/compact", req.URL.String())
+	require.Equal(t, "Bearer entra-token", req.Header.Get("authorization"))
+	require.Empty(t, req.Header.Get("api-key"))
+}
+
+func TestOpenAIHandleErrorResponse_AzureContentFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+
+	svc := &OpenAIGatewayService{}
+	respBody := []byte(`{"error":{"message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy.","code":"content_filter","status":400,"innererror":{"code":"ResponsibleAIPolicyViolation","content_filter_result":{"violence":{"filtered":true,"severity":"medium"}}}}}`)
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Body:       io.NopCloser(bytes.NewReader(respBody)),
+		Header:     http.Header{},
+	}
+
+	_, err := svc.handleErrorResponse(context.Background(), resp, c, newAzureOpenAITestAccount(nil), nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "invalid_request_error", gjson.Get(rec.Body.String(), "error.type").String())
+	require.Contains(t, gjson.Get(rec.Body.String(), "error.message").String(), "(filtered: violence)")
+}
+
+func TestNormalizeAzureContentFilterError_IgnoresOtherAccounts(t *testing.T) {
+	body := []byte(`{"error":{"code":"content_filter","message":"filtered"}}`)
+
+	out, ok := normalizeAzureContentFilterError(&Account{Platform: PlatformOpenAI, Type: AccountTypeAPIKey}, body)
+	require.False(t, ok)
+	require.Equal(t, body, out)
+
+	out, ok = normalizeAzureContentFilterError(newAzureOpenAITestAccount(nil), body)
+	require.True(t, ok)
+	require.Equal(t, "content_filter", gjson.GetBytes(out, "error.code").String())
+}
+
+func TestForwardAsChatCompletions_AzureNativeStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	sse := strings.Join([]string{
+		`data: {"id":"c1","model":"gpt-5-2025-08-07","choices":[{"index":0,"delta":{"content":"hi"}}]}`,
+		``,
+		`data: {"id":"c1","model":"gpt-5-2025-08-07","choices":[],"usage":{"prompt_tokens":11,"completion_tokens":3,"prompt_tokens_details":{"cached_tokens":4}}}`,
+		``,
+		`data: [DONE]`,
+		``,
+	}, "\n")
+	upstream := &anthropicHTTPUpstreamRecorder{resp: &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}, "X-Request-Id": []string{"rid-1"}},
+		Body:       io.NopCloser(strings.NewReader(sse)),
+	}}
+	svc := newAzureOpenAITestService(upstream)
+	account := newAzureOpenAITestAccount(map[string]any{
+		"api_version":        "2024-10-21",
+		"azure_upstream_api": "chat_completions",
+	})
+
+	body, _ := json.Marshal(map[string]any{
+		"model":    "gpt-5",
+		"stream":   true,
+		"messages": []map[string]any{{"role": "user", "content": "hi"}},
+	})
+	result, err := svc.ForwardAsChatCompletions(context.Background(), c, account, body, "", "")
+	require.NoError(t, err)
+
+	require.Equal(t, "https://res.openai.azure.com/openai/deployments/prod-gpt5/chat/completions?api-version=2024-10-21", upstream.lastReq.URL.String())
+	require.Equal(t, "azure-key", upstream.lastReq.Header.Get("api-key"))
+	require.True(t, gjson.GetBytes(upstream.lastBody, "stream_options.include_usage").Bool())
+
+	require.Equal(t, 11, result.Usage.InputTokens)
+	require.Equal(t, 3, result.Usage.OutputTokens)
+	require.Equal(t, 4, result.Usage.CacheReadInputTokens)
+	require.Equal(t, "rid-1", result.RequestID)
+
+	// 客户端未请求 include_usage：usage chunk 不下发，model 还原为请求模型
+	out := rec.Body.String()
+	require.NotContains(t, out, `"usage"`)
+	require.Contains(t, out, `"model":"gpt-5"`)
+	require.Contains(t, out, "data: [DONE]")
+}
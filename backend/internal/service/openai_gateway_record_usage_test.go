@@ -148,6 +148,8 @@ func newOpenAIRecordUsageServiceForTest(usageRepo UsageLogRepository, userRepo U
 		nil,
 		nil,
 		nil,
+		nil,
+		nil,
 	)
 	svc.userGroupRateResolver = newUserGroupRateResolver(
 		rateRepo,
@@ -1070,3 +1072,38 @@ func TestOpenAIGatewayServiceRecordUsage_SimpleModeSkipsBillingAfterPersist(t *t
 	require.Equal(t, 0, userRepo.deductCalls)
 	require.Equal(t, 0, subRepo.incrementCalls)
 }
+
+func TestOpenAIGatewayServiceRecordUsage_RealtimeAudioTokensExcludeCachedAudio(t *testing.T) {
+	usageRepo := &openAIRecordUsageLogRepoStub{inserted: true}
+	userRepo := &openAIRecordUsageUserRepoStub{}
+	subRepo := &openAIRecordUsageSubRepoStub{}
+	svc := newOpenAIRecordUsageServiceForTest(usageRepo, userRepo, subRepo, nil)
+
+	err := svc.RecordUsage(context.Background(), &OpenAIRecordUsageInput{
+		Result: &OpenAIForwardResult{
+			RequestID: "resp_realtime_audio",
+			Usage: OpenAIUsage{
+				InputTokens:          120,
+				OutputTokens:         60,
+				CacheReadInputTokens: 64,
+				AudioInputTokens:     100,
+				AudioOutputTokens:    48,
+				AudioCacheReadTokens: 64,
+			},
+			Model:        "gpt-5.1",
+			Stream:       true,
+			OpenAIWSMode: true,
+			Duration:     time.Second,
+		},
+		APIKey:  &APIKey{ID: 1030},
+		User:    &User{ID: 2030},
+		Account: &Account{ID: 3030},
+	})
+
+	require.NoError(t, err)
+	require.NotNil(t, usageRepo.lastLog)
+	require.Equal(t, 56, usageRepo.lastLog.InputTokens)
+	require.Equal(t, 64, usageRepo.lastLog.CacheReadTokens)
+	require.Equal(t, 36, usageRepo.lastLog.AudioInputTokens)
+	require.Equal(t, 48, usageRepo.lastLog.AudioOutputTokens)
+}
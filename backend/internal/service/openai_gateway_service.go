@@ -207,6 +207,10 @@ type OpenAIUsage struct {
 	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
 	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 	ImageOutputTokens        int `json:"image_output_tokens,omitempty"`
+	// Realtime 音频 token：AudioInputTokens 含缓存命中的音频，AudioCacheReadTokens 为其中的缓存部分
+	AudioInputTokens     int `json:"audio_input_tokens,omitempty"`
+	AudioOutputTokens    int `json:"audio_output_tokens,omitempty"`
+	AudioCacheReadTokens int `json:"audio_cache_read_tokens,omitempty"`
 }
 
 // OpenAIForwardResult represents the result of forwarding
@@ -323,11 +327,14 @@ type OpenAIGatewayService struct {
 	httpUpstream          HTTPUpstream
 	deferredService       *DeferredService
 	openAITokenProvider   *OpenAITokenProvider
+	azureTokenProvider    *AzureOpenAITokenProvider
 	toolCorrector         *CodexToolCorrector
 	openaiWSResolver      OpenAIWSProtocolResolver
 	resolver              *ModelPricingResolver
 	channelService        *ChannelService
 	balanceNotifyService  *BalanceNotifyService
+	quotaForecastService  *QuotaForecastService
+	clusterService        *ClusterService
 
 	openaiWSPoolOnce              sync.Once
 	openaiWSStateStoreOnce        sync.Once
@@ -363,9 +370,11 @@ func NewOpenAIGatewayService(
 	httpUpstream HTTPUpstream,
 	deferredService *DeferredService,
 	openAITokenProvider *OpenAITokenProvider,
+	azureTokenProvider *AzureOpenAITokenProvider,
 	resolver *ModelPricingResolver,
 	channelService *ChannelService,
 	balanceNotifyService *BalanceNotifyService,
+	quotaForecastService *QuotaForecastService,
 ) *OpenAIGatewayService {
 	svc := &OpenAIGatewayService{
 		accountRepo:         accountRepo,
@@ -391,11 +400,13 @@ func NewOpenAIGatewayService(
 		httpUpstream:          httpUpstream,
 		deferredService:       deferredService,
 		openAITokenProvider:   openAITokenProvider,
+		azureTokenProvider:    azureTokenProvider,
 		toolCorrector:         NewCodexToolCorrector(),
 		openaiWSResolver:      NewOpenAIWSProtocolResolver(cfg),
 		resolver:              resolver,
 		channelService:        channelService,
 		balanceNotifyService:  balanceNotifyService,
+		quotaForecastService:  quotaForecastService,
 		responseHeaderFilter:  compileResponseHeaderFilter(cfg),
 		codexSnapshotThrottle: newAccountWriteThrottle(openAICodexSnapshotPersistMinInterval),
 	}
@@ -1544,6 +1555,7 @@ func (s *OpenAIGatewayService) SelectAccountWithLoadAwareness(ctx context.Contex
 		}
 	} else {
 		var available []accountWithLoad
+		now := time.Now()
 		for _, acc := range candidates {
 			loadInfo := loadMap[acc.ID]
 			if loadInfo == nil {
@@ -1553,18 +1565,23 @@ func (s *OpenAIGatewayService) SelectAccountWithLoadAwareness(ctx context.Contex
 				available = append(available, accountWithLoad{
 					account:  acc,
 					loadInfo: loadInfo,
+					quota:    s.quotaForecastService.Forecast(acc, requestedModel, now),
 				})
 			}
 		}
 
 		if len(available) > 0 {
+			assignQuotaResetRanks(available)
 			sort.SliceStable(available, func(i, j int) bool {
 				a, b := available[i], available[j]
 				if a.account.Priority != b.account.Priority {
 					return a.account.Priority < b.account.Priority
 				}
-				if a.loadInfo.LoadRate != b.loadInfo.LoadRate {
-					return a.loadInfo.LoadRate < b.loadInfo.LoadRate
+				if a.effectiveLoadRate() != b.effectiveLoadRate() {
+					return a.effectiveLoadRate() < b.effectiveLoadRate()
+				}
+				if a.quotaResetRank != b.quotaResetRank {
+					return a.quotaResetRank < b.quotaResetRank
 				}
 				switch {
 				case a.account.LastUsedAt == nil && b.account.LastUsedAt != nil:
@@ -1771,6 +1788,22 @@ func (s *OpenAIGatewayService) GetAccessToken(ctx context.Context, account *Acco
 			return "", "", errors.New("api_key not found in credentials")
 		}
 		return apiKey, "apikey", nil
+	case AccountTypeAzure:
+		if account.IsAzureEntraAuth() {
+			if s.azureTokenProvider == nil {
+				return "", "", errors.New("azure token provider not configured")
+			}
+			accessToken, err := s.azureTokenProvider.GetAccessToken(ctx, account)
+			if err != nil {
+				return "", "", err
+			}
+			return accessToken, "azure_entra", nil
+		}
+		apiKey := strings.TrimSpace(account.GetCredential("api_key"))
+		if apiKey == "" {
+			return "", "", errors.New("api_key not found in credentials")
+		}
+		return apiKey, "azure", nil
 	default:
 		return "", "", fmt.Errorf("unsupported account type: %s", account.Type)
 	}
@@ -2025,7 +2058,7 @@ func (s *OpenAIGatewayService) Forward(ctx context.Context, c *gin.Context, acco
 
 		// Also handle max_completion_tokens (similar logic)
 		if _, hasMaxCompletionTokens := reqBody["max_completion_tokens"]; hasMaxCompletionTokens {
-			if account.Type == AccountTypeAPIKey || account.Platform != PlatformOpenAI {
+			if account.Type == AccountTypeAPIKey || account.Type == AccountTypeAzure || account.Platform != PlatformOpenAI {
 				delete(reqBody, "max_completion_tokens")
 				bodyModified = true
 				markPatchDelete("max_completion_tokens")
@@ -2661,8 +2694,17 @@ func (s *OpenAIGatewayService) buildUpstreamRequestOpenAIPassthrough(
 			}
 			targetURL = buildOpenAIResponsesURL(validatedURL)
 		}
+	case AccountTypeAzure:
+		azureURL, err := s.buildAzureResponsesURL(account, c)
+		if err != nil {
+			return nil, err
+		}
+		targetURL = azureURL
+		body = rewriteAzureDeploymentModel(account, body)
+	}
+	if account.Type != AccountTypeAzure {
+		targetURL = appendOpenAIResponsesRequestPathSuffix(targetURL, openAIResponsesRequestPathSuffix(c))
 	}
-	targetURL = appendOpenAIResponsesRequestPathSuffix(targetURL, openAIResponsesRequestPathSuffix(c))
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
 	if err != nil {
@@ -2687,7 +2729,7 @@ func (s *OpenAIGatewayService) buildUpstreamRequestOpenAIPassthrough(
 	req.Header.Del("authorization")
 	req.Header.Del("x-api-key")
 	req.Header.Del("x-goog-api-key")
-	req.Header.Set("authorization", "Bearer "+token)
+	setOpenAIUpstreamAuthHeader(req, account, token)
 
 	// OAuth 透传到 ChatGPT internal API 时补齐必要头。
 	if account.Type == AccountTypeOAuth {
@@ -3173,10 +3215,20 @@ func (s *OpenAIGatewayService) buildUpstreamRequest(ctx context.Context, c *gin.
 			}
 			targetURL = buildOpenAIResponsesURL(validatedURL)
 		}
+	case AccountTypeAzure:
+		// Azure OpenAI：资源端点 + api-version，body.model 改写为部署名
+		azureURL, err := s.buildAzureResponsesURL(account, c)
+		if err != nil {
+			return nil, err
+		}
+		targetURL = azureURL
+		body = rewriteAzureDeploymentModel(account, body)
 	default:
 		targetURL = openaiPlatformAPIURL
 	}
-	targetURL = appendOpenAIResponsesRequestPathSuffix(targetURL, openAIResponsesRequestPathSuffix(c))
+	if account.Type != AccountTypeAzure {
+		targetURL = appendOpenAIResponsesRequestPathSuffix(targetURL, openAIResponsesRequestPathSuffix(c))
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(body))
 	if err != nil {
@@ -3184,7 +3236,7 @@ func (s *OpenAIGatewayService) buildUpstreamRequest(ctx context.Context, c *gin.
 	}
 
 	// Set authentication header
-	req.Header.Set("authorization", "Bearer "+token)
+	setOpenAIUpstreamAuthHeader(req, account, token)
 
 	// Set headers specific to OAuth accounts (ChatGPT internal API)
 	if account.Type == AccountTypeOAuth {
@@ -3259,6 +3311,7 @@ func (s *OpenAIGatewayService) handleErrorResponse(
 	requestBody []byte,
 ) (*OpenAIForwardResult, error) {
 	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	body, contentFiltered := normalizeAzureContentFilterError(account, body)
 
 	upstreamMsg := strings.TrimSpace(extractUpstreamErrorMessage(body))
 	upstreamMsg = sanitizeUpstreamErrorMessage(upstreamMsg)
@@ -3363,20 +3416,25 @@ func (s *OpenAIGatewayService) handleErrorResponse(
 	var errType, errMsg string
 	var statusCode int
 
-	switch resp.StatusCode {
-	case 401:
+	switch {
+	case contentFiltered:
+		// Azure 内容过滤属于请求内容问题，直接返回过滤原因
+		statusCode = http.StatusBadRequest
+		errType = "invalid_request_error"
+		errMsg = upstreamMsg
+	case resp.StatusCode == 401:
 		statusCode = http.StatusBadGateway
 		errType = "upstream_error"
 		errMsg = "Upstream authentication failed, please contact administrator"
-	case 402:
+	case resp.StatusCode == 402:
 		statusCode = http.StatusBadGateway
 		errType = "upstream_error"
 		errMsg = "Upstream payment required: insufficient balance or billing issue"
-	case 403:
+	case resp.StatusCode == 403:
 		statusCode = http.StatusBadGateway
 		errType = "upstream_error"
 		errMsg = "Upstream access forbidden, please contact administrator"
-	case 429:
+	case resp.StatusCode == 429:
 		statusCode = http.StatusTooManyRequests
 		errType = "rate_limit_error"
 		errMsg = "Upstream rate limit exceeded, please retry later"
@@ -3415,6 +3473,7 @@ func (s *OpenAIGatewayService) handleCompatErrorResponse(
 	writeError compatErrorWriter,
 ) (*OpenAIForwardResult, error) {
 	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	body, _ = normalizeAzureContentFilterError(account, body)
 
 	upstreamMsg := strings.TrimSpace(extractUpstreamErrorMessage(body))
 	if upstreamMsg == "" {
@@ -4432,14 +4491,22 @@ func (s *OpenAIGatewayService) RecordUsage(ctx context.Context, input *OpenAIRec
 	if actualInputTokens < 0 {
 		actualInputTokens = 0
 	}
+	// 音频输入同理：缓存命中的音频按音频缓存读取价格计费
+	actualAudioInputTokens := result.Usage.AudioInputTokens - result.Usage.AudioCacheReadTokens
+	if actualAudioInputTokens < 0 {
+		actualAudioInputTokens = 0
+	}
 
 	// Calculate cost
 	tokens := UsageTokens{
-		InputTokens:         actualInputTokens,
-		OutputTokens:        result.Usage.OutputTokens,
-		CacheCreationTokens: result.Usage.CacheCreationInputTokens,
-		CacheReadTokens:     result.Usage.CacheReadInputTokens,
-		ImageOutputTokens:   result.Usage.ImageOutputTokens,
+		InputTokens:          actualInputTokens,
+		OutputTokens:         result.Usage.OutputTokens,
+		CacheCreationTokens:  result.Usage.CacheCreationInputTokens,
+		CacheReadTokens:      result.Usage.CacheReadInputTokens,
+		ImageOutputTokens:    result.Usage.ImageOutputTokens,
+		AudioInputTokens:     actualAudioInputTokens,
+		AudioOutputTokens:    result.Usage.AudioOutputTokens,
+		AudioCacheReadTokens: result.Usage.AudioCacheReadTokens,
 	}
 
 	// Get rate multiplier
@@ -4525,6 +4592,8 @@ func (s *OpenAIGatewayService) RecordUsage(ctx context.Context, input *OpenAIRec
 		CacheCreationTokens: result.Usage.CacheCreationInputTokens,
 		CacheReadTokens:     result.Usage.CacheReadInputTokens,
 		ImageOutputTokens:   result.Usage.ImageOutputTokens,
+		AudioInputTokens:    actualAudioInputTokens,
+		AudioOutputTokens:   result.Usage.AudioOutputTokens,
 	}
 	if cost != nil {
 		usageLog.InputCost = cost.InputCost
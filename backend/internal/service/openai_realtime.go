@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	openaiwsv2 "github.com/Wei-Shaw/sub2api/internal/service/openai_ws_v2"
+	coderws "github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	openaiPlatformRealtimeURL = "https://api.openai.com/v1/realtime"
+
+	// Realtime beta 协议：客户端通过 OpenAI-Beta 头或子协议声明，原样透传给上游
+	openAIRealtimeBetaValue       = "realtime=v1"
+	openAIRealtimeBetaSubprotocol = "openai-beta.realtime-v1"
+	// OpenAIRealtimeSubprotocol 浏览器客户端使用的 Realtime 子协议
+	OpenAIRealtimeSubprotocol = "realtime"
+)
+
+// ProxyRealtimeWebSocket 代理一次 OpenAI Realtime 会话（/v1/realtime）。
+//
+// 仅支持 API Key 账号；会话帧双向原样透传，每个上游 response.done 事件回调一次 onResponseDone 用于计费。
+// 函数在会话结束（任意一方关闭、空闲超时或读写失败）后返回。
+func (s *OpenAIGatewayService) ProxyRealtimeWebSocket(
+	ctx context.Context,
+	c *gin.Context,
+	clientConn *coderws.Conn,
+	account *Account,
+	token string,
+	model string,
+	onResponseDone func(result *OpenAIForwardResult),
+) error {
+	if s == nil {
+		return errors.New("service is nil")
+	}
+	if clientConn == nil {
+		return errors.New("client websocket is nil")
+	}
+	if account == nil {
+		return errors.New("account is nil")
+	}
+	if strings.TrimSpace(token) == "" {
+		return errors.New("token is empty")
+	}
+
+	upstreamModel := resolveOpenAIForwardModel(account, model, "")
+	wsURL, err := s.buildOpenAIRealtimeWSURL(account, upstreamModel)
+	if err != nil {
+		return fmt.Errorf("build realtime ws url: %w", err)
+	}
+	headers := s.buildOpenAIRealtimeHeaders(c, account, token)
+	proxyURL := ""
+	if account.ProxyID != nil && account.Proxy != nil {
+		proxyURL = account.Proxy.URL()
+	}
+	dialer := s.getOpenAIWSPassthroughDialer()
+	if dialer == nil {
+		return errors.New("openai ws passthrough dialer is nil")
+	}
+
+	dialCtx, cancelDial := context.WithTimeout(ctx, s.openAIWSDialTimeout())
+	defer cancelDial()
+	upstreamConn, statusCode, handshakeHeaders, err := dialer.Dial(dialCtx, wsURL, headers, proxyURL)
+	if err != nil {
+		logOpenAIRealtime(
+			"dial_failed account_id=%d model=%s status_code=%d err=%s",
+			account.ID,
+			truncateOpenAIWSLogValue(upstreamModel, openAIWSLogValueMaxLen),
+			statusCode,
+			truncateOpenAIWSLogValue(err.Error(), openAIWSLogValueMaxLen),
+		)
+		return s.mapOpenAIWSPassthroughDialError(err, statusCode, handshakeHeaders)
+	}
+	defer func() {
+		_ = upstreamConn.Close()
+	}()
+	upstreamFrameConn, ok := upstreamConn.(openaiwsv2.FrameConn)
+	if !ok {
+		return errors.New("openai realtime upstream connection does not support frame relay")
+	}
+	logOpenAIRealtime(
+		"session_start account_id=%d model=%s upstream_model=%s upstream_request_id=%s",
+		account.ID,
+		truncateOpenAIWSLogValue(model, openAIWSLogValueMaxLen),
+		truncateOpenAIWSLogValue(upstreamModel, openAIWSLogValueMaxLen),
+		openAIWSHeaderValueForLog(handshakeHeaders, "x-request-id"),
+	)
+
+	relayResult, relayExit := openaiwsv2.RelayRealtime(ctx, &openAIWSClientFrameConn{conn: clientConn}, upstreamFrameConn, openaiwsv2.RealtimeRelayOptions{
+		WriteTimeout: s.openAIWSWriteTimeout(),
+		IdleTimeout:  s.openAIWSPassthroughIdleTimeout(),
+		OnResponseDone: func(resp openaiwsv2.RealtimeResponse) {
+			if onResponseDone == nil {
+				return
+			}
+			onResponseDone(&OpenAIForwardResult{
+				RequestID:       resp.ResponseID,
+				Usage:           openAIUsageFromRealtime(resp.Usage),
+				Model:           model,
+				UpstreamModel:   upstreamModel,
+				Stream:          true,
+				OpenAIWSMode:    true,
+				ResponseHeaders: cloneHeader(handshakeHeaders),
+				Duration:        resp.Duration,
+				FirstTokenMs:    resp.FirstTokenMs,
+			})
+		},
+	})
+	if relayExit == nil {
+		logOpenAIRealtime(
+			"session_completed account_id=%d responses=%d duration_ms=%d c2u_frames=%d u2c_frames=%d dropped_frames=%d",
+			account.ID,
+			relayResult.Responses,
+			relayResult.Duration.Milliseconds(),
+			relayResult.ClientToUpstreamFrames,
+			relayResult.UpstreamToClientFrames,
+			relayResult.DroppedDownstreamFrames,
+		)
+		return nil
+	}
+	logOpenAIRealtime(
+		"session_failed account_id=%d stage=%s err=%s responses=%d duration_ms=%d",
+		account.ID,
+		truncateOpenAIWSLogValue(relayExit.Stage, openAIWSLogValueMaxLen),
+		truncateOpenAIWSLogValue(relayErrorText(relayExit.Err), openAIWSLogValueMaxLen),
+		relayResult.Responses,
+		relayResult.Duration.Milliseconds(),
+	)
+	if relayExit.Stage == "idle_timeout" {
+		return NewOpenAIWSClientCloseError(coderws.StatusPolicyViolation, "client websocket idle timeout", relayExit.Err)
+	}
+	return fmt.Errorf("openai realtime relay %s: %w", relayExit.Stage, relayExit.Err)
+}
+
+// buildOpenAIRealtimeWSURL 构建上游 Realtime 地址：{base}/v1/realtime?model=xxx
+func (s *OpenAIGatewayService) buildOpenAIRealtimeWSURL(account *Account, model string) (string, error) {
+	if account == nil {
+		return "", errors.New("account is nil")
+	}
+	if account.Type != AccountTypeAPIKey {
+		return "", errors.New("realtime requires an openai api key account")
+	}
+	targetURL := openaiPlatformRealtimeURL
+	if baseURL := account.GetOpenAIBaseURL(); baseURL != "" {
+		validatedURL, err := s.validateUpstreamBaseURL(baseURL)
+		if err != nil {
+			return "", err
+		}
+		targetURL = buildOpenAIRealtimeURL(validatedURL)
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(targetURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid target url: %w", err)
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "https":
+		parsed.Scheme = "wss"
+	case "http":
+		parsed.Scheme = "ws"
+	case "wss", "ws":
+		// 保持不变
+	default:
+		return "", fmt.Errorf("unsupported scheme for ws: %s", parsed.Scheme)
+	}
+	query := parsed.Query()
+	query.Set("model", model)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+func buildOpenAIRealtimeURL(base string) string {
+	normalized := strings.TrimRight(strings.TrimSpace(base), "/")
+	if strings.HasSuffix(normalized, "/realtime") {
+		return normalized
+	}
+	if strings.HasSuffix(normalized, "/v1") {
+		return normalized + "/realtime"
+	}
+	return normalized + "/v1/realtime"
+}
+
+func (s *OpenAIGatewayService) buildOpenAIRealtimeHeaders(c *gin.Context, account *Account, token string) http.Header {
+	headers := make(http.Header)
+	headers.Set("authorization", "Bearer "+token)
+	if c != nil && c.Request != nil {
+		if IsOpenAIRealtimeBetaRequest(c.Request) {
+			headers.Set("OpenAI-Beta", openAIRealtimeBetaValue)
+		}
+		if ua := strings.TrimSpace(c.GetHeader("User-Agent")); ua != "" {
+			headers.Set("user-agent", ua)
+		}
+	}
+	if account != nil {
+		if customUA := strings.TrimSpace(account.GetOpenAIUserAgent()); customUA != "" {
+			headers.Set("user-agent", customUA)
+		}
+	}
+	return headers
+}
+
+// IsOpenAIRealtimeBetaRequest 判断客户端是否使用 Realtime beta 协议（OpenAI-Beta 头或 beta 子协议）
+func IsOpenAIRealtimeBetaRequest(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	for _, beta := range strings.Split(r.Header.Get("OpenAI-Beta"), ",") {
+		if strings.EqualFold(strings.TrimSpace(beta), openAIRealtimeBetaValue) {
+			return true
+		}
+	}
+	for _, protocol := range OpenAIRealtimeSubprotocols(r) {
+		if protocol == openAIRealtimeBetaSubprotocol {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAIRealtimeSubprotocols 解析客户端声明的 WebSocket 子协议
+func OpenAIRealtimeSubprotocols(r *http.Request) []string {
+	if r == nil {
+		return nil
+	}
+	var out []string
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				out = append(out, protocol)
+			}
+		}
+	}
+	return out
+}
+
+// openAIUsageFromRealtime 将 Realtime usage 转为 OpenAIUsage（缓存与音频字段均为子集，计费时再拆分）
+func openAIUsageFromRealtime(usage openaiwsv2.RealtimeUsage) OpenAIUsage {
+	return OpenAIUsage{
+		InputTokens:          usage.InputTokens,
+		OutputTokens:         usage.OutputTokens,
+		CacheReadInputTokens: usage.CachedTokens,
+		AudioInputTokens:     usage.AudioInputTokens,
+		AudioOutputTokens:    usage.AudioOutputTokens,
+		AudioCacheReadTokens: usage.CachedAudioTokens,
+	}
+}
+
+func logOpenAIRealtime(format string, args ...any) {
+	logger.LegacyPrintf("service.openai_realtime", "[OpenAI Realtime] "+format, args...)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildOpenAIRealtimeURL(t *testing.T) {
+	require.Equal(t, "https://example.com/v1/realtime", buildOpenAIRealtimeURL("https://example.com"))
+	require.Equal(t, "https://example.com/v1/realtime", buildOpenAIRealtimeURL("https://example.com/v1/"))
+	require.Equal(t, "https://example.com/openai/realtime", buildOpenAIRealtimeURL("https://example.com/openai/realtime"))
+}
+
+func TestBuildOpenAIRealtimeWSURL(t *testing.T) {
+	svc := &OpenAIGatewayService{cfg: &config.Config{}}
+
+	wsURL, err := svc.buildOpenAIRealtimeWSURL(&Account{Type: AccountTypeAPIKey, Platform: PlatformOpenAI}, "gpt-realtime")
+	require.NoError(t, err)
+	require.Equal(t, "wss://api.openai.com/v1/realtime?model=gpt-realtime", wsURL)
+
+	wsURL, err = svc.buildOpenAIRealtimeWSURL(&Account{
+		Type:        AccountTypeAPIKey,
+		Platform:    PlatformOpenAI,
+		Credentials: map[string]any{"base_url": "https://relay.example.com/v1"},
+	}, "gpt-realtime")
+	require.NoError(t, err)
+	require.Equal(t, "wss://relay.example.com/v1/realtime?model=gpt-realtime", wsURL)
+
+	_, err = svc.buildOpenAIRealtimeWSURL(&Account{Type: AccountTypeOAuth, Platform: PlatformOpenAI}, "gpt-realtime")
+	require.Error(t, err)
+}
+
+func TestIsOpenAIRealtimeBetaRequest(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/v1/realtime", nil)
+	require.False(t, IsOpenAIRealtimeBetaRequest(req))
+
+	req.Header.Set("Sec-WebSocket-Protocol", "realtime, openai-beta.realtime-v1")
+	require.True(t, IsOpenAIRealtimeBetaRequest(req))
+
+	req.Header.Del("Sec-WebSocket-Protocol")
+	req.Header.Set("OpenAI-Beta", "realtime=v1")
+	require.True(t, IsOpenAIRealtimeBetaRequest(req))
+}
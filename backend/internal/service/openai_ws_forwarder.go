@@ -951,12 +951,24 @@ func (s *OpenAIGatewayService) getOpenAIWSStateStore() OpenAIWSStateStore {
 	}
 	s.openaiWSStateStoreOnce.Do(func() {
 		if s.openaiWSStateStore == nil {
-			s.openaiWSStateStore = NewOpenAIWSStateStore(s.cache)
+			store := NewClusterOpenAIWSStateStore(s.cache, s.clusterService.SharedCache(), s.clusterService.NodeID())
+			if ds, ok := store.(*defaultOpenAIWSStateStore); ok {
+				s.clusterService.trackBindingWriter(ds.writer)
+			}
+			s.openaiWSStateStore = store
 		}
 	})
 	return s.openaiWSStateStore
 }
 
+// SetClusterService 注入集群服务，启用后 WS 粘连状态在副本间共享（需在处理请求前调用）。
+func (s *OpenAIGatewayService) SetClusterService(cluster *ClusterService) {
+	if s == nil {
+		return
+	}
+	s.clusterService = cluster
+}
+
 func (s *OpenAIGatewayService) openAIWSResponseStickyTTL() time.Duration {
 	if s != nil && s.cfg != nil {
 		seconds := s.cfg.Gateway.OpenAIWS.StickyResponseIDTTLSeconds
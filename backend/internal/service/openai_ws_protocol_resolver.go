@@ -10,6 +10,8 @@ const (
 	OpenAIUpstreamTransportHTTPSSE              OpenAIUpstreamTransport = "http_sse"
 	OpenAIUpstreamTransportResponsesWebsocket   OpenAIUpstreamTransport = "responses_websockets"
 	OpenAIUpstreamTransportResponsesWebsocketV2 OpenAIUpstreamTransport = "responses_websockets_v2"
+	// OpenAIUpstreamTransportRealtime 仅用于账号选择：Realtime 会话只能调度到 OpenAI API Key 账号。
+	OpenAIUpstreamTransportRealtime OpenAIUpstreamTransport = "realtime"
 )
 
 // OpenAIWSProtocolDecision 表示协议决策结果。
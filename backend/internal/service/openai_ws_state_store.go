@@ -9,6 +9,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	gocache "github.com/patrickmn/go-cache"
 )
 
 const (
@@ -17,6 +19,8 @@ const (
 	openAIWSStateStoreCleanupMaxPerMap = 512
 	openAIWSStateStoreMaxEntriesPerMap = 65536
 	openAIWSStateStoreRedisTimeout     = 3 * time.Second
+	// openAIWSSharedTurnStateMissTTL 共享存储未命中后短时间内不再重复查询同一会话
+	openAIWSSharedTurnStateMissTTL = 10 * time.Second
 )
 
 type openAIWSAccountBinding struct {
@@ -45,6 +49,13 @@ type openAIWSSessionConnBinding struct {
 //
 // response_id -> account_id 优先走 GatewayCache（Redis），同时维护本地热缓存。
 // response_id -> conn_id 仅在本进程内有效。
+//
+// 启用集群共享（NewClusterOpenAIWSStateStore）后（写入均为异步批量，不占用请求路径）：
+//   - session -> turn_state 写入 ClusterStateCache，其他副本新建连接时可携带相同 turn state，
+//     保持上游会话粘连与 prompt cache；读取本地优先，本地未命中才查共享存储，出错按未命中处理；
+//   - session -> conn_id 同样写入共享存储并记录归属节点，仅用于运维面板展示归属，
+//     连接本身无法跨进程复用，因此读取仍只看本地；
+//   - response -> conn_id 只保存在本地：调度从不跨副本使用它，逐响应写共享存储没有收益。
 type OpenAIWSStateStore interface {
 	BindResponseAccount(ctx context.Context, groupID int64, responseID string, accountID int64, ttl time.Duration) error
 	GetResponseAccount(ctx context.Context, groupID int64, responseID string) (int64, error)
@@ -76,6 +87,11 @@ type defaultOpenAIWSStateStore struct {
 	sessionToConn        map[string]openAIWSSessionConnBinding
 
 	lastCleanupUnixNano atomic.Int64
+
+	shared       ClusterStateCache
+	writer       *clusterBindingWriter
+	sharedMisses *gocache.Cache
+	nodeID       string
 }
 
 // NewOpenAIWSStateStore 创建默认 WS 状态存储。
@@ -91,6 +107,18 @@ func NewOpenAIWSStateStore(cache GatewayCache) OpenAIWSStateStore {
 	return store
 }
 
+// NewClusterOpenAIWSStateStore 创建跨副本共享的 WS 状态存储；shared 为 nil 时等同 NewOpenAIWSStateStore。
+func NewClusterOpenAIWSStateStore(cache GatewayCache, shared ClusterStateCache, nodeID string) OpenAIWSStateStore {
+	store := NewOpenAIWSStateStore(cache).(*defaultOpenAIWSStateStore)
+	if shared != nil {
+		store.shared = shared
+		store.writer = newClusterBindingWriter(shared)
+		store.sharedMisses = gocache.New(openAIWSSharedTurnStateMissTTL, time.Minute)
+	}
+	store.nodeID = nodeID
+	return store
+}
+
 func (s *defaultOpenAIWSStateStore) BindResponseAccount(ctx context.Context, groupID int64, responseID string, accountID int64, ttl time.Duration) error {
 	id := normalizeOpenAIWSResponseID(responseID)
 	if id == "" || accountID <= 0 {
@@ -225,6 +253,8 @@ func (s *defaultOpenAIWSStateStore) BindSessionTurnState(groupID int64, sessionH
 		expiresAt: time.Now().Add(ttl),
 	}
 	s.sessionToTurnStateMu.Unlock()
+
+	s.setShared(ClusterSessionKindWSTurnState, key, state, ttl)
 }
 
 func (s *defaultOpenAIWSStateStore) GetSessionTurnState(groupID int64, sessionHash string) (string, bool) {
@@ -239,7 +269,7 @@ func (s *defaultOpenAIWSStateStore) GetSessionTurnState(groupID int64, sessionHa
 	binding, ok := s.sessionToTurnState[key]
 	s.sessionToTurnStateMu.RUnlock()
 	if !ok || now.After(binding.expiresAt) || strings.TrimSpace(binding.turnState) == "" {
-		return "", false
+		return s.getSharedTurnState(key)
 	}
 	return binding.turnState, true
 }
@@ -252,6 +282,8 @@ func (s *defaultOpenAIWSStateStore) DeleteSessionTurnState(groupID int64, sessio
 	s.sessionToTurnStateMu.Lock()
 	delete(s.sessionToTurnState, key)
 	s.sessionToTurnStateMu.Unlock()
+
+	s.deleteShared(ClusterSessionKindWSTurnState, key)
 }
 
 func (s *defaultOpenAIWSStateStore) BindSessionConn(groupID int64, sessionHash, connID string, ttl time.Duration) {
@@ -270,6 +302,8 @@ func (s *defaultOpenAIWSStateStore) BindSessionConn(groupID int64, sessionHash,
 		expiresAt: time.Now().Add(ttl),
 	}
 	s.sessionToConnMu.Unlock()
+
+	s.setShared(ClusterSessionKindWSSessionConn, key, conn, ttl)
 }
 
 func (s *defaultOpenAIWSStateStore) GetSessionConn(groupID int64, sessionHash string) (string, bool) {
@@ -297,6 +331,51 @@ func (s *defaultOpenAIWSStateStore) DeleteSessionConn(groupID int64, sessionHash
 	s.sessionToConnMu.Lock()
 	delete(s.sessionToConn, key)
 	s.sessionToConnMu.Unlock()
+
+	s.deleteShared(ClusterSessionKindWSSessionConn, key)
+}
+
+func (s *defaultOpenAIWSStateStore) setShared(kind, key, value string, ttl time.Duration) {
+	if s.writer == nil {
+		return
+	}
+	if kind == ClusterSessionKindWSTurnState {
+		s.sharedMisses.Delete(key)
+	}
+	s.writer.set(kind, key, ClusterBinding{NodeID: s.nodeID, Value: value}, ttl)
+}
+
+func (s *defaultOpenAIWSStateStore) deleteShared(kind, key string) {
+	if s.writer == nil {
+		return
+	}
+	s.writer.delete(kind, key)
+}
+
+// getSharedTurnState 本地未命中时从共享存储读取（会话可能由其他副本建立），命中后回填本地。
+// 出错或未命中都按未命中处理，并在短时间内记住，避免每个请求都访问共享存储。
+func (s *defaultOpenAIWSStateStore) getSharedTurnState(key string) (string, bool) {
+	if s.shared == nil {
+		return "", false
+	}
+	if _, missed := s.sharedMisses.Get(key); missed {
+		return "", false
+	}
+	ctx, cancel := withOpenAIWSStateStoreRedisTimeout(context.Background())
+	defer cancel()
+	binding, err := s.shared.GetBinding(ctx, ClusterSessionKindWSTurnState, key)
+	if err != nil || binding == nil || strings.TrimSpace(binding.Value) == "" {
+		s.sharedMisses.SetDefault(key, struct{}{})
+		return "", false
+	}
+	s.sessionToTurnStateMu.Lock()
+	ensureBindingCapacity(s.sessionToTurnState, key, openAIWSStateStoreMaxEntriesPerMap)
+	s.sessionToTurnState[key] = openAIWSTurnStateBinding{
+		turnState: binding.Value,
+		expiresAt: time.Now().Add(time.Minute),
+	}
+	s.sessionToTurnStateMu.Unlock()
+	return binding.Value, true
 }
 
 func (s *defaultOpenAIWSStateStore) maybeCleanup() {
@@ -0,0 +1,332 @@
+package openai_ws_v2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	coderws "github.com/coder/websocket"
+	"github.com/tidwall/gjson"
+)
+
+// RealtimeUsage 是 Realtime response.done 事件中的 usage。
+// 音频与缓存字段均为对应总量的子集：CachedAudioTokens ⊆ CachedTokens ⊆ InputTokens。
+type RealtimeUsage struct {
+	InputTokens       int
+	OutputTokens      int
+	CachedTokens      int
+	AudioInputTokens  int
+	AudioOutputTokens int
+	CachedAudioTokens int
+}
+
+// RealtimeResponse 描述会话内一次完成的 response（对应一个 response.done 事件）。
+type RealtimeResponse struct {
+	ResponseID   string
+	Status       string
+	Usage        RealtimeUsage
+	Duration     time.Duration
+	FirstTokenMs *int
+}
+
+type RealtimeRelayOptions struct {
+	WriteTimeout         time.Duration
+	IdleTimeout          time.Duration
+	UpstreamDrainTimeout time.Duration
+	OnResponseDone       func(resp RealtimeResponse)
+	OnTrace              func(event RelayTraceEvent)
+	Now                  func() time.Time
+}
+
+type RealtimeRelayResult struct {
+	Responses               int
+	Duration                time.Duration
+	ClientToUpstreamFrames  int64
+	UpstreamToClientFrames  int64
+	DroppedDownstreamFrames int64
+}
+
+type realtimeRelayState struct {
+	responses atomic.Int64
+	// inFlight 记录已 response.created 但尚未 response.done 的 response，用于客户端断开后的排空判断
+	inFlight   atomic.Int64
+	turnTiming map[string]*relayTurnTiming
+}
+
+// RelayRealtime 在客户端与上游之间双向透传 Realtime 会话帧。
+//
+// 与 Relay 不同，Realtime 会话不需要首条消息，帧内容不做任何改写；
+// 仅观测上游的 response.created / response.done 事件，每个 response.done 回调一次 OnResponseDone 用于计费。
+// 客户端主动断开且仍有进行中的 response 时，短暂继续读取上游以捕获延迟的 response.done。
+func RelayRealtime(
+	ctx context.Context,
+	clientConn FrameConn,
+	upstreamConn FrameConn,
+	options RealtimeRelayOptions,
+) (RealtimeRelayResult, *RelayExit) {
+	result := RealtimeRelayResult{}
+	if clientConn == nil || upstreamConn == nil {
+		return result, &RelayExit{Stage: "relay_init", Err: errors.New("relay connection is nil")}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	nowFn := options.Now
+	if nowFn == nil {
+		nowFn = time.Now
+	}
+	writeTimeout := options.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = 2 * time.Minute
+	}
+	drainTimeout := options.UpstreamDrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = 1200 * time.Millisecond
+	}
+	startAt := nowFn()
+	state := &realtimeRelayState{turnTiming: make(map[string]*relayTurnTiming)}
+	onTrace := options.OnTrace
+
+	relayCtx, relayCancel := context.WithCancel(ctx)
+	defer relayCancel()
+
+	lastActivity := atomic.Int64{}
+	lastActivity.Store(nowFn().UnixNano())
+	markActivity := func() {
+		lastActivity.Store(nowFn().UnixNano())
+	}
+	writeUpstream := func(msgType coderws.MessageType, payload []byte) error {
+		writeCtx, cancel := context.WithTimeout(relayCtx, writeTimeout)
+		defer cancel()
+		return upstreamConn.WriteFrame(writeCtx, msgType, payload)
+	}
+	writeClient := func(msgType coderws.MessageType, payload []byte) error {
+		writeCtx, cancel := context.WithTimeout(relayCtx, writeTimeout)
+		defer cancel()
+		return clientConn.WriteFrame(writeCtx, msgType, payload)
+	}
+
+	clientToUpstreamFrames := &atomic.Int64{}
+	upstreamToClientFrames := &atomic.Int64{}
+	droppedDownstreamFrames := &atomic.Int64{}
+	emitRelayTrace(onTrace, RelayTraceEvent{Stage: "realtime_relay_start"})
+
+	exitCh := make(chan relayExitSignal, 3)
+	dropDownstreamWrites := atomic.Bool{}
+	go runClientToUpstream(relayCtx, clientConn, writeUpstream, markActivity, clientToUpstreamFrames, onTrace, exitCh)
+	upstreamDone := make(chan struct{})
+	go func() {
+		defer close(upstreamDone)
+		runRealtimeUpstreamToClient(
+			relayCtx,
+			upstreamConn,
+			writeClient,
+			nowFn,
+			state,
+			options.OnResponseDone,
+			&dropDownstreamWrites,
+			upstreamToClientFrames,
+			droppedDownstreamFrames,
+			markActivity,
+			onTrace,
+			exitCh,
+		)
+	}()
+	go runIdleWatchdog(relayCtx, nowFn, options.IdleTimeout, &lastActivity, onTrace, exitCh)
+
+	firstExit := <-exitCh
+	emitRelayTrace(onTrace, RelayTraceEvent{
+		Stage:           "first_exit",
+		Direction:       relayDirectionFromStage(firstExit.stage),
+		Graceful:        firstExit.graceful,
+		WroteDownstream: firstExit.wroteDownstream,
+		Error:           relayErrorString(firstExit.err),
+	})
+	// 客户端正常断开时若仍有进行中的 response，继续读取上游短窗口以捕获 response.done 计费。
+	if firstExit.stage == "read_client" && firstExit.graceful && state.inFlight.Load() > 0 {
+		dropDownstreamWrites.Store(true)
+		if secondExit, ok := waitRelayExit(exitCh, drainTimeout); ok {
+			emitRelayTrace(onTrace, RelayTraceEvent{
+				Stage:     "second_exit",
+				Direction: relayDirectionFromStage(secondExit.stage),
+				Graceful:  secondExit.graceful,
+				Error:     relayErrorString(secondExit.err),
+			})
+		}
+	}
+	relayCancel()
+	_ = upstreamConn.Close()
+	// 等待上游读循环退出，保证返回后不再回调 OnResponseDone
+	select {
+	case <-upstreamDone:
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	result.Responses = int(state.responses.Load())
+	result.Duration = nowFn().Sub(startAt)
+	result.ClientToUpstreamFrames = clientToUpstreamFrames.Load()
+	result.UpstreamToClientFrames = upstreamToClientFrames.Load()
+	result.DroppedDownstreamFrames = droppedDownstreamFrames.Load()
+
+	// Realtime 会话由任意一方正常关闭即视为结束
+	if firstExit.graceful && (firstExit.stage == "read_client" || firstExit.stage == "read_upstream") {
+		emitRelayTrace(onTrace, RelayTraceEvent{
+			Stage:           "relay_complete",
+			Direction:       relayDirectionFromStage(firstExit.stage),
+			Graceful:        true,
+			WroteDownstream: firstExit.wroteDownstream,
+		})
+		return result, nil
+	}
+	emitRelayTrace(onTrace, RelayTraceEvent{
+		Stage:           "relay_exit",
+		Direction:       relayDirectionFromStage(firstExit.stage),
+		WroteDownstream: firstExit.wroteDownstream,
+		Error:           relayErrorString(firstExit.err),
+	})
+	return result, &RelayExit{
+		Stage:           firstExit.stage,
+		Err:             firstExit.err,
+		WroteDownstream: firstExit.wroteDownstream,
+	}
+}
+
+func runRealtimeUpstreamToClient(
+	ctx context.Context,
+	upstreamConn FrameConn,
+	writeClient func(msgType coderws.MessageType, payload []byte) error,
+	nowFn func() time.Time,
+	state *realtimeRelayState,
+	onResponseDone func(resp RealtimeResponse),
+	dropDownstreamWrites *atomic.Bool,
+	forwardedFrames *atomic.Int64,
+	droppedFrames *atomic.Int64,
+	markActivity func(),
+	onTrace func(event RelayTraceEvent),
+	exitCh chan<- relayExitSignal,
+) {
+	wroteDownstream := false
+	for {
+		msgType, payload, err := upstreamConn.ReadFrame(ctx)
+		if err != nil {
+			emitRelayTrace(onTrace, RelayTraceEvent{
+				Stage:           "read_upstream_failed",
+				Direction:       "upstream_to_client",
+				Error:           err.Error(),
+				Graceful:        isDisconnectError(err),
+				WroteDownstream: wroteDownstream,
+			})
+			exitCh <- relayExitSignal{
+				stage:           "read_upstream",
+				err:             err,
+				graceful:        isDisconnectError(err),
+				wroteDownstream: wroteDownstream,
+			}
+			return
+		}
+		markActivity()
+		done := false
+		if msgType == coderws.MessageText {
+			if resp, ok := observeRealtimeUpstreamMessage(state, payload, nowFn); ok {
+				done = true
+				if onResponseDone != nil {
+					onResponseDone(resp)
+				}
+			}
+		}
+		if dropDownstreamWrites != nil && dropDownstreamWrites.Load() {
+			if droppedFrames != nil {
+				droppedFrames.Add(1)
+			}
+			if done && state.inFlight.Load() <= 0 {
+				exitCh <- relayExitSignal{stage: "drain_terminal", graceful: true, wroteDownstream: wroteDownstream}
+				return
+			}
+			continue
+		}
+		if err := writeClient(msgType, payload); err != nil {
+			emitRelayTrace(onTrace, RelayTraceEvent{
+				Stage:           "write_client_failed",
+				Direction:       "upstream_to_client",
+				MessageType:     relayMessageTypeString(msgType),
+				PayloadBytes:    len(payload),
+				WroteDownstream: wroteDownstream,
+				Error:           err.Error(),
+			})
+			exitCh <- relayExitSignal{stage: "write_client", err: err, wroteDownstream: wroteDownstream}
+			return
+		}
+		wroteDownstream = true
+		if forwardedFrames != nil {
+			forwardedFrames.Add(1)
+		}
+		markActivity()
+	}
+}
+
+// observeRealtimeUpstreamMessage 观测上游事件，遇到 response.done 时返回该 response 的用量。
+func observeRealtimeUpstreamMessage(state *realtimeRelayState, message []byte, nowFn func() time.Time) (RealtimeResponse, bool) {
+	if state == nil || len(message) == 0 {
+		return RealtimeResponse{}, false
+	}
+	values := gjson.GetManyBytes(message, "type", "response.id", "response_id")
+	eventType := strings.TrimSpace(values[0].String())
+	responseID := strings.TrimSpace(values[1].String())
+	if responseID == "" {
+		responseID = strings.TrimSpace(values[2].String())
+	}
+	now := nowFn()
+
+	switch {
+	case eventType == "response.created":
+		if _, exists := state.turnTiming[responseID]; responseID != "" && !exists {
+			state.turnTiming[responseID] = &relayTurnTiming{startAt: now}
+			state.inFlight.Add(1)
+		}
+		return RealtimeResponse{}, false
+	case eventType == "response.done":
+		resp := RealtimeResponse{
+			ResponseID: responseID,
+			Status:     strings.TrimSpace(gjson.GetBytes(message, "response.status").String()),
+			Usage:      parseRealtimeUsage(gjson.GetBytes(message, "response.usage")),
+		}
+		if timing, ok := state.turnTiming[responseID]; ok && timing != nil {
+			delete(state.turnTiming, responseID)
+			state.inFlight.Add(-1)
+			resp.Duration = now.Sub(timing.startAt)
+			resp.FirstTokenMs = openAIWSRelayCloneIntPtr(timing.firstTokenMs)
+		}
+		state.responses.Add(1)
+		return resp, true
+	case isRealtimeTokenEvent(eventType):
+		if timing, ok := state.turnTiming[responseID]; ok && timing != nil && timing.firstTokenMs == nil {
+			ms := int(now.Sub(timing.startAt).Milliseconds())
+			if ms >= 0 {
+				timing.firstTokenMs = &ms
+			}
+		}
+	}
+	return RealtimeResponse{}, false
+}
+
+func parseRealtimeUsage(usage gjson.Result) RealtimeUsage {
+	if !usage.Exists() || usage.Type == gjson.Null {
+		return RealtimeUsage{}
+	}
+	return RealtimeUsage{
+		InputTokens:       int(usage.Get("input_tokens").Int()),
+		OutputTokens:      int(usage.Get("output_tokens").Int()),
+		CachedTokens:      int(usage.Get("input_token_details.cached_tokens").Int()),
+		AudioInputTokens:  int(usage.Get("input_token_details.audio_tokens").Int()),
+		AudioOutputTokens: int(usage.Get("output_token_details.audio_tokens").Int()),
+		CachedAudioTokens: int(usage.Get("input_token_details.cached_tokens_details.audio_tokens").Int()),
+	}
+}
+
+// isRealtimeTokenEvent 匹配 response.audio.delta / response.text.delta / response.output_audio.delta 等增量事件。
+func isRealtimeTokenEvent(eventType string) bool {
+	return strings.HasPrefix(eventType, "response.") && strings.HasSuffix(eventType, ".delta")
+}
@@ -0,0 +1,114 @@
+package openai_ws_v2
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	coderws "github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const realtimeTestResponseDone = `{"type":"response.done","event_id":"evt_9","response":{"id":"resp_rt","status":"completed","usage":{"total_tokens":180,"input_tokens":120,"output_tokens":60,"input_token_details":{"text_tokens":20,"audio_tokens":100,"cached_tokens":64,"cached_tokens_details":{"text_tokens":0,"audio_tokens":64}},"output_token_details":{"text_tokens":12,"audio_tokens":48}}}}`
+
+func TestRelayRealtime_PassthroughAndResponseDone(t *testing.T) {
+	t.Parallel()
+
+	clientConn := newPassthroughTestFrameConn([]passthroughTestFrame{
+		{msgType: coderws.MessageText, payload: []byte(`{"type":"input_audio_buffer.append","audio":"AAAA"}`)},
+	}, false)
+	upstreamBase := newPassthroughTestFrameConn([]passthroughTestFrame{
+		{msgType: coderws.MessageText, payload: []byte(`{"type":"session.created","session":{"id":"sess_1"}}`)},
+		{msgType: coderws.MessageText, payload: []byte(`{"type":"response.created","response":{"id":"resp_rt","status":"in_progress"}}`)},
+		{msgType: coderws.MessageText, payload: []byte(`{"type":"response.audio.delta","response_id":"resp_rt","delta":"BBBB"}`)},
+		{msgType: coderws.MessageText, payload: []byte(realtimeTestResponseDone)},
+	}, true)
+	upstreamConn := &delayedReadFrameConn{base: upstreamBase, firstDelay: 50 * time.Millisecond}
+
+	var mu sync.Mutex
+	var done []RealtimeResponse
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result, relayExit := RelayRealtime(ctx, clientConn, upstreamConn, RealtimeRelayOptions{
+		OnResponseDone: func(resp RealtimeResponse) {
+			mu.Lock()
+			defer mu.Unlock()
+			done = append(done, resp)
+		},
+	})
+	require.Nil(t, relayExit, "上游正常关闭应视为会话结束")
+	require.Equal(t, 1, result.Responses)
+	require.Equal(t, int64(1), result.ClientToUpstreamFrames)
+	require.Equal(t, int64(4), result.UpstreamToClientFrames)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, done, 1)
+	require.Equal(t, "resp_rt", done[0].ResponseID)
+	require.Equal(t, "completed", done[0].Status)
+	require.NotNil(t, done[0].FirstTokenMs)
+	require.Equal(t, RealtimeUsage{
+		InputTokens:       120,
+		OutputTokens:      60,
+		CachedTokens:      64,
+		AudioInputTokens:  100,
+		AudioOutputTokens: 48,
+		CachedAudioTokens: 64,
+	}, done[0].Usage)
+
+	upstreamWrites := upstreamBase.Writes()
+	require.Len(t, upstreamWrites, 1)
+	require.Equal(t, `{"type":"input_audio_buffer.append","audio":"AAAA"}`, string(upstreamWrites[0].payload))
+	clientWrites := clientConn.Writes()
+	require.Len(t, clientWrites, 4)
+	require.Equal(t, realtimeTestResponseDone, string(clientWrites[3].payload))
+}
+
+func TestRelayRealtime_ClientDisconnectDrainsInFlightResponse(t *testing.T) {
+	t.Parallel()
+
+	clientConn := &delayedReadFrameConn{base: newPassthroughTestFrameConn(nil, true), firstDelay: 50 * time.Millisecond}
+	upstreamConn := newPassthroughTestFrameConn([]passthroughTestFrame{
+		{msgType: coderws.MessageText, payload: []byte(`{"type":"response.created","response":{"id":"resp_rt"}}`)},
+	}, false)
+	go func() {
+		time.Sleep(120 * time.Millisecond)
+		upstreamConn.readCh <- passthroughTestFrame{msgType: coderws.MessageText, payload: []byte(realtimeTestResponseDone)}
+	}()
+
+	var doneCount int
+	var doneUsage RealtimeUsage
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result, relayExit := RelayRealtime(ctx, clientConn, upstreamConn, RealtimeRelayOptions{
+		UpstreamDrainTimeout: 500 * time.Millisecond,
+		OnResponseDone: func(resp RealtimeResponse) {
+			doneCount++
+			doneUsage = resp.Usage
+		},
+	})
+	require.Nil(t, relayExit)
+	require.Equal(t, 1, result.Responses)
+	require.Equal(t, 1, doneCount)
+	require.Equal(t, 48, doneUsage.AudioOutputTokens)
+	require.Equal(t, int64(1), result.DroppedDownstreamFrames)
+}
+
+func TestRelayRealtime_NilConnections(t *testing.T) {
+	t.Parallel()
+
+	_, relayExit := RelayRealtime(context.Background(), nil, newPassthroughTestFrameConn(nil, true), RealtimeRelayOptions{})
+	require.NotNil(t, relayExit)
+	require.Equal(t, "relay_init", relayExit.Stage)
+}
+
+func TestParseRealtimeUsage_MissingFields(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, RealtimeUsage{}, parseRealtimeUsage(gjson.Parse(`null`)))
+	require.Equal(t, RealtimeUsage{InputTokens: 5, OutputTokens: 2}, parseRealtimeUsage(gjson.Parse(`{"input_tokens":5,"output_tokens":2}`)))
+}
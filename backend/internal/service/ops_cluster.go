@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// OpsClusterOverview 多副本节点概览
+type OpsClusterOverview struct {
+	Enabled   bool          `json:"enabled"`
+	NodeID    string        `json:"node_id"`
+	Nodes     []ClusterNode `json:"nodes"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// SetClusterService 注入集群服务（运维面板节点视图）
+func (s *OpsService) SetClusterService(cluster *ClusterService) {
+	if s == nil {
+		return
+	}
+	s.clusterService = cluster
+}
+
+// GetClusterOverview 返回存活节点及各节点持有的会话数量
+func (s *OpsService) GetClusterOverview(ctx context.Context) (*OpsClusterOverview, error) {
+	nodes, err := s.clusterService.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &OpsClusterOverview{
+		Enabled:   s.clusterService.Enabled(),
+		NodeID:    s.clusterService.NodeID(),
+		Nodes:     nodes,
+		Timestamp: time.Now().UTC(),
+	}, nil
+}
+
+// ListClusterSessions 返回指定节点持有的会话
+func (s *OpsService) ListClusterSessions(ctx context.Context, nodeID string, limit int) ([]ClusterSessionOwnership, error) {
+	return s.clusterService.ListSessions(ctx, nodeID, limit)
+}
@@ -345,6 +345,19 @@ func (s *OpsService) getUsersLoadMapBestEffort(ctx context.Context, users []User
 	return out
 }
 
+// GetPriorityClassStats returns account slot usage per API key priority class (interactive / normal / background)
+// for the current instance.
+func (s *OpsService) GetPriorityClassStats() []PriorityClassStats {
+	if s == nil || s.concurrencyService == nil {
+		return []PriorityClassStats{}
+	}
+	stats := s.concurrencyService.PriorityClassStats()
+	if stats == nil {
+		return []PriorityClassStats{}
+	}
+	return stats
+}
+
 // GetUserConcurrencyStats returns real-time concurrency usage for all active users.
 func (s *OpsService) GetUserConcurrencyStats(ctx context.Context) (map[int64]*UserConcurrencyInfo, *time.Time, error) {
 	if err := s.RequireMonitoringEnabled(ctx); err != nil {
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// OpsFairShareOverview 分组内公平准入实时状态（仅当前实例）
+type OpsFairShareOverview struct {
+	Enabled   bool                  `json:"enabled"`
+	Groups    []FairShareGroupStats `json:"groups"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// SetFairShareService 注入公平准入服务（运维面板排队视图）
+func (s *OpsService) SetFairShareService(fairShare *FairShareService) {
+	if s == nil {
+		return
+	}
+	s.fairShareService = fairShare
+}
+
+// GetFairShareOverview 返回各分组的租户份额、排队位置与预计等待时间
+func (s *OpsService) GetFairShareOverview(ctx context.Context) *OpsFairShareOverview {
+	overview := &OpsFairShareOverview{
+		Groups:    []FairShareGroupStats{},
+		Timestamp: time.Now().UTC(),
+	}
+	if s == nil || s.fairShareService == nil {
+		return overview
+	}
+	overview.Enabled = s.fairShareService.Settings(ctx).Enabled
+	if groups := s.fairShareService.Snapshot(); len(groups) > 0 {
+		overview.Groups = groups
+	}
+	return overview
+}
@@ -54,6 +54,8 @@ type OpsService struct {
 	geminiCompatService       *GeminiMessagesCompatService
 	antigravityGatewayService *AntigravityGatewayService
 	systemLogSink             *OpsSystemLogSink
+	clusterService            *ClusterService
+	fairShareService          *FairShareService
 }
 
 func NewOpsService(
@@ -0,0 +1,517 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+var (
+	ErrPasskeyNotEnabled         = infraerrors.BadRequest("PASSKEY_NOT_ENABLED", "passkey authentication is not enabled")
+	ErrPasskeyNotFound           = infraerrors.NotFound("PASSKEY_NOT_FOUND", "passkey not found")
+	ErrPasskeyChallengeExpired   = infraerrors.BadRequest("PASSKEY_CHALLENGE_EXPIRED", "passkey challenge expired, please try again")
+	ErrPasskeyVerificationFailed = infraerrors.Unauthorized("PASSKEY_VERIFICATION_FAILED", "passkey verification failed")
+	ErrPasskeyAlreadyRegistered  = infraerrors.Conflict("PASSKEY_ALREADY_REGISTERED", "this passkey is already registered")
+	ErrPasskeyLimitReached       = infraerrors.BadRequest("PASSKEY_LIMIT_REACHED", "maximum number of passkeys reached")
+	ErrPasskeyNameInvalid        = infraerrors.BadRequest("PASSKEY_NAME_INVALID", "passkey name must be 1-100 characters")
+	ErrPasskeyRequiredForAdmin   = infraerrors.Forbidden("PASSKEY_REQUIRED_FOR_ADMIN", "administrator accounts must sign in with a passkey, but none is registered for this account")
+	ErrPasskeyLastForAdmin       = infraerrors.BadRequest("PASSKEY_LAST_FOR_ADMIN", "cannot remove the last passkey while passkeys are required for administrators")
+)
+
+const (
+	passkeyCeremonyTTL   = 5 * time.Minute
+	maxPasskeysPerUser   = 10
+	maxPasskeyNameLength = 100
+
+	passkeyCeremonyRegister = "register:"
+	passkeyCeremony2FA      = "2fa:"
+	passkeyCeremonyLogin    = "login:"
+)
+
+// PasskeyCredential 用户注册的通行密钥；Credential 为 go-webauthn Credential 的 JSON
+type PasskeyCredential struct {
+	ID           int64
+	UserID       int64
+	Name         string
+	CredentialID string // base64url（无填充）
+	Credential   []byte
+	CreatedAt    time.Time
+	LastUsedAt   *time.Time
+}
+
+// PasskeyRepository 通行密钥存储
+type PasskeyRepository interface {
+	ListByUser(ctx context.Context, userID int64) ([]PasskeyCredential, error)
+	Create(ctx context.Context, cred *PasskeyCredential) error
+	Rename(ctx context.Context, userID, id int64, name string) error
+	Delete(ctx context.Context, userID, id int64) error
+	// UpdateAfterLogin 保存新的签名计数等状态并刷新 last_used_at
+	UpdateAfterLogin(ctx context.Context, id int64, credential []byte) error
+	// CountAdminsWithoutPasskey 统计尚未注册通行密钥的活跃管理员
+	CountAdminsWithoutPasskey(ctx context.Context) (int, error)
+}
+
+// PasskeyCache 保存 WebAuthn 仪式（challenge）会话，取出即删除
+type PasskeyCache interface {
+	SetCeremony(ctx context.Context, key string, session *webauthn.SessionData, ttl time.Duration) error
+	TakeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error)
+}
+
+// PasskeyInfo 通行密钥列表项
+type PasskeyInfo struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Synced     bool       `json:"synced"` // 可跨设备同步（backup eligible）
+}
+
+// PasskeyLoginOptions 无密码登录的 challenge
+type PasskeyLoginOptions struct {
+	SessionID string                        `json:"session_id"`
+	Options   *protocol.CredentialAssertion `json:"options"`
+}
+
+// PasskeyService WebAuthn 通行密钥：注册、管理、第二因素断言与无密码登录
+type PasskeyService struct {
+	wa             *webauthn.WebAuthn // nil 表示未启用
+	userRepo       UserRepository
+	repo           PasskeyRepository
+	cache          PasskeyCache
+	settingService *SettingService
+	totpService    *TotpService
+	configErr      error
+}
+
+// NewPasskeyService creates a new PasskeyService
+func NewPasskeyService(
+	cfg *config.Config,
+	userRepo UserRepository,
+	repo PasskeyRepository,
+	cache PasskeyCache,
+	settingService *SettingService,
+	totpService *TotpService,
+) *PasskeyService {
+	s := &PasskeyService{
+		userRepo:       userRepo,
+		repo:           repo,
+		cache:          cache,
+		settingService: settingService,
+		totpService:    totpService,
+	}
+	if cfg != nil && cfg.WebAuthn.Enabled {
+		wa, err := webauthn.New(&webauthn.Config{
+			RPID:          strings.TrimSpace(cfg.WebAuthn.RPID),
+			RPDisplayName: firstNonEmptyString(strings.TrimSpace(cfg.WebAuthn.RPDisplayName), "Sub2API"),
+			RPOrigins:     cfg.WebAuthn.RPOrigins,
+		})
+		if err != nil {
+			// 管理员强制通行密钥策略仍然生效（仅恢复码可用），避免配置错误时静默降级为仅密码登录
+			logger.LegacyPrintf("service.passkey", "[Passkey] invalid webauthn config, passkeys disabled; admins required to use passkeys can only sign in with recovery codes: %v", err)
+			s.configErr = err
+		} else {
+			s.wa = wa
+		}
+	}
+	return s
+}
+
+// Enabled 返回通行密钥功能是否可用
+func (s *PasskeyService) Enabled() bool {
+	return s != nil && s.wa != nil
+}
+
+// ConfigError 返回 WebAuthn 配置初始化失败的原因，配置有效或未启用时为空
+func (s *PasskeyService) ConfigError() string {
+	if s == nil || s.configErr == nil {
+		return ""
+	}
+	return s.configErr.Error()
+}
+
+// List 返回用户的通行密钥
+func (s *PasskeyService) List(ctx context.Context, userID int64) ([]PasskeyInfo, error) {
+	creds, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]PasskeyInfo, 0, len(creds))
+	for i := range creds {
+		info := PasskeyInfo{
+			ID:         creds[i].ID,
+			Name:       creds[i].Name,
+			CreatedAt:  creds[i].CreatedAt,
+			LastUsedAt: creds[i].LastUsedAt,
+		}
+		if wc, err := decodePasskeyCredential(&creds[i]); err == nil {
+			info.Synced = wc.Flags.BackupEligible
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// Count 返回用户已注册的通行密钥数量；功能未启用时视为 0
+func (s *PasskeyService) Count(ctx context.Context, userID int64) (int, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+	creds, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return len(creds), nil
+}
+
+// BeginRegistration 验证身份后生成注册 challenge
+func (s *PasskeyService) BeginRegistration(ctx context.Context, userID int64, emailCode, password string) (*protocol.CredentialCreation, error) {
+	if !s.Enabled() {
+		return nil, ErrPasskeyNotEnabled
+	}
+	if err := s.totpService.VerifyIdentity(ctx, userID, emailCode, password); err != nil {
+		return nil, err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) >= maxPasskeysPerUser {
+		return nil, ErrPasskeyLimitReached
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, c := range user.credentials {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+	creation, session, err := s.wa.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("begin passkey registration: %w", err)
+	}
+	if err := s.cache.SetCeremony(ctx, passkeyCeremonyRegister+fmt.Sprint(userID), session, passkeyCeremonyTTL); err != nil {
+		return nil, fmt.Errorf("store passkey ceremony: %w", err)
+	}
+	return creation, nil
+}
+
+// FinishRegistration 校验认证器响应并保存命名的通行密钥
+func (s *PasskeyService) FinishRegistration(ctx context.Context, userID int64, name string, response []byte) (*PasskeyInfo, error) {
+	if !s.Enabled() {
+		return nil, ErrPasskeyNotEnabled
+	}
+	name, err := normalizePasskeyName(name)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.takeCeremony(ctx, passkeyCeremonyRegister+fmt.Sprint(userID))
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) >= maxPasskeysPerUser {
+		return nil, ErrPasskeyLimitReached
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, ErrPasskeyVerificationFailed.WithCause(err)
+	}
+	credential, err := s.wa.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, ErrPasskeyVerificationFailed.WithCause(err)
+	}
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("marshal passkey credential: %w", err)
+	}
+	record := &PasskeyCredential{
+		UserID:       userID,
+		Name:         name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Credential:   raw,
+	}
+	if err := s.repo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+	logger.LegacyPrintf("service.passkey", "[Passkey] user %d registered passkey %d", userID, record.ID)
+	return &PasskeyInfo{
+		ID:        record.ID,
+		Name:      record.Name,
+		CreatedAt: record.CreatedAt,
+		Synced:    credential.Flags.BackupEligible,
+	}, nil
+}
+
+// Rename 修改通行密钥名称
+func (s *PasskeyService) Rename(ctx context.Context, userID, id int64, name string) error {
+	name, err := normalizePasskeyName(name)
+	if err != nil {
+		return err
+	}
+	return s.repo.Rename(ctx, userID, id, name)
+}
+
+// Delete 验证身份后删除通行密钥；管理员在强制通行密钥时不能删除最后一个
+func (s *PasskeyService) Delete(ctx context.Context, userID, id int64, emailCode, password string) error {
+	if err := s.totpService.VerifyIdentity(ctx, userID, emailCode, password); err != nil {
+		return err
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	if user.IsAdmin() && s.settingService.IsPasskeyRequiredForAdmins(ctx) {
+		creds, err := s.repo.ListByUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(creds) <= 1 {
+			return ErrPasskeyLastForAdmin
+		}
+	}
+	if err := s.repo.Delete(ctx, userID, id); err != nil {
+		return err
+	}
+	logger.LegacyPrintf("service.passkey", "[Passkey] user %d removed passkey %d", userID, id)
+	return nil
+}
+
+// BeginSecondFactor 为待完成的 2FA 登录会话生成断言 challenge（仅允许该用户的通行密钥）
+func (s *PasskeyService) BeginSecondFactor(ctx context.Context, userID int64, tempToken string) (*protocol.CredentialAssertion, error) {
+	if !s.Enabled() {
+		return nil, ErrPasskeyNotEnabled
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, ErrPasskeyNotFound
+	}
+	assertion, session, err := s.wa.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, fmt.Errorf("begin passkey assertion: %w", err)
+	}
+	if err := s.cache.SetCeremony(ctx, passkeyCeremony2FA+tempToken, session, passkeyCeremonyTTL); err != nil {
+		return nil, fmt.Errorf("store passkey ceremony: %w", err)
+	}
+	return assertion, nil
+}
+
+// FinishSecondFactor 校验 2FA 登录会话的断言
+func (s *PasskeyService) FinishSecondFactor(ctx context.Context, userID int64, tempToken string, response []byte) error {
+	if !s.Enabled() {
+		return ErrPasskeyNotEnabled
+	}
+	session, err := s.takeCeremony(ctx, passkeyCeremony2FA+tempToken)
+	if err != nil {
+		return err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return ErrPasskeyVerificationFailed.WithCause(err)
+	}
+	credential, err := s.wa.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return ErrPasskeyVerificationFailed.WithCause(err)
+	}
+	return s.recordUse(ctx, user, credential)
+}
+
+// BeginLogin 生成无密码登录（可发现凭据）challenge
+func (s *PasskeyService) BeginLogin(ctx context.Context) (*PasskeyLoginOptions, error) {
+	if !s.Enabled() {
+		return nil, ErrPasskeyNotEnabled
+	}
+	assertion, session, err := s.wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, fmt.Errorf("begin passkey login: %w", err)
+	}
+	sessionID, err := generateRandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("generate passkey session id: %w", err)
+	}
+	if err := s.cache.SetCeremony(ctx, passkeyCeremonyLogin+sessionID, session, passkeyCeremonyTTL); err != nil {
+		return nil, fmt.Errorf("store passkey ceremony: %w", err)
+	}
+	return &PasskeyLoginOptions{SessionID: sessionID, Options: assertion}, nil
+}
+
+// FinishLogin 校验无密码登录断言（要求用户验证），返回对应用户；账号状态由调用方检查
+func (s *PasskeyService) FinishLogin(ctx context.Context, sessionID string, response []byte) (*User, error) {
+	if !s.Enabled() {
+		return nil, ErrPasskeyNotEnabled
+	}
+	session, err := s.takeCeremony(ctx, passkeyCeremonyLogin+sessionID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, ErrPasskeyVerificationFailed.WithCause(err)
+	}
+	var owner *passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, ok := passkeyUserIDFromHandle(userHandle)
+		if !ok {
+			return nil, errors.New("malformed user handle")
+		}
+		u, err := s.loadUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		owner = u
+		return u, nil
+	}
+	_, credential, err := s.wa.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return nil, ErrPasskeyVerificationFailed.WithCause(err)
+	}
+	if err := s.recordUse(ctx, owner, credential); err != nil {
+		return nil, err
+	}
+	return owner.user, nil
+}
+
+// EnsureAdminsHavePasskeys 开启「管理员必须使用通行密钥」前检查，避免把管理员锁在门外
+func (s *PasskeyService) EnsureAdminsHavePasskeys(ctx context.Context) error {
+	if !s.Enabled() {
+		return ErrPasskeyNotEnabled
+	}
+	missing, err := s.repo.CountAdminsWithoutPasskey(ctx)
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		return infraerrors.BadRequest("PASSKEY_ADMINS_MISSING",
+			fmt.Sprintf("%d active administrator(s) have not registered a passkey yet", missing))
+	}
+	return nil
+}
+
+// recordUse 保存断言后的签名计数；计数回退说明凭据可能被克隆，拒绝登录
+func (s *PasskeyService) recordUse(ctx context.Context, user *passkeyUser, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		logger.LegacyPrintf("service.passkey", "[Passkey] sign counter regression for user %d, possible cloned authenticator", user.user.ID)
+		return ErrPasskeyVerificationFailed
+	}
+	record, ok := user.records[base64.RawURLEncoding.EncodeToString(credential.ID)]
+	if !ok {
+		return ErrPasskeyVerificationFailed
+	}
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("marshal passkey credential: %w", err)
+	}
+	return s.repo.UpdateAfterLogin(ctx, record.ID, raw)
+}
+
+func (s *PasskeyService) takeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	session, err := s.cache.TakeCeremony(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("load passkey ceremony: %w", err)
+	}
+	if session == nil {
+		return nil, ErrPasskeyChallengeExpired
+	}
+	return session, nil
+}
+
+func (s *PasskeyService) loadUser(ctx context.Context, userID int64) (*passkeyUser, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	records, err := s.repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	pu := &passkeyUser{user: user, records: make(map[string]*PasskeyCredential, len(records))}
+	for i := range records {
+		wc, err := decodePasskeyCredential(&records[i])
+		if err != nil {
+			logger.LegacyPrintf("service.passkey", "[Passkey] skip unreadable credential %d: %v", records[i].ID, err)
+			continue
+		}
+		pu.credentials = append(pu.credentials, *wc)
+		pu.records[records[i].CredentialID] = &records[i]
+	}
+	return pu, nil
+}
+
+// passkeyUser 适配 webauthn.User；user handle 为 8 字节大端用户 ID
+type passkeyUser struct {
+	user        *User
+	credentials []webauthn.Credential
+	records     map[string]*PasskeyCredential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return passkeyUserHandle(u.user.ID)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return firstNonEmptyString(strings.TrimSpace(u.user.Username), u.user.Email)
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func passkeyUserHandle(userID int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(userID))
+	return b
+}
+
+func passkeyUserIDFromHandle(handle []byte) (int64, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	id := int64(binary.BigEndian.Uint64(handle))
+	return id, id > 0
+}
+
+func decodePasskeyCredential(record *PasskeyCredential) (*webauthn.Credential, error) {
+	var wc webauthn.Credential
+	if err := json.Unmarshal(record.Credential, &wc); err != nil {
+		return nil, err
+	}
+	return &wc, nil
+}
+
+func normalizePasskeyName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxPasskeyNameLength {
+		return "", ErrPasskeyNameInvalid
+	}
+	return name, nil
+}
@@ -217,6 +217,9 @@ func (s *PaymentService) markCompleted(ctx context.Context, o *dbent.PaymentOrde
 		return fmt.Errorf("mark completed: %w", err)
 	}
 	s.writeAuditLog(ctx, o.ID, auditAction, "system", map[string]any{"rechargeCode": o.RechargeCode, "amount": o.Amount})
+	if s.rechargeObs != nil {
+		s.rechargeObs.OnRechargeCompleted(ctx, o.UserID, o.ID, o.Amount)
+	}
 	return nil
 }
 
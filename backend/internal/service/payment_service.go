@@ -165,6 +165,18 @@ type PaymentService struct {
 	configService   *PaymentConfigService
 	userRepo        UserRepository
 	groupRepo       GroupRepository
+	rechargeObs     RechargeObserver
+}
+
+// RechargeObserver is notified after a payment order has been fulfilled (balance or subscription).
+// Implementations must be idempotent per order and must not fail fulfillment.
+type RechargeObserver interface {
+	OnRechargeCompleted(ctx context.Context, userID, orderID int64, amount float64)
+}
+
+// SetRechargeObserver 注入订单履约完成回调（如邀请返佣结算）
+func (s *PaymentService) SetRechargeObserver(observer RechargeObserver) {
+	s.rechargeObs = observer
 }
 
 func NewPaymentService(entClient *dbent.Client, registry *payment.Registry, loadBalancer payment.LoadBalancer, redeemService *RedeemService, subscriptionSvc *SubscriptionService, configService *PaymentConfigService, userRepo UserRepository, groupRepo GroupRepository) *PaymentService {
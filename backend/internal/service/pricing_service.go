@@ -72,6 +72,29 @@ type LiteLLMModelPricing struct {
 	SupportsPromptCaching               bool    `json:"supports_prompt_caching"`
 	OutputCostPerImage                  float64 `json:"output_cost_per_image"`       // 图片生成模型每张图片价格
 	OutputCostPerImageToken             float64 `json:"output_cost_per_image_token"` // 图片输出 token 价格
+	InputCostPerAudioToken              float64 `json:"input_cost_per_audio_token"`  // 音频输入 token 价格（Realtime）
+	OutputCostPerAudioToken             float64 `json:"output_cost_per_audio_token"` // 音频输出 token 价格（Realtime）
+	CacheReadInputAudioTokenCost        float64 `json:"cache_read_input_audio_token_cost"`
+
+	// 模型能力信息（用于模型目录展示，不参与计费）
+	MaxInputTokens          int  `json:"max_input_tokens,omitempty"`
+	MaxOutputTokens         int  `json:"max_output_tokens,omitempty"`
+	SupportsVision          bool `json:"supports_vision,omitempty"`
+	SupportsFunctionCalling bool `json:"supports_function_calling,omitempty"`
+	SupportsReasoning       bool `json:"supports_reasoning,omitempty"`
+	SupportsPDFInput        bool `json:"supports_pdf_input,omitempty"`
+}
+
+// liteLLMCapabilityEntry 解析 LiteLLM 条目中的能力字段。
+// 单独解析：能力字段类型异常时不影响价格条目本身。
+type liteLLMCapabilityEntry struct {
+	MaxInputTokens          int  `json:"max_input_tokens"`
+	MaxOutputTokens         int  `json:"max_output_tokens"`
+	MaxTokens               int  `json:"max_tokens"`
+	SupportsVision          bool `json:"supports_vision"`
+	SupportsFunctionCalling bool `json:"supports_function_calling"`
+	SupportsReasoning       bool `json:"supports_reasoning"`
+	SupportsPDFInput        bool `json:"supports_pdf_input"`
 }
 
 // PricingRemoteClient 远程价格数据获取接口
@@ -96,6 +119,9 @@ type LiteLLMRawEntry struct {
 	SupportsPromptCaching               bool     `json:"supports_prompt_caching"`
 	OutputCostPerImage                  *float64 `json:"output_cost_per_image"`
 	OutputCostPerImageToken             *float64 `json:"output_cost_per_image_token"`
+	InputCostPerAudioToken              *float64 `json:"input_cost_per_audio_token"`
+	OutputCostPerAudioToken             *float64 `json:"output_cost_per_audio_token"`
+	CacheReadInputAudioTokenCost        *float64 `json:"cache_read_input_audio_token_cost"`
 }
 
 // PricingService 动态价格服务
@@ -413,6 +439,28 @@ func (s *PricingService) parsePricingData(body []byte) (map[string]*LiteLLMModel
 		if entry.OutputCostPerImageToken != nil {
 			pricing.OutputCostPerImageToken = *entry.OutputCostPerImageToken
 		}
+		if entry.InputCostPerAudioToken != nil {
+			pricing.InputCostPerAudioToken = *entry.InputCostPerAudioToken
+		}
+		if entry.OutputCostPerAudioToken != nil {
+			pricing.OutputCostPerAudioToken = *entry.OutputCostPerAudioToken
+		}
+		if entry.CacheReadInputAudioTokenCost != nil {
+			pricing.CacheReadInputAudioTokenCost = *entry.CacheReadInputAudioTokenCost
+		}
+
+		var caps liteLLMCapabilityEntry
+		_ = json.Unmarshal(rawEntry, &caps) // 类型不匹配时保留已解析的字段
+		pricing.MaxInputTokens = caps.MaxInputTokens
+		pricing.MaxOutputTokens = caps.MaxOutputTokens
+		if pricing.MaxOutputTokens == 0 {
+			// LiteLLM 旧字段 max_tokens 语义为最大输出
+			pricing.MaxOutputTokens = caps.MaxTokens
+		}
+		pricing.SupportsVision = caps.SupportsVision
+		pricing.SupportsFunctionCalling = caps.SupportsFunctionCalling
+		pricing.SupportsReasoning = caps.SupportsReasoning
+		pricing.SupportsPDFInput = caps.SupportsPDFInput
 
 		result[modelName] = pricing
 	}
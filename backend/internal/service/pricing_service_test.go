@@ -35,6 +35,30 @@ func TestParsePricingData_ParsesPriorityAndServiceTierFields(t *testing.T) {
 	require.True(t, pricing.SupportsServiceTier)
 }
 
+func TestParsePricingData_ParsesAudioTokenFields(t *testing.T) {
+	svc := &PricingService{}
+	body := []byte(`{
+		"gpt-realtime": {
+			"input_cost_per_token": 0.000004,
+			"output_cost_per_token": 0.000016,
+			"input_cost_per_audio_token": 0.000032,
+			"output_cost_per_audio_token": 0.000064,
+			"cache_read_input_token_cost": 0.0000004,
+			"cache_read_input_audio_token_cost": 0.0000004,
+			"litellm_provider": "openai",
+			"mode": "chat"
+		}
+	}`)
+
+	data, err := svc.parsePricingData(body)
+	require.NoError(t, err)
+	pricing := data["gpt-realtime"]
+	require.NotNil(t, pricing)
+	require.InDelta(t, 3.2e-5, pricing.InputCostPerAudioToken, 1e-12)
+	require.InDelta(t, 6.4e-5, pricing.OutputCostPerAudioToken, 1e-12)
+	require.InDelta(t, 4e-7, pricing.CacheReadInputAudioTokenCost, 1e-12)
+}
+
 func TestGetModelPricing_Gpt53CodexSparkUsesGpt51CodexPricing(t *testing.T) {
 	sparkPricing := &LiteLLMModelPricing{InputCostPerToken: 1}
 	gpt53Pricing := &LiteLLMModelPricing{InputCostPerToken: 9}
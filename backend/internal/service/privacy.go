@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+)
+
+// 数据导出状态
+const (
+	DataExportStatusPending    = "pending"
+	DataExportStatusProcessing = "processing"
+	DataExportStatusReady      = "ready"
+	DataExportStatusFailed     = "failed"
+	DataExportStatusExpired    = "expired"
+)
+
+// 注销申请状态
+const (
+	DeletionStatusPending   = "pending"
+	DeletionStatusCancelled = "cancelled"
+	DeletionStatusCompleted = "completed"
+)
+
+// 导出包中的数据分区（同时也是 zip 内的文件名）
+const (
+	DataExportSectionProfile           = "profile"
+	DataExportSectionAttributes        = "attributes"
+	DataExportSectionAPIKeys           = "api_keys"
+	DataExportSectionUsageLogs         = "usage_logs"
+	DataExportSectionPaymentOrders     = "payment_orders"
+	DataExportSectionSubscriptions     = "subscriptions"
+	DataExportSectionAnnouncementReads = "announcement_reads"
+)
+
+// DataExportSections 导出包包含的全部数据分区（按写入顺序）
+var DataExportSections = []string{
+	DataExportSectionProfile,
+	DataExportSectionAttributes,
+	DataExportSectionAPIKeys,
+	DataExportSectionUsageLogs,
+	DataExportSectionPaymentOrders,
+	DataExportSectionSubscriptions,
+	DataExportSectionAnnouncementReads,
+}
+
+var (
+	ErrDataExportNotFound      = infraerrors.NotFound("DATA_EXPORT_NOT_FOUND", "data export not found")
+	ErrDataExportInProgress    = infraerrors.Conflict("DATA_EXPORT_IN_PROGRESS", "a data export is already in progress")
+	ErrDataExportRateLimited   = infraerrors.TooManyRequests("DATA_EXPORT_RATE_LIMITED", "data export was requested recently, please try again later")
+	ErrDataExportNotReady      = infraerrors.Conflict("DATA_EXPORT_NOT_READY", "data export is not ready")
+	ErrDataExportLinkInvalid   = infraerrors.Forbidden("DATA_EXPORT_LINK_INVALID", "download link is invalid or expired")
+	ErrDeletionRequestNotFound = infraerrors.NotFound("DELETION_REQUEST_NOT_FOUND", "no pending deletion request")
+	ErrDeletionRequestExists   = infraerrors.Conflict("DELETION_REQUEST_EXISTS", "a deletion request is already pending")
+	ErrDeletionAdminNotAllowed = infraerrors.Forbidden("DELETION_ADMIN_NOT_ALLOWED", "admin accounts cannot be deleted via self-service")
+	ErrDeletionReauthRequired  = infraerrors.Forbidden("DELETION_REAUTH_REQUIRED", "confirm your password or sign in again to request deletion")
+)
+
+// UserDataExport 用户数据导出任务
+type UserDataExport struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Status       string     `json:"status"`
+	FilePath     string     `json:"-"`
+	FileSize     int64      `json:"file_size"`
+	ErrorMessage string     `json:"error_message,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// DownloadURL 仅在 ready 状态下返回，为短时有效的签名链接
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+// AccountDeletionRequest 账号注销申请
+type AccountDeletionRequest struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason,omitempty"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// PrivacyRepository 数据导出与账号注销的数据访问接口
+type PrivacyRepository interface {
+	CreateExport(ctx context.Context, export *UserDataExport) error
+	GetExport(ctx context.Context, id int64) (*UserDataExport, error)
+	ListExports(ctx context.Context, userID int64, limit int) ([]UserDataExport, error)
+	// LatestExport 返回用户最近一次导出任务，不存在时返回 nil
+	LatestExport(ctx context.Context, userID int64) (*UserDataExport, error)
+	// ClaimPendingExport 领取一个待处理任务并标记为 processing（多实例安全），无任务时返回 nil
+	ClaimPendingExport(ctx context.Context) (*UserDataExport, error)
+	MarkExportReady(ctx context.Context, id int64, filePath string, fileSize int64, expiresAt time.Time) error
+	MarkExportFailed(ctx context.Context, id int64, message string) error
+	// RequeueStaleExports 将处理超时（实例崩溃等）的任务重新置为 pending
+	RequeueStaleExports(ctx context.Context, startedBefore time.Time) (int64, error)
+	ListExpiredExports(ctx context.Context, now time.Time, limit int) ([]UserDataExport, error)
+	MarkExportExpired(ctx context.Context, id int64) error
+	// StreamExportSection 逐行回调指定数据分区的 JSON 记录（敏感字段已在查询中脱敏）
+	StreamExportSection(ctx context.Context, userID int64, section string, fn func(row json.RawMessage) error) error
+
+	CreateDeletionRequest(ctx context.Context, req *AccountDeletionRequest) error
+	// GetPendingDeletion 返回用户待执行的注销申请，不存在时返回 nil
+	GetPendingDeletion(ctx context.Context, userID int64) (*AccountDeletionRequest, error)
+	CancelDeletionRequest(ctx context.Context, userID int64) (bool, error)
+	ListDueDeletions(ctx context.Context, now time.Time, limit int) ([]AccountDeletionRequest, error)
+	// AnonymizeUser 在单个事务中匿名化用户：清除个人信息、吊销 API Key，
+	// 保留 usage_logs / payment_orders 行（去除个人字段）以保证账单历史一致，并将申请标记为 completed。
+	AnonymizeUser(ctx context.Context, requestID, userID int64) error
+}
@@ -0,0 +1,620 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const (
+	// 同一用户两次导出之间的最短间隔（失败或已过期的任务除外）
+	dataExportCooldown = 24 * time.Hour
+	// processing 状态超过该时长视为实例中断，重新排队
+	dataExportStaleAfter   = 30 * time.Minute
+	dataExportTaskTimeout  = 20 * time.Minute
+	dataExportListLimit    = 20
+	privacyWorkerBatchSize = 20
+	deletionTaskTimeout    = 2 * time.Minute
+)
+
+type privacyUserReader interface {
+	GetByID(ctx context.Context, id int64) (*User, error)
+}
+
+type privacySessionRevoker interface {
+	DeleteUserRefreshTokens(ctx context.Context, userID int64) error
+}
+
+// RequestDeletionInput 账号注销申请
+type RequestDeletionInput struct {
+	Password string `json:"password"`
+	Reason   string `json:"reason"`
+	// AuthTime 当前会话的登录时间，由 handler 从 JWT 填入；
+	// 无本地密码的 OAuth/SSO 用户可通过近期重新登录完成确认
+	AuthTime time.Time `json:"-"`
+}
+
+// deletionReauthWindow 注销申请允许以近期登录代替密码确认的时间窗口
+const deletionReauthWindow = 10 * time.Minute
+
+// dataExportManifest 导出包内的 manifest.json
+type dataExportManifest struct {
+	UserID      int64          `json:"user_id"`
+	ExportID    int64          `json:"export_id"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Sections    map[string]int `json:"sections"`
+	Notes       []string       `json:"notes"`
+}
+
+// PrivacyService 用户自助数据导出与账号注销。
+// 导出任务异步生成 zip 并通过短时签名链接下载；注销申请经过冷静期后匿名化用户数据，
+// usage_logs / payment_orders 仅去除个人字段而不删除，保证账单与统计口径不变。
+type PrivacyService struct {
+	repo                 PrivacyRepository
+	userRepo             privacyUserReader
+	authCacheInvalidator APIKeyAuthCacheInvalidator
+	sessions             privacySessionRevoker
+	emailQueue           BudgetEmailQueue
+	settingRepo          SettingRepository
+	cfg                  config.PrivacyConfig
+	signingKey           []byte
+	now                  func() time.Time
+
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewPrivacyService 创建数据导出与注销服务
+func NewPrivacyService(
+	repo PrivacyRepository,
+	userRepo UserRepository,
+	authCacheInvalidator APIKeyAuthCacheInvalidator,
+	refreshTokenCache RefreshTokenCache,
+	emailQueue *EmailQueueService,
+	settingRepo SettingRepository,
+	cfg *config.Config,
+) *PrivacyService {
+	var queue BudgetEmailQueue
+	if emailQueue != nil {
+		queue = emailQueue
+	}
+	var sessions privacySessionRevoker
+	if refreshTokenCache != nil {
+		sessions = refreshTokenCache
+	}
+	return newPrivacyService(repo, userRepo, authCacheInvalidator, sessions, queue, settingRepo, cfg.Privacy, cfg.JWT.Secret)
+}
+
+func newPrivacyService(
+	repo PrivacyRepository,
+	userRepo privacyUserReader,
+	authCacheInvalidator APIKeyAuthCacheInvalidator,
+	sessions privacySessionRevoker,
+	emailQueue BudgetEmailQueue,
+	settingRepo SettingRepository,
+	cfg config.PrivacyConfig,
+	secret string,
+) *PrivacyService {
+	// 下载链接签名密钥由 JWT secret 派生，避免与 JWT 签名直接复用同一密钥
+	key := sha256.Sum256([]byte("sub2api-data-export:" + secret))
+	return &PrivacyService{
+		repo:                 repo,
+		userRepo:             userRepo,
+		authCacheInvalidator: authCacheInvalidator,
+		sessions:             sessions,
+		emailQueue:           emailQueue,
+		settingRepo:          settingRepo,
+		cfg:                  cfg,
+		signingKey:           key[:],
+		now:                  time.Now,
+		wakeCh:               make(chan struct{}, 1),
+		stopCh:               make(chan struct{}),
+	}
+}
+
+// ============================================
+// 数据导出
+// ============================================
+
+// RequestExport 创建数据导出任务（异步生成）
+func (s *PrivacyService) RequestExport(ctx context.Context, userID int64) (*UserDataExport, error) {
+	latest, err := s.repo.LatestExport(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		switch latest.Status {
+		case DataExportStatusPending, DataExportStatusProcessing:
+			return nil, ErrDataExportInProgress
+		case DataExportStatusReady:
+			if s.now().Sub(latest.CreatedAt) < dataExportCooldown {
+				return nil, ErrDataExportRateLimited
+			}
+		}
+	}
+
+	export := &UserDataExport{UserID: userID, Status: DataExportStatusPending}
+	if err := s.repo.CreateExport(ctx, export); err != nil {
+		return nil, err
+	}
+	s.wake()
+	return export, nil
+}
+
+// ListExports 返回用户的导出任务（ready 状态附带签名下载链接）
+func (s *PrivacyService) ListExports(ctx context.Context, userID int64) ([]UserDataExport, error) {
+	exports, err := s.repo.ListExports(ctx, userID, dataExportListLimit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range exports {
+		s.attachDownloadLink(&exports[i])
+	}
+	return exports, nil
+}
+
+// GetExport 返回单个导出任务
+func (s *PrivacyService) GetExport(ctx context.Context, userID, id int64) (*UserDataExport, error) {
+	export, err := s.repo.GetExport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if export.UserID != userID {
+		return nil, ErrDataExportNotFound
+	}
+	s.attachDownloadLink(export)
+	return export, nil
+}
+
+// ResolveDownload 校验签名链接并返回可下载的导出文件信息
+func (s *PrivacyService) ResolveDownload(ctx context.Context, id int64, expires int64, signature string) (*UserDataExport, error) {
+	if expires <= 0 || s.now().Unix() > expires {
+		return nil, ErrDataExportLinkInvalid
+	}
+	export, err := s.repo.GetExport(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrDataExportNotFound) {
+			return nil, ErrDataExportLinkInvalid
+		}
+		return nil, err
+	}
+	expected := s.sign(export.ID, export.UserID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, ErrDataExportLinkInvalid
+	}
+	if export.Status != DataExportStatusReady || export.ExpiresAt == nil || s.now().After(*export.ExpiresAt) {
+		return nil, ErrDataExportNotReady
+	}
+	if !s.isManagedPath(export.FilePath) {
+		return nil, ErrDataExportNotFound
+	}
+	if _, err := os.Stat(export.FilePath); err != nil {
+		return nil, ErrDataExportNotFound
+	}
+	return export, nil
+}
+
+// ExportFileName 下载时使用的文件名
+func ExportFileName(export *UserDataExport) string {
+	return fmt.Sprintf("sub2api-data-export-%d-%s.zip", export.UserID, export.CreatedAt.UTC().Format("20060102"))
+}
+
+func (s *PrivacyService) attachDownloadLink(export *UserDataExport) {
+	if export.Status != DataExportStatusReady || export.ExpiresAt == nil {
+		return
+	}
+	expiresAt := s.now().Add(time.Duration(s.cfg.DownloadLinkTTLMinutes) * time.Minute)
+	if expiresAt.After(*export.ExpiresAt) {
+		expiresAt = *export.ExpiresAt
+	}
+	if !expiresAt.After(s.now()) {
+		return
+	}
+	exp := expiresAt.Unix()
+	export.DownloadURL = fmt.Sprintf("/api/v1/data-exports/%d/download?expires=%d&sig=%s", export.ID, exp, s.sign(export.ID, export.UserID, exp))
+	t := time.Unix(exp, 0)
+	export.DownloadExpiresAt = &t
+}
+
+func (s *PrivacyService) sign(exportID, userID, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(strconv.FormatInt(exportID, 10) + ":" + strconv.FormatInt(userID, 10) + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *PrivacyService) isManagedPath(path string) bool {
+	if path == "" {
+		return false
+	}
+	dir, err := filepath.Abs(s.cfg.ExportDir)
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(abs, dir+string(filepath.Separator))
+}
+
+// generateExport 生成导出 zip：先写临时文件，完成后原子重命名
+func (s *PrivacyService) generateExport(ctx context.Context, export *UserDataExport) (string, int64, error) {
+	if err := os.MkdirAll(s.cfg.ExportDir, 0o700); err != nil {
+		return "", 0, fmt.Errorf("create export dir: %w", err)
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", 0, fmt.Errorf("generate file name: %w", err)
+	}
+	finalPath := filepath.Join(s.cfg.ExportDir, fmt.Sprintf("user-%d-export-%d-%s.zip", export.UserID, export.ID, hex.EncodeToString(suffix)))
+	tmpPath := finalPath + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", 0, fmt.Errorf("create export file: %w", err)
+	}
+	cleanup := func() {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+	}
+
+	zw := zip.NewWriter(f)
+	manifest := dataExportManifest{
+		UserID:      export.UserID,
+		ExportID:    export.ID,
+		GeneratedAt: s.now().UTC(),
+		Sections:    make(map[string]int, len(DataExportSections)),
+		Notes: []string{
+			"API keys are redacted; only a prefix and suffix are included.",
+			"Monetary amounts are in USD unless the payment order states otherwise.",
+		},
+	}
+	for _, section := range DataExportSections {
+		n, err := s.writeSection(ctx, zw, export.UserID, section)
+		if err != nil {
+			cleanup()
+			return "", 0, fmt.Errorf("export %s: %w", section, err)
+		}
+		manifest.Sections[section] = n
+	}
+	w, err := zw.Create("manifest.json")
+	if err == nil {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(manifest)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		cleanup()
+		return "", 0, fmt.Errorf("write export archive: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		cleanup()
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", 0, err
+	}
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", 0, err
+	}
+	return finalPath, info.Size(), nil
+}
+
+// writeSection 以 JSON 数组形式流式写入一个数据分区，返回记录数
+func (s *PrivacyService) writeSection(ctx context.Context, zw *zip.Writer, userID int64, section string) (int, error) {
+	w, err := zw.Create(section + ".json")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+	count := 0
+	err = s.repo.StreamExportSection(ctx, userID, section, func(row json.RawMessage) error {
+		sep := ",\n"
+		if count == 0 {
+			sep = "\n"
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(w, "\n]\n"); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ============================================
+// 账号注销
+// ============================================
+
+// RequestDeletion 提交注销申请，冷静期结束后执行匿名化
+func (s *PrivacyService) RequestDeletion(ctx context.Context, userID int64, input *RequestDeletionInput) (*AccountDeletionRequest, error) {
+	if input == nil {
+		return nil, ErrDeletionReauthRequired
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsAdmin() {
+		return nil, ErrDeletionAdminNotAllowed
+	}
+	// 提供密码时必须正确；否则要求会话是近期登录的（OAuth/SSO 用户没有可用的本地密码）
+	if input.Password != "" {
+		if !user.CheckPassword(input.Password) {
+			return nil, ErrPasswordIncorrect
+		}
+	} else if input.AuthTime.IsZero() || s.now().Sub(input.AuthTime) > deletionReauthWindow {
+		return nil, ErrDeletionReauthRequired
+	}
+
+	reason := strings.TrimSpace(input.Reason)
+	if len(reason) > 1000 {
+		reason = reason[:1000]
+	}
+	req := &AccountDeletionRequest{
+		UserID:      userID,
+		Status:      DeletionStatusPending,
+		Reason:      reason,
+		ScheduledAt: s.now().Add(time.Duration(s.cfg.DeletionGraceDays) * 24 * time.Hour),
+	}
+	if err := s.repo.CreateDeletionRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	s.notifyUser(ctx, user, "账号注销申请已提交 / Account deletion scheduled",
+		fmt.Sprintf("<p>您的账号将于 %s 注销。如需撤销，请在此之前登录并在账号设置中取消注销申请。</p><p>Your account is scheduled for deletion on %s. To cancel, sign in before then and withdraw the request from your account settings.</p>",
+			req.ScheduledAt.UTC().Format(time.RFC1123), req.ScheduledAt.UTC().Format(time.RFC1123)))
+	if s.cfg.DeletionGraceDays == 0 {
+		s.wake()
+	}
+	return req, nil
+}
+
+// GetPendingDeletion 返回待执行的注销申请
+func (s *PrivacyService) GetPendingDeletion(ctx context.Context, userID int64) (*AccountDeletionRequest, error) {
+	req, err := s.repo.GetPendingDeletion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, ErrDeletionRequestNotFound
+	}
+	return req, nil
+}
+
+// CancelDeletion 在冷静期内撤销注销申请
+func (s *PrivacyService) CancelDeletion(ctx context.Context, userID int64) error {
+	ok, err := s.repo.CancelDeletionRequest(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDeletionRequestNotFound
+	}
+	return nil
+}
+
+// executeDeletion 执行匿名化：删除导出文件、匿名化数据库记录并吊销登录态
+func (s *PrivacyService) executeDeletion(ctx context.Context, req *AccountDeletionRequest) error {
+	exports, err := s.repo.ListExports(ctx, req.UserID, dataExportListLimit)
+	if err != nil {
+		return err
+	}
+	for _, e := range exports {
+		s.removeExportFile(e.FilePath)
+	}
+	if err := s.repo.AnonymizeUser(ctx, req.ID, req.UserID); err != nil {
+		return err
+	}
+	if s.authCacheInvalidator != nil {
+		s.authCacheInvalidator.InvalidateAuthCacheByUserID(ctx, req.UserID)
+	}
+	if s.sessions != nil {
+		if err := s.sessions.DeleteUserRefreshTokens(ctx, req.UserID); err != nil {
+			logger.LegacyPrintf("service.privacy", "[Privacy] revoke sessions failed: user_id=%d err=%v", req.UserID, err)
+		}
+	}
+	return nil
+}
+
+func (s *PrivacyService) removeExportFile(path string) {
+	if !s.isManagedPath(path) {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.LegacyPrintf("service.privacy", "[Privacy] remove export file failed: %v", err)
+	}
+}
+
+func (s *PrivacyService) notifyUser(ctx context.Context, user *User, title, message string) {
+	if s.emailQueue == nil || user == nil || user.Email == "" {
+		return
+	}
+	siteName := defaultSiteName
+	if s.settingRepo != nil {
+		if name, err := s.settingRepo.GetValue(ctx, SettingKeySiteName); err == nil && name != "" {
+			siteName = name
+		}
+	}
+	subject := fmt.Sprintf("[%s] %s", sanitizeEmailHeader(siteName), title)
+	if err := s.emailQueue.EnqueueNotification(user.Email, subject, message); err != nil {
+		logger.LegacyPrintf("service.privacy", "[Privacy] enqueue notification failed: user_id=%d err=%v", user.ID, err)
+	}
+}
+
+// ============================================
+// 后台任务
+// ============================================
+
+// Start 启动后台任务：生成导出、清理过期文件、执行到期注销
+func (s *PrivacyService) Start() {
+	if s == nil || s.repo == nil {
+		return
+	}
+	interval := time.Duration(s.cfg.WorkerIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		s.runOnce()
+		for {
+			select {
+			case <-ticker.C:
+				s.runOnce()
+			case <-s.wakeCh:
+				s.runOnce()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台任务
+func (s *PrivacyService) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	s.wg.Wait()
+}
+
+func (s *PrivacyService) wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *PrivacyService) runOnce() {
+	s.processExports()
+	s.expireExports()
+	s.processDeletions()
+}
+
+func (s *PrivacyService) processExports() {
+	ctx := context.Background()
+	if n, err := s.repo.RequeueStaleExports(ctx, s.now().Add(-dataExportStaleAfter)); err != nil {
+		logger.LegacyPrintf("service.privacy", "[Privacy] requeue stale exports failed: %v", err)
+	} else if n > 0 {
+		logger.LegacyPrintf("service.privacy", "[Privacy] requeued %d stale exports", n)
+	}
+
+	for i := 0; i < privacyWorkerBatchSize; i++ {
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+		export, err := s.repo.ClaimPendingExport(ctx)
+		if err != nil {
+			logger.LegacyPrintf("service.privacy", "[Privacy] claim export failed: %v", err)
+			return
+		}
+		if export == nil {
+			return
+		}
+		s.processExport(export)
+	}
+}
+
+func (s *PrivacyService) processExport(export *UserDataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataExportTaskTimeout)
+	defer cancel()
+
+	path, size, err := s.generateExport(ctx, export)
+	if err != nil {
+		logger.LegacyPrintf("service.privacy", "[Privacy] export failed: id=%d user_id=%d err=%v", export.ID, export.UserID, err)
+		if markErr := s.repo.MarkExportFailed(ctx, export.ID, "export generation failed"); markErr != nil {
+			logger.LegacyPrintf("service.privacy", "[Privacy] mark export failed: id=%d err=%v", export.ID, markErr)
+		}
+		return
+	}
+	expiresAt := s.now().Add(time.Duration(s.cfg.ExportRetentionHours) * time.Hour)
+	if err := s.repo.MarkExportReady(ctx, export.ID, path, size, expiresAt); err != nil {
+		logger.LegacyPrintf("service.privacy", "[Privacy] mark export ready failed: id=%d err=%v", export.ID, err)
+		s.removeExportFile(path)
+		return
+	}
+	if s.userRepo != nil {
+		if user, err := s.userRepo.GetByID(ctx, export.UserID); err == nil {
+			s.notifyUser(ctx, user, "数据导出已就绪 / Your data export is ready",
+				fmt.Sprintf("<p>您申请的数据导出已生成，请在 %s 前登录下载。</p><p>Your data export is ready. Sign in to download it before %s.</p>",
+					expiresAt.UTC().Format(time.RFC1123), expiresAt.UTC().Format(time.RFC1123)))
+		}
+	}
+}
+
+func (s *PrivacyService) expireExports() {
+	ctx := context.Background()
+	exports, err := s.repo.ListExpiredExports(ctx, s.now(), privacyWorkerBatchSize)
+	if err != nil {
+		logger.LegacyPrintf("service.privacy", "[Privacy] list expired exports failed: %v", err)
+		return
+	}
+	for _, e := range exports {
+		s.removeExportFile(e.FilePath)
+		if err := s.repo.MarkExportExpired(ctx, e.ID); err != nil {
+			logger.LegacyPrintf("service.privacy", "[Privacy] mark export expired failed: id=%d err=%v", e.ID, err)
+		}
+	}
+}
+
+func (s *PrivacyService) processDeletions() {
+	ctx := context.Background()
+	due, err := s.repo.ListDueDeletions(ctx, s.now(), privacyWorkerBatchSize)
+	if err != nil {
+		logger.LegacyPrintf("service.privacy", "[Privacy] list due deletions failed: %v", err)
+		return
+	}
+	for i := range due {
+		taskCtx, cancel := context.WithTimeout(ctx, deletionTaskTimeout)
+		err := s.executeDeletion(taskCtx, &due[i])
+		cancel()
+		if err != nil {
+			logger.LegacyPrintf("service.privacy", "[Privacy] account deletion failed: user_id=%d err=%v", due[i].UserID, err)
+			continue
+		}
+		logger.LegacyPrintf("service.privacy", "[Privacy] account anonymized: user_id=%d", due[i].UserID)
+	}
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type privacyRepoStub struct {
+	exports    map[int64]*UserDataExport
+	deletions  map[int64]*AccountDeletionRequest
+	sections   map[string][]json.RawMessage
+	anonymized []int64
+	nextID     int64
+}
+
+func newPrivacyRepoStub() *privacyRepoStub {
+	return &privacyRepoStub{
+		exports:   map[int64]*UserDataExport{},
+		deletions: map[int64]*AccountDeletionRequest{},
+		sections:  map[string][]json.RawMessage{},
+	}
+}
+
+func (r *privacyRepoStub) CreateExport(_ context.Context, e *UserDataExport) error {
+	r.nextID++
+	e.ID = r.nextID
+	e.CreatedAt = time.Now()
+	cp := *e
+	r.exports[e.ID] = &cp
+	return nil
+}
+
+func (r *privacyRepoStub) GetExport(_ context.Context, id int64) (*UserDataExport, error) {
+	e, ok := r.exports[id]
+	if !ok {
+		return nil, ErrDataExportNotFound
+	}
+	cp := *e
+	return &cp, nil
+}
+
+func (r *privacyRepoStub) ListExports(_ context.Context, userID int64, _ int) ([]UserDataExport, error) {
+	var out []UserDataExport
+	for id := r.nextID; id > 0; id-- {
+		if e, ok := r.exports[id]; ok && e.UserID == userID {
+			out = append(out, *e)
+		}
+	}
+	return out, nil
+}
+
+func (r *privacyRepoStub) LatestExport(ctx context.Context, userID int64) (*UserDataExport, error) {
+	list, _ := r.ListExports(ctx, userID, 1)
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return &list[0], nil
+}
+
+func (r *privacyRepoStub) ClaimPendingExport(context.Context) (*UserDataExport, error) {
+	for id := int64(1); id <= r.nextID; id++ {
+		if e, ok := r.exports[id]; ok && e.Status == DataExportStatusPending {
+			e.Status = DataExportStatusProcessing
+			cp := *e
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *privacyRepoStub) MarkExportReady(_ context.Context, id int64, path string, size int64, expiresAt time.Time) error {
+	e := r.exports[id]
+	e.Status, e.FilePath, e.FileSize, e.ExpiresAt = DataExportStatusReady, path, size, &expiresAt
+	return nil
+}
+
+func (r *privacyRepoStub) MarkExportFailed(_ context.Context, id int64, msg string) error {
+	r.exports[id].Status, r.exports[id].ErrorMessage = DataExportStatusFailed, msg
+	return nil
+}
+
+func (r *privacyRepoStub) RequeueStaleExports(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *privacyRepoStub) ListExpiredExports(_ context.Context, now time.Time, _ int) ([]UserDataExport, error) {
+	var out []UserDataExport
+	for _, e := range r.exports {
+		if e.Status == DataExportStatusReady && e.ExpiresAt != nil && !e.ExpiresAt.After(now) {
+			out = append(out, *e)
+		}
+	}
+	return out, nil
+}
+
+func (r *privacyRepoStub) MarkExportExpired(_ context.Context, id int64) error {
+	r.exports[id].Status, r.exports[id].FilePath = DataExportStatusExpired, ""
+	return nil
+}
+
+func (r *privacyRepoStub) StreamExportSection(_ context.Context, _ int64, section string, fn func(json.RawMessage) error) error {
+	for _, row := range r.sections[section] {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *privacyRepoStub) CreateDeletionRequest(_ context.Context, d *AccountDeletionRequest) error {
+	if existing, ok := r.deletions[d.UserID]; ok && existing.Status == DeletionStatusPending {
+		return ErrDeletionRequestExists
+	}
+	r.nextID++
+	d.ID = r.nextID
+	cp := *d
+	r.deletions[d.UserID] = &cp
+	return nil
+}
+
+func (r *privacyRepoStub) GetPendingDeletion(_ context.Context, userID int64) (*AccountDeletionRequest, error) {
+	if d, ok := r.deletions[userID]; ok && d.Status == DeletionStatusPending {
+		cp := *d
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (r *privacyRepoStub) CancelDeletionRequest(_ context.Context, userID int64) (bool, error) {
+	if d, ok := r.deletions[userID]; ok && d.Status == DeletionStatusPending {
+		d.Status = DeletionStatusCancelled
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *privacyRepoStub) ListDueDeletions(_ context.Context, now time.Time, _ int) ([]AccountDeletionRequest, error) {
+	var out []AccountDeletionRequest
+	for _, d := range r.deletions {
+		if d.Status == DeletionStatusPending && !d.ScheduledAt.After(now) {
+			out = append(out, *d)
+		}
+	}
+	return out, nil
+}
+
+func (r *privacyRepoStub) AnonymizeUser(_ context.Context, _ int64, userID int64) error {
+	r.anonymized = append(r.anonymized, userID)
+	r.deletions[userID].Status = DeletionStatusCompleted
+	return nil
+}
+
+type privacyUserStub struct{ users map[int64]*User }
+
+func (s privacyUserStub) GetByID(_ context.Context, id int64) (*User, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
+
+type privacyInvalidatorStub struct{ userIDs []int64 }
+
+func (s *privacyInvalidatorStub) InvalidateAuthCacheByKey(context.Context, string)    {}
+func (s *privacyInvalidatorStub) InvalidateAuthCacheByGroupID(context.Context, int64) {}
+func (s *privacyInvalidatorStub) InvalidateAuthCacheByUserID(_ context.Context, id int64) {
+	s.userIDs = append(s.userIDs, id)
+}
+
+func newPrivacyServiceForTest(t *testing.T, repo *privacyRepoStub, users map[int64]*User, inv *privacyInvalidatorStub) *PrivacyService {
+	t.Helper()
+	cfg := config.PrivacyConfig{
+		ExportDir:              t.TempDir(),
+		ExportRetentionHours:   72,
+		DownloadLinkTTLMinutes: 30,
+		DeletionGraceDays:      14,
+		WorkerIntervalSeconds:  60,
+	}
+	var invalidator APIKeyAuthCacheInvalidator
+	if inv != nil {
+		invalidator = inv
+	}
+	return newPrivacyService(repo, privacyUserStub{users: users}, invalidator, nil, nil, nil, cfg, "test-secret")
+}
+
+func TestPrivacyService_RequestExportGuards(t *testing.T) {
+	repo := newPrivacyRepoStub()
+	svc := newPrivacyServiceForTest(t, repo, nil, nil)
+	ctx := context.Background()
+
+	export, err := svc.RequestExport(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, DataExportStatusPending, export.Status)
+
+	_, err = svc.RequestExport(ctx, 1)
+	require.ErrorIs(t, err, ErrDataExportInProgress)
+
+	repo.exports[export.ID].Status = DataExportStatusReady
+	_, err = svc.RequestExport(ctx, 1)
+	require.ErrorIs(t, err, ErrDataExportRateLimited)
+
+	repo.exports[export.ID].Status = DataExportStatusFailed
+	_, err = svc.RequestExport(ctx, 1)
+	require.NoError(t, err)
+}
+
+func TestPrivacyService_GenerateExportAndSignedDownload(t *testing.T) {
+	repo := newPrivacyRepoStub()
+	repo.sections[DataExportSectionProfile] = []json.RawMessage{json.RawMessage(`{"id":1,"email":"a@example.com"}`)}
+	repo.sections[DataExportSectionUsageLogs] = []json.RawMessage{
+		json.RawMessage(`{"id":10,"actual_cost":0.5}`),
+		json.RawMessage(`{"id":11,"actual_cost":0.25}`),
+	}
+	svc := newPrivacyServiceForTest(t, repo, nil, nil)
+	ctx := context.Background()
+
+	export, err := svc.RequestExport(ctx, 1)
+	require.NoError(t, err)
+	svc.processExports()
+
+	got, err := svc.GetExport(ctx, 1, export.ID)
+	require.NoError(t, err)
+	require.Equal(t, DataExportStatusReady, got.Status)
+	require.NotEmpty(t, got.DownloadURL)
+	_, err = svc.GetExport(ctx, 2, export.ID)
+	require.ErrorIs(t, err, ErrDataExportNotFound)
+
+	zr, err := zip.OpenReader(repo.exports[export.ID].FilePath)
+	require.NoError(t, err)
+	defer func() { _ = zr.Close() }()
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		files[f.Name] = string(data)
+	}
+	for _, section := range DataExportSections {
+		require.Contains(t, files, section+".json")
+	}
+	var logs []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(files["usage_logs.json"]), &logs))
+	require.Len(t, logs, 2)
+	var manifest dataExportManifest
+	require.NoError(t, json.Unmarshal([]byte(files["manifest.json"]), &manifest))
+	require.Equal(t, 2, manifest.Sections[DataExportSectionUsageLogs])
+	require.Equal(t, 0, manifest.Sections[DataExportSectionPaymentOrders])
+
+	u, err := url.Parse(got.DownloadURL)
+	require.NoError(t, err)
+	expires, _ := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	sig := u.Query().Get("sig")
+
+	resolved, err := svc.ResolveDownload(ctx, export.ID, expires, sig)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(ExportFileName(resolved), ".zip"))
+
+	_, err = svc.ResolveDownload(ctx, export.ID, expires+1, sig)
+	require.ErrorIs(t, err, ErrDataExportLinkInvalid)
+	svc.now = func() time.Time { return time.Unix(expires+1, 0) }
+	_, err = svc.ResolveDownload(ctx, export.ID, expires, sig)
+	require.ErrorIs(t, err, ErrDataExportLinkInvalid)
+
+	// 超过保留期后文件被清理
+	path := repo.exports[export.ID].FilePath
+	svc.now = func() time.Time { return time.Now().Add(73 * time.Hour) }
+	svc.expireExports()
+	require.Equal(t, DataExportStatusExpired, repo.exports[export.ID].Status)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestPrivacyService_DeletionFlow(t *testing.T) {
+	user := &User{ID: 1, Email: "a@example.com", Role: RoleUser}
+	require.NoError(t, user.SetPassword("correct-horse"))
+	admin := &User{ID: 2, Email: "admin@example.com", Role: RoleAdmin}
+	require.NoError(t, admin.SetPassword("admin-pass"))
+
+	repo := newPrivacyRepoStub()
+	inv := &privacyInvalidatorStub{}
+	svc := newPrivacyServiceForTest(t, repo, map[int64]*User{1: user, 2: admin}, inv)
+	ctx := context.Background()
+
+	_, err := svc.RequestDeletion(ctx, 1, &RequestDeletionInput{})
+	require.ErrorIs(t, err, ErrDeletionReauthRequired)
+	_, err = svc.RequestDeletion(ctx, 1, &RequestDeletionInput{AuthTime: time.Now().Add(-time.Hour)})
+	require.ErrorIs(t, err, ErrDeletionReauthRequired)
+	_, err = svc.RequestDeletion(ctx, 1, &RequestDeletionInput{Password: "wrong"})
+	require.ErrorIs(t, err, ErrPasswordIncorrect)
+	_, err = svc.RequestDeletion(ctx, 2, &RequestDeletionInput{Password: "admin-pass"})
+	require.ErrorIs(t, err, ErrDeletionAdminNotAllowed)
+
+	req, err := svc.RequestDeletion(ctx, 1, &RequestDeletionInput{Password: "correct-horse", Reason: "bye"})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(14*24*time.Hour), req.ScheduledAt, time.Minute)
+	_, err = svc.RequestDeletion(ctx, 1, &RequestDeletionInput{Password: "correct-horse"})
+	require.ErrorIs(t, err, ErrDeletionRequestExists)
+
+	// 冷静期内不执行，可撤销
+	svc.processDeletions()
+	require.Empty(t, repo.anonymized)
+	require.NoError(t, svc.CancelDeletion(ctx, 1))
+	require.ErrorIs(t, svc.CancelDeletion(ctx, 1), ErrDeletionRequestNotFound)
+
+	// 无本地密码的 OAuth/SSO 用户：近期登录即可确认
+	_, err = svc.RequestDeletion(ctx, 1, &RequestDeletionInput{AuthTime: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+	require.NoError(t, svc.CancelDeletion(ctx, 1))
+
+	// 冷静期结束后匿名化并删除导出文件
+	_, err = svc.RequestDeletion(ctx, 1, &RequestDeletionInput{Password: "correct-horse"})
+	require.NoError(t, err)
+	exportPath := filepath.Join(svc.cfg.ExportDir, "user-1-export-99-abc.zip")
+	require.NoError(t, os.WriteFile(exportPath, []byte("zip"), 0o600))
+	repo.exports[99] = &UserDataExport{ID: 99, UserID: 1, Status: DataExportStatusReady, FilePath: exportPath}
+	repo.nextID = 99
+
+	svc.now = func() time.Time { return time.Now().Add(15 * 24 * time.Hour) }
+	svc.processDeletions()
+	require.Equal(t, []int64{1}, repo.anonymized)
+	require.Equal(t, []int64{1}, inv.userIDs)
+	_, err = os.Stat(exportPath)
+	require.True(t, os.IsNotExist(err))
+	_, err = svc.GetPendingDeletion(ctx, 1)
+	require.ErrorIs(t, err, ErrDeletionRequestNotFound)
+}
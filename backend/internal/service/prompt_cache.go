@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/usagestats"
+	"github.com/tidwall/gjson"
+)
+
+// 自动缓存断点 TTL 模式
+const (
+	PromptCacheTTLAuto = "auto"
+	PromptCacheTTL5m   = "5m"
+	PromptCacheTTL1h   = "1h"
+)
+
+const (
+	defaultPromptCacheMinPrefixTokens = 1024
+	maxPromptCacheMinPrefixTokens     = 200000
+)
+
+var (
+	ErrInvalidPromptCacheTTL    = infraerrors.BadRequest("INVALID_PROMPT_CACHE_TTL", "ttl_mode must be auto, 5m or 1h")
+	ErrInvalidPromptCacheMinLen = infraerrors.BadRequest("INVALID_PROMPT_CACHE_MIN_PREFIX", "min_prefix_tokens must be between 0 and 200000")
+)
+
+// PromptCachePolicy 分组级自动缓存断点策略（opt-in，未配置的分组不做任何改写）
+type PromptCachePolicy struct {
+	GroupID         int64     `json:"group_id"`
+	Enabled         bool      `json:"enabled"`
+	TTLMode         string    `json:"ttl_mode"`
+	MinPrefixTokens int       `json:"min_prefix_tokens"`
+	CacheTools      bool      `json:"cache_tools"`
+	CacheSystem     bool      `json:"cache_system"`
+	CacheMessages   bool      `json:"cache_messages"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// DefaultPromptCachePolicy 返回分组的默认（未启用）策略
+func DefaultPromptCachePolicy(groupID int64) *PromptCachePolicy {
+	return &PromptCachePolicy{
+		GroupID:         groupID,
+		TTLMode:         PromptCacheTTLAuto,
+		MinPrefixTokens: defaultPromptCacheMinPrefixTokens,
+		CacheTools:      true,
+		CacheSystem:     true,
+		CacheMessages:   true,
+	}
+}
+
+// Normalize 规范化并校验策略
+func (p *PromptCachePolicy) Normalize() error {
+	p.TTLMode = strings.ToLower(strings.TrimSpace(p.TTLMode))
+	switch p.TTLMode {
+	case "":
+		p.TTLMode = PromptCacheTTLAuto
+	case PromptCacheTTLAuto, PromptCacheTTL5m, PromptCacheTTL1h:
+	default:
+		return ErrInvalidPromptCacheTTL
+	}
+	if p.MinPrefixTokens < 0 || p.MinPrefixTokens > maxPromptCacheMinPrefixTokens {
+		return ErrInvalidPromptCacheMinLen
+	}
+	return nil
+}
+
+// PromptCacheInjection 单次请求的断点注入结果，随 ForwardResult 传递到计费阶段
+type PromptCacheInjection struct {
+	Breakpoints int
+	// TTL 为 1h 表示静态前缀（tools/system）使用了 1h 断点；对话前缀始终为 5m
+	TTL string
+}
+
+// PromptCacheSavingsRecord 单次注入请求的缓存节省记录
+type PromptCacheSavingsRecord struct {
+	RequestID             string
+	UserID                int64
+	APIKeyID              int64
+	AccountID             int64
+	GroupID               *int64
+	Model                 string
+	TTL                   string
+	Breakpoints           int
+	CacheReadTokens       int
+	CacheCreation5mTokens int
+	CacheCreation1hTokens int
+	SavedCost             float64
+	ActualSavedCost       float64
+	CreatedAt             time.Time
+}
+
+// PromptCacheRepository 自动缓存断点策略与节省记录存储
+type PromptCacheRepository interface {
+	ListPolicies(ctx context.Context) ([]*PromptCachePolicy, error)
+	UpsertPolicy(ctx context.Context, policy *PromptCachePolicy) error
+	DeletePolicy(ctx context.Context, groupID int64) error
+	InsertSavings(ctx context.Context, record *PromptCacheSavingsRecord) error
+	// SumSavings 按 user/api_key/account/group/model 与时间范围汇总（忽略其他 usage 过滤条件）
+	SumSavings(ctx context.Context, filters usagestats.UsageLogFilters) (*usagestats.PromptCacheSavingsStats, error)
+}
+
+// promptCacheInjectOptions 注入参数（由策略与 TTL 决策得出）
+type promptCacheInjectOptions struct {
+	StaticTTL       string
+	MinPrefixTokens int
+	CacheTools      bool
+	CacheSystem     bool
+	CacheMessages   bool
+}
+
+// promptCacheCandidate 候选断点位置；prefixBytes 为该断点之前（含）的请求前缀大小
+type promptCacheCandidate struct {
+	apply       func(body []byte, cacheControl string) ([]byte, bool)
+	prefixBytes int
+	static      bool
+}
+
+// estimatePromptTokens 粗略估算前缀 token 数（JSON 字节数 / 4）
+func estimatePromptTokens(bytes int) int {
+	return bytes / 4
+}
+
+func promptCacheControlJSON(ttl string) string {
+	if ttl == PromptCacheTTL1h {
+		return `{"type":"ephemeral","ttl":"1h"}`
+	}
+	return `{"type":"ephemeral"}`
+}
+
+// countCacheControlBreakpoints 统计请求中已有的 cache_control 断点（tools / system / messages）
+func countCacheControlBreakpoints(body []byte) int {
+	count := 0
+	gjson.GetBytes(body, "tools").ForEach(func(_, tool gjson.Result) bool {
+		if tool.Get("cache_control").Exists() {
+			count++
+		}
+		return true
+	})
+	_, messagePaths, systemPaths := collectCacheControlPaths(body)
+	return count + len(messagePaths) + len(systemPaths)
+}
+
+// injectPromptCacheBreakpoints 为未声明缓存的请求注入 cache_control 断点。
+//
+// 候选位置（按请求顺序）：tools 末尾、system 末尾、上一轮 user 消息、最后一条消息。
+// 优先级为：最后一条消息 > system > tools > 上一轮 user 消息。
+// 客户端已自行声明任何断点时不做注入：新增的 5m 断点可能落在客户端 1h 断点之前，
+// 形成上游拒绝的 TTL 顺序，且客户端的缓存布局应当被原样尊重。
+func injectPromptCacheBreakpoints(body []byte, opts promptCacheInjectOptions) ([]byte, *PromptCacheInjection) {
+	if countCacheControlBreakpoints(body) > 0 {
+		return body, nil
+	}
+	budget := maxCacheControlBlocks
+	staticTTL := opts.StaticTTL
+	if staticTTL != PromptCacheTTL1h {
+		staticTTL = PromptCacheTTL5m
+	}
+
+	tools := gjson.GetBytes(body, "tools")
+	system := gjson.GetBytes(body, "system")
+	messages := gjson.GetBytes(body, "messages")
+
+	prefix := 0
+	var toolsCandidate, systemCandidate, prevCandidate, lastCandidate *promptCacheCandidate
+
+	if tools.IsArray() {
+		prefix += len(tools.Raw)
+		if opts.CacheTools {
+			if items := tools.Array(); len(items) > 0 && items[len(items)-1].IsObject() && !items[len(items)-1].Get("cache_control").Exists() {
+				path := "tools." + strconv.Itoa(len(items)-1) + ".cache_control"
+				toolsCandidate = &promptCacheCandidate{
+					prefixBytes: prefix,
+					static:      true,
+					apply: func(b []byte, cc string) ([]byte, bool) {
+						return setJSONRawBytes(b, path, []byte(cc))
+					},
+				}
+			}
+		}
+	}
+
+	if system.Exists() && system.Type != gjson.Null {
+		prefix += len(system.Raw)
+		if opts.CacheSystem {
+			systemCandidate = systemCacheCandidate(system, prefix)
+		}
+	}
+
+	if opts.CacheMessages && messages.IsArray() {
+		items := messages.Array()
+		offsets := make([]int, len(items))
+		running := prefix
+		for i, msg := range items {
+			running += len(msg.Raw)
+			offsets[i] = running
+		}
+		if n := len(items); n > 0 {
+			lastCandidate = messageCacheCandidate(items[n-1], n-1, offsets[n-1])
+			for i := n - 2; i >= 0; i-- {
+				if items[i].Get("role").String() == "user" {
+					prevCandidate = messageCacheCandidate(items[i], i, offsets[i])
+					break
+				}
+			}
+		}
+	}
+
+	injection := &PromptCacheInjection{TTL: PromptCacheTTL5m}
+	for _, candidate := range []*promptCacheCandidate{lastCandidate, systemCandidate, toolsCandidate, prevCandidate} {
+		if budget <= 0 {
+			break
+		}
+		if candidate == nil || estimatePromptTokens(candidate.prefixBytes) < opts.MinPrefixTokens {
+			continue
+		}
+		ttl := PromptCacheTTL5m
+		if candidate.static {
+			ttl = staticTTL
+		}
+		next, ok := candidate.apply(body, promptCacheControlJSON(ttl))
+		if !ok {
+			continue
+		}
+		body = next
+		budget--
+		injection.Breakpoints++
+		if ttl == PromptCacheTTL1h {
+			injection.TTL = PromptCacheTTL1h
+		}
+	}
+	if injection.Breakpoints == 0 {
+		return body, nil
+	}
+	return body, injection
+}
+
+func systemCacheCandidate(system gjson.Result, prefix int) *promptCacheCandidate {
+	switch {
+	case system.Type == gjson.String:
+		text := system.String()
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		return &promptCacheCandidate{
+			prefixBytes: prefix,
+			static:      true,
+			apply: func(b []byte, cc string) ([]byte, bool) {
+				raw := cacheableTextBlockArray(text, cc)
+				if raw == nil {
+					return b, false
+				}
+				return setJSONRawBytes(b, "system", raw)
+			},
+		}
+	case system.IsArray():
+		items := system.Array()
+		idx := lastCacheableBlockIndex(items)
+		if idx < 0 || items[idx].Get("cache_control").Exists() {
+			return nil
+		}
+		path := "system." + strconv.Itoa(idx) + ".cache_control"
+		return &promptCacheCandidate{
+			prefixBytes: prefix,
+			static:      true,
+			apply: func(b []byte, cc string) ([]byte, bool) {
+				return setJSONRawBytes(b, path, []byte(cc))
+			},
+		}
+	}
+	return nil
+}
+
+func messageCacheCandidate(msg gjson.Result, index int, prefix int) *promptCacheCandidate {
+	content := msg.Get("content")
+	base := "messages." + strconv.Itoa(index) + ".content"
+	switch {
+	case content.Type == gjson.String:
+		text := content.String()
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		return &promptCacheCandidate{
+			prefixBytes: prefix,
+			apply: func(b []byte, cc string) ([]byte, bool) {
+				raw := cacheableTextBlockArray(text, cc)
+				if raw == nil {
+					return b, false
+				}
+				return setJSONRawBytes(b, base, raw)
+			},
+		}
+	case content.IsArray():
+		items := content.Array()
+		idx := lastCacheableBlockIndex(items)
+		if idx < 0 || items[idx].Get("cache_control").Exists() {
+			return nil
+		}
+		path := base + "." + strconv.Itoa(idx) + ".cache_control"
+		return &promptCacheCandidate{
+			prefixBytes: prefix,
+			apply: func(b []byte, cc string) ([]byte, bool) {
+				return setJSONRawBytes(b, path, []byte(cc))
+			},
+		}
+	}
+	return nil
+}
+
+// lastCacheableBlockIndex 返回最后一个可以携带 cache_control 的内容块（跳过 thinking 与空文本块）
+func lastCacheableBlockIndex(items []gjson.Result) int {
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if !item.IsObject() {
+			continue
+		}
+		switch item.Get("type").String() {
+		case "thinking", "redacted_thinking":
+			continue
+		case "text":
+			if strings.TrimSpace(item.Get("text").String()) == "" {
+				continue
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+func cacheableTextBlockArray(text string, cacheControl string) []byte {
+	block, err := marshalAnthropicSystemTextBlock(text, false)
+	if err != nil {
+		return nil
+	}
+	out, ok := setJSONRawBytes(block, "cache_control", []byte(cacheControl))
+	if !ok {
+		return nil
+	}
+	return append(append([]byte{'['}, out...), ']')
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/usagestats"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	promptCachePolicyCacheTTL = 30 * time.Second
+
+	// 静态前缀复用间隔的 EWMA 落在 (5m, 1h] 时改用 1h TTL：
+	// 间隔小于 5m 时 5m 缓存会被持续续期，超过 1h 时两种 TTL 都无法命中，写入更便宜的 5m 即可。
+	promptCacheReuseAlpha    = 0.3
+	promptCacheReuseMaxKeys  = 10000
+	promptCacheReuseIdleDrop = 2 * time.Hour
+	promptCache5mWindow      = 5 * time.Minute
+	promptCache1hWindow      = time.Hour
+)
+
+// PromptCacheService 分组级自动缓存断点
+//
+//   - 策略保存在 group_prompt_cache_policies 表中，进程内整表缓存；
+//   - 仅对启用策略的分组、Anthropic 平台账号的请求改写请求体；
+//   - auto 模式下按静态前缀（tools + system）的实际复用间隔在 5m / 1h 之间选择；
+//   - 注入过断点的请求在计费后记录缓存节省，并汇总到 usage 统计中。
+//
+// 复用观测是实例级的，多实例部署时各实例独立决策。
+type PromptCacheService struct {
+	repo           PromptCacheRepository
+	groupRepo      GroupRepository
+	billingService *BillingService
+	now            func() time.Time
+
+	policyMu     sync.RWMutex
+	policies     map[int64]*PromptCachePolicy
+	policiesAt   time.Time
+	policyReload sync.Mutex
+
+	reuseMu sync.Mutex
+	reuse   map[string]*promptCacheReuse
+}
+
+// promptCacheReuse 单个静态前缀的复用观测
+type promptCacheReuse struct {
+	lastSeen time.Time
+	ewmaGap  time.Duration
+	gaps     int
+}
+
+// NewPromptCacheService 创建自动缓存断点服务
+func NewPromptCacheService(repo PromptCacheRepository, groupRepo GroupRepository, billingService *BillingService) *PromptCacheService {
+	return &PromptCacheService{
+		repo:           repo,
+		groupRepo:      groupRepo,
+		billingService: billingService,
+		now:            time.Now,
+		reuse:          make(map[string]*promptCacheReuse),
+	}
+}
+
+// policyFor 返回分组的已启用策略（未配置或未启用时返回 nil）
+func (s *PromptCacheService) policyFor(ctx context.Context, groupID *int64) *PromptCachePolicy {
+	if s == nil || s.repo == nil || groupID == nil || *groupID <= 0 {
+		return nil
+	}
+	s.policyMu.RLock()
+	policies, loadedAt := s.policies, s.policiesAt
+	s.policyMu.RUnlock()
+
+	if policies == nil || s.now().Sub(loadedAt) >= promptCachePolicyCacheTTL {
+		// 只允许一个请求回源，其他请求继续使用旧缓存
+		if s.policyReload.TryLock() {
+			s.reloadPolicies(ctx)
+			s.policyReload.Unlock()
+			s.policyMu.RLock()
+			policies = s.policies
+			s.policyMu.RUnlock()
+		}
+	}
+	if policy := policies[*groupID]; policy != nil && policy.Enabled {
+		return policy
+	}
+	return nil
+}
+
+func (s *PromptCacheService) reloadPolicies(ctx context.Context) {
+	list, err := s.repo.ListPolicies(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.prompt_cache", "Warning: load prompt cache policies failed: %v", err)
+		s.policyMu.Lock()
+		// 失败时推迟下一次回源，避免每个请求都打到数据库
+		if s.policies == nil {
+			s.policies = map[int64]*PromptCachePolicy{}
+		}
+		s.policiesAt = s.now()
+		s.policyMu.Unlock()
+		return
+	}
+	policies := make(map[int64]*PromptCachePolicy, len(list))
+	for _, p := range list {
+		if p != nil {
+			policies[p.GroupID] = p
+		}
+	}
+	s.policyMu.Lock()
+	s.policies = policies
+	s.policiesAt = s.now()
+	s.policyMu.Unlock()
+}
+
+func (s *PromptCacheService) invalidatePolicies() {
+	s.policyMu.Lock()
+	s.policies = nil
+	s.policyMu.Unlock()
+}
+
+// Apply 按分组策略为请求体注入缓存断点；未启用或无需注入时原样返回 body 与 nil
+func (s *PromptCacheService) Apply(ctx context.Context, groupID *int64, model string, body []byte) ([]byte, *PromptCacheInjection) {
+	policy := s.policyFor(ctx, groupID)
+	if policy == nil || len(body) == 0 {
+		return body, nil
+	}
+	opts := promptCacheInjectOptions{
+		StaticTTL:       s.chooseStaticTTL(policy, *groupID, model, body),
+		MinPrefixTokens: policy.MinPrefixTokens,
+		CacheTools:      policy.CacheTools,
+		CacheSystem:     policy.CacheSystem,
+		CacheMessages:   policy.CacheMessages,
+	}
+	return injectPromptCacheBreakpoints(body, opts)
+}
+
+// chooseStaticTTL 按策略选择静态前缀 TTL；auto 模式下基于该前缀的历史复用间隔
+func (s *PromptCacheService) chooseStaticTTL(policy *PromptCachePolicy, groupID int64, model string, body []byte) string {
+	switch policy.TTLMode {
+	case PromptCacheTTL5m, PromptCacheTTL1h:
+		return policy.TTLMode
+	}
+	if !(policy.CacheTools || policy.CacheSystem) {
+		return PromptCacheTTL5m
+	}
+	tools := gjson.GetBytes(body, "tools").Raw
+	system := gjson.GetBytes(body, "system").Raw
+	if tools == "" && system == "" {
+		return PromptCacheTTL5m
+	}
+	h := sha256.New()
+	_, _ = h.Write([]byte(strconv.FormatInt(groupID, 10)))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(model))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(tools))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(system))
+	return s.observeReuse(hex.EncodeToString(h.Sum(nil)))
+}
+
+// observeReuse 记录一次静态前缀出现并返回推荐 TTL
+func (s *PromptCacheService) observeReuse(key string) string {
+	now := s.now()
+	s.reuseMu.Lock()
+	defer s.reuseMu.Unlock()
+
+	entry := s.reuse[key]
+	if entry == nil {
+		if len(s.reuse) >= promptCacheReuseMaxKeys {
+			s.pruneReuseLocked(now)
+		}
+		s.reuse[key] = &promptCacheReuse{lastSeen: now}
+		return PromptCacheTTL5m
+	}
+	gap := now.Sub(entry.lastSeen)
+	entry.lastSeen = now
+	if entry.gaps == 0 {
+		entry.ewmaGap = gap
+	} else {
+		entry.ewmaGap = time.Duration(promptCacheReuseAlpha*float64(gap) + (1-promptCacheReuseAlpha)*float64(entry.ewmaGap))
+	}
+	entry.gaps++
+	if entry.ewmaGap > promptCache5mWindow && entry.ewmaGap <= promptCache1hWindow {
+		return PromptCacheTTL1h
+	}
+	return PromptCacheTTL5m
+}
+
+func (s *PromptCacheService) pruneReuseLocked(now time.Time) {
+	for key, entry := range s.reuse {
+		if now.Sub(entry.lastSeen) > promptCacheReuseIdleDrop {
+			delete(s.reuse, key)
+		}
+	}
+	if len(s.reuse) >= promptCacheReuseMaxKeys {
+		s.reuse = make(map[string]*promptCacheReuse)
+	}
+}
+
+// promptCacheSavedCost 计算相对无缓存的净节省：读取节省 - 写入溢价（按标准价，未乘倍率）
+func promptCacheSavedCost(pricing *ModelPricing, usage ClaudeUsage) float64 {
+	if pricing == nil {
+		return 0
+	}
+	input := pricing.InputPricePerToken
+	saved := float64(usage.CacheReadInputTokens) * (input - pricing.CacheReadPricePerToken)
+
+	c5m, c1h := usage.CacheCreation5mTokens, usage.CacheCreation1hTokens
+	if c5m == 0 && c1h == 0 {
+		c5m = usage.CacheCreationInputTokens
+	}
+	price5m, price1h := pricing.CacheCreation5mPrice, pricing.CacheCreation1hPrice
+	if !pricing.SupportsCacheBreakdown || price5m <= 0 {
+		price5m = pricing.CacheCreationPricePerToken
+	}
+	if !pricing.SupportsCacheBreakdown || price1h <= 0 {
+		price1h = pricing.CacheCreationPricePerToken
+	}
+	saved -= float64(c5m) * (price5m - input)
+	saved -= float64(c1h) * (price1h - input)
+	return saved
+}
+
+// RecordSavings 记录一次注入请求的缓存节省（best-effort）
+func (s *PromptCacheService) RecordSavings(ctx context.Context, injection *PromptCacheInjection, usageLog *UsageLog, usage ClaudeUsage, billingModel string) {
+	if s == nil || s.repo == nil || injection == nil || usageLog == nil {
+		return
+	}
+	var pricing *ModelPricing
+	if s.billingService != nil {
+		p, err := s.billingService.GetModelPricing(billingModel)
+		if err != nil {
+			logger.LegacyPrintf("service.prompt_cache", "Warning: prompt cache savings pricing unavailable: model=%s err=%v", billingModel, err)
+		}
+		pricing = p
+	}
+	saved := promptCacheSavedCost(pricing, usage)
+	record := &PromptCacheSavingsRecord{
+		RequestID:             usageLog.RequestID,
+		UserID:                usageLog.UserID,
+		APIKeyID:              usageLog.APIKeyID,
+		AccountID:             usageLog.AccountID,
+		GroupID:               usageLog.GroupID,
+		Model:                 usageLog.Model,
+		TTL:                   injection.TTL,
+		Breakpoints:           injection.Breakpoints,
+		CacheReadTokens:       usage.CacheReadInputTokens,
+		CacheCreation5mTokens: usage.CacheCreation5mTokens,
+		CacheCreation1hTokens: usage.CacheCreation1hTokens,
+		SavedCost:             saved,
+		ActualSavedCost:       saved * usageLog.RateMultiplier,
+		CreatedAt:             usageLog.CreatedAt,
+	}
+	if err := s.repo.InsertSavings(ctx, record); err != nil {
+		logger.LegacyPrintf("service.prompt_cache", "Warning: record prompt cache savings failed: request_id=%s err=%v", record.RequestID, err)
+	}
+}
+
+// SumSavings 汇总缓存节省
+func (s *PromptCacheService) SumSavings(ctx context.Context, filters usagestats.UsageLogFilters) (*usagestats.PromptCacheSavingsStats, error) {
+	if s == nil || s.repo == nil {
+		return nil, nil
+	}
+	return s.repo.SumSavings(ctx, filters)
+}
+
+// GetPolicy 获取分组策略（未配置时返回默认的未启用策略）
+func (s *PromptCacheService) GetPolicy(ctx context.Context, groupID int64) (*PromptCachePolicy, error) {
+	list, err := s.repo.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p != nil && p.GroupID == groupID {
+			return p, nil
+		}
+	}
+	return DefaultPromptCachePolicy(groupID), nil
+}
+
+// SetPolicy 创建或更新分组策略
+func (s *PromptCacheService) SetPolicy(ctx context.Context, policy *PromptCachePolicy) (*PromptCachePolicy, error) {
+	if err := policy.Normalize(); err != nil {
+		return nil, err
+	}
+	if s.groupRepo != nil {
+		if _, err := s.groupRepo.GetByIDLite(ctx, policy.GroupID); err != nil {
+			if errors.Is(err, ErrGroupNotFound) {
+				return nil, ErrGroupNotFound
+			}
+			return nil, fmt.Errorf("get group: %w", err)
+		}
+	}
+	policy.UpdatedAt = s.now()
+	if err := s.repo.UpsertPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+	s.invalidatePolicies()
+	return policy, nil
+}
+
+// DeletePolicy 删除分组策略（恢复为不注入）
+func (s *PromptCacheService) DeletePolicy(ctx context.Context, groupID int64) error {
+	if err := s.repo.DeletePolicy(ctx, groupID); err != nil {
+		return err
+	}
+	s.invalidatePolicies()
+	return nil
+}
@@ -0,0 +1,208 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/usagestats"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+type promptCacheRepoStub struct {
+	policies  []*PromptCachePolicy
+	savings   []*PromptCacheSavingsRecord
+	listCalls int
+}
+
+func (r *promptCacheRepoStub) ListPolicies(ctx context.Context) ([]*PromptCachePolicy, error) {
+	r.listCalls++
+	return r.policies, nil
+}
+
+func (r *promptCacheRepoStub) UpsertPolicy(ctx context.Context, policy *PromptCachePolicy) error {
+	r.policies = append(r.policies, policy)
+	return nil
+}
+
+func (r *promptCacheRepoStub) DeletePolicy(ctx context.Context, groupID int64) error {
+	return nil
+}
+
+func (r *promptCacheRepoStub) InsertSavings(ctx context.Context, record *PromptCacheSavingsRecord) error {
+	r.savings = append(r.savings, record)
+	return nil
+}
+
+func (r *promptCacheRepoStub) SumSavings(ctx context.Context, filters usagestats.UsageLogFilters) (*usagestats.PromptCacheSavingsStats, error) {
+	return &usagestats.PromptCacheSavingsStats{Requests: int64(len(r.savings))}, nil
+}
+
+func promptCacheTestBody() []byte {
+	long := strings.Repeat("lorem ipsum ", 100)
+	return []byte(`{"model":"claude-sonnet-4-5","tools":[{"name":"a","input_schema":{}},{"name":"b","input_schema":{}}],` +
+		`"system":"` + long + `",` +
+		`"messages":[{"role":"user","content":"first"},{"role":"assistant","content":"ok"},` +
+		`{"role":"user","content":[{"type":"text","text":"second"}]}]}`)
+}
+
+func allPromptCacheOptions(ttl string) promptCacheInjectOptions {
+	return promptCacheInjectOptions{StaticTTL: ttl, CacheTools: true, CacheSystem: true, CacheMessages: true}
+}
+
+func TestInjectPromptCacheBreakpoints_AllSegments(t *testing.T) {
+	body, injection := injectPromptCacheBreakpoints(promptCacheTestBody(), allPromptCacheOptions(PromptCacheTTL1h))
+	require.NotNil(t, injection)
+	require.Equal(t, 4, injection.Breakpoints)
+	require.Equal(t, PromptCacheTTL1h, injection.TTL)
+
+	require.Equal(t, "1h", gjson.GetBytes(body, "tools.1.cache_control.ttl").String())
+	require.False(t, gjson.GetBytes(body, "tools.0.cache_control").Exists())
+	require.True(t, gjson.GetBytes(body, "system").IsArray())
+	require.Equal(t, "1h", gjson.GetBytes(body, "system.0.cache_control.ttl").String())
+	require.Equal(t, "ephemeral", gjson.GetBytes(body, "messages.2.content.0.cache_control.type").String())
+	require.False(t, gjson.GetBytes(body, "messages.2.content.0.cache_control.ttl").Exists())
+	require.Equal(t, "first", gjson.GetBytes(body, "messages.0.content.0.text").String())
+	require.True(t, gjson.GetBytes(body, "messages.0.content.0.cache_control").Exists())
+	require.Equal(t, maxCacheControlBlocks, countCacheControlBreakpoints(body))
+}
+
+func TestInjectPromptCacheBreakpoints_SkipsClientBreakpoints(t *testing.T) {
+	long := strings.Repeat("x", 6000)
+	// 客户端在 system 上声明了 1h 断点；若再注入 tools 的 5m 断点会排在其之前，上游会拒绝
+	body := []byte(`{"tools":[{"name":"t","input_schema":{}}],` +
+		`"system":[{"type":"text","text":"` + long + `","cache_control":{"type":"ephemeral","ttl":"1h"}}],` +
+		`"messages":[{"role":"user","content":"hi"}]}`)
+
+	out, injection := injectPromptCacheBreakpoints(body, allPromptCacheOptions(PromptCacheTTL5m))
+	require.Nil(t, injection)
+	require.Equal(t, body, out)
+	require.False(t, gjson.GetBytes(out, "tools.0.cache_control").Exists())
+	require.Equal(t, 1, countCacheControlBreakpoints(out))
+}
+
+func TestInjectPromptCacheBreakpoints_SkipsShortPrefixAndThinking(t *testing.T) {
+	_, injection := injectPromptCacheBreakpoints(promptCacheTestBody(), promptCacheInjectOptions{
+		StaticTTL: PromptCacheTTL5m, MinPrefixTokens: 100000, CacheTools: true, CacheSystem: true, CacheMessages: true,
+	})
+	require.Nil(t, injection)
+
+	body := []byte(`{"system":"` + strings.Repeat("s", 8000) + `","messages":[{"role":"user","content":"q"},` +
+		`{"role":"assistant","content":[{"type":"text","text":"answer"},{"type":"thinking","thinking":"hmm","signature":"x"}]}]}`)
+	out, injection := injectPromptCacheBreakpoints(body, promptCacheInjectOptions{
+		StaticTTL: PromptCacheTTL5m, MinPrefixTokens: 1024, CacheMessages: true,
+	})
+	require.NotNil(t, injection)
+	require.True(t, gjson.GetBytes(out, "messages.1.content.0.cache_control").Exists())
+	require.False(t, gjson.GetBytes(out, "messages.1.content.1.cache_control").Exists())
+	require.Equal(t, gjson.String, gjson.GetBytes(out, "system").Type)
+}
+
+func TestPromptCacheService_ChoosesTTLFromReuse(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := NewPromptCacheService(nil, nil, nil)
+	svc.now = func() time.Time { return now }
+
+	require.Equal(t, PromptCacheTTL5m, svc.observeReuse("slow"))
+	now = now.Add(10 * time.Minute)
+	require.Equal(t, PromptCacheTTL1h, svc.observeReuse("slow"))
+
+	require.Equal(t, PromptCacheTTL5m, svc.observeReuse("fast"))
+	now = now.Add(time.Minute)
+	require.Equal(t, PromptCacheTTL5m, svc.observeReuse("fast"))
+
+	// 复用间隔超过 1h 时两种 TTL 都无法命中，保持 5m
+	require.Equal(t, PromptCacheTTL5m, svc.observeReuse("rare"))
+	now = now.Add(3 * time.Hour)
+	require.Equal(t, PromptCacheTTL5m, svc.observeReuse("rare"))
+
+	policy := DefaultPromptCachePolicy(1)
+	policy.TTLMode = PromptCacheTTL1h
+	require.Equal(t, PromptCacheTTL1h, svc.chooseStaticTTL(policy, 1, "m", promptCacheTestBody()))
+}
+
+func TestPromptCacheService_ApplyRequiresEnabledPolicy(t *testing.T) {
+	repo := &promptCacheRepoStub{policies: []*PromptCachePolicy{
+		{GroupID: 1, Enabled: true, TTLMode: PromptCacheTTL5m, CacheTools: true, CacheSystem: true, CacheMessages: true},
+		{GroupID: 2, Enabled: false, TTLMode: PromptCacheTTL5m, CacheTools: true, CacheSystem: true, CacheMessages: true},
+	}}
+	svc := NewPromptCacheService(repo, nil, nil)
+	ctx := context.Background()
+	body := promptCacheTestBody()
+
+	group1, group2 := int64(1), int64(2)
+	_, injection := svc.Apply(ctx, &group1, "claude-sonnet-4-5", body)
+	require.NotNil(t, injection)
+	require.Equal(t, PromptCacheTTL5m, injection.TTL)
+
+	out, injection := svc.Apply(ctx, &group2, "claude-sonnet-4-5", body)
+	require.Nil(t, injection)
+	require.Equal(t, body, out)
+
+	_, injection = svc.Apply(ctx, nil, "claude-sonnet-4-5", body)
+	require.Nil(t, injection)
+	require.Equal(t, 1, repo.listCalls)
+
+	var nilSvc *PromptCacheService
+	_, injection = nilSvc.Apply(ctx, &group1, "claude-sonnet-4-5", body)
+	require.Nil(t, injection)
+}
+
+func TestPromptCacheSavedCost(t *testing.T) {
+	pricing := &ModelPricing{
+		InputPricePerToken:     3e-6,
+		CacheReadPricePerToken: 0.3e-6,
+		CacheCreation5mPrice:   3.75e-6,
+		CacheCreation1hPrice:   6e-6,
+		SupportsCacheBreakdown: true,
+	}
+	saved := promptCacheSavedCost(pricing, ClaudeUsage{
+		CacheReadInputTokens:  10000,
+		CacheCreation5mTokens: 1000,
+		CacheCreation1hTokens: 1000,
+	})
+	require.InDelta(t, 10000*2.7e-6-1000*0.75e-6-1000*3e-6, saved, 1e-12)
+
+	// 首次写入没有读取命中，净节省为负
+	saved = promptCacheSavedCost(pricing, ClaudeUsage{CacheCreationInputTokens: 2000})
+	require.InDelta(t, -2000*0.75e-6, saved, 1e-12)
+	require.Zero(t, promptCacheSavedCost(nil, ClaudeUsage{CacheReadInputTokens: 1}))
+}
+
+func TestPromptCacheService_RecordSavings(t *testing.T) {
+	repo := &promptCacheRepoStub{}
+	svc := NewPromptCacheService(repo, nil, nil)
+	groupID := int64(3)
+	usageLog := &UsageLog{RequestID: "req-1", UserID: 1, APIKeyID: 2, AccountID: 4, GroupID: &groupID, Model: "m", RateMultiplier: 2}
+
+	svc.RecordSavings(context.Background(), &PromptCacheInjection{Breakpoints: 2, TTL: PromptCacheTTL1h}, usageLog,
+		ClaudeUsage{CacheReadInputTokens: 100, CacheCreation1hTokens: 50}, "m")
+	require.Len(t, repo.savings, 1)
+	record := repo.savings[0]
+	require.Equal(t, "req-1", record.RequestID)
+	require.Equal(t, PromptCacheTTL1h, record.TTL)
+	require.Equal(t, 2, record.Breakpoints)
+	require.Equal(t, 100, record.CacheReadTokens)
+	require.Equal(t, 50, record.CacheCreation1hTokens)
+	require.InDelta(t, record.SavedCost*2, record.ActualSavedCost, 1e-12)
+
+	svc.RecordSavings(context.Background(), nil, usageLog, ClaudeUsage{}, "m")
+	require.Len(t, repo.savings, 1)
+}
+
+func TestPromptCachePolicy_Normalize(t *testing.T) {
+	policy := &PromptCachePolicy{TTLMode: " 1H "}
+	require.NoError(t, policy.Normalize())
+	require.Equal(t, PromptCacheTTL1h, policy.TTLMode)
+
+	policy = &PromptCachePolicy{}
+	require.NoError(t, policy.Normalize())
+	require.Equal(t, PromptCacheTTLAuto, policy.TTLMode)
+
+	require.ErrorIs(t, (&PromptCachePolicy{TTLMode: "1d"}).Normalize(), ErrInvalidPromptCacheTTL)
+	require.ErrorIs(t, (&PromptCachePolicy{MinPrefixTokens: -1}).Normalize(), ErrInvalidPromptCacheMinLen)
+}
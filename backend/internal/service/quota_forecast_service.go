@@ -0,0 +1,368 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+)
+
+const (
+	quotaWindow5h = "5h"
+	quotaWindow7d = "7d"
+
+	// 单个窗口最多保留的采样点数量
+	quotaSeriesMaxSamples = 32
+	// 采样跨度不足该值时不计算消耗速率，避免两次相邻采样放大噪声
+	quotaMinBurnRateSpan = time.Minute
+	// 重置时间差异超过该值视为进入了新窗口
+	quotaResetTolerance = time.Minute
+	// 重置时间分桶粒度：同一桶内视为同时重置，交给 LRU 打散
+	quotaResetBucket = 30 * time.Minute
+	// 清理过期序列的最小间隔
+	quotaForecastPruneInterval = 10 * time.Minute
+)
+
+// QuotaForecast 单个账号的额度耗尽预测结果
+type QuotaForecast struct {
+	// Pressure 额度压力（0-1）：0 表示按当前速率在窗口重置前不会耗尽，1 表示应当排空
+	Pressure float64
+	// ResetsAt 最早的额度窗口重置时间（未知时为 nil）
+	ResetsAt *time.Time
+}
+
+// LoadPenalty 将额度压力换算为负载率惩罚（0-100），与 AccountLoadInfo.LoadRate 同一量纲
+func (f QuotaForecast) LoadPenalty() int {
+	return int(math.Round(clamp01(f.Pressure) * 100))
+}
+
+// resetBucket 返回重置时间所在的分桶序号，未知时返回 false
+func (f QuotaForecast) resetBucket() (int64, bool) {
+	if f.ResetsAt == nil {
+		return 0, false
+	}
+	return f.ResetsAt.Unix() / int64(quotaResetBucket/time.Second), true
+}
+
+func (f *QuotaForecast) merge(pressure float64, resetsAt time.Time, now time.Time) {
+	if pressure > f.Pressure {
+		f.Pressure = pressure
+	}
+	if resetsAt.IsZero() || !resetsAt.After(now) {
+		return
+	}
+	if f.ResetsAt == nil || resetsAt.Before(*f.ResetsAt) {
+		t := resetsAt
+		f.ResetsAt = &t
+	}
+}
+
+type quotaSeriesKey struct {
+	accountID int64
+	window    string
+}
+
+type quotaSample struct {
+	at          time.Time
+	utilization float64
+}
+
+type quotaSeries struct {
+	samples  []quotaSample
+	resetsAt time.Time
+	lastSeen time.Time
+}
+
+// burnRate 返回采样窗口内的平均消耗速率（百分点/秒），数据不足时返回 0
+func (sr *quotaSeries) burnRate() float64 {
+	if sr == nil || len(sr.samples) < 2 {
+		return 0
+	}
+	first, last := sr.samples[0], sr.samples[len(sr.samples)-1]
+	span := last.at.Sub(first.at)
+	if span < quotaMinBurnRateSpan {
+		return 0
+	}
+	rate := (last.utilization - first.utilization) / span.Seconds()
+	if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return 0
+	}
+	return rate
+}
+
+// quotaWindowSnapshot 从账号快照中解析出的单个额度窗口
+type quotaWindowSnapshot struct {
+	window      string
+	utilization float64 // 0-100
+	resetsAt    time.Time
+	sampledAt   time.Time
+}
+
+// QuotaForecastService 订阅账号额度耗尽预测。
+//
+// 调度器只有在账号被限流后才会避开它；该服务根据近期消耗速率与窗口重置时间估算
+// 每个账号的耗尽时间（time-to-exhaustion），输出 0-1 的额度压力供调度器降权，
+// 使接近耗尽的账号被逐步排空，而不是把单个账号打到 100% 再触发 429。
+//
+// 采样来源：
+//   - Claude OAuth/SetupToken：响应头被动采样写入的 5h/7d utilization（Account.Extra）
+//   - Codex OAuth：codex_5h/7d_* 用量快照（Account.Extra）
+//   - Antigravity：AccountUsageService 拉取到的分模型额度
+//
+// 采样数据仅保存在进程内存中，重启后从账号快照重新积累。
+type QuotaForecastService struct {
+	enabled        bool
+	burnRateWindow time.Duration
+	drainStart     float64
+	drainFull      float64
+
+	mu        sync.Mutex
+	series    map[quotaSeriesKey]*quotaSeries
+	lastPrune time.Time
+}
+
+// NewQuotaForecastService 创建额度预测服务
+func NewQuotaForecastService(cfg *config.Config) *QuotaForecastService {
+	s := &QuotaForecastService{
+		enabled:        true,
+		burnRateWindow: 30 * time.Minute,
+		drainStart:     80,
+		drainFull:      95,
+		series:         make(map[quotaSeriesKey]*quotaSeries),
+	}
+	if cfg != nil {
+		qf := cfg.Gateway.Scheduling.QuotaForecast
+		s.enabled = qf.Enabled
+		if qf.BurnRateWindow > 0 {
+			s.burnRateWindow = qf.BurnRateWindow
+		}
+		if qf.DrainFullPercent > 0 && qf.DrainStartPercent >= 0 && qf.DrainStartPercent < qf.DrainFullPercent {
+			s.drainStart = qf.DrainStartPercent
+			s.drainFull = qf.DrainFullPercent
+		}
+	}
+	return s
+}
+
+// Forecast 计算账号当前的额度压力。
+// 对 Claude/Codex 账号会顺带把快照中的最新采样纳入消耗速率统计；requestedModel 用于 Antigravity 分模型额度。
+func (s *QuotaForecastService) Forecast(account *Account, requestedModel string, now time.Time) QuotaForecast {
+	var out QuotaForecast
+	if s == nil || !s.enabled || account == nil {
+		return out
+	}
+	snapshots := quotaWindowSnapshotsFromAccount(account, now)
+	isAntigravity := account.Platform == PlatformAntigravity && requestedModel != ""
+	if len(snapshots) == 0 && !isAntigravity {
+		return out
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maybePruneLocked(now)
+
+	for _, snap := range snapshots {
+		key := quotaSeriesKey{accountID: account.ID, window: snap.window}
+		if !snap.sampledAt.IsZero() {
+			s.observeLocked(key, snap.utilization, snap.resetsAt, snap.sampledAt)
+		}
+		out.merge(s.windowPressure(snap.utilization, s.series[key].burnRate(), snap.resetsAt, now), snap.resetsAt, now)
+	}
+
+	// Antigravity 额度不在账号快照中，由 AccountUsageService 拉取后写入，按模型维度预测
+	if isAntigravity {
+		if sr := s.series[quotaSeriesKey{accountID: account.ID, window: antigravityQuotaWindow(requestedModel)}]; sr != nil && len(sr.samples) > 0 {
+			last := sr.samples[len(sr.samples)-1]
+			out.merge(s.windowPressure(last.utilization, sr.burnRate(), sr.resetsAt, now), sr.resetsAt, now)
+		}
+	}
+	return out
+}
+
+// ObserveAntigravityQuota 记录一次 Antigravity 分模型额度采样
+func (s *QuotaForecastService) ObserveAntigravityQuota(accountID int64, quota map[string]*AntigravityModelQuota, sampledAt time.Time) {
+	if s == nil || !s.enabled || len(quota) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for model, q := range quota {
+		if q == nil || model == "" {
+			continue
+		}
+		var resetsAt time.Time
+		if q.ResetTime != "" {
+			if t, err := parseTime(q.ResetTime); err == nil {
+				resetsAt = t
+			}
+		}
+		s.observeLocked(quotaSeriesKey{accountID: accountID, window: antigravityQuotaWindow(model)}, float64(q.Utilization), resetsAt, sampledAt)
+	}
+}
+
+func (s *QuotaForecastService) observeLocked(key quotaSeriesKey, utilization float64, resetsAt time.Time, sampledAt time.Time) {
+	sr := s.series[key]
+	if sr == nil {
+		sr = &quotaSeries{}
+		s.series[key] = sr
+	}
+
+	// 窗口已滚动：旧采样不再代表当前窗口的消耗
+	if !resetsAt.IsZero() && !sr.resetsAt.IsZero() && absDuration(resetsAt.Sub(sr.resetsAt)) > quotaResetTolerance {
+		sr.samples = sr.samples[:0]
+	}
+	if !resetsAt.IsZero() {
+		sr.resetsAt = resetsAt
+	}
+	if sampledAt.After(sr.lastSeen) {
+		sr.lastSeen = sampledAt
+	}
+
+	if n := len(sr.samples); n > 0 {
+		last := sr.samples[n-1]
+		if !sampledAt.After(last.at) {
+			return // 同一快照重复读取
+		}
+		if utilization < last.utilization-0.5 {
+			// 使用率回落（窗口重置或上游修正），重新开始统计
+			sr.samples = sr.samples[:0]
+		}
+	}
+	sr.samples = append(sr.samples, quotaSample{at: sampledAt, utilization: utilization})
+
+	cutoff := sampledAt.Add(-s.burnRateWindow)
+	drop := 0
+	for drop < len(sr.samples)-1 && sr.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	if over := len(sr.samples) - drop - quotaSeriesMaxSamples; over > 0 {
+		drop += over
+	}
+	if drop > 0 {
+		sr.samples = append(sr.samples[:0], sr.samples[drop:]...)
+	}
+}
+
+// windowPressure 计算单个窗口的额度压力：
+//   - 使用率在 [drainStart, drainFull] 区间内线性升高，达到 drainFull 即完全排空；
+//   - 若按当前消耗速率会在窗口重置前达到 drainFull，则压力为 1 - 耗尽时间/重置剩余时间。
+func (s *QuotaForecastService) windowPressure(utilization, burnRate float64, resetsAt time.Time, now time.Time) float64 {
+	if !resetsAt.IsZero() && !now.Before(resetsAt) {
+		return 0 // 窗口已重置，快照中的使用率已失效
+	}
+	if utilization >= s.drainFull {
+		return 1
+	}
+	pressure := 0.0
+	if utilization > s.drainStart {
+		pressure = (utilization - s.drainStart) / (s.drainFull - s.drainStart)
+	}
+	if burnRate > 0 && !resetsAt.IsZero() {
+		timeToExhaust := (s.drainFull - utilization) / burnRate
+		timeToReset := resetsAt.Sub(now).Seconds()
+		if timeToExhaust < timeToReset {
+			pressure = math.Max(pressure, 1-timeToExhaust/timeToReset)
+		}
+	}
+	return clamp01(pressure)
+}
+
+func (s *QuotaForecastService) maybePruneLocked(now time.Time) {
+	if now.Sub(s.lastPrune) < quotaForecastPruneInterval {
+		return
+	}
+	s.lastPrune = now
+	staleBefore := now.Add(-s.burnRateWindow)
+	for key, sr := range s.series {
+		if sr.lastSeen.Before(staleBefore) && (sr.resetsAt.IsZero() || sr.resetsAt.Before(now)) {
+			delete(s.series, key)
+		}
+	}
+}
+
+// quotaWindowSnapshotsFromAccount 从账号快照（Extra / 会话窗口字段）解析订阅额度窗口
+func quotaWindowSnapshotsFromAccount(account *Account, now time.Time) []quotaWindowSnapshot {
+	switch {
+	case account.IsAnthropicOAuthOrSetupToken():
+		return anthropicQuotaWindowSnapshots(account, now)
+	case account.IsOpenAIOAuth():
+		return codexQuotaWindowSnapshots(account, now)
+	}
+	return nil
+}
+
+func anthropicQuotaWindowSnapshots(account *Account, now time.Time) []quotaWindowSnapshot {
+	var sampledAt time.Time
+	if raw, ok := account.Extra["passive_usage_sampled_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			sampledAt = t
+		}
+	}
+
+	var out []quotaWindowSnapshot
+	if end := account.SessionWindowEnd; end != nil && now.Before(*end) {
+		snap := quotaWindowSnapshot{window: quotaWindow5h, resetsAt: *end, sampledAt: sampledAt}
+		found := true
+		if raw, ok := account.Extra["session_window_utilization"]; ok && raw != nil {
+			snap.utilization = parseExtraFloat64(raw) * 100
+		} else {
+			// 与 estimateSetupTokenUsage 一致：没有真实 utilization 时按窗口状态估算
+			switch account.SessionWindowStatus {
+			case "rejected":
+				snap.utilization = 100
+			case "allowed_warning":
+				snap.utilization = 80
+			default:
+				found = false
+			}
+			snap.sampledAt = time.Time{}
+		}
+		if found {
+			out = append(out, snap)
+		}
+	}
+	if raw, ok := account.Extra["passive_usage_7d_utilization"]; ok && raw != nil {
+		snap := quotaWindowSnapshot{window: quotaWindow7d, utilization: parseExtraFloat64(raw) * 100, sampledAt: sampledAt}
+		if reset := parseExtraFloat64(account.Extra["passive_usage_7d_reset"]); reset > 0 {
+			snap.resetsAt = time.Unix(int64(reset), 0)
+		}
+		out = append(out, snap)
+	}
+	return out
+}
+
+func codexQuotaWindowSnapshots(account *Account, now time.Time) []quotaWindowSnapshot {
+	var sampledAt time.Time
+	if raw, ok := account.Extra["codex_usage_updated_at"]; ok {
+		if t, err := parseTime(fmt.Sprint(raw)); err == nil {
+			sampledAt = t
+		}
+	}
+
+	var out []quotaWindowSnapshot
+	for _, window := range []string{quotaWindow5h, quotaWindow7d} {
+		progress := buildCodexUsageProgressFromExtra(account.Extra, window, now)
+		if progress == nil {
+			continue
+		}
+		snap := quotaWindowSnapshot{window: window, utilization: progress.Utilization, sampledAt: sampledAt}
+		if progress.ResetsAt != nil {
+			snap.resetsAt = *progress.ResetsAt
+		}
+		out = append(out, snap)
+	}
+	return out
+}
+
+func antigravityQuotaWindow(model string) string {
+	return "model:" + model
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
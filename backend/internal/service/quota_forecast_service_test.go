@@ -0,0 +1,215 @@
+//go:build unit
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newAnthropicQuotaTestAccount(id int64, windowEnd time.Time, util5h float64, sampledAt time.Time) *Account {
+	return &Account{
+		ID:               id,
+		Platform:         PlatformAnthropic,
+		Type:             AccountTypeOAuth,
+		SessionWindowEnd: &windowEnd,
+		Extra: map[string]any{
+			"session_window_utilization": util5h,
+			"passive_usage_sampled_at":   sampledAt.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+func TestQuotaForecast_NoQuotaWindows(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	now := time.Now()
+
+	apiKey := &Account{ID: 1, Platform: PlatformAnthropic, Type: AccountTypeAPIKey}
+	f := svc.Forecast(apiKey, "claude-sonnet-4-5", now)
+	require.Zero(t, f.Pressure)
+	require.Nil(t, f.ResetsAt)
+
+	var nilSvc *QuotaForecastService
+	require.Zero(t, nilSvc.Forecast(apiKey, "", now).Pressure)
+}
+
+func TestQuotaForecast_UtilizationRamp(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	now := time.Now()
+	end := now.Add(3 * time.Hour)
+
+	low := svc.Forecast(newAnthropicQuotaTestAccount(1, end, 0.5, now), "", now)
+	require.Zero(t, low.Pressure)
+	require.NotNil(t, low.ResetsAt)
+	require.True(t, low.ResetsAt.Equal(end))
+
+	mid := svc.Forecast(newAnthropicQuotaTestAccount(2, end, 0.875, now), "", now)
+	require.InDelta(t, 0.5, mid.Pressure, 1e-9)
+	require.Equal(t, 50, mid.LoadPenalty())
+
+	full := svc.Forecast(newAnthropicQuotaTestAccount(3, end, 0.96, now), "", now)
+	require.Equal(t, 1.0, full.Pressure)
+	require.Equal(t, 100, full.LoadPenalty())
+}
+
+func TestQuotaForecast_BurnRateBeforeReset(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := base.Add(3 * time.Hour)
+
+	account := newAnthropicQuotaTestAccount(1, end, 0.10, base)
+	require.Zero(t, svc.Forecast(account, "", base).Pressure)
+
+	// 10 分钟内从 10% 涨到 30%：2%/min，剩余 65% 约 32.5 分钟耗尽，远早于 ~170 分钟后的重置
+	now := base.Add(10 * time.Minute)
+	account.Extra["session_window_utilization"] = 0.30
+	account.Extra["passive_usage_sampled_at"] = now.Format(time.RFC3339)
+	f := svc.Forecast(account, "", now)
+	timeToReset := end.Sub(now).Seconds()
+	require.InDelta(t, 1-(32.5*60)/timeToReset, f.Pressure, 1e-6)
+
+	// 重复读取同一快照不会产生新的采样
+	again := svc.Forecast(account, "", now.Add(time.Second))
+	require.InDelta(t, f.Pressure, again.Pressure, 0.01)
+}
+
+func TestQuotaForecast_SlowBurnWithSoonResetHasNoPressure(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := base.Add(40 * time.Minute)
+
+	account := newAnthropicQuotaTestAccount(1, end, 0.40, base)
+	svc.Forecast(account, "", base)
+
+	now := base.Add(10 * time.Minute)
+	account.Extra["session_window_utilization"] = 0.45
+	account.Extra["passive_usage_sampled_at"] = now.Format(time.RFC3339)
+	require.Zero(t, svc.Forecast(account, "", now).Pressure)
+}
+
+func TestQuotaForecast_UtilizationDropResetsSeries(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	base := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := base.Add(3 * time.Hour)
+
+	account := newAnthropicQuotaTestAccount(1, end, 0.10, base)
+	svc.Forecast(account, "", base)
+	t1 := base.Add(10 * time.Minute)
+	account.Extra["session_window_utilization"] = 0.50
+	account.Extra["passive_usage_sampled_at"] = t1.Format(time.RFC3339)
+	require.Positive(t, svc.Forecast(account, "", t1).Pressure)
+
+	t2 := base.Add(20 * time.Minute)
+	account.Extra["session_window_utilization"] = 0.05
+	account.Extra["passive_usage_sampled_at"] = t2.Format(time.RFC3339)
+	require.Zero(t, svc.Forecast(account, "", t2).Pressure)
+}
+
+func TestQuotaForecast_ExpiredWindowIgnored(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	now := time.Now()
+	account := &Account{
+		ID:       1,
+		Platform: PlatformAnthropic,
+		Type:     AccountTypeOAuth,
+		Extra: map[string]any{
+			"passive_usage_7d_utilization": 0.99,
+			"passive_usage_7d_reset":       now.Add(-time.Minute).Unix(),
+		},
+	}
+	f := svc.Forecast(account, "", now)
+	require.Zero(t, f.Pressure)
+	require.Nil(t, f.ResetsAt)
+}
+
+func TestQuotaForecast_CodexSnapshot(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	now := time.Now()
+	reset5h := now.Add(2 * time.Hour).UTC().Truncate(time.Second)
+	reset7d := now.Add(72 * time.Hour).UTC().Truncate(time.Second)
+	account := &Account{
+		ID:       1,
+		Platform: PlatformOpenAI,
+		Type:     AccountTypeOAuth,
+		Extra: map[string]any{
+			"codex_5h_used_percent":  20.0,
+			"codex_5h_reset_at":      reset5h.Format(time.RFC3339),
+			"codex_7d_used_percent":  97.0,
+			"codex_7d_reset_at":      reset7d.Format(time.RFC3339),
+			"codex_usage_updated_at": now.UTC().Format(time.RFC3339),
+		},
+	}
+	f := svc.Forecast(account, "gpt-5", now)
+	require.Equal(t, 1.0, f.Pressure)
+	require.NotNil(t, f.ResetsAt)
+	require.True(t, f.ResetsAt.Equal(reset5h))
+}
+
+func TestQuotaForecast_AntigravityPerModel(t *testing.T) {
+	svc := NewQuotaForecastService(nil)
+	now := time.Now()
+	svc.ObserveAntigravityQuota(7, map[string]*AntigravityModelQuota{
+		"claude-sonnet-4-5": {Utilization: 96, ResetTime: now.Add(time.Hour).UTC().Format(time.RFC3339)},
+		"gemini-3-pro":      {Utilization: 10, ResetTime: now.Add(time.Hour).UTC().Format(time.RFC3339)},
+	}, now)
+
+	account := &Account{ID: 7, Platform: PlatformAntigravity, Type: AccountTypeOAuth}
+	require.Equal(t, 1.0, svc.Forecast(account, "claude-sonnet-4-5", now).Pressure)
+	require.Zero(t, svc.Forecast(account, "gemini-3-pro", now).Pressure)
+	require.Zero(t, svc.Forecast(account, "unknown-model", now).Pressure)
+}
+
+func TestQuotaForecast_Disabled(t *testing.T) {
+	cfg := &config.Config{}
+	svc := NewQuotaForecastService(cfg)
+	now := time.Now()
+	account := newAnthropicQuotaTestAccount(1, now.Add(time.Hour), 0.99, now)
+	f := svc.Forecast(account, "", now)
+	require.Zero(t, f.Pressure)
+	require.Nil(t, f.ResetsAt)
+}
+
+func TestFilterBySoonestQuotaReset(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(time.Hour)
+	later := now.Add(4 * time.Hour)
+
+	t.Run("prefers soonest reset, keeps accounts without quota windows", func(t *testing.T) {
+		accounts := []accountWithLoad{
+			{account: &Account{ID: 1}, loadInfo: &AccountLoadInfo{}, quota: QuotaForecast{ResetsAt: &later}},
+			{account: &Account{ID: 2}, loadInfo: &AccountLoadInfo{}, quota: QuotaForecast{ResetsAt: &soon}},
+			{account: &Account{ID: 3}, loadInfo: &AccountLoadInfo{}},
+		}
+		result := filterBySoonestQuotaReset(accounts)
+		require.Len(t, result, 2)
+		require.Equal(t, int64(2), result[0].account.ID)
+		require.Equal(t, int64(3), result[1].account.ID)
+	})
+
+	t.Run("no quota windows keeps all", func(t *testing.T) {
+		accounts := []accountWithLoad{
+			{account: &Account{ID: 1}, loadInfo: &AccountLoadInfo{}},
+			{account: &Account{ID: 2}, loadInfo: &AccountLoadInfo{}},
+		}
+		require.Len(t, filterBySoonestQuotaReset(accounts), 2)
+	})
+}
+
+func TestFilterByMinLoadRate_QuotaPressureDrainsAccount(t *testing.T) {
+	accounts := []accountWithLoad{
+		{account: &Account{ID: 1}, loadInfo: &AccountLoadInfo{LoadRate: 10}, quota: QuotaForecast{Pressure: 0.5}},
+		{account: &Account{ID: 2}, loadInfo: &AccountLoadInfo{LoadRate: 40}},
+	}
+	result := filterByMinLoadRate(accounts)
+	require.Len(t, result, 1)
+	require.Equal(t, int64(2), result[0].account.ID)
+
+	// 压力较小时仍然优先负载更低的账号，实现逐步排空
+	accounts[0].quota.Pressure = 0.2
+	result = filterByMinLoadRate(accounts)
+	require.Len(t, result, 1)
+	require.Equal(t, int64(1), result[0].account.ID)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+)
+
+var (
+	ErrRecoveryCodeInvalid        = infraerrors.BadRequest("RECOVERY_CODE_INVALID", "invalid or already used recovery code")
+	ErrRecoveryCodeNoSecondFactor = infraerrors.BadRequest("RECOVERY_CODE_NO_SECOND_FACTOR", "enable totp or register a passkey before generating recovery codes")
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet 去掉了易混淆的 0/1/i/l/o
+	recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+	recoveryCodeHalfLen  = 5
+)
+
+// RecoveryCodeRepository 恢复码存储，只保存 SHA-256 摘要
+type RecoveryCodeRepository interface {
+	// Replace 删除用户全部旧恢复码并写入新的一组
+	Replace(ctx context.Context, userID int64, codeHashes []string) error
+	// Consume 将匹配且未使用的恢复码标记为已使用；返回是否命中
+	Consume(ctx context.Context, userID int64, codeHash string) (bool, error)
+	CountRemaining(ctx context.Context, userID int64) (int, error)
+	DeleteAll(ctx context.Context, userID int64) error
+}
+
+// RecoveryCodeStatus 恢复码状态（明文只在生成时返回一次）
+type RecoveryCodeStatus struct {
+	Remaining int `json:"remaining"`
+	Total     int `json:"total"`
+}
+
+// RecoveryCodeService 2FA 恢复码：TOTP 与通行密钥用户共用，一次性使用
+type RecoveryCodeService struct {
+	repo        RecoveryCodeRepository
+	totpService *TotpService
+}
+
+// NewRecoveryCodeService creates a new RecoveryCodeService
+func NewRecoveryCodeService(repo RecoveryCodeRepository, totpService *TotpService) *RecoveryCodeService {
+	return &RecoveryCodeService{repo: repo, totpService: totpService}
+}
+
+// GetStatus 返回剩余可用恢复码数量
+func (s *RecoveryCodeService) GetStatus(ctx context.Context, userID int64) (*RecoveryCodeStatus, error) {
+	remaining, err := s.repo.CountRemaining(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveryCodeStatus{Remaining: remaining, Total: recoveryCodeCount}, nil
+}
+
+// Regenerate 作废旧恢复码并生成新的一组（需验证身份）
+func (s *RecoveryCodeService) Regenerate(ctx context.Context, userID int64, hasSecondFactor bool, emailCode, password string) ([]string, error) {
+	if !hasSecondFactor {
+		return nil, ErrRecoveryCodeNoSecondFactor
+	}
+	if err := s.totpService.VerifyIdentity(ctx, userID, emailCode, password); err != nil {
+		return nil, err
+	}
+	return s.generate(ctx, userID)
+}
+
+// IssueInitial 首次启用第二因素时发放恢复码；用户已有可用恢复码时返回 nil
+func (s *RecoveryCodeService) IssueInitial(ctx context.Context, userID int64) ([]string, error) {
+	remaining, err := s.repo.CountRemaining(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if remaining > 0 {
+		return nil, nil
+	}
+	return s.generate(ctx, userID)
+}
+
+// Verify 校验并消耗一个恢复码，与 TOTP 共用失败次数限制
+func (s *RecoveryCodeService) Verify(ctx context.Context, userID int64, code string) error {
+	if s.totpService.tooManyAttempts(ctx, userID) {
+		return ErrTotpTooManyAttempts
+	}
+	ok, err := s.repo.Consume(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.totpService.recordFailedAttempt(ctx, userID)
+		return ErrRecoveryCodeInvalid
+	}
+	s.totpService.clearAttempts(ctx, userID)
+	return nil
+}
+
+// Clear 删除用户全部恢复码（最后一个第二因素被移除时调用）
+func (s *RecoveryCodeService) Clear(ctx context.Context, userID int64) error {
+	return s.repo.DeleteAll(ctx, userID)
+}
+
+func (s *RecoveryCodeService) generate(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("generate recovery code: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+	if err := s.repo.Replace(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode 生成 xxxxx-xxxxx 形式的恢复码（约 49 bit 熵）
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeHalfLen*2)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for i, b := range buf {
+		if i == recoveryCodeHalfLen {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+// hashRecoveryCode 归一化（忽略大小写、空白与连字符）后取 SHA-256
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,129 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recoveryCodeRepoStub struct {
+	codes map[string]bool // hash -> used
+}
+
+func (r *recoveryCodeRepoStub) Replace(_ context.Context, _ int64, hashes []string) error {
+	r.codes = make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		r.codes[h] = false
+	}
+	return nil
+}
+
+func (r *recoveryCodeRepoStub) Consume(_ context.Context, _ int64, hash string) (bool, error) {
+	used, ok := r.codes[hash]
+	if !ok || used {
+		return false, nil
+	}
+	r.codes[hash] = true
+	return true, nil
+}
+
+func (r *recoveryCodeRepoStub) CountRemaining(_ context.Context, _ int64) (int, error) {
+	n := 0
+	for _, used := range r.codes {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *recoveryCodeRepoStub) DeleteAll(_ context.Context, _ int64) error {
+	r.codes = nil
+	return nil
+}
+
+type totpAttemptCacheStub struct {
+	TotpCache
+	attempts int
+}
+
+func (c *totpAttemptCacheStub) IncrementVerifyAttempts(_ context.Context, _ int64) (int, error) {
+	c.attempts++
+	return c.attempts, nil
+}
+
+func (c *totpAttemptCacheStub) GetVerifyAttempts(_ context.Context, _ int64) (int, error) {
+	return c.attempts, nil
+}
+
+func (c *totpAttemptCacheStub) ClearVerifyAttempts(_ context.Context, _ int64) error {
+	c.attempts = 0
+	return nil
+}
+
+func newRecoveryCodeServiceForTest() (*RecoveryCodeService, *recoveryCodeRepoStub, *totpAttemptCacheStub) {
+	repo := &recoveryCodeRepoStub{}
+	cache := &totpAttemptCacheStub{}
+	return NewRecoveryCodeService(repo, &TotpService{cache: cache}), repo, cache
+}
+
+func TestRecoveryCodeService_IssueInitialOnlyOnce(t *testing.T) {
+	svc, _, _ := newRecoveryCodeServiceForTest()
+	ctx := context.Background()
+
+	codes, err := svc.IssueInitial(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	pattern := regexp.MustCompile(`^[2-9a-hjkmnp-z]{5}-[2-9a-hjkmnp-z]{5}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		require.Regexp(t, pattern, code)
+		require.False(t, seen[code])
+		seen[code] = true
+	}
+
+	again, err := svc.IssueInitial(ctx, 1)
+	require.NoError(t, err)
+	require.Nil(t, again, "codes are only returned the first time")
+}
+
+func TestRecoveryCodeService_VerifyConsumesOnce(t *testing.T) {
+	svc, _, cache := newRecoveryCodeServiceForTest()
+	ctx := context.Background()
+	codes, err := svc.IssueInitial(ctx, 1)
+	require.NoError(t, err)
+
+	// 大小写、空格与连字符不影响匹配
+	require.NoError(t, svc.Verify(ctx, 1, " "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" "))
+	require.ErrorIs(t, svc.Verify(ctx, 1, codes[0]), ErrRecoveryCodeInvalid)
+	require.Equal(t, 1, cache.attempts)
+
+	status, err := svc.GetStatus(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, recoveryCodeCount-1, status.Remaining)
+}
+
+func TestRecoveryCodeService_SharesTotpAttemptLimit(t *testing.T) {
+	svc, _, cache := newRecoveryCodeServiceForTest()
+	ctx := context.Background()
+	codes, err := svc.IssueInitial(ctx, 1)
+	require.NoError(t, err)
+
+	cache.attempts = maxTotpAttempts
+	require.ErrorIs(t, svc.Verify(ctx, 1, codes[0]), ErrTotpTooManyAttempts)
+
+	status, err := svc.GetStatus(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, recoveryCodeCount, status.Remaining, "blocked attempts must not consume codes")
+}
+
+func TestRecoveryCodeService_RegenerateRequiresSecondFactor(t *testing.T) {
+	svc, _, _ := newRecoveryCodeServiceForTest()
+	_, err := svc.Regenerate(context.Background(), 1, false, "", "")
+	require.ErrorIs(t, err, ErrRecoveryCodeNoSecondFactor)
+}
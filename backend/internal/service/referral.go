@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+)
+
+// Referral commission sources.
+const (
+	ReferralSourceRecharge = "recharge" // 被邀请人充值订单完成
+	ReferralSourceUsage    = "usage"    // 被邀请人 API 消费（按 usage_logs.actual_cost 结算）
+)
+
+// Referral commission credit modes.
+const (
+	ReferralCreditBalance = "balance" // 佣金直接计入邀请人余额
+	ReferralCreditCredit  = "credit"  // 佣金计入可提现额度，由用户转余额或管理员线下结算
+)
+
+// Referral signup sources recorded on the relation.
+const (
+	ReferralSignupEmail   = "email"
+	ReferralSignupLinuxDo = "linuxdo"
+	ReferralSignupOIDC    = "oidc"
+	ReferralSignupLDAP    = "ldap"
+	ReferralSignupSAML    = "saml"
+)
+
+// Sources of the IPs remembered per user for the same-IP check.
+const (
+	ReferralIPRegister = "register" // 注册时的 IP，永久参与比对
+	ReferralIPLogin    = "login"    // 登录签发 token 时的 IP，仅近期窗口内参与比对
+)
+
+// Referral payout methods.
+const (
+	ReferralPayoutBalance = "balance" // 用户将可提现额度转入余额
+	ReferralPayoutManual  = "manual"  // 管理员线下结算后登记
+)
+
+var (
+	ErrReferralNotFound          = infraerrors.NotFound("REFERRAL_NOT_FOUND", "referral record not found")
+	ErrReferralDisabled          = infraerrors.Forbidden("REFERRAL_DISABLED", "referral program is disabled")
+	ErrReferralCodeInvalid       = infraerrors.BadRequest("REFERRAL_CODE_INVALID", "invalid referral code")
+	ErrReferralSelf              = infraerrors.BadRequest("REFERRAL_SELF", "cannot refer yourself")
+	ErrReferralAlreadyBound      = infraerrors.Conflict("REFERRAL_ALREADY_BOUND", "referrer already recorded for this user")
+	ErrReferralSameIP            = infraerrors.Forbidden("REFERRAL_SAME_IP", "referral rejected: same ip as referrer")
+	ErrReferralIPLimit           = infraerrors.TooManyRequests("REFERRAL_IP_LIMIT", "too many referrals from this ip")
+	ErrReferralInsufficientFunds = infraerrors.BadRequest("REFERRAL_INSUFFICIENT_CREDIT", "insufficient referral credit")
+	ErrReferralInvalidAmount     = infraerrors.BadRequest("REFERRAL_INVALID_AMOUNT", "amount must be greater than 0")
+	ErrReferralBelowMinimum      = infraerrors.BadRequest("REFERRAL_BELOW_MINIMUM", "amount is below the minimum withdrawal")
+)
+
+// ReferralConfig is the admin-configurable referral program settings (stored as JSON in settings).
+type ReferralConfig struct {
+	Enabled bool `json:"enabled"`
+	// CommissionRate is a percentage (0-100) of the referee's recharge/usage credited to the referrer.
+	CommissionRate float64 `json:"commission_rate"`
+	// Sources lists which referee activities generate commission (recharge / usage).
+	Sources []string `json:"sources"`
+	// CreditMode decides whether commission goes to balance directly or to withdrawable credit.
+	CreditMode string `json:"credit_mode"`
+	// CommissionDays limits commission to N days after the referee registered (0 = forever).
+	CommissionDays int `json:"commission_days"`
+	// MaxCommissionPerReferee caps lifetime commission generated by a single referee (0 = unlimited).
+	MaxCommissionPerReferee float64 `json:"max_commission_per_referee"`
+	// MinWithdrawAmount is the minimum credit that can be moved out in credit mode.
+	MinWithdrawAmount float64 `json:"min_withdraw_amount"`
+	// BlockSameIP rejects a referral when the referee registers from an IP the referrer
+	// registered, recently logged in or last opened the referral dashboard from.
+	BlockSameIP bool `json:"block_same_ip"`
+	// MaxReferralsPerIPPerDay limits how many referees can be bound from one IP within 24h (0 = unlimited).
+	MaxReferralsPerIPPerDay int `json:"max_referrals_per_ip_per_day"`
+}
+
+// HasSource reports whether the given commission source is enabled.
+func (c *ReferralConfig) HasSource(source string) bool {
+	if c == nil {
+		return false
+	}
+	for _, s := range c.Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// ReferralAccount holds a user's referral code and commission wallet.
+type ReferralAccount struct {
+	UserID          int64     `json:"user_id"`
+	Code            string    `json:"code"`
+	AvailableCredit float64   `json:"available_credit"`
+	TotalCommission float64   `json:"total_commission"`
+	TotalWithdrawn  float64   `json:"total_withdrawn"`
+	LastIP          string    `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ReferralRelation records that ReferrerID brought in RefereeID.
+type ReferralRelation struct {
+	ID         int64     `json:"id"`
+	ReferrerID int64     `json:"referrer_id"`
+	RefereeID  int64     `json:"referee_id"`
+	Source     string    `json:"source"`
+	RegisterIP string    `json:"register_ip"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Populated by list queries.
+	RefereeEmail    string  `json:"referee_email,omitempty"`
+	ReferrerEmail   string  `json:"referrer_email,omitempty"`
+	TotalCommission float64 `json:"total_commission"`
+}
+
+// ReferralCommission is a single commission credit, unique per (SourceType, SourceRef).
+type ReferralCommission struct {
+	ID         int64     `json:"id"`
+	ReferrerID int64     `json:"referrer_id"`
+	RefereeID  int64     `json:"referee_id"`
+	SourceType string    `json:"source_type"`
+	SourceRef  string    `json:"source_ref"`
+	BaseAmount float64   `json:"base_amount"`
+	Rate       float64   `json:"rate"`
+	Amount     float64   `json:"amount"`
+	CreditMode string    `json:"credit_mode"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	RefereeEmail string `json:"referee_email,omitempty"`
+}
+
+// ReferralPayout records credit moved out of a referral wallet.
+type ReferralPayout struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Amount    float64   `json:"amount"`
+	Method    string    `json:"method"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReferralUsageAggregate is the summed usage cost of one referee within a usage_logs id window.
+type ReferralUsageAggregate struct {
+	RefereeID  int64
+	ReferrerID int64
+	BoundAt    time.Time
+	Cost       float64
+}
+
+// ReferralStats summarizes the referral program (admin) or a single referrer (user).
+type ReferralStats struct {
+	ReferralCount   int64   `json:"referral_count"`
+	TotalCommission float64 `json:"total_commission"`
+	TotalWithdrawn  float64 `json:"total_withdrawn"`
+	AvailableCredit float64 `json:"available_credit"`
+}
+
+// ReferralListFilters filters admin relation/commission listings.
+type ReferralListFilters struct {
+	ReferrerID int64
+	RefereeID  int64
+}
+
+// ReferralRepository persists referral accounts, relations, commissions and payouts.
+type ReferralRepository interface {
+	// GetAccount / GetAccountByCode return ErrReferralNotFound when absent.
+	GetAccount(ctx context.Context, userID int64) (*ReferralAccount, error)
+	GetAccountByCode(ctx context.Context, code string) (*ReferralAccount, error)
+	// CreateAccount inserts the account; returns false when the code is already taken.
+	CreateAccount(ctx context.Context, account *ReferralAccount) (bool, error)
+	UpdateLastIP(ctx context.Context, userID int64, ip string) error
+	// RecordUserIP remembers an IP the user registered (ReferralIPRegister) or logged in (ReferralIPLogin) from.
+	RecordUserIP(ctx context.Context, userID int64, ip, source string) error
+	// HasUserIP reports whether ip is the user's registration IP or a login IP seen since the given time.
+	HasUserIP(ctx context.Context, userID int64, ip string, loginSince time.Time) (bool, error)
+
+	// GetRelationByReferee returns ErrReferralNotFound when the user has no referrer.
+	GetRelationByReferee(ctx context.Context, refereeID int64) (*ReferralRelation, error)
+	CreateRelation(ctx context.Context, relation *ReferralRelation) error
+	CountRelationsByIPSince(ctx context.Context, ip string, since time.Time) (int64, error)
+	ListRelations(ctx context.Context, params pagination.PaginationParams, filters ReferralListFilters) ([]ReferralRelation, *pagination.PaginationResult, error)
+
+	// SumCommissionByReferee returns the lifetime commission generated by a referee.
+	SumCommissionByReferee(ctx context.Context, refereeID int64) (float64, error)
+	// CreditCommission inserts the commission and credits the referrer atomically.
+	// Returns false when a commission for the same source already exists (idempotent replay).
+	CreditCommission(ctx context.Context, commission *ReferralCommission) (bool, error)
+	ListCommissions(ctx context.Context, params pagination.PaginationParams, filters ReferralListFilters) ([]ReferralCommission, *pagination.PaginationResult, error)
+
+	// Payout deducts credit from the wallet and, for balance payouts, adds it to the user's balance.
+	Payout(ctx context.Context, payout *ReferralPayout) error
+	ListPayouts(ctx context.Context, userID int64, limit int) ([]ReferralPayout, error)
+
+	GetStats(ctx context.Context, referrerID int64) (*ReferralStats, error)
+
+	// MaxUsageLogID returns the current max usage_logs.id (settlement upper bound).
+	MaxUsageLogID(ctx context.Context) (int64, error)
+	// AggregateRefereeUsage sums actual_cost of referred users for usage_logs ids in (fromID, toID].
+	AggregateRefereeUsage(ctx context.Context, fromID, toID int64) ([]ReferralUsageAggregate, error)
+}
@@ -0,0 +1,682 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+)
+
+const (
+	referralCodeMaxLength     = 32
+	referralCodeLength        = 8
+	referralCodeAlphabet      = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // 去掉易混淆字符 I/O/0/1
+	referralCodeMaxAttempts   = 5
+	referralSettleInterval    = 5 * time.Minute
+	referralSettleTimeout     = 2 * time.Minute
+	referralUsageBatchMaxRows = 50000
+	referralLoginIPWindow     = 30 * 24 * time.Hour // 同 IP 校验比对邀请人近 30 天的登录 IP
+)
+
+// ReferralSignup carries the referral attribution of an in-flight registration.
+type ReferralSignup struct {
+	Code   string
+	Source string
+	IP     string
+}
+
+type referralSignupCtxKey struct{}
+
+// WithReferralSignup attaches referral attribution to ctx so that AuthService can
+// hand it to the registration observer once the new user has been created.
+// The signup IP is kept even without a code: it becomes the new user's registration IP
+// for the same-IP check when they later refer others.
+func WithReferralSignup(ctx context.Context, signup ReferralSignup) context.Context {
+	signup.Code = strings.TrimSpace(signup.Code)
+	signup.IP = strings.TrimSpace(signup.IP)
+	if signup.Code == "" && signup.IP == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, referralSignupCtxKey{}, signup)
+}
+
+func referralSignupFromContext(ctx context.Context) (ReferralSignup, bool) {
+	if ctx == nil {
+		return ReferralSignup{}, false
+	}
+	signup, ok := ctx.Value(referralSignupCtxKey{}).(ReferralSignup)
+	return signup, ok && signup.Code != ""
+}
+
+// ReferralDashboard is the user-facing referral overview.
+type ReferralDashboard struct {
+	Code            string   `json:"code"`
+	CommissionRate  float64  `json:"commission_rate"`
+	CreditMode      string   `json:"credit_mode"`
+	Sources         []string `json:"sources"`
+	CommissionDays  int      `json:"commission_days"`
+	MinWithdraw     float64  `json:"min_withdraw_amount"`
+	ReferralCount   int64    `json:"referral_count"`
+	TotalCommission float64  `json:"total_commission"`
+	TotalWithdrawn  float64  `json:"total_withdrawn"`
+	AvailableCredit float64  `json:"available_credit"`
+}
+
+// ReferralService 邀请返佣服务：邀请码、注册归因、佣金结算与提现。
+type ReferralService struct {
+	repo                 ReferralRepository
+	settingRepo          SettingRepository
+	billingCacheService  *BillingCacheService
+	authCacheInvalidator APIKeyAuthCacheInvalidator
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewReferralService creates a ReferralService.
+func NewReferralService(
+	repo ReferralRepository,
+	settingRepo SettingRepository,
+	billingCacheService *BillingCacheService,
+	authCacheInvalidator APIKeyAuthCacheInvalidator,
+) *ReferralService {
+	return &ReferralService{
+		repo:                 repo,
+		settingRepo:          settingRepo,
+		billingCacheService:  billingCacheService,
+		authCacheInvalidator: authCacheInvalidator,
+		stopCh:               make(chan struct{}),
+	}
+}
+
+// =========================
+// Config
+// =========================
+
+func defaultReferralConfig() *ReferralConfig {
+	return &ReferralConfig{
+		Enabled:                 false,
+		CommissionRate:          10,
+		Sources:                 []string{ReferralSourceRecharge},
+		CreditMode:              ReferralCreditBalance,
+		BlockSameIP:             true,
+		MaxReferralsPerIPPerDay: 3,
+	}
+}
+
+func normalizeReferralConfig(cfg *ReferralConfig) {
+	if cfg.CommissionRate < 0 {
+		cfg.CommissionRate = 0
+	}
+	if cfg.CommissionRate > 100 {
+		cfg.CommissionRate = 100
+	}
+	if cfg.CreditMode != ReferralCreditCredit {
+		cfg.CreditMode = ReferralCreditBalance
+	}
+	if cfg.CommissionDays < 0 {
+		cfg.CommissionDays = 0
+	}
+	if cfg.MaxCommissionPerReferee < 0 {
+		cfg.MaxCommissionPerReferee = 0
+	}
+	if cfg.MinWithdrawAmount < 0 {
+		cfg.MinWithdrawAmount = 0
+	}
+	if cfg.MaxReferralsPerIPPerDay < 0 {
+		cfg.MaxReferralsPerIPPerDay = 0
+	}
+	sources := make([]string, 0, len(cfg.Sources))
+	seen := make(map[string]bool, len(cfg.Sources))
+	for _, s := range cfg.Sources {
+		s = strings.TrimSpace(s)
+		if (s == ReferralSourceRecharge || s == ReferralSourceUsage) && !seen[s] {
+			seen[s] = true
+			sources = append(sources, s)
+		}
+	}
+	cfg.Sources = sources
+}
+
+// GetConfig returns the referral program configuration (defaults when unset).
+func (s *ReferralService) GetConfig(ctx context.Context) (*ReferralConfig, error) {
+	cfg := defaultReferralConfig()
+	if s == nil || s.settingRepo == nil {
+		return cfg, nil
+	}
+	raw, err := s.settingRepo.GetValue(ctx, SettingKeyReferralConfig)
+	if err != nil {
+		if errors.Is(err, ErrSettingNotFound) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(raw), cfg); err != nil {
+		// 配置损坏时不影响主流程，回退到默认配置（默认关闭）。
+		return defaultReferralConfig(), nil
+	}
+	normalizeReferralConfig(cfg)
+	return cfg, nil
+}
+
+// UpdateConfig validates and persists the referral program configuration.
+func (s *ReferralService) UpdateConfig(ctx context.Context, cfg *ReferralConfig) (*ReferralConfig, error) {
+	if cfg == nil {
+		return nil, errors.New("invalid request")
+	}
+	normalizeReferralConfig(cfg)
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.settingRepo.Set(ctx, SettingKeyReferralConfig, string(b)); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// =========================
+// Referral codes
+// =========================
+
+func generateReferralCode() (string, error) {
+	buf := make([]byte, referralCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	out := make([]byte, referralCodeLength)
+	for i, b := range buf {
+		out[i] = referralCodeAlphabet[int(b)%len(referralCodeAlphabet)]
+	}
+	return string(out), nil
+}
+
+// NormalizeReferralCode upper-cases and trims a user supplied referral code.
+// Oversized input (longer than the referral_accounts.code column) yields "".
+func NormalizeReferralCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) > referralCodeMaxLength {
+		return ""
+	}
+	return code
+}
+
+// EnsureAccount returns the user's referral account, creating a code on first access.
+// ip (optional) is remembered as the referrer's last known IP for same-IP fraud checks.
+func (s *ReferralService) EnsureAccount(ctx context.Context, userID int64, ip string) (*ReferralAccount, error) {
+	account, err := s.repo.GetAccount(ctx, userID)
+	if err == nil {
+		if ip != "" && account.LastIP != ip {
+			if err := s.repo.UpdateLastIP(ctx, userID, ip); err != nil {
+				logger.LegacyPrintf("service.referral", "[Referral] update last ip failed: user=%d err=%v", userID, err)
+			}
+			account.LastIP = ip
+		}
+		return account, nil
+	}
+	if !errors.Is(err, ErrReferralNotFound) {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < referralCodeMaxAttempts; attempt++ {
+		code, err := generateReferralCode()
+		if err != nil {
+			return nil, fmt.Errorf("generate referral code: %w", err)
+		}
+		account = &ReferralAccount{UserID: userID, Code: code, LastIP: ip}
+		created, err := s.repo.CreateAccount(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			return account, nil
+		}
+		// 并发创建或邀请码碰撞：若账户已存在则直接返回，否则换码重试。
+		if existing, getErr := s.repo.GetAccount(ctx, userID); getErr == nil {
+			return existing, nil
+		}
+	}
+	return nil, errors.New("failed to allocate unique referral code")
+}
+
+// =========================
+// Registration attribution
+// =========================
+
+// OnUserRegistered implements UserRegistrationObserver: remembers the registration IP and
+// binds the referrer carried in ctx. Referral failures never block registration; they are only logged.
+func (s *ReferralService) OnUserRegistered(ctx context.Context, user *User) {
+	if s == nil || user == nil {
+		return
+	}
+	if signup, ok := ctx.Value(referralSignupCtxKey{}).(ReferralSignup); ok {
+		s.recordUserIP(ctx, user.ID, signup.IP, ReferralIPRegister)
+	}
+	signup, ok := referralSignupFromContext(ctx)
+	if !ok {
+		return
+	}
+	if err := s.BindReferral(ctx, user.ID, signup); err != nil {
+		logger.LegacyPrintf("service.referral", "[Referral] bind skipped: referee=%d code=%s source=%s reason=%v", user.ID, signup.Code, signup.Source, err)
+	}
+}
+
+// OnUserLogin implements UserLoginObserver: remembers the login IP for the same-IP check.
+func (s *ReferralService) OnUserLogin(ctx context.Context, user *User, ip string) {
+	if s == nil || user == nil {
+		return
+	}
+	s.recordUserIP(ctx, user.ID, ip, ReferralIPLogin)
+}
+
+// recordUserIP 仅在开启同 IP 校验时记录，未开启邀请返佣时不额外保存用户 IP
+func (s *ReferralService) recordUserIP(ctx context.Context, userID int64, ip, source string) {
+	ip = strings.TrimSpace(ip)
+	if ip == "" || userID <= 0 {
+		return
+	}
+	cfg, err := s.GetConfig(ctx)
+	if err != nil || !cfg.Enabled || !cfg.BlockSameIP {
+		return
+	}
+	if err := s.repo.RecordUserIP(ctx, userID, ip, source); err != nil {
+		logger.LegacyPrintf("service.referral", "[Referral] record user ip failed: user=%d source=%s err=%v", userID, source, err)
+	}
+}
+
+// BindReferral records the referrer of refereeID after fraud checks.
+func (s *ReferralService) BindReferral(ctx context.Context, refereeID int64, signup ReferralSignup) error {
+	cfg, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if !cfg.Enabled {
+		return ErrReferralDisabled
+	}
+	code := NormalizeReferralCode(signup.Code)
+	if code == "" {
+		return ErrReferralCodeInvalid
+	}
+	referrer, err := s.repo.GetAccountByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, ErrReferralNotFound) {
+			return ErrReferralCodeInvalid
+		}
+		return err
+	}
+	if referrer.UserID == refereeID {
+		return ErrReferralSelf
+	}
+	if _, err := s.repo.GetRelationByReferee(ctx, refereeID); err == nil {
+		return ErrReferralAlreadyBound
+	} else if !errors.Is(err, ErrReferralNotFound) {
+		return err
+	}
+
+	ip := strings.TrimSpace(signup.IP)
+	if ip != "" {
+		if cfg.BlockSameIP {
+			if referrer.LastIP == ip {
+				return ErrReferralSameIP
+			}
+			// last_ip 只在打开邀请页时更新，这里同时比对邀请人的注册 IP 和近期登录 IP
+			seen, err := s.repo.HasUserIP(ctx, referrer.UserID, ip, time.Now().Add(-referralLoginIPWindow))
+			if err != nil {
+				return err
+			}
+			if seen {
+				return ErrReferralSameIP
+			}
+		}
+		if cfg.MaxReferralsPerIPPerDay > 0 {
+			count, err := s.repo.CountRelationsByIPSince(ctx, ip, time.Now().Add(-24*time.Hour))
+			if err != nil {
+				return err
+			}
+			if count >= int64(cfg.MaxReferralsPerIPPerDay) {
+				return ErrReferralIPLimit
+			}
+		}
+	}
+
+	source := signup.Source
+	if source == "" {
+		source = ReferralSignupEmail
+	}
+	return s.repo.CreateRelation(ctx, &ReferralRelation{
+		ReferrerID: referrer.UserID,
+		RefereeID:  refereeID,
+		Source:     source,
+		RegisterIP: ip,
+	})
+}
+
+// =========================
+// Commission
+// =========================
+
+// OnRechargeCompleted implements RechargeObserver: credits recharge commission for a paid order.
+func (s *ReferralService) OnRechargeCompleted(ctx context.Context, userID, orderID int64, amount float64) {
+	if s == nil || amount <= 0 {
+		return
+	}
+	cfg, err := s.GetConfig(ctx)
+	if err != nil || !cfg.Enabled || !cfg.HasSource(ReferralSourceRecharge) {
+		return
+	}
+	relation, err := s.repo.GetRelationByReferee(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, ErrReferralNotFound) {
+			logger.LegacyPrintf("service.referral", "[Referral] load relation failed: user=%d err=%v", userID, err)
+		}
+		return
+	}
+	ref := "order:" + strconv.FormatInt(orderID, 10)
+	if _, err := s.creditCommission(ctx, cfg, relation, ReferralSourceRecharge, ref, amount); err != nil {
+		logger.LegacyPrintf("service.referral", "[Referral] recharge commission failed: order=%d err=%v", orderID, err)
+	}
+}
+
+// creditCommission applies the commission window and per-referee cap, then credits the referrer.
+// Returns the credited amount (0 when nothing was credited).
+func (s *ReferralService) creditCommission(ctx context.Context, cfg *ReferralConfig, relation *ReferralRelation, sourceType, sourceRef string, base float64) (float64, error) {
+	if cfg.CommissionRate <= 0 || base <= 0 {
+		return 0, nil
+	}
+	if cfg.CommissionDays > 0 && time.Since(relation.CreatedAt) > time.Duration(cfg.CommissionDays)*24*time.Hour {
+		return 0, nil
+	}
+	amount := roundReferralAmount(base * cfg.CommissionRate / 100)
+	if cfg.MaxCommissionPerReferee > 0 {
+		earned, err := s.repo.SumCommissionByReferee(ctx, relation.RefereeID)
+		if err != nil {
+			return 0, err
+		}
+		remaining := roundReferralAmount(cfg.MaxCommissionPerReferee - earned)
+		if remaining <= 0 {
+			return 0, nil
+		}
+		if amount > remaining {
+			amount = remaining
+		}
+	}
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	commission := &ReferralCommission{
+		ReferrerID: relation.ReferrerID,
+		RefereeID:  relation.RefereeID,
+		SourceType: sourceType,
+		SourceRef:  sourceRef,
+		BaseAmount: base,
+		Rate:       cfg.CommissionRate,
+		Amount:     amount,
+		CreditMode: cfg.CreditMode,
+	}
+	inserted, err := s.repo.CreditCommission(ctx, commission)
+	if err != nil {
+		return 0, err
+	}
+	if !inserted {
+		return 0, nil
+	}
+	if commission.CreditMode == ReferralCreditBalance {
+		s.invalidateBalanceCaches(ctx, relation.ReferrerID)
+	}
+	return amount, nil
+}
+
+func roundReferralAmount(v float64) float64 {
+	return math.Round(v*1e8) / 1e8
+}
+
+func (s *ReferralService) invalidateBalanceCaches(ctx context.Context, userID int64) {
+	if s.authCacheInvalidator != nil {
+		s.authCacheInvalidator.InvalidateAuthCacheByUserID(ctx, userID)
+	}
+	if s.billingCacheService == nil {
+		return
+	}
+	go func() {
+		cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.billingCacheService.InvalidateUserBalance(cacheCtx, userID)
+	}()
+}
+
+// SettleUsageCommissions credits usage-based commission for usage logs written since the last run.
+// The first run only initializes the watermark, so enabling the program never back-pays history.
+func (s *ReferralService) SettleUsageCommissions(ctx context.Context) (int, error) {
+	cfg, err := s.GetConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !cfg.Enabled || !cfg.HasSource(ReferralSourceUsage) {
+		return 0, nil
+	}
+
+	maxID, err := s.repo.MaxUsageLogID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	fromID, ok, err := s.loadUsageWatermark(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, s.saveUsageWatermark(ctx, maxID)
+	}
+	if maxID <= fromID {
+		return 0, nil
+	}
+	toID := maxID
+	if toID-fromID > referralUsageBatchMaxRows {
+		toID = fromID + referralUsageBatchMaxRows
+	}
+
+	aggregates, err := s.repo.AggregateRefereeUsage(ctx, fromID, toID)
+	if err != nil {
+		return 0, err
+	}
+	credited := 0
+	for _, agg := range aggregates {
+		relation := &ReferralRelation{ReferrerID: agg.ReferrerID, RefereeID: agg.RefereeID, CreatedAt: agg.BoundAt}
+		ref := fmt.Sprintf("usage:%d:%d-%d", agg.RefereeID, fromID, toID)
+		amount, err := s.creditCommission(ctx, cfg, relation, ReferralSourceUsage, ref, agg.Cost)
+		if err != nil {
+			// 保持游标不动，下一轮按相同 source_ref 幂等重试。
+			return credited, err
+		}
+		if amount > 0 {
+			credited++
+		}
+	}
+	return credited, s.saveUsageWatermark(ctx, toID)
+}
+
+func (s *ReferralService) loadUsageWatermark(ctx context.Context) (int64, bool, error) {
+	raw, err := s.settingRepo.GetValue(ctx, SettingKeyReferralUsageWatermark)
+	if err != nil {
+		if errors.Is(err, ErrSettingNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil {
+		return 0, false, nil
+	}
+	return v, true, nil
+}
+
+func (s *ReferralService) saveUsageWatermark(ctx context.Context, id int64) error {
+	return s.settingRepo.Set(ctx, SettingKeyReferralUsageWatermark, strconv.FormatInt(id, 10))
+}
+
+// Start runs the periodic usage commission settlement.
+func (s *ReferralService) Start() {
+	if s == nil || s.repo == nil || s.settingRepo == nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(referralSettleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.runSettleOnce()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the settlement loop.
+func (s *ReferralService) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	s.wg.Wait()
+}
+
+func (s *ReferralService) runSettleOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), referralSettleTimeout)
+	defer cancel()
+	credited, err := s.SettleUsageCommissions(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.referral", "[Referral] usage settlement failed: %v", err)
+		return
+	}
+	if credited > 0 {
+		logger.LegacyPrintf("service.referral", "[Referral] usage settlement credited %d commissions", credited)
+	}
+}
+
+// =========================
+// Dashboards & payouts
+// =========================
+
+// GetDashboard returns the user's referral overview, creating the referral code on first visit.
+func (s *ReferralService) GetDashboard(ctx context.Context, userID int64, ip string) (*ReferralDashboard, error) {
+	cfg, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, ErrReferralDisabled
+	}
+	account, err := s.EnsureAccount(ctx, userID, ip)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.GetStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &ReferralDashboard{
+		Code:            account.Code,
+		CommissionRate:  cfg.CommissionRate,
+		CreditMode:      cfg.CreditMode,
+		Sources:         cfg.Sources,
+		CommissionDays:  cfg.CommissionDays,
+		MinWithdraw:     cfg.MinWithdrawAmount,
+		ReferralCount:   stats.ReferralCount,
+		TotalCommission: account.TotalCommission,
+		TotalWithdrawn:  account.TotalWithdrawn,
+		AvailableCredit: account.AvailableCredit,
+	}, nil
+}
+
+// ListRelations lists referral relations (filters.ReferrerID restricts to one referrer).
+func (s *ReferralService) ListRelations(ctx context.Context, params pagination.PaginationParams, filters ReferralListFilters) ([]ReferralRelation, *pagination.PaginationResult, error) {
+	return s.repo.ListRelations(ctx, params, filters)
+}
+
+// ListCommissions lists commission records.
+func (s *ReferralService) ListCommissions(ctx context.Context, params pagination.PaginationParams, filters ReferralListFilters) ([]ReferralCommission, *pagination.PaginationResult, error) {
+	return s.repo.ListCommissions(ctx, params, filters)
+}
+
+// ListPayouts lists the most recent payouts of a user.
+func (s *ReferralService) ListPayouts(ctx context.Context, userID int64, limit int) ([]ReferralPayout, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.ListPayouts(ctx, userID, limit)
+}
+
+// GetStats returns program-wide stats (referrerID = 0) or stats of one referrer.
+func (s *ReferralService) GetStats(ctx context.Context, referrerID int64) (*ReferralStats, error) {
+	return s.repo.GetStats(ctx, referrerID)
+}
+
+// WithdrawToBalance moves withdrawable credit into the user's balance (credit mode only).
+func (s *ReferralService) WithdrawToBalance(ctx context.Context, userID int64, amount float64) (*ReferralPayout, error) {
+	cfg, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, ErrReferralDisabled
+	}
+	payout, err := s.payout(ctx, cfg, userID, amount, ReferralPayoutBalance, "")
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateBalanceCaches(ctx, userID)
+	return payout, nil
+}
+
+// RecordManualPayout lets an admin record an off-platform settlement of referral credit.
+func (s *ReferralService) RecordManualPayout(ctx context.Context, userID int64, amount float64, note string) (*ReferralPayout, error) {
+	cfg, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 管理员登记不受最小提现额限制。
+	adminCfg := *cfg
+	adminCfg.MinWithdrawAmount = 0
+	return s.payout(ctx, &adminCfg, userID, amount, ReferralPayoutManual, strings.TrimSpace(note))
+}
+
+func (s *ReferralService) payout(ctx context.Context, cfg *ReferralConfig, userID int64, amount float64, method, note string) (*ReferralPayout, error) {
+	amount = roundReferralAmount(amount)
+	if amount <= 0 {
+		return nil, ErrReferralInvalidAmount
+	}
+	if cfg.MinWithdrawAmount > 0 && amount < cfg.MinWithdrawAmount {
+		return nil, ErrReferralBelowMinimum
+	}
+	account, err := s.repo.GetAccount(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrReferralNotFound) {
+			return nil, ErrReferralInsufficientFunds
+		}
+		return nil, err
+	}
+	if account.AvailableCredit < amount {
+		return nil, ErrReferralInsufficientFunds
+	}
+	payout := &ReferralPayout{UserID: userID, Amount: amount, Method: method, Note: note}
+	if err := s.repo.Payout(ctx, payout); err != nil {
+		return nil, err
+	}
+	return payout, nil
+}
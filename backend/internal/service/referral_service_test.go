@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+	"github.com/stretchr/testify/require"
+)
+
+type referralRepoStub struct {
+	accounts    map[int64]*ReferralAccount
+	relations   map[int64]*ReferralRelation
+	commissions []ReferralCommission
+	payouts     []ReferralPayout
+	ipCounts    map[string]int64
+	userIPs     map[int64]map[string]string // user -> ip -> source
+	balances    map[int64]float64
+	maxUsageID  int64
+	usage       []ReferralUsageAggregate
+	usageCalls  [][2]int64
+}
+
+func newReferralRepoStub() *referralRepoStub {
+	return &referralRepoStub{
+		accounts:  map[int64]*ReferralAccount{},
+		relations: map[int64]*ReferralRelation{},
+		ipCounts:  map[string]int64{},
+		userIPs:   map[int64]map[string]string{},
+		balances:  map[int64]float64{},
+	}
+}
+
+func (r *referralRepoStub) GetAccount(_ context.Context, userID int64) (*ReferralAccount, error) {
+	a, ok := r.accounts[userID]
+	if !ok {
+		return nil, ErrReferralNotFound
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (r *referralRepoStub) GetAccountByCode(_ context.Context, code string) (*ReferralAccount, error) {
+	for _, a := range r.accounts {
+		if a.Code == code {
+			cp := *a
+			return &cp, nil
+		}
+	}
+	return nil, ErrReferralNotFound
+}
+
+func (r *referralRepoStub) CreateAccount(_ context.Context, account *ReferralAccount) (bool, error) {
+	if _, ok := r.accounts[account.UserID]; ok {
+		return false, nil
+	}
+	for _, a := range r.accounts {
+		if a.Code == account.Code {
+			return false, nil
+		}
+	}
+	cp := *account
+	r.accounts[account.UserID] = &cp
+	return true, nil
+}
+
+func (r *referralRepoStub) UpdateLastIP(_ context.Context, userID int64, ip string) error {
+	if a, ok := r.accounts[userID]; ok {
+		a.LastIP = ip
+	}
+	return nil
+}
+
+func (r *referralRepoStub) RecordUserIP(_ context.Context, userID int64, ip, source string) error {
+	if r.userIPs[userID] == nil {
+		r.userIPs[userID] = map[string]string{}
+	}
+	r.userIPs[userID][ip] = source
+	return nil
+}
+
+func (r *referralRepoStub) HasUserIP(_ context.Context, userID int64, ip string, _ time.Time) (bool, error) {
+	_, ok := r.userIPs[userID][ip]
+	return ok, nil
+}
+
+func (r *referralRepoStub) GetRelationByReferee(_ context.Context, refereeID int64) (*ReferralRelation, error) {
+	rel, ok := r.relations[refereeID]
+	if !ok {
+		return nil, ErrReferralNotFound
+	}
+	cp := *rel
+	return &cp, nil
+}
+
+func (r *referralRepoStub) CreateRelation(_ context.Context, relation *ReferralRelation) error {
+	if _, ok := r.relations[relation.RefereeID]; ok {
+		return ErrReferralAlreadyBound
+	}
+	cp := *relation
+	if cp.CreatedAt.IsZero() {
+		cp.CreatedAt = time.Now()
+	}
+	r.relations[relation.RefereeID] = &cp
+	r.ipCounts[relation.RegisterIP]++
+	return nil
+}
+
+func (r *referralRepoStub) CountRelationsByIPSince(_ context.Context, ip string, _ time.Time) (int64, error) {
+	return r.ipCounts[ip], nil
+}
+
+func (r *referralRepoStub) ListRelations(context.Context, pagination.PaginationParams, ReferralListFilters) ([]ReferralRelation, *pagination.PaginationResult, error) {
+	return nil, &pagination.PaginationResult{}, nil
+}
+
+func (r *referralRepoStub) SumCommissionByReferee(_ context.Context, refereeID int64) (float64, error) {
+	var sum float64
+	for _, c := range r.commissions {
+		if c.RefereeID == refereeID {
+			sum += c.Amount
+		}
+	}
+	return sum, nil
+}
+
+func (r *referralRepoStub) CreditCommission(_ context.Context, commission *ReferralCommission) (bool, error) {
+	for _, c := range r.commissions {
+		if c.SourceType == commission.SourceType && c.SourceRef == commission.SourceRef {
+			return false, nil
+		}
+	}
+	r.commissions = append(r.commissions, *commission)
+	a, ok := r.accounts[commission.ReferrerID]
+	if !ok {
+		a = &ReferralAccount{UserID: commission.ReferrerID}
+		r.accounts[commission.ReferrerID] = a
+	}
+	a.TotalCommission += commission.Amount
+	if commission.CreditMode == ReferralCreditCredit {
+		a.AvailableCredit += commission.Amount
+	} else {
+		r.balances[commission.ReferrerID] += commission.Amount
+	}
+	return true, nil
+}
+
+func (r *referralRepoStub) ListCommissions(context.Context, pagination.PaginationParams, ReferralListFilters) ([]ReferralCommission, *pagination.PaginationResult, error) {
+	return r.commissions, &pagination.PaginationResult{Total: int64(len(r.commissions))}, nil
+}
+
+func (r *referralRepoStub) Payout(_ context.Context, payout *ReferralPayout) error {
+	a, ok := r.accounts[payout.UserID]
+	if !ok || a.AvailableCredit < payout.Amount {
+		return ErrReferralInsufficientFunds
+	}
+	a.AvailableCredit -= payout.Amount
+	a.TotalWithdrawn += payout.Amount
+	if payout.Method == ReferralPayoutBalance {
+		r.balances[payout.UserID] += payout.Amount
+	}
+	r.payouts = append(r.payouts, *payout)
+	return nil
+}
+
+func (r *referralRepoStub) ListPayouts(context.Context, int64, int) ([]ReferralPayout, error) {
+	return r.payouts, nil
+}
+
+func (r *referralRepoStub) GetStats(context.Context, int64) (*ReferralStats, error) {
+	return &ReferralStats{}, nil
+}
+
+func (r *referralRepoStub) MaxUsageLogID(context.Context) (int64, error) {
+	return r.maxUsageID, nil
+}
+
+func (r *referralRepoStub) AggregateRefereeUsage(_ context.Context, fromID, toID int64) ([]ReferralUsageAggregate, error) {
+	r.usageCalls = append(r.usageCalls, [2]int64{fromID, toID})
+	return r.usage, nil
+}
+
+func newReferralServiceForTest(t *testing.T, cfg *ReferralConfig) (*ReferralService, *referralRepoStub, *runtimeSettingRepoStub) {
+	t.Helper()
+	repo := newReferralRepoStub()
+	settings := newRuntimeSettingRepoStub()
+	if cfg != nil {
+		raw, err := json.Marshal(cfg)
+		require.NoError(t, err)
+		settings.values[SettingKeyReferralConfig] = string(raw)
+	}
+	return NewReferralService(repo, settings, nil, nil), repo, settings
+}
+
+func TestReferralConfig_DefaultsAndNormalization(t *testing.T) {
+	svc, _, _ := newReferralServiceForTest(t, nil)
+	cfg, err := svc.GetConfig(context.Background())
+	require.NoError(t, err)
+	require.False(t, cfg.Enabled)
+	require.Equal(t, ReferralCreditBalance, cfg.CreditMode)
+	require.True(t, cfg.HasSource(ReferralSourceRecharge))
+
+	updated, err := svc.UpdateConfig(context.Background(), &ReferralConfig{
+		Enabled:        true,
+		CommissionRate: 150,
+		Sources:        []string{"usage", "bogus", "usage"},
+		CreditMode:     "weird",
+		CommissionDays: -3,
+	})
+	require.NoError(t, err)
+	require.Equal(t, float64(100), updated.CommissionRate)
+	require.Equal(t, []string{ReferralSourceUsage}, updated.Sources)
+	require.Equal(t, ReferralCreditBalance, updated.CreditMode)
+	require.Zero(t, updated.CommissionDays)
+}
+
+func TestReferralService_BindReferralFraudChecks(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newReferralServiceForTest(t, &ReferralConfig{
+		Enabled:                 true,
+		CommissionRate:          10,
+		Sources:                 []string{ReferralSourceRecharge},
+		BlockSameIP:             true,
+		MaxReferralsPerIPPerDay: 1,
+	})
+	referrer, err := svc.EnsureAccount(ctx, 1, "1.1.1.1")
+	require.NoError(t, err)
+	require.Len(t, referrer.Code, referralCodeLength)
+
+	code := referrer.Code
+	require.ErrorIs(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: "NOPE"}), ErrReferralCodeInvalid)
+	require.ErrorIs(t, svc.BindReferral(ctx, 1, ReferralSignup{Code: code}), ErrReferralSelf)
+	require.ErrorIs(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: code, IP: "1.1.1.1"}), ErrReferralSameIP)
+
+	require.NoError(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: " " + code + " ", IP: "2.2.2.2"}))
+	require.Equal(t, int64(1), repo.relations[2].ReferrerID)
+	require.Equal(t, ReferralSignupEmail, repo.relations[2].Source)
+
+	require.ErrorIs(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: code, IP: "3.3.3.3"}), ErrReferralAlreadyBound)
+	require.ErrorIs(t, svc.BindReferral(ctx, 3, ReferralSignup{Code: code, IP: "2.2.2.2"}), ErrReferralIPLimit)
+}
+
+func TestReferralService_SameIPUsesRegistrationAndLoginIPs(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newReferralServiceForTest(t, &ReferralConfig{
+		Enabled:        true,
+		CommissionRate: 10,
+		BlockSameIP:    true,
+	})
+	// 邀请人从未打开邀请页：注册时无邀请码，只留下注册 IP；之后从另一个 IP 登录
+	svc.OnUserRegistered(WithReferralSignup(ctx, ReferralSignup{IP: "5.5.5.5"}), &User{ID: 1})
+	svc.OnUserLogin(ctx, &User{ID: 1}, "6.6.6.6")
+	repo.accounts[1] = &ReferralAccount{UserID: 1, Code: "INVITE01"}
+
+	require.ErrorIs(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: "INVITE01", IP: "5.5.5.5"}), ErrReferralSameIP)
+	require.ErrorIs(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: "INVITE01", IP: "6.6.6.6"}), ErrReferralSameIP)
+	require.NoError(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: "INVITE01", IP: "7.7.7.7"}))
+	require.Empty(t, repo.accounts[1].LastIP)
+}
+
+func TestReferralService_UserIPsNotRecordedWhenSameIPCheckDisabled(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newReferralServiceForTest(t, &ReferralConfig{Enabled: true, CommissionRate: 10})
+
+	svc.OnUserRegistered(WithReferralSignup(ctx, ReferralSignup{IP: "5.5.5.5"}), &User{ID: 1})
+	svc.OnUserLogin(ctx, &User{ID: 1}, "6.6.6.6")
+	require.Empty(t, repo.userIPs)
+}
+
+func TestReferralService_OnUserRegisteredUsesContext(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newReferralServiceForTest(t, &ReferralConfig{Enabled: true, CommissionRate: 10})
+	referrer, err := svc.EnsureAccount(ctx, 1, "")
+	require.NoError(t, err)
+
+	svc.OnUserRegistered(ctx, &User{ID: 2})
+	require.Empty(t, repo.relations)
+
+	signupCtx := WithReferralSignup(ctx, ReferralSignup{Code: referrer.Code, Source: ReferralSignupOIDC, IP: "9.9.9.9"})
+	svc.OnUserRegistered(signupCtx, &User{ID: 2})
+	require.Contains(t, repo.relations, int64(2))
+	require.Equal(t, ReferralSignupOIDC, repo.relations[2].Source)
+}
+
+func TestReferralService_DisabledRejectsBinding(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newReferralServiceForTest(t, &ReferralConfig{Enabled: false})
+	require.ErrorIs(t, svc.BindReferral(ctx, 2, ReferralSignup{Code: "ABCD"}), ErrReferralDisabled)
+}
+
+func TestReferralService_RechargeCommissionIdempotentAndCapped(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newReferralServiceForTest(t, &ReferralConfig{
+		Enabled:                 true,
+		CommissionRate:          10,
+		Sources:                 []string{ReferralSourceRecharge},
+		MaxCommissionPerReferee: 15,
+	})
+	repo.relations[2] = &ReferralRelation{ReferrerID: 1, RefereeID: 2, CreatedAt: time.Now()}
+
+	svc.OnRechargeCompleted(ctx, 2, 100, 100)
+	svc.OnRechargeCompleted(ctx, 2, 100, 100) // replay of the same order
+	require.Len(t, repo.commissions, 1)
+	require.InDelta(t, 10, repo.balances[1], 1e-9)
+
+	svc.OnRechargeCompleted(ctx, 2, 101, 100)
+	require.Len(t, repo.commissions, 2)
+	require.InDelta(t, 5, repo.commissions[1].Amount, 1e-9)
+
+	svc.OnRechargeCompleted(ctx, 2, 102, 100)
+	require.Len(t, repo.commissions, 2)
+
+	// 未被邀请的用户不产生佣金
+	svc.OnRechargeCompleted(ctx, 3, 103, 100)
+	require.Len(t, repo.commissions, 2)
+}
+
+func TestReferralService_CommissionWindowExpires(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newReferralServiceForTest(t, &ReferralConfig{
+		Enabled:        true,
+		CommissionRate: 10,
+		Sources:        []string{ReferralSourceRecharge},
+		CommissionDays: 30,
+	})
+	repo.relations[2] = &ReferralRelation{ReferrerID: 1, RefereeID: 2, CreatedAt: time.Now().Add(-31 * 24 * time.Hour)}
+
+	svc.OnRechargeCompleted(ctx, 2, 1, 100)
+	require.Empty(t, repo.commissions)
+}
+
+func TestReferralService_SettleUsageCommissionsWatermark(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, settings := newReferralServiceForTest(t, &ReferralConfig{
+		Enabled:        true,
+		CommissionRate: 20,
+		Sources:        []string{ReferralSourceUsage},
+		CreditMode:     ReferralCreditCredit,
+	})
+	repo.maxUsageID = 500
+	repo.usage = []ReferralUsageAggregate{{RefereeID: 2, ReferrerID: 1, BoundAt: time.Now(), Cost: 3}}
+
+	// 首次运行只初始化游标，不回溯历史消费
+	credited, err := svc.SettleUsageCommissions(ctx)
+	require.NoError(t, err)
+	require.Zero(t, credited)
+	require.Empty(t, repo.usageCalls)
+	require.Equal(t, "500", settings.values[SettingKeyReferralUsageWatermark])
+
+	repo.maxUsageID = 800
+	credited, err = svc.SettleUsageCommissions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, credited)
+	require.Equal(t, [][2]int64{{500, 800}}, repo.usageCalls)
+	require.Equal(t, strconv.FormatInt(800, 10), settings.values[SettingKeyReferralUsageWatermark])
+	require.InDelta(t, 0.6, repo.accounts[1].AvailableCredit, 1e-9)
+	require.Zero(t, repo.balances[1])
+}
+
+func TestReferralService_WithdrawToBalance(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, _ := newReferralServiceForTest(t, &ReferralConfig{
+		Enabled:           true,
+		CreditMode:        ReferralCreditCredit,
+		MinWithdrawAmount: 5,
+	})
+	repo.accounts[1] = &ReferralAccount{UserID: 1, Code: "AAAA", AvailableCredit: 8}
+
+	_, err := svc.WithdrawToBalance(ctx, 1, 0)
+	require.ErrorIs(t, err, ErrReferralInvalidAmount)
+	_, err = svc.WithdrawToBalance(ctx, 1, 2)
+	require.ErrorIs(t, err, ErrReferralBelowMinimum)
+	_, err = svc.WithdrawToBalance(ctx, 1, 10)
+	require.ErrorIs(t, err, ErrReferralInsufficientFunds)
+
+	payout, err := svc.WithdrawToBalance(ctx, 1, 6)
+	require.NoError(t, err)
+	require.Equal(t, ReferralPayoutBalance, payout.Method)
+	require.InDelta(t, 2, repo.accounts[1].AvailableCredit, 1e-9)
+	require.InDelta(t, 6, repo.balances[1], 1e-9)
+
+	// 管理员线下结算不受最小提现额限制
+	_, err = svc.RecordManualPayout(ctx, 1, 2, "paid via bank")
+	require.NoError(t, err)
+	require.Zero(t, repo.accounts[1].AvailableCredit)
+	require.Len(t, repo.payouts, 2)
+}
@@ -15,6 +15,7 @@ type RefreshTokenData struct {
 	UserID       int64     `json:"user_id"`
 	TokenVersion int64     `json:"token_version"` // 用于检测密码更改后的Token失效
 	FamilyID     string    `json:"family_id"`     // Token家族ID，用于防重放攻击
+	AuthTime     int64     `json:"auth_time"`     // 登录完成时间（Unix 秒），Token 轮转时保持不变
 	CreatedAt    time.Time `json:"created_at"`
 	ExpiresAt    time.Time `json:"expires_at"`
 }
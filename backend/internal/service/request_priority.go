@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+)
+
+// API Key 优先级分道
+const (
+	PriorityClassInteractive = "interactive"
+	PriorityClassNormal      = "normal"
+	PriorityClassBackground  = "background"
+)
+
+// PriorityClasses 按优先级从高到低排列
+var PriorityClasses = []string{PriorityClassInteractive, PriorityClassNormal, PriorityClassBackground}
+
+var (
+	ErrInvalidPriorityClass     = infraerrors.BadRequest("INVALID_PRIORITY_CLASS", "priority_class must be interactive, normal or background")
+	ErrPriorityClassUnavailable = infraerrors.ServiceUnavailable("PRIORITY_CLASS_UNAVAILABLE", "api key priority classes are not available")
+)
+
+// APIKeyPriorityRepository API Key 优先级存储（仅保存非 normal 的 Key）
+type APIKeyPriorityRepository interface {
+	ListAll(ctx context.Context) (map[int64]string, error)
+	Set(ctx context.Context, apiKeyID int64, class string) error
+	Delete(ctx context.Context, apiKeyID int64) error
+}
+
+// NormalizePriorityClass 规范化优先级；空值视为 normal，未知值返回 false
+func NormalizePriorityClass(class string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(class)) {
+	case PriorityClassInteractive:
+		return PriorityClassInteractive, true
+	case "", PriorityClassNormal:
+		return PriorityClassNormal, true
+	case PriorityClassBackground:
+		return PriorityClassBackground, true
+	default:
+		return "", false
+	}
+}
+
+// priorityRank 数值越小优先级越高
+func priorityRank(class string) int {
+	switch class {
+	case PriorityClassInteractive:
+		return 0
+	case PriorityClassBackground:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// requestPriorityState 单个请求的优先级状态，随 request context 传递。
+// preempted 在 background 请求被更高优先级挤出账号等待队列时关闭。
+type requestPriorityState struct {
+	class     string
+	preempted chan struct{}
+	// waitTransferred 已将账号等待计数转交给抢占者，退出等待时不再递减
+	waitTransferred bool
+	// waitingAccountID 当前登记等待的账号（0 表示未在等待）
+	waitingAccountID int64
+}
+
+// WithRequestPriority 将请求优先级写入 context
+func WithRequestPriority(ctx context.Context, class string) context.Context {
+	normalized, ok := NormalizePriorityClass(class)
+	if !ok {
+		normalized = PriorityClassNormal
+	}
+	return context.WithValue(ctx, ctxkey.RequestPriority, &requestPriorityState{
+		class:     normalized,
+		preempted: make(chan struct{}),
+	})
+}
+
+func requestPriorityStateFromContext(ctx context.Context) *requestPriorityState {
+	if ctx == nil {
+		return nil
+	}
+	state, _ := ctx.Value(ctxkey.RequestPriority).(*requestPriorityState)
+	return state
+}
+
+// RequestPriorityFromContext 返回请求优先级（未设置时为 normal）
+func RequestPriorityFromContext(ctx context.Context) string {
+	if state := requestPriorityStateFromContext(ctx); state != nil {
+		return state.class
+	}
+	return PriorityClassNormal
+}
+
+// RequestPreempted 返回请求被抢占时关闭的 channel；未设置优先级时返回 nil（永不触发）
+func RequestPreempted(ctx context.Context) <-chan struct{} {
+	if state := requestPriorityStateFromContext(ctx); state != nil {
+		return state.preempted
+	}
+	return nil
+}
+
+// PriorityClassStats 单个优先级的实时状态（当前实例）
+type PriorityClassStats struct {
+	Class     string `json:"class"`
+	InFlight  int64  `json:"in_flight"`
+	Waiting   int64  `json:"waiting"`
+	Preempted int64  `json:"preempted"`
+	Yielded   int64  `json:"yielded"`
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+)
+
+const requestPriorityClassCacheTTL = 30 * time.Second
+
+// RequestPriorityService API Key 优先级分道
+//
+//   - Key 的优先级保存在 api_key_priority_classes 表中，进程内整表缓存；
+//   - 账号槽位获取时，若该账号有更高优先级的请求在等待，低优先级请求让位（strict 一律让位，weighted 按权重概率让位）；
+//   - background 请求只能占用账号并发的 background_max_fraction；
+//   - 账号等待队列已满时，更高优先级请求可以抢占一个 background 等待者的位置，被抢占者立即以 429 返回。
+//
+// 等待者登记与抢占是实例级的：各实例只能感知并抢占自己承接的请求。
+type RequestPriorityService struct {
+	repo      APIKeyPriorityRepository
+	cfg       config.GatewayPriorityConfig
+	randFloat func() float64
+
+	classMu     sync.RWMutex
+	classes     map[int64]string
+	classesAt   time.Time
+	classReload sync.Mutex
+
+	mu    sync.Mutex
+	lanes map[int64]*priorityAccountLane
+
+	inflight  [3]atomic.Int64
+	preempted [3]atomic.Int64
+	yielded   [3]atomic.Int64
+}
+
+// priorityAccountLane 单个账号上按优先级登记的等待者
+type priorityAccountLane struct {
+	waiting [3]int
+	// background 可被抢占的 background 等待者（按登记顺序）
+	background []*requestPriorityState
+}
+
+// NewRequestPriorityService 创建优先级分道服务
+func NewRequestPriorityService(repo APIKeyPriorityRepository, cfg *config.Config) *RequestPriorityService {
+	s := &RequestPriorityService{
+		repo:      repo,
+		randFloat: rand.Float64,
+		lanes:     make(map[int64]*priorityAccountLane),
+	}
+	if cfg != nil {
+		s.cfg = cfg.Gateway.Scheduling.Priority
+	}
+	return s
+}
+
+func (s *RequestPriorityService) enabled() bool {
+	return s != nil && s.cfg.Enabled
+}
+
+// ClassOf 返回 API Key 的优先级（未设置为 normal）
+func (s *RequestPriorityService) ClassOf(ctx context.Context, apiKeyID int64) string {
+	if s == nil || s.repo == nil || apiKeyID <= 0 {
+		return PriorityClassNormal
+	}
+	s.classMu.RLock()
+	classes, loadedAt := s.classes, s.classesAt
+	s.classMu.RUnlock()
+
+	if classes == nil || time.Since(loadedAt) >= requestPriorityClassCacheTTL {
+		// 只允许一个请求回源，其他请求继续使用旧缓存
+		if s.classReload.TryLock() {
+			s.reloadClasses(ctx)
+			s.classReload.Unlock()
+			s.classMu.RLock()
+			classes = s.classes
+			s.classMu.RUnlock()
+		}
+	}
+	if class, ok := classes[apiKeyID]; ok {
+		return class
+	}
+	return PriorityClassNormal
+}
+
+func (s *RequestPriorityService) reloadClasses(ctx context.Context) {
+	classes, err := s.repo.ListAll(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.request_priority", "Warning: load api key priority classes failed: %v", err)
+		s.classMu.Lock()
+		// 失败时推迟下一次回源，避免每个请求都打到数据库
+		if s.classes == nil {
+			s.classes = map[int64]string{}
+		}
+		s.classesAt = time.Now()
+		s.classMu.Unlock()
+		return
+	}
+	if classes == nil {
+		classes = map[int64]string{}
+	}
+	s.classMu.Lock()
+	s.classes = classes
+	s.classesAt = time.Now()
+	s.classMu.Unlock()
+}
+
+// SetClass 设置 API Key 优先级（normal 时删除记录）
+func (s *RequestPriorityService) SetClass(ctx context.Context, apiKeyID int64, class string) (string, error) {
+	normalized, ok := NormalizePriorityClass(class)
+	if !ok {
+		return "", ErrInvalidPriorityClass
+	}
+	if s == nil || s.repo == nil {
+		return "", ErrPriorityClassUnavailable
+	}
+	var err error
+	if normalized == PriorityClassNormal {
+		err = s.repo.Delete(ctx, apiKeyID)
+	} else {
+		err = s.repo.Set(ctx, apiKeyID, normalized)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.classMu.Lock()
+	if s.classes != nil {
+		updated := make(map[int64]string, len(s.classes)+1)
+		for id, c := range s.classes {
+			updated[id] = c
+		}
+		if normalized == PriorityClassNormal {
+			delete(updated, apiKeyID)
+		} else {
+			updated[apiKeyID] = normalized
+		}
+		s.classes = updated
+	}
+	s.classMu.Unlock()
+	return normalized, nil
+}
+
+// effectiveMaxConcurrency background 请求只能使用账号并发的一部分（至少 1）
+func (s *RequestPriorityService) effectiveMaxConcurrency(ctx context.Context, maxConcurrency int) int {
+	if !s.enabled() || maxConcurrency <= 0 || RequestPriorityFromContext(ctx) != PriorityClassBackground {
+		return maxConcurrency
+	}
+	limit := int(math.Floor(float64(maxConcurrency) * s.cfg.BackgroundMaxFraction))
+	return max(limit, 1)
+}
+
+func (s *RequestPriorityService) weightOf(class string) float64 {
+	switch class {
+	case PriorityClassInteractive:
+		return s.cfg.InteractiveWeight
+	case PriorityClassBackground:
+		return s.cfg.BackgroundWeight
+	default:
+		return s.cfg.NormalWeight
+	}
+}
+
+// shouldYield 判断当前请求是否应把账号槽位让给更高优先级的等待者
+func (s *RequestPriorityService) shouldYield(ctx context.Context, accountID int64) bool {
+	if !s.enabled() {
+		return false
+	}
+	state := requestPriorityStateFromContext(ctx)
+	if state != nil {
+		select {
+		case <-state.preempted:
+			return true
+		default:
+		}
+	}
+	class := RequestPriorityFromContext(ctx)
+	rank := priorityRank(class)
+	if rank == 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	lane := s.lanes[accountID]
+	higherWeight := 0.0
+	if lane != nil {
+		for i := 0; i < rank; i++ {
+			if lane.waiting[i] > 0 {
+				higherWeight += s.weightOf(PriorityClasses[i])
+			}
+		}
+	}
+	s.mu.Unlock()
+	if higherWeight <= 0 {
+		return false
+	}
+
+	yield := true
+	if s.cfg.Mode == "weighted" {
+		own := s.weightOf(class)
+		yield = s.randFloat() >= own/(own+higherWeight)
+	}
+	if yield {
+		s.yielded[rank].Add(1)
+	}
+	return yield
+}
+
+// trackAcquired 统计各优先级占用中的槽位，返回包装后的释放函数
+func (s *RequestPriorityService) trackAcquired(ctx context.Context, release func()) func() {
+	if !s.enabled() {
+		return release
+	}
+	rank := priorityRank(RequestPriorityFromContext(ctx))
+	s.inflight[rank].Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.inflight[rank].Add(-1) })
+		if release != nil {
+			release()
+		}
+	}
+}
+
+// registerWaiter 登记账号等待者
+func (s *RequestPriorityService) registerWaiter(ctx context.Context, accountID int64) {
+	if !s.enabled() {
+		return
+	}
+	state := requestPriorityStateFromContext(ctx)
+	rank := priorityRank(RequestPriorityFromContext(ctx))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lane := s.lanes[accountID]
+	if lane == nil {
+		lane = &priorityAccountLane{}
+		s.lanes[accountID] = lane
+	}
+	lane.waiting[rank]++
+	if state != nil {
+		state.waitingAccountID = accountID
+		if state.class == PriorityClassBackground {
+			lane.background = append(lane.background, state)
+		}
+	}
+}
+
+// unregisterWaiter 注销账号等待者；返回 true 表示等待计数已转交给抢占者，调用方不应再递减
+func (s *RequestPriorityService) unregisterWaiter(ctx context.Context, accountID int64) bool {
+	if !s.enabled() {
+		return false
+	}
+	state := requestPriorityStateFromContext(ctx)
+	rank := priorityRank(RequestPriorityFromContext(ctx))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state != nil && state.waitTransferred {
+		state.waitTransferred = false
+		return true
+	}
+	if state != nil && state.waitingAccountID != accountID {
+		return false
+	}
+	lane := s.lanes[accountID]
+	if lane == nil {
+		return false
+	}
+	if lane.waiting[rank] > 0 {
+		lane.waiting[rank]--
+	}
+	if state != nil {
+		state.waitingAccountID = 0
+		for i, waiter := range lane.background {
+			if waiter == state {
+				lane.background = append(lane.background[:i], lane.background[i+1:]...)
+				break
+			}
+		}
+	}
+	s.pruneLaneLocked(accountID, lane)
+	return false
+}
+
+// preemptFor 账号等待队列已满时，为更高优先级请求抢占最近登记的 background 等待者
+func (s *RequestPriorityService) preemptFor(ctx context.Context, accountID int64) bool {
+	if !s.enabled() || priorityRank(RequestPriorityFromContext(ctx)) >= priorityRank(PriorityClassBackground) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lane := s.lanes[accountID]
+	if lane == nil || len(lane.background) == 0 {
+		return false
+	}
+	victim := lane.background[len(lane.background)-1]
+	lane.background = lane.background[:len(lane.background)-1]
+	lane.waiting[priorityRank(PriorityClassBackground)]--
+	victim.waitingAccountID = 0
+	victim.waitTransferred = true
+	close(victim.preempted)
+	s.preempted[priorityRank(PriorityClassBackground)].Add(1)
+	s.pruneLaneLocked(accountID, lane)
+	return true
+}
+
+func (s *RequestPriorityService) pruneLaneLocked(accountID int64, lane *priorityAccountLane) {
+	if len(lane.background) > 0 {
+		return
+	}
+	for _, n := range lane.waiting {
+		if n > 0 {
+			return
+		}
+	}
+	delete(s.lanes, accountID)
+}
+
+// Stats 返回各优先级的占用、等待、抢占与让位统计（当前实例）
+func (s *RequestPriorityService) Stats() []PriorityClassStats {
+	if s == nil {
+		return nil
+	}
+	var waiting [3]int64
+	s.mu.Lock()
+	for _, lane := range s.lanes {
+		for i, n := range lane.waiting {
+			waiting[i] += int64(n)
+		}
+	}
+	s.mu.Unlock()
+
+	out := make([]PriorityClassStats, 0, len(PriorityClasses))
+	for i, class := range PriorityClasses {
+		out = append(out, PriorityClassStats{
+			Class:     class,
+			InFlight:  s.inflight[i].Load(),
+			Waiting:   waiting[i],
+			Preempted: s.preempted[i].Load(),
+			Yielded:   s.yielded[i].Load(),
+		})
+	}
+	return out
+}
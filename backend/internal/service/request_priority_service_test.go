@@ -0,0 +1,253 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type priorityTestConcurrencyCache struct {
+	*mockConcurrencyCache
+	lastMaxConcurrency int
+	waitQueueFull      bool
+	decrementCalls     int
+}
+
+func (c *priorityTestConcurrencyCache) AcquireAccountSlot(ctx context.Context, accountID int64, maxConcurrency int, requestID string) (bool, error) {
+	c.lastMaxConcurrency = maxConcurrency
+	return c.mockConcurrencyCache.AcquireAccountSlot(ctx, accountID, maxConcurrency, requestID)
+}
+
+func (c *priorityTestConcurrencyCache) IncrementAccountWaitCount(ctx context.Context, accountID int64, maxWait int) (bool, error) {
+	return !c.waitQueueFull, nil
+}
+
+func (c *priorityTestConcurrencyCache) DecrementAccountWaitCount(ctx context.Context, accountID int64) error {
+	c.decrementCalls++
+	return nil
+}
+
+type priorityTestRepo struct {
+	classes   map[int64]string
+	listCalls int
+}
+
+func (r *priorityTestRepo) ListAll(ctx context.Context) (map[int64]string, error) {
+	r.listCalls++
+	out := make(map[int64]string, len(r.classes))
+	for id, class := range r.classes {
+		out[id] = class
+	}
+	return out, nil
+}
+
+func (r *priorityTestRepo) Set(ctx context.Context, apiKeyID int64, class string) error {
+	r.classes[apiKeyID] = class
+	return nil
+}
+
+func (r *priorityTestRepo) Delete(ctx context.Context, apiKeyID int64) error {
+	delete(r.classes, apiKeyID)
+	return nil
+}
+
+func newPriorityTestConfig(mode string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Gateway.Scheduling.Priority = config.GatewayPriorityConfig{
+		Enabled:               true,
+		Mode:                  mode,
+		BackgroundMaxFraction: 0.5,
+		InteractiveWeight:     8,
+		NormalWeight:          4,
+		BackgroundWeight:      1,
+	}
+	return cfg
+}
+
+func newPriorityTestConcurrency(mode string) (*ConcurrencyService, *RequestPriorityService, *priorityTestConcurrencyCache) {
+	cache := &priorityTestConcurrencyCache{mockConcurrencyCache: &mockConcurrencyCache{}}
+	priority := NewRequestPriorityService(nil, newPriorityTestConfig(mode))
+	svc := NewConcurrencyService(cache)
+	svc.SetRequestPriorityService(priority)
+	return svc, priority, cache
+}
+
+func priorityTestStats(priority *RequestPriorityService) map[string]PriorityClassStats {
+	out := map[string]PriorityClassStats{}
+	for _, s := range priority.Stats() {
+		out[s.Class] = s
+	}
+	return out
+}
+
+func TestRequestPriority_BackgroundLimitedToFraction(t *testing.T) {
+	svc, _, cache := newPriorityTestConcurrency("strict")
+	background := WithRequestPriority(context.Background(), PriorityClassBackground)
+	normal := WithRequestPriority(context.Background(), PriorityClassNormal)
+
+	_, err := svc.AcquireAccountSlot(background, 1, 5)
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.lastMaxConcurrency)
+
+	_, err = svc.AcquireAccountSlot(background, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, cache.lastMaxConcurrency)
+
+	_, err = svc.AcquireAccountSlot(normal, 1, 5)
+	require.NoError(t, err)
+	require.Equal(t, 5, cache.lastMaxConcurrency)
+}
+
+func TestRequestPriority_StrictYieldToHigherWaiters(t *testing.T) {
+	svc, priority, cache := newPriorityTestConcurrency("strict")
+	interactive := WithRequestPriority(context.Background(), PriorityClassInteractive)
+	normal := WithRequestPriority(context.Background(), PriorityClassNormal)
+	background := WithRequestPriority(context.Background(), PriorityClassBackground)
+
+	canWait, err := svc.IncrementAccountWaitCount(normal, 1, 10)
+	require.NoError(t, err)
+	require.True(t, canWait)
+
+	result, err := svc.AcquireAccountSlot(background, 1, 4)
+	require.NoError(t, err)
+	require.False(t, result.Acquired)
+	require.Zero(t, cache.acquireAccountCalls)
+
+	// 同级与更高优先级不受影响，其他账号也不受影响
+	result, err = svc.AcquireAccountSlot(interactive, 1, 4)
+	require.NoError(t, err)
+	require.True(t, result.Acquired)
+	result, err = svc.AcquireAccountSlot(background, 2, 4)
+	require.NoError(t, err)
+	require.True(t, result.Acquired)
+
+	svc.DecrementAccountWaitCount(normal, 1)
+	result, err = svc.AcquireAccountSlot(background, 1, 4)
+	require.NoError(t, err)
+	require.True(t, result.Acquired)
+
+	stats := priorityTestStats(priority)
+	require.Equal(t, int64(1), stats[PriorityClassBackground].Yielded)
+	require.Zero(t, stats[PriorityClassNormal].Waiting)
+}
+
+func TestRequestPriority_WeightedYield(t *testing.T) {
+	svc, priority, _ := newPriorityTestConcurrency("weighted")
+	interactive := WithRequestPriority(context.Background(), PriorityClassInteractive)
+	background := WithRequestPriority(context.Background(), PriorityClassBackground)
+
+	_, err := svc.IncrementAccountWaitCount(interactive, 1, 10)
+	require.NoError(t, err)
+
+	// background 权重 1，interactive 权重 8：放行概率 1/9
+	priority.randFloat = func() float64 { return 0.05 }
+	result, err := svc.AcquireAccountSlot(background, 1, 4)
+	require.NoError(t, err)
+	require.True(t, result.Acquired)
+
+	priority.randFloat = func() float64 { return 0.5 }
+	result, err = svc.AcquireAccountSlot(background, 1, 4)
+	require.NoError(t, err)
+	require.False(t, result.Acquired)
+}
+
+func TestRequestPriority_PreemptBackgroundWaiter(t *testing.T) {
+	svc, priority, cache := newPriorityTestConcurrency("strict")
+	background := WithRequestPriority(context.Background(), PriorityClassBackground)
+	interactive := WithRequestPriority(context.Background(), PriorityClassInteractive)
+	normal := WithRequestPriority(context.Background(), PriorityClassNormal)
+
+	canWait, err := svc.IncrementAccountWaitCount(background, 1, 1)
+	require.NoError(t, err)
+	require.True(t, canWait)
+
+	cache.waitQueueFull = true
+	canWait, err = svc.IncrementAccountWaitCount(interactive, 1, 1)
+	require.NoError(t, err)
+	require.True(t, canWait)
+
+	select {
+	case <-RequestPreempted(background):
+	default:
+		t.Fatal("background waiter should be preempted")
+	}
+	result, err := svc.AcquireAccountSlot(background, 1, 4)
+	require.NoError(t, err)
+	require.False(t, result.Acquired)
+
+	// 被抢占者的等待计数已转交，退出时不再递减
+	svc.DecrementAccountWaitCount(background, 1)
+	require.Zero(t, cache.decrementCalls)
+	svc.DecrementAccountWaitCount(interactive, 1)
+	require.Equal(t, 1, cache.decrementCalls)
+
+	// 没有可抢占的 background 等待者时仍然拒绝
+	canWait, err = svc.IncrementAccountWaitCount(normal, 1, 1)
+	require.NoError(t, err)
+	require.False(t, canWait)
+
+	stats := priorityTestStats(priority)
+	require.Equal(t, int64(1), stats[PriorityClassBackground].Preempted)
+	require.Zero(t, stats[PriorityClassBackground].Waiting)
+	require.Zero(t, stats[PriorityClassInteractive].Waiting)
+}
+
+func TestRequestPriority_InFlightStats(t *testing.T) {
+	svc, priority, _ := newPriorityTestConcurrency("strict")
+	interactive := WithRequestPriority(context.Background(), PriorityClassInteractive)
+
+	result, err := svc.AcquireAccountSlot(interactive, 1, 4)
+	require.NoError(t, err)
+	require.True(t, result.Acquired)
+	require.Equal(t, int64(1), priorityTestStats(priority)[PriorityClassInteractive].InFlight)
+
+	result.ReleaseFunc()
+	result.ReleaseFunc()
+	require.Zero(t, priorityTestStats(priority)[PriorityClassInteractive].InFlight)
+}
+
+func TestRequestPriority_DisabledIsNoop(t *testing.T) {
+	cache := &priorityTestConcurrencyCache{mockConcurrencyCache: &mockConcurrencyCache{}}
+	svc := NewConcurrencyService(cache)
+	svc.SetRequestPriorityService(NewRequestPriorityService(nil, &config.Config{}))
+	background := WithRequestPriority(context.Background(), PriorityClassBackground)
+
+	_, err := svc.AcquireAccountSlot(background, 1, 4)
+	require.NoError(t, err)
+	require.Equal(t, 4, cache.lastMaxConcurrency)
+	require.Nil(t, (*ConcurrencyService)(NewConcurrencyService(cache)).PriorityClassStats())
+}
+
+func TestRequestPriority_ClassLookupAndUpdate(t *testing.T) {
+	repo := &priorityTestRepo{classes: map[int64]string{7: PriorityClassBackground}}
+	priority := NewRequestPriorityService(repo, newPriorityTestConfig("strict"))
+	ctx := context.Background()
+
+	require.Equal(t, PriorityClassBackground, priority.ClassOf(ctx, 7))
+	require.Equal(t, PriorityClassNormal, priority.ClassOf(ctx, 8))
+	require.Equal(t, 1, repo.listCalls)
+
+	class, err := priority.SetClass(ctx, 8, " Interactive ")
+	require.NoError(t, err)
+	require.Equal(t, PriorityClassInteractive, class)
+	require.Equal(t, PriorityClassInteractive, priority.ClassOf(ctx, 8))
+
+	class, err = priority.SetClass(ctx, 7, "")
+	require.NoError(t, err)
+	require.Equal(t, PriorityClassNormal, class)
+	require.NotContains(t, repo.classes, int64(7))
+	require.Equal(t, PriorityClassNormal, priority.ClassOf(ctx, 7))
+	require.Equal(t, 1, repo.listCalls)
+
+	_, err = priority.SetClass(ctx, 7, "urgent")
+	require.ErrorIs(t, err, ErrInvalidPriorityClass)
+
+	var nilPriority *RequestPriorityService
+	require.Equal(t, PriorityClassNormal, nilPriority.ClassOf(ctx, 7))
+	require.Equal(t, PriorityClassNormal, RequestPriorityFromContext(ctx))
+	require.Nil(t, RequestPreempted(ctx))
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlMetadataPath      = "/api/v1/auth/saml/metadata"
+	samlACSPath           = "/api/v1/auth/saml/acs"
+	samlMetadataFetchSize = 4 << 20
+	samlMetadataTimeout   = 15 * time.Second
+)
+
+var (
+	ErrSAMLDisabled        = infraerrors.NotFound("SAML_DISABLED", "saml login is disabled")
+	ErrSAMLNotReady        = infraerrors.ServiceUnavailable("SAML_NOT_READY", "saml identity provider is not available")
+	ErrSAMLInvalidResponse = infraerrors.Unauthorized("SAML_INVALID_RESPONSE", "invalid saml response")
+)
+
+// 未配置 email_attribute / username_attribute 时依次尝试的常见属性名（AD FS、Azure AD、Okta、Shibboleth）
+var (
+	samlEmailAttributeCandidates = []string{
+		"email",
+		"mail",
+		"emailaddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlUsernameAttributeCandidates = []string{
+		"displayName",
+		"name",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+	}
+)
+
+// SAMLService 是 SAML 2.0 Service Provider：提供 SP metadata、发起 AuthnRequest、校验 IdP 签名断言
+type SAMLService struct {
+	cfg config.SAMLConnectConfig
+
+	mu sync.Mutex
+	sp *saml.ServiceProvider // 首次使用时构建，IdP metadata 拉取失败时下次重试
+}
+
+// NewSAMLService creates a new SAMLService
+func NewSAMLService(cfg *config.Config) *SAMLService {
+	s := &SAMLService{}
+	if cfg != nil {
+		s.cfg = cfg.SAML
+	}
+	return s
+}
+
+// Enabled 返回 SAML 登录是否启用
+func (s *SAMLService) Enabled() bool {
+	return s != nil && s.cfg.Enabled
+}
+
+// GroupMappings 返回目录组映射
+func (s *SAMLService) GroupMappings() []config.DirectoryGroupMapping {
+	return s.cfg.GroupMappings
+}
+
+// Metadata 返回 SP metadata XML，供 IdP 导入
+func (s *SAMLService) Metadata(ctx context.Context) ([]byte, error) {
+	sp, err := s.serviceProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal sp metadata: %w", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// StartLogin 生成 HTTP-Redirect 绑定的 AuthnRequest，返回跳转地址与请求 ID（ACS 校验 InResponseTo 用）
+func (s *SAMLService) StartLogin(ctx context.Context, relayState string) (redirectURL string, requestID string, err error) {
+	sp, err := s.serviceProvider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	idpURL := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if idpURL == "" {
+		logger.LegacyPrintf("service.saml", "[SAML] idp metadata has no HTTP-Redirect SSO endpoint")
+		return "", "", ErrSAMLNotReady
+	}
+	req, err := sp.MakeAuthenticationRequest(idpURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", fmt.Errorf("make authn request: %w", err)
+	}
+	u, err := req.Redirect(url.QueryEscape(relayState), sp)
+	if err != nil {
+		return "", "", fmt.Errorf("build authn redirect: %w", err)
+	}
+	return u.String(), req.ID, nil
+}
+
+// ParseResponse 校验 ACS 收到的 SAMLResponse（签名、受众、有效期、InResponseTo）并提取身份
+func (s *SAMLService) ParseResponse(ctx context.Context, samlResponse string, possibleRequestIDs []string) (*DirectoryIdentity, error) {
+	sp, err := s.serviceProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(samlResponse))
+	if err != nil {
+		return nil, ErrSAMLInvalidResponse
+	}
+	assertion, err := sp.ParseXMLResponse(raw, possibleRequestIDs, sp.AcsURL)
+	if err != nil {
+		if invalid, ok := err.(*saml.InvalidResponseError); ok {
+			logger.LegacyPrintf("service.saml", "[SAML] invalid response: %v", invalid.PrivateErr)
+		} else {
+			logger.LegacyPrintf("service.saml", "[SAML] invalid response: %v", err)
+		}
+		return nil, ErrSAMLInvalidResponse
+	}
+	return s.identityFromAssertion(assertion)
+}
+
+func (s *SAMLService) identityFromAssertion(assertion *saml.Assertion) (*DirectoryIdentity, error) {
+	nameID := ""
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		nameID = strings.TrimSpace(assertion.Subject.NameID.Value)
+	}
+	if nameID == "" {
+		return nil, ErrSAMLInvalidResponse
+	}
+
+	emailAttrs := samlEmailAttributeCandidates
+	if s.cfg.EmailAttribute != "" {
+		emailAttrs = []string{s.cfg.EmailAttribute}
+	}
+	usernameAttrs := samlUsernameAttributeCandidates
+	if s.cfg.UsernameAttribute != "" {
+		usernameAttrs = []string{s.cfg.UsernameAttribute}
+	}
+
+	email := samlFirstAttributeValue(assertion, emailAttrs)
+	if email == "" && strings.Contains(nameID, "@") {
+		email = nameID
+	}
+	if email == "" {
+		email = DirectorySyntheticEmail(DirectoryProviderSAML, assertion.Issuer.Value+"\x1f"+nameID)
+	}
+	username := firstNonEmptyString(samlFirstAttributeValue(assertion, usernameAttrs), nameID)
+
+	return &DirectoryIdentity{
+		Provider: DirectoryProviderSAML,
+		Subject:  nameID,
+		Email:    email,
+		Username: username,
+		Groups:   samlAttributeValues(assertion, s.cfg.GroupAttribute),
+	}, nil
+}
+
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var values []string
+	for _, stmt := range assertion.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			if !strings.EqualFold(attr.Name, name) && !strings.EqualFold(attr.FriendlyName, name) {
+				continue
+			}
+			for _, v := range attr.Values {
+				if val := strings.TrimSpace(v.Value); val != "" {
+					values = append(values, val)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func samlFirstAttributeValue(assertion *saml.Assertion, names []string) string {
+	for _, name := range names {
+		if values := samlAttributeValues(assertion, name); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func (s *SAMLService) serviceProvider(ctx context.Context) (*saml.ServiceProvider, error) {
+	if !s.Enabled() {
+		return nil, ErrSAMLDisabled
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sp != nil {
+		return s.sp, nil
+	}
+	sp, err := s.buildServiceProvider(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.saml", "[SAML] init service provider failed: %v", err)
+		return nil, ErrSAMLNotReady
+	}
+	s.sp = sp
+	return sp, nil
+}
+
+func (s *SAMLService) buildServiceProvider(ctx context.Context) (*saml.ServiceProvider, error) {
+	root, err := url.Parse(strings.TrimRight(s.cfg.RootURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse root_url: %w", err)
+	}
+	metadataURL := *root
+	metadataURL.Path += samlMetadataPath
+	acsURL := *root
+	acsURL.Path += samlACSPath
+
+	idpMetadata, err := s.loadIDPMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:          s.cfg.EntityID,
+		MetadataURL:       metadataURL,
+		AcsURL:            acsURL,
+		IDPMetadata:       idpMetadata,
+		AllowIDPInitiated: s.cfg.AllowIDPInitiated,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+	if s.cfg.CertificateFile != "" {
+		pair, err := tls.LoadX509KeyPair(s.cfg.CertificateFile, s.cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load sp key pair: %w", err)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("parse sp certificate: %w", err)
+		}
+		signer, ok := pair.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("sp private key does not support signing")
+		}
+		sp.Certificate = cert
+		sp.Key = signer
+		if s.cfg.SignRequests {
+			switch cert.PublicKeyAlgorithm {
+			case x509.ECDSA:
+				sp.SignatureMethod = dsig.ECDSASHA256SignatureMethod
+			default:
+				sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+			}
+		}
+	}
+	return sp, nil
+}
+
+func (s *SAMLService) loadIDPMetadata(ctx context.Context) (*saml.EntityDescriptor, error) {
+	var data []byte
+	if s.cfg.IDPMetadataFile != "" {
+		b, err := os.ReadFile(s.cfg.IDPMetadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("read idp metadata: %w", err)
+		}
+		data = b
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, samlMetadataTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.IDPMetadataURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("build idp metadata request: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetch idp metadata: %w", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch idp metadata: status %d", resp.StatusCode)
+		}
+		b, err := io.ReadAll(io.LimitReader(resp.Body, samlMetadataFetchSize))
+		if err != nil {
+			return nil, fmt.Errorf("read idp metadata: %w", err)
+		}
+		data = b
+	}
+	return ParseSAMLIDPMetadata(data)
+}
+
+// ParseSAMLIDPMetadata 解析 IdP metadata，兼容 EntitiesDescriptor 包裹的形式（取第一个含 IDPSSODescriptor 的实体）
+func ParseSAMLIDPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil && len(entity.IDPSSODescriptors) > 0 {
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("parse idp metadata: %w", err)
+	}
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, fmt.Errorf("parse idp metadata: no IDPSSODescriptor found")
+}
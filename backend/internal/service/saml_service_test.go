@@ -0,0 +1,193 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/require"
+)
+
+func newSelfSignedCert(t *testing.T, cn string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+type testSAMLSPProvider struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p *testSAMLSPProvider) GetServiceProvider(_ *http.Request, _ string) (*saml.EntityDescriptor, error) {
+	return p.metadata, nil
+}
+
+// testSAMLIdP 用 crewjam/saml 的 IdentityProvider 充当自签名 IdP，为 SP 的 AuthnRequest 签发断言
+type testSAMLIdP struct {
+	idp *saml.IdentityProvider
+}
+
+func newTestSAMLIdP(t *testing.T) *testSAMLIdP {
+	key, cert := newSelfSignedCert(t, "idp.corp.example")
+	metadataURL, _ := url.Parse("https://idp.corp.example/metadata")
+	ssoURL, _ := url.Parse("https://idp.corp.example/sso")
+	return &testSAMLIdP{idp: &saml.IdentityProvider{
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: *metadataURL,
+		SSOURL:      *ssoURL,
+	}}
+}
+
+func (p *testSAMLIdP) writeMetadata(t *testing.T) string {
+	body, err := xml.Marshal(p.idp.Metadata())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "idp.xml")
+	require.NoError(t, os.WriteFile(path, body, 0o600))
+	return path
+}
+
+// respond 处理 SP 的重定向 AuthnRequest，返回 POST 到 ACS 的 SAMLResponse
+func (p *testSAMLIdP) respond(t *testing.T, sp *SAMLService, redirectURL string, session *saml.Session) string {
+	t.Helper()
+	spMetadata, err := sp.Metadata(context.Background())
+	require.NoError(t, err)
+	var entity saml.EntityDescriptor
+	require.NoError(t, xml.Unmarshal(spMetadata, &entity))
+	p.idp.ServiceProviderProvider = &testSAMLSPProvider{metadata: &entity}
+
+	httpReq, err := http.NewRequest(http.MethodGet, redirectURL, nil)
+	require.NoError(t, err)
+	req, err := saml.NewIdpAuthnRequest(p.idp, httpReq)
+	require.NoError(t, err)
+	require.NoError(t, req.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(req, session))
+	require.NoError(t, req.MakeAssertionEl())
+	form, err := req.PostBinding()
+	require.NoError(t, err)
+	require.Equal(t, "https://sub2api.example.com/api/v1/auth/saml/acs", form.URL)
+	return form.SAMLResponse
+}
+
+func newSAMLServiceForTest(t *testing.T, idp *testSAMLIdP, mutate func(*config.SAMLConnectConfig)) *SAMLService {
+	cfg := config.SAMLConnectConfig{
+		Enabled:         true,
+		RootURL:         "https://sub2api.example.com",
+		IDPMetadataFile: idp.writeMetadata(t),
+		GroupAttribute:  "groups",
+	}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	return NewSAMLService(&config.Config{SAML: cfg})
+}
+
+func testSAMLSession() *saml.Session {
+	return &saml.Session{
+		ID:        "session-1",
+		NameID:    "alice@corp.example",
+		UserEmail: "alice@corp.example",
+		UserName:  "alice",
+		CustomAttributes: []saml.Attribute{
+			{Name: "displayName", Values: []saml.AttributeValue{{Type: "xs:string", Value: "Alice Liddell"}}},
+			{Name: "groups", Values: []saml.AttributeValue{{Type: "xs:string", Value: "ai-users"}, {Type: "xs:string", Value: "staff"}}},
+		},
+	}
+}
+
+func TestSAMLService_Metadata(t *testing.T) {
+	svc := newSAMLServiceForTest(t, newTestSAMLIdP(t), nil)
+
+	body, err := svc.Metadata(context.Background())
+	require.NoError(t, err)
+	var entity saml.EntityDescriptor
+	require.NoError(t, xml.Unmarshal(body, &entity))
+	require.Equal(t, "https://sub2api.example.com/api/v1/auth/saml/metadata", entity.EntityID)
+	require.Len(t, entity.SPSSODescriptors, 1)
+	require.Equal(t, "https://sub2api.example.com/api/v1/auth/saml/acs", entity.SPSSODescriptors[0].AssertionConsumerServices[0].Location)
+}
+
+func TestSAMLService_SignedAssertionRoundTrip(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+	svc := newSAMLServiceForTest(t, idp, nil)
+
+	redirectURL, requestID, err := svc.StartLogin(context.Background(), "")
+	require.NoError(t, err)
+	require.NotEmpty(t, requestID)
+
+	samlResponse := idp.respond(t, svc, redirectURL, testSAMLSession())
+	identity, err := svc.ParseResponse(context.Background(), samlResponse, []string{requestID})
+	require.NoError(t, err)
+	require.Equal(t, DirectoryProviderSAML, identity.Provider)
+	require.Equal(t, "alice@corp.example", identity.Subject)
+	require.Equal(t, "alice@corp.example", identity.Email)
+	require.Equal(t, "Alice Liddell", identity.Username)
+	require.Equal(t, []string{"ai-users", "staff"}, identity.Groups)
+}
+
+func TestSAMLService_RejectsUnknownRequestID(t *testing.T) {
+	idp := newTestSAMLIdP(t)
+	svc := newSAMLServiceForTest(t, idp, nil)
+
+	redirectURL, _, err := svc.StartLogin(context.Background(), "")
+	require.NoError(t, err)
+	samlResponse := idp.respond(t, svc, redirectURL, testSAMLSession())
+
+	_, err = svc.ParseResponse(context.Background(), samlResponse, []string{"id-someone-else"})
+	require.ErrorIs(t, err, ErrSAMLInvalidResponse)
+	_, err = svc.ParseResponse(context.Background(), samlResponse, nil)
+	require.ErrorIs(t, err, ErrSAMLInvalidResponse, "idp-initiated responses are rejected unless allowed")
+}
+
+func TestSAMLService_RejectsAssertionFromOtherIdP(t *testing.T) {
+	trusted := newTestSAMLIdP(t)
+	svc := newSAMLServiceForTest(t, trusted, nil)
+
+	redirectURL, requestID, err := svc.StartLogin(context.Background(), "")
+	require.NoError(t, err)
+
+	// 攻击者用自己的密钥签名，但声称是同一个 IdP
+	forged := newTestSAMLIdP(t)
+	samlResponse := forged.respond(t, svc, redirectURL, testSAMLSession())
+
+	_, err = svc.ParseResponse(context.Background(), samlResponse, []string{requestID})
+	require.ErrorIs(t, err, ErrSAMLInvalidResponse)
+}
+
+func TestSAMLService_DisabledAndBadMetadata(t *testing.T) {
+	_, _, err := NewSAMLService(&config.Config{}).StartLogin(context.Background(), "")
+	require.ErrorIs(t, err, ErrSAMLDisabled)
+
+	svc := NewSAMLService(&config.Config{SAML: config.SAMLConnectConfig{
+		Enabled:         true,
+		RootURL:         "https://sub2api.example.com",
+		IDPMetadataFile: filepath.Join(t.TempDir(), "missing.xml"),
+	}})
+	_, err = svc.Metadata(context.Background())
+	require.ErrorIs(t, err, ErrSAMLNotReady)
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+)
+
+// SCIMFilter 是 RFC 7644 §3.4.2.2 过滤表达式解析后的语法树，在资源的 JSON 形式上求值。
+// 属性名与字符串比较均不区分大小写（核心 schema 中 userName / displayName 等均为 caseExact=false）。
+type SCIMFilter interface {
+	Match(resource map[string]any) bool
+}
+
+type scimLogicalFilter struct {
+	op          string // and | or
+	left, right SCIMFilter
+}
+
+func (f *scimLogicalFilter) Match(resource map[string]any) bool {
+	if f.op == "and" {
+		return f.left.Match(resource) && f.right.Match(resource)
+	}
+	return f.left.Match(resource) || f.right.Match(resource)
+}
+
+type scimNotFilter struct {
+	inner SCIMFilter
+}
+
+func (f *scimNotFilter) Match(resource map[string]any) bool {
+	return !f.inner.Match(resource)
+}
+
+type scimCompareFilter struct {
+	path  []string // name.givenName -> ["name", "givenName"]
+	op    string   // eq ne co sw ew gt ge lt le pr
+	value any      // string / bool / float64 / nil
+}
+
+func (f *scimCompareFilter) Match(resource map[string]any) bool {
+	values := scimLookup(resource, f.path)
+	if f.op == "pr" {
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if f.op == "ne" {
+		for _, v := range values {
+			if scimCompare(v, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if scimCompare(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scimValuePathFilter 对应 emails[type eq "work"]：多值属性中任一元素满足子过滤器即匹配
+type scimValuePathFilter struct {
+	path  []string
+	inner SCIMFilter
+}
+
+func (f *scimValuePathFilter) Match(resource map[string]any) bool {
+	for _, v := range scimLookup(resource, f.path) {
+		if elem, ok := v.(map[string]any); ok && f.inner.Match(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// scimLookup 按路径取值，多值属性展开为各元素；属性名不区分大小写
+func scimLookup(resource map[string]any, path []string) []any {
+	current := []any{resource}
+	for _, name := range path {
+		var next []any
+		for _, node := range current {
+			obj, ok := node.(map[string]any)
+			if !ok {
+				continue
+			}
+			v, ok := scimGetAttr(obj, name)
+			if !ok {
+				continue
+			}
+			if arr, isArr := v.([]any); isArr {
+				next = append(next, arr...)
+			} else {
+				next = append(next, v)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+func scimGetAttr(obj map[string]any, name string) (any, bool) {
+	if v, ok := obj[name]; ok {
+		return v, true
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func scimCompare(actual any, op string, expected any) bool {
+	switch exp := expected.(type) {
+	case nil:
+		return op == "eq" && actual == nil
+	case bool:
+		act, ok := actual.(bool)
+		return ok && op == "eq" && act == exp
+	case float64:
+		act, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return act == exp
+		case "gt":
+			return act > exp
+		case "ge":
+			return act >= exp
+		case "lt":
+			return act < exp
+		case "le":
+			return act <= exp
+		}
+		return false
+	case string:
+		var act string
+		switch v := actual.(type) {
+		case string:
+			act = v
+		case float64:
+			// id 等数字字符串在 JSON 中以字符串出现，这里兼容数值属性与字符串字面量比较
+			act = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return false
+		}
+		a, e := strings.ToLower(act), strings.ToLower(exp)
+		switch op {
+		case "eq":
+			return a == e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	}
+	return false
+}
+
+// ParseSCIMFilter 解析过滤表达式，支持 and / or / not、括号、值路径 attr[...] 以及全部比较运算符
+func ParseSCIMFilter(input string) (SCIMFilter, error) {
+	tokens, err := scimTokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, scimInvalidFilter("unexpected token %q", p.peek().text)
+	}
+	return f, nil
+}
+
+func scimInvalidFilter(format string, args ...any) error {
+	return infraerrors.BadRequest(ErrSCIMInvalidFilter.Reason, "invalid filter: "+fmt.Sprintf(format, args...))
+}
+
+type scimTokenKind int
+
+const (
+	scimTokenWord scimTokenKind = iota
+	scimTokenString
+	scimTokenLParen
+	scimTokenRParen
+	scimTokenLBracket
+	scimTokenRBracket
+)
+
+type scimToken struct {
+	kind scimTokenKind
+	text string
+}
+
+func scimTokenize(input string) ([]scimToken, error) {
+	var tokens []scimToken
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, scimToken{kind: scimTokenLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, scimToken{kind: scimTokenRParen, text: ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, scimToken{kind: scimTokenLBracket, text: "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, scimToken{kind: scimTokenRBracket, text: "]"})
+			i++
+		case c == '"':
+			// 字符串字面量按 JSON 规则解码，支持 \" 与 \uXXXX
+			j := i + 1
+			for j < len(input) && input[j] != '"' {
+				if input[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(input) {
+				return nil, scimInvalidFilter("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(input[i:j+1]), &s); err != nil {
+				return nil, scimInvalidFilter("bad string literal")
+			}
+			tokens = append(tokens, scimToken{kind: scimTokenString, text: s})
+			i = j + 1
+		default:
+			j := i
+			for j < len(input) && !strings.ContainsRune(" \t\n\r()[]\"", rune(input[j])) {
+				j++
+			}
+			tokens = append(tokens, scimToken{kind: scimTokenWord, text: input[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+}
+
+func (p *scimFilterParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *scimFilterParser) peek() scimToken {
+	if p.done() {
+		return scimToken{kind: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *scimFilterParser) peekKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == scimTokenWord && strings.EqualFold(t.text, kw)
+}
+
+func (p *scimFilterParser) parseOr() (SCIMFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogicalFilter{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (SCIMFilter, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogicalFilter{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseFactor() (SCIMFilter, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		if p.peek().kind != scimTokenLParen {
+			return nil, scimInvalidFilter("not must be followed by (")
+		}
+		inner, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return &scimNotFilter{inner: inner}, nil
+	}
+	if p.peek().kind == scimTokenLParen {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != scimTokenRParen {
+			return nil, scimInvalidFilter("missing )")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseAttrExpr()
+}
+
+func (p *scimFilterParser) parseAttrExpr() (SCIMFilter, error) {
+	t := p.peek()
+	if t.kind != scimTokenWord {
+		return nil, scimInvalidFilter("expected attribute name")
+	}
+	p.pos++
+	path := scimSplitAttrPath(t.text)
+
+	if p.peek().kind == scimTokenLBracket {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != scimTokenRBracket {
+			return nil, scimInvalidFilter("missing ]")
+		}
+		p.pos++
+		return &scimValuePathFilter{path: path, inner: inner}, nil
+	}
+
+	opTok := p.peek()
+	if opTok.kind != scimTokenWord {
+		return nil, scimInvalidFilter("expected operator after %q", t.text)
+	}
+	op := strings.ToLower(opTok.text)
+	p.pos++
+	switch op {
+	case "pr":
+		return &scimCompareFilter{path: path, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, scimInvalidFilter("unsupported operator %q", opTok.text)
+	}
+
+	valTok := p.peek()
+	p.pos++
+	var value any
+	switch valTok.kind {
+	case scimTokenString:
+		value = valTok.text
+	case scimTokenWord:
+		switch strings.ToLower(valTok.text) {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			n, err := strconv.ParseFloat(valTok.text, 64)
+			if err != nil {
+				return nil, scimInvalidFilter("bad comparison value %q", valTok.text)
+			}
+			value = n
+		}
+	default:
+		return nil, scimInvalidFilter("expected comparison value after %q", opTok.text)
+	}
+	if _, isString := value.(string); !isString && (op == "co" || op == "sw" || op == "ew") {
+		return nil, scimInvalidFilter("operator %q requires a string value", op)
+	}
+	return &scimCompareFilter{path: path, op: op, value: value}, nil
+}
+
+// scimSplitAttrPath 去掉 schema URN 前缀后按 . 拆分子属性
+func scimSplitAttrPath(attr string) []string {
+	if strings.HasPrefix(strings.ToLower(attr), "urn:") {
+		if idx := strings.LastIndex(attr, ":"); idx >= 0 {
+			attr = attr[idx+1:]
+		}
+	}
+	return strings.Split(attr, ".")
+}
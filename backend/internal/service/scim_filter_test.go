@@ -0,0 +1,84 @@
+//go:build unit
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSCIMFilter_Match(t *testing.T) {
+	resource := map[string]any{
+		"id":          "12",
+		"userName":    "Alice@Corp.example",
+		"displayName": "Alice Liddell",
+		"active":      true,
+		"name":        map[string]any{"givenName": "Alice", "familyName": "Liddell"},
+		"emails": []any{
+			map[string]any{"value": "alice@corp.example", "type": "work", "primary": true},
+			map[string]any{"value": "alice@home.example", "type": "home"},
+		},
+		"meta": map[string]any{"lastModified": "2026-05-01T10:00:00Z"},
+	}
+
+	cases := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "alice@corp.example"`, true},
+		{`USERNAME Eq "ALICE@CORP.EXAMPLE"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "alice@corp.example"`, true},
+		{`userName ne "alice@corp.example"`, false},
+		{`displayName co "lidd"`, true},
+		{`displayName sw "bob"`, false},
+		{`userName ew "@corp.example"`, true},
+		{`name.givenName eq "Alice" and name.familyName eq "Liddell"`, true},
+		{`name.givenName eq "Bob" or active eq true`, true},
+		{`not (active eq true)`, false},
+		{`(displayName sw "A" or displayName sw "B") and not (userName co "home")`, true},
+		{`emails[type eq "home" and value co "home"]`, true},
+		{`emails[type eq "other"]`, false},
+		{`emails.value eq "alice@home.example"`, true},
+		{`externalId pr`, false},
+		{`name pr`, true},
+		{`meta.lastModified gt "2026-01-01T00:00:00Z"`, true},
+		{`meta.lastModified lt "2026-01-01T00:00:00Z"`, false},
+		{`id eq "12"`, true},
+		{`userName eq "a\"b"`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.filter, func(t *testing.T) {
+			f, err := ParseSCIMFilter(tc.filter)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, f.Match(resource))
+		})
+	}
+}
+
+func TestParseSCIMFilter_Invalid(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName xx "a"`,
+		`userName eq`,
+		`userName eq "unterminated`,
+		`(userName eq "a"`,
+		`emails[type eq "work"`,
+		`not userName eq "a"`,
+		`active co true`,
+		`userName eq "a" and`,
+		`userName eq "a" extra`,
+	} {
+		_, err := ParseSCIMFilter(filter)
+		require.ErrorIs(t, err, ErrSCIMInvalidFilter, filter)
+	}
+}
+
+func TestParseSCIMFilter_Precedence(t *testing.T) {
+	// and 优先于 or：a or (b and c)
+	f, err := ParseSCIMFilter(`active eq true or active eq false and userName eq "x"`)
+	require.NoError(t, err)
+	require.True(t, f.Match(map[string]any{"active": true, "userName": "y"}))
+	require.False(t, f.Match(map[string]any{"active": false, "userName": "y"}))
+}
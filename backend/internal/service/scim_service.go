@@ -0,0 +1,1178 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+)
+
+// SCIM 2.0 schema URN（RFC 7643 / 7644）
+const (
+	SCIMSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SCIMSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SCIMSchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	scimDefaultCount = 100
+	scimMaxCount     = 500
+	scimScanPageSize = 200
+)
+
+var (
+	ErrSCIMDisabled      = infraerrors.NotFound("SCIM_DISABLED", "scim provisioning is disabled")
+	ErrSCIMUnauthorized  = infraerrors.Unauthorized("SCIM_UNAUTHORIZED", "invalid scim bearer token")
+	ErrSCIMNotFound      = infraerrors.NotFound("SCIM_RESOURCE_NOT_FOUND", "resource not found")
+	ErrSCIMUniqueness    = infraerrors.Conflict("SCIM_UNIQUENESS", "resource already exists")
+	ErrSCIMInvalidFilter = infraerrors.BadRequest("SCIM_INVALID_FILTER", "invalid filter")
+	ErrSCIMInvalidValue  = infraerrors.BadRequest("SCIM_INVALID_VALUE", "invalid value")
+	ErrSCIMInvalidPath   = infraerrors.BadRequest("SCIM_INVALID_PATH", "invalid path")
+	ErrSCIMNoTarget      = infraerrors.BadRequest("SCIM_NO_TARGET", "path did not match any value")
+	ErrSCIMMutability    = infraerrors.BadRequest("SCIM_MUTABILITY", "attribute is immutable")
+	ErrSCIMInvalidSyntax = infraerrors.BadRequest("SCIM_INVALID_SYNTAX", "invalid request")
+)
+
+// SCIMRepository SCIM 供应辅助数据（externalId 映射、分组成员、批量停用 Key）
+type SCIMRepository interface {
+	GetUserIDByExternalID(ctx context.Context, externalID string) (int64, error)
+	ListExternalIDs(ctx context.Context, userIDs []int64) (map[int64]string, error)
+	// SetExternalID 为空字符串时删除映射；externalId 已被其他用户占用时返回 ErrSCIMUniqueness
+	SetExternalID(ctx context.Context, userID int64, externalID string) error
+	ListGroupMemberIDs(ctx context.Context, groupID int64) ([]int64, error)
+	// DisableUserAPIKeys 将用户未停用的 Key 全部置为 disabled，返回受影响的 key 以便清理认证缓存
+	DisableUserAPIKeys(ctx context.Context, userID int64) ([]string, error)
+}
+
+// SCIMMeta 资源元数据；Location 由 handler 按请求地址填充
+type SCIMMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMMultiValued emails / groups / members 等多值属性的元素
+type SCIMMultiValued struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SCIMUser struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id"`
+	ExternalID  string            `json:"externalId,omitempty"`
+	UserName    string            `json:"userName"`
+	Name        *SCIMName         `json:"name,omitempty"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Emails      []SCIMMultiValued `json:"emails,omitempty"`
+	Active      bool              `json:"active"`
+	Groups      []SCIMMultiValued `json:"groups,omitempty"`
+	Meta        SCIMMeta          `json:"meta"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id"`
+	DisplayName string            `json:"displayName"`
+	Members     []SCIMMultiValued `json:"members"`
+	Meta        SCIMMeta          `json:"meta"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+// SCIMListQuery 列表查询参数；StartIndex 从 1 开始
+type SCIMListQuery struct {
+	Filter     string
+	StartIndex int
+	Count      int
+}
+
+// SCIMUserInput POST / PUT 的 User 请求体
+type SCIMUserInput struct {
+	ExternalID  string            `json:"externalId"`
+	UserName    string            `json:"userName"`
+	Name        *SCIMName         `json:"name"`
+	DisplayName string            `json:"displayName"`
+	Emails      []SCIMMultiValued `json:"emails"`
+	Active      *bool             `json:"active"`
+}
+
+// SCIMGroupInput POST / PUT 的 Group 请求体
+type SCIMGroupInput struct {
+	DisplayName string            `json:"displayName"`
+	Members     []SCIMMultiValued `json:"members"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimUserStore interface {
+	GetByID(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	ListWithFilters(ctx context.Context, params pagination.PaginationParams, filters UserListFilters) ([]User, *pagination.PaginationResult, error)
+	AddGroupToAllowedGroups(ctx context.Context, userID int64, groupID int64) error
+	RemoveGroupFromUserAllowedGroups(ctx context.Context, userID int64, groupID int64) error
+}
+
+type scimGroupStore interface {
+	GetByID(ctx context.Context, id int64) (*Group, error)
+	ListWithFilters(ctx context.Context, params pagination.PaginationParams, platform, status, search string, isExclusive *bool) ([]Group, *pagination.PaginationResult, error)
+}
+
+type scimUserCreator interface {
+	CreateUser(ctx context.Context, input *CreateUserInput) (*User, error)
+}
+
+type scimUserDefaults interface {
+	GetDefaultBalance(ctx context.Context) float64
+	GetDefaultConcurrency(ctx context.Context) int
+}
+
+type scimSessionRevoker interface {
+	RevokeAllUserSessions(ctx context.Context, userID int64) error
+}
+
+// SCIMService SCIM 2.0 供应：User 对应普通用户（userName 即邮箱），Group 对应专属分组，
+// 组成员即 user_allowed_groups。管理员账号不经 SCIM 暴露或修改。
+type SCIMService struct {
+	cfg                  config.SCIMConfig
+	defaultBalance       float64
+	defaultConcurrency   int
+	userRepo             scimUserStore
+	groupRepo            scimGroupStore
+	repo                 SCIMRepository
+	creator              scimUserCreator
+	defaults             scimUserDefaults
+	sessions             scimSessionRevoker
+	authCacheInvalidator APIKeyAuthCacheInvalidator
+}
+
+// NewSCIMService 创建 SCIM 供应服务
+func NewSCIMService(
+	cfg *config.Config,
+	userRepo UserRepository,
+	groupRepo GroupRepository,
+	repo SCIMRepository,
+	adminService AdminService,
+	settingService *SettingService,
+	authService *AuthService,
+	authCacheInvalidator APIKeyAuthCacheInvalidator,
+) *SCIMService {
+	s := &SCIMService{
+		userRepo:             userRepo,
+		groupRepo:            groupRepo,
+		repo:                 repo,
+		creator:              adminService,
+		sessions:             authService,
+		authCacheInvalidator: authCacheInvalidator,
+	}
+	if cfg != nil {
+		s.cfg = cfg.SCIM
+		s.defaultBalance = cfg.Default.UserBalance
+		s.defaultConcurrency = cfg.Default.UserConcurrency
+	}
+	if settingService != nil {
+		s.defaults = settingService
+	}
+	return s
+}
+
+// Enabled 是否开启 SCIM
+func (s *SCIMService) Enabled() bool {
+	return s.cfg.Enabled && s.cfg.BearerToken != ""
+}
+
+// Authenticate 校验 IdP 的 Bearer Token；比较摘要以避免长度与时序泄露
+func (s *SCIMService) Authenticate(token string) error {
+	if !s.Enabled() {
+		return ErrSCIMDisabled
+	}
+	want := sha256.Sum256([]byte(s.cfg.BearerToken))
+	got := sha256.Sum256([]byte(token))
+	if token == "" || subtle.ConstantTimeCompare(want[:], got[:]) != 1 {
+		return ErrSCIMUnauthorized
+	}
+	return nil
+}
+
+// ========== Users ==========
+
+func (s *SCIMService) ListUsers(ctx context.Context, q SCIMListQuery) (*SCIMListResponse, error) {
+	filter, err := parseSCIMListFilter(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.exposedGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []User
+	if attr, value, ok := scimEqualityLookup(filter); ok && (attr == "username" || attr == "externalid") {
+		// IdP 关联账号时几乎总是按 userName / externalId 精确查询，直接走索引
+		if u, err := s.lookupUserBy(ctx, attr, value); err != nil {
+			return nil, err
+		} else if u != nil {
+			candidates = []User{*u}
+		}
+	} else {
+		candidates, err = s.scanUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]int64, 0, len(candidates))
+	for i := range candidates {
+		ids = append(ids, candidates[i].ID)
+	}
+	externalIDs, err := s.repo.ListExternalIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []any
+	for i := range candidates {
+		res := scimUserResource(&candidates[i], externalIDs[candidates[i].ID], groups)
+		if filter == nil || filter.Match(scimResourceMap(res)) {
+			matched = append(matched, res)
+		}
+	}
+	return scimPage(matched, q), nil
+}
+
+func (s *SCIMService) GetUser(ctx context.Context, id string) (*SCIMUser, error) {
+	u, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.userResource(ctx, u)
+}
+
+func (s *SCIMService) CreateUser(ctx context.Context, in *SCIMUserInput) (*SCIMUser, error) {
+	state := scimUserState{active: true}
+	state.applyInput(in)
+	if err := state.validate(); err != nil {
+		return nil, err
+	}
+	if existing, err := s.userRepo.GetByEmail(ctx, state.email); err == nil && existing != nil {
+		return nil, infraerrors.Conflict(ErrSCIMUniqueness.Reason, "userName already exists")
+	} else if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+	if state.externalID != "" {
+		if _, err := s.repo.GetUserIDByExternalID(ctx, state.externalID); err == nil {
+			return nil, infraerrors.Conflict(ErrSCIMUniqueness.Reason, "externalId already exists")
+		} else if !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+	}
+
+	// SCIM 用户通过 SSO 登录，本地密码随机生成且不告知任何人
+	password, err := randomHexString(32)
+	if err != nil {
+		return nil, fmt.Errorf("generate password: %w", err)
+	}
+	balance, concurrency := s.defaultBalance, s.defaultConcurrency
+	if s.defaults != nil {
+		balance = s.defaults.GetDefaultBalance(ctx)
+		concurrency = s.defaults.GetDefaultConcurrency(ctx)
+	}
+	u, err := s.creator.CreateUser(ctx, &CreateUserInput{
+		Email:       state.email,
+		Password:    password,
+		Username:    state.username(""),
+		Notes:       "provisioned by SCIM",
+		Balance:     balance,
+		Concurrency: concurrency,
+	})
+	if err != nil {
+		if errors.Is(err, ErrEmailExists) {
+			return nil, infraerrors.Conflict(ErrSCIMUniqueness.Reason, "userName already exists")
+		}
+		return nil, err
+	}
+	if state.externalID != "" {
+		if err := s.repo.SetExternalID(ctx, u.ID, state.externalID); err != nil {
+			return nil, err
+		}
+	}
+	if !state.active {
+		if err := s.deactivate(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+	logger.LegacyPrintf("service.scim", "[SCIM] provisioned user_id=%d active=%v", u.ID, state.active)
+	return s.userResource(ctx, u)
+}
+
+func (s *SCIMService) ReplaceUser(ctx context.Context, id string, in *SCIMUserInput) (*SCIMUser, error) {
+	u, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// PUT 未携带 active 时视为保持启用（RFC 7643 中 active 缺省语义由服务端决定）
+	state := scimUserState{active: true}
+	state.applyInput(in)
+	return s.commitUser(ctx, u, &state)
+}
+
+func (s *SCIMService) PatchUser(ctx context.Context, id string, req *SCIMPatchRequest) (*SCIMUser, error) {
+	u, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	externalIDs, err := s.repo.ListExternalIDs(ctx, []int64{u.ID})
+	if err != nil {
+		return nil, err
+	}
+	// displayName 留空：未修改显示名与姓名时 username() 保留现有用户名
+	state := scimUserState{
+		email:      u.Email,
+		externalID: externalIDs[u.ID],
+		active:     u.Status == StatusActive,
+	}
+	if len(req.Operations) == 0 {
+		return nil, infraerrors.BadRequest(ErrSCIMInvalidSyntax.Reason, "Operations is required")
+	}
+	for _, op := range req.Operations {
+		if err := state.applyPatch(op); err != nil {
+			return nil, err
+		}
+	}
+	return s.commitUser(ctx, u, &state)
+}
+
+// DeleteUser 取消供应：软停用而非删除，保留用量与账单记录；用户此后以 active=false 出现
+func (s *SCIMService) DeleteUser(ctx context.Context, id string) error {
+	u, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.deactivate(ctx, u)
+}
+
+func (s *SCIMService) commitUser(ctx context.Context, u *User, state *scimUserState) (*SCIMUser, error) {
+	if err := state.validate(); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(state.email, u.Email) {
+		if existing, err := s.userRepo.GetByEmail(ctx, state.email); err == nil && existing != nil && existing.ID != u.ID {
+			return nil, infraerrors.Conflict(ErrSCIMUniqueness.Reason, "userName already exists")
+		} else if err != nil && !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+	}
+
+	wasActive := u.Status == StatusActive
+	u.Email = state.email
+	u.Username = state.username(u.Username)
+	if state.active && !wasActive {
+		u.Status = StatusActive
+	}
+	if err := s.userRepo.Update(ctx, u); err != nil {
+		if errors.Is(err, ErrEmailExists) {
+			return nil, infraerrors.Conflict(ErrSCIMUniqueness.Reason, "userName already exists")
+		}
+		return nil, err
+	}
+	if err := s.repo.SetExternalID(ctx, u.ID, state.externalID); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !state.active && wasActive:
+		if err := s.deactivate(ctx, u); err != nil {
+			return nil, err
+		}
+	case state.active && !wasActive:
+		// 重新启用只恢复账号；停用时吊销的 API Key 需要用户自行重新创建
+		s.invalidateUser(ctx, u.ID)
+		logger.LegacyPrintf("service.scim", "[SCIM] reactivated user_id=%d", u.ID)
+	}
+	return s.userResource(ctx, u)
+}
+
+// deactivate 停用用户：禁用账号、禁用全部 API Key、撤销全部登录会话并清理认证缓存。
+// 任一步失败都返回错误，让 IdP 重试，避免出现“账号已停用但 Key 仍可用”的半完成状态。
+func (s *SCIMService) deactivate(ctx context.Context, u *User) error {
+	if u.Status != StatusDisabled {
+		u.Status = StatusDisabled
+		if err := s.userRepo.Update(ctx, u); err != nil {
+			return err
+		}
+	}
+	keys, err := s.repo.DisableUserAPIKeys(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	if s.sessions != nil {
+		if err := s.sessions.RevokeAllUserSessions(ctx, u.ID); err != nil {
+			return fmt.Errorf("revoke sessions: %w", err)
+		}
+	}
+	if s.authCacheInvalidator != nil {
+		for _, key := range keys {
+			s.authCacheInvalidator.InvalidateAuthCacheByKey(ctx, key)
+		}
+	}
+	s.invalidateUser(ctx, u.ID)
+	logger.LegacyPrintf("service.scim", "[SCIM] deprovisioned user_id=%d revoked_keys=%d", u.ID, len(keys))
+	return nil
+}
+
+func (s *SCIMService) invalidateUser(ctx context.Context, userID int64) {
+	if s.authCacheInvalidator != nil {
+		s.authCacheInvalidator.InvalidateAuthCacheByUserID(ctx, userID)
+	}
+}
+
+func (s *SCIMService) getUser(ctx context.Context, id string) (*User, error) {
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || userID <= 0 {
+		return nil, ErrSCIMNotFound
+	}
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrSCIMNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.IsAdmin() {
+		return nil, ErrSCIMNotFound
+	}
+	return u, nil
+}
+
+func (s *SCIMService) lookupUserBy(ctx context.Context, attr, value string) (*User, error) {
+	var (
+		u   *User
+		err error
+	)
+	if attr == "username" {
+		u, err = s.userRepo.GetByEmail(ctx, strings.TrimSpace(value))
+	} else {
+		var userID int64
+		userID, err = s.repo.GetUserIDByExternalID(ctx, value)
+		if err == nil {
+			u, err = s.userRepo.GetByID(ctx, userID)
+		}
+	}
+	if errors.Is(err, ErrUserNotFound) || (err == nil && u.IsAdmin()) {
+		return nil, nil
+	}
+	return u, err
+}
+
+// scanUsers 遍历全部普通用户；过滤在内存中对 SCIM 表示求值
+func (s *SCIMService) scanUsers(ctx context.Context) ([]User, error) {
+	includeSubs := false
+	var out []User
+	for page := 1; ; page++ {
+		users, result, err := s.userRepo.ListWithFilters(ctx,
+			pagination.PaginationParams{Page: page, PageSize: scimScanPageSize, SortBy: "id", SortOrder: "asc"},
+			UserListFilters{Role: RoleUser, IncludeSubscriptions: &includeSubs})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, users...)
+		if len(users) < scimScanPageSize || result == nil || page >= result.Pages {
+			return out, nil
+		}
+	}
+}
+
+func (s *SCIMService) userResource(ctx context.Context, u *User) (*SCIMUser, error) {
+	groups, err := s.exposedGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	externalIDs, err := s.repo.ListExternalIDs(ctx, []int64{u.ID})
+	if err != nil {
+		return nil, err
+	}
+	return scimUserResource(u, externalIDs[u.ID], groups), nil
+}
+
+func scimUserResource(u *User, externalID string, groups map[int64]*Group) *SCIMUser {
+	res := &SCIMUser{
+		Schemas:     []string{SCIMSchemaUser},
+		ID:          strconv.FormatInt(u.ID, 10),
+		ExternalID:  externalID,
+		UserName:    u.Email,
+		DisplayName: u.Username,
+		Emails:      []SCIMMultiValued{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      u.Status == StatusActive,
+		Meta:        scimMeta("User", u.CreatedAt, u.UpdatedAt),
+	}
+	if u.Username != "" {
+		res.Name = &SCIMName{Formatted: u.Username}
+	}
+	allowed := slices.Clone(u.AllowedGroups)
+	slices.Sort(allowed)
+	for _, gid := range allowed {
+		if g, ok := groups[gid]; ok {
+			res.Groups = append(res.Groups, SCIMMultiValued{Value: strconv.FormatInt(gid, 10), Display: g.Name})
+		}
+	}
+	return res
+}
+
+// scimUserState 是 PUT / PATCH 作用的可变视图，提交时统一校验与落库
+type scimUserState struct {
+	email       string
+	displayName string
+	formatted   string
+	givenName   string
+	familyName  string
+	externalID  string
+	active      bool
+	nameChanged bool
+}
+
+func (st *scimUserState) applyInput(in *SCIMUserInput) {
+	st.email = strings.TrimSpace(in.UserName)
+	if !strings.Contains(st.email, "@") {
+		// userName 不是邮箱时（如纯登录名）退回主邮箱，没有标记 primary 时取第一个
+		if email := scimPrimaryEmail(in.Emails); email != "" {
+			st.email = email
+		}
+	}
+	st.displayName = strings.TrimSpace(in.DisplayName)
+	if in.Name != nil {
+		st.formatted = strings.TrimSpace(in.Name.Formatted)
+		st.givenName = strings.TrimSpace(in.Name.GivenName)
+		st.familyName = strings.TrimSpace(in.Name.FamilyName)
+		st.nameChanged = true
+	}
+	st.externalID = strings.TrimSpace(in.ExternalID)
+	if in.Active != nil {
+		st.active = *in.Active
+	}
+}
+
+func (st *scimUserState) validate() error {
+	if st.email == "" || !strings.Contains(st.email, "@") || len(st.email) > 255 {
+		return infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "userName must be an email address")
+	}
+	if isReservedEmail(st.email) {
+		return infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "userName uses a reserved email domain")
+	}
+	if len(st.externalID) > 255 {
+		return infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "externalId is too long")
+	}
+	return nil
+}
+
+// username 推导 sub2api 用户名：displayName > name.formatted > givenName familyName > 原值 > 邮箱前缀
+func (st *scimUserState) username(current string) string {
+	if st.displayName != "" {
+		return st.displayName
+	}
+	if st.formatted != "" {
+		return st.formatted
+	}
+	if full := strings.TrimSpace(st.givenName + " " + st.familyName); full != "" {
+		return full
+	}
+	if current != "" && !st.nameChanged {
+		return current
+	}
+	local, _, _ := strings.Cut(st.email, "@")
+	return local
+}
+
+func (st *scimUserState) applyPatch(op SCIMPatchOperation) error {
+	kind := strings.ToLower(strings.TrimSpace(op.Op))
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return infraerrors.BadRequest(ErrSCIMInvalidSyntax.Reason, fmt.Sprintf("unsupported patch op %q", op.Op))
+	}
+	path := strings.TrimSpace(op.Path)
+	if path == "" {
+		if kind == "remove" {
+			return infraerrors.BadRequest(ErrSCIMNoTarget.Reason, "remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return infraerrors.BadRequest(ErrSCIMInvalidSyntax.Reason, "patch value must be an object when path is omitted")
+		}
+		// 逐个属性应用，保持与带 path 的写法一致
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := st.setAttr(strings.Join(scimSplitAttrPath(k), "."), values[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	attr := strings.Join(scimSplitAttrPath(path), ".")
+	if kind == "remove" {
+		return st.removeAttr(attr)
+	}
+	return st.setAttr(attr, op.Value)
+}
+
+func (st *scimUserState) setAttr(attr string, raw json.RawMessage) error {
+	lower := strings.ToLower(attr)
+	// emails[type eq "work"].value / emails[primary eq true].value 一类值路径统一视为主邮箱
+	if strings.HasPrefix(lower, "emails[") {
+		lower = "emails.value"
+	}
+	switch lower {
+	case "active":
+		active, err := scimParseBool(raw)
+		if err != nil {
+			return err
+		}
+		st.active = active
+	case "username":
+		v, err := scimParseString(raw)
+		if err != nil {
+			return err
+		}
+		st.email = v
+	case "displayname":
+		v, err := scimParseString(raw)
+		if err != nil {
+			return err
+		}
+		st.displayName = v
+	case "externalid":
+		v, err := scimParseString(raw)
+		if err != nil {
+			return err
+		}
+		st.externalID = v
+	case "name":
+		var name SCIMName
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "name must be an object")
+		}
+		st.formatted, st.givenName, st.familyName = strings.TrimSpace(name.Formatted), strings.TrimSpace(name.GivenName), strings.TrimSpace(name.FamilyName)
+		st.nameChanged = true
+	case "name.formatted", "name.givenname", "name.familyname":
+		v, err := scimParseString(raw)
+		if err != nil {
+			return err
+		}
+		switch lower {
+		case "name.formatted":
+			st.formatted = v
+		case "name.givenname":
+			st.givenName = v
+		default:
+			st.familyName = v
+		}
+		st.nameChanged = true
+	case "emails":
+		var emails []SCIMMultiValued
+		if err := json.Unmarshal(raw, &emails); err != nil {
+			return infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "emails must be an array")
+		}
+		if email := scimPrimaryEmail(emails); email != "" {
+			st.email = email
+		}
+	case "emails.value":
+		v, err := scimParseString(raw)
+		if err != nil {
+			return err
+		}
+		st.email = v
+	default:
+		// 未建模的属性（title、phoneNumbers、enterprise 扩展等）按 RFC 7644 忽略，避免 IdP 同步失败
+		return nil
+	}
+	return nil
+}
+
+func (st *scimUserState) removeAttr(attr string) error {
+	switch strings.ToLower(attr) {
+	case "externalid":
+		st.externalID = ""
+	case "displayname":
+		st.displayName = ""
+	case "name", "name.formatted", "name.givenname", "name.familyname":
+		st.formatted, st.givenName, st.familyName = "", "", ""
+		st.nameChanged = true
+	case "username", "active", "emails", "emails.value":
+		return infraerrors.BadRequest(ErrSCIMMutability.Reason, fmt.Sprintf("%s cannot be removed", attr))
+	}
+	return nil
+}
+
+// ========== Groups ==========
+
+func (s *SCIMService) ListGroups(ctx context.Context, q SCIMListQuery) (*SCIMListResponse, error) {
+	filter, err := parseSCIMListFilter(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.exposedGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matched []any
+	for _, id := range slices.Sorted(maps.Keys(groups)) {
+		res, err := s.groupResource(ctx, groups[id])
+		if err != nil {
+			return nil, err
+		}
+		if filter == nil || filter.Match(scimResourceMap(res)) {
+			matched = append(matched, res)
+		}
+	}
+	return scimPage(matched, q), nil
+}
+
+func (s *SCIMService) GetGroup(ctx context.Context, id string) (*SCIMGroup, error) {
+	g, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.groupResource(ctx, g)
+}
+
+// CreateGroup 不创建新分组：按 displayName 关联已存在的专属分组，并以请求中的成员为准
+func (s *SCIMService) CreateGroup(ctx context.Context, in *SCIMGroupInput) (*SCIMGroup, error) {
+	name := strings.TrimSpace(in.DisplayName)
+	groups, err := s.exposedGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var target *Group
+	for _, g := range groups {
+		if strings.EqualFold(g.Name, name) {
+			target = g
+			break
+		}
+	}
+	if target == nil {
+		return nil, infraerrors.BadRequest(ErrSCIMInvalidValue.Reason,
+			fmt.Sprintf("no exclusive group named %q is exposed to SCIM; create it in sub2api first", name))
+	}
+	if err := s.setMembers(ctx, target.ID, in.Members); err != nil {
+		return nil, err
+	}
+	return s.groupResource(ctx, target)
+}
+
+func (s *SCIMService) ReplaceGroup(ctx context.Context, id string, in *SCIMGroupInput) (*SCIMGroup, error) {
+	g, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if name := strings.TrimSpace(in.DisplayName); name != "" && !strings.EqualFold(name, g.Name) {
+		return nil, infraerrors.BadRequest(ErrSCIMMutability.Reason, "group displayName is managed in sub2api")
+	}
+	if err := s.setMembers(ctx, g.ID, in.Members); err != nil {
+		return nil, err
+	}
+	return s.groupResource(ctx, g)
+}
+
+func (s *SCIMService) PatchGroup(ctx context.Context, id string, req *SCIMPatchRequest) (*SCIMGroup, error) {
+	g, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Operations) == 0 {
+		return nil, infraerrors.BadRequest(ErrSCIMInvalidSyntax.Reason, "Operations is required")
+	}
+	for _, op := range req.Operations {
+		if err := s.applyGroupPatch(ctx, g, op); err != nil {
+			return nil, err
+		}
+	}
+	return s.groupResource(ctx, g)
+}
+
+// DeleteGroup 解除供应：撤销全部成员的分组权限，分组本身保留
+func (s *SCIMService) DeleteGroup(ctx context.Context, id string) error {
+	g, err := s.getGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.setMembers(ctx, g.ID, nil)
+}
+
+func (s *SCIMService) applyGroupPatch(ctx context.Context, g *Group, op SCIMPatchOperation) error {
+	kind := strings.ToLower(strings.TrimSpace(op.Op))
+	path := strings.TrimSpace(op.Path)
+	lowerPath := strings.ToLower(path)
+
+	if path == "" {
+		if kind == "remove" {
+			return infraerrors.BadRequest(ErrSCIMNoTarget.Reason, "remove requires a path")
+		}
+		var in SCIMGroupInput
+		if err := json.Unmarshal(op.Value, &in); err != nil {
+			return infraerrors.BadRequest(ErrSCIMInvalidSyntax.Reason, "patch value must be an object when path is omitted")
+		}
+		if in.DisplayName != "" && !strings.EqualFold(strings.TrimSpace(in.DisplayName), g.Name) {
+			return infraerrors.BadRequest(ErrSCIMMutability.Reason, "group displayName is managed in sub2api")
+		}
+		if in.Members == nil {
+			return nil
+		}
+		if kind == "replace" {
+			return s.setMembers(ctx, g.ID, in.Members)
+		}
+		return s.changeMembers(ctx, g.ID, in.Members, true)
+	}
+
+	switch {
+	case lowerPath == "displayname":
+		name, err := scimParseString(op.Value)
+		if err != nil {
+			return err
+		}
+		if kind == "remove" || !strings.EqualFold(name, g.Name) {
+			return infraerrors.BadRequest(ErrSCIMMutability.Reason, "group displayName is managed in sub2api")
+		}
+		return nil
+	case lowerPath == "members":
+		var members []SCIMMultiValued
+		if len(op.Value) > 0 && string(op.Value) != "null" {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "members must be an array")
+			}
+		}
+		switch kind {
+		case "add":
+			return s.changeMembers(ctx, g.ID, members, true)
+		case "replace":
+			return s.setMembers(ctx, g.ID, members)
+		case "remove":
+			if members == nil {
+				return s.setMembers(ctx, g.ID, nil)
+			}
+			return s.changeMembers(ctx, g.ID, members, false)
+		}
+	case strings.HasPrefix(lowerPath, "members["):
+		// members[value eq "12"]：只允许 remove，按子过滤器选中成员
+		if kind != "remove" {
+			return infraerrors.BadRequest(ErrSCIMInvalidPath.Reason, "value filters on members are only supported for remove")
+		}
+		filter, err := ParseSCIMFilter(path)
+		if err != nil {
+			return infraerrors.BadRequest(ErrSCIMInvalidPath.Reason, infraerrors.Message(err))
+		}
+		current, err := s.repo.ListGroupMemberIDs(ctx, g.ID)
+		if err != nil {
+			return err
+		}
+		var selected []SCIMMultiValued
+		for _, uid := range current {
+			m := SCIMMultiValued{Value: strconv.FormatInt(uid, 10)}
+			if filter.Match(map[string]any{"members": []any{map[string]any{"value": m.Value}}}) {
+				selected = append(selected, m)
+			}
+		}
+		return s.changeMembers(ctx, g.ID, selected, false)
+	}
+	return infraerrors.BadRequest(ErrSCIMInvalidSyntax.Reason, fmt.Sprintf("unsupported patch op %q on %q", op.Op, path))
+}
+
+// setMembers 将分组成员整体替换为 members
+func (s *SCIMService) setMembers(ctx context.Context, groupID int64, members []SCIMMultiValued) error {
+	want, err := s.resolveMembers(ctx, members)
+	if err != nil {
+		return err
+	}
+	current, err := s.repo.ListGroupMemberIDs(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	wantSet := make(map[int64]struct{}, len(want))
+	for _, id := range want {
+		wantSet[id] = struct{}{}
+	}
+	currentSet := make(map[int64]struct{}, len(current))
+	for _, id := range current {
+		currentSet[id] = struct{}{}
+		if _, keep := wantSet[id]; !keep {
+			if err := s.removeMember(ctx, groupID, id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range want {
+		if _, exists := currentSet[id]; !exists {
+			if err := s.addMember(ctx, groupID, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SCIMService) changeMembers(ctx context.Context, groupID int64, members []SCIMMultiValued, add bool) error {
+	ids, err := s.resolveMembers(ctx, members)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if add {
+			err = s.addMember(ctx, groupID, id)
+		} else {
+			err = s.removeMember(ctx, groupID, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SCIMService) addMember(ctx context.Context, groupID, userID int64) error {
+	if err := s.userRepo.AddGroupToAllowedGroups(ctx, userID, groupID); err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, userID)
+	return nil
+}
+
+func (s *SCIMService) removeMember(ctx context.Context, groupID, userID int64) error {
+	if err := s.userRepo.RemoveGroupFromUserAllowedGroups(ctx, userID, groupID); err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, userID)
+	return nil
+}
+
+// resolveMembers 将成员 value 解析为用户 ID；未知或管理员用户视为无效值
+func (s *SCIMService) resolveMembers(ctx context.Context, members []SCIMMultiValued) ([]int64, error) {
+	seen := make(map[int64]struct{}, len(members))
+	out := make([]int64, 0, len(members))
+	for _, m := range members {
+		u, err := s.getUser(ctx, strings.TrimSpace(m.Value))
+		if errors.Is(err, ErrSCIMNotFound) {
+			return nil, infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, fmt.Sprintf("unknown member %q", m.Value))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := seen[u.ID]; dup {
+			continue
+		}
+		seen[u.ID] = struct{}{}
+		out = append(out, u.ID)
+	}
+	return out, nil
+}
+
+func (s *SCIMService) getGroup(ctx context.Context, id string) (*Group, error) {
+	groupID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || groupID <= 0 {
+		return nil, ErrSCIMNotFound
+	}
+	groups, err := s.exposedGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	g, ok := groups[groupID]
+	if !ok {
+		return nil, ErrSCIMNotFound
+	}
+	return g, nil
+}
+
+func (s *SCIMService) groupResource(ctx context.Context, g *Group) (*SCIMGroup, error) {
+	memberIDs, err := s.repo.ListGroupMemberIDs(ctx, g.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := &SCIMGroup{
+		Schemas:     []string{SCIMSchemaGroup},
+		ID:          strconv.FormatInt(g.ID, 10),
+		DisplayName: g.Name,
+		Members:     make([]SCIMMultiValued, 0, len(memberIDs)),
+		Meta:        scimMeta("Group", g.CreatedAt, g.UpdatedAt),
+	}
+	for _, uid := range memberIDs {
+		res.Members = append(res.Members, SCIMMultiValued{Value: strconv.FormatInt(uid, 10)})
+	}
+	return res, nil
+}
+
+// exposedGroups 返回作为 SCIM Group 暴露的专属分组：scim.group_ids 非空时取其交集
+func (s *SCIMService) exposedGroups(ctx context.Context) (map[int64]*Group, error) {
+	out := make(map[int64]*Group)
+	if len(s.cfg.GroupIDs) > 0 {
+		for _, id := range s.cfg.GroupIDs {
+			g, err := s.groupRepo.GetByID(ctx, id)
+			if errors.Is(err, ErrGroupNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if g.IsExclusive {
+				out[g.ID] = g
+			}
+		}
+		return out, nil
+	}
+	exclusive := true
+	for page := 1; ; page++ {
+		groups, result, err := s.groupRepo.ListWithFilters(ctx,
+			pagination.PaginationParams{Page: page, PageSize: scimScanPageSize}, "", "", "", &exclusive)
+		if err != nil {
+			return nil, err
+		}
+		for i := range groups {
+			out[groups[i].ID] = &groups[i]
+		}
+		if len(groups) < scimScanPageSize || result == nil || page >= result.Pages {
+			return out, nil
+		}
+	}
+}
+
+// ========== helpers ==========
+
+func parseSCIMListFilter(raw string) (SCIMFilter, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	return ParseSCIMFilter(raw)
+}
+
+// scimEqualityLookup 识别形如 attr eq "value" 的单条件过滤，返回小写属性名
+func scimEqualityLookup(f SCIMFilter) (string, string, bool) {
+	cmp, ok := f.(*scimCompareFilter)
+	if !ok || cmp.op != "eq" || len(cmp.path) != 1 {
+		return "", "", false
+	}
+	value, ok := cmp.value.(string)
+	if !ok {
+		return "", "", false
+	}
+	return strings.ToLower(cmp.path[0]), value, true
+}
+
+func scimResourceMap(res any) map[string]any {
+	raw, _ := json.Marshal(res)
+	var out map[string]any
+	_ = json.Unmarshal(raw, &out)
+	return out
+}
+
+func scimPage(matched []any, q SCIMListQuery) *SCIMListResponse {
+	start := q.StartIndex
+	if start < 1 {
+		start = 1
+	}
+	count := q.Count
+	if count <= 0 {
+		count = scimDefaultCount
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	resp := &SCIMListResponse{
+		Schemas:      []string{SCIMSchemaListResponse},
+		TotalResults: len(matched),
+		StartIndex:   start,
+		Resources:    []any{},
+	}
+	if start-1 < len(matched) {
+		end := start - 1 + count
+		if end > len(matched) {
+			end = len(matched)
+		}
+		resp.Resources = matched[start-1 : end]
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	return resp
+}
+
+func scimMeta(resourceType string, created, updated time.Time) SCIMMeta {
+	meta := SCIMMeta{ResourceType: resourceType}
+	if !created.IsZero() {
+		meta.Created = created.UTC().Format(time.RFC3339)
+	}
+	if !updated.IsZero() {
+		meta.LastModified = updated.UTC().Format(time.RFC3339)
+	}
+	return meta
+}
+
+func scimPrimaryEmail(emails []SCIMMultiValued) string {
+	for _, e := range emails {
+		if e.Primary {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	if len(emails) > 0 {
+		return strings.TrimSpace(emails[0].Value)
+	}
+	return ""
+}
+
+func scimParseString(raw json.RawMessage) (string, error) {
+	var v string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "expected a string value")
+	}
+	return strings.TrimSpace(v), nil
+}
+
+// scimParseBool 兼容部分 IdP（如 Entra ID）以字符串 "True"/"False" 发送布尔值
+func scimParseBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if v, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+			return v, nil
+		}
+	}
+	return false, infraerrors.BadRequest(ErrSCIMInvalidValue.Reason, "expected a boolean value")
+}
@@ -0,0 +1,435 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
+	"github.com/stretchr/testify/require"
+)
+
+type scimUserStoreStub struct {
+	users   map[int64]*User
+	updates int
+}
+
+func (s *scimUserStoreStub) GetByID(_ context.Context, id int64) (*User, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	cp := *u
+	cp.AllowedGroups = slices.Clone(u.AllowedGroups)
+	return &cp, nil
+}
+
+func (s *scimUserStoreStub) GetByEmail(ctx context.Context, email string) (*User, error) {
+	for id, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return s.GetByID(ctx, id)
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *scimUserStoreStub) Update(_ context.Context, user *User) error {
+	s.updates++
+	cp := *user
+	s.users[user.ID] = &cp
+	return nil
+}
+
+func (s *scimUserStoreStub) ListWithFilters(ctx context.Context, _ pagination.PaginationParams, filters UserListFilters) ([]User, *pagination.PaginationResult, error) {
+	var out []User
+	for _, id := range slices.Sorted(maps.Keys(s.users)) {
+		u, _ := s.GetByID(ctx, id)
+		if filters.Role == "" || u.Role == filters.Role {
+			out = append(out, *u)
+		}
+	}
+	return out, &pagination.PaginationResult{Total: int64(len(out)), Page: 1, Pages: 1}, nil
+}
+
+func (s *scimUserStoreStub) AddGroupToAllowedGroups(_ context.Context, userID int64, groupID int64) error {
+	u := s.users[userID]
+	if !slices.Contains(u.AllowedGroups, groupID) {
+		u.AllowedGroups = append(u.AllowedGroups, groupID)
+	}
+	return nil
+}
+
+func (s *scimUserStoreStub) RemoveGroupFromUserAllowedGroups(_ context.Context, userID int64, groupID int64) error {
+	u := s.users[userID]
+	u.AllowedGroups = slices.DeleteFunc(u.AllowedGroups, func(id int64) bool { return id == groupID })
+	return nil
+}
+
+type scimGroupStoreStub struct {
+	groups []Group
+}
+
+func (s *scimGroupStoreStub) GetByID(_ context.Context, id int64) (*Group, error) {
+	for i := range s.groups {
+		if s.groups[i].ID == id {
+			return &s.groups[i], nil
+		}
+	}
+	return nil, ErrGroupNotFound
+}
+
+func (s *scimGroupStoreStub) ListWithFilters(_ context.Context, _ pagination.PaginationParams, _, _, _ string, isExclusive *bool) ([]Group, *pagination.PaginationResult, error) {
+	var out []Group
+	for _, g := range s.groups {
+		if isExclusive == nil || g.IsExclusive == *isExclusive {
+			out = append(out, g)
+		}
+	}
+	return out, &pagination.PaginationResult{Total: int64(len(out)), Page: 1, Pages: 1}, nil
+}
+
+type scimRepoStub struct {
+	users       *scimUserStoreStub
+	externalIDs map[int64]string
+	keys        map[int64][]string
+}
+
+func (s *scimRepoStub) GetUserIDByExternalID(_ context.Context, externalID string) (int64, error) {
+	for id, ext := range s.externalIDs {
+		if ext == externalID {
+			return id, nil
+		}
+	}
+	return 0, ErrUserNotFound
+}
+
+func (s *scimRepoStub) ListExternalIDs(_ context.Context, userIDs []int64) (map[int64]string, error) {
+	out := map[int64]string{}
+	for _, id := range userIDs {
+		if ext, ok := s.externalIDs[id]; ok {
+			out[id] = ext
+		}
+	}
+	return out, nil
+}
+
+func (s *scimRepoStub) SetExternalID(_ context.Context, userID int64, externalID string) error {
+	if externalID == "" {
+		delete(s.externalIDs, userID)
+		return nil
+	}
+	for id, ext := range s.externalIDs {
+		if ext == externalID && id != userID {
+			return ErrSCIMUniqueness
+		}
+	}
+	s.externalIDs[userID] = externalID
+	return nil
+}
+
+func (s *scimRepoStub) ListGroupMemberIDs(_ context.Context, groupID int64) ([]int64, error) {
+	var out []int64
+	for id, u := range s.users.users {
+		if slices.Contains(u.AllowedGroups, groupID) {
+			out = append(out, id)
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func (s *scimRepoStub) DisableUserAPIKeys(_ context.Context, userID int64) ([]string, error) {
+	keys := s.keys[userID]
+	delete(s.keys, userID)
+	return keys, nil
+}
+
+type scimUserCreatorStub struct {
+	users  *scimUserStoreStub
+	nextID int64
+	inputs []*CreateUserInput
+}
+
+func (s *scimUserCreatorStub) CreateUser(_ context.Context, input *CreateUserInput) (*User, error) {
+	s.inputs = append(s.inputs, input)
+	s.nextID++
+	u := &User{ID: s.nextID, Email: input.Email, Username: input.Username, Role: RoleUser, Status: StatusActive, Concurrency: input.Concurrency}
+	cp := *u
+	s.users.users[u.ID] = &cp
+	return u, nil
+}
+
+type scimSessionRevokerStub struct {
+	revoked []int64
+}
+
+func (s *scimSessionRevokerStub) RevokeAllUserSessions(_ context.Context, userID int64) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+type scimInvalidatorStub struct {
+	keys    []string
+	userIDs []int64
+}
+
+func (s *scimInvalidatorStub) InvalidateAuthCacheByKey(_ context.Context, key string) {
+	s.keys = append(s.keys, key)
+}
+func (s *scimInvalidatorStub) InvalidateAuthCacheByGroupID(context.Context, int64) {}
+func (s *scimInvalidatorStub) InvalidateAuthCacheByUserID(_ context.Context, userID int64) {
+	s.userIDs = append(s.userIDs, userID)
+}
+
+type scimTestEnv struct {
+	svc      *SCIMService
+	users    *scimUserStoreStub
+	repo     *scimRepoStub
+	creator  *scimUserCreatorStub
+	sessions *scimSessionRevokerStub
+	inv      *scimInvalidatorStub
+}
+
+func newSCIMServiceForTest(t *testing.T) *scimTestEnv {
+	t.Helper()
+	users := &scimUserStoreStub{users: map[int64]*User{
+		1: {ID: 1, Email: "admin@corp.example", Username: "admin", Role: RoleAdmin, Status: StatusActive},
+		2: {ID: 2, Email: "alice@corp.example", Username: "Alice", Role: RoleUser, Status: StatusActive, AllowedGroups: []int64{10}},
+		3: {ID: 3, Email: "bob@corp.example", Username: "Bob", Role: RoleUser, Status: StatusActive},
+	}}
+	repo := &scimRepoStub{
+		users:       users,
+		externalIDs: map[int64]string{2: "okta-alice"},
+		keys:        map[int64][]string{2: {"sk-alice-1", "sk-alice-2"}},
+	}
+	env := &scimTestEnv{
+		users:    users,
+		repo:     repo,
+		creator:  &scimUserCreatorStub{users: users, nextID: 100},
+		sessions: &scimSessionRevokerStub{},
+		inv:      &scimInvalidatorStub{},
+	}
+	env.svc = &SCIMService{
+		cfg:                  config.SCIMConfig{Enabled: true, BearerToken: strings.Repeat("s", 40)},
+		defaultConcurrency:   5,
+		userRepo:             users,
+		groupRepo:            &scimGroupStoreStub{groups: []Group{{ID: 10, Name: "AI Team", IsExclusive: true}, {ID: 11, Name: "Research", IsExclusive: true}, {ID: 12, Name: "Public"}}},
+		repo:                 repo,
+		creator:              env.creator,
+		sessions:             env.sessions,
+		authCacheInvalidator: env.inv,
+	}
+	return env
+}
+
+func scimPatch(t *testing.T, ops ...string) *SCIMPatchRequest {
+	t.Helper()
+	var req SCIMPatchRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"schemas":["`+SCIMSchemaPatchOp+`"],"Operations":[`+strings.Join(ops, ",")+`]}`), &req))
+	return &req
+}
+
+func TestSCIMAuthenticate(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+	require.NoError(t, env.svc.Authenticate(strings.Repeat("s", 40)))
+	require.ErrorIs(t, env.svc.Authenticate("wrong"), ErrSCIMUnauthorized)
+	require.ErrorIs(t, env.svc.Authenticate(""), ErrSCIMUnauthorized)
+
+	env.svc.cfg.Enabled = false
+	require.ErrorIs(t, env.svc.Authenticate(strings.Repeat("s", 40)), ErrSCIMDisabled)
+}
+
+func TestSCIMDeleteUser_Deprovisions(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+
+	require.NoError(t, env.svc.DeleteUser(context.Background(), "2"))
+
+	require.Equal(t, StatusDisabled, env.users.users[2].Status)
+	require.Empty(t, env.repo.keys[2], "all api keys disabled")
+	require.Equal(t, []int64{2}, env.sessions.revoked)
+	require.Equal(t, []string{"sk-alice-1", "sk-alice-2"}, env.inv.keys)
+	require.Contains(t, env.inv.userIDs, int64(2))
+
+	user, err := env.svc.GetUser(context.Background(), "2")
+	require.NoError(t, err)
+	require.False(t, user.Active, "deprovisioned users remain visible as inactive")
+}
+
+func TestSCIMPatchUser_ActiveFalseDeprovisions(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+
+	// Entra ID 发送无 path 的 replace，且布尔值为字符串
+	user, err := env.svc.PatchUser(context.Background(), "2", scimPatch(t, `{"op":"Replace","value":{"active":"False"}}`))
+	require.NoError(t, err)
+	require.False(t, user.Active)
+	require.Equal(t, []int64{2}, env.sessions.revoked)
+	require.Len(t, env.inv.keys, 2)
+
+	// 重新启用只恢复账号，不恢复已吊销的 Key
+	user, err = env.svc.PatchUser(context.Background(), "2", scimPatch(t, `{"op":"replace","path":"active","value":true}`))
+	require.NoError(t, err)
+	require.True(t, user.Active)
+	require.Equal(t, StatusActive, env.users.users[2].Status)
+	require.Equal(t, []int64{2}, env.sessions.revoked)
+}
+
+func TestSCIMPatchUser_Attributes(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+
+	user, err := env.svc.PatchUser(context.Background(), "3", scimPatch(t,
+		`{"op":"replace","path":"emails[type eq \"work\"].value","value":"robert@corp.example"}`,
+		`{"op":"replace","path":"name.givenName","value":"Robert"}`,
+		`{"op":"replace","path":"name.familyName","value":"Smith"}`,
+		`{"op":"add","path":"externalId","value":"okta-bob"}`,
+		`{"op":"add","path":"title","value":"Engineer"}`,
+	))
+	require.NoError(t, err)
+	require.Equal(t, "robert@corp.example", user.UserName)
+	require.Equal(t, "Robert Smith", user.DisplayName)
+	require.Equal(t, "okta-bob", user.ExternalID)
+	require.True(t, user.Active)
+	require.Empty(t, env.sessions.revoked)
+
+	_, err = env.svc.PatchUser(context.Background(), "3", scimPatch(t, `{"op":"replace","path":"userName","value":"alice@corp.example"}`))
+	require.ErrorIs(t, err, ErrSCIMUniqueness)
+
+	_, err = env.svc.PatchUser(context.Background(), "3", scimPatch(t, `{"op":"remove","path":"userName"}`))
+	require.ErrorIs(t, err, ErrSCIMMutability)
+}
+
+func TestSCIMCreateUser(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+	active := true
+
+	user, err := env.svc.CreateUser(context.Background(), &SCIMUserInput{
+		UserName:   "carol",
+		ExternalID: "okta-carol",
+		Name:       &SCIMName{GivenName: "Carol", FamilyName: "Danvers"},
+		Emails:     []SCIMMultiValued{{Value: "carol@home.example"}, {Value: "carol@corp.example", Primary: true}},
+		Active:     &active,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "101", user.ID)
+	require.Equal(t, "carol@corp.example", user.UserName)
+	require.Equal(t, "Carol Danvers", user.DisplayName)
+	require.Equal(t, "okta-carol", user.ExternalID)
+	require.Len(t, env.creator.inputs, 1)
+	require.Equal(t, 5, env.creator.inputs[0].Concurrency)
+	require.Len(t, env.creator.inputs[0].Password, 64)
+
+	_, err = env.svc.CreateUser(context.Background(), &SCIMUserInput{UserName: "alice@corp.example"})
+	require.ErrorIs(t, err, ErrSCIMUniqueness)
+	_, err = env.svc.CreateUser(context.Background(), &SCIMUserInput{UserName: "dave@corp.example", ExternalID: "okta-alice"})
+	require.ErrorIs(t, err, ErrSCIMUniqueness)
+	_, err = env.svc.CreateUser(context.Background(), &SCIMUserInput{UserName: "no-email"})
+	require.ErrorIs(t, err, ErrSCIMInvalidValue)
+}
+
+func TestSCIMListUsers_FilterAndAdminsHidden(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+
+	resp, err := env.svc.ListUsers(context.Background(), SCIMListQuery{})
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.TotalResults, "admins are not exposed")
+
+	resp, err = env.svc.ListUsers(context.Background(), SCIMListQuery{Filter: `userName eq "ALICE@corp.example"`})
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.TotalResults)
+	alice := resp.Resources[0].(*SCIMUser)
+	require.Equal(t, "2", alice.ID)
+	require.Equal(t, []SCIMMultiValued{{Value: "10", Display: "AI Team"}}, alice.Groups)
+
+	resp, err = env.svc.ListUsers(context.Background(), SCIMListQuery{Filter: `externalId eq "okta-alice"`})
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.TotalResults)
+
+	resp, err = env.svc.ListUsers(context.Background(), SCIMListQuery{Filter: `userName eq "admin@corp.example"`})
+	require.NoError(t, err)
+	require.Zero(t, resp.TotalResults)
+
+	resp, err = env.svc.ListUsers(context.Background(), SCIMListQuery{Filter: `displayName sw "b"`, StartIndex: 1, Count: 10})
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.TotalResults)
+	require.Equal(t, "3", resp.Resources[0].(*SCIMUser).ID)
+
+	resp, err = env.svc.ListUsers(context.Background(), SCIMListQuery{StartIndex: 2, Count: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.TotalResults)
+	require.Equal(t, 1, resp.ItemsPerPage)
+	require.Equal(t, "3", resp.Resources[0].(*SCIMUser).ID)
+
+	_, err = env.svc.ListUsers(context.Background(), SCIMListQuery{Filter: `userName zz "x"`})
+	require.ErrorIs(t, err, ErrSCIMInvalidFilter)
+
+	_, err = env.svc.GetUser(context.Background(), "1")
+	require.ErrorIs(t, err, ErrSCIMNotFound)
+}
+
+func TestSCIMGroups_MapOntoExclusiveGroups(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+
+	resp, err := env.svc.ListGroups(context.Background(), SCIMListQuery{})
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.TotalResults, "only exclusive groups are exposed")
+
+	group, err := env.svc.CreateGroup(context.Background(), &SCIMGroupInput{
+		DisplayName: "research",
+		Members:     []SCIMMultiValued{{Value: "2"}, {Value: "3"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "11", group.ID)
+	require.Len(t, group.Members, 2)
+	require.Contains(t, env.users.users[3].AllowedGroups, int64(11))
+	require.ElementsMatch(t, []int64{2, 3}, env.inv.userIDs)
+
+	_, err = env.svc.CreateGroup(context.Background(), &SCIMGroupInput{DisplayName: "Unknown"})
+	require.ErrorIs(t, err, ErrSCIMInvalidValue)
+	_, err = env.svc.CreateGroup(context.Background(), &SCIMGroupInput{DisplayName: "Public"})
+	require.ErrorIs(t, err, ErrSCIMInvalidValue)
+	_, err = env.svc.CreateGroup(context.Background(), &SCIMGroupInput{DisplayName: "AI Team", Members: []SCIMMultiValued{{Value: "1"}}})
+	require.ErrorIs(t, err, ErrSCIMInvalidValue, "admins cannot be group members via scim")
+}
+
+func TestSCIMPatchGroup_Members(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+
+	group, err := env.svc.PatchGroup(context.Background(), "10", scimPatch(t,
+		`{"op":"add","path":"members","value":[{"value":"3"}]}`,
+		`{"op":"remove","path":"members[value eq \"2\"]"}`,
+	))
+	require.NoError(t, err)
+	require.Equal(t, []SCIMMultiValued{{Value: "3"}}, group.Members)
+	require.NotContains(t, env.users.users[2].AllowedGroups, int64(10))
+
+	// Entra ID 以 value 数组移除成员
+	group, err = env.svc.PatchGroup(context.Background(), "10", scimPatch(t,
+		`{"op":"remove","path":"members","value":[{"value":"3"}]}`,
+	))
+	require.NoError(t, err)
+	require.Empty(t, group.Members)
+
+	_, err = env.svc.PatchGroup(context.Background(), "10", scimPatch(t, `{"op":"replace","path":"displayName","value":"Renamed"}`))
+	require.ErrorIs(t, err, ErrSCIMMutability)
+
+	_, err = env.svc.PatchGroup(context.Background(), "12", scimPatch(t, `{"op":"add","path":"members","value":[{"value":"3"}]}`))
+	require.ErrorIs(t, err, ErrSCIMNotFound)
+}
+
+func TestSCIMDeleteGroup_RevokesMembership(t *testing.T) {
+	env := newSCIMServiceForTest(t)
+
+	require.NoError(t, env.svc.DeleteGroup(context.Background(), "10"))
+	require.Empty(t, env.users.users[2].AllowedGroups)
+	require.Equal(t, []int64{2}, env.inv.userIDs)
+
+	// 分组本身保留，仍可通过 SCIM 查询
+	group, err := env.svc.GetGroup(context.Background(), "10")
+	require.NoError(t, err)
+	require.Empty(t, group.Members)
+}
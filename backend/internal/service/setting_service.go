@@ -212,6 +212,11 @@ func (s *SettingService) GetPublicSettings(ctx context.Context) (*PublicSettings
 	if oidcProviderName == "" {
 		oidcProviderName = "OIDC"
 	}
+	ldapProviderName, samlProviderName := "LDAP", "SAML"
+	if s.cfg != nil {
+		ldapProviderName = firstNonEmptyString(strings.TrimSpace(s.cfg.LDAP.ProviderName), ldapProviderName)
+		samlProviderName = firstNonEmptyString(strings.TrimSpace(s.cfg.SAML.ProviderName), samlProviderName)
+	}
 
 	// Password reset requires email verification to be enabled
 	emailVerifyEnabled := settings[SettingKeyEmailVerifyEnabled] == "true"
@@ -258,6 +263,11 @@ func (s *SettingService) GetPublicSettings(ctx context.Context) (*PublicSettings
 		PaymentEnabled:                   settings[SettingPaymentEnabled] == "true",
 		OIDCOAuthEnabled:                 oidcEnabled,
 		OIDCOAuthProviderName:            oidcProviderName,
+		LDAPLoginEnabled:                 s.cfg != nil && s.cfg.LDAP.Enabled,
+		LDAPProviderName:                 ldapProviderName,
+		SAMLLoginEnabled:                 s.cfg != nil && s.cfg.SAML.Enabled,
+		SAMLProviderName:                 samlProviderName,
+		PasskeyLoginEnabled:              s.IsPasskeyEnabled(),
 		BalanceLowNotifyEnabled:          settings[SettingKeyBalanceLowNotifyEnabled] == "true",
 		AccountQuotaNotifyEnabled:        settings[SettingKeyAccountQuotaNotifyEnabled] == "true",
 		BalanceLowNotifyThreshold:        balanceLowNotifyThreshold,
@@ -314,6 +324,11 @@ func (s *SettingService) GetPublicSettingsForInjection(ctx context.Context) (any
 		PaymentEnabled                   bool            `json:"payment_enabled"`
 		OIDCOAuthEnabled                 bool            `json:"oidc_oauth_enabled"`
 		OIDCOAuthProviderName            string          `json:"oidc_oauth_provider_name"`
+		LDAPLoginEnabled                 bool            `json:"ldap_login_enabled"`
+		LDAPProviderName                 string          `json:"ldap_provider_name"`
+		SAMLLoginEnabled                 bool            `json:"saml_login_enabled"`
+		SAMLProviderName                 string          `json:"saml_provider_name"`
+		PasskeyLoginEnabled              bool            `json:"passkey_login_enabled"`
 		Version                          string          `json:"version,omitempty"`
 		BalanceLowNotifyEnabled          bool            `json:"balance_low_notify_enabled"`
 		AccountQuotaNotifyEnabled        bool            `json:"account_quota_notify_enabled"`
@@ -348,6 +363,11 @@ func (s *SettingService) GetPublicSettingsForInjection(ctx context.Context) (any
 		PaymentEnabled:                   settings.PaymentEnabled,
 		OIDCOAuthEnabled:                 settings.OIDCOAuthEnabled,
 		OIDCOAuthProviderName:            settings.OIDCOAuthProviderName,
+		LDAPLoginEnabled:                 settings.LDAPLoginEnabled,
+		LDAPProviderName:                 settings.LDAPProviderName,
+		SAMLLoginEnabled:                 settings.SAMLLoginEnabled,
+		SAMLProviderName:                 settings.SAMLProviderName,
+		PasskeyLoginEnabled:              settings.PasskeyLoginEnabled,
 		Version:                          s.version,
 		BalanceLowNotifyEnabled:          settings.BalanceLowNotifyEnabled,
 		AccountQuotaNotifyEnabled:        settings.AccountQuotaNotifyEnabled,
@@ -507,6 +527,7 @@ func (s *SettingService) UpdateSettings(ctx context.Context, settings *SystemSet
 	updates[SettingKeyFrontendURL] = settings.FrontendURL
 	updates[SettingKeyInvitationCodeEnabled] = strconv.FormatBool(settings.InvitationCodeEnabled)
 	updates[SettingKeyTotpEnabled] = strconv.FormatBool(settings.TotpEnabled)
+	updates[SettingKeyRequirePasskeyForAdmins] = strconv.FormatBool(settings.RequirePasskeyForAdmins)
 
 	// 邮件服务设置（只有非空才更新密码）
 	updates[SettingKeySMTPHost] = settings.SMTPHost
@@ -871,6 +892,23 @@ func (s *SettingService) IsTotpEnabled(ctx context.Context) bool {
 	return value == "true"
 }
 
+// IsPasskeyEnabled 检查是否在配置中启用了 WebAuthn 通行密钥
+func (s *SettingService) IsPasskeyEnabled() bool {
+	return s.cfg != nil && s.cfg.WebAuthn.Enabled
+}
+
+// IsPasskeyRequiredForAdmins 检查是否要求管理员使用通行密钥登录（仅在通行密钥启用时生效）
+func (s *SettingService) IsPasskeyRequiredForAdmins(ctx context.Context) bool {
+	if !s.IsPasskeyEnabled() {
+		return false
+	}
+	value, err := s.settingRepo.GetValue(ctx, SettingKeyRequirePasskeyForAdmins)
+	if err != nil {
+		return false // 默认关闭
+	}
+	return value == "true"
+}
+
 // IsTotpEncryptionKeyConfigured 检查 TOTP 加密密钥是否已手动配置
 // 只有手动配置了密钥才允许在管理后台启用 TOTP 功能
 func (s *SettingService) IsTotpEncryptionKeyConfigured() bool {
@@ -991,6 +1029,8 @@ func (s *SettingService) parseSettings(settings map[string]string) *SystemSettin
 		FrontendURL:                      settings[SettingKeyFrontendURL],
 		InvitationCodeEnabled:            settings[SettingKeyInvitationCodeEnabled] == "true",
 		TotpEnabled:                      settings[SettingKeyTotpEnabled] == "true",
+		PasskeyEnabled:                   s.IsPasskeyEnabled(),
+		RequirePasskeyForAdmins:          settings[SettingKeyRequirePasskeyForAdmins] == "true",
 		SMTPHost:                         settings[SettingKeySMTPHost],
 		SMTPUsername:                     settings[SettingKeySMTPUsername],
 		SMTPFrom:                         settings[SettingKeySMTPFrom],
@@ -2074,6 +2114,60 @@ func (s *SettingService) SetRectifierSettings(ctx context.Context, settings *Rec
 	return s.settingRepo.Set(ctx, SettingKeyRectifierSettings, string(data))
 }
 
+// GetFairShareSettings 获取分组内公平准入配置
+func (s *SettingService) GetFairShareSettings(ctx context.Context) (*FairShareSettings, error) {
+	value, err := s.settingRepo.GetValue(ctx, SettingKeyFairShareSettings)
+	if err != nil {
+		if errors.Is(err, ErrSettingNotFound) {
+			return DefaultFairShareSettings(), nil
+		}
+		return nil, fmt.Errorf("get fair share settings: %w", err)
+	}
+	if value == "" {
+		return DefaultFairShareSettings(), nil
+	}
+
+	settings := DefaultFairShareSettings()
+	if err := json.Unmarshal([]byte(value), settings); err != nil {
+		return DefaultFairShareSettings(), nil
+	}
+
+	return settings, nil
+}
+
+// SetFairShareSettings 设置分组内公平准入配置
+func (s *SettingService) SetFairShareSettings(ctx context.Context, settings *FairShareSettings) error {
+	if settings == nil {
+		return fmt.Errorf("settings cannot be nil")
+	}
+	if settings.BurstAllowance < 0 {
+		return fmt.Errorf("burst_allowance must be non-negative")
+	}
+	if settings.DefaultWeight <= 0 {
+		return fmt.Errorf("default_weight must be positive")
+	}
+	if settings.MaxWaitSeconds <= 0 || settings.MaxWaitSeconds > 600 {
+		return fmt.Errorf("max_wait_seconds must be between 1 and 600")
+	}
+	for userID, w := range settings.UserWeights {
+		if w <= 0 {
+			return fmt.Errorf("user_weights[%d] must be positive", userID)
+		}
+	}
+	for keyID, w := range settings.APIKeyWeights {
+		if w <= 0 {
+			return fmt.Errorf("api_key_weights[%d] must be positive", keyID)
+		}
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("marshal fair share settings: %w", err)
+	}
+
+	return s.settingRepo.Set(ctx, SettingKeyFairShareSettings, string(data))
+}
+
 // IsSignatureRectifierEnabled 判断签名整流是否启用（总开关 && 签名子开关）
 func (s *SettingService) IsSignatureRectifierEnabled(ctx context.Context) bool {
 	settings, err := s.GetRectifierSettings(ctx)
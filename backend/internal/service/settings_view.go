@@ -9,6 +9,8 @@ type SystemSettings struct {
 	FrontendURL                      string
 	InvitationCodeEnabled            bool
 	TotpEnabled                      bool // TOTP 双因素认证
+	PasskeyEnabled                   bool // 通行密钥（来自 config.webauthn，只读）
+	RequirePasskeyForAdmins          bool // 管理员必须使用通行密钥登录
 
 	SMTPHost               string
 	SMTPPort               int
@@ -156,6 +158,11 @@ type PublicSettings struct {
 	PaymentEnabled        bool
 	OIDCOAuthEnabled      bool
 	OIDCOAuthProviderName string
+	LDAPLoginEnabled      bool
+	LDAPProviderName      string
+	SAMLLoginEnabled      bool
+	SAMLProviderName      string
+	PasskeyLoginEnabled   bool
 	Version               string
 
 	BalanceLowNotifyEnabled     bool
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+)
+
+// 影子请求结果状态
+const (
+	ShadowStatusSuccess = "success"
+	ShadowStatusError   = "error"
+	// ShadowStatusSkipped 影子分组无可用账号槽位，未实际发出请求
+	ShadowStatusSkipped = "skipped"
+)
+
+const (
+	defaultShadowRuleMaxConcurrency = 4
+	maxShadowRuleMaxConcurrency     = 100
+	maxShadowRulesPerGroup          = 10
+	maxShadowErrorLength            = 500
+)
+
+var (
+	ErrShadowRuleNotFound       = infraerrors.NotFound("SHADOW_RULE_NOT_FOUND", "shadow rule not found")
+	ErrShadowRuleDuplicate      = infraerrors.Conflict("SHADOW_RULE_DUPLICATE", "a shadow rule for this target group already exists")
+	ErrShadowRuleLimitReached   = infraerrors.BadRequest("SHADOW_RULE_LIMIT_REACHED", "too many shadow rules for this group")
+	ErrShadowRuleSameGroup      = infraerrors.BadRequest("SHADOW_RULE_SAME_GROUP", "shadow group must differ from the source group")
+	ErrShadowRuleSampleRate     = infraerrors.BadRequest("SHADOW_RULE_INVALID_SAMPLE_RATE", "sample_rate must be greater than 0 and at most 1")
+	ErrShadowRuleConcurrency    = infraerrors.BadRequest("SHADOW_RULE_INVALID_CONCURRENCY", "max_concurrency must be between 1 and 100")
+	ErrShadowRuleGroupPlatform  = infraerrors.BadRequest("SHADOW_RULE_UNSUPPORTED_PLATFORM", "shadowing is only supported between anthropic groups")
+	ErrShadowRuleShadowNotFound = infraerrors.BadRequest("SHADOW_RULE_GROUP_NOT_FOUND", "shadow group not found")
+)
+
+// GroupShadowRule 分组影子路由规则：按采样率把匹配模型的请求复制一份发往候选分组
+type GroupShadowRule struct {
+	ID             int64     `json:"id"`
+	GroupID        int64     `json:"group_id"`
+	ShadowGroupID  int64     `json:"shadow_group_id"`
+	SampleRate     float64   `json:"sample_rate"`    // (0, 1]
+	ModelPatterns  []string  `json:"model_patterns"` // 为空表示全部模型，支持末尾 * 通配
+	MaxConcurrency int       `json:"max_concurrency"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// MatchesModel 判断请求模型是否命中规则的模型过滤
+func (r *GroupShadowRule) MatchesModel(model string) bool {
+	if len(r.ModelPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range r.ModelPatterns {
+		if matchModelPattern(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShadowUsageLog 一次影子请求与其对应主请求的对照记录（不计费）
+type ShadowUsageLog struct {
+	ID            int64
+	RuleID        int64
+	GroupID       int64
+	ShadowGroupID int64
+	UserID        int64
+	APIKeyID      int64
+	Model         string
+	Stream        bool
+
+	PrimaryAccountID           int64
+	PrimaryDurationMs          int
+	PrimaryFirstTokenMs        *int
+	PrimaryInputTokens         int
+	PrimaryOutputTokens        int
+	PrimaryCacheCreationTokens int
+	PrimaryCacheReadTokens     int
+	PrimaryCost                float64
+
+	ShadowAccountID           *int64
+	ShadowStatus              string
+	ShadowStatusCode          int
+	ShadowError               string
+	ShadowDurationMs          int
+	ShadowFirstTokenMs        *int
+	ShadowInputTokens         int
+	ShadowOutputTokens        int
+	ShadowCacheCreationTokens int
+	ShadowCacheReadTokens     int
+	ShadowCost                float64
+
+	CreatedAt time.Time
+}
+
+// ShadowSideStats 对照报告中单侧（主/影子）的汇总指标
+type ShadowSideStats struct {
+	Requests            int64   `json:"requests"`
+	Errors              int64   `json:"errors"`
+	ErrorRate           float64 `json:"error_rate"`
+	AvgDurationMs       float64 `json:"avg_duration_ms"`
+	P50DurationMs       float64 `json:"p50_duration_ms"`
+	P95DurationMs       float64 `json:"p95_duration_ms"`
+	AvgFirstTokenMs     float64 `json:"avg_first_token_ms"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	Cost                float64 `json:"cost"`
+}
+
+// ShadowModelComparison 按模型拆分的对照指标
+type ShadowModelComparison struct {
+	Model   string          `json:"model"`
+	Primary ShadowSideStats `json:"primary"`
+	Shadow  ShadowSideStats `json:"shadow"`
+}
+
+// ShadowComparisonReport 影子规则对照报告。
+// 影子复制发生在主请求成功之后，因此主侧错误数恒为 0；影子侧错误率不含 skipped 样本。
+// 两侧的延迟、token 与成本只统计影子成功的成对样本，保证同一批请求直接比较。
+type ShadowComparisonReport struct {
+	RuleID        int64                   `json:"rule_id"`
+	GroupID       int64                   `json:"group_id"`
+	ShadowGroupID int64                   `json:"shadow_group_id"`
+	StartTime     time.Time               `json:"start_time"`
+	EndTime       time.Time               `json:"end_time"`
+	Samples       int64                   `json:"samples"`
+	Skipped       int64                   `json:"skipped"`
+	Dropped       int64                   `json:"dropped"` // 本实例启动以来因影子并发预算用尽而放弃的采样数
+	Primary       ShadowSideStats         `json:"primary"`
+	Shadow        ShadowSideStats         `json:"shadow"`
+	ByModel       []ShadowModelComparison `json:"by_model"`
+}
+
+// ShadowRepository 影子规则与影子请求记录的数据访问接口
+type ShadowRepository interface {
+	ListRulesByGroup(ctx context.Context, groupID int64) ([]*GroupShadowRule, error)
+	ListEnabledRules(ctx context.Context) ([]*GroupShadowRule, error)
+	GetRule(ctx context.Context, id int64) (*GroupShadowRule, error)
+	CreateRule(ctx context.Context, rule *GroupShadowRule) error
+	UpdateRule(ctx context.Context, rule *GroupShadowRule) error
+	DeleteRule(ctx context.Context, groupID, id int64) error
+
+	InsertLog(ctx context.Context, log *ShadowUsageLog) error
+	// GetComparison 汇总 [start, end) 内规则的对照指标（不含 Dropped）
+	GetComparison(ctx context.Context, ruleID int64, start, end time.Time) (*ShadowComparisonReport, error)
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/ctxkey"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	shadowRuleLoadTimeout   = 5 * time.Second
+	shadowRecordTimeout     = 5 * time.Second
+	shadowResponseCaptureKB = 4
+)
+
+// shadowRequestHeaderAllowlist 复制到影子请求的请求头（不复制鉴权信息）
+var shadowRequestHeaderAllowlist = []string{"anthropic-beta", "anthropic-version", "user-agent", "content-type"}
+
+// shadowUpstream 影子请求依赖的网关能力（由 GatewayService 实现）
+type shadowUpstream interface {
+	SelectAccountForModel(ctx context.Context, groupID *int64, sessionHash string, requestedModel string) (*Account, error)
+	Forward(ctx context.Context, c *gin.Context, account *Account, parsed *ParsedRequest) (*ForwardResult, error)
+}
+
+// ShadowMirrorInput 主请求成功后用于生成影子请求的上下文
+type ShadowMirrorInput struct {
+	APIKey         *APIKey
+	GroupID        *int64
+	Body           []byte
+	Model          string
+	Stream         bool
+	PrimaryAccount *Account
+	PrimaryResult  *ForwardResult
+}
+
+// shadowRequest 脱离 gin.Context 后的影子请求快照
+type shadowRequest struct {
+	ctx     context.Context
+	url     string
+	header  http.Header
+	body    []byte
+	input   ShadowMirrorInput
+	groupID int64
+}
+
+// ShadowService 分组影子流量：按规则采样主请求，异步发往候选分组并记录对照指标。
+// 影子请求使用独立的并发预算，响应直接丢弃，结果只写入 shadow_usage_logs，不计费。
+type ShadowService struct {
+	repo               ShadowRepository
+	groupRepo          GroupRepository
+	upstream           shadowUpstream
+	concurrencyService *ConcurrencyService
+	billingService     *BillingService
+	cfg                *config.Config
+
+	globalSem chan struct{}
+	inflight  sync.Map // ruleID -> *atomic.Int32
+	dropped   sync.Map // ruleID -> *atomic.Int64
+
+	rulesMu       sync.RWMutex
+	rulesByGroup  map[int64][]*GroupShadowRule
+	rulesLoadedAt time.Time
+	rulesLoading  atomic.Bool
+
+	randFloat func() float64
+	wg        sync.WaitGroup
+}
+
+// NewShadowService 创建影子流量服务
+func NewShadowService(
+	repo ShadowRepository,
+	groupRepo GroupRepository,
+	gatewayService *GatewayService,
+	concurrencyService *ConcurrencyService,
+	billingService *BillingService,
+	cfg *config.Config,
+) *ShadowService {
+	s := &ShadowService{
+		repo:               repo,
+		groupRepo:          groupRepo,
+		concurrencyService: concurrencyService,
+		billingService:     billingService,
+		cfg:                cfg,
+		randFloat:          rand.Float64,
+	}
+	if gatewayService != nil {
+		s.upstream = gatewayService
+	}
+	maxConcurrency := 16
+	if cfg != nil && cfg.Shadow.MaxConcurrency > 0 {
+		maxConcurrency = cfg.Shadow.MaxConcurrency
+	}
+	s.globalSem = make(chan struct{}, maxConcurrency)
+	return s
+}
+
+// Wait 等待所有进行中的影子请求结束（用于测试与优雅退出）
+func (s *ShadowService) Wait() {
+	if s != nil {
+		s.wg.Wait()
+	}
+}
+
+func (s *ShadowService) enabled() bool {
+	return s != nil && s.upstream != nil && s.repo != nil && (s.cfg == nil || s.cfg.Shadow.Enabled)
+}
+
+// ---------- 规则管理 ----------
+
+// ListRules 列出分组的影子规则
+func (s *ShadowService) ListRules(ctx context.Context, groupID int64) ([]*GroupShadowRule, error) {
+	rules, err := s.repo.ListRulesByGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []*GroupShadowRule{}
+	}
+	return rules, nil
+}
+
+// CreateRule 为分组新增影子规则
+func (s *ShadowService) CreateRule(ctx context.Context, rule *GroupShadowRule) (*GroupShadowRule, error) {
+	if err := s.validateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.ListRulesByGroup(ctx, rule.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxShadowRulesPerGroup {
+		return nil, ErrShadowRuleLimitReached
+	}
+	for _, r := range existing {
+		if r.ShadowGroupID == rule.ShadowGroupID {
+			return nil, ErrShadowRuleDuplicate
+		}
+	}
+	if err := s.repo.CreateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	s.reloadRules(ctx)
+	return rule, nil
+}
+
+// UpdateRule 更新分组的影子规则（影子目标分组不可修改）
+func (s *ShadowService) UpdateRule(ctx context.Context, rule *GroupShadowRule) (*GroupShadowRule, error) {
+	existing, err := s.repo.GetRule(ctx, rule.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.GroupID != rule.GroupID {
+		return nil, ErrShadowRuleNotFound
+	}
+	rule.ShadowGroupID = existing.ShadowGroupID
+	if err := s.validateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	s.reloadRules(ctx)
+	return rule, nil
+}
+
+// DeleteRule 删除分组的影子规则（连同对照记录）
+func (s *ShadowService) DeleteRule(ctx context.Context, groupID, ruleID int64) error {
+	if err := s.repo.DeleteRule(ctx, groupID, ruleID); err != nil {
+		return err
+	}
+	s.reloadRules(ctx)
+	return nil
+}
+
+// GetComparisonReport 返回规则在时间范围内的主/影子对照报告
+func (s *ShadowService) GetComparisonReport(ctx context.Context, groupID, ruleID int64, start, end time.Time) (*ShadowComparisonReport, error) {
+	rule, err := s.repo.GetRule(ctx, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if rule.GroupID != groupID {
+		return nil, ErrShadowRuleNotFound
+	}
+	report, err := s.repo.GetComparison(ctx, ruleID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	report.RuleID = rule.ID
+	report.GroupID = rule.GroupID
+	report.ShadowGroupID = rule.ShadowGroupID
+	report.StartTime = start
+	report.EndTime = end
+	report.Dropped = s.droppedCounter(rule.ID).Load()
+	if report.ByModel == nil {
+		report.ByModel = []ShadowModelComparison{}
+	}
+	return report, nil
+}
+
+func (s *ShadowService) validateRule(ctx context.Context, rule *GroupShadowRule) error {
+	if rule.GroupID == rule.ShadowGroupID {
+		return ErrShadowRuleSameGroup
+	}
+	if rule.SampleRate <= 0 || rule.SampleRate > 1 {
+		return ErrShadowRuleSampleRate
+	}
+	if rule.MaxConcurrency == 0 {
+		rule.MaxConcurrency = defaultShadowRuleMaxConcurrency
+	}
+	if rule.MaxConcurrency < 1 || rule.MaxConcurrency > maxShadowRuleMaxConcurrency {
+		return ErrShadowRuleConcurrency
+	}
+	patterns := make([]string, 0, len(rule.ModelPatterns))
+	for _, p := range rule.ModelPatterns {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	rule.ModelPatterns = patterns
+
+	source, err := s.groupRepo.GetByID(ctx, rule.GroupID)
+	if err != nil {
+		return err
+	}
+	target, err := s.groupRepo.GetByID(ctx, rule.ShadowGroupID)
+	if err != nil {
+		if errors.Is(err, ErrGroupNotFound) {
+			return ErrShadowRuleShadowNotFound
+		}
+		return err
+	}
+	// 影子请求复用 Anthropic Messages 转发链路（含 Bedrock / API Key / OAuth 账号）
+	if source.Platform != PlatformAnthropic || target.Platform != PlatformAnthropic {
+		return ErrShadowRuleGroupPlatform
+	}
+	return nil
+}
+
+// ---------- 规则缓存 ----------
+
+// rulesFor 返回分组已启用的规则；缓存过期时异步刷新，热路径不等待数据库
+func (s *ShadowService) rulesFor(groupID int64) []*GroupShadowRule {
+	s.rulesMu.RLock()
+	rules := s.rulesByGroup[groupID]
+	stale := time.Since(s.rulesLoadedAt) >= s.ruleCacheTTL()
+	s.rulesMu.RUnlock()
+	if stale && s.rulesLoading.CompareAndSwap(false, true) {
+		go func() {
+			defer s.rulesLoading.Store(false)
+			ctx, cancel := context.WithTimeout(context.Background(), shadowRuleLoadTimeout)
+			defer cancel()
+			s.reloadRules(ctx)
+		}()
+	}
+	return rules
+}
+
+func (s *ShadowService) reloadRules(ctx context.Context) {
+	rules, err := s.repo.ListEnabledRules(ctx)
+	if err != nil {
+		logger.LegacyPrintf("service.shadow", "[Shadow] load rules failed: %v", err)
+		return
+	}
+	byGroup := make(map[int64][]*GroupShadowRule)
+	for _, r := range rules {
+		byGroup[r.GroupID] = append(byGroup[r.GroupID], r)
+	}
+	s.rulesMu.Lock()
+	s.rulesByGroup = byGroup
+	s.rulesLoadedAt = time.Now()
+	s.rulesMu.Unlock()
+}
+
+func (s *ShadowService) ruleCacheTTL() time.Duration {
+	if s.cfg != nil && s.cfg.Shadow.RuleCacheSeconds > 0 {
+		return time.Duration(s.cfg.Shadow.RuleCacheSeconds) * time.Second
+	}
+	return 15 * time.Second
+}
+
+func (s *ShadowService) requestTimeout() time.Duration {
+	if s.cfg != nil && s.cfg.Shadow.TimeoutSeconds > 0 {
+		return time.Duration(s.cfg.Shadow.TimeoutSeconds) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// ---------- 并发预算 ----------
+
+func (s *ShadowService) inflightCounter(ruleID int64) *atomic.Int32 {
+	v, _ := s.inflight.LoadOrStore(ruleID, &atomic.Int32{})
+	return v.(*atomic.Int32)
+}
+
+func (s *ShadowService) droppedCounter(ruleID int64) *atomic.Int64 {
+	v, _ := s.dropped.LoadOrStore(ruleID, &atomic.Int64{})
+	return v.(*atomic.Int64)
+}
+
+// tryAcquire 同时占用全局与规则级并发预算，任一不足时立即放弃
+func (s *ShadowService) tryAcquire(rule *GroupShadowRule) bool {
+	select {
+	case s.globalSem <- struct{}{}:
+	default:
+		return false
+	}
+	counter := s.inflightCounter(rule.ID)
+	if int(counter.Add(1)) > rule.MaxConcurrency {
+		counter.Add(-1)
+		<-s.globalSem
+		return false
+	}
+	return true
+}
+
+func (s *ShadowService) release(rule *GroupShadowRule) {
+	s.inflightCounter(rule.ID).Add(-1)
+	<-s.globalSem
+}
+
+// ---------- 镜像执行 ----------
+
+// Mirror 在主请求成功后按规则采样并异步发起影子请求；不阻塞、不影响主请求
+func (s *ShadowService) Mirror(c *gin.Context, in *ShadowMirrorInput) {
+	if !s.enabled() || c == nil || c.Request == nil || in == nil || in.GroupID == nil || in.PrimaryResult == nil || len(in.Body) == 0 {
+		return
+	}
+	rules := s.rulesFor(*in.GroupID)
+	if len(rules) == 0 {
+		return
+	}
+
+	var req *shadowRequest
+	for _, rule := range rules {
+		if !rule.Enabled || !rule.MatchesModel(in.Model) || s.randFloat() >= rule.SampleRate {
+			continue
+		}
+		if !s.tryAcquire(rule) {
+			s.droppedCounter(rule.ID).Add(1)
+			continue
+		}
+		if req == nil {
+			req = captureShadowRequest(c, in)
+		}
+		s.wg.Add(1)
+		go func(rule *GroupShadowRule) {
+			defer s.wg.Done()
+			defer s.release(rule)
+			defer func() {
+				if r := recover(); r != nil {
+					logger.LegacyPrintf("service.shadow", "[Shadow] rule %d panic: %v", rule.ID, r)
+				}
+			}()
+			s.execute(req, rule)
+		}(rule)
+	}
+}
+
+func captureShadowRequest(c *gin.Context, in *ShadowMirrorInput) *shadowRequest {
+	header := make(http.Header)
+	for _, key := range shadowRequestHeaderAllowlist {
+		if v := c.GetHeader(key); v != "" {
+			header.Set(key, v)
+		}
+	}
+	url := "http://localhost/v1/messages"
+	if c.Request.URL != nil {
+		url = "http://localhost" + c.Request.URL.RequestURI()
+	}
+	return &shadowRequest{
+		// 保留请求上下文中的客户端标识等值，但不随客户端断开而取消
+		ctx:     context.WithoutCancel(c.Request.Context()),
+		url:     url,
+		header:  header,
+		body:    bytes.Clone(in.Body),
+		input:   *in,
+		groupID: *in.GroupID,
+	}
+}
+
+func (s *ShadowService) execute(req *shadowRequest, rule *GroupShadowRule) {
+	ctx, cancel := context.WithTimeout(req.ctx, s.requestTimeout())
+	defer cancel()
+	// 影子分组按自身平台调度，忽略主请求的强制平台
+	ctx = context.WithValue(ctx, ctxkey.ForcePlatform, "")
+
+	log := s.newShadowLog(req, rule)
+	defer s.record(log)
+
+	shadowGroupID := rule.ShadowGroupID
+	parsed, err := ParseGatewayRequest(req.body, PlatformAnthropic)
+	if err != nil {
+		log.ShadowStatus = ShadowStatusError
+		log.ShadowError = truncateShadowError("parse request: " + err.Error())
+		return
+	}
+	parsed.GroupID = &shadowGroupID
+
+	account, err := s.upstream.SelectAccountForModel(ctx, &shadowGroupID, "", req.input.Model)
+	if err != nil {
+		log.ShadowStatus = ShadowStatusSkipped
+		log.ShadowError = truncateShadowError(err.Error())
+		return
+	}
+	accountID := account.ID
+	log.ShadowAccountID = &accountID
+
+	if s.concurrencyService != nil {
+		slot, err := s.concurrencyService.AcquireAccountSlot(ctx, account.ID, account.Concurrency)
+		if err != nil || slot == nil || !slot.Acquired {
+			log.ShadowStatus = ShadowStatusSkipped
+			log.ShadowError = "shadow account concurrency limit reached"
+			return
+		}
+		if slot.ReleaseFunc != nil {
+			defer slot.ReleaseFunc()
+		}
+	}
+
+	w := newLimitedResponseWriter(shadowResponseCaptureKB * 1024)
+	sc, _ := gin.CreateTestContext(w)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.url, bytes.NewReader(req.body))
+	if err != nil {
+		log.ShadowStatus = ShadowStatusError
+		log.ShadowError = truncateShadowError(err.Error())
+		return
+	}
+	httpReq.Header = req.header.Clone()
+	sc.Request = httpReq
+
+	start := time.Now()
+	result, err := s.upstream.Forward(ctx, sc, account, parsed)
+	log.ShadowDurationMs = int(time.Since(start).Milliseconds())
+	statusCode := sc.Writer.Status()
+
+	var failoverErr *UpstreamFailoverError
+	if errors.As(err, &failoverErr) {
+		statusCode = failoverErr.StatusCode
+	}
+	log.ShadowStatusCode = statusCode
+	if err != nil || statusCode >= http.StatusBadRequest || result == nil {
+		log.ShadowStatus = ShadowStatusError
+		switch {
+		case err != nil:
+			log.ShadowError = truncateShadowError(err.Error())
+		default:
+			log.ShadowError = truncateShadowError(fmt.Sprintf("upstream returned status %d", statusCode))
+		}
+		return
+	}
+
+	log.ShadowStatus = ShadowStatusSuccess
+	if result.Duration > 0 {
+		log.ShadowDurationMs = int(result.Duration.Milliseconds())
+	}
+	log.ShadowFirstTokenMs = result.FirstTokenMs
+	log.ShadowInputTokens = result.Usage.InputTokens
+	log.ShadowOutputTokens = result.Usage.OutputTokens
+	log.ShadowCacheCreationTokens = result.Usage.CacheCreationInputTokens
+	log.ShadowCacheReadTokens = result.Usage.CacheReadInputTokens
+	log.ShadowCost = s.upstreamCost(req.input.Model, result, account)
+}
+
+func (s *ShadowService) newShadowLog(req *shadowRequest, rule *GroupShadowRule) *ShadowUsageLog {
+	in := req.input
+	log := &ShadowUsageLog{
+		RuleID:        rule.ID,
+		GroupID:       req.groupID,
+		ShadowGroupID: rule.ShadowGroupID,
+		Model:         in.Model,
+		Stream:        in.Stream,
+	}
+	if in.APIKey != nil {
+		log.APIKeyID = in.APIKey.ID
+		log.UserID = in.APIKey.UserID
+	}
+	if in.PrimaryAccount != nil {
+		log.PrimaryAccountID = in.PrimaryAccount.ID
+	}
+	if r := in.PrimaryResult; r != nil {
+		log.PrimaryDurationMs = int(r.Duration.Milliseconds())
+		log.PrimaryFirstTokenMs = r.FirstTokenMs
+		log.PrimaryInputTokens = r.Usage.InputTokens
+		log.PrimaryOutputTokens = r.Usage.OutputTokens
+		log.PrimaryCacheCreationTokens = r.Usage.CacheCreationInputTokens
+		log.PrimaryCacheReadTokens = r.Usage.CacheReadInputTokens
+		log.PrimaryCost = s.upstreamCost(in.Model, r, in.PrimaryAccount)
+	}
+	return log
+}
+
+// upstreamCost 按模型标准价 × 账号计费倍率估算上游成本（不含分组/用户倍率，便于两侧直接比较）
+func (s *ShadowService) upstreamCost(model string, result *ForwardResult, account *Account) float64 {
+	if s.billingService == nil || result == nil {
+		return 0
+	}
+	tokens := UsageTokens{
+		InputTokens:           result.Usage.InputTokens,
+		OutputTokens:          result.Usage.OutputTokens,
+		CacheCreationTokens:   result.Usage.CacheCreationInputTokens,
+		CacheReadTokens:       result.Usage.CacheReadInputTokens,
+		CacheCreation5mTokens: result.Usage.CacheCreation5mTokens,
+		CacheCreation1hTokens: result.Usage.CacheCreation1hTokens,
+	}
+	cost, err := s.billingService.CalculateCost(model, tokens, 1.0)
+	if err != nil || cost == nil {
+		return 0
+	}
+	return cost.TotalCost * account.BillingRateMultiplier()
+}
+
+func (s *ShadowService) record(log *ShadowUsageLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowRecordTimeout)
+	defer cancel()
+	if err := s.repo.InsertLog(ctx, log); err != nil {
+		logger.LegacyPrintf("service.shadow", "[Shadow] record rule %d failed: %v", log.RuleID, err)
+	}
+}
+
+func truncateShadowError(msg string) string {
+	if len(msg) <= maxShadowErrorLength {
+		return msg
+	}
+	return msg[:maxShadowErrorLength]
+}
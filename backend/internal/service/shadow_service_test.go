@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+type shadowRepoStub struct {
+	mu     sync.Mutex
+	rules  map[int64]*GroupShadowRule
+	nextID int64
+	logs   []*ShadowUsageLog
+}
+
+func newShadowRepoStub() *shadowRepoStub {
+	return &shadowRepoStub{rules: make(map[int64]*GroupShadowRule)}
+}
+
+func (r *shadowRepoStub) ListRulesByGroup(_ context.Context, groupID int64) ([]*GroupShadowRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*GroupShadowRule
+	for _, rule := range r.rules {
+		if rule.GroupID == groupID {
+			cp := *rule
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *shadowRepoStub) ListEnabledRules(_ context.Context) ([]*GroupShadowRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*GroupShadowRule
+	for _, rule := range r.rules {
+		if rule.Enabled {
+			cp := *rule
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *shadowRepoStub) GetRule(_ context.Context, id int64) (*GroupShadowRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rule, ok := r.rules[id]
+	if !ok {
+		return nil, ErrShadowRuleNotFound
+	}
+	cp := *rule
+	return &cp, nil
+}
+
+func (r *shadowRepoStub) CreateRule(_ context.Context, rule *GroupShadowRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	rule.ID = r.nextID
+	cp := *rule
+	r.rules[rule.ID] = &cp
+	return nil
+}
+
+func (r *shadowRepoStub) UpdateRule(_ context.Context, rule *GroupShadowRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rules[rule.ID]; !ok {
+		return ErrShadowRuleNotFound
+	}
+	cp := *rule
+	r.rules[rule.ID] = &cp
+	return nil
+}
+
+func (r *shadowRepoStub) DeleteRule(_ context.Context, groupID, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rule, ok := r.rules[id]
+	if !ok || rule.GroupID != groupID {
+		return ErrShadowRuleNotFound
+	}
+	delete(r.rules, id)
+	return nil
+}
+
+func (r *shadowRepoStub) InsertLog(_ context.Context, log *ShadowUsageLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, log)
+	return nil
+}
+
+func (r *shadowRepoStub) GetComparison(_ context.Context, ruleID int64, _, _ time.Time) (*ShadowComparisonReport, error) {
+	return &ShadowComparisonReport{}, nil
+}
+
+type shadowGroupRepoStub struct {
+	GroupRepository
+	groups map[int64]*Group
+}
+
+func (r *shadowGroupRepoStub) GetByID(_ context.Context, id int64) (*Group, error) {
+	if g, ok := r.groups[id]; ok {
+		return g, nil
+	}
+	return nil, ErrGroupNotFound
+}
+
+type shadowUpstreamStub struct {
+	mu       sync.Mutex
+	calls    int
+	groupIDs []int64
+	err      error
+	status   int
+	block    chan struct{}
+}
+
+func (u *shadowUpstreamStub) SelectAccountForModel(_ context.Context, groupID *int64, _ string, _ string) (*Account, error) {
+	u.mu.Lock()
+	u.groupIDs = append(u.groupIDs, *groupID)
+	u.mu.Unlock()
+	return &Account{ID: 900 + *groupID, Concurrency: 1}, nil
+}
+
+func (u *shadowUpstreamStub) Forward(_ context.Context, c *gin.Context, _ *Account, _ *ParsedRequest) (*ForwardResult, error) {
+	if u.block != nil {
+		<-u.block
+	}
+	u.mu.Lock()
+	u.calls++
+	u.mu.Unlock()
+	if u.err != nil {
+		return nil, u.err
+	}
+	status := u.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	c.Status(status)
+	return &ForwardResult{
+		Usage:    ClaudeUsage{InputTokens: 12, OutputTokens: 34},
+		Duration: 250 * time.Millisecond,
+	}, nil
+}
+
+func newShadowServiceForTest(t *testing.T, repo *shadowRepoStub, upstream *shadowUpstreamStub) *ShadowService {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Shadow = config.ShadowConfig{Enabled: true, MaxConcurrency: 8, TimeoutSeconds: 5, RuleCacheSeconds: 3600}
+	groups := &shadowGroupRepoStub{groups: map[int64]*Group{
+		1: {ID: 1, Platform: PlatformAnthropic},
+		2: {ID: 2, Platform: PlatformAnthropic},
+		3: {ID: 3, Platform: PlatformOpenAI},
+	}}
+	svc := NewShadowService(repo, groups, nil, nil, nil, cfg)
+	svc.upstream = upstream
+	svc.randFloat = func() float64 { return 0.5 }
+	return svc
+}
+
+func newShadowMirrorContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	c.Request.Header.Set("anthropic-version", "2023-06-01")
+	c.Request.Header.Set("x-api-key", "sk-secret")
+	return c
+}
+
+func newShadowMirrorInput(model string) *ShadowMirrorInput {
+	groupID := int64(1)
+	return &ShadowMirrorInput{
+		APIKey:         &APIKey{ID: 7, UserID: 8},
+		GroupID:        &groupID,
+		Body:           []byte(`{"model":"` + model + `","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`),
+		Model:          model,
+		PrimaryAccount: &Account{ID: 100},
+		PrimaryResult:  &ForwardResult{Usage: ClaudeUsage{InputTokens: 10, OutputTokens: 30}, Duration: 200 * time.Millisecond},
+	}
+}
+
+func TestShadowServiceCreateRuleValidation(t *testing.T) {
+	ctx := context.Background()
+	svc := newShadowServiceForTest(t, newShadowRepoStub(), &shadowUpstreamStub{})
+
+	_, err := svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 1, SampleRate: 0.1})
+	require.ErrorIs(t, err, ErrShadowRuleSameGroup)
+
+	_, err = svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 2, SampleRate: 1.5})
+	require.ErrorIs(t, err, ErrShadowRuleSampleRate)
+
+	_, err = svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 3, SampleRate: 0.1})
+	require.ErrorIs(t, err, ErrShadowRuleGroupPlatform)
+
+	_, err = svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 99, SampleRate: 0.1})
+	require.ErrorIs(t, err, ErrShadowRuleShadowNotFound)
+
+	rule, err := svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 2, SampleRate: 0.1, ModelPatterns: []string{" claude-*", ""}, Enabled: true})
+	require.NoError(t, err)
+	require.Equal(t, defaultShadowRuleMaxConcurrency, rule.MaxConcurrency)
+	require.Equal(t, []string{"claude-*"}, rule.ModelPatterns)
+
+	_, err = svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 2, SampleRate: 0.2})
+	require.ErrorIs(t, err, ErrShadowRuleDuplicate)
+}
+
+func TestShadowServiceMirrorRecordsComparison(t *testing.T) {
+	ctx := context.Background()
+	repo := newShadowRepoStub()
+	upstream := &shadowUpstreamStub{}
+	svc := newShadowServiceForTest(t, repo, upstream)
+
+	_, err := svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 2, SampleRate: 1, ModelPatterns: []string{"claude-*"}, Enabled: true})
+	require.NoError(t, err)
+
+	svc.Mirror(newShadowMirrorContext(), newShadowMirrorInput("claude-sonnet-4"))
+	svc.Mirror(newShadowMirrorContext(), newShadowMirrorInput("gpt-4o")) // 模型不匹配
+	svc.Wait()
+
+	require.Equal(t, 1, upstream.calls)
+	require.Equal(t, []int64{2}, upstream.groupIDs)
+	require.Len(t, repo.logs, 1)
+	log := repo.logs[0]
+	require.Equal(t, ShadowStatusSuccess, log.ShadowStatus)
+	require.Equal(t, int64(1), log.GroupID)
+	require.Equal(t, int64(2), log.ShadowGroupID)
+	require.Equal(t, int64(100), log.PrimaryAccountID)
+	require.Equal(t, 10, log.PrimaryInputTokens)
+	require.Equal(t, 12, log.ShadowInputTokens)
+	require.Equal(t, 34, log.ShadowOutputTokens)
+	require.Equal(t, 250, log.ShadowDurationMs)
+}
+
+func TestShadowServiceMirrorSampling(t *testing.T) {
+	ctx := context.Background()
+	repo := newShadowRepoStub()
+	upstream := &shadowUpstreamStub{}
+	svc := newShadowServiceForTest(t, repo, upstream)
+
+	_, err := svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 2, SampleRate: 0.3, Enabled: true})
+	require.NoError(t, err)
+
+	svc.Mirror(newShadowMirrorContext(), newShadowMirrorInput("claude-sonnet-4")) // 0.5 >= 0.3，不采样
+	svc.randFloat = func() float64 { return 0.1 }
+	svc.Mirror(newShadowMirrorContext(), newShadowMirrorInput("claude-sonnet-4"))
+	svc.Wait()
+
+	require.Equal(t, 1, upstream.calls)
+}
+
+func TestShadowServiceMirrorRecordsUpstreamError(t *testing.T) {
+	ctx := context.Background()
+	repo := newShadowRepoStub()
+	upstream := &shadowUpstreamStub{err: errors.New("boom")}
+	svc := newShadowServiceForTest(t, repo, upstream)
+
+	_, err := svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 2, SampleRate: 1, Enabled: true})
+	require.NoError(t, err)
+
+	svc.Mirror(newShadowMirrorContext(), newShadowMirrorInput("claude-sonnet-4"))
+	svc.Wait()
+
+	require.Len(t, repo.logs, 1)
+	require.Equal(t, ShadowStatusError, repo.logs[0].ShadowStatus)
+	require.Equal(t, "boom", repo.logs[0].ShadowError)
+}
+
+func TestShadowServiceMirrorDropsWhenRuleBudgetExhausted(t *testing.T) {
+	ctx := context.Background()
+	repo := newShadowRepoStub()
+	upstream := &shadowUpstreamStub{block: make(chan struct{})}
+	svc := newShadowServiceForTest(t, repo, upstream)
+
+	rule, err := svc.CreateRule(ctx, &GroupShadowRule{GroupID: 1, ShadowGroupID: 2, SampleRate: 1, MaxConcurrency: 1, Enabled: true})
+	require.NoError(t, err)
+
+	svc.Mirror(newShadowMirrorContext(), newShadowMirrorInput("claude-sonnet-4"))
+	svc.Mirror(newShadowMirrorContext(), newShadowMirrorInput("claude-sonnet-4"))
+	close(upstream.block)
+	svc.Wait()
+
+	require.Equal(t, 1, upstream.calls)
+	require.Equal(t, int64(1), svc.droppedCounter(rule.ID).Load())
+
+	report, err := svc.GetComparisonReport(ctx, 1, rule.ID, time.Now().Add(-time.Hour), time.Now())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), report.Dropped)
+
+	_, err = svc.GetComparisonReport(ctx, 2, rule.ID, time.Now().Add(-time.Hour), time.Now())
+	require.ErrorIs(t, err, ErrShadowRuleNotFound)
+}
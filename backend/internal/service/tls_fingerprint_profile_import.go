@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/model"
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/tlsfingerprint"
+	"github.com/google/uuid"
+)
+
+const (
+	tlsCaptureDefaultListenAddr = ":0"
+	tlsCaptureDefaultTimeout    = 120 * time.Second
+	tlsCaptureMaxTimeout        = 600 * time.Second
+	tlsCaptureMaxActive         = 4
+	// 已结束的抓取结果保留一段时间供管理员查询
+	tlsCaptureResultRetention = 30 * time.Minute
+)
+
+var (
+	ErrTLSFingerprintSourceRequired = infraerrors.BadRequest("TLS_FINGERPRINT_SOURCE_REQUIRED", "one of ja3, ja4 or client_hello is required")
+	ErrTLSFingerprintCaptureLimit   = infraerrors.TooManyRequests("TLS_FINGERPRINT_CAPTURE_LIMIT", "too many active ClientHello captures")
+	ErrTLSFingerprintCaptureMissing = infraerrors.NotFound("TLS_FINGERPRINT_CAPTURE_NOT_FOUND", "capture session not found")
+	ErrTLSFingerprintProfileMissing = infraerrors.NotFound("TLS_FINGERPRINT_PROFILE_NOT_FOUND", "profile not found")
+)
+
+// TLSFingerprintSource 指纹来源：JA3 字符串、JA4（仅 ja4_r/ja4_ro 可导入）或原始 ClientHello（hex/base64）
+// 同时提供 JA3 与 raw JA4 时，JA3 提供密码套件/扩展顺序/曲线，JA4 补充签名算法/ALPN/版本
+type TLSFingerprintSource struct {
+	JA3         string `json:"ja3"`
+	JA4         string `json:"ja4"`
+	ClientHello string `json:"client_hello"`
+}
+
+// ImportTLSFingerprintInput 导入请求
+type ImportTLSFingerprintInput struct {
+	TLSFingerprintSource
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Save        bool    `json:"save"`
+}
+
+// TLSFingerprintImportResult 导入结果；Save=false 时 Profile.ID 为 0，仅用于预览
+type TLSFingerprintImportResult struct {
+	Profile     *model.TLSFingerprintProfile `json:"profile"`
+	Fingerprint tlsfingerprint.Fingerprint   `json:"fingerprint"`
+	Warnings    []string                     `json:"warnings,omitempty"`
+}
+
+// ImportProfile 从 JA3/JA4/ClientHello 解析出模板参数，可选直接保存
+func (s *TLSFingerprintProfileService) ImportProfile(ctx context.Context, input *ImportTLSFingerprintInput) (*TLSFingerprintImportResult, error) {
+	tp, warnings, err := profileFromSource(&input.TLSFingerprintSource)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &model.TLSFingerprintProfile{Name: strings.TrimSpace(input.Name), Description: input.Description}
+	profile.ApplyTLSProfile(tp)
+
+	ch, err := tlsfingerprint.ProfileClientHello(profile.ToTLSProfile(), "")
+	if err != nil {
+		return nil, infraerrors.BadRequest("TLS_FINGERPRINT_UNSUPPORTED", "imported profile cannot be rendered: "+err.Error())
+	}
+	result := &TLSFingerprintImportResult{Profile: profile, Fingerprint: tlsfingerprint.FingerprintOf(ch), Warnings: warnings}
+
+	if input.Save {
+		created, err := s.Create(ctx, profile)
+		if err != nil {
+			return nil, err
+		}
+		result.Profile = created
+	}
+	return result, nil
+}
+
+// ExportFingerprint 计算模板实际发送的 ClientHello 的 JA3/JA4，用于与抓包工具比对
+func (s *TLSFingerprintProfileService) ExportFingerprint(ctx context.Context, id int64, serverName string) (*tlsfingerprint.Fingerprint, error) {
+	profile, err := s.getExisting(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := tlsfingerprint.ProfileClientHello(profile.ToTLSProfile(), serverName)
+	if err != nil {
+		return nil, infraerrors.BadRequest("TLS_FINGERPRINT_UNSUPPORTED", "profile cannot be rendered: "+err.Error())
+	}
+	fp := tlsfingerprint.FingerprintOf(ch)
+	return &fp, nil
+}
+
+// DiffProfile 将模板生成的 ClientHello 与参考指纹逐字段比对
+// 参考优先级：client_hello > ja3 > ja4
+func (s *TLSFingerprintProfileService) DiffProfile(ctx context.Context, id int64, ref *TLSFingerprintSource) (*tlsfingerprint.DiffResult, error) {
+	profile, err := s.getExisting(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := tlsfingerprint.ProfileClientHello(profile.ToTLSProfile(), "")
+	if err != nil {
+		return nil, infraerrors.BadRequest("TLS_FINGERPRINT_UNSUPPORTED", "profile cannot be rendered: "+err.Error())
+	}
+
+	switch {
+	case strings.TrimSpace(ref.ClientHello) != "":
+		expected, err := parseClientHelloInput(ref.ClientHello)
+		if err != nil {
+			return nil, err
+		}
+		return tlsfingerprint.Diff(expected, actual), nil
+	case strings.TrimSpace(ref.JA3) != "":
+		res, err := tlsfingerprint.DiffJA3(ref.JA3, actual)
+		if err != nil {
+			return nil, infraerrors.BadRequest("INVALID_JA3", err.Error())
+		}
+		return res, nil
+	case strings.TrimSpace(ref.JA4) != "":
+		res, err := tlsfingerprint.DiffJA4(ref.JA4, actual)
+		if err != nil {
+			return nil, infraerrors.BadRequest("INVALID_JA4", err.Error())
+		}
+		return res, nil
+	default:
+		return nil, ErrTLSFingerprintSourceRequired
+	}
+}
+
+func (s *TLSFingerprintProfileService) getExisting(ctx context.Context, id int64) (*model.TLSFingerprintProfile, error) {
+	profile, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, ErrTLSFingerprintProfileMissing
+	}
+	return profile, nil
+}
+
+func profileFromSource(src *TLSFingerprintSource) (*tlsfingerprint.Profile, []string, error) {
+	ja3, ja4, raw := strings.TrimSpace(src.JA3), strings.TrimSpace(src.JA4), strings.TrimSpace(src.ClientHello)
+
+	if raw != "" {
+		ch, err := parseClientHelloInput(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ch.ToProfile(""), nil, nil
+	}
+
+	var ja4fp *tlsfingerprint.JA4Fingerprint
+	if ja4 != "" {
+		var err error
+		if ja4fp, err = tlsfingerprint.ParseJA4(ja4); err != nil {
+			return nil, nil, infraerrors.BadRequest("INVALID_JA4", err.Error())
+		}
+	}
+
+	switch {
+	case ja3 != "":
+		tp, err := tlsfingerprint.ParseJA3(ja3)
+		if err != nil {
+			return nil, nil, infraerrors.BadRequest("INVALID_JA3", err.Error())
+		}
+		var warnings []string
+		if ja4fp != nil && !ja4fp.Hashed {
+			// JA3 不包含签名算法/ALPN/版本，由 raw JA4 补充
+			if ja4tp, err := ja4fp.ToProfile(); err == nil {
+				tp.SignatureAlgorithms = ja4tp.SignatureAlgorithms
+				tp.ALPNProtocols = ja4tp.ALPNProtocols
+				tp.SupportedVersions = ja4tp.SupportedVersions
+			}
+		} else {
+			warnings = append(warnings, "JA3 does not carry signature algorithms, ALPN or supported versions; built-in defaults are used")
+		}
+		if ja4fp != nil && ja4fp.Hashed {
+			if ch, err := tlsfingerprint.ProfileClientHello(tp, ""); err == nil && !ja4fp.Matches(ch) {
+				warnings = append(warnings, "imported profile JA4 "+ch.JA4()+" does not match the provided JA4")
+			}
+		}
+		return tp, warnings, nil
+	case ja4fp != nil:
+		tp, err := ja4fp.ToProfile()
+		if err != nil {
+			return nil, nil, infraerrors.BadRequest("INVALID_JA4", err.Error())
+		}
+		return tp, []string{"JA4 does not carry curves or point formats; built-in defaults are used"}, nil
+	default:
+		return nil, nil, ErrTLSFingerprintSourceRequired
+	}
+}
+
+// parseClientHelloInput 解析 hex（允许空白/冒号分隔）或 base64 编码的 ClientHello
+func parseClientHelloInput(s string) (*tlsfingerprint.ClientHello, error) {
+	cleaned := strings.NewReplacer(" ", "", "\n", "", "\r", "", "\t", "", ":", "").Replace(strings.TrimSpace(s))
+	data, err := hex.DecodeString(cleaned)
+	if err != nil {
+		if data, err = base64.StdEncoding.DecodeString(cleaned); err != nil {
+			return nil, infraerrors.BadRequest("INVALID_CLIENT_HELLO", "client_hello must be hex or base64 encoded")
+		}
+	}
+	ch, err := tlsfingerprint.ParseClientHello(data)
+	if err != nil {
+		return nil, infraerrors.BadRequest("INVALID_CLIENT_HELLO", err.Error())
+	}
+	return ch, nil
+}
+
+// --- ClientHello 抓取 ---
+
+// StartTLSCaptureInput 抓取请求；ListenAddr 为空时监听随机端口
+type StartTLSCaptureInput struct {
+	ListenAddr     string `json:"listen_addr"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// TLSFingerprintCapture 抓取会话状态
+type TLSFingerprintCapture struct {
+	ID          string                       `json:"id"`
+	Addr        string                       `json:"addr"`
+	Status      string                       `json:"status"` // pending / captured / failed
+	ExpiresAt   time.Time                    `json:"expires_at"`
+	ClientAddr  string                       `json:"client_addr,omitempty"`
+	ClientHello string                       `json:"client_hello,omitempty"` // hex，可直接提交给 import 保存
+	Fingerprint *tlsfingerprint.Fingerprint  `json:"fingerprint,omitempty"`
+	Profile     *model.TLSFingerprintProfile `json:"profile,omitempty"`
+	Error       string                       `json:"error,omitempty"`
+}
+
+// StartCapture 启动一个临时 TLS 监听，记录第一个连接上来的客户端的 ClientHello
+func (s *TLSFingerprintProfileService) StartCapture(_ context.Context, input *StartTLSCaptureInput) (*TLSFingerprintCapture, error) {
+	addr := strings.TrimSpace(input.ListenAddr)
+	if addr == "" {
+		addr = tlsCaptureDefaultListenAddr
+	}
+	timeout := tlsCaptureDefaultTimeout
+	if input.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(input.TimeoutSeconds)*time.Second, tlsCaptureMaxTimeout)
+	}
+	return s.captures.start(addr, timeout)
+}
+
+// GetCapture 查询抓取会话状态
+func (s *TLSFingerprintProfileService) GetCapture(_ context.Context, id string) (*TLSFingerprintCapture, error) {
+	return s.captures.get(id)
+}
+
+type tlsCaptureEntry struct {
+	server    *tlsfingerprint.CaptureServer
+	addr      string
+	expiresAt time.Time
+}
+
+type tlsFingerprintCaptureRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*tlsCaptureEntry
+}
+
+func newTLSFingerprintCaptureRegistry() *tlsFingerprintCaptureRegistry {
+	return &tlsFingerprintCaptureRegistry{entries: make(map[string]*tlsCaptureEntry)}
+}
+
+func (r *tlsFingerprintCaptureRegistry) start(addr string, timeout time.Duration) (*TLSFingerprintCapture, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(time.Now())
+
+	active := 0
+	for _, e := range r.entries {
+		select {
+		case <-e.server.Done():
+		default:
+			active++
+		}
+	}
+	if active >= tlsCaptureMaxActive {
+		return nil, ErrTLSFingerprintCaptureLimit
+	}
+
+	server, err := tlsfingerprint.StartCapture(addr, timeout)
+	if err != nil {
+		return nil, infraerrors.BadRequest("TLS_FINGERPRINT_CAPTURE_LISTEN_FAILED", err.Error())
+	}
+	id := uuid.NewString()
+	entry := &tlsCaptureEntry{server: server, addr: server.Addr(), expiresAt: time.Now().Add(timeout)}
+	r.entries[id] = entry
+	return entry.view(id), nil
+}
+
+func (r *tlsFingerprintCaptureRegistry) get(id string) (*TLSFingerprintCapture, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(time.Now())
+	entry, ok := r.entries[id]
+	if !ok {
+		return nil, ErrTLSFingerprintCaptureMissing
+	}
+	return entry.view(id), nil
+}
+
+func (r *tlsFingerprintCaptureRegistry) pruneLocked(now time.Time) {
+	for id, e := range r.entries {
+		if now.After(e.expiresAt.Add(tlsCaptureResultRetention)) {
+			_ = e.server.Close()
+			delete(r.entries, id)
+		}
+	}
+}
+
+func (e *tlsCaptureEntry) view(id string) *TLSFingerprintCapture {
+	out := &TLSFingerprintCapture{ID: id, Addr: e.addr, Status: "pending", ExpiresAt: e.expiresAt}
+	select {
+	case <-e.server.Done():
+	default:
+		return out
+	}
+
+	hello, raw, remote, err := e.server.Result()
+	if err != nil {
+		out.Status = "failed"
+		out.Error = err.Error()
+		return out
+	}
+	fp := tlsfingerprint.FingerprintOf(hello)
+	profile := &model.TLSFingerprintProfile{}
+	profile.ApplyTLSProfile(hello.ToProfile(""))
+	out.Status = "captured"
+	out.ClientAddr = remote
+	out.ClientHello = hex.EncodeToString(raw)
+	out.Fingerprint = &fp
+	out.Profile = profile
+	return out
+}
@@ -0,0 +1,62 @@
+//go:build unit
+
+package service
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/tlsfingerprint"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileFromSource_JA3MergedWithRawJA4(t *testing.T) {
+	def, err := tlsfingerprint.ProfileClientHello(nil, "")
+	require.NoError(t, err)
+
+	tp, warnings, err := profileFromSource(&TLSFingerprintSource{JA3: def.JA3(), JA4: def.JA4Raw(true)})
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+	require.Equal(t, def.CipherSuites, tp.CipherSuites)
+	require.Equal(t, def.SignatureAlgorithms, tp.SignatureAlgorithms)
+	require.Equal(t, []string{"http/1.1"}, tp.ALPNProtocols)
+
+	ch, err := tlsfingerprint.ProfileClientHello(tp, "")
+	require.NoError(t, err)
+	require.Equal(t, def.JA4(), ch.JA4())
+}
+
+func TestProfileFromSource_JA3OnlyWarnsAndChecksHashedJA4(t *testing.T) {
+	def, err := tlsfingerprint.ProfileClientHello(nil, "")
+	require.NoError(t, err)
+
+	_, warnings, err := profileFromSource(&TLSFingerprintSource{JA3: def.JA3(), JA4: "t13d1714h1_000000000000_000000000000"})
+	require.NoError(t, err)
+	require.Len(t, warnings, 2)
+}
+
+func TestProfileFromSource_Errors(t *testing.T) {
+	_, _, err := profileFromSource(&TLSFingerprintSource{})
+	require.ErrorIs(t, err, ErrTLSFingerprintSourceRequired)
+
+	_, _, err = profileFromSource(&TLSFingerprintSource{JA4: "t13d1714h1_5b57614c22b0_7baf387fc6ff"})
+	require.True(t, infraerrors.IsBadRequest(err))
+
+	_, _, err = profileFromSource(&TLSFingerprintSource{ClientHello: "not-hex-or-base64!"})
+	require.True(t, infraerrors.IsBadRequest(err))
+}
+
+func TestParseClientHelloInput_HexAndBase64(t *testing.T) {
+	// 最小合法 ClientHello：TLS1.2、单个密码套件、无扩展
+	body := append([]byte{0x03, 0x03}, make([]byte, 32)...)
+	body = append(body, 0x00, 0x00, 0x02, 0x13, 0x01, 0x01, 0x00)
+	msg := append([]byte{0x01, 0x00, 0x00, byte(len(body))}, body...)
+
+	for _, in := range []string{hex.EncodeToString(msg), base64.StdEncoding.EncodeToString(msg)} {
+		ch, err := parseClientHelloInput(in)
+		require.NoError(t, err)
+		require.Equal(t, []uint16{0x1301}, ch.CipherSuites)
+	}
+}
@@ -37,6 +37,9 @@ type TLSFingerprintProfileService struct {
 	// 本地 ID→Profile 映射缓存，用于 DoWithTLS 热路径快速查找
 	localCache map[int64]*model.TLSFingerprintProfile
 	localMu    sync.RWMutex
+
+	// 进行中的 ClientHello 抓取会话
+	captures *tlsFingerprintCaptureRegistry
 }
 
 // NewTLSFingerprintProfileService 创建 TLS 指纹模板服务
@@ -48,6 +51,7 @@ func NewTLSFingerprintProfileService(
 		repo:       repo,
 		cache:      cache,
 		localCache: make(map[int64]*model.TLSFingerprintProfile),
+		captures:   newTLSFingerprintCaptureRegistry(),
 	}
 
 	ctx := context.Background()
@@ -24,6 +24,18 @@ func (c *CompositeTokenCacheInvalidator) InvalidateToken(ctx context.Context, ac
 	if c == nil || c.cache == nil || account == nil {
 		return nil
 	}
+	if account.IsVertex() {
+		if err := c.cache.DeleteAccessToken(ctx, VertexTokenCacheKey(account)); err != nil {
+			slog.Warn("token_cache_delete_failed", "account_id", account.ID, "error", err)
+		}
+		return nil
+	}
+	if account.IsAzureEntraAuth() {
+		if err := c.cache.DeleteAccessToken(ctx, AzureOpenAITokenCacheKey(account)); err != nil {
+			slog.Warn("token_cache_delete_failed", "account_id", account.ID, "error", err)
+		}
+		return nil
+	}
 	if account.Type != AccountTypeOAuth {
 		return nil
 	}
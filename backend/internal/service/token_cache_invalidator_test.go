@@ -545,3 +545,39 @@ func TestCheckTokenVersion_NilRepo(t *testing.T) {
 	_, isStale := CheckTokenVersion(context.Background(), account, nil)
 	require.False(t, isStale) // nil repo，默认允许缓存
 }
+
+func TestCompositeTokenCacheInvalidator_Vertex(t *testing.T) {
+	cache := &geminiTokenCacheStub{}
+	invalidator := NewCompositeTokenCacheInvalidator(cache)
+	account := &Account{
+		ID:       11,
+		Platform: PlatformGemini,
+		Type:     AccountTypeVertex,
+		Credentials: map[string]any{
+			"service_account_json": `{"type":"service_account"}`,
+		},
+	}
+
+	err := invalidator.InvalidateToken(context.Background(), account)
+	require.NoError(t, err)
+	require.Equal(t, []string{VertexTokenCacheKey(account)}, cache.deletedKeys)
+}
+
+func TestCompositeTokenCacheInvalidator_AzureEntra(t *testing.T) {
+	cache := &geminiTokenCacheStub{}
+	invalidator := NewCompositeTokenCacheInvalidator(cache)
+	account := &Account{
+		ID:       12,
+		Platform: PlatformOpenAI,
+		Type:     AccountTypeAzure,
+		Credentials: map[string]any{
+			"auth_mode":       "entra",
+			"azure_tenant_id": "tenant",
+			"azure_client_id": "client",
+		},
+	}
+
+	err := invalidator.InvalidateToken(context.Background(), account)
+	require.NoError(t, err)
+	require.Equal(t, []string{AzureOpenAITokenCacheKey(account)}, cache.deletedKeys)
+}
@@ -149,23 +149,8 @@ func (s *TotpService) InitiateSetup(ctx context.Context, userID int64, emailCode
 		return nil, ErrTotpAlreadyEnabled
 	}
 
-	// Verify identity based on email verification setting
-	if s.settingService.IsEmailVerifyEnabled(ctx) {
-		// Email verification enabled - verify email code
-		if emailCode == "" {
-			return nil, ErrVerifyCodeRequired
-		}
-		if err := s.emailService.VerifyCode(ctx, user.Email, emailCode); err != nil {
-			return nil, err
-		}
-	} else {
-		// Email verification disabled - verify password
-		if password == "" {
-			return nil, ErrPasswordRequired
-		}
-		if !user.CheckPassword(password) {
-			return nil, ErrPasswordIncorrect
-		}
+	if err := s.verifyIdentity(ctx, user, emailCode, password); err != nil {
+		return nil, err
 	}
 
 	// Generate a new TOTP key
@@ -296,23 +281,8 @@ func (s *TotpService) Disable(ctx context.Context, userID int64, emailCode, pass
 		return ErrTotpNotSetup
 	}
 
-	// Verify identity based on email verification setting
-	if s.settingService.IsEmailVerifyEnabled(ctx) {
-		// Email verification enabled - verify email code
-		if emailCode == "" {
-			return ErrVerifyCodeRequired
-		}
-		if err := s.emailService.VerifyCode(ctx, user.Email, emailCode); err != nil {
-			return err
-		}
-	} else {
-		// Email verification disabled - verify password
-		if password == "" {
-			return ErrPasswordRequired
-		}
-		if !user.CheckPassword(password) {
-			return ErrPasswordIncorrect
-		}
+	if err := s.verifyIdentity(ctx, user, emailCode, password); err != nil {
+		return err
 	}
 
 	// Disable TOTP
@@ -330,8 +300,7 @@ func (s *TotpService) VerifyCode(ctx context.Context, userID int64, code string)
 		"code_len", len(code))
 
 	// Check rate limiting
-	attempts, err := s.cache.GetVerifyAttempts(ctx, userID)
-	if err == nil && attempts >= maxTotpAttempts {
+	if s.tooManyAttempts(ctx, userID) {
 		return ErrTotpTooManyAttempts
 	}
 
@@ -385,16 +354,58 @@ func (s *TotpService) VerifyCode(ctx context.Context, userID int64, code string)
 
 	if !valid {
 		// Increment failed attempts
-		_, _ = s.cache.IncrementVerifyAttempts(ctx, userID)
+		s.recordFailedAttempt(ctx, userID)
 		return ErrTotpInvalidCode
 	}
 
 	// Clear attempt counter on success
-	_ = s.cache.ClearVerifyAttempts(ctx, userID)
+	s.clearAttempts(ctx, userID)
 
 	return nil
 }
 
+// VerifyIdentity re-authenticates a logged-in user before sensitive 2FA changes
+// (passkey registration, recovery code regeneration). Uses the same method as TOTP setup.
+func (s *TotpService) VerifyIdentity(ctx context.Context, userID int64, emailCode, password string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	return s.verifyIdentity(ctx, user, emailCode, password)
+}
+
+// verifyIdentity verifies the email code when email verification is enabled, otherwise the password
+func (s *TotpService) verifyIdentity(ctx context.Context, user *User, emailCode, password string) error {
+	if s.settingService.IsEmailVerifyEnabled(ctx) {
+		if emailCode == "" {
+			return ErrVerifyCodeRequired
+		}
+		return s.emailService.VerifyCode(ctx, user.Email, emailCode)
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if !user.CheckPassword(password) {
+		return ErrPasswordIncorrect
+	}
+	return nil
+}
+
+// tooManyAttempts / recordFailedAttempt / clearAttempts share one failure counter
+// across all second factors (TOTP codes and recovery codes).
+func (s *TotpService) tooManyAttempts(ctx context.Context, userID int64) bool {
+	attempts, err := s.cache.GetVerifyAttempts(ctx, userID)
+	return err == nil && attempts >= maxTotpAttempts
+}
+
+func (s *TotpService) recordFailedAttempt(ctx context.Context, userID int64) {
+	_, _ = s.cache.IncrementVerifyAttempts(ctx, userID)
+}
+
+func (s *TotpService) clearAttempts(ctx context.Context, userID int64) {
+	_ = s.cache.ClearVerifyAttempts(ctx, userID)
+}
+
 // CreateLoginSession creates a temporary login session for 2FA
 func (s *TotpService) CreateLoginSession(ctx context.Context, userID int64, email string) (string, error) {
 	// Generate a random temp token
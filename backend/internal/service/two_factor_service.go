@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/go-webauthn/webauthn/protocol"
+
+	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+)
+
+// 登录第二步可用的验证方式
+const (
+	TwoFactorMethodTotp         = "totp"
+	TwoFactorMethodPasskey      = "passkey"
+	TwoFactorMethodRecoveryCode = "recovery_code"
+)
+
+var (
+	ErrTwoFactorMethodNotAllowed = infraerrors.BadRequest("TWO_FACTOR_METHOD_NOT_ALLOWED", "this verification method is not available for the account")
+	ErrTwoFactorCodeRequired     = infraerrors.BadRequest("TWO_FACTOR_CODE_REQUIRED", "totp_code, recovery_code or webauthn is required")
+)
+
+// TwoFactorRequirement 密码登录后需要的第二步验证；Methods 为空表示无需第二步
+type TwoFactorRequirement struct {
+	Methods []string
+	// PasskeyRequired: 管理员强制通行密钥策略生效（此时不接受 TOTP）
+	PasskeyRequired bool
+}
+
+// Required 是否需要第二步验证
+func (r *TwoFactorRequirement) Required() bool {
+	return r != nil && len(r.Methods) > 0
+}
+
+// Allows 是否接受指定验证方式
+func (r *TwoFactorRequirement) Allows(method string) bool {
+	return r != nil && slices.Contains(r.Methods, method)
+}
+
+// TwoFactorLoginInput /auth/login/2fa 提交的验证凭据，三选一
+type TwoFactorLoginInput struct {
+	TotpCode     string
+	RecoveryCode string
+	WebAuthn     []byte // PublicKeyCredential JSON
+}
+
+// twoFactorState 决定第二步验证方式所需的账号状态
+type twoFactorState struct {
+	TotpActive         bool
+	Passkeys           int
+	RecoveryCodes      int
+	AdminPasskeyPolicy bool
+}
+
+// TwoFactorService 编排 TOTP、通行密钥与恢复码在登录中的使用
+type TwoFactorService struct {
+	settingService *SettingService
+	totpService    *TotpService
+	passkeyService *PasskeyService
+	recoveryCodes  *RecoveryCodeService
+}
+
+// NewTwoFactorService creates a new TwoFactorService
+func NewTwoFactorService(settingService *SettingService, totpService *TotpService, passkeyService *PasskeyService, recoveryCodes *RecoveryCodeService) *TwoFactorService {
+	return &TwoFactorService{
+		settingService: settingService,
+		totpService:    totpService,
+		passkeyService: passkeyService,
+		recoveryCodes:  recoveryCodes,
+	}
+}
+
+// Requirement 返回用户密码登录后的第二步要求；强制通行密钥的管理员未注册任何通行密钥时返回 ErrPasskeyRequiredForAdmin
+func (s *TwoFactorService) Requirement(ctx context.Context, user *User) (*TwoFactorRequirement, error) {
+	state, err := s.state(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return resolveTwoFactorRequirement(state)
+}
+
+// Verify 校验登录第二步；tempToken 用于定位通行密钥断言的 challenge
+func (s *TwoFactorService) Verify(ctx context.Context, user *User, tempToken string, in TwoFactorLoginInput) error {
+	req, err := s.Requirement(ctx, user)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(in.WebAuthn) > 0:
+		if !req.Allows(TwoFactorMethodPasskey) {
+			return ErrTwoFactorMethodNotAllowed
+		}
+		return s.passkeyService.FinishSecondFactor(ctx, user.ID, tempToken, in.WebAuthn)
+	case in.RecoveryCode != "":
+		if !req.Allows(TwoFactorMethodRecoveryCode) {
+			return ErrTwoFactorMethodNotAllowed
+		}
+		return s.recoveryCodes.Verify(ctx, user.ID, in.RecoveryCode)
+	case in.TotpCode != "":
+		if !req.Allows(TwoFactorMethodTotp) {
+			return ErrTwoFactorMethodNotAllowed
+		}
+		return s.totpService.VerifyCode(ctx, user.ID, in.TotpCode)
+	default:
+		return ErrTwoFactorCodeRequired
+	}
+}
+
+// BeginPasskeyChallenge 为 2FA 登录会话生成通行密钥断言 challenge
+func (s *TwoFactorService) BeginPasskeyChallenge(ctx context.Context, user *User, tempToken string) (*protocol.CredentialAssertion, error) {
+	req, err := s.Requirement(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Allows(TwoFactorMethodPasskey) {
+		return nil, ErrTwoFactorMethodNotAllowed
+	}
+	return s.passkeyService.BeginSecondFactor(ctx, user.ID, tempToken)
+}
+
+// HasSecondFactor 用户是否已启用 TOTP 或注册了通行密钥
+func (s *TwoFactorService) HasSecondFactor(ctx context.Context, user *User) (bool, error) {
+	if s.settingService.IsTotpEnabled(ctx) && user.TotpEnabled {
+		return true, nil
+	}
+	passkeys, err := s.passkeyService.Count(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return passkeys > 0, nil
+}
+
+// ReconcileRecoveryCodes 最后一个第二因素被移除后作废恢复码，避免重新启用时沿用旧码
+func (s *TwoFactorService) ReconcileRecoveryCodes(ctx context.Context, user *User) error {
+	has, err := s.HasSecondFactor(ctx, user)
+	if err != nil || has {
+		return err
+	}
+	return s.recoveryCodes.Clear(ctx, user.ID)
+}
+
+func (s *TwoFactorService) state(ctx context.Context, user *User) (twoFactorState, error) {
+	st := twoFactorState{
+		TotpActive: s.totpService != nil && s.settingService.IsTotpEnabled(ctx) && user.TotpEnabled,
+		// WebAuthn 配置无效时通行密钥不可用（Count 恒为 0），策略仍然生效：管理员只能用恢复码，不回落到仅密码
+		AdminPasskeyPolicy: user.IsAdmin() && s.settingService.IsPasskeyRequiredForAdmins(ctx),
+	}
+	passkeys, err := s.passkeyService.Count(ctx, user.ID)
+	if err != nil {
+		return st, err
+	}
+	st.Passkeys = passkeys
+	if st.TotpActive || st.Passkeys > 0 || st.AdminPasskeyPolicy {
+		status, err := s.recoveryCodes.GetStatus(ctx, user.ID)
+		if err != nil {
+			return st, err
+		}
+		st.RecoveryCodes = status.Remaining
+	}
+	return st, nil
+}
+
+// resolveTwoFactorRequirement 根据账号状态决定可用方式：
+// 强制通行密钥的管理员只接受通行密钥或恢复码；其余用户接受已启用的任一因素，有因素时可用恢复码兜底。
+func resolveTwoFactorRequirement(st twoFactorState) (*TwoFactorRequirement, error) {
+	req := &TwoFactorRequirement{PasskeyRequired: st.AdminPasskeyPolicy}
+	if st.AdminPasskeyPolicy {
+		if st.Passkeys > 0 {
+			req.Methods = append(req.Methods, TwoFactorMethodPasskey)
+		}
+		if st.RecoveryCodes > 0 {
+			req.Methods = append(req.Methods, TwoFactorMethodRecoveryCode)
+		}
+		if len(req.Methods) == 0 {
+			return nil, ErrPasskeyRequiredForAdmin
+		}
+		return req, nil
+	}
+	if st.TotpActive {
+		req.Methods = append(req.Methods, TwoFactorMethodTotp)
+	}
+	if st.Passkeys > 0 {
+		req.Methods = append(req.Methods, TwoFactorMethodPasskey)
+	}
+	if len(req.Methods) > 0 && st.RecoveryCodes > 0 {
+		req.Methods = append(req.Methods, TwoFactorMethodRecoveryCode)
+	}
+	return req, nil
+}
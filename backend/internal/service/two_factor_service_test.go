@@ -0,0 +1,122 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Wei-Shaw/sub2api/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTwoFactorRequirement(t *testing.T) {
+	cases := []struct {
+		name  string
+		state twoFactorState
+		want  []string
+		err   error
+	}{
+		{name: "no factors", state: twoFactorState{}, want: nil},
+		{name: "recovery codes alone never trigger 2fa", state: twoFactorState{RecoveryCodes: 5}, want: nil},
+		{name: "totp only", state: twoFactorState{TotpActive: true}, want: []string{TwoFactorMethodTotp}},
+		{
+			name:  "totp with recovery codes",
+			state: twoFactorState{TotpActive: true, RecoveryCodes: 3},
+			want:  []string{TwoFactorMethodTotp, TwoFactorMethodRecoveryCode},
+		},
+		{
+			name:  "passkey and totp",
+			state: twoFactorState{TotpActive: true, Passkeys: 2, RecoveryCodes: 10},
+			want:  []string{TwoFactorMethodTotp, TwoFactorMethodPasskey, TwoFactorMethodRecoveryCode},
+		},
+		{
+			name:  "admin policy excludes totp",
+			state: twoFactorState{TotpActive: true, Passkeys: 1, RecoveryCodes: 10, AdminPasskeyPolicy: true},
+			want:  []string{TwoFactorMethodPasskey, TwoFactorMethodRecoveryCode},
+		},
+		{
+			name:  "admin policy without passkey can still recover",
+			state: twoFactorState{TotpActive: true, RecoveryCodes: 1, AdminPasskeyPolicy: true},
+			want:  []string{TwoFactorMethodRecoveryCode},
+		},
+		{
+			name:  "admin policy without passkey is denied",
+			state: twoFactorState{TotpActive: true, AdminPasskeyPolicy: true},
+			err:   ErrPasskeyRequiredForAdmin,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := resolveTwoFactorRequirement(tc.state)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, req.Methods)
+			require.Equal(t, len(tc.want) > 0, req.Required())
+			require.Equal(t, tc.state.AdminPasskeyPolicy, req.PasskeyRequired)
+		})
+	}
+}
+
+func TestTwoFactorService_VerifyRejectsDisallowedMethod(t *testing.T) {
+	settingRepo := &settingRepoStub{values: map[string]string{
+		SettingKeyTotpEnabled:             "true",
+		SettingKeyRequirePasskeyForAdmins: "true",
+	}}
+	settingService := NewSettingService(settingRepo, nil)
+	recovery, _, _ := newRecoveryCodeServiceForTest()
+	totp := recovery.totpService
+	svc := NewTwoFactorService(settingService, totp, &PasskeyService{}, recovery)
+	ctx := context.Background()
+
+	user := &User{ID: 1, Role: RoleUser, TotpEnabled: true}
+	_, err := recovery.IssueInitial(ctx, user.ID)
+	require.NoError(t, err)
+
+	// 未启用通行密钥的用户提交 WebAuthn 断言
+	err = svc.Verify(ctx, user, "tmp", TwoFactorLoginInput{WebAuthn: []byte(`{}`)})
+	require.ErrorIs(t, err, ErrTwoFactorMethodNotAllowed)
+
+	err = svc.Verify(ctx, user, "tmp", TwoFactorLoginInput{})
+	require.ErrorIs(t, err, ErrTwoFactorCodeRequired)
+
+	// 通行密钥功能未在配置中启用时，管理员策略不生效，恢复码照常可用
+	admin := &User{ID: 1, Role: RoleAdmin, TotpEnabled: true}
+	req, err := svc.Requirement(ctx, admin)
+	require.NoError(t, err)
+	require.False(t, req.PasskeyRequired)
+	require.True(t, req.Allows(TwoFactorMethodTotp))
+	require.True(t, req.Allows(TwoFactorMethodRecoveryCode))
+}
+
+func TestTwoFactorService_AdminPolicyFailsClosedWhenWebAuthnInvalid(t *testing.T) {
+	settingRepo := &settingRepoStub{values: map[string]string{
+		SettingKeyTotpEnabled:             "true",
+		SettingKeyRequirePasskeyForAdmins: "true",
+	}}
+	// 配置里启用了 WebAuthn，但 RP 配置无效导致 webauthn 初始化失败
+	cfg := &config.Config{WebAuthn: config.WebAuthnConfig{Enabled: true}}
+	settingService := NewSettingService(settingRepo, cfg)
+	recovery, _, _ := newRecoveryCodeServiceForTest()
+	passkeys := NewPasskeyService(cfg, nil, nil, nil, settingService, recovery.totpService)
+	require.False(t, passkeys.Enabled())
+	require.NotEmpty(t, passkeys.ConfigError())
+	svc := NewTwoFactorService(settingService, recovery.totpService, passkeys, recovery)
+	ctx := context.Background()
+
+	// 策略不因配置错误降级为仅密码登录，TOTP 也不能替代通行密钥
+	admin := &User{ID: 1, Role: RoleAdmin, TotpEnabled: true}
+	_, err := svc.Requirement(ctx, admin)
+	require.ErrorIs(t, err, ErrPasskeyRequiredForAdmin)
+
+	// 仍可用恢复码登录
+	_, err = recovery.IssueInitial(ctx, admin.ID)
+	require.NoError(t, err)
+	req, err := svc.Requirement(ctx, admin)
+	require.NoError(t, err)
+	require.True(t, req.PasskeyRequired)
+	require.Equal(t, []string{TwoFactorMethodRecoveryCode}, req.Methods)
+}
@@ -112,6 +112,8 @@ type UsageLog struct {
 	BillingTier *string
 	// BillingMode 计费模式：token/image
 	BillingMode *string
+	// ContextAction 上下文窗口策略实际执行的动作（truncate/route），nil 表示未触发
+	ContextAction *string
 	// ServiceTier records the OpenAI service tier used for billing, e.g. "priority" / "flex".
 	ServiceTier *string
 	// ReasoningEffort is the request's reasoning effort level.
@@ -137,6 +139,10 @@ type UsageLog struct {
 	ImageOutputTokens int
 	ImageOutputCost   float64
 
+	// Realtime 音频 token，分别是 InputTokens / OutputTokens 的子集
+	AudioInputTokens  int
+	AudioOutputTokens int
+
 	InputCost         float64
 	OutputCost        float64
 	CacheCreationCost float64
@@ -8,6 +8,7 @@ import (
 
 	dbent "github.com/Wei-Shaw/sub2api/ent"
 	infraerrors "github.com/Wei-Shaw/sub2api/internal/pkg/errors"
+	"github.com/Wei-Shaw/sub2api/internal/pkg/logger"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/pagination"
 	"github.com/Wei-Shaw/sub2api/internal/pkg/usagestats"
 )
@@ -50,6 +51,8 @@ type UsageStats struct {
 	TotalCost         float64 `json:"total_cost"`
 	TotalActualCost   float64 `json:"total_actual_cost"`
 	AverageDurationMs float64 `json:"average_duration_ms"`
+
+	PromptCacheSavings *usagestats.PromptCacheSavingsStats `json:"prompt_cache_savings,omitempty"`
 }
 
 // UsageService 使用统计服务
@@ -58,6 +61,7 @@ type UsageService struct {
 	userRepo             UserRepository
 	entClient            *dbent.Client
 	authCacheInvalidator APIKeyAuthCacheInvalidator
+	promptCacheService   *PromptCacheService
 }
 
 // NewUsageService 创建使用统计服务实例
@@ -70,6 +74,27 @@ func NewUsageService(usageRepo UsageLogRepository, userRepo UserRepository, entC
 	}
 }
 
+// SetPromptCacheService 注入自动缓存断点服务，用于在统计中附带缓存节省
+func (s *UsageService) SetPromptCacheService(svc *PromptCacheService) {
+	s.promptCacheService = svc
+}
+
+// promptCacheSavings 查询缓存节省（best-effort，无记录或失败时返回 nil）
+func (s *UsageService) promptCacheSavings(ctx context.Context, filters usagestats.UsageLogFilters) *usagestats.PromptCacheSavingsStats {
+	if s.promptCacheService == nil {
+		return nil
+	}
+	savings, err := s.promptCacheService.SumSavings(ctx, filters)
+	if err != nil {
+		logger.LegacyPrintf("service.usage", "Warning: get prompt cache savings failed: %v", err)
+		return nil
+	}
+	if savings == nil || savings.Requests == 0 {
+		return nil
+	}
+	return savings
+}
+
 // Create 创建使用日志
 func (s *UsageService) Create(ctx context.Context, req CreateUsageLogRequest) (*UsageLog, error) {
 	// 使用数据库事务保证「使用日志插入」与「扣费」的原子性，避免重复扣费或漏扣风险。
@@ -198,6 +223,9 @@ func (s *UsageService) GetStatsByUser(ctx context.Context, userID int64, startTi
 		TotalCost:         stats.TotalCost,
 		TotalActualCost:   stats.TotalActualCost,
 		AverageDurationMs: stats.AverageDurationMs,
+		PromptCacheSavings: s.promptCacheSavings(ctx, usagestats.UsageLogFilters{
+			UserID: userID, StartTime: &startTime, EndTime: &endTime,
+		}),
 	}, nil
 }
 
@@ -217,6 +245,9 @@ func (s *UsageService) GetStatsByAPIKey(ctx context.Context, apiKeyID int64, sta
 		TotalCost:         stats.TotalCost,
 		TotalActualCost:   stats.TotalActualCost,
 		AverageDurationMs: stats.AverageDurationMs,
+		PromptCacheSavings: s.promptCacheSavings(ctx, usagestats.UsageLogFilters{
+			APIKeyID: apiKeyID, StartTime: &startTime, EndTime: &endTime,
+		}),
 	}, nil
 }
 
@@ -357,5 +388,8 @@ func (s *UsageService) GetStatsWithFilters(ctx context.Context, filters usagesta
 	if err != nil {
 		return nil, fmt.Errorf("get usage stats with filters: %w", err)
 	}
+	if stats != nil {
+		stats.PromptCacheSavings = s.promptCacheSavings(ctx, filters)
+	}
 	return stats, nil
 }
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/vertex"
+	"github.com/tidwall/sjson"
+)
+
+// ResolveVertexClaudeModelID resolves a requested Claude model into a Vertex publisher model ID.
+// It applies account model_mapping first, then converts Anthropic dated IDs to the
+// Vertex "@date" form (claude-sonnet-4-5-20250929 → claude-sonnet-4-5@20250929).
+func ResolveVertexClaudeModelID(account *Account, requestedModel string) string {
+	if account == nil {
+		return vertex.ClaudeModelID(requestedModel)
+	}
+	return vertex.ClaudeModelID(account.GetMappedModel(requestedModel))
+}
+
+// PrepareVertexClaudeRequestBody 处理请求体以适配 Vertex rawPredict
+//  1. 注入 anthropic_version（Vertex 要求 vertex-2023-10-16）
+//  2. 移除 model 字段（Vertex 通过 URL 指定模型）
+//  3. 移除工具定义中的 custom 字段（与 Bedrock 相同，云厂商端点会拒绝未知字段）
+//
+// stream 字段保留：streamRawPredict 仍依据请求体中的 stream 决定是否以 SSE 返回。
+func PrepareVertexClaudeRequestBody(body []byte) ([]byte, error) {
+	body, err := sjson.SetBytes(body, "anthropic_version", vertex.AnthropicVersion)
+	if err != nil {
+		return nil, fmt.Errorf("inject anthropic_version: %w", err)
+	}
+	body, err = sjson.DeleteBytes(body, "model")
+	if err != nil {
+		return nil, fmt.Errorf("remove model field: %w", err)
+	}
+	return removeCustomFieldFromTools(body), nil
+}
+
+// buildVertexGeminiRequest 构建 Vertex AI 上 Gemini 模型的请求（generateContent / streamGenerateContent / countTokens）。
+// Vertex 与 AI Studio 使用相同的 GenerateContent 请求/响应格式，仅端点与认证方式不同，响应无需 Code Assist 解包。
+func (s *GeminiMessagesCompatService) buildVertexGeminiRequest(ctx context.Context, account *Account, model, action string, body []byte) (*http.Request, string, error) {
+	if s.vertexTokenProvider == nil {
+		return nil, "", errors.New("vertex token provider not configured")
+	}
+	projectID := account.GetVertexProjectID()
+	if projectID == "" {
+		return nil, "", errors.New("vertex project_id not configured")
+	}
+	accessToken, err := s.vertexTokenProvider.GetAccessToken(ctx, account)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fullURL := vertex.GeminiURL(projectID, account.GetVertexRegion(), model, action)
+	upstreamReq, err := http.NewRequestWithContext(ctx, http.MethodPost, fullURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	upstreamReq.Header.Set("Content-Type", "application/json")
+	upstreamReq.Header.Set("Authorization", "Bearer "+accessToken)
+	return upstreamReq, "x-request-id", nil
+}
@@ -0,0 +1,52 @@
+//go:build unit
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestResolveVertexClaudeModelID(t *testing.T) {
+	account := &Account{
+		Platform: PlatformAnthropic,
+		Type:     AccountTypeVertex,
+		Credentials: map[string]any{
+			"model_mapping": map[string]any{"claude-sonnet-4-5": "claude-sonnet-4-5@20250929"},
+		},
+	}
+	require.Equal(t, "claude-sonnet-4-5@20250929", ResolveVertexClaudeModelID(account, "claude-sonnet-4-5"))
+	require.Equal(t, "claude-opus-4-1@20250805", ResolveVertexClaudeModelID(nil, "claude-opus-4-1-20250805"))
+}
+
+func TestPrepareVertexClaudeRequestBody(t *testing.T) {
+	body := []byte(`{"model":"claude-sonnet-4-5","stream":true,"max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+	out, err := PrepareVertexClaudeRequestBody(body)
+	require.NoError(t, err)
+	require.False(t, gjson.GetBytes(out, "model").Exists())
+	require.Equal(t, "vertex-2023-10-16", gjson.GetBytes(out, "anthropic_version").String())
+	require.True(t, gjson.GetBytes(out, "stream").Bool())
+	require.Equal(t, int64(16), gjson.GetBytes(out, "max_tokens").Int())
+}
+
+func TestAccountVertexSettings(t *testing.T) {
+	account := &Account{
+		Platform: PlatformGemini,
+		Type:     AccountTypeVertex,
+		Credentials: map[string]any{
+			"service_account_json": `{"type":"service_account","project_id":"proj-json"}`,
+		},
+	}
+	require.True(t, account.IsVertex())
+	require.Equal(t, "proj-json", account.GetVertexProjectID())
+	require.Equal(t, "global", account.GetVertexRegion())
+
+	account.Credentials["vertex_project_id"] = "proj-override"
+	account.Credentials["vertex_region"] = "us-east5"
+	require.Equal(t, "proj-override", account.GetVertexProjectID())
+	require.Equal(t, "us-east5", account.GetVertexRegion())
+
+	require.False(t, (&Account{Platform: PlatformOpenAI, Type: AccountTypeVertex}).IsVertex())
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/vertex"
+)
+
+const (
+	vertexTokenCacheSkew   = 5 * time.Minute
+	vertexTokenLockTTL     = 30 * time.Second
+	vertexTokenLockWait    = 200 * time.Millisecond
+	vertexTokenLockRetries = 10
+)
+
+// VertexTokenClient exchanges a signed service-account assertion for an access token.
+type VertexTokenClient interface {
+	ExchangeJWT(ctx context.Context, tokenURL, assertion, proxyURL string) (*vertex.TokenResponse, error)
+}
+
+// VertexTokenProvider manages access_token for Vertex AI service-account accounts.
+// Access tokens are not persisted: they are minted from the service-account key
+// on demand and kept in the shared token cache until shortly before expiry.
+type VertexTokenProvider struct {
+	tokenClient VertexTokenClient
+	tokenCache  GeminiTokenCache
+	now         func() time.Time
+}
+
+func NewVertexTokenProvider(tokenClient VertexTokenClient, tokenCache GeminiTokenCache) *VertexTokenProvider {
+	return &VertexTokenProvider{
+		tokenClient: tokenClient,
+		tokenCache:  tokenCache,
+		now:         time.Now,
+	}
+}
+
+func (p *VertexTokenProvider) GetAccessToken(ctx context.Context, account *Account) (string, error) {
+	if account == nil {
+		return "", errors.New("account is nil")
+	}
+	if !account.IsVertex() {
+		return "", errors.New("not a vertex account")
+	}
+
+	cacheKey := VertexTokenCacheKey(account)
+
+	// 1) Try cache first.
+	if token := p.cachedToken(ctx, cacheKey); token != "" {
+		return token, nil
+	}
+
+	// 2) 分布式锁避免多实例同时换取 token；未抢到锁时短暂等待持锁方写入缓存
+	if p.tokenCache != nil {
+		locked, lockErr := p.tokenCache.AcquireRefreshLock(ctx, cacheKey, vertexTokenLockTTL)
+		switch {
+		case lockErr != nil:
+			slog.Warn("vertex_token_lock_failed", "account_id", account.ID, "error", lockErr)
+		case locked:
+			defer func() { _ = p.tokenCache.ReleaseRefreshLock(ctx, cacheKey) }()
+		default:
+			for i := 0; i < vertexTokenLockRetries; i++ {
+				if err := sleepWithContext(ctx, vertexTokenLockWait); err != nil {
+					return "", err
+				}
+				if token := p.cachedToken(ctx, cacheKey); token != "" {
+					return token, nil
+				}
+			}
+			slog.Debug("vertex_token_lock_held_exchange_anyway", "account_id", account.ID)
+		}
+	}
+
+	// 3) Exchange a freshly signed assertion.
+	sa, err := vertex.ParseServiceAccount(account.GetCredential("service_account_json"))
+	if err != nil {
+		return "", err
+	}
+	assertion, err := sa.Assertion(p.now())
+	if err != nil {
+		return "", err
+	}
+	if p.tokenClient == nil {
+		return "", errors.New("vertex token client not configured")
+	}
+	resp, err := p.tokenClient.ExchangeJWT(ctx, sa.TokenURI, assertion, resolveAccountProxyURL(account))
+	if err != nil {
+		return "", fmt.Errorf("vertex token exchange: %w", err)
+	}
+	accessToken := strings.TrimSpace(resp.AccessToken)
+	if accessToken == "" {
+		return "", errors.New("vertex token exchange returned empty access_token")
+	}
+
+	// 4) Populate cache with TTL.
+	if p.tokenCache != nil {
+		ttl := time.Duration(resp.ExpiresIn) * time.Second
+		switch {
+		case ttl > vertexTokenCacheSkew:
+			ttl -= vertexTokenCacheSkew
+		case ttl <= 0:
+			ttl = time.Minute
+		}
+		if err := p.tokenCache.SetAccessToken(ctx, cacheKey, accessToken, ttl); err != nil {
+			slog.Warn("vertex_token_cache_set_failed", "account_id", account.ID, "error", err)
+		}
+	}
+	return accessToken, nil
+}
+
+func (p *VertexTokenProvider) cachedToken(ctx context.Context, cacheKey string) string {
+	if p.tokenCache == nil {
+		return ""
+	}
+	token, err := p.tokenCache.GetAccessToken(ctx, cacheKey)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// VertexTokenCacheKey 缓存键包含服务账号 JSON 的摘要，更换密钥后自动使用新的缓存项。
+func VertexTokenCacheKey(account *Account) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(account.GetCredential("service_account_json"))))
+	return "vertex:account:" + strconv.FormatInt(account.ID, 10) + ":" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,132 @@
+//go:build unit
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Wei-Shaw/sub2api/internal/pkg/vertex"
+	"github.com/stretchr/testify/require"
+)
+
+type vertexTokenCacheStub struct {
+	tokens map[string]string
+	ttls   map[string]time.Duration
+}
+
+func newVertexTokenCacheStub() *vertexTokenCacheStub {
+	return &vertexTokenCacheStub{tokens: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *vertexTokenCacheStub) GetAccessToken(ctx context.Context, cacheKey string) (string, error) {
+	return s.tokens[cacheKey], nil
+}
+
+func (s *vertexTokenCacheStub) SetAccessToken(ctx context.Context, cacheKey string, token string, ttl time.Duration) error {
+	s.tokens[cacheKey] = token
+	s.ttls[cacheKey] = ttl
+	return nil
+}
+
+func (s *vertexTokenCacheStub) DeleteAccessToken(ctx context.Context, cacheKey string) error {
+	delete(s.tokens, cacheKey)
+	return nil
+}
+
+func (s *vertexTokenCacheStub) AcquireRefreshLock(ctx context.Context, cacheKey string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (s *vertexTokenCacheStub) ReleaseRefreshLock(ctx context.Context, cacheKey string) error {
+	return nil
+}
+
+type vertexTokenClientStub struct {
+	calls     int
+	tokenURL  string
+	assertion string
+	resp      *vertex.TokenResponse
+	err       error
+}
+
+func (s *vertexTokenClientStub) ExchangeJWT(ctx context.Context, tokenURL, assertion, proxyURL string) (*vertex.TokenResponse, error) {
+	s.calls++
+	s.tokenURL = tokenURL
+	s.assertion = assertion
+	return s.resp, s.err
+}
+
+func newVertexTestAccount(t *testing.T) *Account {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	sa, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "proj-from-json",
+		"private_key":  string(keyPEM),
+		"client_email": "svc@proj-from-json.iam.gserviceaccount.com",
+	})
+	require.NoError(t, err)
+	return &Account{
+		ID:       7,
+		Platform: PlatformAnthropic,
+		Type:     AccountTypeVertex,
+		Credentials: map[string]any{
+			"service_account_json": string(sa),
+		},
+	}
+}
+
+func TestVertexTokenProvider_ExchangesAndCaches(t *testing.T) {
+	account := newVertexTestAccount(t)
+	cache := newVertexTokenCacheStub()
+	client := &vertexTokenClientStub{resp: &vertex.TokenResponse{AccessToken: "ya29.token", ExpiresIn: 3600}}
+	provider := NewVertexTokenProvider(client, cache)
+
+	token, err := provider.GetAccessToken(context.Background(), account)
+	require.NoError(t, err)
+	require.Equal(t, "ya29.token", token)
+	require.Equal(t, 1, client.calls)
+	require.Equal(t, vertex.DefaultTokenURL, client.tokenURL)
+	require.NotEmpty(t, client.assertion)
+
+	cacheKey := VertexTokenCacheKey(account)
+	require.Equal(t, 55*time.Minute, cache.ttls[cacheKey])
+
+	token, err = provider.GetAccessToken(context.Background(), account)
+	require.NoError(t, err)
+	require.Equal(t, "ya29.token", token)
+	require.Equal(t, 1, client.calls, "second call should be served from cache")
+}
+
+func TestVertexTokenProvider_ExchangeError(t *testing.T) {
+	account := newVertexTestAccount(t)
+	client := &vertexTokenClientStub{err: errors.New("invalid_grant")}
+	provider := NewVertexTokenProvider(client, newVertexTokenCacheStub())
+
+	_, err := provider.GetAccessToken(context.Background(), account)
+	require.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestVertexTokenProvider_RejectsNonVertexAccount(t *testing.T) {
+	provider := NewVertexTokenProvider(&vertexTokenClientStub{}, nil)
+	_, err := provider.GetAccessToken(context.Background(), &Account{Platform: PlatformAnthropic, Type: AccountTypeAPIKey})
+	require.Error(t, err)
+}
+
+func TestVertexTokenCacheKey_ChangesWithServiceAccount(t *testing.T) {
+	a := newVertexTestAccount(t)
+	b := newVertexTestAccount(t)
+	b.ID = a.ID
+	require.NotEqual(t, VertexTokenCacheKey(a), VertexTokenCacheKey(b))
+	require.Contains(t, VertexTokenCacheKey(a), "vertex:account:7:")
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -19,16 +21,18 @@ type WebSearchEmulationConfig struct {
 	Providers []WebSearchProviderConfig `json:"providers"`
 }
 
-// WebSearchProviderConfig describes a single search provider (Brave or Tavily).
+// WebSearchProviderConfig describes a single search provider (see websearch.ProviderType*).
 type WebSearchProviderConfig struct {
-	Type             string `json:"type"`                    // websearch.ProviderTypeBrave | Tavily
-	APIKey           string `json:"api_key,omitempty"`       // secret — omitted in API responses
-	APIKeyConfigured bool   `json:"api_key_configured"`      // read-only mask
-	QuotaLimit       *int64 `json:"quota_limit"`             // nil = unlimited, >0 = limited
-	SubscribedAt     *int64 `json:"subscribed_at,omitempty"` // subscription start (unix seconds); quota resets monthly
-	QuotaUsed        int64  `json:"quota_used,omitempty"`    // read-only: current usage from Redis
-	ProxyID          *int64 `json:"proxy_id"`                // optional proxy association
-	ExpiresAt        *int64 `json:"expires_at,omitempty"`    // optional expiration timestamp
+	Type             string                       `json:"type"`                    // websearch.ProviderType*
+	APIKey           string                       `json:"api_key,omitempty"`       // secret — omitted in API responses
+	APIKeyConfigured bool                         `json:"api_key_configured"`      // read-only mask
+	BaseURL          string                       `json:"base_url,omitempty"`      // required for searxng / generic_json; optional endpoint override for exa / bing
+	Generic          *websearch.GenericJSONConfig `json:"generic,omitempty"`       // request/response mapping for generic_json
+	QuotaLimit       *int64                       `json:"quota_limit"`             // nil = unlimited, >0 = limited
+	SubscribedAt     *int64                       `json:"subscribed_at,omitempty"` // subscription start (unix seconds); quota resets monthly
+	QuotaUsed        int64                        `json:"quota_used,omitempty"`    // read-only: current usage from Redis
+	ProxyID          *int64                       `json:"proxy_id"`                // optional proxy association
+	ExpiresAt        *int64                       `json:"expires_at,omitempty"`    // optional expiration timestamp
 }
 
 // --- Validation ---
@@ -36,8 +40,12 @@ type WebSearchProviderConfig struct {
 const maxWebSearchProviders = 10
 
 var validProviderTypes = map[string]bool{
-	websearch.ProviderTypeBrave:  true,
-	websearch.ProviderTypeTavily: true,
+	websearch.ProviderTypeBrave:       true,
+	websearch.ProviderTypeTavily:      true,
+	websearch.ProviderTypeSearXNG:     true,
+	websearch.ProviderTypeExa:         true,
+	websearch.ProviderTypeBing:        true,
+	websearch.ProviderTypeGenericJSON: true,
 }
 
 func validateWebSearchConfig(cfg *WebSearchEmulationConfig) error {
@@ -59,6 +67,29 @@ func validateWebSearchConfig(cfg *WebSearchEmulationConfig) error {
 			return fmt.Errorf("provider[%d]: duplicate type %q", i, p.Type)
 		}
 		seen[p.Type] = true
+		if err := validateWebSearchBaseURL(p); err != nil {
+			return fmt.Errorf("provider[%d]: %w", i, err)
+		}
+		if p.Type == websearch.ProviderTypeGenericJSON {
+			if err := p.Generic.Validate(); err != nil {
+				return fmt.Errorf("provider[%d]: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateWebSearchBaseURL(p WebSearchProviderConfig) error {
+	raw := strings.TrimSpace(p.BaseURL)
+	if raw == "" {
+		if websearch.ProviderRequiresBaseURL(p.Type) {
+			return fmt.Errorf("base_url is required for %s", p.Type)
+		}
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base_url must be an absolute http(s) URL")
 	}
 	return nil
 }
@@ -140,10 +171,10 @@ func (s *SettingService) SaveWebSearchEmulationConfig(ctx context.Context, cfg *
 	}
 	s.mergeExistingAPIKeys(ctx, cfg)
 
-	// After merge, validate all enabled providers have API keys
+	// After merge, validate all enabled providers that need API keys have them
 	if cfg.Enabled {
 		for _, p := range cfg.Providers {
-			if p.APIKey == "" {
+			if p.APIKey == "" && websearch.ProviderRequiresAPIKey(p.Type) {
 				return infraerrors.BadRequest("MISSING_API_KEY",
 					fmt.Sprintf("provider %s has no API key configured", p.Type))
 			}
@@ -38,11 +38,34 @@ func TestValidateWebSearchConfig_TooManyProviders(t *testing.T) {
 
 func TestValidateWebSearchConfig_InvalidType(t *testing.T) {
 	cfg := &WebSearchEmulationConfig{
-		Providers: []WebSearchProviderConfig{{Type: "bing"}},
+		Providers: []WebSearchProviderConfig{{Type: "google"}},
 	}
 	require.ErrorContains(t, validateWebSearchConfig(cfg), "invalid type")
 }
 
+func TestValidateWebSearchConfig_SelfHostedProvidersNeedBaseURL(t *testing.T) {
+	cfg := &WebSearchEmulationConfig{
+		Providers: []WebSearchProviderConfig{{Type: "searxng"}},
+	}
+	require.ErrorContains(t, validateWebSearchConfig(cfg), "base_url is required")
+
+	cfg.Providers[0].BaseURL = "searx.local"
+	require.ErrorContains(t, validateWebSearchConfig(cfg), "absolute http(s) URL")
+
+	cfg.Providers[0].BaseURL = "http://searx.local:8080"
+	require.NoError(t, validateWebSearchConfig(cfg))
+}
+
+func TestValidateWebSearchConfig_GenericJSONMapping(t *testing.T) {
+	cfg := &WebSearchEmulationConfig{
+		Providers: []WebSearchProviderConfig{{Type: "generic_json", BaseURL: "https://search.example/api"}},
+	}
+	require.ErrorContains(t, validateWebSearchConfig(cfg), "generic config is required")
+
+	cfg.Providers[0].Generic = &websearch.GenericJSONConfig{ResultsPath: "$.items", URLPath: "$.url", TitlePath: "$.title"}
+	require.NoError(t, validateWebSearchConfig(cfg))
+}
+
 func TestValidateWebSearchConfig_NegativeQuotaLimit(t *testing.T) {
 	cfg := &WebSearchEmulationConfig{
 		Providers: []WebSearchProviderConfig{{Type: "brave", QuotaLimit: int64Ptr(-1)}},
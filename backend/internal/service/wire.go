@@ -169,8 +169,9 @@ func ProvideDeferredService(accountRepo AccountRepository, timingWheel *TimingWh
 }
 
 // ProvideConcurrencyService creates ConcurrencyService and starts slot cleanup worker.
-func ProvideConcurrencyService(cache ConcurrencyCache, accountRepo AccountRepository, cfg *config.Config) *ConcurrencyService {
+func ProvideConcurrencyService(cache ConcurrencyCache, accountRepo AccountRepository, cfg *config.Config, priority *RequestPriorityService) *ConcurrencyService {
 	svc := NewConcurrencyService(cache)
+	svc.SetRequestPriorityService(priority)
 	if err := svc.CleanupStaleProcessSlots(context.Background()); err != nil {
 		logger.LegacyPrintf("service.concurrency", "Warning: startup cleanup stale process slots failed: %v", err)
 	}
@@ -180,6 +181,20 @@ func ProvideConcurrencyService(cache ConcurrencyCache, accountRepo AccountReposi
 	return svc
 }
 
+// ProvideRequestPriorityService 创建 API Key 优先级分道服务，并让鉴权中间件可以解析 Key 的优先级
+func ProvideRequestPriorityService(repo APIKeyPriorityRepository, cfg *config.Config, apiKeyService *APIKeyService) *RequestPriorityService {
+	svc := NewRequestPriorityService(repo, cfg)
+	apiKeyService.SetRequestPriorityService(svc)
+	return svc
+}
+
+// ProvidePromptCacheService 创建自动缓存断点服务，并让 usage 统计附带缓存节省
+func ProvidePromptCacheService(repo PromptCacheRepository, groupRepo GroupRepository, billingService *BillingService, usageService *UsageService) *PromptCacheService {
+	svc := NewPromptCacheService(repo, groupRepo, billingService)
+	usageService.SetPromptCacheService(svc)
+	return svc
+}
+
 // ProvideUserMessageQueueService 创建用户消息串行队列服务并启动清理 worker
 func ProvideUserMessageQueueService(cache UserMsgQueueCache, rpmCache RPMCache, cfg *config.Config) *UserMessageQueueService {
 	svc := NewUserMessageQueueService(cache, rpmCache, &cfg.Gateway.UserMessageQueue)
@@ -373,6 +388,85 @@ func ProvideBackupService(
 	return svc
 }
 
+// ProvideReferralService creates ReferralService, hooks it into registration, login and
+// payment fulfillment, and starts the usage commission settlement loop.
+func ProvideReferralService(
+	repo ReferralRepository,
+	settingRepo SettingRepository,
+	billingCacheService *BillingCacheService,
+	authCacheInvalidator APIKeyAuthCacheInvalidator,
+	authService *AuthService,
+	paymentService *PaymentService,
+) *ReferralService {
+	svc := NewReferralService(repo, settingRepo, billingCacheService, authCacheInvalidator)
+	authService.SetRegistrationObserver(svc)
+	authService.SetLoginObserver(svc)
+	paymentService.SetRechargeObserver(svc)
+	svc.Start()
+	return svc
+}
+
+// ProvideBudgetService creates BudgetService and registers it as the billing budget enforcer.
+func ProvideBudgetService(
+	repo BudgetRepository,
+	cache BudgetSpendCache,
+	userRepo UserRepository,
+	apiKeyRepo APIKeyRepository,
+	emailQueue *EmailQueueService,
+	settingRepo SettingRepository,
+	billingCacheService *BillingCacheService,
+) *BudgetService {
+	svc := NewBudgetService(repo, cache, userRepo, apiKeyRepo, emailQueue, settingRepo)
+	billingCacheService.SetBudgetEnforcer(svc)
+	return svc
+}
+
+// ProvidePrivacyService creates PrivacyService and starts the export/deletion worker.
+func ProvidePrivacyService(
+	repo PrivacyRepository,
+	userRepo UserRepository,
+	authCacheInvalidator APIKeyAuthCacheInvalidator,
+	refreshTokenCache RefreshTokenCache,
+	emailQueue *EmailQueueService,
+	settingRepo SettingRepository,
+	cfg *config.Config,
+) *PrivacyService {
+	svc := NewPrivacyService(repo, userRepo, authCacheInvalidator, refreshTokenCache, emailQueue, settingRepo, cfg)
+	svc.Start()
+	return svc
+}
+
+// ProvideClusterService creates ClusterService, enables cross-replica sharing on the
+// session stores and starts the node heartbeat.
+func ProvideClusterService(
+	cache ClusterStateCache,
+	cfg *config.Config,
+	digestStore *DigestSessionStore,
+	openAIGatewayService *OpenAIGatewayService,
+	opsService *OpsService,
+) *ClusterService {
+	svc := NewClusterService(cache, cfg)
+	if shared := svc.SharedCache(); shared != nil {
+		digestStore.EnableClusterSharing(shared, svc.NodeID())
+		svc.trackBindingWriter(digestStore.writer)
+	}
+	openAIGatewayService.SetClusterService(svc)
+	opsService.SetClusterService(svc)
+	svc.Start()
+	return svc
+}
+
+// ProvideFairShareService creates FairShareService and exposes its queue state to ops.
+func ProvideFairShareService(
+	settingService *SettingService,
+	snapshotService *SchedulerSnapshotService,
+	opsService *OpsService,
+) *FairShareService {
+	svc := NewFairShareService(settingService, snapshotService)
+	opsService.SetFairShareService(svc)
+	return svc
+}
+
 // ProvideSettingService wires SettingService with group reader and proxy repo.
 func ProvideSettingService(settingRepo SettingRepository, groupRepo GroupRepository, proxyRepo ProxyRepository, cfg *config.Config) *SettingService {
 	svc := NewSettingService(settingRepo, cfg)
@@ -415,8 +509,11 @@ var ProviderSet = wire.NewSet(
 	ProvideAntigravityTokenProvider,
 	ProvideOpenAITokenProvider,
 	ProvideClaudeTokenProvider,
+	NewVertexTokenProvider,
+	NewAzureOpenAITokenProvider,
 	NewAntigravityGatewayService,
 	ProvideRateLimitService,
+	NewQuotaForecastService,
 	NewAccountUsageService,
 	NewAccountTestService,
 	ProvideSettingService,
@@ -467,6 +564,26 @@ var ProviderSet = wire.NewSet(
 	NewPaymentService,
 	ProvidePaymentOrderExpiryService,
 	ProvideBalanceNotifyService,
+	ProvideReferralService,
+	ProvideBudgetService,
+	ProvidePrivacyService,
+	ProvideClusterService,
+	ProvideFairShareService,
+	ProvideRequestPriorityService,
+	ProvidePromptCacheService,
+	NewContextPolicyService,
+	NewModelCatalogService,
+	NewShadowService,
+	NewOAuthServerService,
+	NewConfigAsCodeService,
+	NewLDAPAuthService,
+	NewSAMLService,
+	NewDirectoryGroupSyncService,
+	NewDirectorySSOService,
+	NewSCIMService,
+	NewRecoveryCodeService,
+	NewPasskeyService,
+	NewTwoFactorService,
 )
 
 // ProvidePaymentConfigService wraps NewPaymentConfigService to accept the named
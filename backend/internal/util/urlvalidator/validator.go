@@ -117,14 +117,55 @@ func ValidateResolvedIP(host string) error {
 	}
 
 	for _, ip := range ips {
-		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
-			ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
-			return fmt.Errorf("resolved ip %s is not allowed", ip.String())
+		if err := ValidateIP(ip); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// ValidateIP 校验单个 IP 是否为允许访问的公网地址
+// 供拨号阶段使用：校验实际建立连接的地址，避免解析与连接之间的 DNS Rebinding 窗口
+func ValidateIP(ip net.IP) error {
+	if isBlockedIP(ip) {
+		return fmt.Errorf("resolved ip %s is not allowed", ip.String())
+	}
+	return nil
+}
+
+// blockedIPNets 标准库分类之外仍需阻断的保留网段
+var blockedIPNets = mustParseCIDRs(
+	"0.0.0.0/8",     // "本网络"，部分系统会路由到本机
+	"100.64.0.0/10", // 运营商级 NAT（CGNAT），常见于云厂商内网
+	"64:ff9b::/96",  // NAT64，可映射到任意 IPv4（含私网）
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isBlockedIP 判断 IP 是否为非公网地址（回环、私网、链路本地、组播、保留网段）
+func isBlockedIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range blockedIPNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func normalizeAllowlist(values []string) []string {
 	if len(values) == 0 {
 		return nil
@@ -167,9 +208,7 @@ func isBlockedHost(host string) bool {
 		return true
 	}
 	if ip := net.ParseIP(host); ip != nil {
-		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
-			return true
-		}
+		return isBlockedIP(ip)
 	}
 	return false
 }
@@ -1,6 +1,9 @@
 package urlvalidator
 
-import "testing"
+import (
+	"net"
+	"testing"
+)
 
 func TestValidateURLFormat(t *testing.T) {
 	if _, err := ValidateURLFormat("", false); err == nil {
@@ -73,3 +76,31 @@ func TestValidateHTTPURL(t *testing.T) {
 		t.Fatalf("expected localhost to be blocked when allow_private_hosts is false")
 	}
 }
+
+func TestValidateIP(t *testing.T) {
+	blocked := []string{
+		"127.0.0.1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"0.0.0.0", "0.1.2.3", "100.64.0.1", "100.127.255.254",
+		"224.0.0.1", "239.255.255.250", "ff02::1", "ff0e::1",
+		"::1", "::", "fe80::1", "fc00::1", "64:ff9b::a00:1", "::ffff:100.64.0.1",
+	}
+	for _, raw := range blocked {
+		if err := ValidateIP(net.ParseIP(raw)); err == nil {
+			t.Fatalf("expected %s to be blocked", raw)
+		}
+	}
+	if err := ValidateIP(nil); err == nil {
+		t.Fatalf("expected nil ip to be blocked")
+	}
+
+	allowed := []string{"8.8.8.8", "100.63.255.255", "100.128.0.1", "1.1.1.1", "2606:4700:4700::1111"}
+	for _, raw := range allowed {
+		if err := ValidateIP(net.ParseIP(raw)); err != nil {
+			t.Fatalf("expected %s to be allowed, got %v", raw, err)
+		}
+	}
+
+	if _, err := ValidateHTTPURL("https://100.64.0.1", false, ValidationOptions{}); err == nil {
+		t.Fatalf("expected CGNAT literal host to be blocked")
+	}
+}
@@ -436,6 +436,8 @@ func TestFrontendServer_Middleware(t *testing.T) {
 			"/v1beta/chat",
 			"/antigravity/test",
 			"/setup/init",
+			"/scim/v2/Users",
+			"/.well-known/oauth-authorization-server",
 			"/health",
 			"/responses",
 			"/responses/compact",
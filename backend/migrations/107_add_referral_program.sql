@@ -0,0 +1,52 @@
+-- 107_add_referral_program.sql
+-- Referral / affiliate program: per-user referral codes, referrer relationships and commissions.
+
+CREATE TABLE IF NOT EXISTS referral_accounts (
+    user_id           BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    code              VARCHAR(32) NOT NULL,
+    available_credit  DECIMAL(20,8) NOT NULL DEFAULT 0,
+    total_commission  DECIMAL(20,8) NOT NULL DEFAULT 0,
+    total_withdrawn   DECIMAL(20,8) NOT NULL DEFAULT 0,
+    last_ip           VARCHAR(45) NOT NULL DEFAULT '',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_accounts_code ON referral_accounts(code);
+
+CREATE TABLE IF NOT EXISTS referral_relations (
+    id           BIGSERIAL PRIMARY KEY,
+    referrer_id  BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    referee_id   BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source       VARCHAR(20) NOT NULL DEFAULT 'email',
+    register_ip  VARCHAR(45) NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_relations_referee ON referral_relations(referee_id);
+CREATE INDEX IF NOT EXISTS idx_referral_relations_referrer ON referral_relations(referrer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_referral_relations_register_ip ON referral_relations(register_ip, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS referral_commissions (
+    id           BIGSERIAL PRIMARY KEY,
+    referrer_id  BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    referee_id   BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_type  VARCHAR(20) NOT NULL,
+    source_ref   VARCHAR(64) NOT NULL,
+    base_amount  DECIMAL(20,8) NOT NULL DEFAULT 0,
+    rate         DECIMAL(10,4) NOT NULL DEFAULT 0,
+    amount       DECIMAL(20,8) NOT NULL DEFAULT 0,
+    credit_mode  VARCHAR(20) NOT NULL DEFAULT 'balance',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_commissions_source ON referral_commissions(source_type, source_ref);
+CREATE INDEX IF NOT EXISTS idx_referral_commissions_referrer ON referral_commissions(referrer_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_referral_commissions_referee ON referral_commissions(referee_id);
+
+CREATE TABLE IF NOT EXISTS referral_payouts (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount      DECIMAL(20,8) NOT NULL,
+    method      VARCHAR(20) NOT NULL DEFAULT 'balance',
+    note        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_referral_payouts_user ON referral_payouts(user_id, created_at DESC);
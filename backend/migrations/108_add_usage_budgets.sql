@@ -0,0 +1,29 @@
+-- 108_add_usage_budgets.sql
+-- User-configurable spending budgets (account level or per API key) with soft/hard modes and alert settings.
+
+CREATE TABLE IF NOT EXISTS usage_budgets (
+    id                       BIGSERIAL PRIMARY KEY,
+    user_id                  BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    api_key_id               BIGINT REFERENCES api_keys(id) ON DELETE CASCADE,
+    period                   VARCHAR(16) NOT NULL,
+    limit_usd                DECIMAL(20,8) NOT NULL,
+    mode                     VARCHAR(16) NOT NULL DEFAULT 'soft',
+    alert_percent            INT NOT NULL DEFAULT 80,
+    enabled                  BOOLEAN NOT NULL DEFAULT TRUE,
+    last_alert_period_start  TIMESTAMPTZ,
+    last_alert_level         INT NOT NULL DEFAULT 0,
+    created_at               TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at               TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- 同一用户、同一作用范围（账户级 api_key_id 视为 0）、同一周期只允许一个预算
+CREATE UNIQUE INDEX IF NOT EXISTS idx_usage_budgets_scope ON usage_budgets(user_id, COALESCE(api_key_id, 0), period);
+
+CREATE TABLE IF NOT EXISTS user_budget_settings (
+    user_id              BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_enabled        BOOLEAN NOT NULL DEFAULT TRUE,
+    webhook_url          TEXT NOT NULL DEFAULT '',
+    webhook_secret       TEXT NOT NULL DEFAULT '',
+    spike_hourly_usd     DECIMAL(20,8) NOT NULL DEFAULT 0,
+    last_spike_alert_at  TIMESTAMPTZ,
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
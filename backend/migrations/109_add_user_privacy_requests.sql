@@ -0,0 +1,33 @@
+-- 109_add_user_privacy_requests.sql
+-- Self-service personal data exports and account deletion requests with a grace period.
+
+CREATE TABLE IF NOT EXISTS user_data_exports (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status        VARCHAR(20) NOT NULL DEFAULT 'pending',
+    file_path     TEXT NOT NULL DEFAULT '',
+    file_size     BIGINT NOT NULL DEFAULT 0,
+    error_message TEXT NOT NULL DEFAULT '',
+    started_at    TIMESTAMPTZ,
+    completed_at  TIMESTAMPTZ,
+    expires_at    TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_data_exports_user ON user_data_exports(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_user_data_exports_status ON user_data_exports(status, created_at);
+
+CREATE TABLE IF NOT EXISTS account_deletion_requests (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status        VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reason        TEXT NOT NULL DEFAULT '',
+    scheduled_at  TIMESTAMPTZ NOT NULL,
+    cancelled_at  TIMESTAMPTZ,
+    completed_at  TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- 每个用户同时只允许一个待执行的注销申请
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_deletion_requests_pending
+    ON account_deletion_requests(user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_account_deletion_requests_due
+    ON account_deletion_requests(scheduled_at) WHERE status = 'pending';
@@ -0,0 +1,49 @@
+-- 110_add_group_shadow_rules.sql
+-- Traffic shadowing: mirror a sample of a group's requests to a candidate group and record side-by-side metrics.
+
+CREATE TABLE IF NOT EXISTS group_shadow_rules (
+    id               BIGSERIAL PRIMARY KEY,
+    group_id         BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    shadow_group_id  BIGINT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    sample_rate      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    model_patterns   JSONB NOT NULL DEFAULT '[]'::jsonb,
+    max_concurrency  INT NOT NULL DEFAULT 4,
+    enabled          BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT group_shadow_rules_distinct_groups CHECK (group_id <> shadow_group_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_shadow_rules_pair ON group_shadow_rules(group_id, shadow_group_id);
+
+-- 影子请求记录与 usage_logs 完全隔离：不参与计费、配额与用户统计
+CREATE TABLE IF NOT EXISTS shadow_usage_logs (
+    id                             BIGSERIAL PRIMARY KEY,
+    rule_id                        BIGINT NOT NULL REFERENCES group_shadow_rules(id) ON DELETE CASCADE,
+    group_id                       BIGINT NOT NULL,
+    shadow_group_id                BIGINT NOT NULL,
+    user_id                        BIGINT NOT NULL,
+    api_key_id                     BIGINT NOT NULL,
+    model                          VARCHAR(100) NOT NULL,
+    stream                         BOOLEAN NOT NULL DEFAULT FALSE,
+    primary_account_id             BIGINT NOT NULL,
+    primary_duration_ms            INT NOT NULL DEFAULT 0,
+    primary_first_token_ms         INT,
+    primary_input_tokens           INT NOT NULL DEFAULT 0,
+    primary_output_tokens          INT NOT NULL DEFAULT 0,
+    primary_cache_creation_tokens  INT NOT NULL DEFAULT 0,
+    primary_cache_read_tokens      INT NOT NULL DEFAULT 0,
+    primary_cost                   DECIMAL(20,10) NOT NULL DEFAULT 0,
+    shadow_account_id              BIGINT,
+    shadow_status                  VARCHAR(16) NOT NULL,
+    shadow_status_code             INT NOT NULL DEFAULT 0,
+    shadow_error                   TEXT NOT NULL DEFAULT '',
+    shadow_duration_ms             INT NOT NULL DEFAULT 0,
+    shadow_first_token_ms          INT,
+    shadow_input_tokens            INT NOT NULL DEFAULT 0,
+    shadow_output_tokens           INT NOT NULL DEFAULT 0,
+    shadow_cache_creation_tokens   INT NOT NULL DEFAULT 0,
+    shadow_cache_read_tokens       INT NOT NULL DEFAULT 0,
+    shadow_cost                    DECIMAL(20,10) NOT NULL DEFAULT 0,
+    created_at                     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_shadow_usage_logs_rule_created ON shadow_usage_logs(rule_id, created_at);
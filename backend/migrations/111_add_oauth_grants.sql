@@ -0,0 +1,22 @@
+-- 111_add_oauth_grants.sql
+-- OAuth authorization server: one grant per API key issued through the device code / PKCE flows.
+-- 设备码与授权码为短期状态，存放在 Redis；这里只记录长期存在的授权（refresh_token 与签发的 Key）。
+
+CREATE TABLE IF NOT EXISTS oauth_grants (
+    id                  BIGSERIAL PRIMARY KEY,
+    user_id             BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    api_key_id          BIGINT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    client_id           VARCHAR(100) NOT NULL,
+    group_id            BIGINT NOT NULL,
+    scope               VARCHAR(255) NOT NULL DEFAULT '',
+    -- refresh_token 仅保存 SHA-256 摘要；未申请 offline_access 时为空
+    refresh_token_hash  VARCHAR(64),
+    refresh_expires_at  TIMESTAMPTZ,
+    last_refreshed_at   TIMESTAMPTZ,
+    revoked_at          TIMESTAMPTZ,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_grants_refresh_token_hash ON oauth_grants(refresh_token_hash) WHERE refresh_token_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_oauth_grants_user_id ON oauth_grants(user_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_grants_api_key_id ON oauth_grants(api_key_id);
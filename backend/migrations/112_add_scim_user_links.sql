@@ -0,0 +1,11 @@
+-- 112_add_scim_user_links.sql
+-- SCIM 2.0 provisioning: remember the IdP externalId of each provisioned user.
+-- 其余 SCIM 属性直接映射到 users / user_allowed_groups，这里只保存 IdP 侧的外部 ID。
+
+CREATE TABLE IF NOT EXISTS scim_user_links (
+    user_id      BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    external_id  VARCHAR(255) NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_user_links_external_id ON scim_user_links(external_id);
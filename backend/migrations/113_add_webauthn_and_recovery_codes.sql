@@ -0,0 +1,24 @@
+-- 113_add_webauthn_and_recovery_codes.sql
+-- WebAuthn passkeys (multiple named credentials per user) and one-time 2FA recovery codes.
+-- credential 保存 go-webauthn 的 Credential JSON（公钥、签名计数、传输方式等），恢复码仅保存 SHA-256 摘要。
+
+CREATE TABLE IF NOT EXISTS user_webauthn_credentials (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name           VARCHAR(100) NOT NULL,
+    credential_id  TEXT NOT NULL,
+    credential     JSONB NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at   TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_webauthn_credentials_credential_id ON user_webauthn_credentials(credential_id);
+CREATE INDEX IF NOT EXISTS idx_user_webauthn_credentials_user_id ON user_webauthn_credentials(user_id);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash   CHAR(64) NOT NULL,
+    used_at     TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
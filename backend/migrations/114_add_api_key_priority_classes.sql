@@ -0,0 +1,9 @@
+-- 114_add_api_key_priority_classes.sql
+-- API key priority lanes: interactive / normal / background.
+-- 仅保存非 normal 的 Key；未出现在表中的 Key 视为 normal。
+
+CREATE TABLE IF NOT EXISTS api_key_priority_classes (
+    api_key_id      BIGINT PRIMARY KEY REFERENCES api_keys(id) ON DELETE CASCADE,
+    priority_class  VARCHAR(16) NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
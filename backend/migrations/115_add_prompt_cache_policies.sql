@@ -0,0 +1,36 @@
+-- 115_add_prompt_cache_policies.sql
+-- Automatic prompt-cache breakpoints: per-group opt-in policy and per-request savings records.
+
+CREATE TABLE IF NOT EXISTS group_prompt_cache_policies (
+    group_id           BIGINT PRIMARY KEY REFERENCES groups(id) ON DELETE CASCADE,
+    enabled            BOOLEAN NOT NULL DEFAULT FALSE,
+    ttl_mode           VARCHAR(8) NOT NULL DEFAULT 'auto',
+    min_prefix_tokens  INT NOT NULL DEFAULT 1024,
+    cache_tools        BOOLEAN NOT NULL DEFAULT TRUE,
+    cache_system       BOOLEAN NOT NULL DEFAULT TRUE,
+    cache_messages     BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 仅记录网关注入过断点的请求；saved_cost 为相对无缓存的净节省（首次写入时可能为负）
+CREATE TABLE IF NOT EXISTS prompt_cache_savings (
+    id                        BIGSERIAL PRIMARY KEY,
+    request_id                VARCHAR(255) NOT NULL DEFAULT '',
+    user_id                   BIGINT NOT NULL,
+    api_key_id                BIGINT NOT NULL,
+    account_id                BIGINT NOT NULL,
+    group_id                  BIGINT,
+    model                     VARCHAR(100) NOT NULL,
+    ttl                       VARCHAR(8) NOT NULL,
+    breakpoints               INT NOT NULL DEFAULT 0,
+    cache_read_tokens         INT NOT NULL DEFAULT 0,
+    cache_creation_5m_tokens  INT NOT NULL DEFAULT 0,
+    cache_creation_1h_tokens  INT NOT NULL DEFAULT 0,
+    saved_cost                DECIMAL(20,10) NOT NULL DEFAULT 0,
+    actual_saved_cost         DECIMAL(20,10) NOT NULL DEFAULT 0,
+    created_at                TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_prompt_cache_savings_created ON prompt_cache_savings(created_at);
+CREATE INDEX IF NOT EXISTS idx_prompt_cache_savings_user_created ON prompt_cache_savings(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_prompt_cache_savings_api_key_created ON prompt_cache_savings(api_key_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_prompt_cache_savings_group_created ON prompt_cache_savings(group_id, created_at);
@@ -0,0 +1,17 @@
+-- 116_add_group_context_policies.sql
+-- Context-window overflow handling: per-group policy and the applied action on each usage log.
+
+CREATE TABLE IF NOT EXISTS group_context_policies (
+    group_id            BIGINT PRIMARY KEY REFERENCES groups(id) ON DELETE CASCADE,
+    enabled             BOOLEAN NOT NULL DEFAULT FALSE,
+    action              VARCHAR(16) NOT NULL DEFAULT 'reject',
+    long_context_model  VARCHAR(100) NOT NULL DEFAULT '',
+    -- 0 表示使用模型目录（LiteLLM max_input_tokens）中的上下文窗口
+    context_window      INT NOT NULL DEFAULT 0,
+    -- 为本地 token 估算误差预留的余量
+    reserve_tokens      INT NOT NULL DEFAULT 2048,
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- truncate / route；未触发策略时为 NULL
+ALTER TABLE usage_logs ADD COLUMN IF NOT EXISTS context_action VARCHAR(32);
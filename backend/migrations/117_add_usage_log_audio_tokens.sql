@@ -0,0 +1,3 @@
+-- Realtime API 音频 token 统计（分别是 input_tokens / output_tokens 的子集）
+ALTER TABLE usage_logs ADD COLUMN IF NOT EXISTS audio_input_tokens INT NOT NULL DEFAULT 0;
+ALTER TABLE usage_logs ADD COLUMN IF NOT EXISTS audio_output_tokens INT NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- 118_add_directory_user_links.sql
+-- LDAP / SAML identities explicitly linked to local accounts.
+-- 目录登录只认 (provider, subject) 关联，不再按邮箱自动绑定已有账号；
+-- 已有本地账号需用本地密码显式关联一次（目录注册的旧账号可先通过找回密码设置密码）。
+
+CREATE TABLE IF NOT EXISTS directory_user_links (
+    id          BIGSERIAL PRIMARY KEY,
+    provider    VARCHAR(16) NOT NULL,
+    subject     VARCHAR(1024) NOT NULL,
+    user_id     BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_directory_user_links_identity ON directory_user_links(provider, subject);
+CREATE INDEX IF NOT EXISTS idx_directory_user_links_user_id ON directory_user_links(user_id);
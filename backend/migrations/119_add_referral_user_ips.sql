@@ -0,0 +1,12 @@
+-- 119_add_referral_user_ips.sql
+-- IPs a user registered or logged in from, used by the referral same-IP check.
+-- referral_accounts.last_ip 只在打开邀请页时更新，不足以代表邀请人的真实 IP；
+-- 注册 IP 永久有效，登录 IP 按 last_seen_at 取近期窗口。
+
+CREATE TABLE IF NOT EXISTS referral_user_ips (
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip            VARCHAR(45) NOT NULL,
+    source        VARCHAR(16) NOT NULL,
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, ip, source)
+);
@@ -25,6 +25,9 @@ export interface SystemSettings {
   invitation_code_enabled: boolean
   totp_enabled: boolean // TOTP 双因素认证
   totp_encryption_key_configured: boolean // TOTP 加密密钥是否已配置
+  passkey_enabled: boolean // WebAuthn 是否已在配置文件中启用
+  passkey_config_error?: string // WebAuthn 配置无效的原因
+  require_passkey_for_admins: boolean // 管理员登录强制使用通行密钥
   // Default settings
   default_balance: number
   default_concurrency: number
@@ -153,6 +156,7 @@ export interface UpdateSettingsRequest {
   frontend_url?: string
   invitation_code_enabled?: boolean
   totp_enabled?: boolean // TOTP 双因素认证
+  require_passkey_for_admins?: boolean
   default_balance?: number
   default_concurrency?: number
   default_subscriptions?: DefaultSubscriptionSetting[]
@@ -13,7 +13,9 @@ import type {
   SendVerifyCodeResponse,
   PublicSettings,
   TotpLoginResponse,
-  TotpLogin2FARequest
+  TotpLogin2FARequest,
+  TwoFactorMethod,
+  PasskeyLoginOptions
 } from '@/types'
 
 /**
@@ -21,10 +23,18 @@ import type {
  */
 export type LoginResponse = AuthResponse | TotpLoginResponse
 
+/**
+ * Result of a third-party (OAuth / directory) sign-in: a token pair, or the same
+ * second-factor challenge as password login when the account has 2FA enabled
+ */
+export type OAuthLoginResponse =
+  | { access_token: string; refresh_token: string; expires_in: number; token_type: string }
+  | TotpLoginResponse
+
 /**
  * Type guard to check if login response requires 2FA
  */
-export function isTotp2FARequired(response: LoginResponse): response is TotpLoginResponse {
+export function isTotp2FARequired(response: object): response is TotpLoginResponse {
   return 'requires_2fa' in response && response.requires_2fa === true
 }
 
@@ -107,8 +117,8 @@ export async function login(credentials: LoginRequest): Promise<LoginResponse> {
 }
 
 /**
- * Complete login with 2FA code
- * @param request - Temp token and TOTP code
+ * Complete login with the second factor
+ * @param request - Temp token plus one of: TOTP code, recovery code, or passkey assertion
  * @returns Authentication response with token and user data
  */
 export async function login2FA(request: TotpLogin2FARequest): Promise<AuthResponse> {
@@ -127,6 +137,51 @@ export async function login2FA(request: TotpLogin2FARequest): Promise<AuthRespon
   return data
 }
 
+/**
+ * Get passkey assertion options for a pending 2FA login
+ * @param tempToken - Temporary token from the password step
+ * @returns PublicKeyCredentialRequestOptions in JSON form
+ */
+export async function login2FAPasskeyOptions(tempToken: string): Promise<{ publicKey: Record<string, unknown> }> {
+  const { data } = await apiClient.post<{ publicKey: Record<string, unknown> }>('/auth/login/2fa/passkey/options', {
+    temp_token: tempToken
+  })
+  return data
+}
+
+/**
+ * Start a passwordless passkey login (discoverable credential)
+ * @returns Ceremony session ID and assertion options
+ */
+export async function passkeyLoginOptions(): Promise<PasskeyLoginOptions> {
+  const { data } = await apiClient.post<PasskeyLoginOptions>('/auth/passkey/login/options')
+  return data
+}
+
+/**
+ * Complete a passwordless passkey login
+ * @param sessionId - Session ID returned by passkeyLoginOptions
+ * @param credential - Assertion JSON from navigator.credentials.get()
+ * @returns Authentication response with token and user data
+ */
+export async function passkeyLogin(sessionId: string, credential: Record<string, unknown>): Promise<AuthResponse> {
+  const { data } = await apiClient.post<AuthResponse>('/auth/passkey/login', {
+    session_id: sessionId,
+    credential
+  })
+
+  setAuthToken(data.access_token)
+  if (data.refresh_token) {
+    setRefreshToken(data.refresh_token)
+  }
+  if (data.expires_in) {
+    setTokenExpiresAt(data.expires_in)
+  }
+  localStorage.setItem('auth_user', JSON.stringify(data.user))
+
+  return data
+}
+
 /**
  * User registration
  * @param userData - Registration data (username, email, password)
@@ -339,18 +394,13 @@ export async function resetPassword(request: ResetPasswordRequest): Promise<Rese
  * Complete LinuxDo OAuth registration by supplying an invitation code
  * @param pendingOAuthToken - Short-lived JWT from the OAuth callback
  * @param invitationCode - Invitation code entered by the user
- * @returns Token pair on success
+ * @returns Token pair, or a 2FA challenge when the account has a second factor
  */
 export async function completeLinuxDoOAuthRegistration(
   pendingOAuthToken: string,
   invitationCode: string
-): Promise<{ access_token: string; refresh_token: string; expires_in: number; token_type: string }> {
-  const { data } = await apiClient.post<{
-    access_token: string
-    refresh_token: string
-    expires_in: number
-    token_type: string
-  }>('/auth/oauth/linuxdo/complete-registration', {
+): Promise<OAuthLoginResponse> {
+  const { data } = await apiClient.post<OAuthLoginResponse>('/auth/oauth/linuxdo/complete-registration', {
     pending_oauth_token: pendingOAuthToken,
     invitation_code: invitationCode
   })
@@ -361,27 +411,94 @@ export async function completeLinuxDoOAuthRegistration(
  * Complete OIDC OAuth registration by supplying an invitation code
  * @param pendingOAuthToken - Short-lived JWT from the OAuth callback
  * @param invitationCode - Invitation code entered by the user
- * @returns Token pair on success
+ * @returns Token pair, or a 2FA challenge when the account has a second factor
  */
 export async function completeOIDCOAuthRegistration(
   pendingOAuthToken: string,
   invitationCode: string
-): Promise<{ access_token: string; refresh_token: string; expires_in: number; token_type: string }> {
-  const { data } = await apiClient.post<{
-    access_token: string
-    refresh_token: string
-    expires_in: number
-    token_type: string
-  }>('/auth/oauth/oidc/complete-registration', {
+): Promise<OAuthLoginResponse> {
+  const { data } = await apiClient.post<OAuthLoginResponse>('/auth/oauth/oidc/complete-registration', {
     pending_oauth_token: pendingOAuthToken,
     invitation_code: invitationCode
   })
   return data
 }
 
+/**
+ * Sign in with directory (LDAP / Active Directory) credentials
+ * @param username - Directory username (e.g. sAMAccountName)
+ * @param password - Directory password
+ * @param affCode - Optional referral code, applied on first registration only
+ * @returns Token pair, a 2FA challenge, or a pending token when an invitation code or account link is required
+ */
+export async function ldapLogin(
+  username: string,
+  password: string,
+  affCode?: string
+): Promise<{
+  access_token?: string
+  refresh_token?: string
+  expires_in?: number
+  token_type?: string
+  error?: 'invitation_required' | 'link_required'
+  pending_oauth_token?: string
+  frontend_callback?: string
+  requires_2fa?: boolean
+  temp_token?: string
+  user_email_masked?: string
+  methods?: TwoFactorMethod[]
+}> {
+  const { data } = await apiClient.post('/auth/ldap/login', {
+    username,
+    password,
+    aff_code: affCode
+  })
+  return data
+}
+
+/**
+ * Complete LDAP / SAML registration by supplying an invitation code
+ * @param pendingOAuthToken - Short-lived JWT from the directory login
+ * @param invitationCode - Invitation code entered by the user
+ * @param affCode - Optional referral code carried through the login
+ * @returns Token pair, or a 2FA challenge when the account has a second factor
+ */
+export async function completeDirectorySSORegistration(
+  pendingOAuthToken: string,
+  invitationCode: string,
+  affCode?: string
+): Promise<OAuthLoginResponse> {
+  const { data } = await apiClient.post<OAuthLoginResponse>('/auth/sso/complete-registration', {
+    pending_oauth_token: pendingOAuthToken,
+    invitation_code: invitationCode,
+    aff_code: affCode
+  })
+  return data
+}
+
+/**
+ * Link an LDAP / SAML identity to the existing local account with the same email
+ * @param pendingOAuthToken - Short-lived JWT from the directory login
+ * @param password - Password of the existing local account
+ * @returns Token pair, or a 2FA challenge when the account has a second factor
+ */
+export async function linkDirectoryAccount(
+  pendingOAuthToken: string,
+  password: string
+): Promise<OAuthLoginResponse> {
+  const { data } = await apiClient.post<OAuthLoginResponse>('/auth/sso/link', {
+    pending_oauth_token: pendingOAuthToken,
+    password
+  })
+  return data
+}
+
 export const authAPI = {
   login,
   login2FA,
+  login2FAPasskeyOptions,
+  passkeyLoginOptions,
+  passkeyLogin,
   isTotp2FARequired,
   register,
   getCurrentUser,
@@ -403,7 +520,10 @@ export const authAPI = {
   refreshToken,
   revokeAllSessions,
   completeLinuxDoOAuthRegistration,
-  completeOIDCOAuthRegistration
+  completeOIDCOAuthRegistration,
+  ldapLogin,
+  completeDirectorySSORegistration,
+  linkDirectoryAccount
 }
 
 export default authAPI
@@ -14,9 +14,11 @@ export { keysAPI } from './keys'
 export { usageAPI } from './usage'
 export { userAPI } from './user'
 export { redeemAPI, type RedeemHistoryItem } from './redeem'
+export { oauthAPI, type OAuthConsent, type OAuthGrant } from './oauth'
 export { paymentAPI } from './payment'
 export { userGroupsAPI } from './groups'
 export { totpAPI } from './totp'
+export { passkeyAPI } from './passkey'
 export { default as announcementsAPI } from './announcements'
 
 // Admin APIs
@@ -0,0 +1,128 @@
+/**
+ * OAuth authorization server API endpoints
+ * Consent screen for CLI device-code and PKCE logins, plus authorized client management
+ */
+
+import { apiClient } from './client'
+
+export interface OAuthConsentGroup {
+  id: number
+  name: string
+  description: string
+  platform: string
+  rate_multiplier: number
+}
+
+export interface OAuthConsent {
+  client_id: string
+  client_name: string
+  scope: string
+  offline_access: boolean
+  key_ttl_seconds: number
+  groups: OAuthConsentGroup[]
+  user_code?: string
+}
+
+export interface OAuthAuthorizeParams {
+  client_id: string
+  redirect_uri: string
+  scope?: string
+  state?: string
+  code_challenge: string
+  code_challenge_method: string
+}
+
+export interface OAuthGrant {
+  id: number
+  client_id: string
+  client_name: string
+  group_id: number
+  scope: string
+  api_key_id: number
+  api_key_name?: string
+  api_key_status?: string
+  api_key_expires_at?: string
+  api_key_deleted: boolean
+  refresh_expires_at?: string
+  last_refreshed_at?: string
+  revoked_at?: string
+  created_at: string
+}
+
+/**
+ * Load the consent screen for a device user code
+ */
+export async function getDeviceConsent(userCode: string): Promise<OAuthConsent> {
+  const { data } = await apiClient.get<OAuthConsent>('/oauth/consent', {
+    params: { user_code: userCode }
+  })
+  return data
+}
+
+/**
+ * Load the consent screen for an authorization code request
+ */
+export async function getAuthorizeConsent(params: OAuthAuthorizeParams): Promise<OAuthConsent> {
+  const { data } = await apiClient.get<OAuthConsent>('/oauth/consent', { params })
+  return data
+}
+
+/**
+ * Approve or deny a device code
+ */
+export async function approveDevice(
+  userCode: string,
+  groupId: number,
+  approve: boolean
+): Promise<{ approved: boolean }> {
+  const { data } = await apiClient.post<{ approved: boolean }>('/oauth/device/approve', {
+    user_code: userCode,
+    group_id: groupId,
+    approve
+  })
+  return data
+}
+
+/**
+ * Approve or deny an authorization code request
+ * @returns The client redirect URL carrying the code (or error) and state
+ */
+export async function authorize(
+  params: OAuthAuthorizeParams,
+  groupId: number,
+  approve: boolean
+): Promise<{ redirect_url: string }> {
+  const { data } = await apiClient.post<{ redirect_url: string }>('/oauth/authorize', {
+    ...params,
+    group_id: groupId,
+    approve
+  })
+  return data
+}
+
+/**
+ * List CLI clients the current user has authorized
+ */
+export async function listGrants(): Promise<OAuthGrant[]> {
+  const { data } = await apiClient.get<OAuthGrant[]>('/oauth/grants')
+  return data
+}
+
+/**
+ * Revoke an authorization and delete the key it issued
+ */
+export async function revokeGrant(id: number): Promise<{ message: string }> {
+  const { data } = await apiClient.delete<{ message: string }>(`/oauth/grants/${id}`)
+  return data
+}
+
+export const oauthAPI = {
+  getDeviceConsent,
+  getAuthorizeConsent,
+  approveDevice,
+  authorize,
+  listGrants,
+  revokeGrant
+}
+
+export default oauthAPI
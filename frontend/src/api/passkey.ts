@@ -0,0 +1,89 @@
+/**
+ * Passkey (WebAuthn) and recovery code API endpoints
+ * Manages the current user's passkeys and 2FA recovery codes
+ */
+
+import { apiClient } from './client'
+import type {
+  PasskeyListResponse,
+  PasskeyIdentityRequest,
+  PasskeyRegisterResponse,
+  RecoveryCodeStatus
+} from '@/types'
+
+/**
+ * List passkeys registered by the current user
+ * @returns Feature availability and the passkey list
+ */
+export async function list(): Promise<PasskeyListResponse> {
+  const { data } = await apiClient.get<PasskeyListResponse>('/user/passkeys')
+  return data
+}
+
+/**
+ * Start passkey registration
+ * @param request - Email code or password depending on verification method
+ * @returns PublicKeyCredentialCreationOptions in JSON form
+ */
+export async function registerOptions(request?: PasskeyIdentityRequest): Promise<{ publicKey: Record<string, unknown> }> {
+  const { data } = await apiClient.post<{ publicKey: Record<string, unknown> }>('/user/passkeys/register/options', request || {})
+  return data
+}
+
+/**
+ * Finish passkey registration
+ * @param name - Display name for the passkey
+ * @param credential - Credential JSON from navigator.credentials.create()
+ * @returns The saved passkey, plus recovery codes when this is the first second factor
+ */
+export async function register(name: string, credential: Record<string, unknown>): Promise<PasskeyRegisterResponse> {
+  const { data } = await apiClient.post<PasskeyRegisterResponse>('/user/passkeys/register', { name, credential })
+  return data
+}
+
+/**
+ * Rename a passkey
+ */
+export async function rename(id: number, name: string): Promise<{ success: boolean }> {
+  const { data } = await apiClient.patch<{ success: boolean }>(`/user/passkeys/${id}`, { name })
+  return data
+}
+
+/**
+ * Delete a passkey
+ * @param request - Email code or password depending on verification method
+ */
+export async function remove(id: number, request?: PasskeyIdentityRequest): Promise<{ success: boolean }> {
+  const { data } = await apiClient.delete<{ success: boolean }>(`/user/passkeys/${id}`, { data: request || {} })
+  return data
+}
+
+/**
+ * Get remaining recovery code count
+ */
+export async function getRecoveryCodeStatus(): Promise<RecoveryCodeStatus> {
+  const { data } = await apiClient.get<RecoveryCodeStatus>('/user/recovery-codes')
+  return data
+}
+
+/**
+ * Invalidate existing recovery codes and issue a new set
+ * @param request - Email code or password depending on verification method
+ * @returns The new recovery codes (shown once)
+ */
+export async function regenerateRecoveryCodes(request?: PasskeyIdentityRequest): Promise<{ recovery_codes: string[] }> {
+  const { data } = await apiClient.post<{ recovery_codes: string[] }>('/user/recovery-codes/regenerate', request || {})
+  return data
+}
+
+export const passkeyAPI = {
+  list,
+  registerOptions,
+  register,
+  rename,
+  remove,
+  getRecoveryCodeStatus,
+  regenerateRecoveryCodes
+}
+
+export default passkeyAPI
@@ -0,0 +1,90 @@
+import { ref } from 'vue'
+import { useRouter } from 'vue-router'
+import { useI18n } from 'vue-i18n'
+import type TotpLoginModal from '@/components/auth/TotpLoginModal.vue'
+import { useAppStore, useAuthStore } from '@/stores'
+import type { TotpLoginResponse, TwoFactorMethod } from '@/types'
+
+const knownMethods: TwoFactorMethod[] = ['totp', 'passkey', 'recovery_code']
+
+/**
+ * 第三方登录（LinuxDo / OIDC / LDAP / SAML）回调页的第二步验证。
+ * 需要 2FA 时后端不下发 token，而是返回与密码登录相同的挑战（temp_token + methods），
+ * 这里用 TotpLoginModal 收集验证码 / 通行密钥 / 恢复码并通过 /auth/login/2fa 完成登录。
+ */
+export function useSSOTwoFactor() {
+  const router = useRouter()
+  const { t } = useI18n()
+  const authStore = useAuthStore()
+  const appStore = useAppStore()
+
+  const show2FAModal = ref(false)
+  const totpTempToken = ref('')
+  const totpUserEmailMasked = ref('')
+  const totpMethods = ref<TwoFactorMethod[]>([])
+  const totpModalRef = ref<InstanceType<typeof TotpLoginModal> | null>(null)
+  const redirectAfter2FA = ref('/dashboard')
+
+  function start2FA(challenge: TotpLoginResponse, redirect: string): void {
+    totpTempToken.value = challenge.temp_token || ''
+    totpUserEmailMasked.value = challenge.user_email_masked || ''
+    totpMethods.value = challenge.methods || []
+    redirectAfter2FA.value = redirect
+    show2FAModal.value = true
+  }
+
+  /** 回调 fragment 携带 requires_2fa 时弹出验证框，返回是否已处理 */
+  function start2FAFromFragment(params: URLSearchParams, redirect: string): boolean {
+    if (params.get('requires_2fa') !== 'true') return false
+    const methods = (params.get('methods') || '')
+      .split(',')
+      .filter((m): m is TwoFactorMethod => knownMethods.includes(m as TwoFactorMethod))
+    start2FA(
+      {
+        requires_2fa: true,
+        temp_token: params.get('temp_token') || '',
+        user_email_masked: params.get('user_email_masked') || '',
+        methods
+      },
+      redirect
+    )
+    return true
+  }
+
+  async function handle2FAVerify(
+    factor: string | { recovery_code?: string; webauthn?: unknown }
+  ): Promise<void> {
+    totpModalRef.value?.setVerifying(true)
+    try {
+      await authStore.login2FA(totpTempToken.value, factor)
+      show2FAModal.value = false
+      appStore.showSuccess(t('auth.loginSuccess'))
+      await router.replace(redirectAfter2FA.value)
+    } catch (error: unknown) {
+      const err = error as { message?: string; response?: { data?: { message?: string } } }
+      const message = err.response?.data?.message || err.message || t('profile.totp.loginFailed')
+      totpModalRef.value?.setError(message)
+      totpModalRef.value?.setVerifying(false)
+    }
+  }
+
+  async function handle2FACancel(): Promise<void> {
+    show2FAModal.value = false
+    totpTempToken.value = ''
+    totpUserEmailMasked.value = ''
+    totpMethods.value = []
+    await router.replace('/login')
+  }
+
+  return {
+    show2FAModal,
+    totpTempToken,
+    totpUserEmailMasked,
+    totpMethods,
+    totpModalRef,
+    start2FA,
+    start2FAFromFragment,
+    handle2FAVerify,
+    handle2FACancel
+  }
+}
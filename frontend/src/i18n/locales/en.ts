@@ -452,6 +452,16 @@ export default {
       completing: 'Completing registration…',
       completeRegistrationFailed: 'Registration failed. Please check your invitation code and try again.'
     },
+    ldap: {
+      signIn: 'Sign in with {providerName}',
+      usernamePlaceholder: 'Directory username',
+      passwordPlaceholder: 'Directory password',
+      loginFailed: 'Directory sign-in failed. Please check your username and password.'
+    },
+    passkey: {
+      signIn: 'Sign in with a passkey',
+      failed: 'Passkey sign-in failed, please try again'
+    },
     oidc: {
       signIn: 'Continue with {providerName}',
       callbackTitle: 'Signing you in with {providerName}',
@@ -464,7 +474,13 @@ export default {
       invalidPendingToken: 'The registration token has expired. Please sign in again.',
       completeRegistration: 'Complete Registration',
       completing: 'Completing registration…',
-      completeRegistrationFailed: 'Registration failed. Please check your invitation code and try again.'
+      completeRegistrationFailed: 'Registration failed. Please check your invitation code and try again.',
+      linkRequired:
+        'An account with this email already exists. Enter its password to link it to your {providerName} account. If you have never set a password, use "Forgot password" first.',
+      linkPasswordPlaceholder: 'Password of the existing account',
+      linkAccount: 'Link Account',
+      linking: 'Linking account…',
+      linkFailed: 'Linking failed. Please check the password and try again.'
     },
     oauth: {
       code: 'Code',
@@ -799,6 +815,37 @@ export default {
     userAgent: 'User-Agent'
   },
 
+  // OAuth consent (CLI login)
+  oauthConsent: {
+    deviceTitle: 'Authorize Device',
+    authorizeTitle: 'Authorize Application',
+    description: 'Let a CLI tool obtain a short-lived API key for one of your groups',
+    userCodeLabel: 'Device Code',
+    userCodeHint: 'Enter the code shown in your terminal',
+    continue: 'Continue',
+    requestTitle: '{client} wants to access your account',
+    grantKey: 'Create an API key bound to the selected group, valid for {duration}',
+    grantOffline: 'Keep renewing the key until you revoke access',
+    grantRevocable: 'You can revoke access at any time here or by deleting the key',
+    selectGroup: 'Select a group',
+    noGroups: 'No available group matches the requested scope',
+    approve: 'Authorize',
+    deny: 'Deny',
+    approvedMessage: 'Authorized. You can return to your terminal.',
+    deniedMessage: 'Request denied. You can close this page.',
+    loadFailed: 'Failed to load the authorization request',
+    submitFailed: 'Failed to submit the authorization',
+    authorizedClients: 'Authorized CLI Clients',
+    noAuthorizedClients: 'No CLI clients have been authorized',
+    revoke: 'Revoke',
+    revokeConfirm: 'Revoke access for {client}? Its API key will be deleted.',
+    revoked: 'Access revoked',
+    revokeFailed: 'Failed to revoke access',
+    minutes: '{n} minutes',
+    hours: '{n} hours',
+    days: '{n} days'
+  },
+
   // Redeem
   redeem: {
     title: 'Redeem Code',
@@ -906,7 +953,47 @@ export default {
       enterEmailCode: 'Enter 6-digit code',
       sendCode: 'Send Code',
       codeSent: 'Verification code sent to your email',
-      sendCodeFailed: 'Failed to send verification code'
+      sendCodeFailed: 'Failed to send verification code',
+      passkeyLoginHint: 'Confirm sign-in with one of your registered passkeys',
+      recoveryCodeLoginHint: 'Enter one of your recovery codes. Each code can only be used once.',
+      recoveryCodePlaceholder: 'xxxxx-xxxxx',
+      usePasskeyButton: 'Use passkey',
+      useTotp: 'Use authenticator app instead',
+      usePasskey: 'Use a passkey instead',
+      useRecoveryCode: 'Use a recovery code instead'
+    },
+    passkey: {
+      title: 'Passkeys & Recovery Codes',
+      description: 'Sign in without a password, or use a passkey as your second factor',
+      empty: 'No passkeys registered yet',
+      nameLabel: 'Passkey name',
+      namePlaceholder: 'e.g. MacBook Touch ID',
+      add: 'Add Passkey',
+      addTitle: 'Add a Passkey',
+      addHint: 'Verify your identity, then follow the browser prompt to create the passkey.',
+      addSuccess: 'Passkey added',
+      rename: 'Rename',
+      deleteTitle: 'Delete Passkey',
+      deleteHint: 'Delete "{name}"? It can no longer be used to sign in.',
+      deleteSuccess: 'Passkey deleted',
+      synced: 'Synced',
+      createdAt: 'Added',
+      lastUsedAt: 'Last used',
+      notSupported: 'This browser does not support passkeys',
+      cancelled: 'The passkey prompt was cancelled or timed out'
+    },
+    recoveryCodes: {
+      title: 'Recovery Codes',
+      remaining: '{remaining} of {total} codes remaining',
+      regenerate: 'Regenerate',
+      regenerateTitle: 'Regenerate Recovery Codes',
+      regenerateHint: 'All existing recovery codes will stop working.',
+      savedTitle: 'Save Your Recovery Codes',
+      savedHint: 'Each code can be used once to sign in if you lose access to your authenticator or passkeys. They will not be shown again.',
+      copy: 'Copy',
+      copied: 'Recovery codes copied',
+      download: 'Download',
+      acknowledge: "I've saved these codes"
     },
     balanceNotify: {
       title: 'Balance Low Notification',
@@ -1876,6 +1963,8 @@ export default {
         webSearchEmulation: 'Web Search Emulation',
         webSearchEmulationHint: '⚠️ When enabled, all accounts in this channel\'s Anthropic groups will intercept web_search requests. Use with caution.',
         webSearchEmulationGlobalDisabled: 'Please enable the global switch first in Settings → Gateway → Web Search Emulation',
+        webFetchEmulation: 'Web Fetch Emulation',
+        webFetchEmulationHint: '⚠️ When enabled, the gateway fetches web_fetch URLs for this channel\'s Anthropic groups through the account proxy. Only public hosts (or security.url_allowlist.web_fetch_hosts) are reachable.',
         basicSettings: 'Basic Settings',
         addPlatform: 'Add Platform',
         noPlatforms: 'Click "Add Platform" to start configuring the channel',
@@ -2340,6 +2429,10 @@ export default {
       claudeConsole: 'Claude Console',
       bedrockLabel: 'AWS Bedrock',
       bedrockDesc: 'SigV4 / API Key',
+      vertexLabel: 'Vertex AI',
+      vertexDesc: 'GCP Service Account',
+      azureLabel: 'Azure OpenAI',
+      azureDesc: 'Azure Resource Deployments',
       oauthSetupToken: 'OAuth / Setup Token',
       addMethod: 'Add Method',
       setupTokenLongLived: 'Setup Token (Long-lived)',
@@ -2577,6 +2670,32 @@ export default {
       bedrockApiKeyInput: 'API Key',
       bedrockApiKeyRequired: 'Please enter Bedrock API Key',
       bedrockApiKeyLeaveEmpty: 'Leave empty to keep current key',
+      vertexServiceAccountJson: 'Service Account JSON',
+      vertexServiceAccountJsonHint: 'Paste the full service account key file; the service account needs the Vertex AI User role',
+      vertexServiceAccountJsonLeaveEmpty: 'Leave empty to keep current service account key',
+      vertexServiceAccountJsonInvalid: 'Invalid service account JSON (client_email and private_key are required)',
+      vertexProjectId: 'GCP Project ID',
+      vertexProjectIdPlaceholder: 'Defaults to project_id in the service account JSON',
+      vertexProjectIdRequired: 'Please enter GCP Project ID',
+      vertexRegion: 'Region',
+      vertexRegionHint: 'e.g. global, us-east5, europe-west1; defaults to global',
+      vertexModelMappingHint: 'Claude model IDs are converted to the Vertex form automatically (claude-sonnet-4-5-20250929 → claude-sonnet-4-5@20250929)',
+      azureEndpoint: 'Resource Endpoint',
+      azureEndpointHint: 'Azure OpenAI resource endpoint, e.g. https://my-resource.openai.azure.com',
+      azureEndpointRequired: 'Please enter the Azure resource endpoint',
+      azureApiVersion: 'API Version',
+      azureApiVersionHint: 'Defaults to 2025-04-01-preview; use v1 for the /openai/v1 API (no api-version query)',
+      azureUpstreamApi: 'Upstream API',
+      azureUpstreamApiHint: 'Chat Completions applies to /v1/chat/completions for deployments without the Responses API; /v1/responses and /v1/messages always use the Responses API',
+      azureAuthMode: 'Authentication',
+      azureTenantId: 'Tenant ID',
+      azureClientId: 'Client ID',
+      azureClientSecret: 'Client Secret',
+      azureEntraHint: 'The app registration needs the Cognitive Services OpenAI User role on the resource',
+      azureEntraRequired: 'Tenant ID, Client ID and Client Secret are required for Entra ID authentication',
+      azureDeploymentMapping: 'Deployment Mapping',
+      azureDeploymentMappingHint: 'Map model names to Azure deployment names (wildcards supported); unmapped models use the model name as deployment',
+      azureDeploymentName: 'Deployment name',
       apiKeyIsRequired: 'API Key is required',
       leaveEmptyToKeep: 'Leave empty to keep current key',
       // Upstream type
@@ -4295,7 +4414,13 @@ export default {
         totp: 'Two-Factor Authentication (2FA)',
         totpHint: 'Allow users to use authenticator apps like Google Authenticator',
         totpKeyNotConfigured:
-          'Please configure TOTP_ENCRYPTION_KEY in environment variables first. Generate a key with: openssl rand -hex 32'
+          'Please configure TOTP_ENCRYPTION_KEY in environment variables first. Generate a key with: openssl rand -hex 32',
+        requirePasskeyForAdmins: 'Require Passkeys for Admins',
+        requirePasskeyForAdminsHint:
+          'Admin accounts must complete sign-in with a passkey (or a recovery code). Every active admin needs a registered passkey before this can be enabled.',
+        passkeyNotConfigured: 'Enable webauthn in the server config file (rp_id and rp_origins) first.',
+        passkeyConfigInvalid:
+          'The webauthn server config is invalid ({error}). Passkeys are unavailable, so admins required to use a passkey can only sign in with recovery codes until it is fixed.'
       },
       turnstile: {
         title: 'Cloudflare Turnstile',
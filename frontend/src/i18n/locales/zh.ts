@@ -451,6 +451,16 @@ export default {
       completing: '正在完成注册...',
       completeRegistrationFailed: '注册失败，请检查邀请码后重试。'
     },
+    ldap: {
+      signIn: '使用 {providerName} 账号登录',
+      usernamePlaceholder: '目录用户名',
+      passwordPlaceholder: '目录密码',
+      loginFailed: '目录登录失败，请检查用户名和密码'
+    },
+    passkey: {
+      signIn: '使用通行密钥登录',
+      failed: '通行密钥登录失败，请重试'
+    },
     oidc: {
       signIn: '使用 {providerName} 登录',
       callbackTitle: '正在完成 {providerName} 登录',
@@ -462,7 +472,12 @@ export default {
       invalidPendingToken: '注册凭证已失效，请重新登录。',
       completeRegistration: '完成注册',
       completing: '正在完成注册...',
-      completeRegistrationFailed: '注册失败，请检查邀请码后重试。'
+      completeRegistrationFailed: '注册失败，请检查邀请码后重试。',
+      linkRequired: '该邮箱已有账号，请输入该账号的密码以关联 {providerName} 身份。如从未设置过密码，请先通过“忘记密码”设置。',
+      linkPasswordPlaceholder: '已有账号的密码',
+      linkAccount: '关联账号',
+      linking: '正在关联账号...',
+      linkFailed: '关联失败，请检查密码后重试。'
     },
     oauth: {
       code: '授权码',
@@ -803,6 +818,37 @@ export default {
     userAgent: 'User-Agent'
   },
 
+  // OAuth 授权（CLI 登录）
+  oauthConsent: {
+    deviceTitle: '设备授权',
+    authorizeTitle: '应用授权',
+    description: '允许 CLI 工具为你的某个分组获取短期 API Key',
+    userCodeLabel: '设备码',
+    userCodeHint: '输入终端中显示的代码',
+    continue: '继续',
+    requestTitle: '{client} 请求访问你的账户',
+    grantKey: '创建绑定所选分组的 API Key，有效期 {duration}',
+    grantOffline: '在你撤销授权前持续续期该 Key',
+    grantRevocable: '你可以随时在此处撤销授权，或直接删除该 Key',
+    selectGroup: '选择分组',
+    noGroups: '没有符合请求范围的可用分组',
+    approve: '授权',
+    deny: '拒绝',
+    approvedMessage: '授权成功，请返回终端继续。',
+    deniedMessage: '已拒绝该请求，可以关闭此页面。',
+    loadFailed: '加载授权请求失败',
+    submitFailed: '提交授权失败',
+    authorizedClients: '已授权的 CLI 客户端',
+    noAuthorizedClients: '尚未授权任何 CLI 客户端',
+    revoke: '撤销',
+    revokeConfirm: '确定撤销 {client} 的访问权限？其 API Key 将被删除。',
+    revoked: '已撤销授权',
+    revokeFailed: '撤销授权失败',
+    minutes: '{n} 分钟',
+    hours: '{n} 小时',
+    days: '{n} 天'
+  },
+
   // Redeem
   redeem: {
     title: '兑换码',
@@ -910,7 +956,47 @@ export default {
       enterEmailCode: '请输入 6 位验证码',
       sendCode: '发送验证码',
       codeSent: '验证码已发送到您的邮箱',
-      sendCodeFailed: '发送验证码失败'
+      sendCodeFailed: '发送验证码失败',
+      passkeyLoginHint: '请使用已注册的通行密钥确认登录',
+      recoveryCodeLoginHint: '请输入一个恢复码，每个恢复码只能使用一次',
+      recoveryCodePlaceholder: 'xxxxx-xxxxx',
+      usePasskeyButton: '使用通行密钥',
+      useTotp: '改用验证器应用',
+      usePasskey: '改用通行密钥',
+      useRecoveryCode: '改用恢复码'
+    },
+    passkey: {
+      title: '通行密钥与恢复码',
+      description: '无需密码即可登录，或将通行密钥作为第二步验证',
+      empty: '尚未注册通行密钥',
+      nameLabel: '通行密钥名称',
+      namePlaceholder: '例如 MacBook Touch ID',
+      add: '添加通行密钥',
+      addTitle: '添加通行密钥',
+      addHint: '验证身份后，请按浏览器提示创建通行密钥。',
+      addSuccess: '通行密钥已添加',
+      rename: '重命名',
+      deleteTitle: '删除通行密钥',
+      deleteHint: '确定删除「{name}」吗？删除后将无法再用它登录。',
+      deleteSuccess: '通行密钥已删除',
+      synced: '已同步',
+      createdAt: '添加于',
+      lastUsedAt: '最近使用',
+      notSupported: '当前浏览器不支持通行密钥',
+      cancelled: '通行密钥验证已取消或超时'
+    },
+    recoveryCodes: {
+      title: '恢复码',
+      remaining: '剩余 {remaining} / {total} 个',
+      regenerate: '重新生成',
+      regenerateTitle: '重新生成恢复码',
+      regenerateHint: '现有的全部恢复码将立即失效。',
+      savedTitle: '请保存恢复码',
+      savedHint: '丢失验证器或通行密钥时，可使用恢复码登录，每个只能使用一次。关闭后将不再显示。',
+      copy: '复制',
+      copied: '恢复码已复制',
+      download: '下载',
+      acknowledge: '我已保存这些恢复码'
     },
     balanceNotify: {
       title: '余额不足提醒',
@@ -1955,6 +2041,8 @@ export default {
         webSearchEmulation: 'Web Search 模拟',
         webSearchEmulationHint: '⚠️ 开启后该渠道下所有 Anthropic 分组的账号将自动拦截 web_search 请求，请谨慎操作',
         webSearchEmulationGlobalDisabled: '请先在系统设置 → 网关 → Web Search 模拟中启用全局开关',
+        webFetchEmulation: 'Web Fetch 模拟',
+        webFetchEmulationHint: '⚠️ 开启后该渠道下所有 Anthropic 分组的 web_fetch 请求将由网关通过账号代理抓取，仅允许访问公网地址（或 security.url_allowlist.web_fetch_hosts 中的域名）',
         basicSettings: '基础设置',
         addPlatform: '添加平台',
         noPlatforms: '点击"添加平台"开始配置渠道',
@@ -2490,6 +2578,10 @@ export default {
       claudeConsole: 'Claude Console',
       bedrockLabel: 'AWS Bedrock',
       bedrockDesc: 'SigV4 / API Key',
+      vertexLabel: 'Vertex AI',
+      vertexDesc: 'GCP 服务账号',
+      azureLabel: 'Azure OpenAI',
+      azureDesc: 'Azure 资源部署',
       oauthSetupToken: 'OAuth / Setup Token',
       addMethod: '添加方式',
       setupTokenLongLived: 'Setup Token（长期有效）',
@@ -2720,6 +2812,32 @@ export default {
       bedrockApiKeyInput: 'API Key',
       bedrockApiKeyRequired: '请输入 Bedrock API Key',
       bedrockApiKeyLeaveEmpty: '留空以保持当前密钥',
+      vertexServiceAccountJson: '服务账号 JSON',
+      vertexServiceAccountJsonHint: '粘贴完整的服务账号密钥文件，服务账号需具备 Vertex AI User 角色',
+      vertexServiceAccountJsonLeaveEmpty: '留空以保持当前服务账号密钥',
+      vertexServiceAccountJsonInvalid: '服务账号 JSON 无效（需包含 client_email 与 private_key）',
+      vertexProjectId: 'GCP 项目 ID',
+      vertexProjectIdPlaceholder: '默认使用服务账号 JSON 中的 project_id',
+      vertexProjectIdRequired: '请输入 GCP 项目 ID',
+      vertexRegion: '区域',
+      vertexRegionHint: '例如 global、us-east5、europe-west1，默认 global',
+      vertexModelMappingHint: 'Claude 模型 ID 会自动转换为 Vertex 格式（claude-sonnet-4-5-20250929 → claude-sonnet-4-5@20250929）',
+      azureEndpoint: '资源端点',
+      azureEndpointHint: 'Azure OpenAI 资源端点，如 https://my-resource.openai.azure.com',
+      azureEndpointRequired: '请输入 Azure 资源端点',
+      azureApiVersion: 'API 版本',
+      azureApiVersionHint: '默认 2025-04-01-preview；填写 v1 使用 /openai/v1 API（不带 api-version 参数）',
+      azureUpstreamApi: '上游接口',
+      azureUpstreamApiHint: 'Chat Completions 仅作用于 /v1/chat/completions，适用于未开放 Responses API 的部署；/v1/responses 与 /v1/messages 始终使用 Responses API',
+      azureAuthMode: '认证方式',
+      azureTenantId: '租户 ID',
+      azureClientId: '客户端 ID',
+      azureClientSecret: '客户端密钥',
+      azureEntraHint: '应用注册需要在该资源上具有 Cognitive Services OpenAI User 角色',
+      azureEntraRequired: 'Entra ID 认证需要填写租户 ID、客户端 ID 和客户端密钥',
+      azureDeploymentMapping: '部署映射',
+      azureDeploymentMappingHint: '将模型名映射为 Azure 部署名（支持通配符），未映射的模型直接以模型名作为部署名',
+      azureDeploymentName: '部署名',
       apiKeyIsRequired: 'API Key 是必需的',
       leaveEmptyToKeep: '留空以保持当前密钥',
       // Upstream type
@@ -4460,7 +4578,13 @@ export default {
         totp: '双因素认证 (2FA)',
         totpHint: '允许用户使用 Google Authenticator 等应用进行二次验证',
         totpKeyNotConfigured:
-          '请先在环境变量中配置 TOTP_ENCRYPTION_KEY。使用命令 openssl rand -hex 32 生成密钥。'
+          '请先在环境变量中配置 TOTP_ENCRYPTION_KEY。使用命令 openssl rand -hex 32 生成密钥。',
+        requirePasskeyForAdmins: '管理员强制使用通行密钥',
+        requirePasskeyForAdminsHint:
+          '管理员账号必须使用通行密钥（或恢复码）完成登录。启用前所有活跃管理员都需已注册通行密钥。',
+        passkeyNotConfigured: '请先在服务端配置文件中启用 webauthn（rp_id 与 rp_origins）。',
+        passkeyConfigInvalid:
+          '服务端 webauthn 配置无效（{error}）。通行密钥不可用，修复前被要求使用通行密钥的管理员只能用恢复码登录。'
       },
       turnstile: {
         title: 'Cloudflare Turnstile',
@@ -92,6 +92,26 @@ const routes: RouteRecordRaw[] = [
       title: 'OIDC OAuth Callback'
     }
   },
+  {
+    path: '/auth/saml/callback',
+    name: 'SAMLCallback',
+    component: () => import('@/views/auth/OidcCallbackView.vue'),
+    meta: {
+      requiresAuth: false,
+      title: 'SAML Callback',
+      ssoProvider: 'saml'
+    }
+  },
+  {
+    path: '/auth/ldap/callback',
+    name: 'LDAPCallback',
+    component: () => import('@/views/auth/OidcCallbackView.vue'),
+    meta: {
+      requiresAuth: false,
+      title: 'LDAP Callback',
+      ssoProvider: 'ldap'
+    }
+  },
   {
     path: '/forgot-password',
     name: 'ForgotPassword',
@@ -174,6 +194,30 @@ const routes: RouteRecordRaw[] = [
       descriptionKey: 'redeem.description'
     }
   },
+  {
+    path: '/oauth/device',
+    name: 'OAuthDevice',
+    component: () => import('@/views/user/OAuthConsentView.vue'),
+    meta: {
+      requiresAuth: true,
+      requiresAdmin: false,
+      title: 'Authorize Device',
+      titleKey: 'oauthConsent.deviceTitle',
+      descriptionKey: 'oauthConsent.description'
+    }
+  },
+  {
+    path: '/oauth/authorize',
+    name: 'OAuthAuthorize',
+    component: () => import('@/views/user/OAuthConsentView.vue'),
+    meta: {
+      requiresAuth: true,
+      requiresAdmin: false,
+      title: 'Authorize Application',
+      titleKey: 'oauthConsent.authorizeTitle',
+      descriptionKey: 'oauthConsent.description'
+    }
+  },
   {
     path: '/profile',
     name: 'Profile',
@@ -58,5 +58,11 @@ declare module 'vue-router' {
      * i18n key for the page description
      */
     descriptionKey?: string
+
+    /**
+     * SSO provider handled by the shared callback view (OIDC / LDAP / SAML)
+     * @default 'oidc'
+     */
+    ssoProvider?: 'oidc' | 'ldap' | 'saml'
   }
 }
@@ -338,6 +338,11 @@ export const useAppStore = defineStore('app', () => {
         linuxdo_oauth_enabled: false,
         oidc_oauth_enabled: false,
         oidc_oauth_provider_name: 'OIDC',
+        ldap_login_enabled: false,
+        ldap_provider_name: 'LDAP',
+        saml_login_enabled: false,
+        saml_provider_name: 'SAML',
+        passkey_login_enabled: false,
         backend_mode_enabled: false,
         version: siteVersion.value,
         balance_low_notify_enabled: false,
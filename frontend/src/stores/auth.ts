@@ -6,7 +6,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed, readonly } from 'vue'
 import { authAPI, isTotp2FARequired, type LoginResponse } from '@/api'
-import type { User, LoginRequest, RegisterRequest, AuthResponse } from '@/types'
+import type { User, LoginRequest, RegisterRequest, AuthResponse, TotpLogin2FARequest } from '@/types'
 
 const AUTH_TOKEN_KEY = 'auth_token'
 const AUTH_USER_KEY = 'auth_user'
@@ -202,15 +202,36 @@ export const useAuthStore = defineStore('auth', () => {
   }
 
   /**
-   * Complete login with 2FA code
+   * Complete login with the second factor
    * @param tempToken - Temporary token from initial login
-   * @param totpCode - 6-digit TOTP code
+   * @param factor - 6-digit TOTP code, or a recovery code / passkey assertion payload
    * @returns Promise resolving to the authenticated user
    * @throws Error if 2FA verification fails
    */
-  async function login2FA(tempToken: string, totpCode: string): Promise<User> {
+  async function login2FA(
+    tempToken: string,
+    factor: string | Omit<TotpLogin2FARequest, 'temp_token'>
+  ): Promise<User> {
     try {
-      const response = await authAPI.login2FA({ temp_token: tempToken, totp_code: totpCode })
+      const payload = typeof factor === 'string' ? { totp_code: factor } : factor
+      const response = await authAPI.login2FA({ temp_token: tempToken, ...payload })
+      setAuthFromResponse(response)
+      return user.value!
+    } catch (error) {
+      clearAuth()
+      throw error
+    }
+  }
+
+  /**
+   * Passwordless login with a passkey
+   * @param sessionId - Ceremony session ID from passkeyLoginOptions
+   * @param credential - Assertion JSON from navigator.credentials.get()
+   * @returns Promise resolving to the authenticated user
+   */
+  async function passkeyLogin(sessionId: string, credential: Record<string, unknown>): Promise<User> {
+    try {
+      const response = await authAPI.passkeyLogin(sessionId, credential)
       setAuthFromResponse(response)
       return user.value!
     } catch (error) {
@@ -399,6 +420,7 @@ export const useAuthStore = defineStore('auth', () => {
     // Actions
     login,
     login2FA,
+    passkeyLogin,
     register,
     setToken,
     logout,
@@ -125,6 +125,11 @@ export interface PublicSettings {
   linuxdo_oauth_enabled: boolean
   oidc_oauth_enabled: boolean
   oidc_oauth_provider_name: string
+  ldap_login_enabled: boolean
+  ldap_provider_name: string
+  saml_login_enabled: boolean
+  saml_provider_name: string
+  passkey_login_enabled: boolean
   backend_mode_enabled: boolean
   version: string
   balance_low_notify_enabled: boolean
@@ -555,7 +560,7 @@ export interface UpdateGroupRequest {
 // ==================== Account & Proxy Types ====================
 
 export type AccountPlatform = 'anthropic' | 'openai' | 'gemini' | 'antigravity'
-export type AccountType = 'oauth' | 'setup-token' | 'apikey' | 'upstream' | 'bedrock'
+export type AccountType = 'oauth' | 'setup-token' | 'apikey' | 'upstream' | 'bedrock' | 'vertex' | 'azure'
 export type OAuthAddMethod = 'oauth' | 'setup-token'
 export type ProxyProtocol = 'http' | 'https' | 'socks5' | 'socks5h'
 
@@ -1578,6 +1583,7 @@ export interface TotpEnableRequest {
 
 export interface TotpEnableResponse {
   success: boolean
+  recovery_codes?: string[] | null  // Only returned when the first second factor is enabled
 }
 
 export interface TotpDisableRequest {
@@ -1589,15 +1595,55 @@ export interface TotpVerificationMethod {
   method: 'email' | 'password'
 }
 
+export type TwoFactorMethod = 'totp' | 'passkey' | 'recovery_code'
+
 export interface TotpLoginResponse {
   requires_2fa: boolean
   temp_token?: string
   user_email_masked?: string
+  methods?: TwoFactorMethod[]
 }
 
 export interface TotpLogin2FARequest {
   temp_token: string
-  totp_code: string
+  totp_code?: string
+  recovery_code?: string
+  webauthn?: unknown  // PublicKeyCredential JSON from navigator.credentials.get()
+}
+
+// ==================== Passkey (WebAuthn) Types ====================
+
+export interface Passkey {
+  id: number
+  name: string
+  created_at: string
+  last_used_at?: string | null
+  synced: boolean
+}
+
+export interface PasskeyListResponse {
+  enabled: boolean
+  passkeys: Passkey[]
+}
+
+export interface PasskeyIdentityRequest {
+  email_code?: string
+  password?: string
+}
+
+export interface PasskeyRegisterResponse {
+  passkey: Passkey
+  recovery_codes?: string[] | null
+}
+
+export interface PasskeyLoginOptions {
+  session_id: string
+  options: { publicKey: Record<string, unknown> }
+}
+
+export interface RecoveryCodeStatus {
+  remaining: number
+  total: number
 }
 
 // ==================== Scheduled Test Types ====================
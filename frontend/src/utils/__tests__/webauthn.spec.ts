@@ -0,0 +1,24 @@
+import { describe, expect, it } from 'vitest'
+import { base64urlToBuffer, bufferToBase64url, decodeRequestOptions } from '../webauthn'
+
+describe('webauthn', () => {
+  it('base64url 编解码往返一致（无填充）', () => {
+    const bytes = new Uint8Array([0, 250, 251, 252, 253, 254, 255])
+    const encoded = bufferToBase64url(bytes)
+    expect(encoded).not.toMatch(/[+/=]/)
+    expect(new Uint8Array(base64urlToBuffer(encoded))).toEqual(bytes)
+  })
+
+  it('解析断言选项时转换 challenge 与 allowCredentials', () => {
+    const options = decodeRequestOptions({
+      publicKey: {
+        challenge: bufferToBase64url(new Uint8Array([1, 2, 3])),
+        rpId: 'example.com',
+        allowCredentials: [{ type: 'public-key', id: bufferToBase64url(new Uint8Array([9])) }]
+      }
+    })
+    expect(new Uint8Array(options.challenge as ArrayBuffer)).toEqual(new Uint8Array([1, 2, 3]))
+    expect(options.rpId).toBe('example.com')
+    expect(new Uint8Array(options.allowCredentials![0].id as ArrayBuffer)).toEqual(new Uint8Array([9]))
+  })
+})
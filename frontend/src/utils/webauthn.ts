@@ -0,0 +1,105 @@
+/**
+ * WebAuthn helpers.
+ * The backend speaks the JSON form of the WebAuthn options/credentials where
+ * every binary field is base64url; the browser API wants ArrayBuffers.
+ */
+
+type JsonOptions = Record<string, any>
+
+export function isWebAuthnSupported(): boolean {
+  return typeof window !== 'undefined' && typeof window.PublicKeyCredential === 'function' && !!navigator.credentials
+}
+
+export function base64urlToBuffer(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/')
+  const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4)
+  const binary = atob(padded)
+  const bytes = new Uint8Array(binary.length)
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i)
+  }
+  return bytes.buffer as ArrayBuffer
+}
+
+export function bufferToBase64url(buffer: ArrayBuffer | ArrayBufferView): string {
+  const bytes = buffer instanceof ArrayBuffer
+    ? new Uint8Array(buffer)
+    : new Uint8Array(buffer.buffer, buffer.byteOffset, buffer.byteLength)
+  let binary = ''
+  for (let i = 0; i < bytes.length; i++) {
+    binary += String.fromCharCode(bytes[i])
+  }
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+}
+
+function decodeDescriptors(list?: JsonOptions[]): PublicKeyCredentialDescriptor[] | undefined {
+  return list?.map((item) => ({ ...item, id: base64urlToBuffer(item.id) }) as PublicKeyCredentialDescriptor)
+}
+
+/** Convert server creation options ({ publicKey }) into navigator.credentials.create() input */
+export function decodeCreationOptions(options: { publicKey: JsonOptions }): PublicKeyCredentialCreationOptions {
+  const pk = options.publicKey
+  return {
+    ...pk,
+    challenge: base64urlToBuffer(pk.challenge),
+    user: { ...pk.user, id: base64urlToBuffer(pk.user.id) },
+    excludeCredentials: decodeDescriptors(pk.excludeCredentials)
+  } as PublicKeyCredentialCreationOptions
+}
+
+/** Convert server assertion options ({ publicKey }) into navigator.credentials.get() input */
+export function decodeRequestOptions(options: { publicKey: JsonOptions }): PublicKeyCredentialRequestOptions {
+  const pk = options.publicKey
+  return {
+    ...pk,
+    challenge: base64urlToBuffer(pk.challenge),
+    allowCredentials: decodeDescriptors(pk.allowCredentials)
+  } as PublicKeyCredentialRequestOptions
+}
+
+/** Serialize a PublicKeyCredential into the JSON shape the backend parses */
+export function encodeCredential(credential: PublicKeyCredential): Record<string, unknown> {
+  const response = credential.response as AuthenticatorAttestationResponse & AuthenticatorAssertionResponse
+  const encoded: Record<string, unknown> = {
+    clientDataJSON: bufferToBase64url(response.clientDataJSON)
+  }
+  if (response.attestationObject) {
+    encoded.attestationObject = bufferToBase64url(response.attestationObject)
+    if (typeof response.getTransports === 'function') {
+      encoded.transports = response.getTransports()
+    }
+  }
+  if (response.authenticatorData) {
+    encoded.authenticatorData = bufferToBase64url(response.authenticatorData)
+    encoded.signature = bufferToBase64url(response.signature)
+    if (response.userHandle) {
+      encoded.userHandle = bufferToBase64url(response.userHandle)
+    }
+  }
+  return {
+    id: credential.id,
+    rawId: bufferToBase64url(credential.rawId),
+    type: credential.type,
+    authenticatorAttachment: credential.authenticatorAttachment ?? undefined,
+    clientExtensionResults: credential.getClientExtensionResults(),
+    response: encoded
+  }
+}
+
+/** Run navigator.credentials.create() with server options and return the JSON credential */
+export async function createPasskeyCredential(options: { publicKey: JsonOptions }): Promise<Record<string, unknown>> {
+  const credential = await navigator.credentials.create({ publicKey: decodeCreationOptions(options) })
+  if (!credential) {
+    throw new Error('No credential returned')
+  }
+  return encodeCredential(credential as PublicKeyCredential)
+}
+
+/** Run navigator.credentials.get() with server options and return the JSON credential */
+export async function getPasskeyAssertion(options: { publicKey: JsonOptions }): Promise<Record<string, unknown>> {
+  const credential = await navigator.credentials.get({ publicKey: decodeRequestOptions(options) })
+  if (!credential) {
+    throw new Error('No credential returned')
+  }
+  return encodeCredential(credential as PublicKeyCredential)
+}